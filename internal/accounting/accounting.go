@@ -0,0 +1,276 @@
+// Package accounting records per-session usage and summarizes it into reports.
+package accounting
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
+)
+
+// Record describes one finished, authenticated session.
+type Record struct {
+	SessionID string    `json:"session_id"`
+	Username  string    `json:"username"`
+	Client    string    `json:"client"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	BytesIn   int64     `json:"bytes_in"`            // Bytes received from the client
+	BytesOut  int64     `json:"bytes_out"`           // Bytes sent to the client
+	Node      string    `json:"node,omitempty"`      // Instance that served the session in cluster mode
+	Recovered bool      `json:"recovered,omitempty"` // Recorded from a checkpoint after the server stopped unexpectedly
+}
+
+// Duration returns how long the session was connected.
+func (r Record) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Store is an append-only JSON Lines file of session records. In cluster mode the
+// records are kept in a shared Redis list instead, so reports cover every node.
+type Store struct {
+	filePath string
+	mutex    sync.Mutex
+	shared   *redis.Client // Cluster backend; nil keeps records in filePath
+}
+
+// NewStore returns a store backed by dbPath, or by the usage log in the config
+// directory if dbPath is empty.
+func NewStore(dbPath string) *Store {
+	if dbPath == "" {
+		configPath, err := config.GetUsagePath()
+		if err != nil {
+			// Fallback to current directory if config dir fails
+			dbPath = "usage.jsonl"
+		} else {
+			dbPath = configPath
+		}
+	}
+	return &Store{filePath: dbPath, shared: cluster.Client()}
+}
+
+// Append writes a record to the end of the store.
+func (st *Store) Append(rec Record) error {
+	if st.shared != nil && rec.Node == "" {
+		rec.Node = cluster.NodeName
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if st.shared != nil {
+		return st.shared.RPush(cluster.Key("usage"), string(data))
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	file, err := os.OpenFile(st.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Records returns the records of sessions that ended in [from, to).
+func (st *Store) Records(from, to time.Time) ([]Record, error) {
+	if st.shared != nil {
+		return st.sharedRecords(from, to)
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	file, err := os.Open(st.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", st.filePath, line, err)
+		}
+		if !rec.End.Before(from) && rec.End.Before(to) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// sharedRecords is Records for the cluster backend.
+func (st *Store) sharedRecords(from, to time.Time) ([]Record, error) {
+	lines, err := st.shared.LRange(cluster.Key("usage"), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for i, line := range lines {
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("%s[%d]: %v", cluster.Key("usage"), i, err)
+		}
+		if !rec.End.Before(from) && rec.End.Before(to) {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// UserUsage is the usage of one user over a report period.
+type UserUsage struct {
+	Username  string
+	Sessions  int
+	BytesIn   int64
+	BytesOut  int64
+	Connected time.Duration
+	Recovered int // Sessions recorded from checkpoints, whose usage may be incomplete
+}
+
+// Bytes returns the total bytes transferred in both directions.
+func (u UserUsage) Bytes() int64 {
+	return u.BytesIn + u.BytesOut
+}
+
+// Summarize totals records per user, sorted by username.
+func Summarize(records []Record) []UserUsage {
+	byUser := make(map[string]*UserUsage)
+	for _, rec := range records {
+		u, ok := byUser[rec.Username]
+		if !ok {
+			u = &UserUsage{Username: rec.Username}
+			byUser[rec.Username] = u
+		}
+		u.Sessions++
+		u.BytesIn += rec.BytesIn
+		u.BytesOut += rec.BytesOut
+		u.Connected += rec.Duration()
+		if rec.Recovered {
+			u.Recovered++
+		}
+	}
+
+	usage := make([]UserUsage, 0, len(byUser))
+	for _, u := range byUser {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Username < usage[j].Username })
+	return usage
+}
+
+// MonthRange parses a month in the form "2006-01" and returns its first instant and
+// the first instant of the following month, in the server's local time zone.
+func MonthRange(month string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q: expected YYYY-MM", month)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// Report formats
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// reportHeader lists the report columns in order.
+var reportHeader = []string{"username", "sessions", "bytes_in", "bytes_out", "bytes_total", "hours_connected", "recovered_sessions"}
+
+// hours formats a duration as decimal hours.
+func hours(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours(), 'f', 2, 64)
+}
+
+// WriteReport writes usage to w in the given format.
+func WriteReport(w io.Writer, usage []UserUsage, format string) error {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(reportHeader)
+		for _, u := range usage {
+			cw.Write([]string{
+				u.Username,
+				strconv.Itoa(u.Sessions),
+				strconv.FormatInt(u.BytesIn, 10),
+				strconv.FormatInt(u.BytesOut, 10),
+				strconv.FormatInt(u.Bytes(), 10),
+				hours(u.Connected),
+				strconv.Itoa(u.Recovered),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case FormatJSON:
+		rows := make([]map[string]any, 0, len(usage))
+		for _, u := range usage {
+			rows = append(rows, map[string]any{
+				"username":           u.Username,
+				"sessions":           u.Sessions,
+				"bytes_in":           u.BytesIn,
+				"bytes_out":          u.BytesOut,
+				"bytes_total":        u.Bytes(),
+				"hours_connected":    u.Connected.Hours(),
+				"recovered_sessions": u.Recovered,
+			})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "Username\tSessions\tIn\tOut\tTotal\tHours\tRecovered")
+		for _, u := range usage {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%d\n",
+				u.Username, u.Sessions,
+				FormatBytes(u.BytesIn), FormatBytes(u.BytesOut), FormatBytes(u.Bytes()),
+				hours(u.Connected), u.Recovered)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown format %q (expected table, csv or json)", format)
+	}
+}
+
+// FormatBytes formats n using binary units, e.g. "1.5 GiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,63 @@
+// Package alert notifies operators of notable server events through a webhook.
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// WebhookURL receives a JSON POST for every alert. It is read from
+// SSH_IFY_ALERT_WEBHOOK; when empty, alerts are only logged.
+var WebhookURL = config.Env("SSH_IFY_ALERT_WEBHOOK", "")
+
+// Timeout bounds each webhook delivery.
+const Timeout = 10 * time.Second
+
+// Event is the JSON body posted to the webhook.
+type Event struct {
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Node    string    `json:"node"`
+	Time    time.Time `json:"time"`
+}
+
+// client delivers webhooks.
+var client = &http.Client{Timeout: Timeout}
+
+// Send logs an alert and delivers it to the webhook in the background.
+func Send(event, format string, args ...any) {
+	ev := Event{Event: event, Message: fmt.Sprintf(format, args...), Node: cluster.NodeName, Time: time.Now()}
+	log.Printf("Alert %s: %s", ev.Event, ev.Message)
+	if WebhookURL == "" {
+		return
+	}
+	go func() {
+		if err := deliver(ev); err != nil {
+			log.Printf("Failed to deliver alert %s: %v", ev.Event, err)
+		}
+	}()
+}
+
+// deliver posts ev to the webhook.
+func deliver(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package bufpool provides pools of reusable byte buffers that count how they are used,
+// so that pool sizes can be tuned from their reuse rate and peak demand.
+package bufpool
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Pool is a pool of byte buffers of one size.
+type Pool struct {
+	name string
+	size int
+	pool sync.Pool
+
+	gets  atomic.Int64 // Buffers taken
+	puts  atomic.Int64 // Buffers returned
+	news  atomic.Int64 // Buffers allocated because none could be reused
+	inUse atomic.Int64 // Buffers taken and not yet returned
+	peak  atomic.Int64 // Highest inUse since start
+}
+
+// Stats is a snapshot of the use of a pool.
+type Stats struct {
+	Name  string `json:"name"`
+	Size  int    `json:"size"`
+	Gets  int64  `json:"gets"`
+	Puts  int64  `json:"puts"`
+	News  int64  `json:"news"`
+	InUse int64  `json:"in_use"`
+	Peak  int64  `json:"peak_in_use"`
+}
+
+// Reused returns the share of gets served by a reused buffer, from 0 to 1.
+func (s Stats) Reused() float64 {
+	if s.Gets == 0 {
+		return 0
+	}
+	return float64(s.Gets-s.News) / float64(s.Gets)
+}
+
+// New creates a pool of buffers of size bytes and registers its metrics as
+// ssh_ify_<name>_buffer_pool_*.
+func New(name string, size int) *Pool {
+	p := &Pool{name: name, size: size}
+	p.pool.New = func() any {
+		p.news.Add(1)
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	prefix := "ssh_ify_" + name + "_buffer_pool_"
+	metrics.NewCounterFunc(prefix+"gets_total", "Number of buffers taken from the "+name+" pool.",
+		func() float64 { return float64(p.gets.Load()) })
+	metrics.NewCounterFunc(prefix+"puts_total", "Number of buffers returned to the "+name+" pool.",
+		func() float64 { return float64(p.puts.Load()) })
+	metrics.NewCounterFunc(prefix+"news_total", "Number of buffers the "+name+" pool allocated because none could be reused.",
+		func() float64 { return float64(p.news.Load()) })
+	metrics.NewGaugeFunc(prefix+"peak_in_use", "Highest number of buffers of the "+name+" pool in use at once since start.",
+		func() float64 { return float64(p.peak.Load()) })
+	return p
+}
+
+// Get takes a buffer from the pool, allocating one if none can be reused.
+func (p *Pool) Get() *[]byte {
+	p.gets.Add(1)
+	inUse := p.inUse.Add(1)
+	for peak := p.peak.Load(); inUse > peak && !p.peak.CompareAndSwap(peak, inUse); peak = p.peak.Load() {
+	}
+	return p.pool.Get().(*[]byte)
+}
+
+// Put returns a buffer taken with Get to the pool.
+func (p *Pool) Put(buf *[]byte) {
+	p.puts.Add(1)
+	p.inUse.Add(-1)
+	p.pool.Put(buf)
+}
+
+// InUse returns the number of buffers taken and not yet returned.
+func (p *Pool) InUse() int64 {
+	return p.inUse.Load()
+}
+
+// Stats returns a snapshot of the use of the pool.
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Name:  p.name,
+		Size:  p.size,
+		Gets:  p.gets.Load(),
+		Puts:  p.puts.Load(),
+		News:  p.news.Load(),
+		InUse: p.inUse.Load(),
+		Peak:  p.peak.Load(),
+	}
+}
@@ -0,0 +1,185 @@
+// Package clientconfig describes how a user connects to the server, as profiles that
+// tunnel clients can import.
+package clientconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/qrcode"
+)
+
+// PublicHost is the host name or address clients reach the server at, used in exported
+// profiles when no host is given. It is read from SSH_IFY_PUBLIC_HOST.
+var PublicHost = config.Env("SSH_IFY_PUBLIC_HOST", "")
+
+// Export formats.
+const (
+	FormatJSON    = "json"    // ssh-ify's own format
+	FormatEHI     = "ehi"     // HTTP Injector style profile
+	FormatOpenSSH = "openssh" // OpenSSH client configuration snippet
+	FormatQR      = "qr"      // QR code of the profile in ssh-ify's own format
+)
+
+// Config is the connection profile of a user in ssh-ify's own client format.
+type Config struct {
+	Name     string `json:"name"`          // Profile name, e.g. "alice@tunnel.example.com"
+	Host     string `json:"host"`          // Host clients connect to
+	Port     int    `json:"port"`          // Port of a listener serving WebSocket tunnels
+	TLS      bool   `json:"tls"`           // Whether the listener expects TLS
+	SNI      string `json:"sni,omitempty"` // Server name sent in the TLS handshake
+	Username string `json:"username"`      // SSH user to log in as
+	Payload  string `json:"payload"`       // Upgrade request sent before the SSH stream
+}
+
+// New returns the profile of username for a listener at host:port. header holds extra
+// headers the upgrade request must carry, such as the tunnel key. The SNI is the host,
+// unless it is an IP address.
+func New(username, host string, port int, tls bool, header http.Header) *Config {
+	cfg := &Config{
+		Name:     username + "@" + host,
+		Host:     host,
+		Port:     port,
+		TLS:      tls,
+		Username: username,
+		Payload:  Payload(host, header),
+	}
+	if tls && net.ParseIP(host) == nil {
+		cfg.SNI = host
+	}
+	return cfg
+}
+
+// Payload returns a WebSocket upgrade request for host with the extra headers in header,
+// in sorted order.
+func Payload(host string, header http.Header) string {
+	var b strings.Builder
+	b.WriteString("GET / HTTP/1.1\r\n")
+	b.WriteString("Host: " + host + "\r\n")
+	b.WriteString("Upgrade: websocket\r\n")
+	b.WriteString("Connection: Upgrade\r\n")
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			b.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// WriteJSON writes the profile in ssh-ify's own format.
+func (c *Config) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+// Write writes the profile in format.
+func (c *Config) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return c.WriteJSON(w)
+	case FormatEHI:
+		return c.WriteEHI(w)
+	case FormatOpenSSH:
+		return c.WriteOpenSSH(w)
+	case FormatQR:
+		return c.WriteQR(w)
+	default:
+		return fmt.Errorf("unknown format %q (expected json, ehi, openssh or qr)", format)
+	}
+}
+
+// ehiProfile is a profile in the JSON layout of HTTP Injector style clients, which write
+// line breaks in payloads as "[crlf]".
+type ehiProfile struct {
+	ConfigName  string `json:"configName"`
+	TunnelType  string `json:"tunnelType"`
+	SSHHost     string `json:"sshHost"`
+	SSHPort     int    `json:"sshPort"`
+	SSHUsername string `json:"sshUsername"`
+	SSHPassword string `json:"sshPassword"`
+	Payload     string `json:"payload"`
+	SNI         string `json:"sni,omitempty"`
+}
+
+// WriteEHI writes the profile in the layout of HTTP Injector style clients. The password
+// is left empty for the user to fill in.
+func (c *Config) WriteEHI(w io.Writer) error {
+	profile := ehiProfile{
+		ConfigName:  c.Name,
+		TunnelType:  "ssh_payload",
+		SSHHost:     c.Host,
+		SSHPort:     c.Port,
+		SSHUsername: c.Username,
+		Payload:     strings.ReplaceAll(c.Payload, "\r\n", "[crlf]"),
+		SNI:         c.SNI,
+	}
+	if c.TLS {
+		profile.TunnelType = "ssh_payload_ssl"
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(profile)
+}
+
+// WriteOpenSSH writes a Host block for the OpenSSH client. Its ProxyCommand sends the
+// payload and then relays the SSH stream through openssl for TLS listeners, or nc for
+// plain ones; ssh skips the upgrade response preceding the server's version line.
+func (c *Config) WriteOpenSSH(w io.Writer) error {
+	relay := "nc %h %p"
+	if c.TLS {
+		relay = "openssl s_client -quiet -connect %h:%p"
+		if c.SNI != "" {
+			relay += " -servername " + c.SNI
+		}
+		relay += " 2>/dev/null"
+	}
+	_, err := fmt.Fprintf(w, "# %s\nHost ssh-ify-%s\n  HostName %s\n  Port %d\n  User %s\n  ProxyCommand sh -c '{ printf \"%s\"; cat; } | %s'\n",
+		c.Name, c.Host, c.Host, c.Port, c.Username, printfEscape(c.Payload), relay)
+	return err
+}
+
+// printfEscape returns s as a printf format that prints s, safe in double quotes inside
+// single quotes and free of the % tokens of ssh_config.
+func printfEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\r':
+			b.WriteString(`\r`)
+		case ch == '\n':
+			b.WriteString(`\n`)
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9', strings.IndexByte(" /:.,;=+_-", ch) >= 0:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, `\%03o`, ch)
+		}
+	}
+	return b.String()
+}
+
+// WriteQR writes a QR code of the profile in ssh-ify's own format, for clients on phones
+// to scan from the terminal.
+func (c *Config) WriteQR(w io.Writer) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	code, err := qrcode.Encode(data)
+	if err != nil {
+		return err
+	}
+	return code.WriteText(w)
+}
@@ -0,0 +1,76 @@
+// Package clock provides an injectable time source for ssh-ify.
+package clock
+
+import "time"
+
+// Clock reports the current time and schedules timers. Code that computes deadlines or
+// durations, or waits for them, takes a Clock instead of using the time package
+// directly so tests can control time.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine once d has passed, like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+
+	// NewTimer returns a timer sending the time on its channel once d has passed, like
+	// time.NewTimer.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker returns a ticker sending the time on its channel every d, like
+	// time.NewTicker. d must be positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event scheduled by a Clock.
+type Timer interface {
+	// C returns the channel the time is sent on, or nil for timers created by AfterFunc.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It reports false if the timer already fired
+	// or was stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire once d has passed. It reports whether the timer
+	// was active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker delivers ticks at intervals on its channel.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is a Clock backed by the system time.
+type Real struct{}
+
+// Now returns the current system time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc calls time.AfterFunc.
+func (Real) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+// NewTimer calls time.NewTimer.
+func (Real) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// NewTicker calls time.NewTicker.
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
@@ -0,0 +1,148 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock for tests whose time only moves when Advance is called. Timers and
+// tickers due by then fire in order of their due time: AfterFunc functions are called in
+// their own goroutine and channels receive the fake time without blocking, dropping
+// ticks a slow reader missed as time.Ticker does.
+type Fake struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// AfterFunc calls fn in its own goroutine once the fake time has advanced by d.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(&fakeTimer{clock: f, fn: fn}, d)
+}
+
+// NewTimer returns a timer firing once the fake time has advanced by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(&fakeTimer{clock: f, c: make(chan time.Time, 1)}, d)
+}
+
+// NewTicker returns a ticker firing every d of fake time.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(&fakeTimer{clock: f, c: make(chan time.Time, 1), period: d}, d)}
+}
+
+// Advance moves the fake time forward by d, firing the timers and tickers due by then.
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	end := f.now.Add(d)
+	for {
+		t := f.nextLocked(end)
+		if t == nil {
+			break
+		}
+		f.now = t.due
+		if t.period > 0 {
+			t.due = t.due.Add(t.period)
+		} else {
+			f.removeLocked(t)
+		}
+		t.fire(f.now)
+	}
+	f.now = end
+	f.mutex.Unlock()
+}
+
+// Timers returns the number of timers and tickers that have not fired or been stopped,
+// so that tests can wait for code to schedule one before advancing the time.
+func (f *Fake) Timers() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.timers)
+}
+
+// add schedules t to fire after d.
+func (f *Fake) add(t *fakeTimer, d time.Duration) *fakeTimer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	t.due = f.now.Add(d)
+	f.timers = append(f.timers, t)
+	return t
+}
+
+// nextLocked returns the timer due first, if it is due by end.
+func (f *Fake) nextLocked(end time.Time) *fakeTimer {
+	sort.SliceStable(f.timers, func(i, j int) bool { return f.timers[i].due.Before(f.timers[j].due) })
+	if len(f.timers) == 0 || f.timers[0].due.After(end) {
+		return nil
+	}
+	return f.timers[0]
+}
+
+// removeLocked unschedules t, reporting whether it was scheduled.
+func (f *Fake) removeLocked(t *fakeTimer) bool {
+	for i, other := range f.timers {
+		if other == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is a timer, ticker or AfterFunc of a Fake clock.
+type fakeTimer struct {
+	clock  *Fake
+	due    time.Time
+	period time.Duration // Interval of tickers; 0 for timers
+	c      chan time.Time
+	fn     func()
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		go t.fn()
+		return
+	}
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	return t.clock.removeLocked(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	active := t.clock.removeLocked(t)
+	t.due = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	return active
+}
+
+// fakeTicker is the Ticker of a periodic fakeTimer.
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.c }
+func (t fakeTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeTimers(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+	timer := c.NewTimer(time.Second)
+	ticker := c.NewTicker(400 * time.Millisecond)
+	defer ticker.Stop()
+	called := make(chan time.Time, 1)
+	c.AfterFunc(2*time.Second, func() { called <- c.Now() })
+
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before it was due")
+	default:
+	}
+	if got := <-ticker.C(); !got.Equal(start.Add(400 * time.Millisecond)) {
+		t.Errorf("first tick at %v, want %v", got, start.Add(400*time.Millisecond))
+	}
+
+	c.Advance(time.Millisecond)
+	if got := <-timer.C(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("timer fired at %v, want %v", got, start.Add(time.Second))
+	}
+	if timer.Stop() {
+		t.Error("Stop() = true for a timer that fired")
+	}
+	if timer.Reset(time.Second) {
+		t.Error("Reset() = true for a timer that fired")
+	}
+	if !timer.Stop() {
+		t.Error("Stop() = false for a reset timer")
+	}
+
+	c.Advance(time.Second)
+	if got := <-called; !got.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("AfterFunc called at %v, want %v", got, start.Add(2*time.Second))
+	}
+	if n := c.Timers(); n != 1 {
+		t.Errorf("Timers() = %d, want only the ticker", n)
+	}
+	select {
+	case <-timer.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+}
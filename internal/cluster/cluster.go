@@ -0,0 +1,67 @@
+// Package cluster holds the shared Redis backend that lets several ssh-ify instances
+// behind a load balancer share users and aggregate sessions and usage.
+package cluster
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
+)
+
+// Cluster configuration, read from the environment at startup.
+var (
+	// RedisURL selects the shared backend, e.g. "redis://:secret@10.0.0.5:6379/0".
+	// It is read from SSH_IFY_REDIS_URL; when empty, every instance keeps its own
+	// state in the config directory.
+	RedisURL = config.Env("SSH_IFY_REDIS_URL", "")
+
+	// KeyPrefix namespaces all keys written to Redis so several deployments can share
+	// a server. It is read from SSH_IFY_REDIS_PREFIX.
+	KeyPrefix = config.Env("SSH_IFY_REDIS_PREFIX", "ssh-ify:")
+
+	// NodeName identifies this instance in cluster-wide data. It is read from
+	// SSH_IFY_NODE_NAME and defaults to the hostname.
+	NodeName = config.Env("SSH_IFY_NODE_NAME", hostname())
+)
+
+var (
+	clientOnce sync.Once
+	client     *redis.Client
+)
+
+// hostname returns the host name, or "local" if it cannot be determined.
+func hostname() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "local"
+}
+
+// Enabled reports whether a shared backend is configured.
+func Enabled() bool {
+	return Client() != nil
+}
+
+// Client returns the shared Redis client, or nil if cluster mode is not configured.
+// An invalid URL is fatal, since silently running standalone would split the cluster.
+func Client() *redis.Client {
+	clientOnce.Do(func() {
+		if RedisURL == "" {
+			return
+		}
+		c, err := redis.ParseURL(RedisURL)
+		if err != nil {
+			log.Fatalf("Invalid SSH_IFY_REDIS_URL: %v", err)
+		}
+		client = c
+	})
+	return client
+}
+
+// Key returns the namespaced Redis key for name.
+func Key(name string) string {
+	return KeyPrefix + name
+}
@@ -11,18 +11,8 @@ import (
 // - Windows: %APPDATA%\ssh-ify
 // - Unix-like: $XDG_CONFIG_HOME/ssh-ify or $HOME/.config/ssh-ify
 func GetConfigDir() (string, error) {
-	var configDir string
-
-	// Check for XDG_CONFIG_HOME first (cross-platform standard)
-	if xdgConfig := os.Getenv("XDG_CONFIG_HOME"); xdgConfig != "" {
-		configDir = filepath.Join(xdgConfig, "ssh-ify")
-	} else if appData := os.Getenv("APPDATA"); appData != "" {
-		// Windows: use APPDATA
-		configDir = filepath.Join(appData, "ssh-ify")
-	} else if homeDir, err := os.UserHomeDir(); err == nil {
-		// Unix-like: use ~/.config/ssh-ify
-		configDir = filepath.Join(homeDir, ".config", "ssh-ify")
-	} else {
+	configDir, err := configDirPath()
+	if err != nil {
 		return "", err
 	}
 
@@ -34,6 +24,24 @@ func GetConfigDir() (string, error) {
 	return configDir, nil
 }
 
+// configDirPath returns the configuration directory without creating it.
+func configDirPath() (string, error) {
+	// Check for XDG_CONFIG_HOME first (cross-platform standard)
+	if xdgConfig := os.Getenv("XDG_CONFIG_HOME"); xdgConfig != "" {
+		return filepath.Join(xdgConfig, "ssh-ify"), nil
+	}
+	// Windows: use APPDATA
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		return filepath.Join(appData, "ssh-ify"), nil
+	}
+	// Unix-like: use ~/.config/ssh-ify
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "ssh-ify"), nil
+}
+
 // GetUserDBPath returns the full path to the user database file in the config directory.
 func GetUserDBPath() (string, error) {
 	configDir, err := GetConfigDir()
@@ -42,3 +50,135 @@ func GetUserDBPath() (string, error) {
 	}
 	return filepath.Join(configDir, "users.json"), nil
 }
+
+// GetAdminDBPath returns the full path to the admin database file in the config directory.
+func GetAdminDBPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "admins.json"), nil
+}
+
+// GetCertsPath returns the full path to the per-hostname TLS certificate map in the config directory.
+func GetCertsPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "certs.json"), nil
+}
+
+// GetResponsesPath returns the full path to the custom HTTP response templates in the config directory.
+func GetResponsesPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "responses.json"), nil
+}
+
+// GetPolicyPath returns the full path to the forwarding destination policy in the config directory.
+func GetPolicyPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "policy.json"), nil
+}
+
+// GetPolicyAuditPath returns the full path to the log of forwarding policy decisions in
+// the config directory.
+func GetPolicyAuditPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "policy-audit.jsonl"), nil
+}
+
+// GetPlansPath returns the full path to the named user plans in the config directory:
+// plans.yaml, or plans.json if only that exists.
+func GetPlansPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(configDir, "plans.yaml")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		legacy := filepath.Join(configDir, "plans.json")
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+	return path, nil
+}
+
+// GetListenersPath returns the full path to the listener configuration in the config directory.
+func GetListenersPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "listeners.json"), nil
+}
+
+// GetListenerStatePath returns the full path to the listeners an admin disabled, in the
+// config directory.
+func GetListenerStatePath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "listener-state.json"), nil
+}
+
+// GetSettingsPath returns the full path to the settings file in the config directory.
+func GetSettingsPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, SettingsFileName), nil
+}
+
+// GetUsagePath returns the full path to the session usage log in the config directory.
+func GetUsagePath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "usage.jsonl"), nil
+}
+
+// GetTransferPath returns the full path to the monthly transfer counter in the config directory.
+func GetTransferPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "transfer.json"), nil
+}
+
+// GetCheckpointsPath returns the directory that running servers checkpoint their active
+// sessions to.
+func GetCheckpointsPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "checkpoints"), nil
+}
+
+// GetAdminSocketPath returns the path of the local admin socket. It can be overridden
+// with SSH_IFY_ADMIN_SOCKET and defaults to admin.sock in the config directory.
+func GetAdminSocketPath() (string, error) {
+	if path := Env("SSH_IFY_ADMIN_SOCKET", ""); path != "" {
+		return path, nil
+	}
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "admin.sock"), nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env returns the value of the environment variable name, or the value the settings file
+// gives it if it is unset or empty, or def if neither sets it.
+func Env(name, def string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	if v := strings.TrimSpace(fileSettings()[name]); v != "" {
+		return v
+	}
+	return def
+}
+
+// EnvBool returns the environment variable name parsed as a boolean, or def if it is
+// unset or invalid.
+func EnvBool(name string, def bool) bool {
+	v := Env(name, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Config: invalid boolean %s=%q, using default %v", name, v, def)
+		return def
+	}
+	return b
+}
+
+// EnvInt returns the environment variable name parsed as an integer, or def if it is
+// unset or invalid.
+func EnvInt(name string, def int) int {
+	v := Env(name, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Config: invalid integer %s=%q, using default %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// EnvDuration returns the environment variable name parsed as a duration (e.g. "30s"),
+// or def if it is unset or invalid.
+func EnvDuration(name string, def time.Duration) time.Duration {
+	v := Env(name, "")
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Config: invalid duration %s=%q, using default %s", name, v, def)
+		return def
+	}
+	return d
+}
+
+// EnvSize returns the environment variable name parsed as a byte size, or def if it is
+// unset or invalid. Sizes are plain byte counts or use a KB, MB, GB or TB suffix (powers of 1024).
+func EnvSize(name string, def int64) int64 {
+	v := Env(name, "")
+	if v == "" {
+		return def
+	}
+	n, err := ParseSize(v)
+	if err != nil {
+		log.Printf("Config: invalid size %s=%q, using default %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// ParseSize parses a byte size such as "512", "64KB", "256MB", "1GB" or "2TB".
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+)
+
+// Hardened mode floors, for regulated environments.
+const (
+	// HardenedMinRSABits is the smallest RSA key accepted, and the size of RSA keys
+	// generated, in hardened mode.
+	HardenedMinRSABits = 3072
+
+	// HardenedBcryptCost is the lowest bcrypt cost of password hashes in hardened mode.
+	HardenedBcryptCost = 12
+)
+
+// Hardened enforces strong-only cryptography on the TLS and SSH layers, minimum key sizes
+// and password hashing costs, and refuses to start with permissive settings. It is read
+// from SSH_IFY_HARDENED.
+var Hardened = EnvBool("SSH_IFY_HARDENED", false)
+
+// CheckKeyStrength returns an error if key, the public key of what, is weaker than
+// hardened mode allows: an RSA key below HardenedMinRSABits or an ECDSA key below P-256.
+// Other key types are accepted.
+func CheckKeyStrength(what string, key any) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < HardenedMinRSABits {
+			return fmt.Errorf("%s is a %d-bit RSA key, hardened mode requires at least %d bits", what, bits, HardenedMinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := key.Curve.Params().BitSize; bits < 256 {
+			return fmt.Errorf("%s is a %d-bit ECDSA key, hardened mode requires at least 256 bits", what, bits)
+		}
+	}
+	return nil
+}
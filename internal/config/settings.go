@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SettingsFileName is the settings file in the config directory: a JSON object mapping
+// SSH_IFY_* variables to values, used for the variables not set in the environment.
+const SettingsFileName = "settings.json"
+
+var (
+	settingsOnce sync.Once
+	settings     map[string]string
+)
+
+// fileSettings returns the settings read from the settings file at first use.
+func fileSettings() map[string]string {
+	settingsOnce.Do(func() {
+		dir, err := configDirPath()
+		if err != nil {
+			return
+		}
+		path := filepath.Join(dir, SettingsFileName)
+		settings, err = ReadSettings(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Config: failed to read %s: %v", path, err)
+		}
+	})
+	return settings
+}
+
+// ReadSettings reads a settings file.
+func ReadSettings(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// FileEnviron returns the settings file as NAME=value pairs, for child processes that
+// cannot read it themselves.
+func FileEnviron() []string {
+	var env []string
+	for name, value := range fileSettings() {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Setting describes a setting that can be changed at runtime.
+type Setting struct {
+	Name    string `json:"name"` // The SSH_IFY_* variable it is read from
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"` // "environment", "file", "default" or "runtime"
+}
+
+// tunable is a registered runtime setting.
+type tunable struct {
+	def    string
+	source string
+	get    func() string
+	set    func(string) error
+}
+
+var (
+	tunablesMu sync.Mutex
+	tunables   = make(map[string]*tunable)
+)
+
+// register makes the setting name changeable with SetTunable.
+func register(name, def string, get func() string, set func(string) error) {
+	source := "default"
+	if strings.TrimSpace(os.Getenv(name)) != "" {
+		source = "environment"
+	} else if strings.TrimSpace(fileSettings()[name]) != "" {
+		source = "file"
+	}
+	tunablesMu.Lock()
+	defer tunablesMu.Unlock()
+	tunables[name] = &tunable{def: def, source: source, get: get, set: set}
+}
+
+// Int is an integer setting that can be changed at runtime.
+type Int struct{ v atomic.Int64 }
+
+// Load returns the current value.
+func (i *Int) Load() int { return int(i.v.Load()) }
+
+func (i *Int) String() string { return strconv.Itoa(i.Load()) }
+
+// Duration is a duration setting that can be changed at runtime.
+type Duration struct{ v atomic.Int64 }
+
+// Load returns the current value.
+func (d *Duration) Load() time.Duration { return time.Duration(d.v.Load()) }
+
+func (d *Duration) String() string { return d.Load().String() }
+
+// EnvTunableInt returns a setting read like EnvInt that can be changed at runtime to any
+// non-negative integer.
+func EnvTunableInt(name string, def int) *Int {
+	i := &Int{}
+	i.v.Store(int64(EnvInt(name, def)))
+	register(name, strconv.Itoa(def), i.String, func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid non-negative integer %q", value)
+		}
+		i.v.Store(int64(n))
+		return nil
+	})
+	return i
+}
+
+// EnvTunableDuration returns a setting read like EnvDuration that can be changed at
+// runtime to any non-negative duration.
+func EnvTunableDuration(name string, def time.Duration) *Duration {
+	d := &Duration{}
+	d.v.Store(int64(EnvDuration(name, def)))
+	register(name, def.String(), d.String, func(value string) error {
+		v, err := time.ParseDuration(value)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid non-negative duration %q", value)
+		}
+		d.v.Store(int64(v))
+		return nil
+	})
+	return d
+}
+
+// Tunables describes the settings that can be changed at runtime, sorted by name.
+func Tunables() []Setting {
+	tunablesMu.Lock()
+	defer tunablesMu.Unlock()
+	list := make([]Setting, 0, len(tunables))
+	for name, t := range tunables {
+		list = append(list, Setting{Name: name, Value: t.get(), Default: t.def, Source: t.source})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// SetTunable changes the runtime setting name to value.
+func SetTunable(name, value string) error {
+	tunablesMu.Lock()
+	defer tunablesMu.Unlock()
+	t, ok := tunables[name]
+	if !ok {
+		return fmt.Errorf("%s cannot be changed at runtime", name)
+	}
+	if err := t.set(strings.TrimSpace(value)); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	t.source = "runtime"
+	return nil
+}
@@ -0,0 +1,242 @@
+// Package connpool keeps spare connections open to frequently dialed destinations, so
+// that forwards to them skip connection setup.
+//
+// Forwarded streams belong to the client that opened them, so connections are never
+// reused once handed out. Instead, a destination dialed PopularDials times within the
+// idle timeout gets spare connections dialed ahead of time, which the next dials to it
+// take. Spares that stay unused for the idle timeout are closed.
+package connpool
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+const (
+	// PopularDials is the number of dials within the idle timeout that make a destination
+	// worth keeping spare connections to.
+	PopularDials = 3
+
+	// MaxDestinations caps the destinations spare connections are kept to at once.
+	MaxDestinations = 64
+
+	// aliveCheckTimeout is how long a spare is read from to tell whether the destination
+	// closed it before it is handed out.
+	aliveCheckTimeout = time.Millisecond
+
+	// maxPeek caps what is read from a spare while checking it.
+	maxPeek = 64 * 1024
+)
+
+var (
+	poolHits = metrics.NewCounter("ssh_ify_forward_pool_hits_total",
+		"Forward connections served from a spare connection.")
+	poolMisses = metrics.NewCounter("ssh_ify_forward_pool_misses_total",
+		"Forward connections to pooled destinations dialed because no spare was available.")
+	poolSpares = metrics.NewGauge("ssh_ify_forward_pool_spare_connections",
+		"Spare connections currently kept open to popular destinations.")
+)
+
+// Dialer opens outbound connections. *net.Dialer satisfies this interface.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Pool is a Dialer keeping spare connections to popular destinations, dialed through next.
+type Pool struct {
+	next        Dialer
+	size        int           // Spare connections kept per popular destination
+	idleTimeout time.Duration // How long spares and dial counts are kept
+
+	mutex        sync.Mutex
+	destinations map[string]*destination
+	spares       int // Spare connections across all destinations
+	janitor      sync.Once
+}
+
+// destination is the dial history and spare connections of one address.
+type destination struct {
+	dials    int       // Dials since windowStart
+	window   time.Time // Start of the current counting window
+	spares   []spare
+	filling  bool // Whether spares are being dialed
+	lastDial time.Time
+}
+
+// spare is a connection dialed ahead of time.
+type spare struct {
+	conn  net.Conn
+	since time.Time
+}
+
+// New returns a Pool dialing through next that keeps up to size spare connections to
+// each popular destination for at most idleTimeout.
+func New(next Dialer, size int, idleTimeout time.Duration) *Pool {
+	return &Pool{next: next, size: size, idleTimeout: idleTimeout, destinations: map[string]*destination{}}
+}
+
+// Dial connects to address, taking a spare connection if one is available. Only TCP
+// connections are pooled.
+func (p *Pool) Dial(network, address string) (net.Conn, error) {
+	if network != "tcp" || p.size <= 0 {
+		return p.next.Dial(network, address)
+	}
+	p.janitor.Do(func() { go p.sweep() })
+
+	now := time.Now()
+	p.mutex.Lock()
+	d := p.destinations[address]
+	if d == nil {
+		if len(p.destinations) >= MaxDestinations {
+			p.mutex.Unlock()
+			return p.next.Dial(network, address)
+		}
+		d = &destination{window: now}
+		p.destinations[address] = d
+	}
+	if now.Sub(d.window) > p.idleTimeout {
+		d.dials, d.window = 0, now
+	}
+	d.dials++
+	d.lastDial = now
+	popular := d.dials >= PopularDials
+	for len(d.spares) > 0 {
+		s := d.spares[len(d.spares)-1]
+		d.spares = d.spares[:len(d.spares)-1]
+		p.removeSpares(1)
+		p.mutex.Unlock()
+		if conn, ok := alive(s.conn); ok {
+			poolHits.Inc()
+			p.fill(address)
+			return conn, nil
+		}
+		s.conn.Close()
+		p.mutex.Lock()
+	}
+	p.mutex.Unlock()
+
+	if popular {
+		poolMisses.Inc()
+		p.fill(address)
+	}
+	return p.next.Dial(network, address)
+}
+
+// fill dials spare connections to address in the background until it has size of them.
+func (p *Pool) fill(address string) {
+	p.mutex.Lock()
+	d := p.destinations[address]
+	if d == nil || d.filling || len(d.spares) >= p.size {
+		p.mutex.Unlock()
+		return
+	}
+	d.filling = true
+	p.mutex.Unlock()
+
+	go func() {
+		for {
+			conn, err := p.next.Dial("tcp", address)
+			p.mutex.Lock()
+			if err != nil || p.destinations[address] != d {
+				d.filling = false
+				p.mutex.Unlock()
+				if conn != nil {
+					conn.Close()
+				}
+				return
+			}
+			d.spares = append(d.spares, spare{conn: conn, since: time.Now()})
+			p.addSpares(1)
+			if len(d.spares) >= p.size {
+				d.filling = false
+				p.mutex.Unlock()
+				return
+			}
+			p.mutex.Unlock()
+		}
+	}()
+}
+
+// sweep closes spares unused for the idle timeout and forgets destinations not dialed
+// within it, every half idle timeout, for the life of the process.
+func (p *Pool) sweep() {
+	ticker := time.NewTicker(max(p.idleTimeout/2, time.Second))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		var expired []net.Conn
+		p.mutex.Lock()
+		for address, d := range p.destinations {
+			kept := d.spares[:0]
+			for _, s := range d.spares {
+				if now.Sub(s.since) > p.idleTimeout {
+					expired = append(expired, s.conn)
+				} else {
+					kept = append(kept, s)
+				}
+			}
+			d.spares = kept
+			if len(d.spares) == 0 && !d.filling && now.Sub(d.lastDial) > p.idleTimeout {
+				delete(p.destinations, address)
+			}
+		}
+		p.removeSpares(len(expired))
+		p.mutex.Unlock()
+		for _, conn := range expired {
+			conn.Close()
+		}
+	}
+}
+
+// addSpares and removeSpares keep the spare count and its gauge. The caller holds mutex.
+func (p *Pool) addSpares(n int) {
+	p.spares += n
+	poolSpares.Set(int64(p.spares))
+}
+
+func (p *Pool) removeSpares(n int) {
+	p.addSpares(-n)
+}
+
+// alive reports whether the destination has not closed conn, returning the connection
+// to use in its place: conn itself, or a wrapper replaying what was read while checking.
+func alive(conn net.Conn) (net.Conn, bool) {
+	var read []byte
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(aliveCheckTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	for len(read) < maxPeek {
+		n, err := conn.Read(buf)
+		read = append(read, buf[:n]...)
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+	}
+	if len(read) > 0 {
+		return &peekedConn{Conn: conn, peeked: read}, true
+	}
+	return conn, true
+}
+
+// peekedConn is a connection whose first bytes were already read into peeked.
+type peekedConn struct {
+	net.Conn
+	peeked []byte
+}
+
+// Read returns the bytes read while checking the connection before reading from it.
+func (c *peekedConn) Read(p []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(p, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
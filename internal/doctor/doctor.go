@@ -0,0 +1,555 @@
+// Package doctor implements self-diagnostics for an ssh-ify installation.
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sandbox"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/tunnel"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Constants
+const (
+	// HandshakeTimeout bounds the loopback tunnel handshake check.
+	HandshakeTimeout = 30 * time.Second
+
+	// AdminTimeout bounds requests to the running server's admin socket.
+	AdminTimeout = 5 * time.Second
+)
+
+// Status describes the outcome of a single diagnostic check.
+type Status int
+
+// Check outcomes
+const (
+	StatusOK Status = iota
+	StatusWarn
+	StatusFail
+)
+
+// String returns the label printed in the report for the status.
+func (st Status) String() string {
+	switch st {
+	case StatusOK:
+		return " OK "
+	case StatusWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// Result is the outcome of a diagnostic check.
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Check is a named diagnostic that reports its status and a human readable detail.
+type Check struct {
+	Name string
+	Run  func() (Status, string)
+}
+
+// Checks returns the default set of diagnostics in the order they are run.
+func Checks() []Check {
+	return []Check{
+		{Name: "config directory", Run: checkConfigDir},
+		{Name: "tcp port", Run: func() (Status, string) { return checkPort(tunnel.DefaultListenPort) }},
+		{Name: "tls port", Run: func() (Status, string) { return checkPort(tunnel.DefaultListenTLSPort) }},
+		{Name: "listeners", Run: checkListeners},
+		{Name: "control addresses", Run: checkControlAddrs},
+		{Name: "tls certificate", Run: checkCertificate},
+		{Name: "sni certificates", Run: checkSNICertificates},
+		{Name: "http responses", Run: checkResponseTemplates},
+		{Name: "ssh host key", Run: checkHostKey},
+		{Name: "ssh host cert", Run: checkHostCert},
+		{Name: "user CA", Run: checkUserCA},
+		{Name: "ssh banner", Run: checkBanner},
+		{Name: "ssh algorithms", Run: checkAlgorithms},
+		{Name: "hardened mode", Run: checkHardened},
+		{Name: "sandbox", Run: checkSandbox},
+		{Name: "user database", Run: checkUserDB},
+		{Name: "plans", Run: checkPlans},
+		{Name: "loopback handshake", Run: checkLoopbackHandshake},
+	}
+}
+
+// Run executes the given checks and collects their results.
+func Run(checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		status, detail := c.Run()
+		results = append(results, Result{Name: c.Name, Status: status, Detail: detail})
+	}
+	return results
+}
+
+// PrintReport writes a diagnostic report to w and reports whether all checks passed
+// (warnings do not count as failures).
+func PrintReport(w io.Writer, results []Result) bool {
+	healthy := true
+	fmt.Fprintln(w, "SSH-ify Diagnostic Report")
+	fmt.Fprintln(w, strings.Repeat("-", 60))
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %-20s %s\n", r.Status, r.Name, r.Detail)
+		if r.Status == StatusFail {
+			healthy = false
+		}
+	}
+	fmt.Fprintln(w, strings.Repeat("-", 60))
+	if healthy {
+		fmt.Fprintln(w, "All checks passed.")
+	} else {
+		fmt.Fprintln(w, "Some checks failed.")
+	}
+	return healthy
+}
+
+// checkConfigDir verifies the configuration directory can be resolved and created.
+func checkConfigDir() (Status, string) {
+	dir, err := config.GetConfigDir()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve config directory: %v", err)
+	}
+	return StatusOK, dir
+}
+
+// checkPort verifies that the given port can be bound on the default listen address,
+// or is held by a listener of the running ssh-ify server.
+func checkPort(port int) (Status, string) {
+	addr := net.JoinHostPort(tunnel.DefaultListenAddress, fmt.Sprint(port))
+	ln, err := net.Listen("tcp", addr)
+	if err == nil {
+		ln.Close()
+		return StatusOK, fmt.Sprintf("%s available", addr)
+	}
+	name, adminErr := runningListener(port)
+	switch {
+	case adminErr == nil && name != "":
+		return StatusOK, fmt.Sprintf("%s in use by listener %s of the running ssh-ify server", addr, name)
+	case errors.Is(adminErr, os.ErrPermission):
+		return StatusWarn, fmt.Sprintf("%s in use, possibly by an ssh-ify server running as another user: %v", addr, adminErr)
+	}
+	return StatusFail, fmt.Sprintf("%s unavailable: %v", addr, err)
+}
+
+// runningListener returns the name of the running server's listener on port, or "" if
+// it has none. It fails if no server answers on the admin socket.
+func runningListener(port int) (string, error) {
+	socket, err := config.GetAdminSocketPath()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), AdminTimeout)
+	defer cancel()
+	infos, err := tunnel.FetchListeners(ctx, tunnel.NewAdminClient(socket))
+	if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		if _, p, err := net.SplitHostPort(info.Addr); err == nil && p == strconv.Itoa(port) {
+			return info.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// checkCertificate verifies that the TLS certificate and key exist and belong together.
+func checkCertificate() (Status, string) {
+	certFile, keyFile := tunnel.DefaultTLSCertFile, tunnel.DefaultTLSKeyFile
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		return StatusWarn, "not present; a self-signed pair will be generated on start"
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return StatusFail, fmt.Sprintf("%s/%s: %v", certFile, keyFile, err)
+	}
+	return StatusOK, fmt.Sprintf("%s matches %s", certFile, keyFile)
+}
+
+// checkSNICertificates verifies that every pair in the SNI certificate map loads.
+func checkSNICertificates() (Status, string) {
+	path, err := config.GetCertsPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve certificate map path: %v", err)
+	}
+	pairs, err := tunnel.LoadCertMap(path)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	if len(pairs) == 0 {
+		return StatusOK, "none configured"
+	}
+	for name, pair := range pairs {
+		if _, err := tls.LoadX509KeyPair(pair.Cert, pair.Key); err != nil {
+			return StatusFail, fmt.Sprintf("%s: %v", name, err)
+		}
+	}
+	return StatusOK, fmt.Sprintf("%d hostnames in %s", len(pairs), path)
+}
+
+// checkResponseTemplates verifies that the custom HTTP response templates parse.
+func checkResponseTemplates() (Status, string) {
+	path, err := config.GetResponsesPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve response templates path: %v", err)
+	}
+	templates, err := tunnel.LoadResponseTemplates(path)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	if len(templates) == 0 {
+		return StatusOK, "none configured"
+	}
+	return StatusOK, fmt.Sprintf("%d status codes in %s", len(templates), path)
+}
+
+// checkListeners verifies that the listener configuration, if present, is valid.
+func checkListeners() (Status, string) {
+	path, err := config.GetListenersPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve listeners path: %v", err)
+	}
+	listeners, err := tunnel.LoadListeners(path)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	if len(listeners) == 0 {
+		return StatusOK, "default TCP and TLS listeners"
+	}
+	return StatusOK, fmt.Sprintf("%d listeners in %s", len(listeners), path)
+}
+
+// checkControlAddrs verifies that the metrics and web admin addresses, if set, are
+// control addresses the server will bind.
+func checkControlAddrs() (Status, string) {
+	var set []string
+	for _, c := range []struct{ name, addr string }{
+		{"SSH_IFY_METRICS_ADDR", config.Env("SSH_IFY_METRICS_ADDR", "")},
+		{"SSH_IFY_ADMIN_ADDR", tunnel.AdminAddr},
+	} {
+		if c.addr == "" {
+			continue
+		}
+		if err := tunnel.CheckControlAddr(c.addr); err != nil {
+			return StatusFail, fmt.Sprintf("%s: %v", c.name, err)
+		}
+		set = append(set, c.addr)
+	}
+	if len(set) == 0 {
+		return StatusOK, "not configured"
+	}
+	return StatusOK, strings.Join(set, ", ")
+}
+
+// checkHostCert verifies that the host certificate, if present, certifies the host key
+// and is currently valid.
+func checkHostCert() (Status, string) {
+	if _, err := os.Stat(ssh.HostCertPath); os.IsNotExist(err) {
+		return StatusOK, "not configured"
+	}
+	data, err := os.ReadFile(ssh.HostKeyPath)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot read %s: %v", ssh.HostKeyPath, err)
+	}
+	signer, err := gossh.ParsePrivateKey(data)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot parse %s: %v", ssh.HostKeyPath, err)
+	}
+	cert, err := ssh.LoadHostCert(signer)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	expiry := "never expires"
+	if cert.ValidBefore != gossh.CertTimeInfinity {
+		expiry = "valid until " + time.Unix(int64(cert.ValidBefore), 0).Format(time.RFC3339)
+	}
+	return StatusOK, fmt.Sprintf("%q for %s, %s", cert.KeyId, strings.Join(cert.ValidPrincipals, ", "), expiry)
+}
+
+// checkUserCA verifies that the trusted user certificate authorities can be loaded.
+func checkUserCA() (Status, string) {
+	if ssh.UserCAFile == "" {
+		return StatusOK, "not configured"
+	}
+	authorities, err := ssh.LoadUserAuthorities(ssh.UserCAFile)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	return StatusOK, fmt.Sprintf("%d authorities in %s", len(authorities), ssh.UserCAFile)
+}
+
+// checkBanner verifies that the banner template, if set, can be loaded and that the
+// banner policy is known.
+func checkBanner() (Status, string) {
+	if err := ssh.ValidateBanner(); err != nil {
+		return StatusFail, err.Error()
+	}
+	switch {
+	case ssh.BannerPolicy == ssh.BannerNone:
+		return StatusOK, "none"
+	case ssh.BannerFile != "":
+		return StatusOK, fmt.Sprintf("%s (%s)", ssh.BannerFile, ssh.BannerPolicy)
+	case ssh.BannerText != "":
+		return StatusOK, fmt.Sprintf("SSH_IFY_BANNER (%s)", ssh.BannerPolicy)
+	}
+	return StatusOK, "default"
+}
+
+// checkAlgorithms verifies the crypto profile and algorithm lists, warning when
+// algorithms with known weaknesses are offered.
+func checkAlgorithms() (Status, string) {
+	algorithms, err := ssh.Algorithms()
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	insecure := ssh.InsecureAlgorithmsOffered(algorithms)
+	if len(insecure) > 0 {
+		return StatusWarn, fmt.Sprintf("%s profile offers insecure %s", ssh.CryptoProfile, strings.Join(insecure, ", "))
+	}
+	return StatusOK, ssh.CryptoProfile + " profile"
+}
+
+// checkHardened verifies that hardened mode, if enabled, accepts the settings, keys and
+// certificates in use.
+func checkHardened() (Status, string) {
+	if !config.Hardened {
+		return StatusOK, "off"
+	}
+	if err := ssh.CheckHardened(); err != nil {
+		return StatusFail, err.Error()
+	}
+	if err := tunnel.CheckHardenedTLS(); err != nil {
+		return StatusFail, err.Error()
+	}
+	return StatusOK, "on"
+}
+
+// checkSandbox verifies that the sandboxes, if any, are known.
+func checkSandbox() (Status, string) {
+	sandboxes, err := sandbox.Sandboxes()
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	if len(sandboxes) == 0 {
+		return StatusOK, "off"
+	}
+	return StatusOK, strings.Join(sandboxes, ", ")
+}
+
+// checkHostKey verifies that the SSH host key can be parsed.
+func checkHostKey() (Status, string) {
+	data, err := os.ReadFile(ssh.HostKeyPath)
+	if os.IsNotExist(err) {
+		return StatusWarn, "not present; a new key will be generated on first connection"
+	}
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot read %s: %v", ssh.HostKeyPath, err)
+	}
+	signer, err := gossh.ParsePrivateKey(data)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot parse %s: %v", ssh.HostKeyPath, err)
+	}
+	return StatusOK, fmt.Sprintf("%s %s", signer.PublicKey().Type(), gossh.FingerprintSHA256(signer.PublicKey()))
+}
+
+// checkUserDB verifies that the user database is readable and its directory writable.
+func checkUserDB() (Status, string) {
+	dbPath, err := config.GetUserDBPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve user database path: %v", err)
+	}
+
+	users := make(map[string]*usermgmt.User)
+	data, err := os.ReadFile(dbPath)
+	switch {
+	case os.IsNotExist(err):
+		// A missing database is created on first write.
+	case err != nil:
+		return StatusFail, fmt.Sprintf("cannot read %s: %v", dbPath, err)
+	case len(data) > 0:
+		if err := json.Unmarshal(data, &users); err != nil {
+			return StatusFail, fmt.Sprintf("cannot parse %s: %v", dbPath, err)
+		}
+	}
+
+	probe := dbPath + ".doctor"
+	if err := os.WriteFile(probe, []byte("{}"), 0600); err != nil {
+		return StatusFail, fmt.Sprintf("cannot write next to %s: %v", dbPath, err)
+	}
+	os.Remove(probe)
+
+	if len(users) == 0 {
+		return StatusWarn, fmt.Sprintf("%s is writable but contains no users", dbPath)
+	}
+	weak := 0
+	for _, user := range users {
+		if usermgmt.WeakPasswordHash(user.PasswordHash) {
+			weak++
+		}
+	}
+	if weak > 0 {
+		return StatusWarn, fmt.Sprintf("%s (%d users, %d with password hashes below cost %d until they log in)",
+			dbPath, len(users), weak, config.HardenedBcryptCost)
+	}
+	return StatusOK, fmt.Sprintf("%s (%d users)", dbPath, len(users))
+}
+
+// checkPlans verifies that the plans, if present, are valid on top of the forwarding
+// policy and that every user assigned to a plan names one that exists.
+func checkPlans() (Status, string) {
+	policyPath, err := config.GetPolicyPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve policy path: %v", err)
+	}
+	base, err := policy.Load(policyPath)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	path, err := config.GetPlansPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve plans path: %v", err)
+	}
+	plans, err := usermgmt.LoadPlans(path, base)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+
+	dbPath, err := config.GetUserDBPath()
+	if err != nil {
+		return StatusFail, fmt.Sprintf("cannot resolve user database path: %v", err)
+	}
+	users := make(map[string]*usermgmt.User)
+	if data, err := os.ReadFile(dbPath); err == nil && len(data) > 0 {
+		json.Unmarshal(data, &users)
+	}
+	var missing []string
+	for name, user := range users {
+		if user != nil && user.Plan != "" && plans[user.Plan] == nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, user.Plan))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return StatusFail, "users assigned to undefined plans cannot log in: " + strings.Join(missing, ", ")
+	}
+
+	if len(plans) == 0 {
+		return StatusOK, "none configured"
+	}
+	return StatusOK, fmt.Sprintf("%s in %s", strings.Join(usermgmt.PlanNames(plans), ", "), path)
+}
+
+// checkLoopbackHandshake runs an in-memory client through the WebSocket upgrade and
+// SSH key exchange. The upgrade request carries the configured tunnel key and solves a
+// proof-of-work challenge if one is issued. Authentication is expected to be rejected
+// for the probe user.
+func checkLoopbackHandshake() (Status, string) {
+	if tunnel.UpgradeAuth {
+		return StatusWarn, "skipped: upgrade requests need basic-auth credentials"
+	}
+	server := tunnel.NewServer()
+
+	conn, resp, err := probeUpgrade(server, "")
+	if err == nil && resp.StatusCode == http.StatusPreconditionRequired {
+		conn.Close()
+		solution, solveErr := tunnel.SolvePoW(resp.Header.Get(tunnel.PoWChallengeHeader))
+		if solveErr != nil {
+			return StatusFail, fmt.Sprintf("solving proof-of-work challenge: %v", solveErr)
+		}
+		conn, resp, err = probeUpgrade(server, solution)
+	}
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return StatusFail, fmt.Sprintf("unexpected upgrade response: %s %s", resp.Proto, resp.Status)
+	}
+
+	clientConfig := &gossh.ClientConfig{
+		User:            ssh.ProbeUser,
+		Auth:            []gossh.AuthMethod{gossh.Password("")},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         HandshakeTimeout,
+	}
+	sshConn, _, _, err := gossh.NewClientConn(conn, "loopback", clientConfig)
+	if err == nil {
+		sshConn.Close()
+		return StatusOK, "upgrade and SSH handshake completed"
+	}
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return StatusOK, "upgrade and SSH key exchange completed"
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return StatusFail, "timed out during SSH handshake"
+	}
+	return StatusFail, fmt.Sprintf("SSH handshake failed: %v", err)
+}
+
+// probeUpgrade connects a loopback probe to server and sends a WebSocket upgrade request
+// with the configured tunnel key and, if not empty, the proof-of-work solution. It
+// returns a connection reading past the response, and the response.
+func probeUpgrade(server *tunnel.Server, powSolution string) (net.Conn, *http.Response, error) {
+	clientEnd, serverEnd := net.Pipe()
+	clientEnd.SetDeadline(time.Now().Add(HandshakeTimeout))
+	go server.ServeProbe(serverEnd)
+
+	req := "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+	switch {
+	case tunnel.TunnelKey == "":
+	case tunnel.TunnelKeyMode == tunnel.TunnelKeySigned:
+		req += tunnel.TunnelKeyHeader + ": " + tunnel.SignTunnelKey(tunnel.TunnelKey, time.Now()) + "\r\n"
+	default:
+		req += tunnel.TunnelKeyHeader + ": " + tunnel.TunnelKey + "\r\n"
+	}
+	if powSolution != "" {
+		req += tunnel.PoWSolutionHeader + ": " + powSolution + "\r\n"
+	}
+	if _, err := io.WriteString(clientEnd, req+"\r\n"); err != nil {
+		clientEnd.Close()
+		return nil, nil, fmt.Errorf("writing upgrade request: %v", err)
+	}
+
+	reader := bufio.NewReader(clientEnd)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		clientEnd.Close()
+		return nil, nil, fmt.Errorf("reading upgrade response: %v", err)
+	}
+	return &bufferedConn{Conn: clientEnd, r: reader}, resp, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from a bufio.Reader that may
+// already hold bytes read past the HTTP response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from the buffered reader.
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
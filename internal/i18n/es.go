@@ -0,0 +1,169 @@
+package i18n
+
+// es is the Spanish catalog.
+var es = map[string]string{
+	// Server messages shown to clients.
+	"Welcome to ssh-ify.\n": "Bienvenido a ssh-ify.\n",
+	"The server is under maintenance, please try again later.":                              "El servidor está en mantenimiento, inténtelo de nuevo más tarde.",
+	"All sessions will be closed for maintenance in %s: %s":                                 "Todas las sesiones se cerrarán por mantenimiento en %s: %s",
+	"This session will be closed in %s, having reached the maximum session duration of %s.": "Esta sesión se cerrará en %s al alcanzar la duración máxima de sesión de %s.",
+	"Reset your password": "Restablezca su contraseña",
+	"Reset token":         "Token de restablecimiento",
+	"New password":        "Nueva contraseña",
+	"Set password":        "Establecer contraseña",
+	"Invalid request.":    "Solicitud no válida.",
+	"This reset token is invalid or has expired.": "Este token de restablecimiento no es válido o ha caducado.",
+	"Password not changed: %v":                    "La contraseña no se cambió: %v",
+	"Create your account":                         "Cree su cuenta",
+	"Invite":                                      "Invitación",
+	"Username":                                    "Usuario",
+	"Password":                                    "Contraseña",
+	"Create account":                              "Crear cuenta",
+	"This invite is invalid, used or has expired.":                               "Esta invitación no es válida, ya se usó o ha caducado.",
+	"Account not created: %v":                                                    "La cuenta no se creó: %v",
+	"Account '%s' created. You can now connect with your username and password.": "Cuenta '%s' creada. Ya puede conectarse con su usuario y contraseña.",
+	"Your password has been changed.":                                            "Su contraseña se ha cambiado.",
+
+	// Results of user management commands.
+	"User '%s' added successfully!\n":                                    "¡Usuario '%s' añadido correctamente!\n",
+	"User '%s' removed successfully!\n":                                  "¡Usuario '%s' eliminado correctamente!\n",
+	"User '%s' enabled successfully!\n":                                  "¡Usuario '%s' activado correctamente!\n",
+	"User '%s' disabled successfully!\n":                                 "¡Usuario '%s' desactivado correctamente!\n",
+	"User '%s' unlocked successfully!\n":                                 "¡Usuario '%s' desbloqueado correctamente!\n",
+	"User '%s' archived successfully!\n":                                 "¡Usuario '%s' archivado correctamente!\n",
+	"User '%s' unarchived successfully!\n":                               "¡Usuario '%s' desarchivado correctamente!\n",
+	"User '%s' updated successfully!\n":                                  "¡Usuario '%s' actualizado correctamente!\n",
+	"Schedule for user '%s' updated successfully!\n":                     "¡El horario del usuario '%s' se actualizó correctamente!\n",
+	"Plan for user '%s' updated successfully!\n":                         "¡El plan del usuario '%s' se actualizó correctamente!\n",
+	"Expiry for user '%s' updated successfully!\n":                       "¡La expiración del usuario '%s' se actualizó correctamente!\n",
+	"User added successfully!":                                           "¡Usuario añadido correctamente!",
+	"Password changed successfully!":                                     "¡Contraseña cambiada correctamente!",
+	"Client certificate mapped to user '%s' successfully!\n":             "¡Certificado de cliente asignado al usuario '%s' correctamente!\n",
+	"Client certificate removed from user '%s' successfully!\n":          "¡Certificado de cliente quitado del usuario '%s' correctamente!\n",
+	"User database backed up to '%s' successfully!\n":                    "¡Copia de seguridad de la base de usuarios guardada en '%s' correctamente!\n",
+	"%d archived users purged.\n":                                        "%d usuarios archivados purgados.\n",
+	"%d users restored from '%s' successfully!\n":                        "¡%d usuarios restaurados desde '%s' correctamente!\n",
+	"Admin '%s' added successfully!\n":                                   "¡Administrador '%s' añadido correctamente!\n",
+	"Admin '%s' removed successfully!\n":                                 "¡Administrador '%s' eliminado correctamente!\n",
+	"Quota for admin '%s' updated successfully!\n":                       "¡Cuota del administrador '%s' actualizada correctamente!\n",
+	"Tokens of admin '%s' revoked successfully!\n":                       "¡Tokens del administrador '%s' revocados correctamente!\n",
+	"Token for admin '%s' (shown only once): %s\n":                       "Token del administrador '%s' (solo se muestra una vez): %s\n",
+	"Reset token for user '%s' (shown only once, valid until %s): %s\n":  "Token de restablecimiento del usuario '%s' (solo se muestra una vez, válido hasta %s): %s\n",
+	"Reset token for user '%s' (shown only once, valid until %s):\n%s\n": "Token de restablecimiento del usuario '%s' (solo se muestra una vez, válido hasta %s):\n%s\n",
+	"Token for admin '%s' (shown only once):\n%s\n":                      "Token del administrador '%s' (solo se muestra una vez):\n%s\n",
+	"Invite for one account (shown only once, valid until %s):\n%s\n":    "Invitación para una cuenta (solo se muestra una vez, válida hasta %s):\n%s\n",
+	"Signup link: %s\n":                                                  "Enlace de registro: %s\n",
+	"%d invites revoked.\n":                                              "%d invitaciones revocadas.\n",
+	"Ban of '%s' lifted successfully!\n":                                 "¡Bloqueo de '%s' levantado correctamente!\n",
+
+	// Errors.
+	"Error adding user: %v\n":                                  "Error al añadir el usuario: %v\n",
+	"Error removing user: %v\n":                                "Error al eliminar el usuario: %v\n",
+	"Error showing user: %v\n":                                 "Error al mostrar el usuario: %v\n",
+	"Error updating user: %v\n":                                "Error al actualizar el usuario: %v\n",
+	"Error enabling user: %v\n":                                "Error al activar el usuario: %v\n",
+	"Error disabling user: %v\n":                               "Error al desactivar el usuario: %v\n",
+	"Error unlocking user: %v\n":                               "Error al desbloquear el usuario: %v\n",
+	"Error setting schedule: %v\n":                             "Error al establecer el horario: %v\n",
+	"Error setting plan: %v\n":                                 "Error al establecer el plan: %v\n",
+	"Error setting expiry: %v\n":                               "Error al establecer la expiración: %v\n",
+	"Error setting quota: %v\n":                                "Error al establecer la cuota: %v\n",
+	"Error changing password: %v\n":                            "Error al cambiar la contraseña: %v\n",
+	"Error archiving user: %v\n":                               "Error al archivar el usuario: %v\n",
+	"Error unarchiving user: %v\n":                             "Error al desarchivar el usuario: %v\n",
+	"Error listing archived users: %v\n":                       "Error al listar los usuarios archivados: %v\n",
+	"Error purging archived users: %v\n":                       "Error al purgar los usuarios archivados: %v\n",
+	"Error restoring users: %v\n":                              "Error al restaurar los usuarios: %v\n",
+	"Error backing up users: %v\n":                             "Error al respaldar los usuarios: %v\n",
+	"Error adding client certificate: %v\n":                    "Error al añadir el certificado de cliente: %v\n",
+	"Error removing client certificate: %v\n":                  "Error al quitar el certificado de cliente: %v\n",
+	"Error adding admin: %v\n":                                 "Error al añadir el administrador: %v\n",
+	"Error removing admin: %v\n":                               "Error al eliminar el administrador: %v\n",
+	"Error listing admins: %v\n":                               "Error al listar los administradores: %v\n",
+	"Error creating token: %v\n":                               "Error al crear el token: %v\n",
+	"Error creating reset token: %v\n":                         "Error al crear el token de restablecimiento: %v\n",
+	"Error exporting client profile: %v\n":                     "Error al exportar el perfil de cliente: %v\n",
+	"Error creating invite: %v\n":                              "Error al crear la invitación: %v\n",
+	"Error listing invites: %v\n":                              "Error al listar las invitaciones: %v\n",
+	"Error revoking invites: %v\n":                             "Error al revocar las invitaciones: %v\n",
+	"Error revoking tokens: %v\n":                              "Error al revocar los tokens: %v\n",
+	"Error reading input: %v\n":                                "Error al leer la entrada: %v\n",
+	"Error reading password: %v\n":                             "Error al leer la contraseña: %v\n",
+	"Error generating report: %v\n":                            "Error al generar el informe: %v\n",
+	"Error listing sessions: %v\n":                             "Error al listar las sesiones: %v\n",
+	"Error listing bans: %v\n":                                 "Error al listar los bloqueos: %v\n",
+	"Error lifting ban: %v\n":                                  "Error al levantar el bloqueo: %v\n",
+	"Error checking for updates: %v\n":                         "Error al buscar actualizaciones: %v\n",
+	"Error updating: %v\n":                                     "Error al actualizar: %v\n",
+	"Error: %v\n":                                              "Error: %v\n",
+	"Error locating admin socket: %v\n":                        "Error al localizar el socket de administración: %v\n",
+	"Error reading cluster status: %v\n":                       "Error al leer el estado del clúster: %v\n",
+	"Error loading host key: %v\n":                             "Error al cargar la clave del host: %v\n",
+	"Invalid interval: %s\n":                                   "Intervalo no válido: %s\n",
+	"Invalid quota: %s\n":                                      "Cuota no válida: %s\n",
+	"Unknown command: %s\n":                                    "Comando desconocido: %s\n",
+	"Permission denied: '%s' may only list their own users.\n": "Permiso denegado: '%s' solo puede listar sus propios usuarios.\n",
+	"Note: running server not notified: %v\n":                  "Nota: no se notificó al servidor en ejecución: %v\n",
+	"Warning: Failed to create default user from environment variables: %v\n": "Aviso: no se pudo crear el usuario predeterminado a partir de las variables de entorno: %v\n",
+
+	// Prompts and interactive mode.
+	"Enter username: ":                                      "Nombre de usuario: ",
+	"Enter password: ":                                      "Contraseña: ",
+	"Confirm password: ":                                    "Confirme la contraseña: ",
+	"Enter new password: ":                                  "Nueva contraseña: ",
+	"Confirm new password: ":                                "Confirme la nueva contraseña: ",
+	"Enter admin password: ":                                "Contraseña del administrador: ",
+	"Password for admin '%s': ":                             "Contraseña del administrador '%s': ",
+	"SSH-ify User Management":                               "SSH-ify - Gestión de usuarios",
+	"Type 'help' for available commands or 'quit' to exit.": "Escriba 'help' para ver los comandos disponibles o 'quit' para salir.",
+	"Type 'help' for available commands.":                   "Escriba 'help' para ver los comandos disponibles.",
+	"User Management Commands:":                             "Comandos de gestión de usuarios:",
+	"Goodbye!":                                              "¡Hasta luego!",
+	"No users found.":                                       "No se encontraron usuarios.",
+	"No admins found.":                                      "No se encontraron administradores.",
+	"No archived users.":                                    "No hay usuarios archivados.",
+	"Archive user '%s'?":                                    "¿Archivar el usuario '%s'?",
+	"Permanently remove user '%s'?":                         "¿Eliminar definitivamente el usuario '%s'?",
+	"Permanently delete all archived users?":                "¿Eliminar definitivamente todos los usuarios archivados?",
+	"Permanently delete archived user '%s'?":                "¿Eliminar definitivamente el usuario archivado '%s'?",
+	"Replace all users with the %d users in '%s'?":          "¿Reemplazar todos los usuarios por los %d usuarios de '%s'?",
+	"Aborted.": "Cancelado.",
+	"Aborted; pass --yes to skip this confirmation.": "Cancelado; use --yes para omitir esta confirmación.",
+	"No pending invites.":                            "No hay invitaciones pendientes.",
+	"Revoke all pending invites?":                    "¿Revocar todas las invitaciones pendientes?",
+	"No banned IPs.":                                 "No hay IP bloqueadas.",
+
+	// Status output.
+	"%d active sessions\n":                                     "%d sesiones activas\n",
+	"Maintenance mode is off.":                                 "El modo de mantenimiento está desactivado.",
+	"Maintenance mode off; new sessions are accepted again.":   "Modo de mantenimiento desactivado; se vuelven a aceptar sesiones nuevas.",
+	"Maintenance mode on since %s\n":                           "Modo de mantenimiento activo desde %s\n",
+	"Message:  %s\n":                                           "Mensaje:  %s\n",
+	"Sessions: closed at %s\n":                                 "Sesiones: se cierran a las %s\n",
+	"Invalid destination '%s', expected <host:port>\n":         "Destino '%s' no válido, se esperaba <host:puerto>\n",
+	"%s may not connect to %s: denied by %s\n":                 "%s no puede conectarse a %s: denegado por %s\n",
+	"%s may connect to %s: allowed by %s\n":                    "%s puede conectarse a %s: permitido por %s\n",
+	"Connections go through upstream %s\n":                     "Las conexiones pasan por el upstream %s\n",
+	"You are running the latest release.":                      "Está usando la última versión.",
+	"Already running the latest release (%s).\n":               "Ya está usando la última versión (%s).\n",
+	"A new release is available: %s (%s)\n":                    "Hay una nueva versión disponible: %s (%s)\n",
+	"Run 'ssh-ify self-update' to install it.":                 "Ejecute 'ssh-ify self-update' para instalarla.",
+	"Updated to %s. Restart ssh-ify to use the new version.\n": "Actualizado a %s. Reinicie ssh-ify para usar la nueva versión.\n",
+
+	// Labels of show-user, aligned per language.
+	"Username: %s\n": "Usuario:     %s\n",
+	"Status:   %s\n": "Estado:      %s\n",
+	"Created:  %s\n": "Creado:      %s\n",
+	"Schedule: %s\n": "Horario:     %s\n",
+	"Plan:     %s\n": "Plan:        %s\n",
+	"Expires:  %s\n": "Expira:      %s\n",
+	"Locked:   %s\n": "Bloqueado:   %s\n",
+	"Owner:    %s\n": "Propietario: %s\n",
+	"Contact:  %s\n": "Contacto:    %s\n",
+	"Notes:    %s\n": "Notas:       %s\n",
+	"Cert:     %s\n": "Cert:        %s\n",
+
+	"Sessions: %d (%d active)\n": "Sesiones:    %d (%d activas)\n",
+	"Month:    %s in, %s out\n":  "Este mes:    %s recibidos, %s enviados\n",
+	"Last:     %s from %s\n":     "Última:      %s desde %s\n",
+}
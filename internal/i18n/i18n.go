@@ -0,0 +1,101 @@
+// Package i18n translates CLI output and client-facing messages. Catalogs map English
+// messages, which serve as keys, to their translation; messages a catalog lacks are
+// shown in English.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// DefaultLang is the language messages are written in and fall back to.
+const DefaultLang = "en"
+
+// catalogs maps language codes to their translations.
+var catalogs = map[string]map[string]string{
+	DefaultLang: {},
+	"es":        es,
+	"id":        id,
+	"pt":        pt,
+}
+
+// lang is the language messages are shown in. It is read from SSH_IFY_LANG and can be
+// changed with SetLang.
+var lang, _ = lookup(config.Env("SSH_IFY_LANG", DefaultLang))
+
+// lookup reduces a locale such as "pt_BR.UTF-8" to its language code and reports whether
+// the language is supported. Unsupported languages yield DefaultLang.
+func lookup(locale string) (string, bool) {
+	code := strings.ToLower(locale)
+	if i := strings.IndexAny(code, "_-."); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := catalogs[code]; !ok {
+		return DefaultLang, false
+	}
+	return code, true
+}
+
+// SetLang shows messages in the language of locale, such as "es" or "pt_BR", and
+// reports whether it is supported. Unsupported languages fall back to English.
+func SetLang(locale string) bool {
+	code, ok := lookup(locale)
+	lang = code
+	return ok
+}
+
+// Lang returns the code of the language messages are shown in.
+func Lang() string {
+	return lang
+}
+
+// Supported returns the codes of the supported languages in sorted order.
+func Supported() []string {
+	codes := make([]string, 0, len(catalogs))
+	for code := range catalogs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// T returns the translation of msg, or msg if there is none.
+func T(msg string) string {
+	if translated, ok := catalogs[lang][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// Sprintf formats according to the translation of format.
+func Sprintf(format string, a ...any) string {
+	return fmt.Sprintf(T(format), a...)
+}
+
+// Printf prints according to the translation of format.
+func Printf(format string, a ...any) {
+	fmt.Printf(T(format), a...)
+}
+
+// Print prints a, translating it if it is a single message.
+func Print(a ...any) {
+	fmt.Print(translate(a)...)
+}
+
+// Println prints a followed by a newline, translating it if it is a single message.
+func Println(a ...any) {
+	fmt.Println(translate(a)...)
+}
+
+// translate replaces a single string in a with its translation.
+func translate(a []any) []any {
+	if len(a) == 1 {
+		if msg, ok := a[0].(string); ok {
+			return []any{T(msg)}
+		}
+	}
+	return a
+}
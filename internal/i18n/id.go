@@ -0,0 +1,169 @@
+package i18n
+
+// id is the Indonesian catalog.
+var id = map[string]string{
+	// Server messages shown to clients.
+	"Welcome to ssh-ify.\n": "Selamat datang di ssh-ify.\n",
+	"The server is under maintenance, please try again later.":                              "Server sedang dalam pemeliharaan, silakan coba lagi nanti.",
+	"All sessions will be closed for maintenance in %s: %s":                                 "Semua sesi akan ditutup untuk pemeliharaan dalam %s: %s",
+	"This session will be closed in %s, having reached the maximum session duration of %s.": "Sesi ini akan ditutup dalam %s karena telah mencapai durasi sesi maksimum %s.",
+	"Reset your password": "Atur ulang kata sandi Anda",
+	"Reset token":         "Token atur ulang",
+	"New password":        "Kata sandi baru",
+	"Set password":        "Simpan kata sandi",
+	"Invalid request.":    "Permintaan tidak valid.",
+	"This reset token is invalid or has expired.": "Token atur ulang ini tidak valid atau sudah kedaluwarsa.",
+	"Password not changed: %v":                    "Kata sandi tidak diubah: %v",
+	"Create your account":                         "Buat akun Anda",
+	"Invite":                                      "Undangan",
+	"Username":                                    "Nama pengguna",
+	"Password":                                    "Kata sandi",
+	"Create account":                              "Buat akun",
+	"This invite is invalid, used or has expired.":                               "Undangan ini tidak valid, sudah dipakai, atau sudah kedaluwarsa.",
+	"Account not created: %v":                                                    "Akun tidak dibuat: %v",
+	"Account '%s' created. You can now connect with your username and password.": "Akun '%s' dibuat. Sekarang Anda dapat terhubung dengan nama pengguna dan kata sandi Anda.",
+	"Your password has been changed.":                                            "Kata sandi Anda telah diubah.",
+
+	// Results of user management commands.
+	"User '%s' added successfully!\n":                                    "Pengguna '%s' berhasil ditambahkan!\n",
+	"User '%s' removed successfully!\n":                                  "Pengguna '%s' berhasil dihapus!\n",
+	"User '%s' enabled successfully!\n":                                  "Pengguna '%s' berhasil diaktifkan!\n",
+	"User '%s' disabled successfully!\n":                                 "Pengguna '%s' berhasil dinonaktifkan!\n",
+	"User '%s' unlocked successfully!\n":                                 "Pengguna '%s' berhasil dibuka kuncinya!\n",
+	"User '%s' archived successfully!\n":                                 "Pengguna '%s' berhasil diarsipkan!\n",
+	"User '%s' unarchived successfully!\n":                               "Pengguna '%s' berhasil dipulihkan dari arsip!\n",
+	"User '%s' updated successfully!\n":                                  "Pengguna '%s' berhasil diperbarui!\n",
+	"Schedule for user '%s' updated successfully!\n":                     "Jadwal pengguna '%s' berhasil diperbarui!\n",
+	"Plan for user '%s' updated successfully!\n":                         "Paket pengguna '%s' berhasil diperbarui!\n",
+	"Expiry for user '%s' updated successfully!\n":                       "Masa berlaku pengguna '%s' berhasil diperbarui!\n",
+	"User added successfully!":                                           "Pengguna berhasil ditambahkan!",
+	"Password changed successfully!":                                     "Kata sandi berhasil diubah!",
+	"Client certificate mapped to user '%s' successfully!\n":             "Sertifikat klien berhasil dipetakan ke pengguna '%s'!\n",
+	"Client certificate removed from user '%s' successfully!\n":          "Sertifikat klien berhasil dihapus dari pengguna '%s'!\n",
+	"User database backed up to '%s' successfully!\n":                    "Basis data pengguna berhasil dicadangkan ke '%s'!\n",
+	"%d archived users purged.\n":                                        "%d pengguna arsip dihapus permanen.\n",
+	"%d users restored from '%s' successfully!\n":                        "%d pengguna berhasil dipulihkan dari '%s'!\n",
+	"Admin '%s' added successfully!\n":                                   "Admin '%s' berhasil ditambahkan!\n",
+	"Admin '%s' removed successfully!\n":                                 "Admin '%s' berhasil dihapus!\n",
+	"Quota for admin '%s' updated successfully!\n":                       "Kuota admin '%s' berhasil diperbarui!\n",
+	"Tokens of admin '%s' revoked successfully!\n":                       "Token admin '%s' berhasil dicabut!\n",
+	"Token for admin '%s' (shown only once): %s\n":                       "Token untuk admin '%s' (hanya ditampilkan sekali): %s\n",
+	"Reset token for user '%s' (shown only once, valid until %s): %s\n":  "Token atur ulang untuk pengguna '%s' (hanya ditampilkan sekali, berlaku hingga %s): %s\n",
+	"Reset token for user '%s' (shown only once, valid until %s):\n%s\n": "Token atur ulang untuk pengguna '%s' (hanya ditampilkan sekali, berlaku hingga %s):\n%s\n",
+	"Token for admin '%s' (shown only once):\n%s\n":                      "Token untuk admin '%s' (hanya ditampilkan sekali):\n%s\n",
+	"Invite for one account (shown only once, valid until %s):\n%s\n":    "Undangan untuk satu akun (hanya ditampilkan sekali, berlaku hingga %s):\n%s\n",
+	"Signup link: %s\n":                                                  "Tautan pendaftaran: %s\n",
+	"%d invites revoked.\n":                                              "%d undangan dicabut.\n",
+	"Ban of '%s' lifted successfully!\n":                                 "Blokir '%s' berhasil dicabut!\n",
+
+	// Errors.
+	"Error adding user: %v\n":                                  "Gagal menambahkan pengguna: %v\n",
+	"Error removing user: %v\n":                                "Gagal menghapus pengguna: %v\n",
+	"Error showing user: %v\n":                                 "Gagal menampilkan pengguna: %v\n",
+	"Error updating user: %v\n":                                "Gagal memperbarui pengguna: %v\n",
+	"Error enabling user: %v\n":                                "Gagal mengaktifkan pengguna: %v\n",
+	"Error disabling user: %v\n":                               "Gagal menonaktifkan pengguna: %v\n",
+	"Error unlocking user: %v\n":                               "Gagal membuka kunci pengguna: %v\n",
+	"Error setting schedule: %v\n":                             "Gagal mengatur jadwal: %v\n",
+	"Error setting plan: %v\n":                                 "Gagal mengatur paket: %v\n",
+	"Error setting expiry: %v\n":                               "Gagal mengatur masa berlaku: %v\n",
+	"Error setting quota: %v\n":                                "Gagal mengatur kuota: %v\n",
+	"Error changing password: %v\n":                            "Gagal mengubah kata sandi: %v\n",
+	"Error archiving user: %v\n":                               "Gagal mengarsipkan pengguna: %v\n",
+	"Error unarchiving user: %v\n":                             "Gagal memulihkan pengguna dari arsip: %v\n",
+	"Error listing archived users: %v\n":                       "Gagal menampilkan daftar pengguna arsip: %v\n",
+	"Error purging archived users: %v\n":                       "Gagal menghapus permanen pengguna arsip: %v\n",
+	"Error restoring users: %v\n":                              "Gagal memulihkan pengguna: %v\n",
+	"Error backing up users: %v\n":                             "Gagal mencadangkan pengguna: %v\n",
+	"Error adding client certificate: %v\n":                    "Gagal menambahkan sertifikat klien: %v\n",
+	"Error removing client certificate: %v\n":                  "Gagal menghapus sertifikat klien: %v\n",
+	"Error adding admin: %v\n":                                 "Gagal menambahkan admin: %v\n",
+	"Error removing admin: %v\n":                               "Gagal menghapus admin: %v\n",
+	"Error listing admins: %v\n":                               "Gagal menampilkan daftar admin: %v\n",
+	"Error creating token: %v\n":                               "Gagal membuat token: %v\n",
+	"Error creating reset token: %v\n":                         "Gagal membuat token atur ulang: %v\n",
+	"Error exporting client profile: %v\n":                     "Gagal mengekspor profil klien: %v\n",
+	"Error creating invite: %v\n":                              "Gagal membuat undangan: %v\n",
+	"Error listing invites: %v\n":                              "Gagal menampilkan daftar undangan: %v\n",
+	"Error revoking invites: %v\n":                             "Gagal mencabut undangan: %v\n",
+	"Error revoking tokens: %v\n":                              "Gagal mencabut token: %v\n",
+	"Error reading input: %v\n":                                "Gagal membaca masukan: %v\n",
+	"Error reading password: %v\n":                             "Gagal membaca kata sandi: %v\n",
+	"Error generating report: %v\n":                            "Gagal membuat laporan: %v\n",
+	"Error listing sessions: %v\n":                             "Gagal menampilkan daftar sesi: %v\n",
+	"Error listing bans: %v\n":                                 "Gagal menampilkan daftar blokir: %v\n",
+	"Error lifting ban: %v\n":                                  "Gagal mencabut blokir: %v\n",
+	"Error checking for updates: %v\n":                         "Gagal memeriksa pembaruan: %v\n",
+	"Error updating: %v\n":                                     "Gagal memperbarui: %v\n",
+	"Error: %v\n":                                              "Galat: %v\n",
+	"Error locating admin socket: %v\n":                        "Gagal menemukan soket admin: %v\n",
+	"Error reading cluster status: %v\n":                       "Gagal membaca status klaster: %v\n",
+	"Error loading host key: %v\n":                             "Gagal memuat kunci host: %v\n",
+	"Invalid interval: %s\n":                                   "Interval tidak valid: %s\n",
+	"Invalid quota: %s\n":                                      "Kuota tidak valid: %s\n",
+	"Unknown command: %s\n":                                    "Perintah tidak dikenal: %s\n",
+	"Permission denied: '%s' may only list their own users.\n": "Akses ditolak: '%s' hanya boleh menampilkan penggunanya sendiri.\n",
+	"Note: running server not notified: %v\n":                  "Catatan: server yang berjalan tidak diberi tahu: %v\n",
+	"Warning: Failed to create default user from environment variables: %v\n": "Peringatan: gagal membuat pengguna bawaan dari variabel lingkungan: %v\n",
+
+	// Prompts and interactive mode.
+	"Enter username: ":                                      "Nama pengguna: ",
+	"Enter password: ":                                      "Kata sandi: ",
+	"Confirm password: ":                                    "Konfirmasi kata sandi: ",
+	"Enter new password: ":                                  "Kata sandi baru: ",
+	"Confirm new password: ":                                "Konfirmasi kata sandi baru: ",
+	"Enter admin password: ":                                "Kata sandi admin: ",
+	"Password for admin '%s': ":                             "Kata sandi admin '%s': ",
+	"SSH-ify User Management":                               "SSH-ify - Manajemen pengguna",
+	"Type 'help' for available commands or 'quit' to exit.": "Ketik 'help' untuk melihat perintah yang tersedia atau 'quit' untuk keluar.",
+	"Type 'help' for available commands.":                   "Ketik 'help' untuk melihat perintah yang tersedia.",
+	"User Management Commands:":                             "Perintah manajemen pengguna:",
+	"Goodbye!":                                              "Sampai jumpa!",
+	"No users found.":                                       "Tidak ada pengguna.",
+	"No admins found.":                                      "Tidak ada admin.",
+	"No archived users.":                                    "Tidak ada pengguna arsip.",
+	"Archive user '%s'?":                                    "Arsipkan pengguna '%s'?",
+	"Permanently remove user '%s'?":                         "Hapus pengguna '%s' secara permanen?",
+	"Permanently delete all archived users?":                "Hapus semua pengguna arsip secara permanen?",
+	"Permanently delete archived user '%s'?":                "Hapus pengguna arsip '%s' secara permanen?",
+	"Replace all users with the %d users in '%s'?":          "Ganti semua pengguna dengan %d pengguna di '%s'?",
+	"Aborted.": "Dibatalkan.",
+	"Aborted; pass --yes to skip this confirmation.": "Dibatalkan; gunakan --yes untuk melewati konfirmasi ini.",
+	"No pending invites.":                            "Tidak ada undangan yang tertunda.",
+	"Revoke all pending invites?":                    "Cabut semua undangan yang tertunda?",
+	"No banned IPs.":                                 "Tidak ada IP yang diblokir.",
+
+	// Status output.
+	"%d active sessions\n":                                     "%d sesi aktif\n",
+	"Maintenance mode is off.":                                 "Mode pemeliharaan tidak aktif.",
+	"Maintenance mode off; new sessions are accepted again.":   "Mode pemeliharaan dimatikan; sesi baru diterima kembali.",
+	"Maintenance mode on since %s\n":                           "Mode pemeliharaan aktif sejak %s\n",
+	"Message:  %s\n":                                           "Pesan:    %s\n",
+	"Sessions: closed at %s\n":                                 "Sesi: ditutup pada %s\n",
+	"Invalid destination '%s', expected <host:port>\n":         "Tujuan '%s' tidak valid, seharusnya <host:port>\n",
+	"%s may not connect to %s: denied by %s\n":                 "%s tidak boleh terhubung ke %s: ditolak oleh %s\n",
+	"%s may connect to %s: allowed by %s\n":                    "%s boleh terhubung ke %s: diizinkan oleh %s\n",
+	"Connections go through upstream %s\n":                     "Koneksi melewati upstream %s\n",
+	"You are running the latest release.":                      "Anda menggunakan rilis terbaru.",
+	"Already running the latest release (%s).\n":               "Sudah menggunakan rilis terbaru (%s).\n",
+	"A new release is available: %s (%s)\n":                    "Rilis baru tersedia: %s (%s)\n",
+	"Run 'ssh-ify self-update' to install it.":                 "Jalankan 'ssh-ify self-update' untuk memasangnya.",
+	"Updated to %s. Restart ssh-ify to use the new version.\n": "Diperbarui ke %s. Mulai ulang ssh-ify untuk menggunakan versi baru.\n",
+
+	// Labels of show-user, aligned per language.
+	"Username: %s\n": "Pengguna:    %s\n",
+	"Status:   %s\n": "Status:      %s\n",
+	"Created:  %s\n": "Dibuat:      %s\n",
+	"Schedule: %s\n": "Jadwal:      %s\n",
+	"Plan:     %s\n": "Paket:       %s\n",
+	"Expires:  %s\n": "Kedaluwarsa: %s\n",
+	"Locked:   %s\n": "Terkunci:    %s\n",
+	"Owner:    %s\n": "Pemilik:     %s\n",
+	"Contact:  %s\n": "Kontak:      %s\n",
+	"Notes:    %s\n": "Catatan:     %s\n",
+	"Cert:     %s\n": "Sertifikat:  %s\n",
+
+	"Sessions: %d (%d active)\n": "Sesi:        %d (%d aktif)\n",
+	"Month:    %s in, %s out\n":  "Bulan ini:   %s masuk, %s keluar\n",
+	"Last:     %s from %s\n":     "Terakhir:    %s dari %s\n",
+}
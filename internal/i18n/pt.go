@@ -0,0 +1,169 @@
+package i18n
+
+// pt is the Portuguese catalog.
+var pt = map[string]string{
+	// Server messages shown to clients.
+	"Welcome to ssh-ify.\n": "Bem-vindo ao ssh-ify.\n",
+	"The server is under maintenance, please try again later.":                              "O servidor está em manutenção, tente novamente mais tarde.",
+	"All sessions will be closed for maintenance in %s: %s":                                 "Todas as sessões serão encerradas para manutenção em %s: %s",
+	"This session will be closed in %s, having reached the maximum session duration of %s.": "Esta sessão será encerrada em %s ao atingir a duração máxima de sessão de %s.",
+	"Reset your password": "Redefina sua senha",
+	"Reset token":         "Token de redefinição",
+	"New password":        "Nova senha",
+	"Set password":        "Definir senha",
+	"Invalid request.":    "Solicitação inválida.",
+	"This reset token is invalid or has expired.": "Este token de redefinição é inválido ou expirou.",
+	"Password not changed: %v":                    "A senha não foi alterada: %v",
+	"Create your account":                         "Crie sua conta",
+	"Invite":                                      "Convite",
+	"Username":                                    "Usuário",
+	"Password":                                    "Senha",
+	"Create account":                              "Criar conta",
+	"This invite is invalid, used or has expired.":                               "Este convite é inválido, já foi usado ou expirou.",
+	"Account not created: %v":                                                    "A conta não foi criada: %v",
+	"Account '%s' created. You can now connect with your username and password.": "Conta '%s' criada. Agora você pode se conectar com seu usuário e senha.",
+	"Your password has been changed.":                                            "Sua senha foi alterada.",
+
+	// Results of user management commands.
+	"User '%s' added successfully!\n":                                    "Usuário '%s' adicionado com sucesso!\n",
+	"User '%s' removed successfully!\n":                                  "Usuário '%s' removido com sucesso!\n",
+	"User '%s' enabled successfully!\n":                                  "Usuário '%s' ativado com sucesso!\n",
+	"User '%s' disabled successfully!\n":                                 "Usuário '%s' desativado com sucesso!\n",
+	"User '%s' unlocked successfully!\n":                                 "Usuário '%s' desbloqueado com sucesso!\n",
+	"User '%s' archived successfully!\n":                                 "Usuário '%s' arquivado com sucesso!\n",
+	"User '%s' unarchived successfully!\n":                               "Usuário '%s' desarquivado com sucesso!\n",
+	"User '%s' updated successfully!\n":                                  "Usuário '%s' atualizado com sucesso!\n",
+	"Schedule for user '%s' updated successfully!\n":                     "O horário do usuário '%s' foi atualizado com sucesso!\n",
+	"Plan for user '%s' updated successfully!\n":                         "O plano do usuário '%s' foi atualizado com sucesso!\n",
+	"Expiry for user '%s' updated successfully!\n":                       "A expiração do usuário '%s' foi atualizada com sucesso!\n",
+	"User added successfully!":                                           "Usuário adicionado com sucesso!",
+	"Password changed successfully!":                                     "Senha alterada com sucesso!",
+	"Client certificate mapped to user '%s' successfully!\n":             "Certificado de cliente associado ao usuário '%s' com sucesso!\n",
+	"Client certificate removed from user '%s' successfully!\n":          "Certificado de cliente removido do usuário '%s' com sucesso!\n",
+	"User database backed up to '%s' successfully!\n":                    "Backup do banco de usuários salvo em '%s' com sucesso!\n",
+	"%d archived users purged.\n":                                        "%d usuários arquivados excluídos.\n",
+	"%d users restored from '%s' successfully!\n":                        "%d usuários restaurados de '%s' com sucesso!\n",
+	"Admin '%s' added successfully!\n":                                   "Administrador '%s' adicionado com sucesso!\n",
+	"Admin '%s' removed successfully!\n":                                 "Administrador '%s' removido com sucesso!\n",
+	"Quota for admin '%s' updated successfully!\n":                       "Cota do administrador '%s' atualizada com sucesso!\n",
+	"Tokens of admin '%s' revoked successfully!\n":                       "Tokens do administrador '%s' revogados com sucesso!\n",
+	"Token for admin '%s' (shown only once): %s\n":                       "Token do administrador '%s' (exibido apenas uma vez): %s\n",
+	"Reset token for user '%s' (shown only once, valid until %s): %s\n":  "Token de redefinição do usuário '%s' (exibido apenas uma vez, válido até %s): %s\n",
+	"Reset token for user '%s' (shown only once, valid until %s):\n%s\n": "Token de redefinição do usuário '%s' (exibido apenas uma vez, válido até %s):\n%s\n",
+	"Token for admin '%s' (shown only once):\n%s\n":                      "Token do administrador '%s' (exibido apenas uma vez):\n%s\n",
+	"Invite for one account (shown only once, valid until %s):\n%s\n":    "Convite para uma conta (exibido apenas uma vez, válido até %s):\n%s\n",
+	"Signup link: %s\n":                                                  "Link de cadastro: %s\n",
+	"%d invites revoked.\n":                                              "%d convites revogados.\n",
+	"Ban of '%s' lifted successfully!\n":                                 "Banimento de '%s' removido com sucesso!\n",
+
+	// Errors.
+	"Error adding user: %v\n":                                  "Erro ao adicionar o usuário: %v\n",
+	"Error removing user: %v\n":                                "Erro ao remover o usuário: %v\n",
+	"Error showing user: %v\n":                                 "Erro ao exibir o usuário: %v\n",
+	"Error updating user: %v\n":                                "Erro ao atualizar o usuário: %v\n",
+	"Error enabling user: %v\n":                                "Erro ao ativar o usuário: %v\n",
+	"Error disabling user: %v\n":                               "Erro ao desativar o usuário: %v\n",
+	"Error unlocking user: %v\n":                               "Erro ao desbloquear o usuário: %v\n",
+	"Error setting schedule: %v\n":                             "Erro ao definir o horário: %v\n",
+	"Error setting plan: %v\n":                                 "Erro ao definir o plano: %v\n",
+	"Error setting expiry: %v\n":                               "Erro ao definir a expiração: %v\n",
+	"Error setting quota: %v\n":                                "Erro ao definir a cota: %v\n",
+	"Error changing password: %v\n":                            "Erro ao alterar a senha: %v\n",
+	"Error archiving user: %v\n":                               "Erro ao arquivar o usuário: %v\n",
+	"Error unarchiving user: %v\n":                             "Erro ao desarquivar o usuário: %v\n",
+	"Error listing archived users: %v\n":                       "Erro ao listar os usuários arquivados: %v\n",
+	"Error purging archived users: %v\n":                       "Erro ao excluir os usuários arquivados: %v\n",
+	"Error restoring users: %v\n":                              "Erro ao restaurar os usuários: %v\n",
+	"Error backing up users: %v\n":                             "Erro ao fazer backup dos usuários: %v\n",
+	"Error adding client certificate: %v\n":                    "Erro ao adicionar o certificado de cliente: %v\n",
+	"Error removing client certificate: %v\n":                  "Erro ao remover o certificado de cliente: %v\n",
+	"Error adding admin: %v\n":                                 "Erro ao adicionar o administrador: %v\n",
+	"Error removing admin: %v\n":                               "Erro ao remover o administrador: %v\n",
+	"Error listing admins: %v\n":                               "Erro ao listar os administradores: %v\n",
+	"Error creating token: %v\n":                               "Erro ao criar o token: %v\n",
+	"Error creating reset token: %v\n":                         "Erro ao criar o token de redefinição: %v\n",
+	"Error exporting client profile: %v\n":                     "Erro ao exportar o perfil de cliente: %v\n",
+	"Error creating invite: %v\n":                              "Erro ao criar o convite: %v\n",
+	"Error listing invites: %v\n":                              "Erro ao listar os convites: %v\n",
+	"Error revoking invites: %v\n":                             "Erro ao revogar os convites: %v\n",
+	"Error revoking tokens: %v\n":                              "Erro ao revogar os tokens: %v\n",
+	"Error reading input: %v\n":                                "Erro ao ler a entrada: %v\n",
+	"Error reading password: %v\n":                             "Erro ao ler a senha: %v\n",
+	"Error generating report: %v\n":                            "Erro ao gerar o relatório: %v\n",
+	"Error listing sessions: %v\n":                             "Erro ao listar as sessões: %v\n",
+	"Error listing bans: %v\n":                                 "Erro ao listar os banimentos: %v\n",
+	"Error lifting ban: %v\n":                                  "Erro ao remover o banimento: %v\n",
+	"Error checking for updates: %v\n":                         "Erro ao verificar atualizações: %v\n",
+	"Error updating: %v\n":                                     "Erro ao atualizar: %v\n",
+	"Error: %v\n":                                              "Erro: %v\n",
+	"Error locating admin socket: %v\n":                        "Erro ao localizar o socket de administração: %v\n",
+	"Error reading cluster status: %v\n":                       "Erro ao ler o estado do cluster: %v\n",
+	"Error loading host key: %v\n":                             "Erro ao carregar a chave do host: %v\n",
+	"Invalid interval: %s\n":                                   "Intervalo inválido: %s\n",
+	"Invalid quota: %s\n":                                      "Cota inválida: %s\n",
+	"Unknown command: %s\n":                                    "Comando desconhecido: %s\n",
+	"Permission denied: '%s' may only list their own users.\n": "Permissão negada: '%s' só pode listar os próprios usuários.\n",
+	"Note: running server not notified: %v\n":                  "Nota: o servidor em execução não foi notificado: %v\n",
+	"Warning: Failed to create default user from environment variables: %v\n": "Aviso: falha ao criar o usuário padrão a partir das variáveis de ambiente: %v\n",
+
+	// Prompts and interactive mode.
+	"Enter username: ":                                      "Nome de usuário: ",
+	"Enter password: ":                                      "Senha: ",
+	"Confirm password: ":                                    "Confirme a senha: ",
+	"Enter new password: ":                                  "Nova senha: ",
+	"Confirm new password: ":                                "Confirme a nova senha: ",
+	"Enter admin password: ":                                "Senha do administrador: ",
+	"Password for admin '%s': ":                             "Senha do administrador '%s': ",
+	"SSH-ify User Management":                               "SSH-ify - Gerenciamento de usuários",
+	"Type 'help' for available commands or 'quit' to exit.": "Digite 'help' para ver os comandos disponíveis ou 'quit' para sair.",
+	"Type 'help' for available commands.":                   "Digite 'help' para ver os comandos disponíveis.",
+	"User Management Commands:":                             "Comandos de gerenciamento de usuários:",
+	"Goodbye!":                                              "Até logo!",
+	"No users found.":                                       "Nenhum usuário encontrado.",
+	"No admins found.":                                      "Nenhum administrador encontrado.",
+	"No archived users.":                                    "Nenhum usuário arquivado.",
+	"Archive user '%s'?":                                    "Arquivar o usuário '%s'?",
+	"Permanently remove user '%s'?":                         "Remover definitivamente o usuário '%s'?",
+	"Permanently delete all archived users?":                "Excluir definitivamente todos os usuários arquivados?",
+	"Permanently delete archived user '%s'?":                "Excluir definitivamente o usuário arquivado '%s'?",
+	"Replace all users with the %d users in '%s'?":          "Substituir todos os usuários pelos %d usuários de '%s'?",
+	"Aborted.": "Cancelado.",
+	"Aborted; pass --yes to skip this confirmation.": "Cancelado; use --yes para pular esta confirmação.",
+	"No pending invites.":                            "Nenhum convite pendente.",
+	"Revoke all pending invites?":                    "Revogar todos os convites pendentes?",
+	"No banned IPs.":                                 "Nenhum IP banido.",
+
+	// Status output.
+	"%d active sessions\n":                                     "%d sessões ativas\n",
+	"Maintenance mode is off.":                                 "O modo de manutenção está desligado.",
+	"Maintenance mode off; new sessions are accepted again.":   "Modo de manutenção desligado; novas sessões voltam a ser aceitas.",
+	"Maintenance mode on since %s\n":                           "Modo de manutenção ligado desde %s\n",
+	"Message:  %s\n":                                           "Mensagem: %s\n",
+	"Sessions: closed at %s\n":                                 "Sessões: encerradas às %s\n",
+	"Invalid destination '%s', expected <host:port>\n":         "Destino '%s' inválido, esperado <host:porta>\n",
+	"%s may not connect to %s: denied by %s\n":                 "%s não pode se conectar a %s: negado por %s\n",
+	"%s may connect to %s: allowed by %s\n":                    "%s pode se conectar a %s: permitido por %s\n",
+	"Connections go through upstream %s\n":                     "As conexões passam pelo upstream %s\n",
+	"You are running the latest release.":                      "Você está usando a versão mais recente.",
+	"Already running the latest release (%s).\n":               "Já está usando a versão mais recente (%s).\n",
+	"A new release is available: %s (%s)\n":                    "Uma nova versão está disponível: %s (%s)\n",
+	"Run 'ssh-ify self-update' to install it.":                 "Execute 'ssh-ify self-update' para instalá-la.",
+	"Updated to %s. Restart ssh-ify to use the new version.\n": "Atualizado para %s. Reinicie o ssh-ify para usar a nova versão.\n",
+
+	// Labels of show-user, aligned per language.
+	"Username: %s\n": "Usuário:   %s\n",
+	"Status:   %s\n": "Status:    %s\n",
+	"Created:  %s\n": "Criado:    %s\n",
+	"Schedule: %s\n": "Horário:   %s\n",
+	"Plan:     %s\n": "Plano:     %s\n",
+	"Expires:  %s\n": "Expira:    %s\n",
+	"Locked:   %s\n": "Bloqueado: %s\n",
+	"Owner:    %s\n": "Dono:      %s\n",
+	"Contact:  %s\n": "Contato:   %s\n",
+	"Notes:    %s\n": "Notas:     %s\n",
+	"Cert:     %s\n": "Cert:      %s\n",
+
+	"Sessions: %d (%d active)\n": "Sessões:   %d (%d ativas)\n",
+	"Month:    %s in, %s out\n":  "Este mês:  %s recebidos, %s enviados\n",
+	"Last:     %s from %s\n":     "Última:    %s de %s\n",
+}
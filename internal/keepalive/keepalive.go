@@ -0,0 +1,80 @@
+// Package keepalive holds how often each transport sends keepalives to idle clients.
+// Frequent keepalives stop carrier-grade NATs and proxies from dropping idle tunnels but
+// keep the radio of phones awake; presets pick intervals suited to either case, and each
+// interval can still be set on its own.
+package keepalive
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// Intervals are the keepalive intervals of each transport. Zero turns a keepalive off.
+type Intervals struct {
+	WebSocketPing time.Duration // Ping frames sent on WebSocket-framed forwards
+	SSH           time.Duration // keepalive@openssh.com requests sent on SSH connections
+	TCP           time.Duration // TCP keepalive probes sent on idle client connections
+}
+
+// Presets maps the names accepted by SSH_IFY_KEEPALIVE_PRESET to their intervals.
+var Presets = map[string]Intervals{
+	// default keeps the behavior of earlier releases: only the TCP keepalives the Go
+	// runtime enables.
+	"default": {TCP: 15 * time.Second},
+
+	// mobile probes rarely, just often enough for common carrier NAT timeouts, so that
+	// idle phones can sleep, and notices vanished clients within half an hour.
+	"mobile": {SSH: 10 * time.Minute, TCP: 4 * time.Minute},
+
+	// nat keeps tunnels busy enough for aggressive NATs, firewalls and CDNs that drop
+	// connections idle for a minute or two.
+	"nat": {WebSocketPing: 25 * time.Second, SSH: time.Minute, TCP: 30 * time.Second},
+}
+
+// Keepalive settings, read from the environment at startup.
+var (
+	// Preset names the entry of Presets the intervals default to, read from
+	// SSH_IFY_KEEPALIVE_PRESET.
+	Preset = config.Env("SSH_IFY_KEEPALIVE_PRESET", "default")
+
+	// WebSocketPing is how often a ping frame is sent on WebSocket-framed forwards, read
+	// from SSH_IFY_WEBSOCKET_PING_INTERVAL.
+	WebSocketPing = config.EnvDuration("SSH_IFY_WEBSOCKET_PING_INTERVAL", preset().WebSocketPing)
+
+	// SSH is how often a keepalive request is sent on SSH connections, read from
+	// SSH_IFY_SSH_KEEPALIVE_INTERVAL.
+	SSH = config.EnvDuration("SSH_IFY_SSH_KEEPALIVE_INTERVAL", preset().SSH)
+
+	// SSHCountMax is the number of SSH keepalive intervals a client may leave a request
+	// unanswered before it is disconnected, read from SSH_IFY_SSH_KEEPALIVE_COUNT.
+	SSHCountMax = config.EnvInt("SSH_IFY_SSH_KEEPALIVE_COUNT", 3)
+
+	// TCP is how long a client connection may be idle before TCP keepalive probes are
+	// sent, and how often they are sent then, read from SSH_IFY_TCP_KEEPALIVE_INTERVAL.
+	TCP = config.EnvDuration("SSH_IFY_TCP_KEEPALIVE_INTERVAL", preset().TCP)
+)
+
+// preset returns the intervals of Preset, or of the default preset if it is unknown.
+func preset() Intervals {
+	if p, ok := Presets[Preset]; ok {
+		return p
+	}
+	return Presets["default"]
+}
+
+// Check returns an error if Preset names no preset.
+func Check() error {
+	if _, ok := Presets[Preset]; ok {
+		return nil
+	}
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return fmt.Errorf("unknown keepalive preset %q (expected %s)", Preset, strings.Join(names, ", "))
+}
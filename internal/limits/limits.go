@@ -0,0 +1,277 @@
+// Package limits keeps the state behind brute-force bans and per-user session limits.
+// The state lives in process memory, or in Redis in cluster mode so that limits are
+// enforced across every node.
+package limits
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// Limit configuration, read from the environment at startup. The session, forward and
+// ban limits can be changed at runtime.
+var (
+	// BanThreshold is the number of failed logins from one IP within BanWindow that
+	// bans it. It is read from SSH_IFY_BAN_THRESHOLD; 0 disables banning.
+	BanThreshold = config.EnvTunableInt("SSH_IFY_BAN_THRESHOLD", 0)
+
+	// BanWindow is the period failed logins are counted over. It is read from
+	// SSH_IFY_BAN_WINDOW.
+	BanWindow = config.EnvDuration("SSH_IFY_BAN_WINDOW", 10*time.Minute)
+
+	// BanDuration is how long a banned IP is refused. It is read from SSH_IFY_BAN_DURATION.
+	BanDuration = config.EnvTunableDuration("SSH_IFY_BAN_DURATION", time.Hour)
+
+	// MaxSessionsPerUser caps the concurrent sessions of one user. It is read from
+	// SSH_IFY_MAX_SESSIONS_PER_USER; 0 means unlimited.
+	MaxSessionsPerUser = config.EnvTunableInt("SSH_IFY_MAX_SESSIONS_PER_USER", 0)
+
+	// MaxForwardsPerConnection caps the port forwarding channels one SSH connection may
+	// have open at once. It is read from SSH_IFY_MAX_FORWARDS_PER_CONNECTION; 0 means
+	// unlimited.
+	MaxForwardsPerConnection = config.EnvTunableInt("SSH_IFY_MAX_FORWARDS_PER_CONNECTION", 256)
+
+	// MaxSessionDuration is the longest a user's SSH connection or raw forward may last
+	// before it is closed. It is read from SSH_IFY_MAX_SESSION_DURATION; 0 means unlimited.
+	MaxSessionDuration = config.EnvTunableDuration("SSH_IFY_MAX_SESSION_DURATION", 0)
+
+	// SessionDurationWarning is how long before reaching its maximum duration a connection
+	// is warned that it will be closed. It is read from SSH_IFY_SESSION_DURATION_WARNING;
+	// 0 closes connections without warning.
+	SessionDurationWarning = config.EnvDuration("SSH_IFY_SESSION_DURATION_WARNING", 5*time.Minute)
+
+	// AccountThrottleDelay is the delay before answering a password attempt for an account
+	// after its first failed login; it doubles with every further failure. It is read from
+	// SSH_IFY_ACCOUNT_THROTTLE_DELAY; 0 disables account throttling.
+	AccountThrottleDelay = config.EnvDuration("SSH_IFY_ACCOUNT_THROTTLE_DELAY", 0)
+
+	// AccountThrottleMax caps the delay of account throttling. It is read from
+	// SSH_IFY_ACCOUNT_THROTTLE_MAX.
+	AccountThrottleMax = config.EnvDuration("SSH_IFY_ACCOUNT_THROTTLE_MAX", 30*time.Second)
+
+	// AccountThrottleWindow is the period failed logins of an account are counted over.
+	// It is read from SSH_IFY_ACCOUNT_THROTTLE_WINDOW.
+	AccountThrottleWindow = config.EnvDuration("SSH_IFY_ACCOUNT_THROTTLE_WINDOW", 15*time.Minute)
+
+	// AccountLockThreshold is the number of failed password attempts for an account within
+	// AccountThrottleWindow that locks it. It is read from SSH_IFY_ACCOUNT_LOCK_THRESHOLD;
+	// 0 disables account locking.
+	AccountLockThreshold = config.EnvInt("SSH_IFY_ACCOUNT_LOCK_THRESHOLD", 0)
+
+	// AccountLockDuration is how long a locked account stays locked before it unlocks
+	// itself. It is read from SSH_IFY_ACCOUNT_LOCK_DURATION; 0 keeps accounts locked until
+	// they are unlocked with ssh-ify unlock-user.
+	AccountLockDuration = config.EnvDuration("SSH_IFY_ACCOUNT_LOCK_DURATION", time.Hour)
+)
+
+// Store holds ban, login failure and concurrent session state.
+type Store interface {
+	// Ban refuses ip until the given duration has passed.
+	Ban(ip string, d time.Duration) error
+	// Unban lifts a ban on ip.
+	Unban(ip string) error
+	// Banned reports whether ip is currently banned.
+	Banned(ip string) (bool, error)
+	// Bans returns the banned IPs and when their bans expire.
+	Bans() (map[string]time.Time, error)
+
+	// AddFailure counts a failed login for key and returns the number of failures
+	// within window, counted from the first failure.
+	AddFailure(key string, window time.Duration) (int, error)
+	// Failures returns the number of failed logins of key within window, without counting one.
+	Failures(key string, window time.Duration) (int, error)
+	// ResetFailures forgets the failed logins of key.
+	ResetFailures(key string) error
+
+	// AcquireSession counts a new session of user and reports whether it is allowed
+	// under max concurrent sessions (0 means unlimited). A refused session is not counted.
+	AcquireSession(user string, max int) (bool, error)
+	// ReleaseSession uncounts a session acquired with AcquireSession.
+	ReleaseSession(user string) error
+	// Sessions returns the number of sessions of user currently counted.
+	Sessions(user string) (int, error)
+}
+
+var (
+	sharedOnce  sync.Once
+	sharedStore Store
+)
+
+// Shared returns the process-wide store: a Redis store in cluster mode, otherwise an
+// in-memory store.
+func Shared() Store {
+	sharedOnce.Do(func() {
+		if client := cluster.Client(); client != nil {
+			sharedStore = NewRedisStore(client)
+		} else {
+			sharedStore = NewMemoryStore(clock.Real{})
+		}
+	})
+	return sharedStore
+}
+
+// AccountKey returns the key failed logins of user are tracked by. It cannot collide
+// with an IP.
+func AccountKey(user string) string {
+	return "account:" + user
+}
+
+// ThrottleDelay returns the delay before answering a password attempt for an account
+// with the given number of recent failures: none for the first attempt, then
+// AccountThrottleDelay doubling with each failure up to AccountThrottleMax.
+func ThrottleDelay(failures int) time.Duration {
+	if AccountThrottleDelay <= 0 || failures <= 0 {
+		return 0
+	}
+	delay := AccountThrottleDelay
+	for i := 1; i < failures && delay < AccountThrottleMax; i++ {
+		delay *= 2
+	}
+	return min(delay, AccountThrottleMax)
+}
+
+// IP returns the host part of addr, which is the key bans and failures are tracked by.
+func IP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// failureWindow counts failures since start.
+type failureWindow struct {
+	count int
+	start time.Time
+}
+
+// MemoryStore is a Store for a single process.
+type MemoryStore struct {
+	clock    clock.Clock
+	mutex    sync.Mutex
+	bans     map[string]time.Time
+	failures map[string]*failureWindow
+	sessions map[string]int
+}
+
+// NewMemoryStore creates an empty in-memory store using c as its time source.
+func NewMemoryStore(c clock.Clock) *MemoryStore {
+	return &MemoryStore{
+		clock:    c,
+		bans:     make(map[string]time.Time),
+		failures: make(map[string]*failureWindow),
+		sessions: make(map[string]int),
+	}
+}
+
+// Ban refuses ip until the given duration has passed.
+func (m *MemoryStore) Ban(ip string, d time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bans[ip] = m.clock.Now().Add(d)
+	return nil
+}
+
+// Unban lifts a ban on ip.
+func (m *MemoryStore) Unban(ip string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.bans, ip)
+	return nil
+}
+
+// Banned reports whether ip is currently banned.
+func (m *MemoryStore) Banned(ip string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	until, ok := m.bans[ip]
+	if ok && !m.clock.Now().Before(until) {
+		delete(m.bans, ip)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// Bans returns the banned IPs and when their bans expire.
+func (m *MemoryStore) Bans() (map[string]time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.clock.Now()
+	bans := make(map[string]time.Time, len(m.bans))
+	for ip, until := range m.bans {
+		if !now.Before(until) {
+			delete(m.bans, ip)
+			continue
+		}
+		bans[ip] = until
+	}
+	return bans, nil
+}
+
+// AddFailure counts a failed login for key and returns the failures within window.
+func (m *MemoryStore) AddFailure(key string, window time.Duration) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.clock.Now()
+	w, ok := m.failures[key]
+	if !ok || now.Sub(w.start) >= window {
+		w = &failureWindow{start: now}
+		m.failures[key] = w
+	}
+	w.count++
+	return w.count, nil
+}
+
+// Failures returns the failures of key within window.
+func (m *MemoryStore) Failures(key string, window time.Duration) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	w, ok := m.failures[key]
+	if !ok || m.clock.Now().Sub(w.start) >= window {
+		return 0, nil
+	}
+	return w.count, nil
+}
+
+// ResetFailures forgets the failed logins of key.
+func (m *MemoryStore) ResetFailures(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.failures, key)
+	return nil
+}
+
+// AcquireSession counts a new session of user if it is allowed under max.
+func (m *MemoryStore) AcquireSession(user string, max int) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if max > 0 && m.sessions[user] >= max {
+		return false, nil
+	}
+	m.sessions[user]++
+	return true, nil
+}
+
+// ReleaseSession uncounts a session of user.
+func (m *MemoryStore) ReleaseSession(user string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.sessions[user] <= 1 {
+		delete(m.sessions, user)
+	} else {
+		m.sessions[user]--
+	}
+	return nil
+}
+
+// Sessions returns the number of sessions of user.
+func (m *MemoryStore) Sessions(user string) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.sessions[user], nil
+}
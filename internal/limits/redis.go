@@ -0,0 +1,205 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
+)
+
+// RedisStore is a Store shared by every node of a cluster.
+//
+// Bans are a hash of IP to expiry, failures are counters expiring with their window, and
+// session counts are kept in one hash per node so that a node that crashed stops
+// counting once it drops out of the cluster.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore returns a store on client. Session counts left behind by a previous run
+// of this node are cleared.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	client.Del(sessionsKey(cluster.NodeName))
+	return &RedisStore{client: client}
+}
+
+// sessionsKey returns the key of a node's session count hash.
+func sessionsKey(node string) string {
+	return cluster.Key("sessions:" + node)
+}
+
+// Ban refuses ip until the given duration has passed.
+func (r *RedisStore) Ban(ip string, d time.Duration) error {
+	until := time.Now().Add(d).UnixNano()
+	return r.client.HSet(cluster.Key("bans"), ip, strconv.FormatInt(until, 10))
+}
+
+// Unban lifts a ban on ip.
+func (r *RedisStore) Unban(ip string) error {
+	return r.client.HDel(cluster.Key("bans"), ip)
+}
+
+// Banned reports whether ip is currently banned.
+func (r *RedisStore) Banned(ip string) (bool, error) {
+	value, err := r.client.HGet(cluster.Key("bans"), ip)
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !time.Now().Before(parseExpiry(value)) {
+		r.client.HDel(cluster.Key("bans"), ip)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Bans returns the banned IPs and when their bans expire.
+func (r *RedisStore) Bans() (map[string]time.Time, error) {
+	fields, err := r.client.HGetAll(cluster.Key("bans"))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bans := make(map[string]time.Time, len(fields))
+	for ip, value := range fields {
+		until := parseExpiry(value)
+		if !now.Before(until) {
+			r.client.HDel(cluster.Key("bans"), ip)
+			continue
+		}
+		bans[ip] = until
+	}
+	return bans, nil
+}
+
+// parseExpiry parses a ban expiry stored as Unix nanoseconds. Invalid values are
+// treated as already expired.
+func parseExpiry(value string) time.Time {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// AddFailure counts a failed login for key and returns the failures within window. The
+// counter is created with its expiry and incremented in one transaction, so that it
+// never outlives its window, even if a node fails midway.
+func (r *RedisStore) AddFailure(key string, window time.Duration) (int, error) {
+	k := cluster.Key("failures:" + key)
+	ttl := strconv.FormatInt(max(window.Milliseconds(), 1), 10)
+	replies, err := r.client.Transaction([]string{"SET", k, "0", "PX", ttl, "NX"}, []string{"INCR", k})
+	if err != nil {
+		return 0, err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(redis.Error); ok {
+			return 0, err
+		}
+	}
+	var n int64
+	if len(replies) == 2 {
+		n, _ = replies[1].(int64)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("redis: unexpected transaction replies %v", replies)
+	}
+	return int(n), nil
+}
+
+// Failures returns the failures of key within window. The window is enforced by the
+// counter's expiry.
+func (r *RedisStore) Failures(key string, window time.Duration) (int, error) {
+	value, err := r.client.Get(cluster.Key("failures:" + key))
+	if errors.Is(err, redis.ErrNil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// ResetFailures forgets the failed logins of key.
+func (r *RedisStore) ResetFailures(key string) error {
+	return r.client.Del(cluster.Key("failures:" + key))
+}
+
+// AcquireSession counts a new session of user if it is allowed under max. The session is
+// counted before the cluster-wide total is checked, so concurrent logins on different
+// nodes may both be refused but never both admitted over the limit.
+func (r *RedisStore) AcquireSession(user string, max int) (bool, error) {
+	if _, err := r.client.HIncrBy(sessionsKey(cluster.NodeName), user, 1); err != nil {
+		return false, err
+	}
+	if max <= 0 {
+		return true, nil
+	}
+	total, err := r.countSessions(user)
+	if err == nil && total <= max {
+		return true, nil
+	}
+	r.ReleaseSession(user)
+	return false, err
+}
+
+// countSessions sums the sessions of user over this node and every live node.
+func (r *RedisStore) countSessions(user string) (int, error) {
+	total, err := r.nodeSessions(cluster.NodeName, user)
+	if err != nil {
+		return 0, err
+	}
+	nodes, err := r.client.SMembers(cluster.Key("nodes"))
+	if err != nil {
+		return 0, err
+	}
+	for _, node := range nodes {
+		if node == cluster.NodeName {
+			continue
+		}
+		live, err := r.client.Exists(cluster.Key("node:" + node))
+		if err != nil {
+			return 0, err
+		}
+		if !live {
+			continue
+		}
+		n, err := r.nodeSessions(node, user)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// nodeSessions returns the sessions of user counted by node.
+func (r *RedisStore) nodeSessions(node, user string) (int, error) {
+	value, err := r.client.HGet(sessionsKey(node), user)
+	if errors.Is(err, redis.ErrNil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// Sessions returns the number of sessions of user on this node and every live node.
+func (r *RedisStore) Sessions(user string) (int, error) {
+	return r.countSessions(user)
+}
+
+// ReleaseSession uncounts a session of user.
+func (r *RedisStore) ReleaseSession(user string) error {
+	n, err := r.client.HIncrBy(sessionsKey(cluster.NodeName), user, -1)
+	if err == nil && n <= 0 {
+		err = r.client.HDel(sessionsKey(cluster.NodeName), user)
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package limits
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis/redistest"
+)
+
+// newRedisStore returns a store on a new redistest server.
+func newRedisStore(t *testing.T) (*RedisStore, *redistest.Server) {
+	t.Helper()
+	server := redistest.NewServer(t)
+	client, err := redis.ParseURL(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client), server
+}
+
+func TestRedisFailuresExpire(t *testing.T) {
+	store, server := newRedisStore(t)
+	key := cluster.Key("failures:192.0.2.1")
+	for want := 1; want <= 3; want++ {
+		n, err := store.AddFailure("192.0.2.1", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("AddFailure = %d, want %d", n, want)
+		}
+	}
+	if ttl, ok := server.TTL(key); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("failure counter expires in %s (set %t), want within the window", ttl, ok)
+	}
+}
+
+func TestRedisFailureCounterNeverLosesExpiry(t *testing.T) {
+	store, server := newRedisStore(t)
+	key := cluster.Key("failures:192.0.2.2")
+	// The increment fails after the counter was created.
+	server.Fail("INCR", 1)
+	if _, err := store.AddFailure("192.0.2.2", time.Minute); err == nil {
+		t.Fatal("AddFailure succeeded although INCR failed")
+	}
+	if _, ok := server.TTL(key); !ok {
+		t.Fatal("failure counter left without an expiry")
+	}
+	if n, err := store.AddFailure("192.0.2.2", time.Minute); err != nil || n != 1 {
+		t.Fatalf("AddFailure after the failure = %d, %v, want 1", n, err)
+	}
+}
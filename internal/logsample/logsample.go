@@ -0,0 +1,128 @@
+// Package logsample limits how often high-frequency log messages, such as copy errors
+// and scanner probes, are written, summarizing the ones it suppresses, so that a single
+// abusive client cannot fill the disk through the logger.
+package logsample
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Sampling configuration, read from the environment at startup and changeable at runtime.
+var (
+	// Burst is the number of messages of one kind logged per Interval; later ones are
+	// suppressed until the interval ends. It is read from SSH_IFY_LOG_SAMPLE_BURST; 0
+	// logs every message.
+	Burst = config.EnvTunableInt("SSH_IFY_LOG_SAMPLE_BURST", 20)
+
+	// Interval is the period Burst applies to. It is read from SSH_IFY_LOG_SAMPLE_INTERVAL.
+	Interval = config.EnvTunableDuration("SSH_IFY_LOG_SAMPLE_INTERVAL", time.Minute)
+)
+
+// Kinds of sampled messages
+const (
+	CopyError    = "copy_error"    // Relaying between a client and its destination failed
+	BadRequest   = "bad_request"   // A client sent a malformed, oversized or incomplete request
+	TLSHandshake = "tls_handshake" // A TLS handshake failed
+	Banned       = "banned"        // A banned client connected
+	TunnelKey    = "tunnel_key"    // An upgrade request failed the pre-shared key gate
+	LoginFailed  = "login_failed"  // A login attempt failed
+	ProofOfWork  = "pow"           // A client was challenged for, or failed, proof of work
+)
+
+// suppressed counts messages not logged, by kind.
+var suppressed = metrics.NewCounterVec("ssh_ify_log_messages_suppressed_total",
+	"Number of log messages suppressed by sampling, by kind.", "kind")
+
+// window counts the messages of one kind logged and suppressed since start.
+type window struct {
+	start      time.Time
+	logged     int
+	suppressed int
+}
+
+// Sampler logs at most burst messages of each kind per interval. Once an interval in
+// which messages were suppressed ends, it logs how many were.
+type Sampler struct {
+	limits  func() (burst int, interval time.Duration)
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// New returns a sampler logging burst messages of each kind per interval. A burst of
+// zero or less logs every message.
+func New(burst int, interval time.Duration) *Sampler {
+	return newSampler(func() (int, time.Duration) { return burst, interval })
+}
+
+// newSampler returns a sampler reading its burst and interval from limits at every message.
+func newSampler(limits func() (int, time.Duration)) *Sampler {
+	return &Sampler{limits: limits, windows: make(map[string]*window)}
+}
+
+// Printf logs a message of the given kind, formatted like log.Printf, unless the burst
+// of its kind is used up.
+func (s *Sampler) Printf(kind, format string, args ...any) {
+	burst, interval := s.limits()
+	if burst <= 0 || interval <= 0 {
+		log.Printf(format, args...)
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	w := s.windows[kind]
+	if w == nil || now.Sub(w.start) >= interval {
+		if w != nil {
+			s.summarizeLocked(kind, w, interval)
+		}
+		w = &window{start: now}
+		s.windows[kind] = w
+	}
+	if w.logged < burst {
+		w.logged++
+		s.mu.Unlock()
+		log.Printf(format, args...)
+		return
+	}
+	w.suppressed++
+	if w.suppressed == 1 {
+		// Report at the end of the window even if no further message of this kind comes.
+		time.AfterFunc(w.start.Add(interval).Sub(now), func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.windows[kind] == w {
+				s.summarizeLocked(kind, w, interval)
+				delete(s.windows, kind)
+			}
+		})
+	}
+	s.mu.Unlock()
+	suppressed.Inc(kind)
+}
+
+// summarizeLocked logs how many messages of kind w, an interval long, suppressed, if any.
+func (s *Sampler) summarizeLocked(kind string, w *window, interval time.Duration) {
+	if w.suppressed > 0 {
+		log.Printf("Suppressed %d similar %s messages in the last %s", w.suppressed, kind, interval)
+		w.suppressed = 0
+	}
+}
+
+var (
+	sharedOnce    sync.Once
+	sharedSampler *Sampler
+)
+
+// Printf logs a message of the given kind through the process-wide sampler, configured
+// by the current Burst and Interval.
+func Printf(kind, format string, args ...any) {
+	sharedOnce.Do(func() {
+		sharedSampler = newSampler(func() (int, time.Duration) { return Burst.Load(), Interval.Load() })
+	})
+	sharedSampler.Printf(kind, format, args...)
+}
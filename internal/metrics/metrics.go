@@ -0,0 +1,279 @@
+// Package metrics provides a minimal, dependency-free metrics registry for ssh-ify
+// that is exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metric is implemented by every registered metric type.
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holds metrics in registration order.
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds m under name, panicking on duplicate names like other metric libraries.
+func (r *Registry) register(name string, m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, m := range r.metrics {
+		m.write(w)
+	}
+}
+
+// ServeHTTP implements http.Handler for the /metrics endpoint.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// formatValue formats a sample value.
+func formatValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing integer metric.
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+// NewCounter creates and registers a counter in the default registry.
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	Default.register(name, c)
+	return c
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n, which must not be negative.
+func (c *Counter) Add(n int64) {
+	if n > 0 {
+		c.value.Add(n)
+	}
+}
+
+// Value returns the current count.
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Gauge is an integer metric that can go up and down.
+type Gauge struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+// NewGauge creates and registers a gauge in the default registry.
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	Default.register(name, g)
+	return g
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v int64) {
+	g.value.Store(v)
+}
+
+// Add adds delta (which may be negative) to the gauge.
+func (g *Gauge) Add(delta int64) {
+	g.value.Add(delta)
+}
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %d\n", g.name, g.Value())
+}
+
+// GaugeFunc is a gauge whose value is computed when metrics are collected.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc creates and registers a computed gauge in the default registry.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	Default.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.fn()))
+}
+
+// CounterFunc is a counter whose value is computed when metrics are collected, for counts
+// kept elsewhere.
+type CounterFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewCounterFunc creates and registers a computed counter in the default registry.
+func NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	c := &CounterFunc{name: name, help: help, fn: fn}
+	Default.register(name, c)
+	return c
+}
+
+func (c *CounterFunc) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %s\n", c.name, formatValue(c.fn()))
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.RWMutex
+	values map[string]*atomic.Int64 // keyed by the joined label values
+}
+
+// NewCounterVec creates and registers a labeled counter family in the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*atomic.Int64)}
+	Default.register(name, c)
+	return c
+}
+
+// labelSeparator joins label values into map keys; it cannot appear in valid UTF-8 text.
+const labelSeparator = "\xff"
+
+// Add adds n to the counter for the given label values.
+func (c *CounterVec) Add(n int64, values ...string) {
+	if len(values) != len(c.labels) {
+		log.Printf("metrics: %s expects %d label values, got %d", c.name, len(c.labels), len(values))
+		return
+	}
+	key := strings.Join(values, labelSeparator)
+
+	c.mutex.RLock()
+	v, ok := c.values[key]
+	c.mutex.RUnlock()
+	if !ok {
+		c.mutex.Lock()
+		if v, ok = c.values[key]; !ok {
+			v = new(atomic.Int64)
+			c.values[key] = v
+		}
+		c.mutex.Unlock()
+	}
+	v.Add(n)
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the count for the given label values.
+func (c *CounterVec) Value(values ...string) int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if v, ok := c.values[strings.Join(values, labelSeparator)]; ok {
+		return v.Load()
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mutex.RLock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := strings.Split(k, labelSeparator)
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = fmt.Sprintf("%s=%q", label, values[i])
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", c.name, strings.Join(pairs, ","), c.values[k].Load())
+	}
+	c.mutex.RUnlock()
+}
+
+// ListenAndServe serves the default registry on addr at /metrics. It blocks until the
+// server fails.
+func ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ln)
+}
+
+// Serve serves the default registry at /metrics on connections accepted from ln. It
+// blocks until the listener fails or is closed.
+func Serve(ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Default)
+	log.Printf("Metrics server listening on %s", ln.Addr())
+	return http.Serve(ln, mux)
+}
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// AuditEnabled appends every forwarding decision to the policy audit log in the config
+// directory. It is read from SSH_IFY_POLICY_AUDIT.
+var AuditEnabled = config.EnvBool("SSH_IFY_POLICY_AUDIT", false)
+
+// decisions counts forwarding decisions by the rule that made them, so that rules which
+// are never hit, or hit far more than expected, stand out.
+var decisions = metrics.NewCounterVec("ssh_ify_policy_decisions_total",
+	"Forwarding decisions by action and the rule that made them.", "action", "rule")
+
+// AuditRecord describes one forwarding decision.
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Client  string    `json:"client,omitempty"` // IP the user connected from
+	Host    string    `json:"host"`
+	Port    int       `json:"port"`
+	Allowed bool      `json:"allowed"`
+	Rule    string    `json:"rule"`
+	Via     string    `json:"via,omitempty"` // Upstream allowed connections go through
+}
+
+// AuditLog is an append-only JSON Lines file of forwarding decisions.
+type AuditLog struct {
+	filePath string
+	mutex    sync.Mutex
+}
+
+// NewAuditLog returns an audit log backed by path, or by the policy audit log in the
+// config directory if path is empty.
+func NewAuditLog(path string) *AuditLog {
+	if path == "" {
+		configPath, err := config.GetPolicyAuditPath()
+		if err != nil {
+			// Fallback to current directory if config dir fails
+			path = "policy-audit.jsonl"
+		} else {
+			path = configPath
+		}
+	}
+	return &AuditLog{filePath: path}
+}
+
+// Append writes a record to the end of the log.
+func (l *AuditLog) Append(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	file, err := os.OpenFile(l.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// AuditFilter selects audit records. Empty fields match every record.
+type AuditFilter struct {
+	User        string
+	Client      string    // IP the user connected from
+	Destination string    // Host, or host:port, connected to
+	Since       time.Time // Earliest decision time, inclusive
+	Until       time.Time // Latest decision time, exclusive
+}
+
+// Match reports whether rec passes the filter.
+func (f AuditFilter) Match(rec AuditRecord) bool {
+	if f.User != "" && rec.User != f.User {
+		return false
+	}
+	if f.Client != "" && rec.Client != f.Client {
+		return false
+	}
+	if f.Destination != "" {
+		host, port, err := net.SplitHostPort(f.Destination)
+		if err != nil {
+			host, port = f.Destination, ""
+		}
+		if !strings.EqualFold(rec.Host, host) || port != "" && port != strconv.Itoa(rec.Port) {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	return f.Until.IsZero() || rec.Time.Before(f.Until)
+}
+
+// Scan calls fn with each record matching filter in the order they were appended,
+// stopping at the first error fn returns. Appends are not held up while it runs.
+func (l *AuditLog) Scan(filter AuditFilter, fn func(AuditRecord) error) error {
+	file, err := os.Open(l.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s:%d: %v", l.filePath, line, err)
+		}
+		if !filter.Match(rec) {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+var (
+	sharedAuditOnce sync.Once
+	sharedAudit     *AuditLog
+)
+
+// Record counts a decision of whether user, connected from the IP client, may connect to
+// host:port and, if auditing is enabled, appends it to the audit log in the config directory.
+func Record(user, client, host string, port int, decision Decision) {
+	action := Deny
+	if decision.Allowed {
+		action = Allow
+	}
+	decisions.Inc(action, decision.Rule)
+	if !AuditEnabled {
+		return
+	}
+
+	sharedAuditOnce.Do(func() { sharedAudit = NewAuditLog("") })
+	rec := AuditRecord{Time: time.Now(), User: user, Client: client, Host: host, Port: port, Allowed: decision.Allowed, Rule: decision.Rule}
+	if decision.Via != nil {
+		rec.Via = decision.Via.Name()
+	}
+	if err := sharedAudit.Append(rec); err != nil {
+		log.Printf("Failed to write forwarding decision to the audit log: %v", err)
+	}
+}
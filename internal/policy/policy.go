@@ -0,0 +1,320 @@
+// Package policy decides which destinations users may open connections to, for SSH port
+// forwarding and raw WebSocket forwarding alike, and which upstream they are reached through.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/upstream"
+)
+
+// Rule actions
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Rule matches connections by user, destination host and port. Empty lists match everything.
+type Rule struct {
+	Name   string   `json:"name,omitempty"`  // Shown in logs; defaults to "rule <n>"
+	Action string   `json:"action"`          // Allow or Deny
+	Users  []string `json:"users,omitempty"` // Usernames the rule applies to
+	Hosts  []string `json:"hosts,omitempty"` // Hostnames, "*.domain" wildcards, "~regex", IPs, CIDRs or "*"
+	Ports  []string `json:"ports,omitempty"` // Ports or ranges such as "8000-8999"
+	Via    string   `json:"via,omitempty"`   // Upstream allowed connections are tunneled through
+}
+
+// Policy is an ordered list of rules; the first matching rule decides. Connections no
+// rule matches get the default action.
+type Policy struct {
+	Default   string                        `json:"default,omitempty"`   // Allow (the default) or Deny
+	Upstreams map[string]*upstream.Upstream `json:"upstreams,omitempty"` // Upstreams rules may name in Via
+	Rules     []Rule                        `json:"rules"`
+}
+
+// Decision is the outcome of checking a destination against a policy.
+type Decision struct {
+	Allowed bool
+	Rule    string             // Name of the matching rule, or "default"
+	Via     *upstream.Upstream // Upstream to connect through, or nil to connect directly
+}
+
+// Load reads a policy from a JSON file such as
+//
+//	{"default": "allow",
+//	 "rules": [{"action": "deny", "hosts": ["10.0.0.0/8", "localhost"]},
+//	           {"action": "deny", "hosts": ["*.ads.example", "~tracker[0-9]+\\.example\\.com"]},
+//	           {"action": "deny", "users": ["guest"], "ports": ["25"]},
+//	           {"action": "allow", "users": ["alice"], "via": "exit-de"}],
+//	 "upstreams": {"exit-de": {"type": "socks5", "addr": "de.example.com:1080"}}}
+//
+// A missing file yields a policy that allows everything.
+func Load(path string) (*Policy, error) {
+	p := &Policy{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// validate checks the actions, port ranges and upstreams of the policy.
+func (p *Policy) validate() error {
+	if p.Default != "" && p.Default != Allow && p.Default != Deny {
+		return fmt.Errorf("unknown default action %q", p.Default)
+	}
+	if err := upstream.Resolve(p.Upstreams); err != nil {
+		return err
+	}
+	return p.validateRules()
+}
+
+// validateRules checks the actions, port ranges and upstream names of the rules.
+func (p *Policy) validateRules() error {
+	for i, rule := range p.Rules {
+		if rule.Action != Allow && rule.Action != Deny {
+			return fmt.Errorf("rule %d: unknown action %q", i+1, rule.Action)
+		}
+		if rule.Via != "" {
+			if rule.Action != Allow {
+				return fmt.Errorf("rule %d: only allow rules can name an upstream", i+1)
+			}
+			if p.Upstreams[rule.Via] == nil {
+				return fmt.Errorf("rule %d: unknown upstream %q", i+1, rule.Via)
+			}
+		}
+		for _, host := range rule.Hosts {
+			if err := validateHostPattern(host); err != nil {
+				return fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		}
+		for _, ports := range rule.Ports {
+			if _, _, err := parsePortRange(ports); err != nil {
+				return fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check decides whether user may connect to host:port.
+func (p *Policy) Check(user, host string, port int) Decision {
+	if decision, ok := p.Match(user, host, port); ok {
+		return decision
+	}
+	return Decision{Allowed: p.Default != Deny, Rule: "default"}
+}
+
+// Match returns the decision of the first rule matching a connection of user to
+// host:port, and false if no rule matches.
+func (p *Policy) Match(user, host string, port int) (Decision, bool) {
+	for i, rule := range p.Rules {
+		if rule.matches(user, host, port) {
+			name := rule.Name
+			if name == "" {
+				name = "rule " + strconv.Itoa(i+1)
+			}
+			return Decision{Allowed: rule.Action == Allow, Rule: name, Via: p.Upstreams[rule.Via]}, true
+		}
+	}
+	return Decision{}, false
+}
+
+// Overlay returns a policy with rules and the upstreams of p, for checking rules kept
+// outside the policy file before p itself. Rules may name the upstreams of p in Via.
+func (p *Policy) Overlay(rules []Rule) (*Policy, error) {
+	overlay := &Policy{Upstreams: p.Upstreams, Rules: rules}
+	if err := overlay.validateRules(); err != nil {
+		return nil, err
+	}
+	return overlay, nil
+}
+
+// matches reports whether the rule applies to a connection of user to host:port.
+func (r Rule) matches(user, host string, port int) bool {
+	if len(r.Users) > 0 && !contains(r.Users, user) {
+		return false
+	}
+	if len(r.Hosts) > 0 && !matchesAnyHost(r.Hosts, host) {
+		return false
+	}
+	if len(r.Ports) > 0 && !matchesAnyPort(r.Ports, port) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyHost reports whether host equals one of the patterns, case-insensitively, is
+// a subdomain of a "*.domain" pattern, matches a "~regex" pattern or is an IP within one
+// of the CIDR patterns. "*" matches every host. Patterns are matched against the host as
+// requested, before it is resolved.
+func matchesAnyHost(patterns []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	ip := net.ParseIP(host)
+	for _, pattern := range patterns {
+		if pattern == "*" || strings.EqualFold(strings.TrimSuffix(pattern, "."), host) {
+			return true
+		}
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+strings.TrimSuffix(strings.ToLower(domain), ".")) {
+				return true
+			}
+			continue
+		}
+		if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+			if re, err := hostRegexp(expr); err == nil && re.MatchString(host) {
+				return true
+			}
+			continue
+		}
+		if ip == nil {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(pattern); err == nil && network.Contains(ip) {
+			return true
+		}
+		if patternIP := net.ParseIP(pattern); patternIP != nil && patternIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostRegexps caches the compiled "~regex" host patterns.
+var hostRegexps sync.Map // map[string]*regexp.Regexp
+
+// hostRegexp compiles a "~regex" host pattern without its prefix. The expression must
+// match the whole lower-cased host.
+func hostRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := hostRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	re := regexp.MustCompile("^(?:" + expr + ")$")
+	hostRegexps.Store(expr, re)
+	return re, nil
+}
+
+// validateHostPattern checks that wildcards appear only as "*" or a leading "*." and that
+// "~regex" patterns compile.
+func validateHostPattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+		if _, err := hostRegexp(expr); err != nil {
+			return fmt.Errorf("invalid host pattern %q: %v", pattern, err)
+		}
+		return nil
+	}
+	if pattern != "*" && strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+		return fmt.Errorf("invalid host pattern %q: wildcards must be a leading \"*.\"", pattern)
+	}
+	return nil
+}
+
+func matchesAnyPort(ranges []string, port int) bool {
+	for _, r := range ranges {
+		if low, high, err := parsePortRange(r); err == nil && port >= low && port <= high {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePortRange parses "443" or "8000-8999".
+func parsePortRange(s string) (int, int, error) {
+	lowText, highText, isRange := strings.Cut(s, "-")
+	if !isRange {
+		highText = lowText
+	}
+	low, err1 := strconv.Atoi(strings.TrimSpace(lowText))
+	high, err2 := strconv.Atoi(strings.TrimSpace(highText))
+	if err1 != nil || err2 != nil || low < 0 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return low, high, nil
+}
+
+var (
+	sharedOnce   sync.Once
+	sharedPolicy atomic.Pointer[Policy]
+)
+
+// Shared returns the process-wide policy loaded from the config directory. A policy that
+// cannot be loaded denies every connection, so that a broken file never opens up access.
+func Shared() *Policy {
+	sharedOnce.Do(func() {
+		sharedPolicy.Store(&Policy{Default: Deny})
+		path, err := config.GetPolicyPath()
+		if err != nil {
+			log.Printf("Failed to locate forwarding policy, denying all forwarding: %v", err)
+			return
+		}
+		p, err := Load(path)
+		if err != nil {
+			log.Printf("Failed to load forwarding policy, denying all forwarding: %v", err)
+			return
+		}
+		logLoaded(p, path)
+		sharedPolicy.Store(p)
+	})
+	return sharedPolicy.Load()
+}
+
+// Reload replaces the process-wide policy with the contents of the policy file. A policy
+// that cannot be loaded is reported and leaves the current one in place. Plans keep the
+// upstreams of the policy they were loaded with until they are reloaded too.
+func Reload() error {
+	Shared()
+	path, err := config.GetPolicyPath()
+	if err != nil {
+		return err
+	}
+	p, err := Load(path)
+	if err != nil {
+		return err
+	}
+	logLoaded(p, path)
+	sharedPolicy.Store(p)
+	return nil
+}
+
+// logLoaded logs the rules and upstreams of p, loaded from path.
+func logLoaded(p *Policy, path string) {
+	if len(p.Rules) > 0 {
+		log.Printf("Loaded %d forwarding policy rules from %s", len(p.Rules), path)
+	}
+	if len(p.Upstreams) > 0 {
+		log.Printf("Loaded %d upstreams from %s", len(p.Upstreams), path)
+	}
+}
@@ -0,0 +1,219 @@
+// Package privsep implements the control channel between the privileged supervisor and
+// its unprivileged worker processes. The supervisor keeps the SSH host key and the TLS
+// private key and signs with them on request, so that a compromised worker can use the
+// keys while it runs but never read them.
+package privsep
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Operations of control requests
+const (
+	OpHostKey  = "host-key"  // Public SSH host key
+	OpSignHost = "sign-host" // Sign with the SSH host key
+	OpTLSCert  = "tls-cert"  // TLS certificate chain
+	OpSignTLS  = "sign-tls"  // Sign with the TLS private key
+)
+
+// Request is sent by a worker on the control channel.
+type Request struct {
+	Op        string `json:"op"`
+	Algorithm string `json:"algorithm,omitempty"` // SSH signature algorithm of OpSignHost
+	Hash      uint   `json:"hash,omitempty"`      // crypto.Hash of the digest of OpSignTLS
+	PSSSalt   *int   `json:"pss_salt,omitempty"`  // Salt length of RSA-PSS signatures, if PSS is used
+	Data      []byte `json:"data,omitempty"`      // Data or digest to sign
+}
+
+// Response answers a Request.
+type Response struct {
+	Data  [][]byte `json:"data,omitempty"` // Public key, certificate chain or signature
+	Error string   `json:"error,omitempty"`
+}
+
+// Keys are the private keys the supervisor signs with.
+type Keys struct {
+	HostKey ssh.Signer      // SSH host key
+	TLS     tls.Certificate // Default TLS certificate and its private key
+}
+
+// Serve answers the requests of one worker on conn until it is closed.
+func Serve(conn io.ReadWriter, keys Keys) error {
+	dec, enc := json.NewDecoder(conn), json.NewEncoder(conn)
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		data, err := keys.answer(req)
+		resp := Response{Data: data}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// answer performs req.
+func (k Keys) answer(req Request) ([][]byte, error) {
+	switch req.Op {
+	case OpHostKey:
+		return [][]byte{k.HostKey.PublicKey().Marshal()}, nil
+	case OpSignHost:
+		signer, ok := k.HostKey.(ssh.AlgorithmSigner)
+		if !ok {
+			return nil, errors.New("host key does not support signature algorithms")
+		}
+		sig, err := signer.SignWithAlgorithm(rand.Reader, req.Data, req.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{ssh.Marshal(sig)}, nil
+	case OpTLSCert:
+		return k.TLS.Certificate, nil
+	case OpSignTLS:
+		signer, ok := k.TLS.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("TLS private key cannot sign")
+		}
+		var opts crypto.SignerOpts = crypto.Hash(req.Hash)
+		if req.PSSSalt != nil {
+			opts = &rsa.PSSOptions{SaltLength: *req.PSSSalt, Hash: crypto.Hash(req.Hash)}
+		}
+		sig, err := signer.Sign(rand.Reader, req.Data, opts)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{sig}, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", req.Op)
+	}
+}
+
+// Client sends the requests of a worker to its supervisor.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+// NewClient returns a client for the control channel conn.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, dec: json.NewDecoder(conn), enc: json.NewEncoder(conn)}
+}
+
+// call sends req and returns the data of the response.
+func (c *Client) call(req Request) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("supervisor unreachable: %v", err)
+	}
+	var resp Response
+	if err := c.dec.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("supervisor unreachable: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Data, nil
+}
+
+// HostKey returns a signer for the supervisor's SSH host key.
+func (c *Client) HostKey() (ssh.Signer, error) {
+	data, err := c.call(Request{Op: OpHostKey})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1 {
+		return nil, errors.New("supervisor sent no host key")
+	}
+	pub, err := ssh.ParsePublicKey(data[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key from supervisor: %v", err)
+	}
+	return &hostSigner{client: c, pub: pub}, nil
+}
+
+// Certificate returns the supervisor's default TLS certificate, signing with its key.
+func (c *Client) Certificate() (tls.Certificate, error) {
+	chain, err := c.call(Request{Op: OpTLSCert})
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if len(chain) == 0 {
+		return tls.Certificate{}, errors.New("supervisor sent no TLS certificate")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid TLS certificate from supervisor: %v", err)
+	}
+	signer := &tlsSigner{client: c, pub: leaf.PublicKey}
+	return tls.Certificate{Certificate: chain, PrivateKey: signer, Leaf: leaf}, nil
+}
+
+// hostSigner is an ssh.AlgorithmSigner signing with the supervisor's host key.
+type hostSigner struct {
+	client *Client
+	pub    ssh.PublicKey
+}
+
+func (s *hostSigner) PublicKey() ssh.PublicKey { return s.pub }
+
+func (s *hostSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *hostSigner) SignWithAlgorithm(_ io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	resp, err := s.client.call(Request{Op: OpSignHost, Algorithm: algorithm, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	sig := new(ssh.Signature)
+	if len(resp) != 1 || ssh.Unmarshal(resp[0], sig) != nil {
+		return nil, errors.New("invalid signature from supervisor")
+	}
+	return sig, nil
+}
+
+// tlsSigner is a crypto.Signer signing with the supervisor's TLS private key.
+type tlsSigner struct {
+	client *Client
+	pub    crypto.PublicKey
+}
+
+func (s *tlsSigner) Public() crypto.PublicKey { return s.pub }
+
+func (s *tlsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := Request{Op: OpSignTLS, Hash: uint(opts.HashFunc()), Data: digest}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		salt := pss.SaltLength
+		req.PSSSalt = &salt
+	}
+	resp, err := s.client.call(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 1 {
+		return nil, errors.New("invalid signature from supervisor")
+	}
+	return resp[0], nil
+}
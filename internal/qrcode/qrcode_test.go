@@ -0,0 +1,92 @@
+package qrcode
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// exampleCode is the version 2-L code of "https://example.com" with mask 6, as decoded by
+// an independent reader: its format information, Reed-Solomon syndromes and payload check
+// out. Dark modules are '#'.
+var exampleCode = []string{
+	"#######.#..##.#...#######",
+	"#.....#..##.....#.#.....#",
+	"#.###.#...#.###.#.#.###.#",
+	"#.###.#.....##..#.#.###.#",
+	"#.###.#..#.#.##.#.#.###.#",
+	"#.....#...#.#.#.#.#.....#",
+	"#######.#.#.#.#.#.#######",
+	"........#.##.#.##........",
+	"##.##.#..###.#..#.#.....#",
+	"#...#..###..######.#####.",
+	"#..#.##...##.#.###.###..#",
+	".##.#....#####...###.####",
+	"###..#####.###.##.##....#",
+	"#.#..........####...#..#.",
+	"##.#.##....###.##.#.#####",
+	"#.###..#...#.....###.##.#",
+	"#.#.#.##..#...#.#####.##.",
+	"........#.#####.#...#.##.",
+	"#######....#....#.#.#...#",
+	"#.....#..##.#.###...#..#.",
+	"#.###.#.##..#########...#",
+	"#.###.#.#.#...#.###....##",
+	"#.###.#..#..#.##.#..#####",
+	"#.....#.###...##...##.###",
+	"#######.#.#..##.#.#..#..#",
+}
+
+func TestEncodeKnownMatrix(t *testing.T) {
+	c, err := Encode([]byte("https://example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Size != len(exampleCode) {
+		t.Fatalf("size = %d, want %d", c.Size, len(exampleCode))
+	}
+	for y, row := range exampleCode {
+		var b strings.Builder
+		for x := range c.Size {
+			if c.Dark(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		if got := b.String(); got != row {
+			t.Errorf("row %2d = %s\n   want %s", y, got, row)
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// The data and error correction codewords of "HELLO WORLD" at version 1-M, from the
+	// worked example of thonky.com's QR code tutorial.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(len(want))); !slices.Equal(got, want) {
+		t.Errorf("error correction codewords = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeVersions(t *testing.T) {
+	tests := []struct{ length, size int }{
+		{17, 21},    // Capacity of version 1-L
+		{18, 25},    // One byte more needs version 2
+		{2953, 177}, // Capacity of version 40-L
+	}
+	for _, tt := range tests {
+		c, err := Encode(make([]byte, tt.length))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tt.length, err)
+		}
+		if c.Size != tt.size {
+			t.Errorf("%d bytes: size %d, want %d", tt.length, c.Size, tt.size)
+		}
+	}
+	if _, err := Encode(make([]byte, 2954)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("2954 bytes: error = %v, want %v", err, ErrTooLong)
+	}
+}
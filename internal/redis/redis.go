@@ -0,0 +1,476 @@
+// Package redis implements a minimal, dependency-free Redis client speaking RESP2,
+// covering the commands ssh-ify uses to share state between cluster nodes.
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds dialing and each command round trip.
+const DefaultTimeout = 5 * time.Second
+
+// ErrNil is returned by typed helpers when the key or field does not exist.
+var ErrNil = errors.New("redis: nil")
+
+// Error is an error reply sent by the server.
+type Error string
+
+// Error returns the server's error message.
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// MaxIdleConns is how many idle connections a Client keeps for reuse.
+const MaxIdleConns = 8
+
+// Client is a pool of Redis connections that is safe for concurrent use. Each command
+// takes an idle connection or dials a new one, so that a slow round trip only delays
+// its own caller. Connections are dropped after failures and re-established on demand.
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	useTLS   bool
+	timeout  time.Duration
+
+	mutex sync.Mutex
+	idle  []*conn // Connections not in use, most recently used last
+}
+
+// conn is one connection to the server.
+type conn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+// ParseURL returns a client for a URL of the form
+// redis[s]://[[user]:password@]host[:port][/db]. Connections are opened lazily.
+func ParseURL(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %v", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis URL scheme %q (expected redis or rediss)", u.Scheme)
+	}
+	c := &Client{addr: u.Host, useTLS: u.Scheme == "rediss", timeout: DefaultTimeout}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if c.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", path)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the idle connections. Connections in use are closed when their command
+// completes.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.mutex.Unlock()
+	var err error
+	for _, cn := range idle {
+		if closeErr := cn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// dial connects to the server and authenticates.
+func (c *Client) dial() (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var nc net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		nc, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		nc, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, rd: bufio.NewReader(nc)}
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.roundTrip(args, c.timeout); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.roundTrip([]string{"SELECT", strconv.Itoa(c.db)}, c.timeout); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// get returns an idle connection, or dials a new one if there is none.
+func (c *Client) get() (*conn, error) {
+	c.mutex.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mutex.Unlock()
+		return cn, nil
+	}
+	c.mutex.Unlock()
+	return c.dial()
+}
+
+// put returns a healthy connection to the pool, closing it if the pool is full.
+func (c *Client) put(cn *conn) {
+	c.mutex.Lock()
+	if len(c.idle) < MaxIdleConns {
+		c.idle = append(c.idle, cn)
+		cn = nil
+	}
+	c.mutex.Unlock()
+	if cn != nil {
+		cn.Close()
+	}
+}
+
+// Do sends a command and returns its reply: a string, an int64, nil, a []any of
+// replies, or an Error.
+func (c *Client) Do(args ...string) (any, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.roundTrip(args, c.timeout)
+	if err != nil {
+		var redisErr Error
+		if !errors.As(err, &redisErr) {
+			// The connection is in an unknown state; drop it.
+			cn.Close()
+			return nil, err
+		}
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Transaction runs commands atomically in a MULTI/EXEC block and returns their replies.
+// Error replies of single commands are returned as Error values in the replies.
+func (c *Client) Transaction(commands ...[]string) ([]any, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	writeCommand(&b, []string{"MULTI"})
+	for _, args := range commands {
+		writeCommand(&b, args)
+	}
+	writeCommand(&b, []string{"EXEC"})
+	replies, err := cn.exchange(b.String(), len(commands)+2, c.timeout)
+	if err != nil {
+		var redisErr Error
+		if !errors.As(err, &redisErr) {
+			cn.Close()
+			return nil, err
+		}
+	}
+	c.put(cn)
+	if err != nil {
+		return nil, err
+	}
+	results, ok := replies[len(replies)-1].([]any)
+	if !ok {
+		return nil, fmt.Errorf("redis: transaction aborted")
+	}
+	return results, nil
+}
+
+// roundTrip writes one command and reads its reply within timeout.
+func (cn *conn) roundTrip(args []string, timeout time.Duration) (any, error) {
+	var b strings.Builder
+	writeCommand(&b, args)
+	replies, err := cn.exchange(b.String(), 1, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// exchange writes pipelined commands and reads n replies within timeout. All replies are
+// read even after an error reply, which is returned once they are, so that the
+// connection stays usable.
+func (cn *conn) exchange(commands string, n int, timeout time.Duration) ([]any, error) {
+	cn.SetDeadline(time.Now().Add(timeout))
+	if _, err := io.WriteString(cn, commands); err != nil {
+		return nil, err
+	}
+	replies := make([]any, n)
+	var replyErr error
+	for i := range replies {
+		reply, err := readReply(cn.rd)
+		var redisErr Error
+		if errors.As(err, &redisErr) {
+			if replyErr == nil {
+				replyErr = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, replyErr
+}
+
+// writeCommand encodes a command as an array of bulk strings.
+func writeCommand(b *strings.Builder, args []string) {
+	fmt.Fprintf(b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply parses one RESP2 reply.
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				// Error replies inside arrays (e.g. from EXEC) are returned as values.
+				var redisErr Error
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				items[i] = redisErr
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// String runs a command whose reply is a string, returning ErrNil for a nil reply.
+func (c *Client) String(args ...string) (string, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case nil:
+		return "", ErrNil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+}
+
+// Int runs a command whose reply is an integer.
+func (c *Client) Int(args ...string) (int64, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+	return n, nil
+}
+
+// Strings runs a command whose reply is an array of strings. Nil elements become "".
+func (c *Client) Strings(args ...string) ([]string, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i], _ = item.(string)
+	}
+	return values, nil
+}
+
+// Ping checks that the server is reachable.
+func (c *Client) Ping() error {
+	_, err := c.Do("PING")
+	return err
+}
+
+// Get returns the value of key, or ErrNil if it does not exist.
+func (c *Client) Get(key string) (string, error) {
+	return c.String("GET", key)
+}
+
+// Set sets key to value, expiring after ttl if it is positive.
+func (c *Client) Set(key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(args...)
+	return err
+}
+
+// SetNX sets key to value, expiring after ttl if it is positive, only if key does not
+// exist, and reports whether it was set.
+func (c *Client) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	reply, err := c.Do(args...)
+	return reply != nil, err
+}
+
+// Del deletes keys.
+func (c *Client) Del(keys ...string) error {
+	_, err := c.Do(append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// HGet returns a hash field, or ErrNil if it does not exist.
+func (c *Client) HGet(key, field string) (string, error) {
+	return c.String("HGET", key, field)
+}
+
+// HSet sets a hash field.
+func (c *Client) HSet(key, field, value string) error {
+	_, err := c.Do("HSET", key, field, value)
+	return err
+}
+
+// HSetNX sets a hash field only if it does not exist and reports whether it was set.
+func (c *Client) HSetNX(key, field, value string) (bool, error) {
+	n, err := c.Int("HSETNX", key, field, value)
+	return n == 1, err
+}
+
+// HDel deletes hash fields.
+func (c *Client) HDel(key string, fields ...string) error {
+	_, err := c.Do(append([]string{"HDEL", key}, fields...)...)
+	return err
+}
+
+// HGetAll returns all fields of a hash.
+func (c *Client) HGetAll(key string) (map[string]string, error) {
+	values, err := c.Strings("HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		fields[values[i]] = values[i+1]
+	}
+	return fields, nil
+}
+
+// RPush appends values to a list.
+func (c *Client) RPush(key string, values ...string) error {
+	_, err := c.Do(append([]string{"RPUSH", key}, values...)...)
+	return err
+}
+
+// LRange returns the list elements between start and stop (inclusive, negative from the end).
+func (c *Client) LRange(key string, start, stop int) ([]string, error) {
+	return c.Strings("LRANGE", key, strconv.Itoa(start), strconv.Itoa(stop))
+}
+
+// SAdd adds members to a set.
+func (c *Client) SAdd(key string, members ...string) error {
+	_, err := c.Do(append([]string{"SADD", key}, members...)...)
+	return err
+}
+
+// SRem removes members from a set.
+func (c *Client) SRem(key string, members ...string) error {
+	_, err := c.Do(append([]string{"SREM", key}, members...)...)
+	return err
+}
+
+// SMembers returns all members of a set.
+func (c *Client) SMembers(key string) ([]string, error) {
+	return c.Strings("SMEMBERS", key)
+}
+
+// Exists reports whether key exists.
+func (c *Client) Exists(key string) (bool, error) {
+	n, err := c.Int("EXISTS", key)
+	return n == 1, err
+}
+
+// Incr increments the integer value of key and returns the new value.
+func (c *Client) Incr(key string) (int64, error) {
+	return c.Int("INCR", key)
+}
+
+// HIncrBy increments a hash field by n and returns the new value.
+func (c *Client) HIncrBy(key, field string, n int64) (int64, error) {
+	return c.Int("HINCRBY", key, field, strconv.FormatInt(n, 10))
+}
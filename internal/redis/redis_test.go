@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis/redistest"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+		err   error // Error the reply is expected to match with errors.Is, if any
+	}{
+		{"simple string", "+OK\r\n", "OK", nil},
+		{"integer", ":-42\r\n", int64(-42), nil},
+		{"bulk string", "$5\r\nhello\r\n", "hello", nil},
+		{"bulk string with CRLF", "$7\r\nab\r\ncd\r\n\r\n", "ab\r\ncd\r", nil},
+		{"empty bulk string", "$0\r\n\r\n", "", nil},
+		{"nil bulk string", "$-1\r\n", nil, nil},
+		{"nil array", "*-1\r\n", nil, nil},
+		{"empty array", "*0\r\n", []any{}, nil},
+		{"array", "*3\r\n$1\r\na\r\n:2\r\n$-1\r\n", []any{"a", int64(2), nil}, nil},
+		{"nested array", "*2\r\n*1\r\n+x\r\n$1\r\ny\r\n", []any{[]any{"x"}, "y"}, nil},
+		{"error in array", "*2\r\n+OK\r\n-ERR bad\r\n", []any{"OK", Error("ERR bad")}, nil},
+		{"error", "-ERR unknown command\r\n", nil, Error("ERR unknown command")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyMalformed(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"\r\n",
+		"?what\r\n",
+		":abc\r\n",
+		"$x\r\n",
+		"$5\r\nhel",
+		"*x\r\n",
+		"*2\r\n+OK\r\n",
+	} {
+		if reply, err := readReply(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("readReply(%q) = %#v, want an error", input, reply)
+		}
+	}
+}
+
+// newClient returns a client of a new redistest server.
+func newClient(t *testing.T) (*Client, *redistest.Server) {
+	t.Helper()
+	server := redistest.NewServer(t)
+	client, err := ParseURL(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestClientCommands(t *testing.T) {
+	client, _ := newClient(t)
+	if err := client.HSet("h", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.HGet("h", "a"); err != nil || v != "1" {
+		t.Fatalf("HGet = %q, %v, want \"1\"", v, err)
+	}
+	if _, err := client.HGet("h", "missing"); !errors.Is(err, ErrNil) {
+		t.Fatalf("HGet of a missing field: error = %v, want %v", err, ErrNil)
+	}
+	if fields, err := client.HGetAll("h"); err != nil || !reflect.DeepEqual(fields, map[string]string{"a": "1"}) {
+		t.Fatalf("HGetAll = %v, %v", fields, err)
+	}
+	// Error replies leave the connection usable.
+	if _, err := client.Do("NOSUCHCOMMAND"); !errors.As(err, new(Error)) {
+		t.Fatalf("unknown command: error = %v, want an error reply", err)
+	}
+	if err := client.Ping(); err != nil {
+		t.Fatalf("Ping after an error reply: %v", err)
+	}
+}
+
+func TestClientSlowCommandDoesNotBlockOthers(t *testing.T) {
+	client, server := newClient(t)
+	client.HSet("users", "alice", "{}")
+	held, release := server.Hold("HGET")
+	defer release()
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := client.HGet("users", "alice")
+		slow <- err
+	}()
+	<-held
+	done := make(chan error, 1)
+	go func() { done <- client.Ping() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Ping while another command is slow: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Ping waited for a slow command on another connection")
+	}
+	release()
+	if err := <-slow; err != nil {
+		t.Fatalf("slow HGet: %v", err)
+	}
+}
+
+func TestClientTransaction(t *testing.T) {
+	client, server := newClient(t)
+	replies, err := client.Transaction([]string{"SET", "k", "0", "NX"}, []string{"INCR", "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replies, []any{"OK", int64(1)}) {
+		t.Fatalf("replies = %#v", replies)
+	}
+	// A failing command is reported in its reply without aborting the others.
+	server.Fail("SET", 1)
+	replies, err = client.Transaction([]string{"SET", "k", "0"}, []string{"INCR", "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := replies[0].(Error); !ok || replies[1] != int64(2) {
+		t.Fatalf("replies = %#v, want an error reply and 2", replies)
+	}
+}
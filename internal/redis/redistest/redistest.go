@@ -0,0 +1,415 @@
+// Package redistest provides an in-memory Redis server for tests, implementing the
+// subset of commands ssh-ify uses.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is an in-memory Redis server listening on a loopback port.
+type Server struct {
+	ln net.Listener
+
+	mutex   sync.Mutex
+	values  map[string]string            // String keys
+	hashes  map[string]map[string]string // Hash keys
+	sets    map[string]map[string]bool   // Set keys
+	expires map[string]time.Time         // Expiry of keys that have one
+	fail    map[string]int               // Upcoming calls of a command to fail, by name
+	hold    map[string]*hold             // Commands blocked until released
+}
+
+// NewServer starts a server that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		ln:      ln,
+		values:  make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		sets:    make(map[string]map[string]bool),
+		expires: make(map[string]time.Time),
+		fail:    make(map[string]int),
+		hold:    make(map[string]*hold),
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// URL returns the redis:// URL of the server.
+func (s *Server) URL() string {
+	return "redis://" + s.ln.Addr().String()
+}
+
+// Fail makes the next n calls of command return an error reply.
+func (s *Server) Fail(command string, n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fail[strings.ToUpper(command)] += n
+}
+
+// Hold blocks calls of command until release is called. The held channel is closed
+// once a call is blocked.
+func (s *Server) Hold(command string) (held <-chan struct{}, release func()) {
+	h := &hold{held: make(chan struct{}), release: make(chan struct{})}
+	s.mutex.Lock()
+	s.hold[strings.ToUpper(command)] = h
+	s.mutex.Unlock()
+	return h.held, func() {
+		h.releaseOnce.Do(func() {
+			s.mutex.Lock()
+			delete(s.hold, strings.ToUpper(command))
+			s.mutex.Unlock()
+			close(h.release)
+		})
+	}
+}
+
+// hold blocks the calls of a command.
+type hold struct {
+	held        chan struct{} // Closed once a call is blocked
+	heldOnce    sync.Once
+	release     chan struct{} // Closed to let the calls continue
+	releaseOnce sync.Once
+}
+
+// TTL returns the time left before key expires, and false if key does not exist or
+// never expires.
+func (s *Server) TTL(key string) (time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expireLocked(key)
+	at, ok := s.expires[key]
+	if !ok {
+		return 0, false
+	}
+	return time.Until(at), true
+}
+
+// Get returns the value of a string key, or "" if it does not exist.
+func (s *Server) Get(key string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expireLocked(key)
+	return s.values[key]
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the commands sent on conn until it is closed.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	var queued [][]string // Commands of an open MULTI block
+	inMulti := false
+	for {
+		args, err := readCommand(rd)
+		if err != nil || len(args) == 0 {
+			return
+		}
+		var reply string
+		switch name := strings.ToUpper(args[0]); {
+		case name == "MULTI":
+			queued, inMulti = nil, true
+			reply = ok
+		case name == "EXEC" && inMulti:
+			replies := make([]string, len(queued))
+			for i, command := range queued {
+				replies[i] = s.exec(command)
+			}
+			queued, inMulti = nil, false
+			reply = fmt.Sprintf("*%d\r\n%s", len(replies), strings.Join(replies, ""))
+		case inMulti:
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		default:
+			reply = s.exec(args)
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads one command sent as an array of bulk strings.
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// Replies
+const (
+	ok       = "+OK\r\n"
+	nilReply = "$-1\r\n"
+)
+
+func bulk(s string) string       { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+func integer(n int64) string     { return fmt.Sprintf(":%d\r\n", n) }
+func errorReply(s string) string { return "-" + s + "\r\n" }
+
+func array(items []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(items))
+	for _, item := range items {
+		b.WriteString(bulk(item))
+	}
+	return b.String()
+}
+
+// exec runs one command and returns its reply.
+func (s *Server) exec(args []string) string {
+	if len(args) == 0 {
+		return errorReply("ERR empty command")
+	}
+	name := strings.ToUpper(args[0])
+	s.mutex.Lock()
+	h := s.hold[name]
+	s.mutex.Unlock()
+	if h != nil {
+		h.heldOnce.Do(func() { close(h.held) })
+		<-h.release
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.fail[name] > 0 {
+		s.fail[name]--
+		return errorReply("ERR injected failure")
+	}
+	if len(args) > 1 {
+		s.expireLocked(args[1])
+	}
+	switch {
+	case name == "PING":
+		return "+PONG\r\n"
+	case name == "GET" && len(args) == 2:
+		if v, ok := s.values[args[1]]; ok {
+			return bulk(v)
+		}
+		return nilReply
+	case name == "SET" && len(args) >= 3:
+		return s.setLocked(args[1:])
+	case name == "DEL":
+		var n int64
+		for _, key := range args[1:] {
+			if s.existsLocked(key) {
+				n++
+			}
+			delete(s.values, key)
+			delete(s.hashes, key)
+			delete(s.sets, key)
+			delete(s.expires, key)
+		}
+		return integer(n)
+	case name == "EXISTS" && len(args) == 2:
+		if s.existsLocked(args[1]) {
+			return integer(1)
+		}
+		return integer(0)
+	case name == "INCR" && len(args) == 2:
+		n, err := strconv.ParseInt(s.valueOr(args[1], "0"), 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range")
+		}
+		s.values[args[1]] = strconv.FormatInt(n+1, 10)
+		return integer(n + 1)
+	case name == "PEXPIRE" && len(args) == 3:
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range")
+		}
+		if !s.existsLocked(args[1]) {
+			return integer(0)
+		}
+		s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return integer(1)
+	case name == "HGET" && len(args) == 3:
+		if v, ok := s.hashes[args[1]][args[2]]; ok {
+			return bulk(v)
+		}
+		return nilReply
+	case name == "HSET" && len(args) == 4:
+		_, exists := s.hashes[args[1]][args[2]]
+		s.hashLocked(args[1])[args[2]] = args[3]
+		if exists {
+			return integer(0)
+		}
+		return integer(1)
+	case name == "HSETNX" && len(args) == 4:
+		if _, exists := s.hashes[args[1]][args[2]]; exists {
+			return integer(0)
+		}
+		s.hashLocked(args[1])[args[2]] = args[3]
+		return integer(1)
+	case name == "HDEL" && len(args) >= 3:
+		var n int64
+		for _, field := range args[2:] {
+			if _, exists := s.hashes[args[1]][field]; exists {
+				delete(s.hashes[args[1]], field)
+				n++
+			}
+		}
+		return integer(n)
+	case name == "HGETALL" && len(args) == 2:
+		fields := s.hashes[args[1]]
+		keys := make([]string, 0, len(fields))
+		for field := range fields {
+			keys = append(keys, field)
+		}
+		sort.Strings(keys)
+		var items []string
+		for _, field := range keys {
+			items = append(items, field, fields[field])
+		}
+		return array(items)
+	case name == "HINCRBY" && len(args) == 4:
+		by, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range")
+		}
+		hash, n := s.hashLocked(args[1]), int64(0)
+		if v, exists := hash[args[2]]; exists {
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return errorReply("ERR hash value is not an integer")
+			}
+		}
+		hash[args[2]] = strconv.FormatInt(n+by, 10)
+		return integer(n + by)
+	case name == "SADD" && len(args) >= 3:
+		set := s.sets[args[1]]
+		if set == nil {
+			set = make(map[string]bool)
+			s.sets[args[1]] = set
+		}
+		var n int64
+		for _, member := range args[2:] {
+			if !set[member] {
+				set[member] = true
+				n++
+			}
+		}
+		return integer(n)
+	case name == "SMEMBERS" && len(args) == 2:
+		var members []string
+		for member := range s.sets[args[1]] {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		return array(members)
+	}
+	return errorReply(fmt.Sprintf("ERR unknown command or wrong number of arguments for '%s'", args[0]))
+}
+
+// setLocked runs SET with its arguments: key, value and the NX and PX options.
+func (s *Server) setLocked(args []string) string {
+	key, value := args[0], args[1]
+	nx, ttl := false, time.Duration(0)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "PX":
+			if i+1 == len(args) {
+				return errorReply("ERR syntax error")
+			}
+			i++
+			ms, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || ms <= 0 {
+				return errorReply("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(ms) * time.Millisecond
+		default:
+			return errorReply("ERR syntax error")
+		}
+	}
+	if nx && s.existsLocked(key) {
+		return nilReply
+	}
+	s.values[key] = value
+	delete(s.expires, key)
+	if ttl > 0 {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+	return ok
+}
+
+// existsLocked reports whether key holds a value of any type.
+func (s *Server) existsLocked(key string) bool {
+	_, isValue := s.values[key]
+	return isValue || len(s.hashes[key]) > 0 || len(s.sets[key]) > 0
+}
+
+// expireLocked deletes key if it has expired.
+func (s *Server) expireLocked(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		delete(s.values, key)
+		delete(s.hashes, key)
+		delete(s.sets, key)
+		delete(s.expires, key)
+	}
+}
+
+// valueOr returns the value of a string key, or def if it does not exist.
+func (s *Server) valueOr(key, def string) string {
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	return def
+}
+
+// hashLocked returns the hash at key, creating it if needed.
+func (s *Server) hashLocked(key string) map[string]string {
+	hash := s.hashes[key]
+	if hash == nil {
+		hash = make(map[string]string)
+		s.hashes[key] = hash
+	}
+	return hash
+}
@@ -0,0 +1,113 @@
+// Package relay copies byte streams between connections, reporting progress as it goes
+// and stopping as soon as its context is cancelled.
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ReportInterval is the longest Copy holds on to a byte count before reporting it.
+const ReportInterval = time.Second
+
+// errInvalidWrite is returned when a writer reports more bytes written than it was given.
+var errInvalidWrite = errors.New("invalid write result")
+
+// Reporter receives the number of bytes a Copy read since its previous report.
+type Reporter func(n int64)
+
+// Copy copies src to dst using buf until src is exhausted, either side fails or ctx is
+// cancelled, and returns the number of bytes written to dst. Reaching EOF on src is not
+// an error. The bytes read from src are passed to report, if not nil, within
+// ReportInterval of being read and before Copy returns. Reports are made from a timer
+// goroutine while copying, so report must be safe for concurrent use.
+//
+// Cancelling ctx closes src and dst where they are io.Closers, cutting short a Read or
+// Write that would otherwise block until the peer sends something or the socket fails.
+// Copy then returns ctx.Err().
+func Copy(ctx context.Context, dst io.Writer, src io.Reader, buf []byte, report Reporter) (written int64, err error) {
+	stop := context.AfterFunc(ctx, func() {
+		closeIfCloser(src)
+		closeIfCloser(dst)
+	})
+	defer stop()
+
+	var m meter
+	if report != nil {
+		m.report = report
+		m.timer = time.AfterFunc(ReportInterval, m.flush)
+		m.timer.Stop()
+		defer func() {
+			m.timer.Stop()
+			m.flush()
+		}()
+	}
+	defer func() {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			m.add(int64(nr))
+			nw, werr := dst.Write(buf[:nr])
+			if nw < 0 || nw > nr {
+				nw = 0
+				if werr == nil {
+					werr = errInvalidWrite
+				}
+			}
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// meter batches the byte counts of a Copy, handing them to report when its timer fires.
+type meter struct {
+	report  Reporter
+	timer   *time.Timer
+	pending atomic.Int64 // Bytes read but not reported yet
+	armed   atomic.Bool  // Whether timer is due to fire
+}
+
+// add counts n bytes read, arming the timer if it is not running.
+func (m *meter) add(n int64) {
+	if m.report == nil {
+		return
+	}
+	m.pending.Add(n)
+	if m.armed.CompareAndSwap(false, true) {
+		m.timer.Reset(ReportInterval)
+	}
+}
+
+// flush reports the pending bytes, if any.
+func (m *meter) flush() {
+	m.armed.Store(false)
+	if n := m.pending.Swap(0); n > 0 {
+		m.report(n)
+	}
+}
+
+// closeIfCloser closes v if it is an io.Closer.
+func closeIfCloser(v any) {
+	if c, ok := v.(io.Closer); ok {
+		c.Close()
+	}
+}
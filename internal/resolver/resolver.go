@@ -0,0 +1,187 @@
+// Package resolver builds name resolvers that send their queries over an encrypted
+// transport, DNS over HTTPS (RFC 8484) or DNS over TLS (RFC 7858), so that the network
+// the server runs in can neither observe nor forge them.
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+const (
+	// QueryTimeout bounds a query without a deadline of its own.
+	QueryTimeout = 10 * time.Second
+
+	// DoTPort is the port of DNS over TLS servers given without one.
+	DoTPort = "853"
+
+	// dnsMessageType is the media type of DNS messages in DNS over HTTPS.
+	dnsMessageType = "application/dns-message"
+
+	// maxMessageSize is the largest DNS message, limited by its length prefix over streams.
+	maxMessageSize = 65535
+)
+
+var queries = metrics.NewCounterVec("ssh_ify_encrypted_dns_queries_total",
+	"DNS queries sent over DNS over HTTPS or DNS over TLS, by transport and result.", "transport", "result")
+
+// New returns a resolver querying server, either a DNS over HTTPS URL such as
+// "https://dns.example/dns-query" or a DNS over TLS server such as "tls://1.1.1.1" or
+// "tls://dns.example:853". The server's own name, if any, is resolved by the system.
+func New(server string) (*net.Resolver, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resolver %q: %v", server, err)
+	}
+	var dial func(ctx context.Context) (net.Conn, error)
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid resolver %q: missing host", server)
+		}
+		client := &http.Client{Timeout: QueryTimeout}
+		dial = func(ctx context.Context) (net.Conn, error) {
+			return &httpsConn{ctx: ctx, client: client, url: server}, nil
+		}
+	case "tls":
+		if u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid resolver %q: expected tls://host[:port]", server)
+		}
+		port := u.Port()
+		if port == "" {
+			port = DoTPort
+		}
+		addr := net.JoinHostPort(u.Hostname(), port)
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{Timeout: QueryTimeout},
+			Config:    &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12},
+		}
+		dial = func(ctx context.Context) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				queries.Inc("tls", "error")
+				return nil, err
+			}
+			queries.Inc("tls", "ok")
+			return conn, nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid resolver %q: scheme must be https or tls", server)
+	}
+
+	// The Go resolver frames queries for streams on connections that are not
+	// net.PacketConns, whichever server and network it asks for.
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dial(ctx)
+		},
+	}, nil
+}
+
+// Failing returns a resolver whose lookups all fail with err, for when the configured
+// resolver is invalid and names must not leak to the system resolver instead.
+func Failing(err error) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		},
+	}
+}
+
+// httpsConn carries length-prefixed DNS messages written to it to a DNS over HTTPS
+// server, and returns the answers length-prefixed when read.
+type httpsConn struct {
+	ctx      context.Context
+	client   *http.Client
+	url      string
+	deadline time.Time
+
+	query  bytes.Buffer // Written bytes not yet sent
+	answer bytes.Buffer // Answers not yet read
+}
+
+// Write sends each complete query written to the server.
+func (c *httpsConn) Write(p []byte) (int, error) {
+	c.query.Write(p)
+	for c.query.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.query.Bytes()))
+		if c.query.Len() < 2+size {
+			break
+		}
+		c.query.Next(2)
+		answer, err := c.exchange(c.query.Next(size))
+		if err != nil {
+			queries.Inc("https", "error")
+			return 0, err
+		}
+		queries.Inc("https", "ok")
+		binary.Write(&c.answer, binary.BigEndian, uint16(len(answer)))
+		c.answer.Write(answer)
+	}
+	return len(p), nil
+}
+
+// exchange posts query to the server and returns its answer.
+func (c *httpsConn) exchange(query []byte) ([]byte, error) {
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS server returned %s", resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(answer) > maxMessageSize {
+		return nil, fmt.Errorf("DNS over HTTPS answer exceeds %d bytes", maxMessageSize)
+	}
+	return answer, nil
+}
+
+// Read returns the answers to the queries sent so far.
+func (c *httpsConn) Read(p []byte) (int, error) {
+	if c.answer.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.answer.Read(p)
+}
+
+func (c *httpsConn) Close() error                       { return nil }
+func (c *httpsConn) LocalAddr() net.Addr                { return httpsAddr("") }
+func (c *httpsConn) RemoteAddr() net.Addr               { return httpsAddr(c.url) }
+func (c *httpsConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *httpsConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *httpsConn) SetWriteDeadline(t time.Time) error { c.deadline = t; return nil }
+
+// httpsAddr is the address of a DNS over HTTPS server, its URL.
+type httpsAddr string
+
+func (a httpsAddr) Network() string { return "https" }
+func (a httpsAddr) String() string  { return string(a) }
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package sandbox
+
+import "errors"
+
+// errUnsupported is returned for sandboxes enabled on platforms other than Linux.
+var errUnsupported = errors.New("only supported on Linux")
+
+func restrictFiles(readWrite, readOnly []string) error {
+	return errUnsupported
+}
+
+func filterSyscalls() error {
+	return errUnsupported
+}
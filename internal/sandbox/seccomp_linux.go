@@ -0,0 +1,70 @@
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// seccomp operations, flags, return values and struct seccomp_data offsets.
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1 << 0
+
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+
+	seccompDataNr   = 0
+	seccompDataArch = 4
+
+	// x32SyscallBit marks the system calls of the x32 ABI on amd64.
+	x32SyscallBit = 0x40000000
+)
+
+// filterSyscalls installs a seccomp-bpf filter on every thread of the process that
+// fails deniedSyscalls, and system calls of other architectures, with EPERM.
+func filterSyscalls() error {
+	if auditArch == 0 {
+		return fmt.Errorf("not supported on %s", runtime.GOARCH)
+	}
+	filter := seccompFilter()
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	// no_new_privs is set on this thread, and by the kernel on the threads it synchronizes.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("setting no_new_privs: %v", errno)
+	}
+	tid, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return fmt.Errorf("installing filter: %v", errno)
+	}
+	if tid != 0 {
+		return fmt.Errorf("installing filter: thread %d cannot be synchronized", tid)
+	}
+	return nil
+}
+
+// seccompFilter returns the BPF program of filterSyscalls.
+func seccompFilter() []syscall.SockFilter {
+	deny := func(code uint16, k uint32, at int) syscall.SockFilter {
+		// Jump to the final instruction, which denies the call.
+		return syscall.SockFilter{Code: code, Jt: uint8(len(deniedSyscalls) + 5 - at), K: k}
+	}
+	filter := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataArch},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: auditArch, Jt: 1},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataNr},
+	}
+	filter = append(filter, deny(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, x32SyscallBit, len(filter)))
+	for _, nr := range deniedSyscalls {
+		filter = append(filter, deny(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, len(filter)))
+	}
+	return append(filter,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+}
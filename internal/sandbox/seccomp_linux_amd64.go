@@ -0,0 +1,52 @@
+package sandbox
+
+// auditArch is AUDIT_ARCH_X86_64, the architecture seccomp_data reports for native calls.
+const auditArch = 0xc000003e
+
+// sysSeccomp is the number of the seccomp system call.
+const sysSeccomp = 317
+
+// deniedSyscalls are failed by the seccomp sandbox.
+var deniedSyscalls = []uint32{
+	59,  // execve
+	322, // execveat
+	101, // ptrace
+	310, // process_vm_readv
+	311, // process_vm_writev
+	165, // mount
+	166, // umount2
+	155, // pivot_root
+	161, // chroot
+	167, // swapon
+	168, // swapoff
+	169, // reboot
+	246, // kexec_load
+	320, // kexec_file_load
+	175, // init_module
+	313, // finit_module
+	176, // delete_module
+	321, // bpf
+	298, // perf_event_open
+	250, // keyctl
+	248, // add_key
+	249, // request_key
+	272, // unshare
+	308, // setns
+	323, // userfaultfd
+	163, // acct
+	164, // settimeofday
+	227, // clock_settime
+	172, // iopl
+	173, // ioperm
+	304, // open_by_handle_at
+	179, // quotactl
+	103, // syslog
+	170, // sethostname
+	171, // setdomainname
+	425, // io_uring_setup
+	428, // open_tree
+	429, // move_mount
+	430, // fsopen
+	432, // fsmount
+	442, // mount_setattr
+}
@@ -0,0 +1,50 @@
+package sandbox
+
+// auditArch is AUDIT_ARCH_AARCH64, the architecture seccomp_data reports for native calls.
+const auditArch = 0xc00000b7
+
+// sysSeccomp is the number of the seccomp system call.
+const sysSeccomp = 277
+
+// deniedSyscalls are failed by the seccomp sandbox.
+var deniedSyscalls = []uint32{
+	221, // execve
+	281, // execveat
+	117, // ptrace
+	270, // process_vm_readv
+	271, // process_vm_writev
+	40,  // mount
+	39,  // umount2
+	41,  // pivot_root
+	51,  // chroot
+	224, // swapon
+	225, // swapoff
+	142, // reboot
+	104, // kexec_load
+	294, // kexec_file_load
+	105, // init_module
+	273, // finit_module
+	106, // delete_module
+	280, // bpf
+	241, // perf_event_open
+	219, // keyctl
+	217, // add_key
+	218, // request_key
+	97,  // unshare
+	268, // setns
+	282, // userfaultfd
+	89,  // acct
+	170, // settimeofday
+	112, // clock_settime
+	265, // open_by_handle_at
+	60,  // quotactl
+	116, // syslog
+	161, // sethostname
+	162, // setdomainname
+	425, // io_uring_setup
+	428, // open_tree
+	429, // move_mount
+	430, // fsopen
+	432, // fsmount
+	442, // mount_setattr
+}
@@ -0,0 +1,10 @@
+//go:build linux && !amd64 && !arm64
+
+package sandbox
+
+// auditArch is zero where the seccomp sandbox has no system call table.
+const auditArch = 0
+
+const sysSeccomp = 0
+
+var deniedSyscalls []uint32
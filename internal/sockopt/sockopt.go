@@ -0,0 +1,59 @@
+// Package sockopt sets the socket options multi-WAN servers and policy routing setups
+// rely on: binding a socket to a network interface or VRF device and marking its
+// packets with a firewall mark for ip rules. Both are Linux only.
+package sockopt
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Options are applied to a socket before it is bound or connected.
+type Options struct {
+	Interface string // Interface or VRF device the socket is bound to (SO_BINDTODEVICE); any if empty
+	Mark      int    // Firewall mark of the socket's packets (SO_MARK); none if zero
+}
+
+// IsZero reports whether o sets no option.
+func (o Options) IsZero() bool {
+	return o.Interface == "" && o.Mark == 0
+}
+
+// Check returns an error if o cannot be applied on this platform.
+func (o Options) Check() error {
+	if o.IsZero() {
+		return nil
+	}
+	if o.Mark < 0 || int64(o.Mark) > 1<<32-1 {
+		return fmt.Errorf("invalid fwmark %d", o.Mark)
+	}
+	return checkSupported()
+}
+
+// Control returns a function applying o for the Control field of net.Dialer and
+// net.ListenConfig, or nil if o sets no option.
+func (o Options) Control() func(network, address string, c syscall.RawConn) error {
+	if o.IsZero() {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) { err = o.apply(fd) }); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
+
+// String describes o for logs, e.g. "interface wan1, fwmark 2".
+func (o Options) String() string {
+	switch {
+	case o.Interface != "" && o.Mark != 0:
+		return fmt.Sprintf("interface %s, fwmark %d", o.Interface, o.Mark)
+	case o.Interface != "":
+		return "interface " + o.Interface
+	case o.Mark != 0:
+		return fmt.Sprintf("fwmark %d", o.Mark)
+	}
+	return "default"
+}
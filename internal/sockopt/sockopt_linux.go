@@ -0,0 +1,25 @@
+package sockopt
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func checkSupported() error {
+	return nil
+}
+
+// apply sets the options of o on the socket fd.
+func (o Options) apply(fd uintptr) error {
+	if o.Interface != "" {
+		if err := syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, o.Interface); err != nil {
+			return fmt.Errorf("failed to bind to interface %s: %v", o.Interface, err)
+		}
+	}
+	if o.Mark != 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, o.Mark); err != nil {
+			return fmt.Errorf("failed to set fwmark %d: %v", o.Mark, err)
+		}
+	}
+	return nil
+}
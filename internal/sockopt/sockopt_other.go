@@ -0,0 +1,16 @@
+//go:build !linux
+
+package sockopt
+
+import "errors"
+
+// errUnsupported is returned for socket options set on platforms other than Linux.
+var errUnsupported = errors.New("binding to an interface and fwmarks are only supported on Linux")
+
+func checkSupported() error {
+	return errUnsupported
+}
+
+func (o Options) apply(fd uintptr) error {
+	return errUnsupported
+}
@@ -0,0 +1,157 @@
+package ssh
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Crypto profiles
+const (
+	// CryptoSecure offers only algorithms without known weaknesses, preferring
+	// chacha20-poly1305 and hybrid post-quantum key exchange.
+	CryptoSecure = "secure"
+
+	// CryptoCompat adds SHA-1 based key exchanges and MACs and CBC ciphers for old clients.
+	CryptoCompat = "compat"
+)
+
+// Algorithm settings, read from the environment at startup.
+var (
+	// CryptoProfile selects the algorithms offered to clients, CryptoSecure or
+	// CryptoCompat. It is read from SSH_IFY_CRYPTO_PROFILE.
+	CryptoProfile = config.Env("SSH_IFY_CRYPTO_PROFILE", CryptoSecure)
+
+	// KeyExchangeList, CipherList and MACList replace the profile's key exchanges,
+	// ciphers and MACs with comma-separated lists in order of preference. They are read
+	// from SSH_IFY_KEX_ALGORITHMS, SSH_IFY_CIPHERS and SSH_IFY_MACS.
+	KeyExchangeList = config.Env("SSH_IFY_KEX_ALGORITHMS", "")
+	CipherList      = config.Env("SSH_IFY_CIPHERS", "")
+	MACList         = config.Env("SSH_IFY_MACS", "")
+)
+
+// secureAlgorithms are the algorithms of CryptoSecure, in order of preference.
+var secureAlgorithms = ssh.Algorithms{
+	KeyExchanges: []string{
+		ssh.KeyExchangeMLKEM768X25519,
+		ssh.KeyExchangeCurve25519,
+		ssh.KeyExchangeECDHP256,
+		ssh.KeyExchangeECDHP384,
+		ssh.KeyExchangeECDHP521,
+		ssh.KeyExchangeDH16SHA512,
+		ssh.KeyExchangeDH14SHA256,
+	},
+	Ciphers: []string{
+		ssh.CipherChaCha20Poly1305,
+		ssh.CipherAES256GCM,
+		ssh.CipherAES128GCM,
+		ssh.CipherAES256CTR,
+		ssh.CipherAES192CTR,
+		ssh.CipherAES128CTR,
+	},
+	MACs: []string{
+		ssh.HMACSHA256ETM,
+		ssh.HMACSHA512ETM,
+		ssh.HMACSHA256,
+		ssh.HMACSHA512,
+	},
+}
+
+// compatAlgorithms are the algorithms of CryptoCompat, in order of preference.
+var compatAlgorithms = ssh.Algorithms{
+	KeyExchanges: append(slices.Clone(secureAlgorithms.KeyExchanges),
+		ssh.KeyExchangeDHGEXSHA256, ssh.InsecureKeyExchangeDH14SHA1, ssh.InsecureKeyExchangeDH1SHA1),
+	Ciphers: append(slices.Clone(secureAlgorithms.Ciphers),
+		ssh.InsecureCipherAES128CBC, ssh.InsecureCipherTripleDESCBC),
+	MACs: append(slices.Clone(secureAlgorithms.MACs),
+		ssh.HMACSHA1, ssh.InsecureHMACSHA196),
+}
+
+// Algorithms returns the key exchanges, ciphers and MACs offered to clients: those of
+// CryptoProfile, with each list set explicitly replacing the profile's. In hardened mode
+// they are narrowed to hardenedAlgorithms.
+func Algorithms() (ssh.Algorithms, error) {
+	var algorithms ssh.Algorithms
+	switch CryptoProfile {
+	case CryptoSecure:
+		algorithms = secureAlgorithms
+	case CryptoCompat:
+		algorithms = compatAlgorithms
+	default:
+		return ssh.Algorithms{}, fmt.Errorf("unknown crypto profile %q", CryptoProfile)
+	}
+
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	var err error
+	if algorithms.KeyExchanges, err = parseAlgorithms("key exchange", KeyExchangeList, algorithms.KeyExchanges,
+		append(supported.KeyExchanges, insecure.KeyExchanges...)); err != nil {
+		return ssh.Algorithms{}, err
+	}
+	if algorithms.Ciphers, err = parseAlgorithms("cipher", CipherList, algorithms.Ciphers,
+		append(supported.Ciphers, insecure.Ciphers...)); err != nil {
+		return ssh.Algorithms{}, err
+	}
+	if algorithms.MACs, err = parseAlgorithms("MAC", MACList, algorithms.MACs,
+		append(supported.MACs, insecure.MACs...)); err != nil {
+		return ssh.Algorithms{}, err
+	}
+
+	if config.Hardened {
+		if CryptoProfile != CryptoSecure {
+			return ssh.Algorithms{}, fmt.Errorf("crypto profile %q is not allowed in hardened mode", CryptoProfile)
+		}
+		if algorithms.KeyExchanges, err = hardenAlgorithms("key exchange", KeyExchangeList, algorithms.KeyExchanges,
+			hardenedAlgorithms.KeyExchanges); err != nil {
+			return ssh.Algorithms{}, err
+		}
+		if algorithms.Ciphers, err = hardenAlgorithms("cipher", CipherList, algorithms.Ciphers,
+			hardenedAlgorithms.Ciphers); err != nil {
+			return ssh.Algorithms{}, err
+		}
+		if algorithms.MACs, err = hardenAlgorithms("MAC", MACList, algorithms.MACs,
+			hardenedAlgorithms.MACs); err != nil {
+			return ssh.Algorithms{}, err
+		}
+	}
+	return algorithms, nil
+}
+
+// InsecureAlgorithmsOffered returns the algorithms of algorithms with known weaknesses.
+func InsecureAlgorithmsOffered(algorithms ssh.Algorithms) []string {
+	insecure := ssh.InsecureAlgorithms()
+	weak := slices.Concat(insecure.KeyExchanges, insecure.Ciphers, insecure.MACs, []string{ssh.HMACSHA1})
+	var offered []string
+	for _, name := range slices.Concat(algorithms.KeyExchanges, algorithms.Ciphers, algorithms.MACs) {
+		if slices.Contains(weak, name) {
+			offered = append(offered, name)
+		}
+	}
+	return offered
+}
+
+// parseAlgorithms parses a comma-separated list of algorithms of kind, each of which
+// must be known, returning profile if list is empty.
+func parseAlgorithms(kind, list string, profile, known []string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return profile, nil
+	}
+	var algorithms []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unsupported %s algorithm %q, supported: %s", kind, name, strings.Join(known, ", "))
+		}
+		algorithms = append(algorithms, name)
+	}
+	if len(algorithms) == 0 {
+		return nil, fmt.Errorf("no %s algorithms in %q", kind, list)
+	}
+	return algorithms, nil
+}
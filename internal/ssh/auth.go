@@ -0,0 +1,57 @@
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Authentication settings, read from the environment at startup.
+var (
+	// MaxAuthTries is the number of failed authentication attempts a connection may make
+	// before it is closed, read from SSH_IFY_MAX_AUTH_TRIES. A negative value allows any
+	// number of attempts.
+	MaxAuthTries = config.EnvInt("SSH_IFY_MAX_AUTH_TRIES", 6)
+
+	// NoClientAuth lets clients log in without credentials under any name that is not a
+	// registered user, e.g. for a public tunnel. Registered users still authenticate as
+	// usual. It is read from SSH_IFY_NO_CLIENT_AUTH.
+	NoClientAuth = config.EnvBool("SSH_IFY_NO_CLIENT_AUTH", false)
+
+	// AuthTimeout is how long a connection may take to complete the SSH handshake and
+	// authenticate before it is closed, read from SSH_IFY_SSH_AUTH_TIMEOUT. 0 disables it.
+	AuthTimeout = config.EnvDuration("SSH_IFY_SSH_AUTH_TIMEOUT", 2*time.Minute)
+)
+
+// authTimeouts counts connections closed for not authenticating within AuthTimeout.
+var authTimeouts = metrics.NewCounter("ssh_ify_ssh_auth_timeouts_total",
+	"SSH connections closed for not completing authentication in time.")
+
+// withNoClientAuth wraps a NoClientAuthCallback, which may be nil, so that clients it
+// does not accept log in anyway unless they are banned or claim the name of a registered
+// user.
+func withNoClientAuth(next func(ssh.ConnMetadata) (*ssh.Permissions, error)) func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+	return func(c ssh.ConnMetadata) (*ssh.Permissions, error) {
+		if next != nil {
+			if perms, err := next(c); err == nil {
+				return perms, nil
+			}
+		}
+		if clientBanned(c) {
+			logf(c, "NoClientAuth: rejected login for user '%s' from banned client %s", c.User(), c.RemoteAddr())
+			return nil, fmt.Errorf("%w: client banned", ErrPolicyDenied)
+		}
+		if userDB == nil {
+			return nil, fmt.Errorf("user database not initialized")
+		}
+		if _, err := userDB.GetUserInfo(c.User()); err == nil {
+			return nil, fmt.Errorf("%w: registered users must authenticate", ErrAuthFailed)
+		}
+		logf(c, "NoClientAuth: login without credentials as '%s' from %s", c.User(), c.RemoteAddr())
+		return nil, nil
+	}
+}
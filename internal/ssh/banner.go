@@ -0,0 +1,202 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultBanner is sent to clients before authentication, translated, when neither a
+// banner file nor banner text is set.
+const DefaultBanner = "Welcome to ssh-ify.\n"
+
+// Banner policies
+const (
+	// BannerAccount renders the banner with the status of the account the client logs in as.
+	BannerAccount = "account"
+
+	// BannerGeneric renders the banner without account status, the same for every client,
+	// so that it reveals nothing about accounts.
+	BannerGeneric = "generic"
+
+	// BannerNone sends no banner.
+	BannerNone = "none"
+)
+
+// Banner settings, read from the environment at startup.
+var (
+	// BannerFile is a text/template rendered with BannerData for each connection and sent
+	// to the client before authentication. It is read from SSH_IFY_BANNER_FILE; when
+	// empty, BannerText is sent.
+	BannerFile = config.Env("SSH_IFY_BANNER_FILE", "")
+
+	// BannerText is the banner template used without a banner file, read from
+	// SSH_IFY_BANNER; when empty, DefaultBanner is sent.
+	BannerText = config.Env("SSH_IFY_BANNER", "")
+
+	// BannerPolicy selects what the banner may reveal before authentication: BannerAccount,
+	// BannerGeneric or BannerNone. It is read from SSH_IFY_BANNER_POLICY.
+	BannerPolicy = config.Env("SSH_IFY_BANNER_POLICY", BannerAccount)
+
+	// BannerSkipClients lists patterns of SSH client version strings, such as
+	// "SSH-2.0-paramiko_*", separated by commas, whose clients get no banner. Some
+	// automated clients mishandle a banner during authentication. It is read from
+	// SSH_IFY_BANNER_SKIP_CLIENTS.
+	BannerSkipClients = config.Env("SSH_IFY_BANNER_SKIP_CLIENTS", "")
+)
+
+// bannersSkipped counts banners not sent, by why: "listener" or "client".
+var bannersSkipped = metrics.NewCounterVec("ssh_ify_banners_skipped_total",
+	"Banners not sent because the listener disables them or the client version matches SSH_IFY_BANNER_SKIP_CLIENTS.", "reason")
+
+// BannerData is the account status of the user a client logs in as, available to the
+// banner template. The banner is sent before the password is checked, so the values are
+// those of the account named by the client, whoever they are.
+type BannerData struct {
+	User           string    // Username the client logs in as
+	Plan           string    // Plan of the user, or ""
+	Schedule       string    // Login window in effect, e.g. "any time"
+	Expires        string    // Expiry date of the account, or "never"
+	DaysLeft       int       // Days until the account expires, rounded up, or -1 if it never does
+	ActiveSessions int       // Sessions the user currently has open
+	MaxSessions    int       // Concurrent sessions the user may have; 0 means unlimited
+	Now            time.Time // Time of the connection
+	Lang           string    // Language code of the server's messages, e.g. "es"
+}
+
+// LoadBanner parses the banner template at path. The template is checked by rendering it
+// for an example user, so that unknown fields are reported at startup.
+func LoadBanner(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read banner file: %v", err)
+	}
+	return parseBanner("banner file "+path, string(data))
+}
+
+// parseBanner parses the banner template text from source, checking it like LoadBanner.
+func parseBanner(source, text string) (*template.Template, error) {
+	tmpl, err := template.New("banner").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", source, err)
+	}
+	example := BannerData{User: "example", Schedule: "any time", Expires: "never", DaysLeft: -1, Now: time.Now(), Lang: i18n.Lang()}
+	if err := tmpl.Execute(io.Discard, example); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", source, err)
+	}
+	return tmpl, nil
+}
+
+// newBannerCallback returns an ssh.ServerConfig.BannerCallback sending the banner at
+// path, or the banner text if path is empty, or DefaultBanner if both are, rendered as
+// policy allows, except to clients matching one of the skip patterns or connected through
+// a listener that disables the banner. BannerNone yields a nil callback, sending no banner.
+func newBannerCallback(path, text, policy, skip string) (func(ssh.ConnMetadata) string, error) {
+	switch policy {
+	case BannerAccount, BannerGeneric:
+	case BannerNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown banner policy %q", policy)
+	}
+	patterns := parseClientPatterns(skip)
+	banner, err := newBanner(path, text, policy)
+	if err != nil {
+		return nil, err
+	}
+	return func(meta ssh.ConnMetadata) string {
+		if addr, ok := meta.RemoteAddr().(SessionAddr); ok && addr.NoBanner {
+			bannersSkipped.Inc("listener")
+			return ""
+		}
+		if matchesClient(patterns, string(meta.ClientVersion())) {
+			bannersSkipped.Inc("client")
+			return ""
+		}
+		return banner(meta)
+	}, nil
+}
+
+// newBanner returns a function rendering the banner at path, or the banner text if path
+// is empty, or DefaultBanner if both are, as policy allows.
+func newBanner(path, text, policy string) (func(ssh.ConnMetadata) string, error) {
+	var tmpl *template.Template
+	var err error
+	switch {
+	case path != "":
+		tmpl, err = LoadBanner(path)
+	case text != "":
+		tmpl, err = parseBanner("SSH_IFY_BANNER", text)
+	default:
+		return func(ssh.ConnMetadata) string { return i18n.T(DefaultBanner) }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func(meta ssh.ConnMetadata) string {
+		data := BannerData{Schedule: "any time", Expires: "never", DaysLeft: -1, Now: time.Now(), Lang: i18n.Lang()}
+		if policy == BannerAccount {
+			data = bannerData(meta.User())
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			logf(meta, "Banner: failed to render for user '%s': %v", meta.User(), err)
+			return i18n.T(DefaultBanner)
+		}
+		return b.String()
+	}, nil
+}
+
+// ValidateBanner checks the banner settings, loading the banner template if one is set.
+func ValidateBanner() error {
+	_, err := newBannerCallback(BannerFile, BannerText, BannerPolicy, BannerSkipClients)
+	return err
+}
+
+// AccountStatus returns the account status of user, as shown in the banner.
+func AccountStatus(user string) BannerData {
+	return bannerData(user)
+}
+
+// bannerData returns the account status of user. Users that do not exist get the values
+// of an account without restrictions.
+func bannerData(user string) BannerData {
+	now := time.Now()
+	data := BannerData{User: user, Schedule: "any time", Expires: "never", DaysLeft: -1, Now: now, Lang: i18n.Lang()}
+	data.MaxSessions = SessionLimit(user)
+	if n, err := limits.Shared().Sessions(user); err == nil {
+		data.ActiveSessions = n
+	}
+	if userDB == nil {
+		return data
+	}
+	info, err := userDB.GetUserInfo(user)
+	if err != nil {
+		return data
+	}
+	schedule := info.Schedule
+	if info.Plan != "" {
+		data.Plan = info.Plan
+		if plan := userDB.PlanOf(user); plan != nil && schedule == nil {
+			schedule = plan.Schedule
+		}
+	}
+	data.Schedule = schedule.String()
+	if !info.Expires.IsZero() {
+		data.Expires = info.Expires.Format(usermgmt.ExpiryLayout)
+		data.DaysLeft = max(int(math.Ceil(info.Expires.Sub(now).Hours()/24)), 0)
+	}
+	return data
+}
@@ -0,0 +1,367 @@
+package ssh
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Keyboard-interactive modes
+const (
+	// KeyboardInteractiveAfter requires the challenges after a successful password,
+	// certificate or client certificate login.
+	KeyboardInteractiveAfter = "after"
+
+	// KeyboardInteractiveInstead replaces password authentication with keyboard-interactive
+	// authentication that asks for the password first, then runs the challenges.
+	KeyboardInteractiveInstead = "instead"
+)
+
+// Keyboard-interactive configuration, read from the environment at startup.
+var (
+	// KeyboardInteractiveChallenges lists the challenges users must pass, in order, as
+	// comma-separated "name" or "name:argument" entries, e.g. "math,otp:/etc/ssh-ify/otp.json".
+	// It is read from SSH_IFY_KBD_CHALLENGES; when empty, keyboard-interactive
+	// authentication is disabled.
+	KeyboardInteractiveChallenges = config.Env("SSH_IFY_KBD_CHALLENGES", "")
+
+	// KeyboardInteractiveMode is KeyboardInteractiveAfter or KeyboardInteractiveInstead.
+	// It is read from SSH_IFY_KBD_MODE.
+	KeyboardInteractiveMode = config.Env("SSH_IFY_KBD_MODE", KeyboardInteractiveAfter)
+)
+
+// Challenge is one step of keyboard-interactive authentication.
+type Challenge interface {
+	// Run asks the user of meta questions through ask and returns nil if the answers are
+	// correct, or an error wrapping ErrAuthFailed if they are not.
+	Run(meta ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) error
+}
+
+// ChallengeFactory creates a challenge from its configuration argument, which is empty
+// when none was given.
+type ChallengeFactory func(arg string) (Challenge, error)
+
+var (
+	challengesMutex sync.RWMutex
+	challenges      = map[string]ChallengeFactory{
+		"password": newPasswordChallenge,
+		"math":     newMathChallenge,
+		"otp":      newOTPChallenge,
+		"question": newQuestionChallenge,
+	}
+)
+
+// RegisterChallenge makes a challenge available under name for use in
+// SSH_IFY_KBD_CHALLENGES. Registering a name again replaces the previous factory.
+func RegisterChallenge(name string, factory ChallengeFactory) {
+	challengesMutex.Lock()
+	defer challengesMutex.Unlock()
+	challenges[name] = factory
+}
+
+// ChallengeNames returns the names of the registered challenges, sorted.
+func ChallengeNames() []string {
+	challengesMutex.RLock()
+	defer challengesMutex.RUnlock()
+	names := make([]string, 0, len(challenges))
+	for name := range challenges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedChallenge is a configured challenge and the name it is logged as.
+type namedChallenge struct {
+	name string
+	Challenge
+}
+
+// ParseChallenges creates the challenges listed in spec, in the format of
+// KeyboardInteractiveChallenges.
+func ParseChallenges(spec string) ([]namedChallenge, error) {
+	challengesMutex.RLock()
+	defer challengesMutex.RUnlock()
+	var list []namedChallenge
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(entry, ":")
+		factory, ok := challenges[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown keyboard-interactive challenge %q", name)
+		}
+		challenge, err := factory(arg)
+		if err != nil {
+			return nil, fmt.Errorf("keyboard-interactive challenge %q: %v", name, err)
+		}
+		list = append(list, namedChallenge{name: name, Challenge: challenge})
+	}
+	return list, nil
+}
+
+// configureKeyboardInteractive installs the challenges on config according to
+// KeyboardInteractiveMode. In both modes certificate and client certificate logins only
+// stand in for the password, so the challenges follow them.
+func configureKeyboardInteractive(config *ssh.ServerConfig, list []namedChallenge) error {
+	switch KeyboardInteractiveMode {
+	case KeyboardInteractiveInstead:
+		password := namedChallenge{name: "password", Challenge: passwordChallenge{}}
+		config.KeyboardInteractiveCallback = runChallenges(append([]namedChallenge{password}, list...), nil)
+		config.PasswordCallback = nil
+	case KeyboardInteractiveAfter:
+		config.PasswordCallback = thenChallenges(config.PasswordCallback, list)
+	default:
+		return fmt.Errorf("unknown keyboard-interactive mode %q", KeyboardInteractiveMode)
+	}
+	config.PublicKeyCallback = thenChallenges(config.PublicKeyCallback, list)
+	if noClientAuth := config.NoClientAuthCallback; noClientAuth != nil {
+		next := thenChallenges(func(c ssh.ConnMetadata, _ struct{}) (*ssh.Permissions, error) {
+			return noClientAuth(c)
+		}, list)
+		config.NoClientAuthCallback = func(c ssh.ConnMetadata) (*ssh.Permissions, error) {
+			return next(c, struct{}{})
+		}
+	}
+	return nil
+}
+
+// thenChallenges wraps an authentication callback so that its successes only partially
+// authenticate the client, which must then pass the challenges. A nil callback stays nil.
+func thenChallenges[T any](callback func(ssh.ConnMetadata, T) (*ssh.Permissions, error), list []namedChallenge) func(ssh.ConnMetadata, T) (*ssh.Permissions, error) {
+	if callback == nil {
+		return nil
+	}
+	return func(c ssh.ConnMetadata, credential T) (*ssh.Permissions, error) {
+		perms, err := callback(c, credential)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &ssh.PartialSuccessError{Next: ssh.ServerAuthCallbacks{
+			KeyboardInteractiveCallback: runChallenges(list, perms),
+		}}
+	}
+}
+
+// runChallenges returns a keyboard-interactive callback running the challenges in order.
+// On success it grants perms, the permissions of an earlier authentication step.
+func runChallenges(list []namedChallenge, perms *ssh.Permissions) func(ssh.ConnMetadata, ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+	return func(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		if clientBanned(c) {
+			logf(c, "KeyboardInteractive: rejected login for user '%s' from banned client %s", c.User(), c.RemoteAddr())
+			return nil, fmt.Errorf("%w: client banned", ErrPolicyDenied)
+		}
+		for _, challenge := range list {
+			if err := challenge.Run(c, ask); err != nil {
+				logf(c, "KeyboardInteractive: user '%s' from %s failed the %s challenge: %v", c.User(), c.RemoteAddr(), challenge.name, err)
+				if challenge.name != "password" {
+					// The password challenge records its own failures.
+					recordLoginFailure(c)
+				}
+				return nil, err
+			}
+		}
+		logf(c, "KeyboardInteractive: user '%s' from %s passed %d challenges", c.User(), c.RemoteAddr(), len(list))
+		return perms, nil
+	}
+}
+
+// askOne asks a single question and returns the trimmed answer.
+func askOne(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge, question string, echo bool) (string, error) {
+	answers, err := ask(c.User(), "", []string{question}, []bool{echo})
+	if err != nil {
+		return "", err
+	}
+	if len(answers) != 1 {
+		return "", fmt.Errorf("%w: expected 1 answer, got %d", ErrAuthFailed, len(answers))
+	}
+	return strings.TrimSpace(answers[0]), nil
+}
+
+// passwordChallenge asks for the user's password.
+type passwordChallenge struct{}
+
+func newPasswordChallenge(string) (Challenge, error) {
+	return passwordChallenge{}, nil
+}
+
+// Run checks the password like PasswordAuth.
+func (passwordChallenge) Run(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) error {
+	answers, err := ask(c.User(), "", []string{"Password: "}, []bool{false})
+	if err != nil {
+		return err
+	}
+	if len(answers) != 1 {
+		return fmt.Errorf("%w: expected 1 answer, got %d", ErrAuthFailed, len(answers))
+	}
+	_, err = PasswordAuth(c, []byte(answers[0]))
+	return err
+}
+
+// mathChallenge asks for the sum of two random numbers, which slows down scripted logins.
+type mathChallenge struct{}
+
+func newMathChallenge(string) (Challenge, error) {
+	return mathChallenge{}, nil
+}
+
+// Run asks for the sum of two numbers between 1 and 20.
+func (mathChallenge) Run(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) error {
+	a, b := randomInt(20)+1, randomInt(20)+1
+	answer, err := askOne(c, ask, fmt.Sprintf("What is %d + %d? ", a, b), true)
+	if err != nil {
+		return err
+	}
+	if answer != strconv.Itoa(a+b) {
+		return fmt.Errorf("%w: wrong answer", ErrAuthFailed)
+	}
+	return nil
+}
+
+func randomInt(n int64) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int64())
+}
+
+// otpChallenge asks for a time-based one-time password (RFC 6238, 30-second steps,
+// 6 digits, SHA-1) as generated by common authenticator apps.
+type otpChallenge struct {
+	secrets map[string][]byte // Shared secret by username
+
+	mutex sync.Mutex
+	used  map[string]int64 // Last accepted time step by username
+}
+
+// newOTPChallenge reads a JSON object mapping usernames to base32 secrets from the file
+// named by arg. Users without a secret fail the challenge.
+func newOTPChallenge(arg string) (Challenge, error) {
+	encoded, err := readJSONFile[map[string]string](arg)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string][]byte, len(encoded))
+	for user, secret := range encoded {
+		secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+		key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret of user '%s': %v", user, err)
+		}
+		secrets[user] = key
+	}
+	return &otpChallenge{secrets: secrets, used: make(map[string]int64)}, nil
+}
+
+// Run accepts the code of the current 30-second step or an adjacent one. Codes of a step
+// no later than the user's last accepted one are refused, so an observed code cannot be
+// used again.
+func (o *otpChallenge) Run(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) error {
+	answer, err := askOne(c, ask, "Verification code: ", true)
+	if err != nil {
+		return err
+	}
+	key, ok := o.secrets[c.User()]
+	if !ok {
+		return fmt.Errorf("%w: no OTP secret enrolled", ErrAuthFailed)
+	}
+	step := time.Now().Unix() / 30
+	for _, s := range []int64{step - 1, step, step + 1} {
+		if subtle.ConstantTimeCompare([]byte(answer), []byte(totp(key, s))) != 1 {
+			continue
+		}
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		if s <= o.used[c.User()] {
+			return fmt.Errorf("%w: verification code already used", ErrAuthFailed)
+		}
+		o.used[c.User()] = s
+		return nil
+	}
+	return fmt.Errorf("%w: wrong verification code", ErrAuthFailed)
+}
+
+// totp returns the 6-digit code for the given time step (RFC 4226 section 5.3).
+func totp(key []byte, step int64) string {
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+// securityQuestion is a user's question and the SHA-256 hex digest of the lower-cased answer.
+type securityQuestion struct {
+	Question     string `json:"question"`
+	AnswerSHA256 string `json:"answer_sha256"`
+}
+
+// questionChallenge asks the user's security question.
+type questionChallenge struct {
+	questions map[string]securityQuestion
+}
+
+// newQuestionChallenge reads a JSON object mapping usernames to their question from the
+// file named by arg. Users without a question fail the challenge.
+func newQuestionChallenge(arg string) (Challenge, error) {
+	questions, err := readJSONFile[map[string]securityQuestion](arg)
+	if err != nil {
+		return nil, err
+	}
+	return &questionChallenge{questions: questions}, nil
+}
+
+// Run compares the answer case-insensitively.
+func (q *questionChallenge) Run(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) error {
+	question, ok := q.questions[c.User()]
+	if !ok {
+		return fmt.Errorf("%w: no security question set", ErrAuthFailed)
+	}
+	answer, err := askOne(c, ask, question.Question+" ", false)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(answer)))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(question.AnswerSHA256))) != 1 {
+		return fmt.Errorf("%w: wrong answer", ErrAuthFailed)
+	}
+	return nil
+}
+
+// readJSONFile decodes the JSON file at path.
+func readJSONFile[T any](path string) (T, error) {
+	var v T
+	if path == "" {
+		return v, fmt.Errorf("a file argument is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return v, nil
+}
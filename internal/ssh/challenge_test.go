@@ -0,0 +1,182 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// codeChallenge asks for a fixed code.
+type codeChallenge struct{ code string }
+
+func (ch codeChallenge) Run(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) error {
+	answer, err := askOne(c, ask, "Code: ", true)
+	if err != nil {
+		return err
+	}
+	if answer != ch.code {
+		return fmt.Errorf("%w: wrong code", ErrAuthFailed)
+	}
+	return nil
+}
+
+// newTestSigner returns a fresh ed25519 signer.
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// newTestUserDB replaces the user database with an empty one holding user.
+func newTestUserDB(t *testing.T, user, password string) {
+	t.Helper()
+	previous := userDB
+	t.Cleanup(func() { userDB = previous })
+	if err := InitializeAuth(filepath.Join(t.TempDir(), "users.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := userDB.AddUser(user, password); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// certLogin runs an SSH handshake against config over loopback TCP, authenticating with a
+// certificate for user signed by ca and, if answer is not empty, keyboard-interactive
+// answers. It returns the questions the client was asked.
+func certLogin(t *testing.T, config *ssh.ServerConfig, ca ssh.Signer, user, answer string) ([]string, error) {
+	t.Helper()
+	userKey := newTestSigner(t)
+	cert := &ssh.Certificate{
+		Key:             userKey.PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           user + "-key",
+		ValidPrincipals: []string{user},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, userKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var asked []string
+	auth := []ssh.AuthMethod{ssh.PublicKeys(certSigner)}
+	if answer != "" {
+		auth = append(auth, ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+			asked = append(asked, questions...)
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = answer
+			}
+			return answers, nil
+		}))
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		serverEnd, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer serverEnd.Close()
+		serverEnd.SetDeadline(time.Now().Add(10 * time.Second))
+		if conn, _, _, err := ssh.NewServerConn(serverEnd, config); err == nil {
+			conn.Close()
+		}
+	}()
+	clientEnd, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientEnd.Close()
+	clientEnd.SetDeadline(time.Now().Add(10 * time.Second))
+	conn, _, _, err := ssh.NewClientConn(clientEnd, "test", &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		conn.Close()
+	}
+	return asked, err
+}
+
+func TestUserCertInsteadModeRunsChallenges(t *testing.T) {
+	newTestUserDB(t, "alice", "secret")
+	previous := KeyboardInteractiveMode
+	KeyboardInteractiveMode = KeyboardInteractiveInstead
+	t.Cleanup(func() { KeyboardInteractiveMode = previous })
+
+	ca := newTestSigner(t)
+	config := &ssh.ServerConfig{
+		PasswordCallback:  PasswordAuth,
+		PublicKeyCallback: NewUserCertAuth([]ssh.PublicKey{ca.PublicKey()}),
+	}
+	config.AddHostKey(newTestSigner(t))
+	if err := configureKeyboardInteractive(config, []namedChallenge{{name: "code", Challenge: codeChallenge{"42"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := certLogin(t, config, ca, "alice", ""); err == nil {
+		t.Fatal("certificate login succeeded without answering the challenges")
+	}
+	if _, err := certLogin(t, config, ca, "alice", "41"); err == nil {
+		t.Fatal("certificate login succeeded with a wrong answer")
+	}
+	asked, err := certLogin(t, config, ca, "alice", "42")
+	if err != nil {
+		t.Fatalf("certificate login with the right answer: %v", err)
+	}
+	// The certificate stands in for the password, which is not asked for.
+	if !slices.Equal(asked, []string{"Code: "}) {
+		t.Errorf("client was asked %q, want only the challenge", asked)
+	}
+}
+
+// userMeta is connection metadata naming a user.
+type userMeta struct {
+	ssh.ConnMetadata
+	user string
+}
+
+func (m userMeta) User() string { return m.user }
+
+func TestOTPCodeUsedOnce(t *testing.T) {
+	key := []byte("12345678901234567890")
+	o := &otpChallenge{secrets: map[string][]byte{"alice": key}, used: make(map[string]int64)}
+	code := totp(key, time.Now().Unix()/30)
+	ask := func(string, string, []string, []bool) ([]string, error) { return []string{code}, nil }
+
+	if err := o.Run(userMeta{user: "alice"}, ask); err != nil {
+		t.Fatalf("first use of the code: %v", err)
+	}
+	if err := o.Run(userMeta{user: "alice"}, ask); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("second use of the code: error = %v, want %v", err, ErrAuthFailed)
+	}
+	// Other users' steps are tracked separately.
+	o.secrets["bob"] = key
+	if err := o.Run(userMeta{user: "bob"}, ask); err != nil {
+		t.Fatalf("code of another user: %v", err)
+	}
+}
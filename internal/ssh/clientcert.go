@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Client certificate authentication modes
+const (
+	// ClientCertOff ignores TLS client certificates for SSH authentication.
+	ClientCertOff = "off"
+
+	// ClientCertSufficient logs a user in without a password when the session's TLS
+	// client certificate is mapped to them. Password authentication still works.
+	ClientCertSufficient = "sufficient"
+
+	// ClientCertRequired requires both a mapped TLS client certificate and the password.
+	ClientCertRequired = "required"
+)
+
+// ClientCertAuth selects how TLS client certificates take part in SSH authentication.
+// It is read from SSH_IFY_CLIENT_CERT_AUTH and only has an effect on sessions whose
+// TLS listener verified a client certificate.
+var ClientCertAuth = config.Env("SSH_IFY_CLIENT_CERT_AUTH", ClientCertSufficient)
+
+// clientCertIdentities returns the identities of the verified TLS client certificate
+// of the session meta belongs to, or nil if there is none.
+func clientCertIdentities(meta ssh.ConnMetadata) []string {
+	addr, ok := meta.RemoteAddr().(SessionAddr)
+	if !ok || addr.ClientCert == nil {
+		return nil
+	}
+	return usermgmt.CertIdentities(addr.ClientCert)
+}
+
+// clientCertMatches reports whether the session's client certificate is mapped to the
+// user meta authenticates as.
+func clientCertMatches(meta ssh.ConnMetadata) bool {
+	identities := clientCertIdentities(meta)
+	return userDB != nil && len(identities) > 0 && userDB.AuthenticateClientCert(meta.User(), identities)
+}
+
+// ClientCertAuthCallback implements ssh.ServerConfig.NoClientAuthCallback. It accepts the
+// "none" method when the session's TLS client certificate is mapped to the user.
+func ClientCertAuthCallback(c ssh.ConnMetadata) (*ssh.Permissions, error) {
+	if clientCertIdentities(c) == nil {
+		return nil, fmt.Errorf("no client certificate")
+	}
+	if clientBanned(c) {
+		logf(c, "ClientCertAuth: rejected login for user '%s' from banned client %s", c.User(), c.RemoteAddr())
+		return nil, fmt.Errorf("%w: client banned", ErrPolicyDenied)
+	}
+	if !clientCertMatches(c) {
+		logf(c, "ClientCertAuth: certificate not mapped to user '%s' from %s", c.User(), c.RemoteAddr())
+		return nil, fmt.Errorf("%w: client certificate not mapped to user", ErrAuthFailed)
+	}
+	logf(c, "ClientCertAuth: successful login for user '%s' from %s", c.User(), c.RemoteAddr())
+	return nil, nil
+}
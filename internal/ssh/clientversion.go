@@ -0,0 +1,119 @@
+package ssh
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Client version rules, read from the environment at startup. Both are lists of patterns
+// of SSH client version strings, such as "SSH-2.0-OpenSSH_9.*", separated by commas, in
+// which "*" matches any run of characters.
+var (
+	// ClientVersionAllow lists the only client versions that may log in. It is read from
+	// SSH_IFY_CLIENT_VERSION_ALLOW; when empty, any client may.
+	ClientVersionAllow = config.Env("SSH_IFY_CLIENT_VERSION_ALLOW", "")
+
+	// ClientVersionDeny lists client versions that may not log in, even if allowed by
+	// ClientVersionAllow. It is read from SSH_IFY_CLIENT_VERSION_DENY.
+	ClientVersionDeny = config.Env("SSH_IFY_CLIENT_VERSION_DENY", "")
+)
+
+// clientVersionRejections counts login attempts refused for the client version, by
+// reason: "not_allowed" or "denied".
+var clientVersionRejections = metrics.NewCounterVec("ssh_ify_client_version_rejections_total",
+	"Login attempts refused because of the SSH client version, by reason.", "reason")
+
+// parseClientPatterns compiles a comma-separated list of client version patterns, in
+// which "*" matches any run of characters.
+func parseClientPatterns(list string) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		expr := strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+		patterns = append(patterns, regexp.MustCompile("^"+expr+"$"))
+	}
+	return patterns
+}
+
+// matchesClient reports whether the client version string matches one of patterns.
+func matchesClient(patterns []*regexp.Regexp, version string) bool {
+	for _, p := range patterns {
+		if p.MatchString(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkClientVersion reports whether the client version passes the allow and deny lists.
+// On failure it also returns the reason ("not_allowed" or "denied").
+func checkClientVersion(allow, deny []*regexp.Regexp, version string) (bool, string) {
+	if len(allow) > 0 && !matchesClient(allow, version) {
+		return false, "not_allowed"
+	}
+	if matchesClient(deny, version) {
+		return false, "denied"
+	}
+	return true, ""
+}
+
+// restrictClientVersions wraps the authentication callbacks of config so that clients
+// refused by ClientVersionAllow and ClientVersionDeny cannot log in, whatever
+// credentials they present.
+func restrictClientVersions(config *ssh.ServerConfig) {
+	allow, deny := parseClientPatterns(ClientVersionAllow), parseClientPatterns(ClientVersionDeny)
+	if len(allow) == 0 && len(deny) == 0 {
+		return
+	}
+	refused := func(c ssh.ConnMetadata) error {
+		ok, reason := checkClientVersion(allow, deny, string(c.ClientVersion()))
+		if ok {
+			return nil
+		}
+		clientVersionRejections.Inc(reason)
+		sampledLogf(logsample.LoginFailed, c, "ClientVersion: rejected login for user '%s' from %s with client %q", c.User(), c.RemoteAddr(), c.ClientVersion())
+		return fmt.Errorf("%w: client version not allowed", ErrPolicyDenied)
+	}
+
+	if next := config.PasswordCallback; next != nil {
+		config.PasswordCallback = func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if err := refused(c); err != nil {
+				return nil, err
+			}
+			return next(c, password)
+		}
+	}
+	if next := config.PublicKeyCallback; next != nil {
+		config.PublicKeyCallback = func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if err := refused(c); err != nil {
+				return nil, err
+			}
+			return next(c, key)
+		}
+	}
+	if next := config.KeyboardInteractiveCallback; next != nil {
+		config.KeyboardInteractiveCallback = func(c ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if err := refused(c); err != nil {
+				return nil, err
+			}
+			return next(c, ask)
+		}
+	}
+	if next := config.NoClientAuthCallback; next != nil {
+		config.NoClientAuthCallback = func(c ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if err := refused(c); err != nil {
+				return nil, err
+			}
+			return next(c)
+		}
+	}
+}
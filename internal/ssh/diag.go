@@ -0,0 +1,129 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Diagnostics channel protocol
+const (
+	// DiagChannelType is the channel type clients open for diagnostics. Data sent on the
+	// channel is echoed back, so that clients can time round trips through the tunnel,
+	// and a DiagReport is written to its stderr as one JSON line when it opens and on
+	// every DiagReportRequestType request.
+	DiagChannelType = "ssh-ify-diag"
+
+	// DiagReportRequestType asks for a fresh DiagReport on the diagnostics channel.
+	DiagReportRequestType = "report"
+)
+
+// DiagChannel lets clients open DiagChannelType channels. It is read from
+// SSH_IFY_DIAG_CHANNEL.
+var DiagChannel = config.EnvBool("SSH_IFY_DIAG_CHANNEL", false)
+
+// diagChannels counts diagnostics channels opened.
+var diagChannels = metrics.NewCounter("ssh_ify_diag_channels_total",
+	"Diagnostics channels opened by clients.")
+
+// TransportDiagnostics are the parts of a DiagReport known to the transport carrying
+// the SSH connection, supplied by ConnHandler.Diagnostics.
+type TransportDiagnostics struct {
+	BytesIn          int64 `json:"bytes_in"`                    // Bytes received from the client so far
+	BytesOut         int64 `json:"bytes_out"`                   // Bytes sent to the client so far
+	EgressLimit      int64 `json:"egress_limit,omitempty"`      // Server-wide bytes per second sent to clients; 0 is unlimited
+	IngressLimit     int64 `json:"ingress_limit,omitempty"`     // Server-wide bytes per second received from clients; 0 is unlimited
+	MonthlyRemaining int64 `json:"monthly_remaining,omitempty"` // Bytes left of the server's monthly transfer budget, if it has one
+	BudgetReached    bool  `json:"budget_reached,omitempty"`    // Whether the budget threshold was reached and its action taken
+}
+
+// DiagReport describes a connection, its limits and what is left of them.
+type DiagReport struct {
+	Time             time.Time             `json:"time"`
+	User             string                `json:"user"`
+	Session          string                `json:"session,omitempty"`
+	RTTMillis        float64               `json:"rtt_ms"`                              // Round trip of a keepalive request sent for this report
+	ConnectedSeconds int64                 `json:"connected_seconds"`                   // Since the user authenticated
+	ActiveSessions   int                   `json:"active_sessions"`                     // Sessions the user has open, this one included
+	MaxSessions      int                   `json:"max_sessions,omitempty"`              // Concurrent sessions allowed; 0 is unlimited
+	OpenForwards     int                   `json:"open_forwards"`                       // Forwarding and diagnostics channels open on this connection
+	MaxForwards      int                   `json:"max_forwards,omitempty"`              // Channels allowed per connection; 0 is unlimited
+	SessionRemaining int64                 `json:"session_remaining_seconds,omitempty"` // Until the maximum session duration is reached
+	AccountExpires   time.Time             `json:"account_expires,omitzero"`
+	Transport        *TransportDiagnostics `json:"transport,omitempty"`
+}
+
+// diagReport builds a report on the connection of meta, authenticated at start with
+// forwards channels open.
+func (h *ConnHandler) diagReport(meta ssh.ConnMetadata, start time.Time, forwards *atomic.Int32) DiagReport {
+	user := meta.User()
+	report := DiagReport{
+		User:         user,
+		Session:      SessionID(meta),
+		MaxSessions:  SessionLimit(user),
+		OpenForwards: int(forwards.Load()),
+		MaxForwards:  limits.MaxForwardsPerConnection.Load(),
+	}
+	if conn, ok := meta.(ssh.Conn); ok {
+		sent := time.Now()
+		if _, _, err := conn.SendRequest(KeepaliveRequestType, true, nil); err == nil {
+			report.RTTMillis = float64(time.Since(sent).Microseconds()) / 1000
+		}
+	}
+	if n, err := limits.Shared().Sessions(user); err == nil {
+		report.ActiveSessions = n
+	}
+	if userDB != nil {
+		if info, err := userDB.GetUserInfo(user); err == nil {
+			report.AccountExpires = info.Expires
+		}
+	}
+	if h.Diagnostics != nil {
+		transport := h.Diagnostics()
+		report.Transport = &transport
+	}
+
+	now := h.Clock.Now()
+	report.Time = now
+	report.ConnectedSeconds = int64(now.Sub(start).Seconds())
+	if limit := SessionDurationLimit(user); limit > 0 {
+		report.SessionRemaining = int64(max(limit-now.Sub(start), 0).Seconds())
+	}
+	return report
+}
+
+// handleDiagChannel serves a diagnostics channel until the client closes it or ctx is
+// cancelled.
+func (h *ConnHandler) handleDiagChannel(ctx context.Context, meta ssh.ConnMetadata, ch ssh.Channel, reqs <-chan *ssh.Request, start time.Time, forwards *atomic.Int32) {
+	defer RecoverPanic("diag", SessionID(meta), closeConn(meta))
+	defer ch.Close()
+	diagChannels.Inc()
+
+	enc := json.NewEncoder(ch.Stderr())
+	if err := enc.Encode(h.diagReport(meta, start, forwards)); err != nil {
+		return
+	}
+	go func() {
+		for req := range reqs {
+			if req.Type != DiagReportRequestType {
+				req.Reply(false, nil)
+				continue
+			}
+			err := enc.Encode(h.diagReport(meta, start, forwards))
+			req.Reply(err == nil, nil)
+		}
+	}()
+
+	if _, err := CopyWithSSHBuffer(ctx, ch, ch, nil); err != nil && err != io.EOF && err != ctx.Err() {
+		logf(meta, "Diag: error echoing for user '%s': %v", meta.User(), err)
+	}
+	ch.CloseWrite()
+}
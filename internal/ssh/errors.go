@@ -0,0 +1,38 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Sentinel errors returned or wrapped by this package, so that embedders can tell error
+// kinds apart with errors.Is.
+var (
+	// ErrAuthFailed means the client did not present valid credentials.
+	ErrAuthFailed = errors.New("authentication failed")
+
+	// ErrPolicyDenied means the client was refused by policy rather than for bad
+	// credentials, e.g. a ban, a missing client certificate or a session limit.
+	ErrPolicyDenied = errors.New("denied by policy")
+
+	// ErrTargetUnreachable means a forwarding target could not be connected to.
+	ErrTargetUnreachable = errors.New("target unreachable")
+)
+
+// classifyHandshakeError wraps an SSH handshake error with ErrAuthFailed if the client
+// failed to authenticate, and with ErrPolicyDenied too if any authentication attempt
+// was refused by policy. Other errors are returned unchanged.
+func classifyHandshakeError(err error) error {
+	var authErr *ssh.ServerAuthError
+	if !errors.As(err, &authErr) {
+		return err
+	}
+	for _, attempt := range authErr.Errors {
+		if errors.Is(attempt, ErrPolicyDenied) {
+			return fmt.Errorf("%w: %w: %w", ErrAuthFailed, ErrPolicyDenied, err)
+		}
+	}
+	return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+}
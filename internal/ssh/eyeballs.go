@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Address family preferences for dialing forwarding targets.
+const (
+	PreferIPv6 = "ipv6"
+	PreferIPv4 = "ipv4"
+)
+
+// Happy Eyeballs (RFC 8305) settings, read from the environment at startup.
+var (
+	// ForwardIPPreference is the address family tried first when a forwarding target has
+	// both IPv6 and IPv4 addresses, "ipv6" or "ipv4". It is read from
+	// SSH_IFY_FORWARD_IP_PREFERENCE.
+	ForwardIPPreference = readIPPreference(config.Env("SSH_IFY_FORWARD_IP_PREFERENCE", PreferIPv6))
+
+	// HappyEyeballsDelay is how long a connection attempt to a forwarding target is given
+	// before the next address is tried alongside it, read from SSH_IFY_HAPPY_EYEBALLS_DELAY.
+	HappyEyeballsDelay = config.EnvDuration("SSH_IFY_HAPPY_EYEBALLS_DELAY", 250*time.Millisecond)
+)
+
+// dialFallbacks counts forwards connected through an address other than the first tried.
+var dialFallbacks = metrics.NewCounter("ssh_ify_forward_dial_fallbacks_total",
+	"Port forwards connected to an address of the target other than the first one tried.")
+
+// readIPPreference returns preference if it is a valid address family preference, and
+// PreferIPv6 otherwise.
+func readIPPreference(preference string) string {
+	if preference != PreferIPv6 && preference != PreferIPv4 {
+		log.Printf("Invalid SSH_IFY_FORWARD_IP_PREFERENCE %q, preferring %s", preference, PreferIPv6)
+		return PreferIPv6
+	}
+	return preference
+}
+
+// sortAddresses orders ips for connection attempts as RFC 8305 section 4 recommends:
+// alternating between address families, starting with the preferred one, and otherwise
+// in the order they were resolved.
+func sortAddresses(ips []net.IP, preferIPv6 bool) []net.IP {
+	var preferred, other []net.IP
+	for _, ip := range ips {
+		if (ip.To4() == nil) == preferIPv6 {
+			preferred = append(preferred, ip)
+		} else {
+			other = append(other, ip)
+		}
+	}
+	sorted := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(preferred) || i < len(other); i++ {
+		if i < len(preferred) {
+			sorted = append(sorted, preferred[i])
+		}
+		if i < len(other) {
+			sorted = append(sorted, other[i])
+		}
+	}
+	return sorted
+}
+
+// dialResult is the outcome of one connection attempt.
+type dialResult struct {
+	conn  net.Conn
+	err   error
+	index int
+}
+
+// dialAddresses connects to port on the first of ips to answer, racing connection
+// attempts as RFC 8305 describes: addresses are tried in sortAddresses order, each
+// HappyEyeballsDelay after the previous one or as soon as it fails. Connections that
+// succeed after the first are closed. The first failure is returned if all attempts fail.
+func dialAddresses(ctx context.Context, dialer Dialer, clk clock.Clock, ips []net.IP, port int) (net.Conn, error) {
+	ips = sortAddresses(ips, ForwardIPPreference == PreferIPv6)
+	results := make(chan dialResult, len(ips))
+	next, pending := 0, 0
+	attempt := func() {
+		index := next
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.Dial("tcp", net.JoinHostPort(ips[index].String(), strconv.Itoa(port)))
+			results <- dialResult{conn: conn, err: err, index: index}
+		}()
+	}
+	// discard closes the connections of attempts still pending once the race is decided.
+	discard := func() {
+		go func(pending int) {
+			for ; pending > 0; pending-- {
+				if r := <-results; r.conn != nil {
+					r.conn.Close()
+				}
+			}
+		}(pending)
+	}
+
+	attempt()
+	timer := clk.NewTimer(HappyEyeballsDelay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				discard()
+				if r.index > 0 {
+					dialFallbacks.Inc()
+				}
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(ips) {
+				attempt()
+				timer.Reset(HappyEyeballsDelay)
+			}
+		case <-timer.C():
+			if next < len(ips) {
+				attempt()
+				timer.Reset(HappyEyeballsDelay)
+			}
+		case <-ctx.Done():
+			discard()
+			return nil, ctx.Err()
+		}
+	}
+	return nil, firstErr
+}
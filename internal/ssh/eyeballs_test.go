@@ -0,0 +1,57 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+)
+
+// stallDialer hangs dials to stall until released and connects to any other address.
+type stallDialer struct {
+	stall    string
+	released chan struct{}
+}
+
+func (d stallDialer) Dial(network, address string) (net.Conn, error) {
+	if address == d.stall {
+		<-d.released
+		return nil, errors.New("stalled")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func TestDialAddressesFallsBack(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	dialer := stallDialer{stall: "[2001:db8::1]:22", released: make(chan struct{})}
+	defer close(dialer.released)
+	ips := []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}
+
+	result := make(chan error, 1)
+	go func() {
+		conn, err := dialAddresses(context.Background(), dialer, c, ips, 22)
+		if conn != nil {
+			conn.Close()
+		}
+		result <- err
+	}()
+
+	// Nothing but the stalled attempt runs until the delay passes.
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-result:
+		t.Fatalf("dialAddresses returned %v before the fallback delay", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Advance(HappyEyeballsDelay)
+	if err := <-result; err != nil {
+		t.Fatalf("dialAddresses() error = %v, want the IPv4 fallback", err)
+	}
+}
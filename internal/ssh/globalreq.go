@@ -0,0 +1,102 @@
+package ssh
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/keepalive"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Global request types answered by the server.
+const (
+	// KeepaliveRequestType is sent by OpenSSH clients with ServerAliveInterval set. Some
+	// clients hang or disconnect if it is never answered.
+	KeepaliveRequestType = "keepalive@openssh.com"
+
+	// NoMoreSessionsRequestType tells the server that the client will open no further
+	// session channels, so that any later attempt can be refused as hostile.
+	NoMoreSessionsRequestType = "no-more-sessions@openssh.com"
+)
+
+// globalRequests counts global requests by type. Types the server does not handle are
+// counted as "other".
+var globalRequests = metrics.NewCounterVec("ssh_ify_global_requests_total",
+	"SSH global requests received, by type.", "type")
+
+// keepaliveTimeouts counts connections closed for leaving keepalive requests unanswered.
+var keepaliveTimeouts = metrics.NewCounter("ssh_ify_ssh_keepalive_timeouts_total",
+	"SSH connections closed because the client stopped answering keepalive requests.")
+
+// sessionsClosed holds the connections whose client sent no-more-sessions.
+var sessionsClosed sync.Map // map[ssh.ConnMetadata]struct{}
+
+// handleGlobalRequests answers the global requests of a connection until it closes:
+// keepalives succeed, no-more-sessions succeeds and refuses further session channels,
+// and everything else, such as remote port forwarding, fails.
+func handleGlobalRequests(meta ssh.ConnMetadata, reqs <-chan *ssh.Request) {
+	defer RecoverPanic("global requests", SessionID(meta), closeConn(meta))
+	defer sessionsClosed.Delete(meta)
+	for req := range reqs {
+		switch req.Type {
+		case KeepaliveRequestType:
+			globalRequests.Inc(req.Type)
+			req.Reply(true, nil)
+		case NoMoreSessionsRequestType:
+			globalRequests.Inc(req.Type)
+			sessionsClosed.Store(meta, struct{}{})
+			req.Reply(true, nil)
+		default:
+			globalRequests.Inc("other")
+			logf(meta, "GlobalRequests: user '%s' sent unsupported global request %s", meta.User(), req.Type)
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// sessionsAllowed reports whether the client of meta may still open session channels.
+func sessionsAllowed(meta ssh.ConnMetadata) bool {
+	_, closed := sessionsClosed.Load(meta)
+	return !closed
+}
+
+// sendKeepalives sends a keepalive request every interval until done is closed, and
+// closes the connection once a request has been left unanswered for
+// keepalive.SSHCountMax intervals. Any reply counts as an answer: OpenSSH clients reject
+// the request, but they do reply.
+func sendKeepalives(conn ssh.Conn, clk clock.Clock, interval time.Duration, done <-chan struct{}) {
+	defer RecoverPanic("keepalive", SessionID(conn), closeConn(conn))
+	ticker := clk.NewTicker(interval)
+	defer ticker.Stop()
+	replies := make(chan error, 1)
+	pending, missed := false, 0
+	for {
+		select {
+		case <-done:
+			return
+		case err := <-replies:
+			if err != nil {
+				return
+			}
+			pending, missed = false, 0
+		case <-ticker.C():
+			if !pending {
+				pending = true
+				go func() {
+					_, _, err := conn.SendRequest(KeepaliveRequestType, true, nil)
+					replies <- err
+				}()
+				continue
+			}
+			if missed++; missed >= keepalive.SSHCountMax {
+				keepaliveTimeouts.Inc()
+				logf(conn, "Keepalive: user '%s' left %d keepalives unanswered, disconnecting", conn.User(), missed)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
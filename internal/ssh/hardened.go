@@ -0,0 +1,142 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// hardenedAlgorithms are the only algorithms offered in hardened mode: NIST curve and
+// large-group Diffie-Hellman key exchanges, AES ciphers and SHA-2 MACs.
+var hardenedAlgorithms = ssh.Algorithms{
+	KeyExchanges: []string{
+		ssh.KeyExchangeECDHP256,
+		ssh.KeyExchangeECDHP384,
+		ssh.KeyExchangeECDHP521,
+		ssh.KeyExchangeDH16SHA512,
+		ssh.KeyExchangeDH14SHA256,
+	},
+	Ciphers: []string{
+		ssh.CipherAES256GCM,
+		ssh.CipherAES128GCM,
+		ssh.CipherAES256CTR,
+		ssh.CipherAES192CTR,
+		ssh.CipherAES128CTR,
+	},
+	MACs: []string{
+		ssh.HMACSHA256ETM,
+		ssh.HMACSHA512ETM,
+		ssh.HMACSHA256,
+		ssh.HMACSHA512,
+	},
+}
+
+// hardenedPublicKeyAlgorithms are the signature algorithms accepted from clients, also
+// for certificates, and used with the host key in hardened mode, leaving out SHA-1 and
+// DSA signatures.
+var hardenedPublicKeyAlgorithms = []string{
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoED25519,
+}
+
+// hardenAlgorithms narrows algorithms, of kind, to those approved for hardened mode. A
+// list set explicitly must contain approved algorithms only.
+func hardenAlgorithms(kind, list string, algorithms, approved []string) ([]string, error) {
+	if list == "" {
+		return slices.DeleteFunc(slices.Clone(algorithms), func(name string) bool {
+			return !slices.Contains(approved, name)
+		}), nil
+	}
+	for _, name := range algorithms {
+		if !slices.Contains(approved, name) {
+			return nil, fmt.Errorf("%s algorithm %q is not allowed in hardened mode", kind, name)
+		}
+	}
+	return algorithms, nil
+}
+
+// CheckHardened returns an error listing the settings and keys that hardened mode
+// refuses to start with, or nil if there are none. The host key is checked if it exists.
+func CheckHardened() error {
+	var problems []string
+	if _, err := Algorithms(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if NoClientAuth {
+		problems = append(problems, "SSH_IFY_NO_CLIENT_AUTH lets clients in without credentials")
+	}
+	if MaxAuthTries < 0 {
+		problems = append(problems, "SSH_IFY_MAX_AUTH_TRIES allows unlimited authentication attempts")
+	}
+	if AuthTimeout <= 0 {
+		problems = append(problems, "SSH_IFY_SSH_AUTH_TIMEOUT is disabled")
+	}
+	if data, err := os.ReadFile(HostKeyPath); err == nil {
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			if _, err := hardenHostKey(signer); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if UserCAFile != "" {
+		if err := checkAuthorities(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkAuthorities checks the strength of the keys in UserCAFile.
+func checkAuthorities() error {
+	authorities, err := LoadUserAuthorities(UserCAFile)
+	if err != nil {
+		return err
+	}
+	for _, authority := range authorities {
+		if err := CheckPublicKeyStrength("user CA key "+ssh.FingerprintSHA256(authority), authority); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckPublicKeyStrength returns an error if key, the public key of what, is weaker than
+// hardened mode allows.
+func CheckPublicKeyStrength(what string, key ssh.PublicKey) error {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	if key, ok := key.(ssh.CryptoPublicKey); ok {
+		return config.CheckKeyStrength(what, key.CryptoPublicKey())
+	}
+	return nil
+}
+
+// hardenHostKey checks the strength of the host key and restricts it to the signature
+// algorithms of hardened mode.
+func hardenHostKey(signer ssh.Signer) (ssh.Signer, error) {
+	if err := CheckPublicKeyStrength("host key", signer.PublicKey()); err != nil {
+		return nil, err
+	}
+	keyType := signer.PublicKey().Type()
+	if keyType != ssh.KeyAlgoRSA {
+		if !slices.Contains(hardenedPublicKeyAlgorithms, keyType) {
+			return nil, fmt.Errorf("host key type %s is not allowed in hardened mode", keyType)
+		}
+		return signer, nil
+	}
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("host key cannot sign with SHA-2")
+	}
+	return ssh.NewSignerWithAlgorithms(algorithmSigner, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256})
+}
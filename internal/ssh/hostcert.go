@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostCertPath is the OpenSSH host certificate for the host key, offered to clients in
+// addition to the plain key when the file exists. It is read from SSH_IFY_HOST_CERT and
+// defaults to the OpenSSH naming convention next to the host key.
+var HostCertPath = config.Env("SSH_IFY_HOST_CERT", HostKeyPath+"-cert.pub")
+
+// HostKeySource returns the host key the server signs with. It is LoadHostKey unless
+// the key is held by another process, such as the privilege separation supervisor.
+var HostKeySource = LoadHostKey
+
+// LoadHostKey returns the SSH host key, generating and saving a new one if HostKeyPath
+// does not exist.
+func LoadHostKey() (ssh.Signer, error) {
+	// Try to read existing host key from disk.
+	privateBytes, err := os.ReadFile(HostKeyPath)
+	if err != nil {
+		// If not found, generate a new RSA key and save it.
+		privateKey, err := NewRSAPrivateKey(4096)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate private key: %v", err)
+		}
+		privateBytes = RSAPrivateKeyPEM(privateKey)
+		if err := os.WriteFile(HostKeyPath, privateBytes, 0600); err != nil {
+			return nil, fmt.Errorf("failed to save generated host key: %v", err)
+		}
+	}
+	// Parse the PEM-encoded private key for SSH server use.
+	private, err := ssh.ParsePrivateKey(privateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host key: %v", err)
+	}
+	return private, nil
+}
+
+// LoadHostCert reads the host certificate at HostCertPath and checks that it is a
+// currently valid host certificate for key. It returns nil without error if the file
+// does not exist.
+func LoadHostCert(key ssh.Signer) (*ssh.Certificate, error) {
+	data, err := os.ReadFile(HostCertPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host certificate: %v", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host certificate %s: %v", HostCertPath, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.HostCert {
+		return nil, fmt.Errorf("%s is not a host certificate", HostCertPath)
+	}
+	if !bytes.Equal(cert.Key.Marshal(), key.PublicKey().Marshal()) {
+		return nil, fmt.Errorf("host certificate %s does not certify the host key %s", HostCertPath, HostKeyPath)
+	}
+	now := uint64(time.Now().Unix())
+	if now < cert.ValidAfter || (cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore) {
+		return nil, fmt.Errorf("host certificate %s is not valid now", HostCertPath)
+	}
+	return cert, nil
+}
+
+// HostPublicKey returns the host public key in authorized_keys format, ready to be signed
+// with "ssh-keygen -s <ca> -h". The host key is generated if it does not exist yet.
+func HostPublicKey() ([]byte, error) {
+	key, err := LoadHostKey()
+	if err != nil {
+		return nil, err
+	}
+	return ssh.MarshalAuthorizedKey(key.PublicKey()), nil
+}
@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/alert"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	bansIssued = metrics.NewCounter("ssh_ify_bans_total",
+		"Client IPs banned after repeated failed logins.")
+	sessionLimitRejections = metrics.NewCounter("ssh_ify_session_limit_rejections_total",
+		"Authenticated connections closed because the user reached the concurrent session limit.")
+	accountThrottles = metrics.NewCounter("ssh_ify_account_throttles_total",
+		"Password attempts delayed because their account had recent failed logins.")
+	accountLocks = metrics.NewCounter("ssh_ify_account_locks_total",
+		"Accounts locked after repeated failed logins.")
+	forwardLimitRejections = metrics.NewCounter("ssh_ify_forward_limit_rejections_total",
+		"Port forwarding channels rejected because their connection had too many open.")
+	sessionDurationClosures = metrics.NewCounter("ssh_ify_session_duration_closures_total",
+		"Connections closed because they reached the maximum session duration.")
+)
+
+// clientBanned reports whether the client of meta is banned. Store errors are logged and
+// do not ban the client.
+func clientBanned(meta ssh.ConnMetadata) bool {
+	banned, err := limits.Shared().Banned(limits.IP(meta.RemoteAddr()))
+	if err != nil {
+		logf(meta, "Limits: failed to check ban of %s: %v", meta.RemoteAddr(), err)
+	}
+	return banned
+}
+
+// recordLoginFailure counts a failed login from the client of meta and bans the client
+// once it reaches limits.BanThreshold failures within limits.BanWindow.
+func recordLoginFailure(meta ssh.ConnMetadata) {
+	if limits.BanThreshold.Load() <= 0 {
+		return
+	}
+	store := limits.Shared()
+	ip := limits.IP(meta.RemoteAddr())
+	n, err := store.AddFailure(ip, limits.BanWindow)
+	if err != nil {
+		logf(meta, "Limits: failed to record login failure of %s: %v", ip, err)
+		return
+	}
+	if n < limits.BanThreshold.Load() {
+		return
+	}
+	if err := store.Ban(ip, limits.BanDuration.Load()); err != nil {
+		logf(meta, "Limits: failed to ban %s: %v", ip, err)
+		return
+	}
+	store.ResetFailures(ip)
+	bansIssued.Inc()
+	logf(meta, "Limits: banned %s for %s after %d failed logins", ip, limits.BanDuration, n)
+}
+
+// recordLoginSuccess forgets the failed logins of the client of meta.
+func recordLoginSuccess(meta ssh.ConnMetadata) {
+	if limits.BanThreshold.Load() <= 0 {
+		return
+	}
+	if err := limits.Shared().ResetFailures(limits.IP(meta.RemoteAddr())); err != nil {
+		logf(meta, "Limits: failed to reset login failures of %s: %v", meta.RemoteAddr(), err)
+	}
+}
+
+// throttleAccount delays a password attempt for the user of meta according to the
+// account's recent failed logins, independent of the client IP, so that credential
+// stuffing spread over many IPs slows down too.
+func throttleAccount(meta ssh.ConnMetadata) {
+	if limits.AccountThrottleDelay <= 0 {
+		return
+	}
+	n, err := limits.Shared().Failures(limits.AccountKey(meta.User()), limits.AccountThrottleWindow)
+	if err != nil {
+		logf(meta, "Limits: failed to check login failures of user '%s': %v", meta.User(), err)
+		return
+	}
+	delay := limits.ThrottleDelay(n)
+	if delay <= 0 {
+		return
+	}
+	accountThrottles.Inc()
+	logf(meta, "Limits: delaying password attempt for user '%s' by %s after %d failed logins", meta.User(), delay, n)
+	time.Sleep(delay)
+}
+
+// trackAccountFailures reports whether failed password attempts are counted per account.
+func trackAccountFailures() bool {
+	return limits.AccountThrottleDelay > 0 || limits.AccountLockThreshold > 0
+}
+
+// recordAccountFailure counts a failed password attempt for the user of meta and locks
+// the account once it reaches limits.AccountLockThreshold failures.
+func recordAccountFailure(meta ssh.ConnMetadata) {
+	if !trackAccountFailures() {
+		return
+	}
+	store := limits.Shared()
+	key := limits.AccountKey(meta.User())
+	n, err := store.AddFailure(key, limits.AccountThrottleWindow)
+	if err != nil {
+		logf(meta, "Limits: failed to record login failure of user '%s': %v", meta.User(), err)
+		return
+	}
+	if limits.AccountLockThreshold <= 0 || n < limits.AccountLockThreshold {
+		return
+	}
+	if _, err := userDB.GetUserInfo(meta.User()); err != nil {
+		// Unknown usernames have no account to lock.
+		return
+	}
+	reason := fmt.Sprintf("%d failed logins within %s, the last from %s", n, limits.AccountThrottleWindow, limits.IP(meta.RemoteAddr()))
+	lock, locked, err := userDB.LockUser(meta.User(), reason, limits.AccountLockDuration)
+	if err != nil {
+		logf(meta, "Limits: failed to lock user '%s': %v", meta.User(), err)
+		return
+	}
+	if !locked {
+		return
+	}
+	store.ResetFailures(key)
+	accountLocks.Inc()
+	logf(meta, "Limits: locked user '%s': %s", meta.User(), reason)
+	alert.Send("account_locked", "User '%s' was locked after %s (%s)", meta.User(), reason, untilText(lock))
+}
+
+// untilText describes when lock ends.
+func untilText(lock *usermgmt.Lock) string {
+	if lock.Until.IsZero() {
+		return "until unlocked with ssh-ify unlock-user"
+	}
+	return "until " + lock.Until.Format(time.RFC3339)
+}
+
+// recordAccountSuccess forgets the failed password attempts of the user of meta.
+func recordAccountSuccess(meta ssh.ConnMetadata) {
+	if !trackAccountFailures() {
+		return
+	}
+	if err := limits.Shared().ResetFailures(limits.AccountKey(meta.User())); err != nil {
+		logf(meta, "Limits: failed to reset login failures of user '%s': %v", meta.User(), err)
+	}
+}
+
+// acquireSession counts a session of the authenticated user of meta and reports whether
+// it is within SessionLimit. When it is, release must be called once the
+// session ends. Store errors are logged and admit the session uncounted.
+func acquireSession(meta ssh.ConnMetadata) (release func(), ok bool) {
+	store := limits.Shared()
+	limit := SessionLimit(meta.User())
+	ok, err := store.AcquireSession(meta.User(), limit)
+	if err != nil {
+		logf(meta, "Limits: failed to count session of user '%s': %v", meta.User(), err)
+		return func() {}, true
+	}
+	if !ok {
+		sessionLimitRejections.Inc()
+		logf(meta, "Limits: user '%s' reached the limit of %d concurrent sessions", meta.User(), limit)
+		return nil, false
+	}
+	return func() {
+		if err := store.ReleaseSession(meta.User()); err != nil {
+			logf(meta, "Limits: failed to release session of user '%s': %v", meta.User(), err)
+		}
+	}, true
+}
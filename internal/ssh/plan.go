@@ -0,0 +1,52 @@
+package ssh
+
+import (
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+)
+
+// CheckForward decides whether user, connected from the IP client, may connect to
+// host:port and records the decision. The rules of the user's plan are checked first,
+// then the forwarding policy.
+func CheckForward(user, client, host string, port int) policy.Decision {
+	decision := ExplainForward(user, host, port)
+	policy.Record(user, client, host, port, decision)
+	return decision
+}
+
+// ExplainForward decides like CheckForward without recording the decision, for dry runs
+// such as "ssh-ify policy test".
+func ExplainForward(user, host string, port int) policy.Decision {
+	if userDB != nil {
+		if plan := userDB.PlanOf(user); plan != nil {
+			if decision, ok := plan.CheckForward(user, host, port); ok {
+				return decision
+			}
+		}
+	}
+	return policy.Shared().Check(user, host, port)
+}
+
+// SessionLimit returns the number of concurrent sessions user may have: the limit of the
+// user's plan if it sets one, otherwise limits.MaxSessionsPerUser.
+func SessionLimit(user string) int {
+	if userDB != nil {
+		if plan := userDB.PlanOf(user); plan != nil && plan.MaxSessions > 0 {
+			return plan.MaxSessions
+		}
+	}
+	return limits.MaxSessionsPerUser.Load()
+}
+
+// SessionDurationLimit returns how long a connection of user may last: the limit of the
+// user's plan if it sets one, otherwise limits.MaxSessionDuration. Zero means unlimited.
+func SessionDurationLimit(user string) time.Duration {
+	if userDB != nil {
+		if plan := userDB.PlanOf(user); plan != nil && plan.SessionDuration() > 0 {
+			return plan.SessionDuration()
+		}
+	}
+	return limits.MaxSessionDuration.Load()
+}
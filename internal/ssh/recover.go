@@ -0,0 +1,44 @@
+package ssh
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// panicsRecovered counts panics recovered in session goroutines, by goroutine kind.
+var panicsRecovered = metrics.NewCounterVec("ssh_ify_panics_recovered_total",
+	"Panics recovered in per-session goroutines; each closed only its own session.", "goroutine")
+
+// RecoverPanic stops a panic in the calling goroutine from crashing the server. It logs
+// the panic with a stack trace, counts it under where and calls cleanup, which should
+// close the affected session. It must be deferred directly:
+//
+//	defer ssh.RecoverPanic("relay", sessionID, sess.Close)
+func RecoverPanic(where, sessionID string, cleanup func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	panicsRecovered.Inc(where)
+	prefix := ""
+	if sessionID != "" {
+		prefix = "[session " + sessionID + "] "
+	}
+	log.Printf("%sRecovered panic in %s goroutine, closing session: %v\n%s", prefix, where, r, debug.Stack())
+	if cleanup != nil {
+		cleanup()
+	}
+}
+
+// closeConn returns a cleanup function closing the SSH connection of meta, if meta is one.
+func closeConn(meta ssh.ConnMetadata) func() {
+	return func() {
+		if conn, ok := meta.(ssh.Conn); ok {
+			conn.Close()
+		}
+	}
+}
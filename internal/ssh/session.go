@@ -0,0 +1,183 @@
+package ssh
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Constants
+const (
+	// SessionChannelType is the channel type clients open for shells, commands and agent forwarding.
+	SessionChannelType = "session"
+
+	// AgentRequestType is the session request a client sends to ask for agent forwarding.
+	AgentRequestType = "auth-agent-req@openssh.com"
+
+	// NoticeRequestType is the global request carrying notices to clients, such as an
+	// upcoming disconnection. Clients that do not know it ignore it.
+	NoticeRequestType = "notice@ssh-ify"
+)
+
+// RequestAction is the way a session request is answered.
+type RequestAction int
+
+// Session request actions
+const (
+	// RequestDeny replies with a failure.
+	RequestDeny RequestAction = iota
+	// RequestAcknowledge replies with success without acting on the request. For
+	// agent forwarding this keeps clients that treat a refusal as fatal working
+	// while granting no agent access.
+	RequestAcknowledge
+)
+
+// String returns the action name.
+func (a RequestAction) String() string {
+	if a == RequestAcknowledge {
+		return "acknowledge"
+	}
+	return "deny"
+}
+
+// ParseRequestAction converts an action name into a RequestAction, defaulting to RequestDeny.
+func ParseRequestAction(name string) RequestAction {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "acknowledge", "accept", "allow":
+		return RequestAcknowledge
+	default:
+		return RequestDeny
+	}
+}
+
+// RequestPolicy describes how one session request type is answered.
+type RequestPolicy struct {
+	Action  RequestAction // Reply sent to the client
+	Message string        // Text written to the channel's stderr, if non-empty
+	Log     bool          // Whether the attempt is logged
+	Close   bool          // Whether the channel is closed after a denial
+}
+
+// SessionPolicy maps session request types (exec, shell, x11-req, ...) to their policy.
+// Request types not present are denied silently.
+type SessionPolicy map[string]RequestPolicy
+
+// DefaultDenyMessage is written to clients that ask for a shell, command or subsystem.
+// It can be overridden with SSH_IFY_DENY_MESSAGE.
+var DefaultDenyMessage = config.Env("SSH_IFY_DENY_MESSAGE",
+	"This server only provides port forwarding; shells, commands and subsystems are disabled.")
+
+// DefaultSessionPolicy is the session policy used by NewConnHandler. Agent forwarding
+// is controlled by SSH_IFY_AGENT_FORWARDING ("deny" or "acknowledge").
+var DefaultSessionPolicy = SessionPolicy{
+	"shell":     {Action: RequestDeny, Message: DefaultDenyMessage, Log: true, Close: true},
+	"exec":      {Action: RequestDeny, Message: DefaultDenyMessage, Log: true, Close: true},
+	"subsystem": {Action: RequestDeny, Message: DefaultDenyMessage, Log: true, Close: true},
+	"x11-req":   {Action: RequestDeny, Message: "X11 forwarding is disabled on this server.", Log: true},
+	AgentRequestType: {
+		Action: ParseRequestAction(config.Env("SSH_IFY_AGENT_FORWARDING", "deny")),
+		Log:    true,
+	},
+	// Terminal setup that precedes a shell is harmless and acknowledged quietly.
+	"pty-req":       {Action: RequestAcknowledge},
+	"env":           {Action: RequestAcknowledge},
+	"window-change": {Action: RequestAcknowledge},
+}
+
+// openSessionChannels holds the session channels currently open on any connection, with
+// the connection they belong to.
+var openSessionChannels sync.Map // map[ssh.Channel]ssh.ConnMetadata
+
+// Broadcast writes message to the stderr of every open session channel, e.g. to warn
+// users of an upcoming shutdown, and returns the number of channels it was written to.
+// Clients that only forward ports have no session channel and do not see it.
+func Broadcast(message string) int {
+	n := 0
+	openSessionChannels.Range(func(key, value any) bool {
+		if _, err := key.(ssh.Channel).Stderr().Write([]byte(message + "\r\n")); err == nil {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// notify sends message to the client of conn, both as a NoticeRequestType global request
+// and on the stderr of the connection's session channels, and returns the number of
+// channels it was written to.
+func notify(conn ssh.Conn, message string) int {
+	conn.SendRequest(NoticeRequestType, false, ssh.Marshal(struct{ Message string }{message}))
+	n := 0
+	openSessionChannels.Range(func(key, value any) bool {
+		if value == any(conn) {
+			if _, err := key.(ssh.Channel).Stderr().Write([]byte(message + "\r\n")); err == nil {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
+
+// isSessionChannel reports whether the SSH channel is of type "session".
+func isSessionChannel(newChannel ssh.NewChannel) bool {
+	return newChannel.ChannelType() == SessionChannelType
+}
+
+// handleSessionChannel accepts a session channel and answers its requests per policy.
+// No shell or command is ever run; the channel only exists so clients that open a
+// session alongside their forwards are not disconnected.
+func (h *ConnHandler) handleSessionChannel(meta ssh.ConnMetadata, newChannel ssh.NewChannel) {
+	defer RecoverPanic("session channel", SessionID(meta), closeConn(meta))
+	ch, reqs, err := newChannel.Accept()
+	if err != nil {
+		logf(meta, "HandleChannels: Error accepting session channel: %v", err)
+		return
+	}
+	defer ch.Close()
+	openSessionChannels.Store(ch, meta)
+	defer openSessionChannels.Delete(ch)
+
+	for req := range reqs {
+		policy, known := h.SessionPolicy[req.Type]
+		if policy.Log {
+			logf(meta, "SessionPolicy: user '%s' from %s requested %s%s: %s",
+				meta.User(), meta.RemoteAddr(), req.Type, describeRequest(req), policy.Action)
+		} else if !known {
+			logf(meta, "SessionPolicy: user '%s' sent unsupported session request %s", meta.User(), req.Type)
+		}
+
+		if policy.Message != "" {
+			ch.Stderr().Write([]byte(policy.Message + "\r\n"))
+		}
+		if req.WantReply {
+			req.Reply(policy.Action == RequestAcknowledge, nil)
+		}
+		if policy.Action == RequestDeny && policy.Close {
+			// Report a failed exit so clients terminate with an error instead of hanging.
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+			return
+		}
+	}
+}
+
+// describeRequest returns a short description of the request payload for logging.
+func describeRequest(req *ssh.Request) string {
+	switch req.Type {
+	case "exec":
+		var payload struct{ Command string }
+		if ssh.Unmarshal(req.Payload, &payload) == nil {
+			return " (" + strconv.Quote(payload.Command) + ")"
+		}
+	case "subsystem":
+		var payload struct{ Name string }
+		if ssh.Unmarshal(req.Payload, &payload) == nil {
+			return " (" + strconv.Quote(payload.Name) + ")"
+		}
+	}
+	return ""
+}
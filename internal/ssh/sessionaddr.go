@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"crypto/x509"
+	"log"
+	"net"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SessionAddr is the remote address of an SSH connection served over an in-process
+// pipe. It carries the tunnel session ID and the real client address so that
+// authentication callbacks and logs can identify the session.
+type SessionAddr struct {
+	ID     string   // Tunnel session ID
+	Client net.Addr // Address of the client connected to the tunnel
+
+	ClientCert *x509.Certificate // Verified TLS client certificate, if the client sent one
+	NoBanner   bool              // Whether the listener the client connected to sends no SSH banner
+	Probe      bool              // Whether the connection is the doctor's in-process loopback probe
+}
+
+// ProbeUser is the username the doctor's loopback probe logs in as. Its logins are
+// rejected without counting towards client bans or account lockouts.
+const ProbeUser = "ssh-ify-doctor"
+
+// Network returns the network of the client address.
+func (a SessionAddr) Network() string {
+	return a.Client.Network()
+}
+
+// String returns the client address.
+func (a SessionAddr) String() string {
+	return a.Client.String()
+}
+
+// sessionConn is a net.Conn whose RemoteAddr reports a SessionAddr.
+type sessionConn struct {
+	net.Conn
+	remote SessionAddr
+}
+
+// RemoteAddr returns the session address.
+func (c *sessionConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// NewSessionConn wraps conn so that its RemoteAddr reports the given session address.
+func NewSessionConn(conn net.Conn, addr SessionAddr) net.Conn {
+	return &sessionConn{Conn: conn, remote: addr}
+}
+
+// SessionID returns the tunnel session ID of an SSH connection, or "" if it was not
+// served through a session conn.
+func SessionID(meta ssh.ConnMetadata) string {
+	if addr, ok := meta.RemoteAddr().(SessionAddr); ok {
+		return addr.ID
+	}
+	return ""
+}
+
+// isProbe reports whether meta is the doctor's loopback probe logging in as ProbeUser.
+// Remote clients cannot set SessionAddr.Probe, so claiming the username is not enough.
+func isProbe(meta ssh.ConnMetadata) bool {
+	addr, ok := meta.RemoteAddr().(SessionAddr)
+	return ok && addr.Probe && meta.User() == ProbeUser
+}
+
+// logf logs a message prefixed with the tunnel session ID of meta, if known.
+func logf(meta ssh.ConnMetadata, format string, args ...any) {
+	if id := SessionID(meta); id != "" {
+		format = "[session " + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// sampledLogf is logf for high-frequency messages of the given kind, which are sampled
+// as logsample.Printf does.
+func sampledLogf(kind string, meta ssh.ConnMetadata, format string, args ...any) {
+	if id := SessionID(meta); id != "" {
+		format = "[session " + id + "] " + format
+	}
+	logsample.Printf(kind, format, args...)
+}
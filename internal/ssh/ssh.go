@@ -2,19 +2,33 @@
 package ssh
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/binary"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ayanrajpoot10/ssh-ify/internal/bufpool"
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/connpool"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/keepalive"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/relay"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sockopt"
+	"github.com/ayanrajpoot10/ssh-ify/internal/upstream"
 	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
 
 	"golang.org/x/crypto/ssh"
@@ -25,30 +39,86 @@ const (
 	// SSHBufferPoolSize is the size of each buffer in the SSH pool (32KB)
 	// Optimized for SSH channel data transfer
 	SSHBufferPoolSize = 32 * 1024
+
+	// ScheduleCheckInterval is how often established connections are checked against
+	// the user's login schedule.
+	ScheduleCheckInterval = 30 * time.Second
+
+	// HostKeyPath is the file the SSH host key is loaded from, or generated into if missing.
+	HostKeyPath = "host_key"
 )
 
 // Type aliases
 // ServerConfig is a type alias for ssh.ServerConfig.
 type ServerConfig = ssh.ServerConfig
 
+// Interfaces
+// Dialer opens outbound connections for forwarded channels.
+// *net.Dialer satisfies this interface.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// ConnHandler serves SSH connections. Its dependencies are injected so that
+// forwarding behavior can be exercised without real network access or wall-clock time.
+type ConnHandler struct {
+	Config *ssh.ServerConfig // SSH server configuration used for the handshake
+	Dialer Dialer            // Dialer used to reach direct-tcpip targets
+	Clock  clock.Clock       // Time source for durations and deadlines
+
+	SessionPolicy SessionPolicy // How requests on session channels (exec, shell, ...) are answered
+
+	HandshakeFailed func(err error)             // Called, if set, when the handshake or authentication fails
+	ChannelOpened   func(target string)         // Called, if set, with host:port when a forward is accepted
+	Diagnostics     func() TransportDiagnostics // Called, if set, for the transport part of diagnostics reports
+}
+
 // Global variables
 var (
 	// Global user database instance
 	userDB *usermgmt.UserDB
 
-	// sshBufferPool is a pool of reusable byte slices for SSH I/O operations
-	sshBufferPool = sync.Pool{
-		New: func() interface{} {
-			buf := make([]byte, SSHBufferPoolSize)
-			return &buf
-		},
+	// ForwardPoolSize is the number of spare connections kept open to each frequently
+	// forwarded-to destination, read from SSH_IFY_FORWARD_POOL_SIZE. Zero, the default,
+	// disables pooling.
+	ForwardPoolSize = config.EnvInt("SSH_IFY_FORWARD_POOL_SIZE", 0)
+
+	// ForwardPoolIdleTimeout is how long spare connections are kept unused, read from
+	// SSH_IFY_FORWARD_POOL_IDLE_TIMEOUT.
+	ForwardPoolIdleTimeout = config.EnvDuration("SSH_IFY_FORWARD_POOL_IDLE_TIMEOUT", 30*time.Second)
+
+	// ForwardSocketOptions are applied to the connections DefaultDialer opens, so that
+	// forwarded traffic can leave through one WAN or VRF of a multi-homed server. The
+	// interface or VRF device is read from SSH_IFY_FORWARD_INTERFACE and the firewall mark
+	// from SSH_IFY_FORWARD_MARK; by default neither is set.
+	ForwardSocketOptions = sockopt.Options{
+		Interface: config.Env("SSH_IFY_FORWARD_INTERFACE", ""),
+		Mark:      config.EnvInt("SSH_IFY_FORWARD_MARK", 0),
 	}
+
+	// DefaultDialer is the Dialer used when a ConnHandler does not specify one. It resolves
+	// names with the forwarding resolver and keeps spare connections to popular
+	// destinations when ForwardPoolSize is set.
+	DefaultDialer = newDefaultDialer()
+
+	// sshBufferPool is a pool of reusable byte slices for SSH I/O operations
+	sshBufferPool = bufpool.New("ssh", SSHBufferPoolSize)
 )
 
+// newDefaultDialer returns a net.Dialer using the forwarding resolver and
+// ForwardSocketOptions, wrapped in a connection pool if pooling is enabled.
+func newDefaultDialer() Dialer {
+	dialer := &net.Dialer{Resolver: forwardResolver, Control: ForwardSocketOptions.Control()}
+	if ForwardPoolSize > 0 {
+		return connpool.New(dialer, ForwardPoolSize, ForwardPoolIdleTimeout)
+	}
+	return dialer
+}
+
 // Buffer pool functions
 // getSSHBuffer retrieves a buffer from the SSH pool
 func getSSHBuffer() *[]byte {
-	return sshBufferPool.Get().(*[]byte)
+	return sshBufferPool.Get()
 }
 
 // putSSHBuffer returns a buffer to the SSH pool for reuse
@@ -56,11 +126,22 @@ func putSSHBuffer(buf *[]byte) {
 	sshBufferPool.Put(buf)
 }
 
-// CopyWithSSHBuffer performs buffered copying using a pooled buffer.
-func CopyWithSSHBuffer(dst io.Writer, src io.Reader) (int64, error) {
+// BuffersInUse returns the number of SSH buffers currently checked out of the pool.
+func BuffersInUse() int64 {
+	return sshBufferPool.InUse()
+}
+
+// BufferPoolStats returns a snapshot of the use of the SSH buffer pool.
+func BufferPoolStats() bufpool.Stats {
+	return sshBufferPool.Stats()
+}
+
+// CopyWithSSHBuffer copies src to dst with a pooled buffer until src is exhausted,
+// either side fails or ctx is cancelled, passing the bytes read to report as it goes.
+func CopyWithSSHBuffer(ctx context.Context, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error) {
 	buf := getSSHBuffer()
 	defer putSSHBuffer(buf)
-	return io.CopyBuffer(dst, src, *buf)
+	return relay.Copy(ctx, dst, src, *buf, report)
 }
 
 // Authentication functions
@@ -78,20 +159,46 @@ func GetUserDB() *usermgmt.UserDB {
 // PasswordAuth implements ssh.PasswordCallback for authentication.
 func PasswordAuth(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 	if userDB == nil {
-		log.Printf("PasswordAuth: user database not initialized")
+		logf(c, "PasswordAuth: user database not initialized")
 		return nil, fmt.Errorf("user database not initialized")
 	}
 
+	// The doctor's probe only checks the key exchange; its login is expected to fail.
+	if isProbe(c) {
+		logf(c, "PasswordAuth: rejected doctor probe login as '%s'", c.User())
+		return nil, fmt.Errorf("%w: invalid credentials", ErrAuthFailed)
+	}
+
+	if clientBanned(c) {
+		sampledLogf(logsample.Banned, c, "PasswordAuth: rejected login for user '%s' from banned client %s", c.User(), c.RemoteAddr())
+		return nil, fmt.Errorf("%w: client banned", ErrPolicyDenied)
+	}
+
+	throttleAccount(c)
 	success := userDB.Authenticate(c.User(), string(password))
+	if success && ClientCertAuth == ClientCertRequired && !clientCertMatches(c) {
+		logf(c, "PasswordAuth: user '%s' from %s did not present a mapped client certificate", c.User(), c.RemoteAddr())
+		return nil, fmt.Errorf("%w: client certificate required", ErrPolicyDenied)
+	}
 	if success {
-		log.Printf("PasswordAuth: successful login for user '%s'", c.User())
+		logf(c, "PasswordAuth: successful login for user '%s' from %s", c.User(), c.RemoteAddr())
+		recordLoginSuccess(c)
+		recordAccountSuccess(c)
 		return nil, nil
 	} else {
-		log.Printf("PasswordAuth: failed login attempt for user '%s'", c.User())
-		return nil, fmt.Errorf("invalid credentials")
+		sampledLogf(logsample.LoginFailed, c, "PasswordAuth: failed login attempt for user '%s' from %s", c.User(), c.RemoteAddr())
+		recordLoginFailure(c)
+		recordAccountFailure(c)
+		return nil, fmt.Errorf("%w: invalid credentials", ErrAuthFailed)
 	}
 }
 
+// IsAuthError reports whether err from the SSH handshake means the client failed to authenticate.
+func IsAuthError(err error) bool {
+	var authErr *ssh.ServerAuthError
+	return errors.Is(err, ErrAuthFailed) || errors.As(err, &authErr)
+}
+
 // Key generation functions
 // NewRSAPrivateKey generates a new RSA private key.
 func NewRSAPrivateKey(bitSize int) (*rsa.PrivateKey, error) {
@@ -130,57 +237,120 @@ func NewConfig() (*ssh.ServerConfig, error) {
 		}
 	}
 
-	keyPath := "host_key"
-	// Try to read existing host key from disk.
-	privateBytes, err := os.ReadFile(keyPath)
+	private, err := HostKeySource()
 	if err != nil {
-		// If not found, generate a new RSA key and save it.
-		privateKey, err := NewRSAPrivateKey(4096)
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate private key: %v", err)
-		}
-		privateBytes = RSAPrivateKeyPEM(privateKey)
-		if err := os.WriteFile(keyPath, privateBytes, 0600); err != nil {
-			return nil, fmt.Errorf("failed to save generated host key: %v", err)
-		}
+		return nil, err
 	}
-	// Parse the PEM-encoded private key for SSH server use.
-	private, err := ssh.ParsePrivateKey(privateBytes)
+	hostCert, err := LoadHostCert(private)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse host key: %v", err)
+		return nil, err
+	}
+	banner, err := newBannerCallback(BannerFile, BannerText, BannerPolicy, BannerSkipClients)
+	if err != nil {
+		return nil, err
+	}
+	algorithms, err := Algorithms()
+	if err != nil {
+		return nil, err
+	}
+	// In hardened mode the host key signs with SHA-2 only.
+	hardened := config.Hardened
+	if hardened {
+		if private, err = hardenHostKey(private); err != nil {
+			return nil, err
+		}
 	}
 	// Set up server config with password authentication.
 	config := &ssh.ServerConfig{
 		PasswordCallback: PasswordAuth,
-		BannerCallback: func(conn ssh.ConnMetadata) string {
-			return "Welcome to ssh-ify.\n"
-		},
+		BannerCallback:   banner,
+		MaxAuthTries:     MaxAuthTries,
+	}
+	config.KeyExchanges = algorithms.KeyExchanges
+	config.Ciphers = algorithms.Ciphers
+	config.MACs = algorithms.MACs
+	if hardened {
+		config.PublicKeyAuthAlgorithms = hardenedPublicKeyAlgorithms
+	}
+
+	// Accept OpenSSH user certificates signed by a trusted CA.
+	if UserCAFile != "" {
+		authorities, err := LoadUserAuthorities(UserCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.PublicKeyCallback = NewUserCertAuth(authorities)
+	}
+
+	// Let a mapped TLS client certificate stand in for the password.
+	if ClientCertAuth == ClientCertSufficient {
+		config.NoClientAuth = true
+		config.NoClientAuthCallback = ClientCertAuthCallback
 	}
 
+	// Let clients without credentials in under names that are not registered users.
+	if NoClientAuth {
+		config.NoClientAuth = true
+		config.NoClientAuthCallback = withNoClientAuth(config.NoClientAuthCallback)
+	}
+
+	// Run the configured keyboard-interactive challenges.
+	if KeyboardInteractiveChallenges != "" {
+		list, err := ParseChallenges(KeyboardInteractiveChallenges)
+		if err != nil {
+			return nil, err
+		}
+		if err := configureKeyboardInteractive(config, list); err != nil {
+			return nil, err
+		}
+	}
+
+	// Refuse clients whose version the allow and deny lists exclude, before any credential
+	// is checked.
+	restrictClientVersions(config)
+
 	// Set custom SSH version banner
 	config.ServerVersion = "SSH-2.0-ssh-ify_1.0"
 
 	config.AddHostKey(private)
+	if hostCert != nil {
+		// Clients that trust the host CA verify the certificate instead of the plain key.
+		certSigner, err := ssh.NewCertSigner(hostCert, private)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use host certificate: %v", err)
+		}
+		config.AddHostKey(certSigner)
+	}
 	return config, nil
 }
 
 // Channel handling functions
-// ForwardData relays data bidirectionally between an SSH channel and a target connection.
-func ForwardData(ch ssh.Channel, targetConn net.Conn, addr string) {
+// ForwardData relays data bidirectionally between an SSH channel and a target connection
+// until both directions end or ctx is cancelled.
+func ForwardData(ctx context.Context, meta ssh.ConnMetadata, ch ssh.Channel, targetConn net.Conn, addr string) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		_, err := CopyWithSSHBuffer(targetConn, ch)
-		if err != nil && err != io.EOF {
-			log.Printf("forwardChannel: Error copying SSH->%s: %v", addr, err)
+		defer RecoverPanic("forward", SessionID(meta), closeConn(meta))
+		_, err := CopyWithSSHBuffer(ctx, targetConn, ch, nil)
+		if err != nil && err != io.EOF && err != ctx.Err() {
+			sampledLogf(logsample.CopyError, meta, "forwardChannel: Error copying SSH->%s: %v", addr, err)
+		}
+		// Pass the client's EOF on so that the target can finish its side.
+		if cw, ok := targetConn.(interface{ CloseWrite() error }); ok && err == nil {
+			cw.CloseWrite()
 		}
 	}()
 	go func() {
 		defer wg.Done()
-		_, err := CopyWithSSHBuffer(ch, targetConn)
-		if err != nil && err != io.EOF {
-			log.Printf("forwardChannel: Error copying %s->SSH: %v", addr, err)
+		defer RecoverPanic("forward", SessionID(meta), closeConn(meta))
+		_, err := CopyWithSSHBuffer(ctx, ch, targetConn, nil)
+		if err != nil && err != io.EOF && err != ctx.Err() {
+			sampledLogf(logsample.CopyError, meta, "forwardChannel: Error copying %s->SSH: %v", addr, err)
+		}
+		if err == nil {
+			ch.CloseWrite()
 		}
 	}()
 	wg.Wait()
@@ -189,12 +359,62 @@ func ForwardData(ch ssh.Channel, targetConn net.Conn, addr string) {
 	ch.Close()
 }
 
-// HandleSSHChannels processes incoming SSH channels for port forwarding.
-func HandleSSHChannels(chans <-chan ssh.NewChannel) {
+// NewConnHandler returns a ConnHandler using the default dialer and the system clock.
+func NewConnHandler(config *ssh.ServerConfig) *ConnHandler {
+	return &ConnHandler{
+		Config: config,
+		Dialer: DefaultDialer,
+		Clock:  clock.Real{},
+
+		SessionPolicy: DefaultSessionPolicy,
+	}
+}
+
+// forwardLimitReached reports whether n open channels exceed
+// limits.MaxForwardsPerConnection.
+func forwardLimitReached(n int32) bool {
+	limit := limits.MaxForwardsPerConnection.Load()
+	return limit > 0 && n > int32(limit)
+}
+
+// HandleSSHChannels processes incoming SSH channels for port forwarding. Forwards are
+// aborted when ctx is cancelled, and at most limits.MaxForwardsPerConnection may be open
+// at once.
+func (h *ConnHandler) HandleSSHChannels(ctx context.Context, meta ssh.ConnMetadata, chans <-chan ssh.NewChannel) {
+	var forwards atomic.Int32 // Forwarding and diagnostics channels currently open
+	start := h.Clock.Now()
 	for newChannel := range chans {
 		// Step 1: Validate channel type
+		if isSessionChannel(newChannel) {
+			if !sessionsAllowed(meta) {
+				logf(meta, "HandleChannels: user '%s' opened a session channel after no-more-sessions", meta.User())
+				newChannel.Reject(ssh.Prohibited, "no more sessions")
+				continue
+			}
+			go h.handleSessionChannel(meta, newChannel)
+			continue
+		}
+		if DiagChannel && newChannel.ChannelType() == DiagChannelType {
+			if forwardLimitReached(forwards.Add(1)) {
+				forwards.Add(-1)
+				forwardLimitRejections.Inc()
+				newChannel.Reject(ssh.ResourceShortage, "too many open channels")
+				continue
+			}
+			ch, reqs, err := newChannel.Accept()
+			if err != nil {
+				forwards.Add(-1)
+				logf(meta, "HandleChannels: Error accepting channel: %v", err)
+				continue
+			}
+			go func() {
+				defer forwards.Add(-1)
+				h.handleDiagChannel(ctx, meta, ch, reqs, start, &forwards)
+			}()
+			continue
+		}
 		if !isDirectTCPIPChannel(newChannel) {
-			log.Printf("HandleChannels: Unknown channel type: %s", newChannel.ChannelType())
+			logf(meta, "HandleChannels: Unknown channel type: %s", newChannel.ChannelType())
 			newChannel.Reject(ssh.UnknownChannelType, "only port forwarding allowed")
 			continue
 		}
@@ -202,21 +422,59 @@ func HandleSSHChannels(chans <-chan ssh.NewChannel) {
 		// Step 2: Parse direct-tcpip extra data
 		targetHost, targetPort, err := parseDirectTCPIPExtra(newChannel.ExtraData())
 		if err != nil {
-			log.Printf("HandleChannels: %v", err)
+			logf(meta, "HandleChannels: %v", err)
 			newChannel.Reject(ssh.Prohibited, err.Error())
 			continue
 		}
 
-		// Step 3: Accept the channel
+		// Step 3: Check the destination against the forwarding policy
+		if !forwardingPermitted(meta) {
+			logf(meta, "HandleChannels: certificate of user '%s' does not permit port forwarding", meta.User())
+			newChannel.Reject(ssh.Prohibited, "port forwarding not permitted")
+			continue
+		}
+		decision := CheckForward(meta.User(), limits.IP(meta.RemoteAddr()), targetHost, int(targetPort))
+		if !decision.Allowed {
+			logf(meta, "HandleChannels: user '%s' denied forwarding to %s by %s", meta.User(),
+				net.JoinHostPort(targetHost, strconv.Itoa(int(targetPort))), decision.Rule)
+			newChannel.Reject(ssh.Prohibited, "destination not allowed")
+			continue
+		}
+		if decision.Via == nil {
+			// Connections through an upstream reach the upstream's network, not ours.
+			if err := checkTargetHost(targetHost, int(targetPort)); err != nil {
+				logf(meta, "HandleChannels: user '%s' denied forwarding: %v", meta.User(), err)
+				newChannel.Reject(ssh.Prohibited, "destination not allowed")
+				continue
+			}
+		}
+
+		// Step 4: Enforce the per-connection forward limit
+		if forwardLimitReached(forwards.Add(1)) {
+			forwards.Add(-1)
+			forwardLimitRejections.Inc()
+			logf(meta, "HandleChannels: user '%s' reached the limit of %d open forwards", meta.User(), limits.MaxForwardsPerConnection.Load())
+			newChannel.Reject(ssh.ResourceShortage, "too many open forwards")
+			continue
+		}
+
+		// Step 5: Accept the channel
 		ch, reqs, err := newChannel.Accept()
 		if err != nil {
-			log.Printf("HandleChannels: Error accepting channel: %v", err)
+			forwards.Add(-1)
+			logf(meta, "HandleChannels: Error accepting channel: %v", err)
 			continue
 		}
 		go ssh.DiscardRequests(reqs)
+		if h.ChannelOpened != nil {
+			h.ChannelOpened(net.JoinHostPort(targetHost, strconv.Itoa(int(targetPort))))
+		}
 
-		// Step 4: Handle forwarding in a goroutine
-		go handlePortForwarding(targetHost, targetPort, ch)
+		// Step 6: Handle forwarding in a goroutine
+		go func() {
+			defer forwards.Add(-1)
+			h.handlePortForwarding(ctx, meta, targetHost, targetPort, decision.Via, ch)
+		}()
 	}
 }
 
@@ -225,53 +483,245 @@ func isDirectTCPIPChannel(newChannel ssh.NewChannel) bool {
 	return newChannel.ChannelType() == "direct-tcpip"
 }
 
-// parseDirectTCPIPExtra extracts target host and port from direct-tcpip extra data.
+// parseDirectTCPIPExtra extracts target host and port from direct-tcpip extra data,
+// rejecting hosts longer than MaxTargetHostLength and ports outside 1-65535.
 func parseDirectTCPIPExtra(extra []byte) (string, uint32, error) {
 	if len(extra) < 4 {
 		return "", 0, fmt.Errorf("invalid direct-tcpip request: insufficient data for host length")
 	}
-	l := int(binary.BigEndian.Uint32(extra[:4]))
+	// Compare before converting, as a length above 2^31 turns negative in a 32-bit int.
+	hostLen := binary.BigEndian.Uint32(extra[:4])
+	if hostLen > uint32(MaxTargetHostLength) {
+		return "", 0, fmt.Errorf("invalid direct-tcpip request: host of %d bytes exceeds %d", hostLen, MaxTargetHostLength)
+	}
+	l := int(hostLen)
 	if len(extra) < 4+l+4 {
 		return "", 0, fmt.Errorf("invalid direct-tcpip request: insufficient data for host and port")
 	}
 	targetHost := string(extra[4 : 4+l])
 	portOffset := 4 + l
 	targetPort := binary.BigEndian.Uint32(extra[portOffset : portOffset+4])
+	if targetPort == 0 || targetPort > 65535 {
+		return "", 0, fmt.Errorf("invalid direct-tcpip request: port %d out of range", targetPort)
+	}
 	return targetHost, targetPort, nil
 }
 
-// handlePortForwarding establishes a TCP connection to the target and relays data.
-func handlePortForwarding(targetHost string, targetPort uint32, ch ssh.Channel) {
+// handlePortForwarding establishes a TCP connection to the target, through via if it is
+// not nil, and relays data.
+func (h *ConnHandler) handlePortForwarding(ctx context.Context, meta ssh.ConnMetadata, targetHost string, targetPort uint32, via *upstream.Upstream, ch ssh.Channel) {
+	defer RecoverPanic("forward", SessionID(meta), closeConn(meta))
 	defer ch.Close()
 	addr := net.JoinHostPort(targetHost, strconv.Itoa(int(targetPort)))
-	targetConn, err := net.Dial("tcp", addr)
+	if via != nil {
+		logf(meta, "HandleChannels: Connecting to %s via upstream %s", addr, via.Name())
+	}
+	targetConn, err := h.dialTarget(ctx, targetHost, int(targetPort), via)
 	if err != nil {
-		log.Printf("HandleChannels: Error connecting to target %s: %v", addr, err)
+		logf(meta, "HandleChannels: %v", err)
 		return
 	}
-	ForwardData(ch, targetConn, addr)
+	start := h.Clock.Now()
+	ForwardData(ctx, meta, ch, targetConn, addr)
+	logf(meta, "HandleChannels: Forwarding to %s finished after %s", addr, h.Clock.Now().Sub(start))
+}
+
+// dialTarget connects to a forwarding target with the handler's dialer and clock, as
+// DialTarget does.
+func (h *ConnHandler) dialTarget(ctx context.Context, host string, port int, via *upstream.Upstream) (net.Conn, error) {
+	return DialTarget(ctx, h.Dialer, h.Clock, host, port, via)
+}
+
+// DialTarget connects to a forwarding target with dialer, through via if it is not nil,
+// wrapping failures with ErrTargetUnreachable. Every transport that forwards for clients
+// dials through it. Targets dialed directly are refused with ErrPolicyDenied if they name
+// or resolve to one of the server's own ports, or to a private address unless private
+// targets are allowed, and are dialed with Happy Eyeballs across their addresses.
+func DialTarget(ctx context.Context, dialer Dialer, clk clock.Clock, host string, port int, via *upstream.Upstream) (net.Conn, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	var conn net.Conn
+	var err error
+	if via == nil {
+		if checkErr := checkTargetHost(host, port); checkErr != nil {
+			return nil, checkErr
+		}
+		ips, resolveErr := resolveTarget(ctx, host, port)
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		conn, err = dialAddresses(ctx, dialer, clk, ips, port)
+	} else {
+		conn, err = via.Dial(dialer, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrTargetUnreachable, addr, err)
+	}
+	return conn, nil
 }
 
 // Server functions
-// HandleSSHConnection handles an incoming SSH connection.
-func HandleSSHConnection(conn net.Conn, config *ssh.ServerConfig, onAuthSuccess func()) {
+// HandleSSHConnection handles an incoming SSH connection using the default dialer and clock.
+func HandleSSHConnection(conn net.Conn, config *ssh.ServerConfig, onAuthSuccess func(user, clientVersion string)) {
+	NewConnHandler(config).Serve(conn, onAuthSuccess)
+}
+
+// Serve runs the SSH handshake on conn and processes its channels until the connection ends.
+// onAuthSuccess, if set, is called with the authenticated username and the client's
+// version string.
+func (h *ConnHandler) Serve(conn net.Conn, onAuthSuccess func(user, clientVersion string)) {
+	sessionID := ""
+	if addr, ok := conn.RemoteAddr().(SessionAddr); ok {
+		sessionID = addr.ID
+	}
+	defer RecoverPanic("ssh", sessionID, func() { conn.Close() })
+
+	// Reap connections that do not finish the handshake and authentication in time.
+	var authTimer clock.Timer
+	if AuthTimeout > 0 {
+		authTimer = h.Clock.AfterFunc(AuthTimeout, func() {
+			authTimeouts.Inc()
+			conn.Close()
+		})
+	}
+
 	// Accept the incoming SSH connection and extract channels/requests.
-	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, h.Config)
+	if authTimer != nil && !authTimer.Stop() && err == nil {
+		// The timer fired just as authentication succeeded.
+		sshConn.Close()
+		return
+	}
 	if err != nil {
+		if h.HandshakeFailed != nil {
+			h.HandshakeFailed(classifyHandshakeError(err))
+		}
 		// If handshake fails, close connection.
 		conn.Close()
 		return
 	}
 
+	// Enforce the per-user concurrent session limit.
+	release, ok := acquireSession(sshConn)
+	if !ok {
+		sshConn.Close()
+		return
+	}
+	defer release()
+
 	// Call the success callback if provided (authentication was successful)
 	if onAuthSuccess != nil {
-		onAuthSuccess()
+		onAuthSuccess(sshConn.User(), string(sshConn.ClientVersion()))
 	}
 
-	// Discard global requests (not used).
-	go ssh.DiscardRequests(reqs)
-	// Handle port forwarding channels.
-	HandleSSHChannels(chans)
+	// Disconnect the user once their login window closes, their account expires or the
+	// connection reaches its maximum duration.
+	done := make(chan struct{})
+	defer close(done)
+	enforceLimits(h.Clock, boundConn{
+		user:      sshConn.User(),
+		sessionID: SessionID(sshConn),
+		close:     func() { sshConn.Close() },
+		notify:    func(message string) int { return notify(sshConn, message) },
+	}, done)
+
+	// Answer keepalives and other global requests, and send our own to keep NAT
+	// mappings alive and notice vanished clients.
+	go handleGlobalRequests(sshConn, reqs)
+	if keepalive.SSH > 0 {
+		go sendKeepalives(sshConn, h.Clock, keepalive.SSH, done)
+	}
+	// Handle port forwarding channels. Forwards still running when the connection ends
+	// are aborted rather than left waiting for their target to hang up.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.HandleSSHChannels(ctx, sshConn, chans)
 	// Close SSH connection after handling channels.
 	sshConn.Close()
 }
+
+// boundConn is a connection whose lifetime is bound by its user's login schedule, account
+// expiry and maximum session duration.
+type boundConn struct {
+	user      string
+	sessionID string                   // Tunnel session ID, if known
+	close     func()                   // Disconnects the client
+	notify    func(message string) int // Warns the client, returning the channels written to; nil if it cannot be warned
+}
+
+// logf logs a message prefixed with the tunnel session ID of c, if known.
+func (c boundConn) logf(format string, args ...any) {
+	if c.sessionID != "" {
+		format = "[session " + c.sessionID + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// EnforceLimits disconnects a connection of user that does not carry SSH, such as a raw
+// forward, once the user's login window closes, their account expires or the connection
+// reaches its maximum duration, as Serve does for SSH connections. close is called to
+// disconnect the client. The checks stop when done is closed.
+func EnforceLimits(clk clock.Clock, user, sessionID string, close func(), done <-chan struct{}) {
+	enforceLimits(clk, boundConn{user: user, sessionID: sessionID, close: close}, done)
+}
+
+// enforceLimits starts the schedule and duration checks of c, which stop when done is
+// closed.
+func enforceLimits(clk clock.Clock, c boundConn, done <-chan struct{}) {
+	go enforceSchedule(clk, c, done)
+	if limit := SessionDurationLimit(c.user); limit > 0 {
+		go enforceDuration(clk, c, limit, done)
+	}
+}
+
+// enforceSchedule periodically checks the user's login schedule and closes the
+// connection when it no longer permits the login. It returns when done is closed.
+func enforceSchedule(clk clock.Clock, c boundConn, done <-chan struct{}) {
+	defer RecoverPanic("schedule", c.sessionID, c.close)
+	ticker := clk.NewTicker(ScheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			if userDB == nil || userDB.LoginAllowed(c.user) {
+				continue
+			}
+			c.logf("Schedule: user '%s' is no longer permitted to be logged in, disconnecting", c.user)
+			c.close()
+			return
+		}
+	}
+}
+
+// enforceDuration closes the connection once it has lasted limit, warning the client
+// limits.SessionDurationWarning before if it can be warned. It returns when done is
+// closed.
+func enforceDuration(clk clock.Clock, c boundConn, limit time.Duration, done <-chan struct{}) {
+	defer RecoverPanic("duration", c.sessionID, c.close)
+	deadline := clk.NewTimer(limit)
+	defer deadline.Stop()
+	var warn <-chan time.Time
+	if limits.SessionDurationWarning > 0 && c.notify != nil {
+		warning := clk.NewTimer(max(limit-limits.SessionDurationWarning, 0))
+		defer warning.Stop()
+		warn = warning.C()
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-warn:
+			message := i18n.Sprintf("This session will be closed in %s, having reached the maximum session duration of %s.",
+				min(limits.SessionDurationWarning, limit), limit)
+			n := c.notify(message)
+			c.logf("Duration: warned user '%s' on %d session channels that the connection closes in %s",
+				c.user, n, min(limits.SessionDurationWarning, limit))
+		case <-deadline.C():
+			c.logf("Duration: user '%s' reached the maximum session duration of %s, disconnecting", c.user, limit)
+			sessionDurationClosures.Inc()
+			c.close()
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// directTCPIPExtra encodes the extra data of a direct-tcpip channel request for host:port.
+func directTCPIPExtra(host string, port uint32) []byte {
+	extra := binary.BigEndian.AppendUint32(nil, uint32(len(host)))
+	extra = append(extra, host...)
+	extra = binary.BigEndian.AppendUint32(extra, port)
+	// The originator address and port follow.
+	extra = binary.BigEndian.AppendUint32(extra, 9)
+	extra = append(extra, "127.0.0.1"...)
+	return binary.BigEndian.AppendUint32(extra, 50000)
+}
+
+func FuzzParseDirectTCPIPExtra(f *testing.F) {
+	f.Add(directTCPIPExtra("example.com", 443))
+	f.Add(directTCPIPExtra("::1", 22))
+	f.Add(directTCPIPExtra("", 80))
+	f.Add(directTCPIPExtra("example.com", 0))
+	f.Add(directTCPIPExtra("example.com", 65536))
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 80})
+	f.Add([]byte{0, 0, 0, 4, 'h', 'o'})
+	f.Fuzz(func(t *testing.T, extra []byte) {
+		host, port, err := parseDirectTCPIPExtra(extra)
+		if err != nil {
+			return
+		}
+		if len(host) > MaxTargetHostLength {
+			t.Fatalf("accepted host of %d bytes", len(host))
+		}
+		if port == 0 || port > 65535 {
+			t.Fatalf("accepted port %d", port)
+		}
+		if got := binary.BigEndian.Uint32(extra); int(got) != len(host) || string(extra[4:4+got]) != host {
+			t.Fatalf("parsed host %q does not match its encoding", host)
+		}
+	})
+}
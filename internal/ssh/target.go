@@ -0,0 +1,198 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/resolver"
+)
+
+// MaxTargetHostLength is the longest host a direct-tcpip request may name, the maximum
+// length of a DNS name.
+const MaxTargetHostLength = 253
+
+// Target restrictions, read from the environment at startup.
+var (
+	// AllowPrivateTargets permits forwarding to unspecified, loopback, link-local and
+	// private addresses, which are refused by default so that clients cannot reach
+	// services only meant for the host or its network. It is read from
+	// SSH_IFY_ALLOW_PRIVATE_TARGETS.
+	AllowPrivateTargets = config.EnvBool("SSH_IFY_ALLOW_PRIVATE_TARGETS", false)
+
+	// privateTargetExceptions are the host:port destinations that may be forwarded to
+	// although they are private, e.g. "127.0.0.1:7300" for a local UDP gateway. They are
+	// read from SSH_IFY_ALLOWED_PRIVATE_TARGETS, separated by commas.
+	privateTargetExceptions = parseTargetList(config.Env("SSH_IFY_ALLOWED_PRIVATE_TARGETS", ""))
+
+	// ForwardResolver is the DNS over HTTPS URL or tls:// DNS over TLS server that names
+	// of forwarding targets are resolved with, read from SSH_IFY_FORWARD_RESOLVER. Empty,
+	// the default, uses the system resolver.
+	ForwardResolver = config.Env("SSH_IFY_FORWARD_RESOLVER", "")
+
+	// forwardResolver resolves names of forwarding targets.
+	forwardResolver = newForwardResolver(ForwardResolver)
+)
+
+var (
+	// privateTargetRefusals counts forwards refused for naming or resolving to a private address.
+	privateTargetRefusals = metrics.NewCounter("ssh_ify_private_target_refusals_total",
+		"Port forwards refused because their target is a private, loopback or link-local address.")
+	// ownTargetRefusals counts forwards refused for targeting the server itself.
+	ownTargetRefusals = metrics.NewCounter("ssh_ify_own_target_refusals_total",
+		"Port forwards refused because their target is a port the server itself listens on.")
+)
+
+// serverPorts holds the TCP ports the server listens on.
+var serverPorts sync.Map // map[int]struct{}
+
+// AddServerAddr records addr as an address the server listens on. Port forwards to it,
+// on any address of the host, are refused whatever the forwarding policy and the private
+// target settings allow, so that clients cannot reach the admin, metrics or other
+// endpoints of the server through its own tunnels.
+func AddServerAddr(addr net.Addr) {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		AddServerPort(tcpAddr.Port)
+	}
+}
+
+// AddServerPort records port as a TCP port the server listens on, like AddServerAddr,
+// for ports opened by another process of the server.
+func AddServerPort(port int) {
+	serverPorts.Store(port, struct{}{})
+}
+
+// ServerPorts returns the TCP ports the server listens on, in ascending order.
+func ServerPorts() []int {
+	var ports []int
+	serverPorts.Range(func(port, _ any) bool {
+		ports = append(ports, port.(int))
+		return true
+	})
+	sort.Ints(ports)
+	return ports
+}
+
+// serverPort reports whether the server listens on TCP port.
+func serverPort(port int) bool {
+	_, ok := serverPorts.Load(port)
+	return ok
+}
+
+// serverAddress reports whether ip:port is an address the server listens on: one of its
+// ports on a loopback, unspecified or local interface address.
+func serverAddress(ip net.IP, port int) bool {
+	if !serverPort(port) {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		// Refuse rather than risk exposing the server's endpoints.
+		return true
+	}
+	for _, addr := range addrs {
+		if network, ok := addr.(*net.IPNet); ok && network.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newForwardResolver returns the resolver for server, or the system resolver if server
+// is empty. An invalid server yields a resolver that fails every lookup, so that names
+// are not resolved unencrypted instead.
+func newForwardResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	r, err := resolver.New(server)
+	if err != nil {
+		log.Printf("Forwarding resolver disabled, refusing forwards to names: %v", err)
+		return resolver.Failing(err)
+	}
+	return r
+}
+
+// parseTargetList parses a comma-separated list of host:port destinations.
+func parseTargetList(list string) map[string]bool {
+	targets := map[string]bool{}
+	for _, target := range strings.Split(list, ",") {
+		if target = strings.ToLower(strings.TrimSpace(target)); target != "" {
+			targets[target] = true
+		}
+	}
+	return targets
+}
+
+// isPrivateIP reports whether ip is unspecified, loopback, link-local or private.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// privateTargetAllowed reports whether host:port may be forwarded to even if it is private.
+func privateTargetAllowed(host string, port int) bool {
+	return AllowPrivateTargets ||
+		privateTargetExceptions[strings.ToLower(net.JoinHostPort(strings.TrimSuffix(host, "."), strconv.Itoa(port)))]
+}
+
+// checkTargetHost refuses hosts that name the server or a private address outright:
+// localhost and IP literals. Other names are checked once resolved, by resolveTarget.
+func checkTargetHost(host string, port int) error {
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	loopback := name == "localhost" || strings.HasSuffix(name, ".localhost")
+	if ip := net.ParseIP(host); (ip != nil && serverAddress(ip, port)) || (loopback && serverPort(port)) {
+		ownTargetRefusals.Inc()
+		return fmt.Errorf("%w: %s is an address of this server", ErrPolicyDenied, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	if privateTargetAllowed(host, port) {
+		return nil
+	}
+	if loopback {
+		privateTargetRefusals.Inc()
+		return fmt.Errorf("%w: %s is a loopback name", ErrPolicyDenied, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		privateTargetRefusals.Inc()
+		return fmt.Errorf("%w: %s is a private address", ErrPolicyDenied, host)
+	}
+	return nil
+}
+
+// resolveTarget returns the addresses to dial for host:port. Names are resolved here,
+// with the forwarding resolver, and refused if any of their addresses is one of the
+// server's, or private unless private targets are allowed. The addresses returned are
+// dialed so that the name cannot resolve differently in between.
+func resolveTarget(ctx context.Context, host string, port int) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	checkPrivate := !privateTargetAllowed(host, port)
+	ips, err := forwardResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrTargetUnreachable, net.JoinHostPort(host, strconv.Itoa(port)), err)
+	}
+	resolved := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if serverAddress(ip.IP, port) {
+			ownTargetRefusals.Inc()
+			return nil, fmt.Errorf("%w: %s resolves to %s, an address of this server", ErrPolicyDenied, host, ip.IP)
+		}
+		if checkPrivate && isPrivateIP(ip.IP) {
+			privateTargetRefusals.Inc()
+			return nil, fmt.Errorf("%w: %s resolves to private address %s", ErrPolicyDenied, host, ip.IP)
+		}
+		resolved = append(resolved, ip.IP)
+	}
+	return resolved, nil
+}
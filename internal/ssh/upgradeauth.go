@@ -0,0 +1,45 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+)
+
+// upgradeMeta is the ssh.ConnMetadata of credentials sent with an HTTP upgrade request,
+// before any SSH connection exists.
+type upgradeMeta struct {
+	user string
+	addr SessionAddr
+}
+
+func (m upgradeMeta) User() string          { return m.user }
+func (m upgradeMeta) SessionID() []byte     { return []byte(m.addr.ID) }
+func (m upgradeMeta) ClientVersion() []byte { return nil }
+func (m upgradeMeta) ServerVersion() []byte { return nil }
+func (m upgradeMeta) RemoteAddr() net.Addr  { return m.addr }
+func (m upgradeMeta) LocalAddr() net.Addr   { return nil }
+
+// AuthenticateUpgrade checks credentials sent with the HTTP upgrade request of a session,
+// e.g. in an Authorization header. The same rules as PasswordAuth apply, and failures
+// count towards the client's ban.
+func AuthenticateUpgrade(addr SessionAddr, user, password string) error {
+	if GetUserDB() == nil {
+		if err := InitializeAuth(""); err != nil {
+			return err
+		}
+	}
+	_, err := PasswordAuth(upgradeMeta{user: user, addr: addr}, []byte(password))
+	return err
+}
+
+// AuthenticateProxy checks credentials that grant access on their own, without an SSH
+// login: those of WebSocket forwarding, speedtest, CONNECT and SOCKS5 requests. Like
+// AuthenticateUpgrade, except that they are refused with ErrPolicyDenied while
+// keyboard-interactive challenges are configured, as only SSH clients can answer those.
+func AuthenticateProxy(addr SessionAddr, user, password string) error {
+	if KeyboardInteractiveChallenges != "" {
+		logf(upgradeMeta{user: user, addr: addr}, "Auth: refused password-only login for user '%s' from %s: keyboard-interactive challenges are required", user, addr)
+		return fmt.Errorf("%w: keyboard-interactive challenges are required", ErrPolicyDenied)
+	}
+	return AuthenticateUpgrade(addr, user, password)
+}
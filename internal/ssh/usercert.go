@@ -0,0 +1,129 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// UserCAFile lists the OpenSSH certificate authorities trusted to sign user certificates,
+// one public key per line in authorized_keys format. A certificate logs a user in when
+// it names the username among its principals. It is read from SSH_IFY_USER_CA; when
+// empty, public key authentication is disabled.
+var UserCAFile = config.Env("SSH_IFY_USER_CA", "")
+
+// CertKeyIDExtension is set in the permissions of connections authenticated with a user
+// certificate, to the certificate's key ID.
+const CertKeyIDExtension = "key-id@ssh-ify"
+
+// LoadUserAuthorities reads the trusted CA public keys from path.
+func LoadUserAuthorities(path string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user CA file: %v", err)
+	}
+	var authorities []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse user CA file %s: %v", path, err)
+		}
+		authorities = append(authorities, key)
+		data = rest
+	}
+	if len(authorities) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", path)
+	}
+	return authorities, nil
+}
+
+// NewUserCertAuth returns an ssh.ServerConfig.PublicKeyCallback accepting user
+// certificates signed by one of authorities. Certificates must be within their validity
+// window, name the user among their principals and carry no critical options other than
+// source-address, which is enforced. The user must exist and be allowed to log in, and
+// with ClientCertRequired present a mapped TLS client certificate too. Attempts are
+// throttled and counted towards bans and account lockouts like passwords.
+func NewUserCertAuth(authorities []ssh.PublicKey) func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			for _, authority := range authorities {
+				if bytes.Equal(auth.Marshal(), authority.Marshal()) {
+					return true
+				}
+			}
+			return false
+		},
+		SupportedCriticalOptions: []string{"source-address"},
+	}
+
+	return func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
+			return nil, fmt.Errorf("only certificates are accepted")
+		}
+		if clientBanned(c) {
+			logf(c, "UserCertAuth: rejected login for user '%s' from banned client %s", c.User(), c.RemoteAddr())
+			return nil, fmt.Errorf("%w: client banned", ErrPolicyDenied)
+		}
+		throttleAccount(c)
+		perms, err := checker.Authenticate(certMeta{c}, key)
+		if err != nil {
+			logf(c, "UserCertAuth: rejected certificate %q for user '%s' from %s: %v", cert.KeyId, c.User(), c.RemoteAddr(), err)
+			recordLoginFailure(c)
+			recordAccountFailure(c)
+			return nil, fmt.Errorf("%w: %w", ErrAuthFailed, err)
+		}
+		if userDB == nil || !userDB.LoginAllowed(c.User()) {
+			logf(c, "UserCertAuth: user '%s' of certificate %q from %s may not log in", c.User(), cert.KeyId, c.RemoteAddr())
+			recordLoginFailure(c)
+			recordAccountFailure(c)
+			return nil, fmt.Errorf("%w: user may not log in", ErrAuthFailed)
+		}
+		if ClientCertAuth == ClientCertRequired && !clientCertMatches(c) {
+			logf(c, "UserCertAuth: user '%s' of certificate %q from %s did not present a mapped client certificate", c.User(), cert.KeyId, c.RemoteAddr())
+			return nil, fmt.Errorf("%w: client certificate required", ErrPolicyDenied)
+		}
+		logf(c, "UserCertAuth: successful login for user '%s' with certificate %q from %s", c.User(), cert.KeyId, c.RemoteAddr())
+		recordLoginSuccess(c)
+		recordAccountSuccess(c)
+
+		if perms.Extensions == nil {
+			perms.Extensions = make(map[string]string)
+		}
+		perms.Extensions[CertKeyIDExtension] = cert.KeyId
+		return perms, nil
+	}
+}
+
+// certMeta presents the real client address of a session to ssh.CertChecker, which
+// needs a TCP address to enforce the source-address option.
+type certMeta struct {
+	ssh.ConnMetadata
+}
+
+// RemoteAddr returns the client address of the session.
+func (m certMeta) RemoteAddr() net.Addr {
+	if addr, ok := m.ConnMetadata.RemoteAddr().(SessionAddr); ok {
+		return addr.Client
+	}
+	return m.ConnMetadata.RemoteAddr()
+}
+
+// forwardingPermitted reports whether the connection may forward ports. Connections
+// authenticated with a certificate need its permit-port-forwarding extension.
+func forwardingPermitted(meta ssh.ConnMetadata) bool {
+	conn, ok := meta.(*ssh.ServerConn)
+	if !ok || conn.Permissions == nil {
+		return true
+	}
+	if _, isCert := conn.Permissions.Extensions[CertKeyIDExtension]; !isCert {
+		return true
+	}
+	_, permitted := conn.Permissions.Extensions["permit-port-forwarding"]
+	return permitted
+}
@@ -0,0 +1,56 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newCertConfig returns a server configuration accepting user certificates signed by ca.
+func newCertConfig(t *testing.T, ca ssh.Signer) *ssh.ServerConfig {
+	t.Helper()
+	config := &ssh.ServerConfig{PublicKeyCallback: NewUserCertAuth([]ssh.PublicKey{ca.PublicKey()})}
+	config.AddHostKey(newTestSigner(t))
+	return config
+}
+
+func TestUserCertClientCertRequired(t *testing.T) {
+	newTestUserDB(t, "alice", "secret")
+	ca := newTestSigner(t)
+	config := newCertConfig(t, ca)
+
+	if _, err := certLogin(t, config, ca, "alice", ""); err != nil {
+		t.Fatalf("certificate login: %v", err)
+	}
+	previous := ClientCertAuth
+	ClientCertAuth = ClientCertRequired
+	t.Cleanup(func() { ClientCertAuth = previous })
+	if _, err := certLogin(t, config, ca, "alice", ""); err == nil {
+		t.Fatal("certificate login without a TLS client certificate succeeded with client certificates required")
+	}
+}
+
+func TestUserCertFailuresLockAccount(t *testing.T) {
+	newTestUserDB(t, "carol", "secret")
+	previous := limits.AccountLockThreshold
+	limits.AccountLockThreshold = 2
+	t.Cleanup(func() { limits.AccountLockThreshold = previous })
+	ca := newTestSigner(t)
+	config := newCertConfig(t, ca)
+
+	// Certificates from an untrusted CA count as failed logins of the account.
+	untrusted := newTestSigner(t)
+	for range 2 {
+		if _, err := certLogin(t, config, untrusted, "carol", ""); err == nil {
+			t.Fatal("certificate of an untrusted CA was accepted")
+		}
+	}
+	if userDB.LoginAllowed("carol") {
+		t.Fatal("account not locked after failed certificate logins")
+	}
+	if _, err := certLogin(t, config, ca, "carol", ""); err == nil {
+		t.Error("valid certificate logged in to a locked account")
+	}
+}
@@ -0,0 +1,228 @@
+// Package top implements "ssh-ify top", a live terminal dashboard of a running server.
+package top
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/tunnel"
+)
+
+// Constants
+const (
+	// DefaultInterval is how often the dashboard polls the server.
+	DefaultInterval = time.Second
+
+	// HistoryLength is the number of samples shown in the throughput graph.
+	HistoryLength = 60
+
+	// MaxRows is the maximum number of users and sessions listed.
+	MaxRows = 15
+)
+
+// ANSI escape sequences used to redraw the screen.
+const (
+	clearScreen = "\033[H\033[2J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+	bold        = "\033[1m"
+	reset       = "\033[0m"
+)
+
+// sparkLevels are the bar characters of the throughput graph, lowest first.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// userRate is the throughput of one user between two samples.
+type userRate struct {
+	user     string
+	sessions int
+	in, out  float64 // Bytes per second
+}
+
+// Dashboard polls the admin socket and renders the server state.
+type Dashboard struct {
+	client   *http.Client
+	socket   string
+	interval time.Duration
+	out      io.Writer
+
+	prev    *tunnel.ServerStats
+	history []float64 // Server-wide bytes per second, oldest first
+}
+
+// New returns a dashboard reading from the admin socket at socket.
+func New(socket string, interval time.Duration, out io.Writer) *Dashboard {
+	return &Dashboard{
+		client:   tunnel.NewAdminClient(socket),
+		socket:   socket,
+		interval: interval,
+		out:      out,
+	}
+}
+
+// Run redraws the dashboard every interval until interrupted.
+func (d *Dashboard) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprint(d.out, hideCursor)
+	defer fmt.Fprint(d.out, showCursor)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, d.interval)
+		stats, err := tunnel.FetchStats(reqCtx, d.client)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("cannot reach admin socket %s (is the server running?): %v", d.socket, err)
+		}
+		d.render(stats)
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(d.out)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// render draws one frame from stats and remembers it for the next rate calculation.
+func (d *Dashboard) render(stats *tunnel.ServerStats) {
+	var totalRate float64
+	rates := d.userRates(stats)
+	if d.prev != nil {
+		if dt := stats.Time.Sub(d.prev.Time).Seconds(); dt > 0 {
+			totalRate = float64(stats.BytesIn-d.prev.BytesIn+stats.BytesOut-d.prev.BytesOut) / dt
+		}
+	}
+	d.history = append(d.history, totalRate)
+	if len(d.history) > HistoryLength {
+		d.history = d.history[len(d.history)-HistoryLength:]
+	}
+	d.prev = stats
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "%sssh-ify top%s  %s  up %s  (Ctrl+C to quit)\n\n", bold, reset,
+		stats.Time.Format("15:04:05"), stats.Time.Sub(stats.StartedAt).Round(time.Second))
+	fmt.Fprintf(&b, "Sessions: %-6d Pre-auth: %-6d Listeners: %-3d Memory: %-10s Buffers: %-6d Shed: %-6d Tarpit: %d\n",
+		len(stats.Sessions), stats.PreAuth, stats.ListenerCount, accounting.FormatBytes(stats.MemoryInUse),
+		stats.BuffersInUse, stats.SessionsShed, stats.HoneypotHeld)
+	fmt.Fprintf(&b, "Total:    in %s  out %s  now %s/s\n",
+		accounting.FormatBytes(stats.BytesIn), accounting.FormatBytes(stats.BytesOut), formatRate(totalRate))
+	b.WriteString("Pools:   ")
+	for _, pool := range stats.BufferPools {
+		fmt.Fprintf(&b, " %s %.0f%% reused, peak %d;", pool.Name, 100*pool.Reused(), pool.Peak)
+	}
+	fmt.Fprintf(&b, " GC %d cycles, last pause %s, heap %s\n\n",
+		stats.GC.Cycles, stats.GC.LastPause, accounting.FormatBytes(int64(stats.GC.HeapAlloc)))
+
+	fmt.Fprintf(&b, "%sThroughput (last %d samples, peak %s/s)%s\n", bold, len(d.history), formatRate(peak(d.history)), reset)
+	b.WriteString(sparkline(d.history))
+	b.WriteString("\n\n")
+
+	fmt.Fprintf(&b, "%s%-20s %8s %12s %12s%s\n", bold, "User", "Sessions", "In/s", "Out/s", reset)
+	for i, r := range rates {
+		if i == MaxRows {
+			fmt.Fprintf(&b, "... %d more\n", len(rates)-MaxRows)
+			break
+		}
+		fmt.Fprintf(&b, "%-20s %8d %12s %12s\n", r.user, r.sessions, formatRate(r.in), formatRate(r.out))
+	}
+
+	fmt.Fprintf(&b, "\n%s%-26s %-20s %-21s %10s %10s %8s%s\n", bold, "Session", "User", "Client", "In", "Out", "Idle", reset)
+	for i, sess := range stats.Sessions {
+		if i == MaxRows {
+			fmt.Fprintf(&b, "... %d more\n", len(stats.Sessions)-MaxRows)
+			break
+		}
+		fmt.Fprintf(&b, "%-26s %-20s %-21s %10s %10s %8s\n", sess.ID, sess.User, sess.Client,
+			accounting.FormatBytes(sess.BytesIn), accounting.FormatBytes(sess.BytesOut),
+			stats.Time.Sub(sess.LastActivity).Round(time.Second))
+	}
+	fmt.Fprint(d.out, b.String())
+}
+
+// userRates computes per-user throughput since the previous snapshot, highest first.
+// Sessions that were not in the previous snapshot are counted from zero.
+func (d *Dashboard) userRates(stats *tunnel.ServerStats) []userRate {
+	prevBytes := make(map[string][2]int64)
+	dt := 0.0
+	if d.prev != nil {
+		dt = stats.Time.Sub(d.prev.Time).Seconds()
+		for _, sess := range d.prev.Sessions {
+			prevBytes[sess.ID] = [2]int64{sess.BytesIn, sess.BytesOut}
+		}
+	}
+
+	byUser := make(map[string]*userRate)
+	for _, sess := range stats.Sessions {
+		r, ok := byUser[sess.User]
+		if !ok {
+			r = &userRate{user: sess.User}
+			byUser[sess.User] = r
+		}
+		r.sessions++
+		if dt > 0 {
+			prev := prevBytes[sess.ID]
+			r.in += float64(sess.BytesIn-prev[0]) / dt
+			r.out += float64(sess.BytesOut-prev[1]) / dt
+		}
+	}
+
+	rates := make([]userRate, 0, len(byUser))
+	for _, r := range byUser {
+		rates = append(rates, *r)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if ri, rj := rates[i].in+rates[i].out, rates[j].in+rates[j].out; ri != rj {
+			return ri > rj
+		}
+		return rates[i].user < rates[j].user
+	})
+	return rates
+}
+
+// sparkline renders values as a bar graph scaled to the largest value.
+func sparkline(values []float64) string {
+	max := peak(values)
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if max > 0 {
+			level = int(v / max * float64(len(sparkLevels)-1))
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// peak returns the largest value, or zero.
+func peak(values []float64) float64 {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// formatRate formats a byte rate using binary units.
+func formatRate(bytesPerSecond float64) string {
+	return accounting.FormatBytes(int64(bytesPerSecond))
+}
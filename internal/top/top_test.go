@@ -0,0 +1,70 @@
+package top
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/tunnel"
+)
+
+func TestUserRates(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := &Dashboard{}
+	first := &tunnel.ServerStats{Time: start, Sessions: []tunnel.SessionInfo{
+		{ID: "s1", User: "alice", BytesIn: 1000, BytesOut: 2000},
+		{ID: "s2", User: "bob", BytesIn: 500},
+	}}
+	// Without a previous snapshot there are no rates yet.
+	want := []userRate{{user: "alice", sessions: 1}, {user: "bob", sessions: 1}}
+	if got := d.userRates(first); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first rates = %+v, want %+v", got, want)
+	}
+
+	d.prev = first
+	second := &tunnel.ServerStats{Time: start.Add(2 * time.Second), Sessions: []tunnel.SessionInfo{
+		{ID: "s1", User: "alice", BytesIn: 1200, BytesOut: 2200},
+		{ID: "s2", User: "bob", BytesIn: 4500},
+		{ID: "s3", User: "bob", BytesOut: 1000}, // New sessions count from zero
+	}}
+	want = []userRate{
+		{user: "bob", sessions: 2, in: 2000, out: 500},
+		{user: "alice", sessions: 1, in: 100, out: 100},
+	}
+	if got := d.userRates(second); !reflect.DeepEqual(got, want) {
+		t.Errorf("rates = %+v, want %+v", got, want)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 1, 2, 7}); got != "▁▂▃█" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := sparkline([]float64{0, 0}); got != "▁▁" {
+		t.Errorf("sparkline of zeros = %q", got)
+	}
+}
+
+func TestRenderLimitsRows(t *testing.T) {
+	var out strings.Builder
+	d := &Dashboard{out: &out}
+	stats := &tunnel.ServerStats{Time: time.Now()}
+	for i := range MaxRows + 3 {
+		stats.Sessions = append(stats.Sessions, tunnel.SessionInfo{ID: fmt.Sprintf("s%d", i), User: fmt.Sprintf("user%02d", i)})
+	}
+	for range HistoryLength + 5 {
+		d.render(stats)
+	}
+	if len(d.history) != HistoryLength {
+		t.Errorf("history holds %d samples, want %d", len(d.history), HistoryLength)
+	}
+	frame := out.String()[strings.LastIndex(out.String(), clearScreen):]
+	if n := strings.Count(frame, "... 3 more"); n != 2 {
+		t.Errorf("frame lists the remaining users and sessions %d times, want 2:\n%s", n, frame)
+	}
+	if strings.Contains(frame, "user17") {
+		t.Errorf("frame lists more than %d rows:\n%s", MaxRows, frame)
+	}
+}
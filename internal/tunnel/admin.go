@@ -0,0 +1,186 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/bufpool"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// StatsPath is the admin socket endpoint serving a ServerStats snapshot.
+const StatsPath = "/stats"
+
+// SessionInfo describes an active session in a stats snapshot.
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	User          string    `json:"user"`
+	Client        string    `json:"client"`
+	ClientVersion string    `json:"client_version,omitempty"` // SSH client version string, if the session carries SSH
+	Since         time.Time `json:"since"`
+	LastActivity  time.Time `json:"last_activity"`
+	BytesIn       int64     `json:"bytes_in"`
+	BytesOut      int64     `json:"bytes_out"`
+}
+
+// GCStats describes the garbage collector's activity since start.
+type GCStats struct {
+	Cycles      uint32        `json:"cycles"`
+	PauseTotal  time.Duration `json:"pause_total_ns"`
+	LastPause   time.Duration `json:"last_pause_ns"`
+	HeapAlloc   uint64        `json:"heap_alloc"`   // Bytes of allocated heap objects
+	HeapObjects uint64        `json:"heap_objects"` // Number of allocated heap objects
+	Mallocs     uint64        `json:"mallocs"`      // Heap objects allocated since start
+}
+
+// readGCStats returns the garbage collector's activity since start.
+func readGCStats() GCStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return GCStats{
+		Cycles:      m.NumGC,
+		PauseTotal:  time.Duration(m.PauseTotalNs),
+		LastPause:   time.Duration(m.PauseNs[(m.NumGC+255)%256]),
+		HeapAlloc:   m.HeapAlloc,
+		HeapObjects: m.HeapObjects,
+		Mallocs:     m.Mallocs,
+	}
+}
+
+// ServerStats is a point-in-time snapshot of the server served on the admin socket.
+type ServerStats struct {
+	Time          time.Time       `json:"time"`
+	StartedAt     time.Time       `json:"started_at"`
+	BytesIn       int64           `json:"bytes_in"`  // Bytes relayed from clients since start
+	BytesOut      int64           `json:"bytes_out"` // Bytes relayed to clients since start
+	MemoryInUse   int64           `json:"memory_in_use"`
+	BuffersInUse  int64           `json:"buffers_in_use"`
+	BufferPools   []bufpool.Stats `json:"buffer_pools"`
+	GC            GCStats         `json:"gc"`
+	Sessions      []SessionInfo   `json:"sessions"`
+	PreAuth       int             `json:"preauth_sessions"` // Connections that have not authenticated yet
+	SessionsShed  int64           `json:"sessions_shed"`
+	HoneypotHeld  int64           `json:"honeypot_held"`
+	ListenerCount int             `json:"listener_count"`
+	Listeners     []ListenerInfo  `json:"listeners"`
+}
+
+// Stats returns a snapshot of the server and its active sessions, sorted by start time.
+func (s *Server) Stats() ServerStats {
+	stats := ServerStats{
+		Time:         s.clock.Now(),
+		StartedAt:    s.startedAt,
+		BytesIn:      relayedBytesIn.Value(),
+		BytesOut:     relayedBytesOut.Value(),
+		MemoryInUse:  MemoryInUse(),
+		BuffersInUse: BuffersInUse() + ssh.BuffersInUse(),
+		BufferPools:  []bufpool.Stats{BufferPoolStats(), ssh.BufferPoolStats()},
+		GC:           readGCStats(),
+		Sessions:     []SessionInfo{},
+		PreAuth:      s.PreAuthSessions(),
+		SessionsShed: sessionsShed.Value(),
+		HoneypotHeld: tarpitted.Load(),
+		Listeners:    s.listenerInfos(),
+	}
+	s.listeners.Range(func(key, value any) bool {
+		stats.ListenerCount++
+		return true
+	})
+	s.conns.Range(func(key, value any) bool {
+		sess := key.(*Session)
+		sess.authMutex.Lock()
+		info := SessionInfo{ID: sess.sessionID, User: sess.username, ClientVersion: sess.clientVersion, Since: sess.authenticatedAt}
+		sess.authMutex.Unlock()
+		info.Client = sess.client.RemoteAddr().String()
+		info.LastActivity = sess.LastActivity()
+		info.BytesIn, info.BytesOut = sess.Transferred()
+		stats.Sessions = append(stats.Sessions, info)
+		return true
+	})
+	sort.Slice(stats.Sessions, func(i, j int) bool { return stats.Sessions[i].Since.Before(stats.Sessions[j].Since) })
+	return stats
+}
+
+// serveAdminSocket serves the admin endpoints on the local admin socket until the server
+// shuts down. The socket is only accessible to the user running the server.
+func (s *Server) serveAdminSocket() {
+	path, err := config.GetAdminSocketPath()
+	if err != nil {
+		log.Printf("Admin socket disabled: %v", err)
+		return
+	}
+	ln, err := s.listenUnix(path)
+	if err != nil {
+		log.Printf("Admin socket disabled: %v", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	handleControlEndpoints(mux)
+	mux.HandleFunc("GET "+BansPath, handleBans)
+	mux.HandleFunc("DELETE "+BansPath+"/{ip}", handleUnban)
+	mux.HandleFunc("DELETE "+LocksPath+"/{user}", handleUnlock)
+	mux.HandleFunc(MaintenancePath, s.handleMaintenance)
+	mux.HandleFunc("GET "+EventsPath, s.handleEvents)
+	mux.HandleFunc("GET "+AuditPath, handleAudit)
+	mux.HandleFunc("GET "+ListenersPath, s.handleListeners)
+	mux.HandleFunc("PUT "+ListenersPath+"/{name}", s.handleSetListener)
+	mux.HandleFunc("GET "+SettingsPath, handleSettings)
+	mux.HandleFunc("PUT "+SettingsPath+"/{name}", handleSetSetting)
+	mux.HandleFunc("POST "+PolicyReloadPath, handlePolicyReload)
+	mux.HandleFunc(StatsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Stats())
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-s.ctx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Admin socket listening on %s", path)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Admin socket stopped: %v", err)
+	}
+}
+
+// NewAdminClient returns an HTTP client whose requests go to the admin socket at path,
+// whatever host they name.
+func NewAdminClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// FetchStats requests a stats snapshot through an admin socket client.
+func FetchStats(ctx context.Context, client *http.Client) (*ServerStats, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://admin"+StatsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+	var stats ServerStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
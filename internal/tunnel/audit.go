@@ -0,0 +1,121 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+)
+
+// AuditPath is the admin socket endpoint exporting the policy audit log. The query
+// parameters user, ip, destination, since and until filter the records, and format
+// selects AuditFormatJSON, the default, or AuditFormatCSV.
+const AuditPath = "/audit"
+
+// Audit export formats
+const (
+	AuditFormatJSON = "json" // One JSON object per line
+	AuditFormatCSV  = "csv"  // A header row, then one row per record
+)
+
+// auditHeader lists the columns of the CSV export in order.
+var auditHeader = []string{"time", "user", "client", "host", "port", "allowed", "rule", "via"}
+
+// ParseAuditTime parses a time bound of an audit export: an RFC 3339 time, a date in the
+// form "2006-01-02" in the server's local time zone, or a duration meaning that long
+// before now.
+func ParseAuditTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339, YYYY-MM-DD or a duration such as 24h", value)
+}
+
+// handleAudit streams the policy audit records matching the request's filters.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := policy.AuditFilter{
+		User:        query.Get("user"),
+		Client:      query.Get("ip"),
+		Destination: query.Get("destination"),
+	}
+	now := time.Now()
+	for name, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := ParseAuditTime(value, now)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*bound = t
+		}
+	}
+
+	var write func(policy.AuditRecord) error
+	flush := func() error { return nil }
+	switch format := query.Get("format"); format {
+	case "", AuditFormatJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(rec policy.AuditRecord) error { return enc.Encode(rec) }
+	case AuditFormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write(auditHeader)
+		write = func(rec policy.AuditRecord) error {
+			return cw.Write([]string{rec.Time.Format(time.RFC3339Nano), rec.User, rec.Client, rec.Host,
+				strconv.Itoa(rec.Port), strconv.FormatBool(rec.Allowed), rec.Rule, rec.Via})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q (expected json or csv)", format), http.StatusBadRequest)
+		return
+	}
+
+	// The status is sent before the first record, so later errors can only cut the export short.
+	w.WriteHeader(http.StatusOK)
+	if err := policy.NewAuditLog("").Scan(filter, write); err != nil {
+		log.Printf("Audit export stopped: %v", err)
+	}
+	if err := flush(); err != nil {
+		log.Printf("Audit export stopped: %v", err)
+	}
+}
+
+// ExportAudit writes the policy audit records matching query, as described for AuditPath,
+// to w through an admin socket client.
+func ExportAudit(ctx context.Context, client *http.Client, query url.Values, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://admin"+AuditPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("admin socket returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
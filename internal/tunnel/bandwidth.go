@@ -0,0 +1,126 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/relay"
+)
+
+// Bandwidth configuration, read from the environment at startup.
+var (
+	// EgressLimit caps the bytes per second sent to all clients together. It is read
+	// from SSH_IFY_EGRESS_LIMIT, e.g. "10MB"; 0 means unlimited.
+	EgressLimit = config.EnvSize("SSH_IFY_EGRESS_LIMIT", 0)
+
+	// IngressLimit caps the bytes per second received from all clients together. It is
+	// read from SSH_IFY_INGRESS_LIMIT; 0 means unlimited.
+	IngressLimit = config.EnvSize("SSH_IFY_INGRESS_LIMIT", 0)
+
+	// egressBucket and ingressBucket are shared by every session.
+	egressBucket  = newTokenBucket(EgressLimit)
+	ingressBucket = newTokenBucket(IngressLimit)
+
+	// bandwidthThrottled counts reads delayed by the bandwidth cap, by direction.
+	bandwidthThrottled = metrics.NewCounterVec("ssh_ify_bandwidth_throttled_total",
+		"Relay reads delayed to stay within the server-wide bandwidth cap.", "direction")
+)
+
+// tokenBucket is a byte rate limiter. Readers take tokens for what they read and sleep
+// off any debt, so the long-run rate stays at the configured limit however many
+// sessions share the bucket.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64 // Bytes per second; 0 means unlimited
+	tokens float64 // Available bytes; negative while readers are in debt
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket refilling at rate bytes per second.
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), last: time.Now()}
+}
+
+// SetRate changes the bucket's rate; 0 removes the limit.
+func (b *tokenBucket) SetRate(rate int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.rate = float64(rate)
+	b.tokens = 0
+	b.last = time.Now()
+}
+
+// Rate returns the bucket's rate in bytes per second; 0 means unlimited.
+func (b *tokenBucket) Rate() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return int64(b.rate)
+}
+
+// chunk returns how many bytes one read may take, so that no single read runs up a
+// debt of more than a fraction of a second.
+func (b *tokenBucket) chunk() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rate == 0 {
+		return 0
+	}
+	return max(int(b.rate/10), 1024)
+}
+
+// take removes n tokens and returns how long the caller must wait to pay off the debt.
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rate == 0 {
+		return 0
+	}
+	now := time.Now()
+	// Refill, allowing at most one second of burst.
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttledReader limits the rate of reads from r through a shared bucket.
+type throttledReader struct {
+	r      io.Reader
+	bucket *tokenBucket
+	dir    Direction
+}
+
+// Read reads at most one chunk from the underlying reader and waits until the bucket
+// allows the bytes read.
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if chunk := t.bucket.chunk(); chunk > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	if wait := t.bucket.take(n); wait > 0 {
+		bandwidthThrottled.Inc(t.dir.String())
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// limitedRelay is a Relayer enforcing the server-wide bandwidth cap on top of next.
+type limitedRelay struct {
+	next Relayer
+}
+
+// Copy copies src to dst through next, taking tokens from the bucket of dir.
+func (l limitedRelay) Copy(ctx context.Context, dir Direction, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error) {
+	bucket := ingressBucket
+	if dir == TargetToClient {
+		bucket = egressBucket
+	}
+	return l.next.Copy(ctx, dir, dst, &throttledReader{r: src, bucket: bucket, dir: dir}, report)
+}
@@ -0,0 +1,96 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// BansPath is the admin socket endpoint listing bans; DELETE BansPath/{ip} lifts one.
+const BansPath = "/bans"
+
+// bannedConnections counts connections closed because the client IP is banned.
+var bannedConnections = metrics.NewCounter("ssh_ify_banned_connections_total",
+	"Connections closed because the client IP is banned.")
+
+// banned closes the session without a response if the client IP is banned and reports
+// whether it did so. Store errors are logged and let the session through.
+func (s *Session) banned() bool {
+	ip := limits.IP(s.client.RemoteAddr())
+	banned, err := limits.Shared().Banned(ip)
+	if err != nil {
+		log.Printf("[session %s] Failed to check ban of %s: %v", s.sessionID, ip, err)
+		return false
+	}
+	if banned {
+		bannedConnections.Inc()
+		logsample.Printf(logsample.Banned, "[session %s] Client %s is banned, closing connection", s.sessionID, ip)
+	}
+	return banned
+}
+
+// handleBans serves the ban list on the admin socket.
+func handleBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := limits.Shared().Bans()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// handleUnban lifts the ban named in the path on the admin socket.
+func handleUnban(w http.ResponseWriter, r *http.Request) {
+	if err := limits.Shared().Unban(r.PathValue("ip")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FetchBans requests the banned IPs and their expiry through an admin socket client.
+func FetchBans(ctx context.Context, client *http.Client) (map[string]time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://admin"+BansPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+	var bans map[string]time.Time
+	if err := json.NewDecoder(resp.Body).Decode(&bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// Unban lifts the ban of ip through an admin socket client.
+func Unban(ctx context.Context, client *http.Client, ip string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "http://admin"+BansPath+"/"+url.PathEscape(ip), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+	return nil
+}
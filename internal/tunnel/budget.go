@@ -0,0 +1,81 @@
+package tunnel
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// Constants
+const (
+	// SessionOverhead estimates the memory held by a tunneled session besides its relay
+	// buffers: the in-memory pipe, SSH transport state and channel windows.
+	SessionOverhead = 64 * 1024
+
+	// ServiceUnavailableResponse is sent to clients refused because the memory or transfer
+	// budget is exhausted, unless a custom 503 response is configured.
+	ServiceUnavailableResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+		"Retry-After: 30\r\n" +
+		"Content-Length: 0\r\n" +
+		"Connection: close\r\n\r\n"
+)
+
+// MemoryBudget is the maximum number of bytes that sessions may hold in buffers and
+// pipes before new sessions are refused. Zero disables the budget. It is read from
+// SSH_IFY_MEMORY_BUDGET, e.g. "256MB".
+var MemoryBudget = config.EnvSize("SSH_IFY_MEMORY_BUDGET", 0)
+
+// sessionMemory is the total memory accounted to all sessions.
+var sessionMemory atomic.Int64
+
+// Memory budget metrics
+var (
+	memoryInUseGauge = metrics.NewGaugeFunc("ssh_ify_memory_in_use_bytes",
+		"Estimated bytes held by session buffers, pipes and SSH forwarding buffers.",
+		func() float64 { return float64(MemoryInUse()) })
+	sessionsShed = metrics.NewCounter("ssh_ify_sessions_shed_total",
+		"Number of sessions refused because the memory budget was exhausted.")
+)
+
+// MemoryInUse returns the estimated number of bytes held by sessions and SSH forwarding buffers.
+func MemoryInUse() int64 {
+	return sessionMemory.Load() + ssh.BuffersInUse()*ssh.SSHBufferPoolSize
+}
+
+// overBudget reports whether the memory budget is exhausted.
+func overBudget() bool {
+	return MemoryBudget > 0 && MemoryInUse() >= MemoryBudget
+}
+
+// account adds delta bytes to the memory accounted to the session and to the global total.
+func (s *Session) account(delta int64) {
+	s.memory.Add(delta)
+	sessionMemory.Add(delta)
+}
+
+// releaseMemory returns all memory accounted to the session.
+func (s *Session) releaseMemory() {
+	s.account(-s.memory.Load())
+}
+
+// MemoryUsage returns the number of bytes currently accounted to the session.
+func (s *Session) MemoryUsage() int64 {
+	return s.memory.Load()
+}
+
+// shed refuses the session with a 503 response if the memory budget is exhausted and
+// reports whether it did so.
+func (s *Session) shed() bool {
+	if !overBudget() {
+		return false
+	}
+	sessionsShed.Inc()
+	log.Printf("[session %s] Memory budget exhausted (%d of %d bytes), refusing session",
+		s.sessionID, MemoryInUse(), MemoryBudget)
+	s.respond(http.StatusServiceUnavailable)
+	return true
+}
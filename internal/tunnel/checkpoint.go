@@ -0,0 +1,157 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// CheckpointInterval is how often the active sessions are checkpointed.
+const CheckpointInterval = 30 * time.Second
+
+// sessionsRecovered counts sessions recorded from the checkpoints of stopped servers.
+var sessionsRecovered = metrics.NewCounter("ssh_ify_sessions_recovered_total",
+	"Sessions recorded from the checkpoint of a server that stopped unexpectedly.")
+
+// checkpoint is the state of a server's authenticated sessions at one point in time.
+// Each process writes its own checkpoint, named after its PID, so that the processes
+// taking part in an upgrade do not overwrite each other's.
+type checkpoint struct {
+	PID      int           `json:"pid"`
+	Time     time.Time     `json:"time"`
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// checkpointSessions records the usage left in the checkpoints of servers that stopped
+// without recording their sessions, then checkpoints this server's sessions every
+// CheckpointInterval until it shuts down, when its checkpoint is removed.
+func (s *Server) checkpointSessions() {
+	dir, err := config.GetCheckpointsPath()
+	if err == nil {
+		err = os.MkdirAll(dir, 0700)
+	}
+	if err != nil {
+		log.Printf("Session checkpoints disabled: %v", err)
+		return
+	}
+	s.recoverCheckpoints(dir)
+
+	path := filepath.Join(dir, strconv.Itoa(os.Getpid())+".json")
+	ticker := time.NewTicker(CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			// Sessions still open are recorded as they are closed during shutdown.
+			os.Remove(path)
+			return
+		case <-ticker.C:
+		}
+		if err := s.saveCheckpoint(path); err != nil {
+			log.Printf("Failed to checkpoint sessions: %v", err)
+		}
+	}
+}
+
+// saveCheckpoint writes the authenticated sessions of s to path.
+func (s *Server) saveCheckpoint(path string) error {
+	stats := s.Stats()
+	cp := checkpoint{PID: os.Getpid(), Time: stats.Time, Sessions: []SessionInfo{}}
+	for _, info := range stats.Sessions {
+		if info.User != "" {
+			cp.Sessions = append(cp.Sessions, info)
+		}
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// recoverCheckpoints records the sessions in the checkpoints of processes that are no
+// longer running as usage, ending at the time of their checkpoint, and removes the
+// checkpoints. Sessions that were recorded after their checkpoint are skipped.
+func (s *Server) recoverCheckpoints(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Failed to read session checkpoints: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := s.recoverCheckpoint(path); err != nil {
+			log.Printf("Failed to recover sessions from %s: %v", path, err)
+			continue
+		}
+		os.Remove(path)
+	}
+}
+
+// recoverCheckpoint records the sessions in the checkpoint at path.
+func (s *Server) recoverCheckpoint(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return err
+	}
+	if len(cp.Sessions) == 0 || s.usage == nil {
+		return nil
+	}
+
+	from := cp.Time
+	for _, info := range cp.Sessions {
+		if info.Since.Before(from) {
+			from = info.Since
+		}
+	}
+	recorded, err := s.usage.Records(from, time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(recorded))
+	for _, rec := range recorded {
+		seen[rec.SessionID] = true
+	}
+
+	count := 0
+	for _, info := range cp.Sessions {
+		if seen[info.ID] {
+			continue
+		}
+		rec := accounting.Record{
+			SessionID: info.ID,
+			Username:  info.User,
+			Client:    info.Client,
+			Start:     info.Since,
+			End:       cp.Time,
+			BytesIn:   info.BytesIn,
+			BytesOut:  info.BytesOut,
+			Recovered: true,
+		}
+		if err := s.usage.Append(rec); err != nil {
+			return err
+		}
+		count++
+	}
+	sessionsRecovered.Add(int64(count))
+	if count > 0 {
+		log.Printf("Recovered %d sessions of process %d from its checkpoint of %s", count, cp.PID, cp.Time.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
+)
+
+// Cluster publishing constants
+const (
+	// ClusterPublishInterval is how often each node publishes its stats snapshot.
+	ClusterPublishInterval = 10 * time.Second
+
+	// clusterStatsTTL is how long a published snapshot lives. A node that stops
+	// publishing drops out of the cluster view after this long.
+	clusterStatsTTL = 3 * ClusterPublishInterval
+)
+
+// NodeStats is the stats snapshot of one cluster node.
+type NodeStats struct {
+	Node string `json:"node"`
+	ServerStats
+}
+
+// publishClusterStats periodically publishes the server's stats snapshot to the
+// cluster backend until the server shuts down. It does nothing outside cluster mode.
+func (s *Server) publishClusterStats() {
+	client := cluster.Client()
+	if client == nil {
+		return
+	}
+	log.Printf("Cluster mode enabled as node %q", cluster.NodeName)
+
+	ticker := time.NewTicker(ClusterPublishInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.publishStats(client); err != nil {
+			log.Printf("Failed to publish stats to cluster backend: %v", err)
+		}
+		select {
+		case <-s.listenCtx.Done():
+			if s.ctx.Err() == nil {
+				// Draining after an upgrade: the successor publishes for this node.
+				return
+			}
+			// Leave the cluster view immediately instead of waiting for expiry.
+			client.Del(cluster.Key("node:" + cluster.NodeName))
+			client.SRem(cluster.Key("nodes"), cluster.NodeName)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishStats stores one stats snapshot under the node's key.
+func (s *Server) publishStats(client *redis.Client) error {
+	data, err := json.Marshal(s.Stats())
+	if err != nil {
+		return err
+	}
+	if err := client.Set(cluster.Key("node:"+cluster.NodeName), string(data), clusterStatsTTL); err != nil {
+		return err
+	}
+	return client.SAdd(cluster.Key("nodes"), cluster.NodeName)
+}
+
+// FetchClusterStats returns the latest snapshot of every live node, sorted by node
+// name. Nodes whose snapshot has expired are removed from the node set.
+func FetchClusterStats() ([]NodeStats, error) {
+	client := cluster.Client()
+	if client == nil {
+		return nil, fmt.Errorf("cluster mode is not configured (set SSH_IFY_REDIS_URL)")
+	}
+
+	nodes, err := client.SMembers(cluster.Key("nodes"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(nodes)
+
+	all := make([]NodeStats, 0, len(nodes))
+	for _, node := range nodes {
+		data, err := client.Get(cluster.Key("node:" + node))
+		if errors.Is(err, redis.ErrNil) {
+			client.SRem(cluster.Key("nodes"), node)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ns := NodeStats{Node: node}
+		if err := json.Unmarshal([]byte(data), &ns.ServerStats); err != nil {
+			return nil, fmt.Errorf("node %s: %v", node, err)
+		}
+		all = append(all, ns)
+	}
+	return all, nil
+}
+
+// NodeSession is an active session together with the node serving it.
+type NodeSession struct {
+	Node string `json:"node"`
+	SessionInfo
+}
+
+// FetchSessions returns the active sessions of the whole cluster, sorted by start time.
+// Outside cluster mode the sessions of the local server are requested through the admin
+// socket client instead. In cluster mode sessions appear once their node has published
+// its next snapshot, at most ClusterPublishInterval after they start.
+func FetchSessions(ctx context.Context, client *http.Client) ([]NodeSession, error) {
+	if !cluster.Enabled() {
+		stats, err := FetchStats(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		sessions := make([]NodeSession, 0, len(stats.Sessions))
+		for _, info := range stats.Sessions {
+			sessions = append(sessions, NodeSession{Node: cluster.NodeName, SessionInfo: info})
+		}
+		return sessions, nil
+	}
+
+	nodes, err := FetchClusterStats()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []NodeSession
+	for _, ns := range nodes {
+		for _, info := range ns.Sessions {
+			sessions = append(sessions, NodeSession{Node: ns.Node, SessionInfo: info})
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Since.Before(sessions[j].Since) })
+	return sessions, nil
+}
@@ -0,0 +1,48 @@
+package tunnel
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// ConnectEstablishedResponse answers a successful HTTP CONNECT request.
+const ConnectEstablishedResponse = "HTTP/1.1 200 Connection established\r\n\r\n"
+
+// proxyRequests counts HTTP CONNECT and SOCKS requests by protocol and result.
+var proxyRequests = metrics.NewCounterVec("ssh_ify_proxy_requests_total",
+	"Number of HTTP CONNECT and SOCKS proxy requests, by protocol and result.", "protocol", "result")
+
+// ConnectHandler connects a session that sent an authenticated HTTP CONNECT request to
+// target. On success, release must be called once the session has been relayed.
+func ConnectHandler(s *Session, target string) (release func(), ok bool) {
+	release, result, status := s.openForward(s.upgradeUser, target)
+	if release == nil {
+		proxyRequests.Inc("connect", result)
+		s.respond(status)
+		return nil, false
+	}
+	if _, err := s.client.Write([]byte(ConnectEstablishedResponse)); err != nil {
+		log.Printf("[session %s] Failed to write CONNECT response: %v", s.sessionID, err)
+		s.Close()
+		release()
+		return nil, false
+	}
+	proxyRequests.Inc("connect", "forwarded")
+	return s.startForward(s.upgradeUser, target, release), true
+}
+
+// requestFeature returns the listener feature an HTTP request asks for.
+func requestFeature(req *http.Request) string {
+	switch {
+	case req.Method == http.MethodConnect:
+		return FeatureConnect
+	case forwardTarget(req) != "":
+		return FeatureForward
+	case speedtestKind(req) != "":
+		return FeatureSpeedtest
+	default:
+		return FeatureWebSocket
+	}
+}
@@ -0,0 +1,93 @@
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// UnixAddrPrefix marks control addresses that name a Unix socket, e.g.
+// "unix:/run/ssh-ify/metrics.sock".
+const UnixAddrPrefix = "unix:"
+
+// PprofEnabled serves Go profiling endpoints under /debug/pprof/ on the control
+// listeners. It is read from SSH_IFY_PPROF.
+var PprofEnabled = config.EnvBool("SSH_IFY_PPROF", false)
+
+// CheckControlAddr returns an error unless addr may serve control endpoints (the admin
+// API, metrics and profiling): a Unix socket, or a TCP address on the loopback interface.
+func CheckControlAddr(addr string) error {
+	if path, ok := strings.CutPrefix(addr, UnixAddrPrefix); ok {
+		if path == "" {
+			return fmt.Errorf("empty Unix socket path in %q", addr)
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is neither a loopback nor a Unix socket address", addr)
+	}
+	return nil
+}
+
+// listenControl binds a control address, refusing any that CheckControlAddr rejects.
+func (s *Server) listenControl(name, addr string) (net.Listener, error) {
+	if err := CheckControlAddr(addr); err != nil {
+		return nil, err
+	}
+	if path, ok := strings.CutPrefix(addr, UnixAddrPrefix); ok {
+		return s.listenUnix(path)
+	}
+	return s.listen(name, addr)
+}
+
+// listenUnix binds a Unix socket at path that only the user running the server can
+// access. The socket is removed when the server shuts down, unless it was upgraded.
+func (s *Server) listenUnix(path string) (net.Listener, error) {
+	// Remove a socket left behind by a previous run.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		log.Printf("Failed to restrict permissions of %s: %v", path, err)
+	}
+	// After an upgrade the path belongs to the successor, so never unlink it on close.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	go func() {
+		<-s.ctx.Done()
+		if !s.upgraded.Load() {
+			os.Remove(path)
+		}
+	}()
+	return ln, nil
+}
+
+// handleControlEndpoints adds the metrics endpoint and, if enabled, the profiling
+// endpoints to mux.
+func handleControlEndpoints(mux *http.ServeMux) {
+	mux.Handle("GET /metrics", metrics.Default)
+	if PprofEnabled {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+}
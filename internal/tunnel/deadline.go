@@ -0,0 +1,133 @@
+package tunnel
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Idle timeouts by session phase, read from the environment at startup. A session is
+// closed once neither the client nor the target sent anything for the timeout of its
+// current phase; zero disables the timeout of a phase.
+var (
+	// SSHHandshakeIdleTimeout applies to SSH tunnels from the upgrade request until the
+	// user authenticates.
+	SSHHandshakeIdleTimeout = config.EnvTunableDuration("SSH_IFY_SSH_HANDSHAKE_IDLE_TIMEOUT", 30*time.Second)
+
+	// SSHIdleTimeout applies to SSH tunnels once the user authenticated.
+	SSHIdleTimeout = config.EnvTunableDuration("SSH_IFY_SSH_IDLE_TIMEOUT", 15*time.Minute)
+
+	// RelayIdleTimeout applies to relays without an SSH layer: WebSocket forwarding,
+	// CONNECT and SOCKS.
+	RelayIdleTimeout = config.EnvTunableDuration("SSH_IFY_RELAY_IDLE_TIMEOUT", 5*time.Minute)
+)
+
+// idleTimeouts counts sessions closed by the idle timeout of their phase.
+var idleTimeouts = metrics.NewCounterVec("ssh_ify_idle_timeouts_total",
+	"Number of sessions closed for relaying nothing within the idle timeout of their phase.", "phase")
+
+// Phase is a stage of a session with its own idle timeout.
+type Phase int32
+
+// Session phases
+const (
+	// PhaseNone leaves the deadlines of the client to others, such as the request reader
+	// while the upgrade request is read or the poll transports.
+	PhaseNone Phase = iota
+	// PhaseSSHHandshake is an SSH tunnel whose user has not authenticated yet.
+	PhaseSSHHandshake
+	// PhaseSSH is an SSH tunnel whose user authenticated.
+	PhaseSSH
+	// PhaseRelay is a relay without an SSH layer.
+	PhaseRelay
+)
+
+// String returns the name of the phase, as used in metrics.
+func (p Phase) String() string {
+	switch p {
+	case PhaseSSHHandshake:
+		return "ssh_handshake"
+	case PhaseSSH:
+		return "ssh"
+	case PhaseRelay:
+		return "relay"
+	default:
+		return "none"
+	}
+}
+
+// IdleTimeout returns the idle timeout of the phase, or zero for none.
+func (p Phase) IdleTimeout() time.Duration {
+	switch p {
+	case PhaseSSHHandshake:
+		return SSHHandshakeIdleTimeout.Load()
+	case PhaseSSH:
+		return SSHIdleTimeout.Load()
+	case PhaseRelay:
+		return RelayIdleTimeout.Load()
+	default:
+		return 0
+	}
+}
+
+// deadlineManager keeps the read deadline of a session's client the idle timeout of the
+// session's phase ahead of its last activity. Moving the deadline on every read would
+// reset a timer each time, so it is only moved once an eighth of the timeout has passed.
+// The zero value is in PhaseNone.
+type deadlineManager struct {
+	phase atomic.Int32
+	moved atomic.Int64 // UnixNano time the deadline was last moved
+}
+
+// current returns the phase of the session.
+func (d *deadlineManager) current() Phase {
+	return Phase(d.phase.Load())
+}
+
+// enter switches to phase p and moves the deadline of conn to its idle timeout from now.
+func (d *deadlineManager) enter(conn net.Conn, now time.Time, p Phase) {
+	d.phase.Store(int32(p))
+	d.move(conn, now)
+}
+
+// advance switches from phase from to phase to, like enter, and reports whether the
+// session was in phase from.
+func (d *deadlineManager) advance(conn net.Conn, now time.Time, from, to Phase) bool {
+	if !d.phase.CompareAndSwap(int32(from), int32(to)) {
+		return false
+	}
+	d.move(conn, now)
+	return true
+}
+
+// activity records that the session relayed data at now, moving the deadline of conn if
+// it is due.
+func (d *deadlineManager) activity(conn net.Conn, now time.Time) {
+	timeout := d.current().IdleTimeout()
+	if timeout <= 0 || now.Sub(time.Unix(0, d.moved.Load())) < timeout/8 {
+		return
+	}
+	d.move(conn, now)
+}
+
+// move sets the read deadline of conn to the idle timeout of the phase from now, or
+// clears it if the phase has none.
+func (d *deadlineManager) move(conn net.Conn, now time.Time) {
+	d.moved.Store(now.UnixNano())
+	var deadline time.Time
+	if timeout := d.current().IdleTimeout(); timeout > 0 {
+		deadline = now.Add(timeout)
+	}
+	if d.current() != PhaseNone {
+		conn.SetReadDeadline(deadline)
+	}
+}
+
+// enterPhase switches the session to phase p, replacing the client's read deadline with
+// the idle timeout of p.
+func (s *Session) enterPhase(p Phase) {
+	s.deadlines.enter(s.client, s.clock.Now(), p)
+}
@@ -0,0 +1,165 @@
+package tunnel
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// DNS transport configuration, read from the environment at startup. The transport is
+// experimental and disabled unless DNSDomain is set.
+var (
+	// DNSDomain is the zone delegated to this server, e.g. "t.example.com". Queries for
+	// names below it carry tunnel traffic. It is read from SSH_IFY_DNS_DOMAIN.
+	DNSDomain = strings.ToLower(strings.TrimSuffix(config.Env("SSH_IFY_DNS_DOMAIN", ""), "."))
+
+	// DNSAddr is the UDP address the DNS transport listens on. It is read from SSH_IFY_DNS_ADDR.
+	DNSAddr = config.Env("SSH_IFY_DNS_ADDR", ":53")
+
+	// DNSIdleTimeout closes DNS sessions the client has not polled for this long. It is
+	// read from SSH_IFY_DNS_IDLE_TIMEOUT.
+	DNSIdleTimeout = config.EnvDuration("SSH_IFY_DNS_IDLE_TIMEOUT", 2*time.Minute)
+
+	// DNSMaxSessions caps concurrent DNS sessions, which are opened before authentication.
+	// It is read from SSH_IFY_DNS_MAX_SESSIONS.
+	DNSMaxSessions = config.EnvInt("SSH_IFY_DNS_MAX_SESSIONS", 32)
+)
+
+// DNS transport commands, the leftmost label of a query name below DNSDomain:
+//
+//	o.<nonce>.<domain>                     open a session; answered with its ID
+//	d.<id>.<seq>.<base32 data...>.<domain> send data and receive pending data
+//	c.<id>.<domain>                        close a session
+//
+// Upstream data is unpadded base32 split into labels; a data query without data labels
+// polls. Repeating a sequence number repeats the previous answer without resending the
+// data, so retransmitted queries are harmless. Downstream data is base64 in TXT answers
+// or raw in NULL answers.
+const (
+	dnsCommandOpen  = "o"
+	dnsCommandData  = "d"
+	dnsCommandClose = "c"
+)
+
+// dnsEncoding encodes upstream data in case-insensitive DNS labels.
+var dnsEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// dnsQueries counts DNS transport queries by command.
+var dnsQueries = metrics.NewCounterVec("ssh_ify_dns_queries_total",
+	"Number of DNS transport queries, by command.", "command")
+
+// dnsServer answers DNS transport queries.
+type dnsServer struct {
+	sessions *pollSessions
+}
+
+// serveDNS runs the DNS transport until the server stops listening.
+func (s *Server) serveDNS() {
+	if DNSDomain == "" {
+		return
+	}
+	conn, err := net.ListenPacket("udp", DNSAddr)
+	if err != nil {
+		log.Printf("DNS transport disabled: %v", err)
+		return
+	}
+	log.Printf("DNS transport listening on %s for %s (experimental)", DNSAddr, DNSDomain)
+	d := &dnsServer{sessions: newPollSessions(s, "DNS", DNSMaxSessions, DNSIdleTimeout, 4)}
+	go func() {
+		<-s.listenCtx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("DNS transport stopped: %v", err)
+			}
+			return
+		}
+		msg := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer ssh.RecoverPanic("dns", "", nil)
+			if resp := d.handle(msg, addr); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+// handle answers one query, returning nil for packets that are not worth answering.
+func (d *dnsServer) handle(msg []byte, addr net.Addr) []byte {
+	q, err := parseDNSQuery(msg)
+	if err != nil {
+		return nil
+	}
+	name, ok := strings.CutSuffix(q.name, "."+DNSDomain)
+	if !ok || (q.qtype != dnsTypeTXT && q.qtype != dnsTypeNULL) {
+		return q.response(dnsRcodeRefused, nil)
+	}
+	labels := strings.Split(name, ".")
+
+	// The usable answer size depends on the encoding of the record type.
+	capacity := q.answerCapacity()
+	if q.qtype == dnsTypeTXT {
+		capacity = (capacity - 2) / 4 * 3
+	}
+	answer := func(data []byte) []byte {
+		if q.qtype == dnsTypeTXT {
+			return q.response(0, txtRecord(base64.StdEncoding.EncodeToString(data)))
+		}
+		return q.response(0, data)
+	}
+
+	switch labels[0] {
+	case dnsCommandOpen:
+		dnsQueries.Inc("open")
+		id, err := d.sessions.open(addr)
+		if err != nil {
+			log.Printf("DNS transport: refusing session from %s: %v", addr, err)
+			return q.response(dnsRcodeRefused, nil)
+		}
+		return answer([]byte(id))
+
+	case dnsCommandData:
+		dnsQueries.Inc("data")
+		if len(labels) < 3 {
+			return q.response(dnsRcodeFormErr, nil)
+		}
+		data, err := dnsEncoding.DecodeString(strings.ToUpper(strings.Join(labels[3:], "")))
+		if err != nil {
+			return q.response(dnsRcodeFormErr, nil)
+		}
+		sess := d.sessions.lookup(labels[1])
+		if sess == nil {
+			return q.response(dnsRcodeNXDomain, nil)
+		}
+		reply, err := sess.exchange(labels[2], data, capacity)
+		if err != nil {
+			d.sessions.remove(sess.id)
+			return q.response(dnsRcodeNXDomain, nil)
+		}
+		return answer(reply)
+
+	case dnsCommandClose:
+		dnsQueries.Inc("close")
+		if len(labels) >= 2 {
+			d.sessions.remove(labels[1])
+		}
+		return answer(nil)
+
+	default:
+		dnsQueries.Inc("unknown")
+		return q.response(dnsRcodeNXDomain, nil)
+	}
+}
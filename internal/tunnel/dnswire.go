@@ -0,0 +1,108 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// DNS record types and response codes used by the DNS transport.
+const (
+	dnsTypeNULL = 10
+	dnsTypeTXT  = 16
+
+	dnsRcodeFormErr  = 1
+	dnsRcodeNXDomain = 3
+	dnsRcodeRefused  = 5
+
+	// dnsMaxMessage is the largest response sent, the classic UDP limit every resolver accepts.
+	dnsMaxMessage = 512
+)
+
+var errMalformedQuery = errors.New("malformed DNS query")
+
+// dnsQuery is a parsed single-question DNS query.
+type dnsQuery struct {
+	id       uint16
+	flags    uint16
+	name     string // Lower-cased, without the trailing dot
+	qtype    uint16
+	question []byte // Raw question section, echoed in the response
+}
+
+// parseDNSQuery parses a query with exactly one question. Compressed names are refused,
+// as queries never need them.
+func parseDNSQuery(msg []byte) (*dnsQuery, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[4:6]) != 1 || msg[2]&0x80 != 0 {
+		return nil, errMalformedQuery
+	}
+	q := &dnsQuery{id: binary.BigEndian.Uint16(msg[0:2]), flags: binary.BigEndian.Uint16(msg[2:4])}
+
+	var labels []string
+	pos := 12
+	for {
+		if pos >= len(msg) {
+			return nil, errMalformedQuery
+		}
+		n := int(msg[pos])
+		pos++
+		if n == 0 {
+			break
+		}
+		if n > 63 || pos+n > len(msg) {
+			return nil, errMalformedQuery
+		}
+		labels = append(labels, strings.ToLower(string(msg[pos:pos+n])))
+		pos += n
+	}
+	if pos+4 > len(msg) {
+		return nil, errMalformedQuery
+	}
+	q.name = strings.Join(labels, ".")
+	q.qtype = binary.BigEndian.Uint16(msg[pos : pos+2])
+	q.question = msg[12 : pos+4]
+	return q, nil
+}
+
+// response builds a response to q. A nil answer sends no answer record.
+func (q *dnsQuery) response(rcode int, answer []byte) []byte {
+	// QR and AA set, opcode and RD copied from the query.
+	flags := 0x8400 | q.flags&0x7900 | uint16(rcode)
+	msg := make([]byte, 12, dnsMaxMessage)
+	binary.BigEndian.PutUint16(msg[0:2], q.id)
+	binary.BigEndian.PutUint16(msg[2:4], flags)
+	binary.BigEndian.PutUint16(msg[4:6], 1)
+	msg = append(msg, q.question...)
+	if answer == nil {
+		return msg
+	}
+	binary.BigEndian.PutUint16(msg[6:8], 1)
+	msg = append(msg, 0xc0, 12) // Pointer to the question name
+	msg = binary.BigEndian.AppendUint16(msg, q.qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // Class IN
+	msg = binary.BigEndian.AppendUint32(msg, 0) // TTL 0 so resolvers do not cache
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(answer)))
+	return append(msg, answer...)
+}
+
+// answerCapacity returns how many bytes of record data fit in a response to q.
+func (q *dnsQuery) answerCapacity() int {
+	return dnsMaxMessage - 12 - len(q.question) - 12
+}
+
+// txtRecord encodes text as TXT record data of character strings of at most 255 bytes.
+func txtRecord(text string) []byte {
+	record := []byte{}
+	for {
+		chunk := text
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		record = append(record, byte(len(chunk)))
+		record = append(record, chunk...)
+		text = text[len(chunk):]
+		if text == "" {
+			return record
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// roundTrip writes size random bytes to conn and checks that the same bytes come back.
+func roundTrip(t *testing.T, conn net.Conn, size int) {
+	t.Helper()
+	sent := make([]byte, size)
+	rand.Read(sent)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(sent)
+		errs <- err
+	}()
+	received := make([]byte, size)
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatalf("reading echoed data: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("writing data: %v", err)
+	}
+	if !bytes.Equal(sent, received) {
+		t.Fatal("echoed data differs from the data sent")
+	}
+}
+
+func TestTunnelDataIntegrity(t *testing.T) {
+	h := newHarness(t)
+	client := h.login()
+
+	targets := []string{"203.0.113.7:80", "203.0.113.8:443", "[2001:db8::1]:22", "198.51.100.1:8080"}
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := client.Dial("tcp", target)
+			if err != nil {
+				t.Errorf("forwarding to %s: %v", target, err)
+				return
+			}
+			defer conn.Close()
+			roundTrip(t, conn, 1<<20)
+		}()
+	}
+	wg.Wait()
+
+	dialed := h.upstream.Dialed()
+	for _, target := range targets {
+		if !slices.Contains(dialed, target) {
+			t.Errorf("upstream was not dialed for %s, dialed %v", target, dialed)
+		}
+	}
+}
+
+func TestAuthFailures(t *testing.T) {
+	h := newHarness(t)
+	tests := []struct{ name, user, password string }{
+		{"wrong password", harnessUser, "wrong"},
+		{"empty password", harnessUser, ""},
+		{"unknown user", "mallory", harnessPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := h.sshClient(tt.user, tt.password)
+			if err == nil {
+				client.Close()
+				t.Fatalf("login as %q succeeded", tt.user)
+			}
+			if !isAuthFailure(err) {
+				t.Fatalf("login error = %v, want an authentication failure", err)
+			}
+		})
+	}
+	// Failed logins leave the account usable.
+	h.login()
+}
+
+func TestPolicyRejections(t *testing.T) {
+	h := newHarness(t)
+	client := h.login()
+	for _, target := range []string{"127.0.0.1:22", "10.0.0.1:80", "[::1]:22", "192.168.1.1:443", "localhost:80"} {
+		if conn, err := client.Dial("tcp", target); err == nil {
+			conn.Close()
+			t.Errorf("forwarding to private target %s was allowed", target)
+		}
+	}
+	if dialed := h.upstream.Dialed(); len(dialed) > 0 {
+		t.Errorf("upstream was dialed for refused targets: %v", dialed)
+	}
+	// The connection survives refused forwards.
+	conn, err := client.Dial("tcp", "203.0.113.7:80")
+	if err != nil {
+		t.Fatalf("forwarding after refused targets: %v", err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn, 4096)
+}
+
+func TestListenerFeatureRejection(t *testing.T) {
+	h := newHarness(t, FeatureConnect)
+	if resp, _ := h.upgrade(h.dial()); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("WebSocket upgrade on a CONNECT-only listener got status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestShutdownClosesSessions(t *testing.T) {
+	h := newHarness(t)
+	client := h.login()
+	conn, err := client.Dial("tcp", "203.0.113.7:80")
+	if err != nil {
+		t.Fatalf("forwarding: %v", err)
+	}
+	roundTrip(t, conn, 4096)
+
+	h.shutdown()
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.Wait() }()
+	select {
+	case <-closed:
+	case <-time.After(harnessTimeout):
+		t.Fatal("client connection still open after shutdown")
+	}
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Error("forwarded channel still writable after shutdown")
+	}
+	if _, err := h.listener.Dial(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("dialing after shutdown: error = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestProbeLoginNotCounted(t *testing.T) {
+	if err := config.SetTunable("SSH_IFY_BAN_THRESHOLD", "1"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.SetTunable("SSH_IFY_BAN_THRESHOLD", "0") })
+	h := newHarness(t)
+
+	// The doctor's probe fails to log in without banning its client.
+	probe := &net.TCPAddr{IP: net.IPv4(198, 51, 100, 9), Port: 40000}
+	clientEnd, serverEnd := net.Pipe()
+	go h.server.ServeProbe(addrConn{Conn: serverEnd, local: h.listener.Addr(), remote: probe})
+	clientEnd.SetDeadline(time.Now().Add(harnessTimeout))
+	t.Cleanup(func() { clientEnd.Close() })
+	resp, conn := h.upgrade(addrConn{Conn: clientEnd, local: probe, remote: h.listener.Addr()})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("probe upgrade response status %d, want 101", resp.StatusCode)
+	}
+	if _, err := h.handshake(conn, ssh.ProbeUser, ""); !isAuthFailure(err) {
+		t.Fatalf("probe login error = %v, want an authentication failure", err)
+	}
+	if banned, _ := limits.Shared().Banned(limits.IP(probe)); banned {
+		t.Error("probe login banned its client")
+	}
+
+	// Remote clients claiming the probe's name are counted as usual.
+	raw := h.dial()
+	resp, conn = h.upgrade(raw)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade response status %d, want 101", resp.StatusCode)
+	}
+	if _, err := h.handshake(conn, ssh.ProbeUser, ""); !isAuthFailure(err) {
+		t.Fatalf("login error = %v, want an authentication failure", err)
+	}
+	ip := limits.IP(raw.LocalAddr())
+	t.Cleanup(func() { limits.Shared().Unban(ip) })
+	if banned, _ := limits.Shared().Banned(ip); !banned {
+		t.Errorf("failed login as %q did not ban a remote client", ssh.ProbeUser)
+	}
+}
@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// EventsPath is the admin socket endpoint streaming events as JSON lines.
+const EventsPath = "/events"
+
+// EventType identifies what an Event reports.
+type EventType string
+
+// Event types
+const (
+	EventSessionStarted EventType = "session_started" // A client authenticated
+	EventAuthFailed     EventType = "auth_failed"     // A client failed SSH authentication
+	EventChannelOpened  EventType = "channel_opened"  // An authenticated client opened a forward
+	EventSessionClosed  EventType = "session_closed"  // A session that started ended
+)
+
+// Event is something that happened to a session, as delivered to subscribers.
+type Event struct {
+	Type      EventType     `json:"type"`
+	Time      time.Time     `json:"time"`
+	SessionID string        `json:"session_id"`
+	User      string        `json:"user,omitempty"`
+	Client    string        `json:"client"`                // Remote address of the client
+	Target    string        `json:"target,omitempty"`      // Destination of EventChannelOpened
+	Error     string        `json:"error,omitempty"`       // Reason of EventAuthFailed
+	BytesIn   int64         `json:"bytes_in,omitempty"`    // Bytes relayed from the client, in EventSessionClosed
+	BytesOut  int64         `json:"bytes_out,omitempty"`   // Bytes relayed to the client, in EventSessionClosed
+	Duration  time.Duration `json:"duration_ns,omitempty"` // Time since authentication, in EventSessionClosed
+}
+
+// DefaultEventBuffer is the number of events a subscription holds for a slow reader.
+const DefaultEventBuffer = 256
+
+// eventsDropped counts events not delivered because a subscriber's buffer was full.
+var eventsDropped = metrics.NewCounter("ssh_ify_events_dropped_total",
+	"Number of events dropped because a subscriber did not keep up.")
+
+// eventHub delivers events to the subscribers of a server.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Subscribe returns a channel receiving every event from now on, holding up to buffer
+// events for a slow reader, and a function ending the subscription and closing the
+// channel. Events that do not fit are dropped rather than holding up sessions. A buffer
+// of zero or less uses DefaultEventBuffer.
+func (s *Server) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+	s.events.mu.Lock()
+	if s.events.subscribers == nil {
+		s.events.subscribers = make(map[chan Event]struct{})
+	}
+	s.events.subscribers[ch] = struct{}{}
+	s.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.events.mu.Lock()
+			delete(s.events.subscribers, ch)
+			s.events.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish delivers ev to every subscriber without blocking.
+func (s *Server) publish(ev Event) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	for ch := range s.events.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			eventsDropped.Inc()
+		}
+	}
+}
+
+// publishEvent publishes an event of type typ for the session, filling in its ID, user
+// and client.
+func (s *Session) publishEvent(typ EventType, ev Event) {
+	ev.Type, ev.Time, ev.SessionID = typ, s.clock.Now(), s.sessionID
+	if ev.User == "" {
+		s.authMutex.Lock()
+		ev.User = s.username
+		s.authMutex.Unlock()
+	}
+	ev.Client = s.client.RemoteAddr().String()
+	s.server.publish(ev)
+}
+
+// handleEvents streams events as JSON lines until the client disconnects. The optional
+// buffer query parameter sets the subscription's buffer size.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	buffer, _ := strconv.Atoi(r.URL.Query().Get("buffer"))
+	events, cancel := s.Subscribe(buffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
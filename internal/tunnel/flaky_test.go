@@ -0,0 +1,164 @@
+package tunnel
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// errConnReset is returned by a flakyConn that dropped its connection.
+var errConnReset = errors.New("connection reset by flaky network")
+
+// faults describes how a flakyConn misbehaves. The zero value passes traffic through
+// unchanged.
+type faults struct {
+	latency    time.Duration // Delay before each chunk is written
+	chunk      int           // Largest number of bytes written at once; 0 for no limit
+	dropAfter  int64         // Bytes read and written before the connection resets; 0 for never
+	stallAfter int64         // Bytes written before writes hang until their deadline; 0 for never
+}
+
+// wrap returns conn with the faults applied.
+func (f faults) wrap(conn net.Conn) *flakyConn {
+	return &flakyConn{Conn: conn, faults: f, closed: make(chan struct{})}
+}
+
+// flakyConn is a connection over an unreliable network. Writes are delayed and split
+// into chunks. Once dropAfter bytes have crossed it in either direction the connection
+// resets: the read or write in progress delivers only the bytes before that point and
+// the rest are lost. Once stallAfter bytes have been written, writes hang until their
+// deadline passes or the connection is closed, as over a path that silently stopped
+// delivering packets.
+type flakyConn struct {
+	net.Conn
+	faults
+
+	mutex         sync.Mutex
+	transferred   int64
+	written       int64
+	writeDeadline time.Time
+	closed        chan struct{}
+	once          sync.Once
+}
+
+// allow returns how many of n bytes may cross the connection before it resets, and
+// counts them.
+func (c *flakyConn) allow(n int) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.dropAfter > 0 {
+		n = int(min(int64(n), max(c.dropAfter-c.transferred, 0)))
+	}
+	c.transferred += int64(n)
+	return n
+}
+
+// dropped reports whether the connection has carried dropAfter bytes.
+func (c *flakyConn) dropped() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.dropAfter > 0 && c.transferred >= c.dropAfter
+}
+
+func (c *flakyConn) Read(p []byte) (int, error) {
+	if c.dropped() {
+		c.Close()
+		return 0, errConnReset
+	}
+	n, err := c.Conn.Read(p)
+	if allowed := c.allow(n); allowed < n {
+		c.Close()
+		return allowed, errConnReset
+	}
+	return n, err
+}
+
+func (c *flakyConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := len(p) - written
+		if c.chunk > 0 {
+			chunk = min(chunk, c.chunk)
+		}
+		if err := c.delay(); err != nil {
+			return written, err
+		}
+		if err := c.stall(); err != nil {
+			return written, err
+		}
+		allowed := c.allow(chunk)
+		n, err := c.Conn.Write(p[written : written+allowed])
+		written += n
+		c.mutex.Lock()
+		c.written += int64(n)
+		c.mutex.Unlock()
+		if err != nil {
+			return written, err
+		}
+		if allowed < chunk {
+			c.Close()
+			return written, errConnReset
+		}
+	}
+	return written, nil
+}
+
+// delay waits for the latency to pass.
+func (c *flakyConn) delay() error {
+	if c.latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(c.latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+// stall hangs once stallAfter bytes were written, until the write deadline passes or
+// the connection is closed.
+func (c *flakyConn) stall() error {
+	c.mutex.Lock()
+	stalled := c.stallAfter > 0 && c.written >= c.stallAfter
+	deadline := c.writeDeadline
+	c.mutex.Unlock()
+	if !stalled {
+		return nil
+	}
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+func (c *flakyConn) SetDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.writeDeadline = t
+	c.mutex.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *flakyConn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.writeDeadline = t
+	c.mutex.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *flakyConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,151 @@
+package tunnel
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// Raw forwarding requests name their destination in ForwardHeader or in a path below
+// ForwardPathPrefix, e.g. "/tcp/example.com:443".
+const (
+	ForwardHeader     = "X-Forward-To"
+	ForwardPathPrefix = "/tcp/"
+)
+
+// WebSocketForward lets clients that authenticate with basic auth on the upgrade request
+// relay a raw TCP connection to a destination, without an SSH layer. Destinations are
+// checked against the forwarding policy. It is read from SSH_IFY_WS_FORWARD.
+var WebSocketForward = config.EnvBool("SSH_IFY_WS_FORWARD", false)
+
+// websocketForwards counts raw forwarding requests by result.
+var websocketForwards = metrics.NewCounterVec("ssh_ify_websocket_forwards_total",
+	"Number of raw WebSocket-to-TCP forwarding requests, by result.", "result")
+
+// forwardTarget returns the destination of a raw forwarding request, or "" if req asks
+// for an SSH tunnel.
+func forwardTarget(req *http.Request) string {
+	if !WebSocketForward {
+		return ""
+	}
+	if target := req.Header.Get(ForwardHeader); target != "" {
+		return target
+	}
+	if target, ok := strings.CutPrefix(req.URL.Path, ForwardPathPrefix); ok {
+		return target
+	}
+	return ""
+}
+
+// ForwardHandler upgrades an authenticated session and connects it to target. Clients
+// that sent a Sec-WebSocket-Key exchange WebSocket frames; others relay raw bytes after
+// the upgrade response, like SSH tunnels. On success, release must be called once the
+// session has been relayed.
+func ForwardHandler(s *Session, req *http.Request, target string) (release func(), ok bool) {
+	release, result, status := s.openForward(s.upgradeUser, target)
+	if release == nil {
+		websocketForwards.Inc(result)
+		s.respond(status)
+		return nil, false
+	}
+
+	if _, err := s.client.Write([]byte(upgradeResponse(req))); err != nil {
+		log.Printf("[session %s] Failed to write WebSocket upgrade response: %v", s.sessionID, err)
+		s.Close()
+		release()
+		return nil, false
+	}
+	if req.Header.Get("Sec-WebSocket-Key") != "" {
+		s.client = newWebSocketConn(s.client, s.preData)
+		s.preData = nil
+	}
+
+	websocketForwards.Inc("forwarded")
+	return s.startForward(s.upgradeUser, target, release), true
+}
+
+// openForward checks target against the forwarding rules and the concurrent session
+// limit of user and connects the session to it. On failure release is nil, and result
+// and status describe why for metrics and the HTTP response; otherwise release must be
+// called once the session has been relayed.
+func (s *Session) openForward(user, target string) (release func(), result string, status int) {
+	host, portText, err := net.SplitHostPort(target)
+	port, portErr := strconv.Atoi(portText)
+	if err != nil || portErr != nil || host == "" || port <= 0 || port > 65535 {
+		log.Printf("[session %s] Invalid forwarding destination %q", s.sessionID, target)
+		return nil, "invalid", http.StatusBadRequest
+	}
+
+	decision := ssh.CheckForward(user, limits.IP(s.client.RemoteAddr()), host, port)
+	if !decision.Allowed {
+		log.Printf("[session %s] User '%s' denied forwarding to %s by %s", s.sessionID, user, target, decision.Rule)
+		return nil, "denied", http.StatusForbidden
+	}
+
+	store := limits.Shared()
+	limit := ssh.SessionLimit(user)
+	allowed, err := store.AcquireSession(user, limit)
+	counted := err == nil
+	if err != nil {
+		log.Printf("[session %s] Failed to count session of user '%s': %v", s.sessionID, user, err)
+		allowed = true
+	}
+	if !allowed {
+		log.Printf("[session %s] User '%s' reached the limit of %d concurrent sessions", s.sessionID, user, limit)
+		return nil, "limited", http.StatusTooManyRequests
+	}
+	release = func() {
+		if counted {
+			if err := store.ReleaseSession(user); err != nil {
+				log.Printf("[session %s] Failed to release session of user '%s': %v", s.sessionID, user, err)
+			}
+		}
+	}
+
+	s.account(SessionOverhead)
+	if decision.Via != nil {
+		log.Printf("[session %s] Connecting to %s via upstream %s", s.sessionID, target, decision.Via.Name())
+	}
+	conn, dialErr := ssh.DialTarget(s.server.ctx, s.dialer, s.clock, host, port, decision.Via)
+	if errors.Is(dialErr, ssh.ErrPolicyDenied) {
+		log.Printf("[session %s] User '%s' denied forwarding: %v", s.sessionID, user, dialErr)
+		release()
+		return nil, "denied", http.StatusForbidden
+	}
+	if dialErr != nil {
+		log.Printf("[session %s] Failed to connect to %s: %v", s.sessionID, target, dialErr)
+		release()
+		return nil, "unreachable", http.StatusBadGateway
+	}
+	s.target = conn
+	return release, "", 0
+}
+
+// startForward records user as the session's user and registers the session with the
+// server once its forwarded connection is set up. Like SSH connections, the session is
+// closed once the user's login window closes, their account expires or it reaches the
+// maximum session duration. It returns release wrapped to also stop these checks.
+func (s *Session) startForward(user, target string, release func()) func() {
+	s.authMutex.Lock()
+	s.username, s.authenticatedAt = user, s.clock.Now()
+	s.authMutex.Unlock()
+	s.server.Add(s)
+	log.Printf("[session %s] Forwarding to %s for user '%s'.", s.sessionID, target, user)
+	s.publishEvent(EventSessionStarted, Event{User: user})
+	s.publishEvent(EventChannelOpened, Event{User: user, Target: target})
+
+	done := make(chan struct{})
+	ssh.EnforceLimits(s.clock, user, s.sessionID, s.Close, done)
+	return func() {
+		close(done)
+		release()
+	}
+}
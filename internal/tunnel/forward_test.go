@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// openRawForward sends an authenticated raw forwarding request for target as user and
+// returns the relayed connection.
+func (h *harness) openRawForward(user, password, target string) net.Conn {
+	h.t.Helper()
+	credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	resp, conn := h.upgrade(h.dial(), ForwardHeader+": "+target, "Authorization: Basic "+credentials)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		h.t.Fatalf("forwarding request got status %d, want 101", resp.StatusCode)
+	}
+	return conn
+}
+
+// waitForTimers waits until fake has at least n timers scheduled.
+func waitForTimers(t *testing.T, fake *clock.Fake, n int) {
+	t.Helper()
+	deadline := time.Now().Add(harnessTimeout)
+	for fake.Timers() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers scheduled, want %d", fake.Timers(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// expectClosed fails the test unless the server closes conn.
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("forward was not closed: %v", err)
+	}
+}
+
+func TestRawForwardLimits(t *testing.T) {
+	previous := WebSocketForward
+	WebSocketForward = true
+	t.Cleanup(func() { WebSocketForward = previous })
+	if err := config.SetTunable("SSH_IFY_MAX_SESSION_DURATION", "1h"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.SetTunable("SSH_IFY_MAX_SESSION_DURATION", "0") })
+
+	t.Run("duration", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		h := newHarnessWith(t, []ServerOption{WithClock(fake)})
+		timers := fake.Timers()
+		conn := h.openRawForward(harnessUser, harnessPassword, "203.0.113.7:80")
+		roundTrip(t, conn, 4096)
+		// The schedule ticker and the duration timer.
+		waitForTimers(t, fake, timers+2)
+
+		fake.Advance(59 * time.Minute)
+		roundTrip(t, conn, 4096)
+		fake.Advance(time.Minute)
+		expectClosed(t, conn)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		const user, password = "dave", "expiring"
+		db := ssh.GetUserDB()
+		if err := db.AddUser(user, password); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.RemoveUser(user) })
+		fake := clock.NewFake(time.Now())
+		h := newHarnessWith(t, []ServerOption{WithClock(fake)})
+		timers := fake.Timers()
+		conn := h.openRawForward(user, password, "203.0.113.7:80")
+		roundTrip(t, conn, 4096)
+		waitForTimers(t, fake, timers+2)
+
+		if err := db.SetExpiry(user, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		fake.Advance(ssh.ScheduleCheckInterval)
+		expectClosed(t, conn)
+	})
+}
@@ -0,0 +1,157 @@
+package tunnel
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// TunnelKeyHeader is the request header that must carry TunnelKey.
+const TunnelKeyHeader = "X-Tunnel-Key"
+
+// TunnelKey is the pre-shared secret upgrade requests must present in TunnelKeyHeader
+// before the SSH handshake starts. It is read from SSH_IFY_TUNNEL_KEY; when empty, the
+// header is not required.
+var TunnelKey = config.Env("SSH_IFY_TUNNEL_KEY", "")
+
+// Tunnel key modes
+const (
+	// TunnelKeyStatic expects TunnelKeyHeader to carry TunnelKey itself.
+	TunnelKeyStatic = "static"
+
+	// TunnelKeySigned expects TunnelKeyHeader to carry a token made by SignTunnelKey:
+	// a timestamp and a random nonce signed with TunnelKey. Each token is accepted once
+	// and only within TunnelKeySkew of its timestamp, so captured upgrade requests
+	// cannot be replayed.
+	TunnelKeySigned = "signed"
+)
+
+// Signed tunnel key configuration, read from the environment at startup.
+var (
+	// TunnelKeyMode selects how TunnelKeyHeader is checked: TunnelKeyStatic, the default,
+	// or TunnelKeySigned. It is read from SSH_IFY_TUNNEL_KEY_MODE.
+	TunnelKeyMode = config.Env("SSH_IFY_TUNNEL_KEY_MODE", TunnelKeyStatic)
+
+	// TunnelKeySkew is how far the timestamp of a signed token may be from the server's
+	// clock, either way. It is read from SSH_IFY_TUNNEL_KEY_SKEW.
+	TunnelKeySkew = config.EnvDuration("SSH_IFY_TUNNEL_KEY_SKEW", 2*time.Minute)
+)
+
+// tunnelKeyRejections counts upgrade requests refused by the pre-shared key gate, by reason.
+var tunnelKeyRejections = metrics.NewCounterVec("ssh_ify_tunnel_key_rejections_total",
+	"Number of upgrade requests refused for a missing, wrong, expired or replayed tunnel key.", "reason")
+
+// checkTunnelKey reports whether req passes the pre-shared key gate at now. On failure it
+// also returns the reason ("missing", "invalid", "expired" or "replayed").
+func checkTunnelKey(req *http.Request, now time.Time) (bool, string) {
+	if TunnelKey == "" {
+		return true, ""
+	}
+	key := req.Header.Get(TunnelKeyHeader)
+	if key == "" {
+		return false, "missing"
+	}
+	if TunnelKeyMode == TunnelKeySigned {
+		return checkSignedTunnelKey(key, now)
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(TunnelKey)) != 1 {
+		return false, "invalid"
+	}
+	return true, ""
+}
+
+// SignTunnelKey returns a token for TunnelKeyHeader in TunnelKeySigned mode, signed
+// with key for use at now.
+func SignTunnelKey(key string, now time.Time) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	payload := strconv.FormatInt(now.Unix(), 10) + "." + hex.EncodeToString(nonce)
+	return payload + "." + tunnelKeyMAC(key, payload)
+}
+
+// tunnelKeyMAC returns the hex HMAC-SHA256 of payload under key.
+func tunnelKeyMAC(key, payload string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkSignedTunnelKey checks a token made by SignTunnelKey, remembering its nonce so
+// that it is not accepted again.
+func checkSignedTunnelKey(token string, now time.Time) (bool, string) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || len(parts[1]) < 16 || len(parts[1]) > 64 {
+		return false, "invalid"
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(tunnelKeyMAC(TunnelKey, payload))) {
+		return false, "invalid"
+	}
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false, "invalid"
+	}
+	issued := time.Unix(unix, 0)
+	if issued.Before(now.Add(-TunnelKeySkew)) || issued.After(now.Add(TunnelKeySkew)) {
+		return false, "expired"
+	}
+	// The token stays acceptable until TunnelKeySkew after its timestamp; its nonce
+	// must be remembered that long.
+	if !usedNonces.add(parts[1], now, issued.Add(TunnelKeySkew)) {
+		return false, "replayed"
+	}
+	return true, ""
+}
+
+// nonceCache remembers the nonces of accepted signed tokens until they expire. In
+// cluster mode they are kept in Redis, so that a token is accepted once by the whole
+// cluster.
+type nonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	nextPrune time.Time
+}
+
+// usedNonces is the process-wide nonce cache.
+var usedNonces = &nonceCache{expires: make(map[string]time.Time)}
+
+// add records nonce as used until expires and reports whether it was unused. Store
+// errors are logged and count the nonce as unused.
+func (c *nonceCache) add(nonce string, now, expires time.Time) bool {
+	if client := cluster.Client(); client != nil {
+		ok, err := client.SetNX(cluster.Key("tunnel-nonce:"+nonce), "1", expires.Sub(now))
+		if err != nil {
+			log.Printf("Failed to check tunnel key nonce in cluster backend: %v", err)
+			return true
+		}
+		return ok
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.After(c.nextPrune) {
+		for n, exp := range c.expires {
+			if now.After(exp) {
+				delete(c.expires, n)
+			}
+		}
+		c.nextPrune = now.Add(TunnelKeySkew)
+	}
+	if exp, ok := c.expires[nonce]; ok && !now.After(exp) {
+		return false
+	}
+	c.expires[nonce] = expires
+	return true
+}
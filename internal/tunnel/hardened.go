@@ -0,0 +1,69 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// hardenedCipherSuites are the TLS 1.2 cipher suites offered in hardened mode: ECDHE key
+// exchange with AES-GCM.
+var hardenedCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+}
+
+// hardenTLS restricts tlsConfig to TLS 1.2 and later, hardenedCipherSuites and the NIST
+// curves.
+func hardenTLS(tlsConfig *tls.Config) {
+	tlsConfig.MinVersion = tls.VersionTLS12
+	tlsConfig.CipherSuites = hardenedCipherSuites
+	tlsConfig.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+}
+
+// checkCertStrength returns an error if the key of cert, served for name, is weaker than
+// hardened mode allows.
+func checkCertStrength(name string, cert *tls.Certificate) error {
+	if cert.Leaf == nil {
+		return nil
+	}
+	return config.CheckKeyStrength("TLS certificate for "+name, cert.Leaf.PublicKey)
+}
+
+// checkHardenedCerts checks the strength of every certificate sel serves.
+func checkHardenedCerts(sel *certSelector) error {
+	if err := checkCertStrength("the default hostname", sel.fallback); err != nil {
+		return err
+	}
+	for name, cert := range sel.byName {
+		if err := checkCertStrength(name, cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckHardenedTLS checks the default certificate and the certificates of the SNI
+// certificate map, those that exist, against hardened mode.
+func CheckHardenedTLS() error {
+	var fallback tls.Certificate
+	if cert, err := tls.LoadX509KeyPair(DefaultTLSCertFile, DefaultTLSKeyFile); err == nil {
+		fallback = cert
+	}
+	path, err := config.GetCertsPath()
+	if err != nil {
+		return fmt.Errorf("cannot resolve certificate map path: %v", err)
+	}
+	pairs, err := LoadCertMap(path)
+	if err != nil {
+		return err
+	}
+	sel, err := newCertSelector(pairs, &fallback)
+	if err != nil {
+		return err
+	}
+	return checkHardenedCerts(sel)
+}
@@ -0,0 +1,321 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// harnessTimeout bounds every step of a harness test, so that a hung session fails the
+// test instead of the whole run.
+const harnessTimeout = 10 * time.Second
+
+// Credentials of the user every harness registers.
+const (
+	harnessUser     = "alice"
+	harnessPassword = "correct horse"
+)
+
+// harness runs a Server entirely in memory: clients connect through a pipeListener
+// served by the server's own accept loop, and forwarded channels reach an echoUpstream
+// through the injected dialer.
+type harness struct {
+	t        *testing.T
+	server   *Server
+	listener *pipeListener
+	upstream *echoUpstream
+	served   chan struct{} // Closed when the accept loop returns
+}
+
+// TestMain gives the package's tests a fresh configuration directory, an in-memory host
+// key, a user database holding the harness user and session resumption. Log output is
+// only shown with -v.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ssh-ify-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := func() int {
+		defer os.RemoveAll(dir)
+		os.Setenv("XDG_CONFIG_HOME", dir)
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		signer, err := gossh.NewSignerFromKey(key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ssh.HostKeySource = func() (gossh.Signer, error) { return signer, nil }
+		// Clients of the resume tests opt in to resumption; others are unaffected.
+		ResumeEnabled = true
+		if err := ssh.InitializeAuth(filepath.Join(dir, "users.json")); err != nil {
+			log.Fatal(err)
+		}
+		if err := ssh.GetUserDB().AddUser(harnessUser, harnessPassword); err != nil {
+			log.Fatal(err)
+		}
+		flag.Parse()
+		if !testing.Verbose() {
+			log.SetOutput(io.Discard)
+		}
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// newHarness starts a server with a listener serving features, or DefaultFeatures.
+func newHarness(t *testing.T, features ...string) *harness {
+	t.Helper()
+	return newHarnessWith(t, nil, features...)
+}
+
+// newHarnessWith is newHarness for a server with opts applied after the harness dialer.
+func newHarnessWith(t *testing.T, opts []ServerOption, features ...string) *harness {
+	t.Helper()
+	if len(features) == 0 {
+		features = DefaultFeatures
+	}
+	enabled, err := NewFeatures(features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &harness{
+		t:        t,
+		listener: newPipeListener(),
+		upstream: &echoUpstream{},
+		served:   make(chan struct{}),
+	}
+	h.server = NewServer(append([]ServerOption{WithDialer(h.upstream)}, opts...)...)
+	l := &listener{name: "test", raw: h.listener, ln: h.listener, features: enabled}
+	go func() {
+		defer close(h.served)
+		serveListener(h.server, l)
+	}()
+	t.Cleanup(h.shutdown)
+	return h
+}
+
+// shutdown stops accepting connections and closes the server's sessions, as the server
+// does on SIGTERM. It fails the test if either takes longer than harnessTimeout.
+func (h *harness) shutdown() {
+	h.t.Helper()
+	h.server.stopListening()
+	h.listener.Close()
+	done := make(chan struct{})
+	go func() {
+		<-h.served
+		h.server.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(harnessTimeout):
+		h.t.Fatal("server did not shut down")
+	}
+}
+
+// dial connects a new client to the server.
+func (h *harness) dial() net.Conn {
+	h.t.Helper()
+	conn, err := h.listener.Dial()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(harnessTimeout))
+	h.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// upgrade sends a WebSocket upgrade request with the extra header lines on conn and
+// returns the response and a connection reading past it.
+func (h *harness) upgrade(conn net.Conn, header ...string) (*http.Response, net.Conn) {
+	h.t.Helper()
+	resp, conn, err := upgradeConn(conn, header...)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return resp, conn
+}
+
+// upgradeConn is upgrade for callers that cannot fail the test, such as connections
+// reconnecting in the background.
+func upgradeConn(conn net.Conn, header ...string) (*http.Response, net.Conn, error) {
+	req := "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+	for _, line := range header {
+		req += line + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return nil, nil, fmt.Errorf("writing upgrade request: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading upgrade response: %w", err)
+	}
+	return resp, &readerConn{Conn: conn, r: reader}, nil
+}
+
+// sshClient upgrades a new connection and logs in as user with password.
+func (h *harness) sshClient(user, password string) (*gossh.Client, error) {
+	h.t.Helper()
+	resp, conn := h.upgrade(h.dial())
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		h.t.Fatalf("upgrade response status %d, want 101", resp.StatusCode)
+	}
+	return h.handshake(conn, user, password)
+}
+
+// handshake runs the SSH handshake on conn and logs in as user with password.
+func (h *harness) handshake(conn net.Conn, user, password string) (*gossh.Client, error) {
+	h.t.Helper()
+	config := &gossh.ClientConfig{
+		User:            user,
+		Auth:            []gossh.AuthMethod{gossh.Password(password)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         harnessTimeout,
+	}
+	c, chans, reqs, err := gossh.NewClientConn(conn, "harness", config)
+	if err != nil {
+		return nil, err
+	}
+	client := gossh.NewClient(c, chans, reqs)
+	h.t.Cleanup(func() { client.Close() })
+	return client, nil
+}
+
+// login is sshClient for the harness user, failing the test if the login fails.
+func (h *harness) login() *gossh.Client {
+	h.t.Helper()
+	client, err := h.sshClient(harnessUser, harnessPassword)
+	if err != nil {
+		h.t.Fatalf("logging in: %v", err)
+	}
+	return client
+}
+
+// readerConn is a net.Conn whose reads are served from a bufio.Reader that may already
+// hold bytes read past an HTTP response.
+type readerConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *readerConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// pipeListener is an in-memory listener whose connections are net.Pipe ends. Each
+// connection gets its own client address in 192.0.2.0/24, so that per-client limits
+// and bans apply as they would over TCP.
+type pipeListener struct {
+	conns    chan net.Conn
+	closed   chan struct{}
+	once     sync.Once
+	clients  atomic.Int32
+	deadline atomic.Pointer[time.Time]
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+// Dial connects to the listener, waiting for the server to accept the connection.
+func (l *pipeListener) Dial() (net.Conn, error) {
+	n := l.clients.Add(1)
+	client := &net.TCPAddr{IP: net.IPv4(192, 0, 2, byte(n%250+1)), Port: 40000 + int(n)}
+	server := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 254), Port: 80}
+	clientEnd, serverEnd := net.Pipe()
+	select {
+	case l.conns <- addrConn{Conn: serverEnd, local: server, remote: client}:
+		return addrConn{Conn: clientEnd, local: client, remote: server}, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	var timeout <-chan time.Time
+	if deadline := l.deadline.Load(); deadline != nil && !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(*deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (l *pipeListener) SetDeadline(t time.Time) error {
+	l.deadline.Store(&t)
+	return nil
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 254), Port: 80}
+}
+
+// addrConn is a net.Conn reporting the given addresses.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+// echoUpstream is a dialer whose every connection echoes what it receives. It records
+// the addresses it was asked to dial.
+type echoUpstream struct {
+	mutex  sync.Mutex
+	dialed []string
+}
+
+func (u *echoUpstream) Dial(network, address string) (net.Conn, error) {
+	u.mutex.Lock()
+	u.dialed = append(u.dialed, address)
+	u.mutex.Unlock()
+	clientEnd, serverEnd := net.Pipe()
+	go func() {
+		defer serverEnd.Close()
+		io.Copy(serverEnd, serverEnd)
+	}()
+	return clientEnd, nil
+}
+
+// Dialed returns the addresses dialed so far.
+func (u *echoUpstream) Dialed() []string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return append([]string(nil), u.dialed...)
+}
+
+// isAuthFailure reports whether err from a client handshake means the server rejected
+// the credentials.
+func isAuthFailure(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "unable to authenticate")
+}
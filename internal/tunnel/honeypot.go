@@ -0,0 +1,150 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Honeypot triggers
+const (
+	// TriggerTunnelKey marks clients that failed the pre-shared key gate.
+	TriggerTunnelKey = "tunnel_key"
+
+	// TriggerSSHAuth marks clients that failed SSH authentication.
+	TriggerSSHAuth = "ssh_auth"
+
+	// TriggerUpgradeAuth marks clients that sent wrong basic-auth credentials with the
+	// upgrade request.
+	TriggerUpgradeAuth = "upgrade_auth"
+)
+
+// Honeypot configuration, read from the environment at startup.
+var (
+	// HoneypotEnabled routes clients that fail the tunnel key gate or SSH authentication
+	// to a tarpit that holds the connection open and answers very slowly, instead of
+	// closing it immediately.
+	HoneypotEnabled = config.EnvBool("SSH_IFY_HONEYPOT", false)
+
+	// HoneypotInterval is the pause between the bytes the tarpit trickles to a client.
+	HoneypotInterval = config.EnvDuration("SSH_IFY_HONEYPOT_INTERVAL", 10*time.Second)
+
+	// HoneypotDuration is the longest a client is held in the tarpit.
+	HoneypotDuration = config.EnvDuration("SSH_IFY_HONEYPOT_DURATION", 5*time.Minute)
+
+	// HoneypotMaxClients caps concurrently tarpitted clients; further failures are closed
+	// immediately so the tarpit cannot be used to exhaust the server.
+	HoneypotMaxClients = int64(config.EnvInt("SSH_IFY_HONEYPOT_MAX_CLIENTS", 100))
+)
+
+// tarpitted counts clients currently held in the tarpit.
+var tarpitted atomic.Int64
+
+// Honeypot metrics
+var (
+	honeypotClients = metrics.NewCounterVec("ssh_ify_honeypot_clients_total",
+		"Number of clients routed to the tarpit, by what they failed.", "trigger")
+	honeypotActive = metrics.NewGaugeFunc("ssh_ify_honeypot_active_clients",
+		"Number of clients currently held in the tarpit.",
+		func() float64 { return float64(tarpitted.Load()) })
+	honeypotOverflow = metrics.NewCounter("ssh_ify_honeypot_overflow_total",
+		"Number of failing clients closed immediately because the tarpit was full.")
+	honeypotBytesReceived = metrics.NewCounter("ssh_ify_honeypot_received_bytes_total",
+		"Number of bytes tarpitted clients sent while being held.")
+	honeypotSecondsHeld = metrics.NewCounter("ssh_ify_honeypot_held_seconds_total",
+		"Total seconds clients were held in the tarpit.")
+	honeypotClientHangups = metrics.NewCounter("ssh_ify_honeypot_client_hangups_total",
+		"Number of tarpitted clients that disconnected before the tarpit gave up on them.")
+)
+
+// tarpit holds the session's client connection open for up to HoneypotDuration, sending
+// one small chunk from next every HoneypotInterval and discarding whatever the client
+// sends. It returns once the client disconnects, the duration elapses or the server
+// shuts down. If the honeypot is disabled or full, it returns immediately.
+func (s *Session) tarpit(trigger string, next func() []byte) {
+	if !HoneypotEnabled {
+		return
+	}
+	if tarpitted.Add(1) > HoneypotMaxClients {
+		tarpitted.Add(-1)
+		honeypotOverflow.Inc()
+		return
+	}
+	defer tarpitted.Add(-1)
+	s.leavePreAuth() // Held clients are bounded by HoneypotMaxClients instead.
+
+	// The tarpit needs none of the buffers accounted to the session.
+	s.releaseMemory()
+	honeypotClients.Inc(trigger)
+	log.Printf("[session %s] Honeypot: holding %s in tarpit after %s failure", s.sessionID, s.client.RemoteAddr(), trigger)
+
+	start := s.clock.Now()
+	hangup := make(chan struct{})
+	go func() {
+		defer close(hangup)
+		n, _ := io.Copy(io.Discard, s.client)
+		honeypotBytesReceived.Add(n)
+	}()
+
+	ticker := time.NewTicker(HoneypotInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(HoneypotDuration)
+	defer deadline.Stop()
+
+	reason := "timeout"
+loop:
+	for {
+		select {
+		case <-s.server.ctx.Done():
+			reason = "shutdown"
+			break loop
+		case <-hangup:
+			reason = "client hangup"
+			honeypotClientHangups.Inc()
+			break loop
+		case <-deadline.C:
+			break loop
+		case <-ticker.C:
+			s.client.SetWriteDeadline(time.Now().Add(HoneypotInterval))
+			if _, err := s.client.Write(next()); err != nil {
+				reason = "write error"
+				break loop
+			}
+		}
+	}
+
+	s.client.Close()
+	held := s.clock.Now().Sub(start)
+	honeypotSecondsHeld.Add(int64(held.Seconds()))
+	log.Printf("[session %s] Honeypot: released after %s (%s)", s.sessionID, held.Round(time.Second), reason)
+}
+
+// httpTarpitResponse returns a generator for an endless HTTP response: a status line
+// followed by one random header line per call, so HTTP clients keep waiting for the body.
+func httpTarpitResponse() func() []byte {
+	started := false
+	return func() []byte {
+		if !started {
+			started = true
+			return []byte("HTTP/1.1 200 OK\r\n")
+		}
+		var b [4]byte
+		rand.Read(b[:])
+		return []byte(fmt.Sprintf("X-%s: %x\r\n", hex.EncodeToString(b[:2]), b[2:]))
+	}
+}
+
+// randomByte returns one random byte per call, which keeps binary protocols such as SSH
+// waiting for a complete packet.
+func randomByte() []byte {
+	var b [1]byte
+	rand.Read(b[:])
+	return b[:]
+}
@@ -0,0 +1,230 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// ICMP transport configuration, read from the environment at startup. The transport
+// needs a raw socket (root or CAP_NET_RAW) and is disabled unless ICMPEnabled is set.
+var (
+	// ICMPEnabled carries SSH in ICMP echo requests and replies. It is read from SSH_IFY_ICMP.
+	ICMPEnabled = config.EnvBool("SSH_IFY_ICMP", false)
+
+	// ICMPAddr is the IPv4 address the transport receives echo requests on. It is read
+	// from SSH_IFY_ICMP_ADDR.
+	ICMPAddr = config.Env("SSH_IFY_ICMP_ADDR", "0.0.0.0")
+
+	// ICMPMTU is the largest IP packet sent; replies carry at most ICMPMTU minus the IP,
+	// ICMP and transport headers of downstream data. It is read from SSH_IFY_ICMP_MTU.
+	ICMPMTU = config.EnvInt("SSH_IFY_ICMP_MTU", 1280)
+
+	// ICMPRate caps the echo requests answered per second from one client IP; excess
+	// requests are dropped. It is read from SSH_IFY_ICMP_RATE.
+	ICMPRate = config.EnvInt("SSH_IFY_ICMP_RATE", 200)
+
+	// ICMPIdleTimeout closes ICMP sessions the client has not polled for this long. It is
+	// read from SSH_IFY_ICMP_IDLE_TIMEOUT.
+	ICMPIdleTimeout = config.EnvDuration("SSH_IFY_ICMP_IDLE_TIMEOUT", 2*time.Minute)
+
+	// ICMPMaxSessions caps concurrent ICMP sessions, which are opened before
+	// authentication. It is read from SSH_IFY_ICMP_MAX_SESSIONS.
+	ICMPMaxSessions = config.EnvInt("SSH_IFY_ICMP_MAX_SESSIONS", 32)
+)
+
+// ICMP transport packets are echo requests whose payload starts with icmpRequestMagic,
+// a command byte and a 4-byte session ID (zero when opening), followed by upstream data.
+// The server answers with an echo reply of the same identifier and sequence number whose
+// payload starts with icmpReplyMagic, the command and the session ID, followed by
+// downstream data. The echo sequence number orders exchanges: repeating it repeats the
+// previous reply. A reply with icmpCommandClose means the session is gone.
+//
+// The kernel answers echo requests as well, with the request payload; clients tell the
+// replies apart by their magic.
+const (
+	icmpRequestMagic = "SFYQ"
+	icmpReplyMagic   = "SFYR"
+
+	icmpCommandOpen  = 'o'
+	icmpCommandData  = 'd'
+	icmpCommandClose = 'c'
+
+	icmpTypeEchoReply   = 0
+	icmpTypeEchoRequest = 8
+
+	icmpHeaderSize      = 8
+	icmpTransportHeader = len(icmpRequestMagic) + 1 + 4
+	ipv4HeaderSize      = 20
+)
+
+// icmpPackets counts ICMP transport packets by outcome.
+var icmpPackets = metrics.NewCounterVec("ssh_ify_icmp_packets_total",
+	"Number of ICMP transport echo requests, by outcome.", "result")
+
+// icmpServer answers ICMP transport echo requests.
+type icmpServer struct {
+	conn     net.PacketConn
+	sessions *pollSessions
+	limiter  *packetLimiter
+}
+
+// serveICMP runs the ICMP transport until the server stops listening.
+func (s *Server) serveICMP() {
+	if !ICMPEnabled {
+		return
+	}
+	conn, err := net.ListenPacket("ip4:icmp", ICMPAddr)
+	if err != nil {
+		log.Printf("ICMP transport disabled (a raw socket needs root or CAP_NET_RAW): %v", err)
+		return
+	}
+	log.Printf("ICMP transport listening on %s (experimental)", ICMPAddr)
+	i := &icmpServer{
+		conn:     conn,
+		sessions: newPollSessions(s, "ICMP", ICMPMaxSessions, ICMPIdleTimeout, 4),
+		limiter:  &packetLimiter{rate: ICMPRate},
+	}
+	go func() {
+		<-s.listenCtx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("ICMP transport stopped: %v", err)
+			}
+			return
+		}
+		msg := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer ssh.RecoverPanic("icmp", "", nil)
+			i.handle(msg, addr)
+		}()
+	}
+}
+
+// handle answers one ICMP message if it is a transport echo request.
+func (i *icmpServer) handle(msg []byte, addr net.Addr) {
+	if len(msg) < icmpHeaderSize+icmpTransportHeader || msg[0] != icmpTypeEchoRequest ||
+		!bytes.HasPrefix(msg[icmpHeaderSize:], []byte(icmpRequestMagic)) {
+		return
+	}
+	if !i.limiter.allow(limits.IP(addr)) {
+		icmpPackets.Inc("rate_limited")
+		return
+	}
+	id, seq := msg[4:6], binary.BigEndian.Uint16(msg[6:8])
+	payload := msg[icmpHeaderSize+len(icmpRequestMagic):]
+	command, sessionID, data := payload[0], hex.EncodeToString(payload[1:5]), payload[5:]
+
+	capacity := ICMPMTU - ipv4HeaderSize - icmpHeaderSize - icmpTransportHeader
+	switch command {
+	case icmpCommandOpen:
+		icmpPackets.Inc("open")
+		newID, err := i.sessions.open(addr)
+		if err != nil {
+			log.Printf("ICMP transport: refusing session from %s: %v", addr, err)
+			i.reply(addr, id, seq, icmpCommandClose, sessionID, nil)
+			return
+		}
+		i.reply(addr, id, seq, icmpCommandOpen, newID, nil)
+
+	case icmpCommandData:
+		icmpPackets.Inc("data")
+		sess := i.sessions.lookup(sessionID)
+		if sess == nil {
+			i.reply(addr, id, seq, icmpCommandClose, sessionID, nil)
+			return
+		}
+		downstream, err := sess.exchange(strconv.Itoa(int(seq)), data, capacity)
+		if err != nil {
+			i.sessions.remove(sessionID)
+			i.reply(addr, id, seq, icmpCommandClose, sessionID, nil)
+			return
+		}
+		i.reply(addr, id, seq, icmpCommandData, sessionID, downstream)
+
+	case icmpCommandClose:
+		icmpPackets.Inc("close")
+		i.sessions.remove(sessionID)
+		i.reply(addr, id, seq, icmpCommandClose, sessionID, nil)
+
+	default:
+		icmpPackets.Inc("invalid")
+	}
+}
+
+// reply sends an echo reply carrying command, the session ID and data.
+func (i *icmpServer) reply(addr net.Addr, id []byte, seq uint16, command byte, sessionID string, data []byte) {
+	rawID, err := hex.DecodeString(sessionID)
+	if err != nil || len(rawID) != 4 {
+		rawID = make([]byte, 4)
+	}
+	msg := []byte{icmpTypeEchoReply, 0, 0, 0}
+	msg = append(msg, id...)
+	msg = binary.BigEndian.AppendUint16(msg, seq)
+	msg = append(msg, icmpReplyMagic...)
+	msg = append(msg, command)
+	msg = append(msg, rawID...)
+	msg = append(msg, data...)
+	binary.BigEndian.PutUint16(msg[2:4], internetChecksum(msg))
+	if _, err := i.conn.WriteTo(msg, addr); err != nil {
+		log.Printf("ICMP transport: failed to reply to %s: %v", addr, err)
+	}
+}
+
+// internetChecksum computes the RFC 1071 checksum of b.
+func internetChecksum(b []byte) uint16 {
+	var sum uint32
+	for len(b) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// packetLimiter admits at most rate packets per second from each key.
+type packetLimiter struct {
+	rate   int
+	mutex  sync.Mutex
+	second int64          // Unix second the counts belong to
+	counts map[string]int // Packets admitted this second, by key
+}
+
+// allow reports whether another packet from key is admitted this second.
+func (l *packetLimiter) allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if now := time.Now().Unix(); now != l.second || l.counts == nil {
+		l.second, l.counts = now, make(map[string]int)
+	}
+	if l.counts[key] >= l.rate {
+		return false
+	}
+	l.counts[key]++
+	return true
+}
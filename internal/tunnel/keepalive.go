@@ -0,0 +1,33 @@
+package tunnel
+
+import (
+	"net"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/keepalive"
+)
+
+// keepaliveListener sets the TCP keepalive of the connections it accepts from
+// keepalive.TCP, whether the socket was bound by this process or inherited.
+type keepaliveListener struct {
+	*net.TCPListener
+}
+
+func (l keepaliveListener) Accept() (net.Conn, error) {
+	conn, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	setTCPKeepAlive(conn, keepalive.TCP)
+	return conn, nil
+}
+
+// setTCPKeepAlive sends keepalive probes on conn once it has been idle for interval,
+// and every interval after that, or turns them off if interval is zero.
+func setTCPKeepAlive(conn *net.TCPConn, interval time.Duration) {
+	if interval <= 0 {
+		conn.SetKeepAlive(false)
+		return
+	}
+	conn.SetKeepAliveConfig(net.KeepAliveConfig{Enable: true, Idle: interval, Interval: interval})
+}
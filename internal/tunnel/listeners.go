@@ -0,0 +1,342 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clientconfig"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sockopt"
+	"github.com/ayanrajpoot10/ssh-ify/pkg/certgen"
+)
+
+// Listener features
+const (
+	// FeatureWebSocket serves SSH tunnels behind an HTTP/WebSocket upgrade request.
+	FeatureWebSocket = "websocket"
+
+	// FeatureForward serves raw WebSocket-to-TCP forwarding (also needs WebSocketForward).
+	FeatureForward = "forward"
+
+	// FeatureConnect serves HTTP CONNECT proxy requests for authenticated users.
+	FeatureConnect = "connect"
+
+	// FeatureSOCKS serves SOCKS5 proxy requests for authenticated users.
+	FeatureSOCKS = "socks"
+
+	// FeatureSSH serves SSH spoken directly, without an upgrade request.
+	FeatureSSH = "ssh"
+
+	// FeatureAdmin serves the web admin dashboard and API to loopback clients.
+	FeatureAdmin = "admin"
+
+	// FeatureSpeedtest serves speedtest requests of authenticated users (also needs Speedtest).
+	FeatureSpeedtest = "speedtest"
+)
+
+// allFeatures lists the features a listener may enable.
+var allFeatures = []string{FeatureWebSocket, FeatureForward, FeatureConnect, FeatureSOCKS, FeatureSSH, FeatureAdmin, FeatureSpeedtest}
+
+// DefaultFeatures are enabled on listeners that do not list their own.
+var DefaultFeatures = []string{FeatureWebSocket, FeatureForward, FeatureSpeedtest}
+
+// Features is the set of features enabled on a listener.
+type Features map[string]bool
+
+// NewFeatures returns the set of the named features.
+func NewFeatures(names []string) (Features, error) {
+	features := make(Features, len(names))
+	for _, name := range names {
+		if !slices.Contains(allFeatures, name) {
+			return nil, fmt.Errorf("unknown feature %q (expected one of %s)", name, strings.Join(allFeatures, ", "))
+		}
+		features[name] = true
+	}
+	return features, nil
+}
+
+// Has reports whether feature is enabled. A nil set has no features.
+func (f Features) Has(feature string) bool {
+	return f[feature]
+}
+
+// String lists the enabled features in a fixed order.
+func (f Features) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return slices.Index(allFeatures, names[i]) < slices.Index(allFeatures, names[j])
+	})
+	return strings.Join(names, ",")
+}
+
+// ListenerConfig describes a tunnel listener.
+type ListenerConfig struct {
+	Name     string   `json:"name"`               // Unique name used in logs and to hand the socket over on upgrades
+	Addr     string   `json:"addr"`               // Address to bind, e.g. ":443" or "127.0.0.1:8443"
+	TLS      bool     `json:"tls,omitempty"`      // Whether connections are wrapped in TLS
+	Features []string `json:"features,omitempty"` // Enabled features; DefaultFeatures if empty
+
+	Interface string `json:"interface,omitempty"` // Interface or VRF device to bind to (Linux only); any if empty
+	Mark      int    `json:"mark,omitempty"`      // Firewall mark of the listener's packets (Linux only); none if zero
+
+	NoBanner bool `json:"no_banner,omitempty"` // Send no SSH banner to clients of this listener
+}
+
+// socketOptions returns the socket options of the listener described by cfg.
+func (cfg ListenerConfig) socketOptions() sockopt.Options {
+	return sockopt.Options{Interface: cfg.Interface, Mark: cfg.Mark}
+}
+
+// LoadListeners reads a JSON array of listener configurations, e.g.
+//
+//	[{"name": "TLS", "addr": ":443", "tls": true, "features": ["websocket"]},
+//	 {"name": "local", "addr": "127.0.0.1:8443", "tls": true, "features": ["websocket", "admin"]}]
+//
+// A missing file yields nil.
+func LoadListeners(path string) ([]ListenerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var configs []ListenerConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	names := make(map[string]bool, len(configs))
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("listener %d in %s has no name", i+1, path)
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("duplicate listener name %q in %s", cfg.Name, path)
+		}
+		names[cfg.Name] = true
+		if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+			return nil, fmt.Errorf("listener %q in %s: invalid address %q: %v", cfg.Name, path, cfg.Addr, err)
+		}
+		if _, err := NewFeatures(cfg.Features); err != nil {
+			return nil, fmt.Errorf("listener %q in %s: %v", cfg.Name, path, err)
+		}
+		if err := cfg.socketOptions().Check(); err != nil {
+			return nil, fmt.Errorf("listener %q in %s: %v", cfg.Name, path, err)
+		}
+		// The dashboard is only served on control addresses.
+		if slices.Contains(cfg.Features, FeatureAdmin) {
+			if err := CheckControlAddr(cfg.Addr); err != nil {
+				return nil, fmt.Errorf("listener %q in %s: feature %s needs a loopback address: %v", cfg.Name, path, FeatureAdmin, err)
+			}
+		}
+	}
+	return configs, nil
+}
+
+// listenerConfigs returns the listeners configured in the config directory, or the
+// default plain TCP and TLS listeners if there are none.
+func (s *Server) listenerConfigs() []ListenerConfig {
+	path, err := config.GetListenersPath()
+	if err == nil {
+		var configs []ListenerConfig
+		if configs, err = LoadListeners(path); err == nil && len(configs) > 0 {
+			log.Printf("Loaded %d listeners from %s", len(configs), path)
+			return configs
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to load listener configuration: %v", err)
+	}
+	return s.defaultListeners()
+}
+
+// LoadListenerConfigs reads the listeners configured in the config directory. It returns
+// nil if there are none.
+func LoadListenerConfigs() ([]ListenerConfig, error) {
+	path, err := config.GetListenersPath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadListeners(path)
+}
+
+// defaultListeners returns the plain TCP and TLS listeners served when none are configured.
+func (s *Server) defaultListeners() []ListenerConfig {
+	return []ListenerConfig{
+		{Name: "TCP", Addr: net.JoinHostPort(s.host, fmt.Sprint(s.tcpPort))},
+		{Name: "TLS", Addr: net.JoinHostPort(s.host, fmt.Sprint(s.tlsPort)), TLS: true},
+	}
+}
+
+// DefaultListeners returns the listeners served on the default ports when none are
+// configured.
+func DefaultListeners() []ListenerConfig {
+	s := &Server{host: DefaultListenAddress, tcpPort: DefaultListenPort, tlsPort: DefaultListenTLSPort}
+	return s.defaultListeners()
+}
+
+// ErrNoClientListener is returned when no listener serves WebSocket tunnels.
+var ErrNoClientListener = errors.New("no listener serves WebSocket tunnels")
+
+// ClientConfig returns the connection profile of username for clients reaching the server
+// at host. It uses the listener ClientListener picks among the configured ones, or among
+// defaults when none are configured.
+func ClientConfig(username, host string, defaults []ListenerConfig) (*clientconfig.Config, error) {
+	configs, err := LoadListenerConfigs()
+	if err != nil || len(configs) == 0 {
+		configs = defaults
+	}
+	listener, ok := ClientListener(configs)
+	if !ok {
+		return nil, ErrNoClientListener
+	}
+	_, portText, _ := net.SplitHostPort(listener.Addr)
+	port, _ := strconv.Atoi(portText)
+	header := http.Header{}
+	if TunnelKey != "" {
+		header.Set(TunnelKeyHeader, TunnelKey)
+	}
+	return clientconfig.New(username, host, port, listener.TLS, header), nil
+}
+
+// ClientListener returns the listener among configs that clients should tunnel through:
+// the first one serving WebSocket tunnels over TLS, or else the first serving them in
+// plain TCP. It reports false if no listener serves WebSocket tunnels.
+func ClientListener(configs []ListenerConfig) (ListenerConfig, bool) {
+	var plain *ListenerConfig
+	for i, cfg := range configs {
+		features := cfg.Features
+		if len(features) == 0 {
+			features = DefaultFeatures
+		}
+		if !slices.Contains(features, FeatureWebSocket) {
+			continue
+		}
+		if cfg.TLS {
+			return cfg, true
+		}
+		if plain == nil {
+			plain = &configs[i]
+		}
+	}
+	if plain == nil {
+		return ListenerConfig{}, false
+	}
+	return *plain, true
+}
+
+// serveListenerConfig binds the listener described by cfg and serves it until the server
+// shuts down.
+func (s *Server) serveListenerConfig(cfg ListenerConfig) {
+	names := cfg.Features
+	if len(names) == 0 {
+		names = DefaultFeatures
+	}
+	features, err := NewFeatures(names)
+	if err != nil {
+		log.Fatalf("Invalid %s listener: %v", cfg.Name, err)
+	}
+	wrap := func(ln net.Listener) net.Listener { return ln }
+	if cfg.TLS {
+		tlsConfig := s.tlsConfig()
+		wrap = func(ln net.Listener) net.Listener { return tls.NewListener(recordingListener{ln}, tlsConfig) }
+	}
+	s.runListener(cfg.Name, cfg.Addr, cfg.socketOptions(), features, wrap)
+}
+
+// tlsConfig returns the TLS configuration shared by all TLS listeners, generating the
+// default certificate if it does not exist yet.
+func (s *Server) tlsConfig() *tls.Config {
+	s.tlsOnce.Do(func() {
+		cert, err := s.defaultCertificate()
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate or key: %v", err)
+		}
+
+		// Serve per-hostname certificates from the SNI map, falling back to the default pair.
+		sel := loadCertSelector(&cert)
+		s.tlsCerts = sel
+		s.tlsConf = &tls.Config{GetCertificate: sel.GetCertificate}
+		if err := configureClientAuth(s.tlsConf); err != nil {
+			log.Fatalf("Failed to configure TLS client authentication: %v", err)
+		}
+		if config.Hardened {
+			if err := checkHardenedCerts(sel); err != nil {
+				log.Fatalf("Refusing to start in hardened mode: %v", err)
+			}
+			hardenTLS(s.tlsConf)
+		}
+	})
+	return s.tlsConf
+}
+
+// defaultCertificate returns the default TLS certificate: the pair at tlsCertFile and
+// tlsKeyFile, generated if it does not exist yet, or the supervisor's in a worker.
+func (s *Server) defaultCertificate() (tls.Certificate, error) {
+	if supervisor != nil {
+		return supervisor.Certificate()
+	}
+	bits := certgen.DefaultKeyBits
+	if config.Hardened {
+		bits = config.HardenedMinRSABits
+	}
+	if err := certgen.GenerateCertWithKeySize(s.tlsCertFile, s.tlsKeyFile, bits); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate TLS certificates: %v", err)
+	}
+	return tls.LoadX509KeyPair(s.tlsCertFile, s.tlsKeyFile)
+}
+
+// listenerFeatureRejections counts requests refused because their listener does not
+// enable the feature they ask for.
+var listenerFeatureRejections = metrics.NewCounterVec("ssh_ify_listener_feature_rejections_total",
+	"Requests refused because their listener does not enable the feature, by feature.", "feature")
+
+// sniff detects clients that speak SOCKS or SSH instead of HTTP, on listeners that
+// enable them, and returns the feature they ask for or "".
+func (s *Session) sniff(r *requestReader) string {
+	if !s.features.Has(FeatureSOCKS) && !s.features.Has(FeatureSSH) {
+		return ""
+	}
+	first, err := r.Peek(1)
+	if err != nil {
+		// readRequest reports the error.
+		return ""
+	}
+	switch {
+	case first[0] == socksVersion && s.features.Has(FeatureSOCKS):
+		return FeatureSOCKS
+	case first[0] == 'S' && s.features.Has(FeatureSSH):
+		if prefix, err := r.Peek(4); err == nil && string(prefix) == "SSH-" {
+			return FeatureSSH
+		}
+	}
+	return ""
+}
+
+// handleDirectSSH connects a client that speaks SSH right away to the in-process SSH
+// server. It reports whether the session was relayed.
+func (s *Session) handleDirectSSH(r *requestReader) bool {
+	log.Printf("[session %s] Direct SSH connection", s.sessionID)
+	s.preData = r.Pending()
+	s.enterPhase(PhaseSSHHandshake)
+	if err := s.startSSH(); err != nil {
+		log.Printf("[session %s] Error initializing SSH config: %v", s.sessionID, err)
+		return false
+	}
+	s.Relay()
+	return true
+}
@@ -0,0 +1,246 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// ListenersPath is the admin socket endpoint listing the tunnel listeners; PUT
+// ListenersPath/{name} with a ListenerState enables or disables one.
+const ListenersPath = "/listeners"
+
+// ListenerInfo describes a tunnel listener.
+type ListenerInfo struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	TLS       bool   `json:"tls"`
+	Enabled   bool   `json:"enabled"`   // Whether an admin left the listener enabled
+	Listening bool   `json:"listening"` // Whether its accept loop is running
+}
+
+// ListenerState is the body of a request enabling or disabling a listener.
+type ListenerState struct {
+	Enabled bool `json:"enabled"`
+	Persist bool `json:"persist,omitempty"` // Keep the state across restarts
+}
+
+// listenerSwitches holds which listeners an admin disabled at runtime.
+type listenerSwitches struct {
+	mu       sync.Mutex
+	disabled map[string]bool
+	changed  chan struct{} // Closed and replaced whenever disabled changes
+}
+
+// enabled reports whether the listener name is enabled, and returns a channel closed on
+// the next change.
+func (ls *listenerSwitches) enabled(name string) (bool, <-chan struct{}) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.changed == nil {
+		ls.changed = make(chan struct{})
+	}
+	return !ls.disabled[name], ls.changed
+}
+
+// set enables or disables the listener name and returns the names of all disabled listeners.
+func (ls *listenerSwitches) set(name string, enabled bool) []string {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.disabled == nil {
+		ls.disabled = make(map[string]bool)
+	}
+	if enabled {
+		delete(ls.disabled, name)
+	} else {
+		ls.disabled[name] = true
+	}
+	if ls.changed != nil {
+		close(ls.changed)
+	}
+	ls.changed = make(chan struct{})
+
+	names := make([]string, 0, len(ls.disabled))
+	for n := range ls.disabled {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadListenerStates disables the listeners persisted as disabled by an admin.
+func (s *Server) loadListenerStates() {
+	path, err := config.GetListenerStatePath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read listener state: %v", err)
+		}
+		return
+	}
+	var disabled []string
+	if err := json.Unmarshal(data, &disabled); err != nil {
+		log.Printf("Failed to parse listener state %s: %v", path, err)
+		return
+	}
+	for _, name := range disabled {
+		s.switches.set(name, false)
+		log.Printf("%s listener disabled by %s", name, path)
+	}
+}
+
+// awaitListenerEnabled blocks while the listener name is disabled and reports whether it
+// is enabled, or false once the server stops listening.
+func (s *Server) awaitListenerEnabled(name string) bool {
+	for {
+		enabled, changed := s.switches.enabled(name)
+		if enabled {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-s.listenCtx.Done():
+			return false
+		}
+	}
+}
+
+// setListenerEnabled enables or disables the listener name, closing its socket when it
+// is disabled. Sessions already accepted on it continue. With persist the disabled
+// listeners are saved so that they stay disabled after a restart.
+func (s *Server) setListenerEnabled(name string, enabled, persist bool) error {
+	if _, ok := s.listenerConfig(name); !ok {
+		return fmt.Errorf("unknown listener %q", name)
+	}
+	if workerListener != "" {
+		// The worker could not bind a privileged port again once it closed the socket.
+		return fmt.Errorf("listeners cannot be disabled with privilege separation")
+	}
+	disabled := s.switches.set(name, enabled)
+	if !enabled {
+		if l, ok := s.listeners.Load(name); ok {
+			l.(*listener).ln.Close()
+		}
+	}
+	if persist {
+		path, err := config.GetListenerStatePath()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(disabled)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return fmt.Errorf("failed to save listener state: %v", err)
+		}
+	}
+	return nil
+}
+
+// listenerConfig returns the configuration of the listener name.
+func (s *Server) listenerConfig(name string) (ListenerConfig, bool) {
+	for _, cfg := range s.listenerCfgs {
+		if cfg.Name == name {
+			return cfg, true
+		}
+	}
+	return ListenerConfig{}, false
+}
+
+// listenerInfos describes the configured listeners in order.
+func (s *Server) listenerInfos() []ListenerInfo {
+	infos := make([]ListenerInfo, 0, len(s.listenerCfgs))
+	for _, cfg := range s.listenerCfgs {
+		if !servesListener(cfg.Name) {
+			continue
+		}
+		info := ListenerInfo{Name: cfg.Name, Addr: cfg.Addr, TLS: cfg.TLS}
+		info.Enabled, _ = s.switches.enabled(cfg.Name)
+		_, info.Listening = s.listeners.Load(cfg.Name)
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// handleListeners lists the listeners on the admin socket.
+func (s *Server) handleListeners(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.listenerInfos())
+}
+
+// handleSetListener enables or disables the listener named in the path on the admin socket.
+func (s *Server) handleSetListener(w http.ResponseWriter, r *http.Request) {
+	var req ListenerState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	if err := s.setListenerEnabled(name, req.Enabled, req.Persist); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	state := "disabled"
+	if req.Enabled {
+		state = "enabled"
+	}
+	log.Printf("Admin socket: %s listener %s", name, state)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FetchListeners requests the listeners through an admin socket client.
+func FetchListeners(ctx context.Context, client *http.Client) ([]ListenerInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://admin"+ListenersPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+	var infos []ListenerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// SetListener enables or disables the listener name through an admin socket client.
+func SetListener(ctx context.Context, client *http.Client, name string, state ListenerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://admin"+ListenersPath+"/"+url.PathEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("admin socket returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// LocksPath is the admin socket endpoint for account locks; DELETE LocksPath/{user}
+// unlocks one.
+const LocksPath = "/locks"
+
+// handleUnlock lifts the lock of the account named in the path on the admin socket and
+// forgets its failed logins, so that it is not locked again by its next mistake.
+func handleUnlock(w http.ResponseWriter, r *http.Request) {
+	user := r.PathValue("user")
+	db := ssh.GetUserDB()
+	if db == nil {
+		http.Error(w, "user database not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if err := db.UnlockUser(user); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	limits.Shared().ResetFailures(limits.AccountKey(user))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser lifts the lock of an account through an admin socket client.
+func UnlockUser(ctx context.Context, client *http.Client, user string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "http://admin"+LocksPath+"/"+url.PathEscape(user), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// MaintenancePath is the admin socket endpoint for maintenance mode: GET reports it, PUT
+// with a MaintenanceRequest starts it and DELETE ends it.
+const MaintenancePath = "/maintenance"
+
+// MaintenanceMessage is sent, translated, to new clients during maintenance when no
+// message was given. It is read from SSH_IFY_MAINTENANCE_MESSAGE.
+var MaintenanceMessage = config.Env("SSH_IFY_MAINTENANCE_MESSAGE",
+	"The server is under maintenance, please try again later.")
+
+// maintenanceRefusals counts sessions refused during maintenance.
+var maintenanceRefusals = metrics.NewCounter("ssh_ify_maintenance_refused_sessions_total",
+	"Sessions refused because the server is in maintenance mode.")
+
+// MaintenanceRequest starts maintenance mode.
+type MaintenanceRequest struct {
+	Message    string        `json:"message,omitempty"`     // Shown to new clients; defaults to MaintenanceMessage
+	ShutdownIn time.Duration `json:"shutdown_in,omitempty"` // Close all sessions after this long; 0 keeps them open
+	WarnBefore time.Duration `json:"warn_before,omitempty"` // Warn connected users this long before closing their sessions
+}
+
+// Maintenance describes maintenance mode while it is on.
+type Maintenance struct {
+	Since      time.Time `json:"since"`
+	Message    string    `json:"message"`
+	ShutdownAt time.Time `json:"shutdown_at,omitzero"` // When all sessions are closed, if scheduled
+
+	timers []*time.Timer
+}
+
+// startMaintenance refuses new sessions until endMaintenance is called and schedules the
+// warning and shutdown of req. It replaces any maintenance already in progress.
+func (s *Server) startMaintenance(req MaintenanceRequest) *Maintenance {
+	m := &Maintenance{Since: s.clock.Now(), Message: req.Message}
+	if m.Message == "" {
+		m.Message = i18n.T(MaintenanceMessage)
+	}
+	if req.ShutdownIn > 0 {
+		m.ShutdownAt = m.Since.Add(req.ShutdownIn)
+		if req.WarnBefore > 0 {
+			warning := i18n.Sprintf("All sessions will be closed for maintenance in %s: %s", min(req.WarnBefore, req.ShutdownIn), m.Message)
+			m.timers = append(m.timers, time.AfterFunc(max(req.ShutdownIn-req.WarnBefore, 0), func() {
+				n := ssh.Broadcast(warning)
+				log.Printf("Maintenance: warned %d SSH sessions: %s", n, warning)
+			}))
+		}
+		m.timers = append(m.timers, time.AfterFunc(req.ShutdownIn, func() {
+			log.Println("Maintenance: closing all sessions")
+			s.conns.Range(func(key, value any) bool {
+				key.(*Session).Close()
+				return true
+			})
+		}))
+	}
+
+	s.maintenanceMutex.Lock()
+	previous := s.maintenance
+	s.maintenance = m
+	s.maintenanceMutex.Unlock()
+	previous.stop()
+
+	if m.ShutdownAt.IsZero() {
+		log.Printf("Maintenance mode on: %s", m.Message)
+	} else {
+		log.Printf("Maintenance mode on, closing all sessions at %s: %s", m.ShutdownAt.Format(time.RFC3339), m.Message)
+	}
+	return m
+}
+
+// endMaintenance accepts new sessions again and cancels any scheduled shutdown. It
+// reports whether maintenance mode was on.
+func (s *Server) endMaintenance() bool {
+	s.maintenanceMutex.Lock()
+	previous := s.maintenance
+	s.maintenance = nil
+	s.maintenanceMutex.Unlock()
+	if previous == nil {
+		return false
+	}
+	previous.stop()
+	log.Println("Maintenance mode off")
+	return true
+}
+
+// currentMaintenance returns the maintenance in progress, or nil.
+func (s *Server) currentMaintenance() *Maintenance {
+	s.maintenanceMutex.Lock()
+	defer s.maintenanceMutex.Unlock()
+	return s.maintenance
+}
+
+// stop cancels the scheduled warning and shutdown of m, if any.
+func (m *Maintenance) stop() {
+	if m == nil {
+		return
+	}
+	for _, t := range m.timers {
+		t.Stop()
+	}
+}
+
+// refuseInMaintenance refuses the session during maintenance and reports whether it did
+// so. HTTP clients get a 503 response carrying the maintenance message.
+func (s *Session) refuseInMaintenance(isHTTP bool) bool {
+	m := s.server.currentMaintenance()
+	if m == nil {
+		return false
+	}
+	maintenanceRefusals.Inc()
+	log.Printf("[session %s] Server in maintenance, refusing session", s.sessionID)
+	if isHTTP {
+		s.client.Write([]byte(m.response(s)))
+	}
+	return true
+}
+
+// response returns the 503 response sent to HTTP clients during m. It keeps the headers
+// of a custom 503 response, if one is configured.
+func (m *Maintenance) response(s *Session) string {
+	tmpl := s.server.responses[http.StatusServiceUnavailable]
+	headers := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	for name, value := range tmpl.Headers {
+		headers[name] = value
+	}
+	if !m.ShutdownAt.IsZero() {
+		if wait := m.ShutdownAt.Sub(s.clock.Now()); wait > 0 {
+			headers["Retry-After"] = strconv.Itoa(int(wait.Seconds()) + 1)
+		}
+	}
+	tmpl.Headers, tmpl.Body = headers, m.Message+"\n"
+	return tmpl.render(http.StatusServiceUnavailable, s.sessionID)
+}
+
+// handleMaintenance serves maintenance mode on the admin socket.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req MaintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ShutdownIn < 0 || req.WarnBefore < 0 {
+			http.Error(w, "durations must not be negative", http.StatusBadRequest)
+			return
+		}
+		s.startMaintenance(req)
+	case http.MethodDelete:
+		s.endMaintenance()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.currentMaintenance())
+}
+
+// FetchMaintenance returns the maintenance in progress, or nil, through an admin socket client.
+func FetchMaintenance(ctx context.Context, client *http.Client) (*Maintenance, error) {
+	return maintenanceRequest(ctx, client, http.MethodGet, nil)
+}
+
+// StartMaintenance starts maintenance mode through an admin socket client.
+func StartMaintenance(ctx context.Context, client *http.Client, req MaintenanceRequest) (*Maintenance, error) {
+	return maintenanceRequest(ctx, client, http.MethodPut, &req)
+}
+
+// EndMaintenance ends maintenance mode through an admin socket client.
+func EndMaintenance(ctx context.Context, client *http.Client) error {
+	_, err := maintenanceRequest(ctx, client, http.MethodDelete, nil)
+	return err
+}
+
+// maintenanceRequest sends a request to the maintenance endpoint and decodes the reply.
+func maintenanceRequest(ctx context.Context, client *http.Client, method string, body *MaintenanceRequest) (*Maintenance, error) {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://admin"+MaintenancePath, payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusOK:
+		var m *Maintenance
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if text := strings.TrimSpace(string(msg)); text != "" {
+			return nil, fmt.Errorf("%s", text)
+		}
+		return nil, fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+}
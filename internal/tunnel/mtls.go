@@ -0,0 +1,52 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// ClientCAFile is the PEM bundle of certificate authorities that client certificates on
+// the TLS listener are verified against. It is read from SSH_IFY_CLIENT_CA; when empty,
+// client certificates are not requested.
+var ClientCAFile = config.Env("SSH_IFY_CLIENT_CA", "")
+
+// configureClientAuth enables mutual TLS on tlsConfig when ClientCAFile is set. Clients
+// must present a certificate only if ssh.ClientCertAuth requires one.
+func configureClientAuth(tlsConfig *tls.Config) error {
+	if ClientCAFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if ssh.ClientCertAuth == ssh.ClientCertRequired {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// clientCert returns the verified TLS client certificate of the session, or nil when the
+// client connected without TLS or without a certificate.
+func (s *Session) clientCert() *x509.Certificate {
+	tlsConn, ok := s.client.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
@@ -0,0 +1,111 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// Answers to plain HTTP requests on the TLS port
+const (
+	// PlainHTTPPage answers with 400 Bad Request and a page explaining that the port
+	// expects TLS, or the custom 400 response if one is configured.
+	PlainHTTPPage = "page"
+
+	// PlainHTTPRedirect redirects to the same host and path over HTTPS, which suits
+	// browsers and HTTP clients; requests without a Host header get the page instead.
+	PlainHTTPRedirect = "redirect"
+
+	// PlainHTTPClose closes the connection without an answer.
+	PlainHTTPClose = "close"
+)
+
+// PlainHTTPOnTLS selects how plain HTTP requests to the TLS port are answered:
+// PlainHTTPPage, the default, PlainHTTPRedirect or PlainHTTPClose. It is read from
+// SSH_IFY_PLAIN_HTTP_ON_TLS.
+var PlainHTTPOnTLS = config.Env("SSH_IFY_PLAIN_HTTP_ON_TLS", PlainHTTPPage)
+
+// plainHTTPPage is the body of the PlainHTTPPage answer.
+const plainHTTPPage = `<!DOCTYPE html>
+<html><head><title>400 Bad Request</title></head>
+<body>
+<h1>This port expects TLS</h1>
+<p>Your client sent a plain HTTP request to a port that only accepts TLS (HTTPS) connections.</p>
+<p>Enable TLS/SSL in your tunnel client, or connect to the plain HTTP port instead.</p>
+<p>Reference: {session_id}</p>
+</body></html>
+`
+
+// recordingListener records the first bytes read from each accepted connection until
+// its TLS handshake completes, so that a plain HTTP request the TLS library has already
+// read can still be parsed.
+type recordingListener struct {
+	net.Listener
+}
+
+func (l recordingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{Conn: conn}, nil
+}
+
+// recordingConn keeps up to MaxHeaderSize bytes of what is read from it until stopped.
+type recordingConn struct {
+	net.Conn
+	mu       sync.Mutex
+	recorded []byte
+	stopped  bool
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	if !c.stopped {
+		c.recorded = append(c.recorded, p[:n]...)
+		c.stopped = int64(len(c.recorded)) >= MaxHeaderSize
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// stop ends recording and returns what was recorded.
+func (c *recordingConn) stop() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	recorded := c.recorded
+	c.recorded, c.stopped = nil, true
+	return recorded
+}
+
+// answerPlainHTTP answers the plain HTTP request that was sent to the TLS port on conn.
+func (s *Session) answerPlainHTTP(conn net.Conn) {
+	if PlainHTTPOnTLS == PlainHTTPClose {
+		return
+	}
+	var read []byte
+	if rec, ok := conn.(*recordingConn); ok {
+		read = rec.stop()
+	}
+	conn.SetDeadline(time.Now().Add(RequestHeaderTimeout.Load()))
+	r := io.MultiReader(bytes.NewReader(read), io.LimitReader(conn, MaxHeaderSize-int64(len(read))))
+	req, err := http.ReadRequest(bufio.NewReader(r))
+
+	tmpl, ok := s.server.responses[http.StatusBadRequest]
+	if !ok {
+		tmpl = ResponseTemplate{Body: plainHTTPPage}
+	}
+	code := http.StatusBadRequest
+	if PlainHTTPOnTLS == PlainHTTPRedirect && err == nil && req.Host != "" {
+		tmpl = ResponseTemplate{Headers: map[string]string{"Location": "https://" + req.Host + req.URL.RequestURI()}}
+		code = http.StatusMovedPermanently
+	}
+	io.WriteString(conn, tmpl.render(code, s.sessionID))
+}
@@ -0,0 +1,252 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Polled session buffers
+const (
+	// pollPendingLimit bounds the downstream bytes buffered per polled session; the SSH
+	// stream is paused while it is full.
+	pollPendingLimit = 256 * 1024
+
+	// pollUpstreamQueue is the number of upstream datagrams queued per session before
+	// exchanges wait for the SSH stream to catch up.
+	pollUpstreamQueue = 64
+)
+
+// pollSession is the server side of an SSH stream carried by datagrams the client sends
+// and the server answers, as in the DNS and ICMP transports. The client must poll for
+// downstream data.
+type pollSession struct {
+	id   string
+	conn net.Conn // Pipe end connected to the tunnel session's client side
+
+	upstream  chan []byte   // Upstream data waiting to be written, in order
+	done      chan struct{} // Closed when the session is closed
+	closeOnce sync.Once
+
+	exchangeMutex sync.Mutex // Keeps exchanges in order
+
+	mutex     sync.Mutex
+	cond      *sync.Cond // Signalled when pending shrinks or the session closes
+	pending   []byte     // Downstream bytes not yet sent
+	closed    bool       // Set once the tunnel session ended
+	lastSeq   string     // Sequence number of the last exchange
+	lastReply []byte     // Downstream data sent for lastSeq
+	lastSeen  time.Time
+}
+
+// readDownstream buffers data from the tunnel session until it ends.
+func (p *pollSession) readDownstream() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := p.conn.Read(buf)
+		p.mutex.Lock()
+		for len(p.pending) >= pollPendingLimit && !p.closed {
+			p.cond.Wait()
+		}
+		p.pending = append(p.pending, buf[:n]...)
+		if err != nil {
+			p.closed = true
+		}
+		p.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeUpstream writes queued upstream data to the tunnel session until it is closed.
+// Writes block until the relay reads, which must not delay answering the client.
+func (p *pollSession) writeUpstream() {
+	for {
+		select {
+		case data := <-p.upstream:
+			if _, err := p.conn.Write(data); err != nil {
+				p.close()
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// exchange queues upstream data for seq and returns up to max pending downstream bytes.
+// A repeated seq returns the previous downstream bytes again without queueing data, so
+// retransmitted datagrams are harmless. io.EOF is returned once the tunnel session
+// ended and all its data was sent.
+func (p *pollSession) exchange(seq string, data []byte, max int) ([]byte, error) {
+	p.exchangeMutex.Lock()
+	defer p.exchangeMutex.Unlock()
+
+	p.mutex.Lock()
+	p.lastSeen = time.Now()
+	if seq == p.lastSeq {
+		defer p.mutex.Unlock()
+		return p.lastReply, nil
+	}
+	p.mutex.Unlock()
+
+	if len(data) > 0 {
+		select {
+		case p.upstream <- data:
+		case <-p.done:
+			return nil, io.ErrClosedPipe
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed && len(p.pending) == 0 {
+		return nil, io.EOF
+	}
+	n := min(max, len(p.pending))
+	reply := append([]byte(nil), p.pending[:n]...)
+	p.pending = p.pending[n:]
+	p.cond.Broadcast()
+	p.lastSeq, p.lastReply = seq, reply
+	return reply, nil
+}
+
+// close ends the session and unblocks its reader and writer.
+func (p *pollSession) close() {
+	p.closeOnce.Do(func() { close(p.done) })
+	p.conn.Close()
+	p.mutex.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mutex.Unlock()
+}
+
+// pollConn is the client side of a polled session, reporting the peer the session was
+// opened from as its remote address.
+type pollConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+// RemoteAddr returns the address the session was opened from.
+func (c *pollConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// pollSessions tracks the polled sessions of one transport.
+type pollSessions struct {
+	server      *Server
+	transport   string        // Transport name used in logs, e.g. "DNS"
+	maxSessions int           // Sessions open at once; they are opened before authentication
+	idleTimeout time.Duration // Sessions not exchanged with for this long are closed
+	idBytes     int           // Random bytes in each session ID
+
+	mutex    sync.Mutex
+	sessions map[string]*pollSession
+}
+
+// newPollSessions returns an empty registry and starts expiring its idle sessions.
+func newPollSessions(s *Server, transport string, maxSessions int, idleTimeout time.Duration, idBytes int) *pollSessions {
+	r := &pollSessions{
+		server:      s,
+		transport:   transport,
+		maxSessions: maxSessions,
+		idleTimeout: idleTimeout,
+		idBytes:     idBytes,
+		sessions:    make(map[string]*pollSession),
+	}
+	go r.expire()
+	return r
+}
+
+// expire closes idle sessions, and every session once the server stops listening.
+func (r *pollSessions) expire() {
+	ticker := time.NewTicker(r.idleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.server.listenCtx.Done():
+			r.mutex.Lock()
+			for id, sess := range r.sessions {
+				sess.close()
+				delete(r.sessions, id)
+			}
+			r.mutex.Unlock()
+			return
+		case <-ticker.C:
+			r.mutex.Lock()
+			for id, sess := range r.sessions {
+				sess.mutex.Lock()
+				idle := time.Since(sess.lastSeen) > r.idleTimeout
+				sess.mutex.Unlock()
+				if idle {
+					log.Printf("%s session %s idle, closing", r.transport, id)
+					sess.close()
+					delete(r.sessions, id)
+				}
+			}
+			r.mutex.Unlock()
+		}
+	}
+}
+
+// open starts a tunnel session for a new polled session from addr and returns its ID.
+func (r *pollSessions) open(addr net.Addr) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.sessions) >= r.maxSessions {
+		return "", fmt.Errorf("too many %s sessions", r.transport)
+	}
+	raw := make([]byte, r.idBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+	if _, exists := r.sessions[id]; exists {
+		return "", errors.New("session ID collision")
+	}
+
+	serverEnd, clientEnd := net.Pipe()
+	sess := &pollSession{
+		id:       id,
+		conn:     serverEnd,
+		upstream: make(chan []byte, pollUpstreamQueue),
+		done:     make(chan struct{}),
+		lastSeq:  "-",
+		lastSeen: time.Now(),
+	}
+	sess.cond = sync.NewCond(&sess.mutex)
+	r.sessions[id] = sess
+	go sess.readDownstream()
+	go sess.writeUpstream()
+
+	tunnelSession := NewSession(&pollConn{Conn: clientEnd, remote: addr}, r.server)
+	log.Printf("[session %s] %s session %s opened from %s", tunnelSession.sessionID, r.transport, id, addr)
+	go tunnelSession.HandleStream()
+	return id, nil
+}
+
+// lookup returns the session with the given ID, or nil.
+func (r *pollSessions) lookup(id string) *pollSession {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.sessions[id]
+}
+
+// remove closes and forgets the session with the given ID.
+func (r *pollSessions) remove(id string) {
+	r.mutex.Lock()
+	sess, ok := r.sessions[id]
+	delete(r.sessions, id)
+	r.mutex.Unlock()
+	if ok {
+		sess.close()
+	}
+}
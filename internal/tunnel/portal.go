@@ -0,0 +1,243 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+)
+
+// PortalAddr is the address the end-user self-service portal listens on with TLS, e.g.
+// ":8444". It is read from SSH_IFY_PORTAL_ADDR; when empty, the portal is disabled.
+var PortalAddr = config.Env("SSH_IFY_PORTAL_ADDR", "")
+
+// portalUI holds the single-page portal served at "/".
+//
+//go:embed portal
+var portalUI embed.FS
+
+// portal serves the self-service portal and its JSON API to users signed in with a
+// user token.
+type portal struct {
+	server *Server
+	db     *usermgmt.UserDB
+}
+
+// servePortal serves the self-service portal on PortalAddr with the TLS certificates of
+// the tunnel listeners until the server stops listening.
+func (s *Server) servePortal() {
+	if PortalAddr == "" {
+		return
+	}
+	tcpLn, err := s.listen("portal", PortalAddr)
+	if err != nil {
+		log.Printf("Self-service portal disabled: %v", err)
+		return
+	}
+	// Share the user database the SSH server authenticates against.
+	if ssh.GetUserDB() == nil {
+		ssh.InitializeAuth("")
+	}
+	p := &portal{server: s, db: ssh.GetUserDB()}
+
+	ui, _ := fs.Sub(portalUI, "portal")
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServer(http.FS(ui)))
+	mux.HandleFunc("POST /api/login", p.handleLogin)
+	mux.HandleFunc("POST /api/logout", p.auth(p.handleLogout))
+	mux.HandleFunc("GET /api/account", p.auth(p.handleAccount))
+	mux.HandleFunc("POST /api/password", p.auth(p.handlePassword))
+	mux.HandleFunc("GET /api/client-config", p.auth(p.handleClientConfig))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-s.listenCtx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Self-service portal listening on %s", PortalAddr)
+	if err := srv.Serve(tls.NewListener(tcpLn, s.tlsConfig())); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Self-service portal stopped: %v", err)
+	}
+}
+
+// auth wraps h so that it only runs for requests carrying a valid user token in the
+// Authorization header, passing the name of the signed-in user.
+func (p *portal) auth(h func(w http.ResponseWriter, r *http.Request, user string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		user, err := p.db.AuthenticateUserToken(token)
+		if errors.Is(err, usermgmt.ErrInvalidUserToken) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("Portal: failed to check user token: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to check token")
+			return
+		}
+		h(w, r, user)
+	}
+}
+
+// requestAddr returns the SSH session address of a portal request, so that logins are
+// logged, throttled and counted towards bans like SSH logins.
+func requestAddr(r *http.Request) ssh.SessionAddr {
+	addr := ssh.SessionAddr{ID: newSessionID(time.Now()), Client: &net.TCPAddr{}}
+	if client, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		addr.Client = client
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+		addr.ClientCert = r.TLS.PeerCertificates[0]
+	}
+	return addr
+}
+
+// handleLogin checks a user's credentials and returns a user token.
+func (p *portal) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := ssh.AuthenticateUpgrade(requestAddr(r), req.Username, req.Password); err != nil {
+		if errors.Is(err, ssh.ErrPolicyDenied) {
+			writeError(w, http.StatusForbidden, "login refused")
+			return
+		}
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+	token, expires, err := p.db.CreateUserToken(req.Username, usermgmt.UserTokenTTL)
+	if err != nil {
+		log.Printf("Portal: failed to create token for user '%s': %v", req.Username, err)
+		writeError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	log.Printf("Portal: user '%s' signed in from %s", req.Username, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]any{"token": token, "expires": expires})
+}
+
+// handleLogout revokes the token the request was made with.
+func (p *portal) handleLogout(w http.ResponseWriter, r *http.Request, user string) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := p.db.RevokeUserToken(token); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// usageView is the usage of a user in the current month.
+type usageView struct {
+	Month    string  `json:"month"`
+	Sessions int     `json:"sessions"`
+	BytesIn  int64   `json:"bytes_in"`
+	BytesOut int64   `json:"bytes_out"`
+	Hours    float64 `json:"hours"`
+}
+
+// accountView is the JSON representation of a user's own account.
+type accountView struct {
+	Username    string        `json:"username"`
+	Plan        string        `json:"plan,omitempty"`
+	Schedule    string        `json:"schedule"`
+	Expires     string        `json:"expires"`
+	DaysLeft    int           `json:"days_left"`
+	MaxSessions int           `json:"max_sessions"`
+	Sessions    []SessionInfo `json:"sessions"`
+	Usage       usageView     `json:"usage"`
+}
+
+// handleAccount returns the status, active sessions and monthly usage of the user.
+func (p *portal) handleAccount(w http.ResponseWriter, r *http.Request, user string) {
+	status := ssh.AccountStatus(user)
+	view := accountView{
+		Username:    user,
+		Plan:        status.Plan,
+		Schedule:    status.Schedule,
+		Expires:     status.Expires,
+		DaysLeft:    status.DaysLeft,
+		MaxSessions: status.MaxSessions,
+		Sessions:    []SessionInfo{},
+	}
+	for _, sess := range p.server.Stats().Sessions {
+		if sess.User == user {
+			view.Sessions = append(view.Sessions, sess)
+		}
+	}
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	view.Usage.Month = start.Format("2006-01")
+	records, err := p.server.usage.Records(start, now)
+	if err != nil {
+		log.Printf("Portal: failed to read usage of user '%s': %v", user, err)
+	}
+	for _, u := range accounting.Summarize(records) {
+		if u.Username == user {
+			view.Usage.Sessions = u.Sessions
+			view.Usage.BytesIn = u.BytesIn
+			view.Usage.BytesOut = u.BytesOut
+			view.Usage.Hours = u.Connected.Hours()
+		}
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// passwordChange is the request body for changing the signed-in user's password.
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+// handlePassword changes the password of the user after checking the current one.
+func (p *portal) handlePassword(w http.ResponseWriter, r *http.Request, user string) {
+	var req passwordChange
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := ssh.AuthenticateUpgrade(requestAddr(r), user, req.CurrentPassword); err != nil {
+		writeError(w, http.StatusForbidden, "current password is incorrect")
+		return
+	}
+	if err := p.db.UpdatePassword(user, req.Password); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Portal: user '%s' changed their password from %s", user, r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClientConfig returns the connection profile of the user as a download, for the
+// host the portal was reached at.
+func (p *portal) handleClientConfig(w http.ResponseWriter, r *http.Request, user string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	cfg, err := ClientConfig(user, host, p.server.defaultListeners())
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "ssh-ify-" + user + ".json"}))
+	cfg.WriteJSON(w)
+}
@@ -0,0 +1,218 @@
+package tunnel
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Proof-of-work headers
+const (
+	// PoWChallengeHeader carries a challenge in the response to requests that must prove
+	// work: "<bits>.<unix time>.<nonce>.<signature>".
+	PoWChallengeHeader = "X-Tunnel-PoW-Challenge"
+
+	// PoWSolutionHeader carries "<challenge>:<counter>" on the retried request, where the
+	// SHA-256 of the whole value has at least <bits> leading zero bits.
+	PoWSolutionHeader = "X-Tunnel-PoW"
+)
+
+// Proof-of-work modes
+const (
+	PoWOff    = "off"    // Never challenge clients
+	PoWAuto   = "auto"   // Challenge new requests while the server is under load
+	PoWAlways = "always" // Challenge every new request
+)
+
+// PoWChallengeTTL is how long a challenge can be solved and presented after it was issued.
+const PoWChallengeTTL = time.Minute
+
+// powMemoryLoad is the share of the memory budget in use at which PoWAuto starts
+// challenging new requests.
+const powMemoryLoad = 0.8
+
+// Proof-of-work configuration, read from the environment at startup.
+var (
+	// PoWMode selects when upgrade requests must solve a proof-of-work challenge before
+	// the tunnel is set up: PoWOff, the default, PoWAuto or PoWAlways. It is read from
+	// SSH_IFY_POW.
+	PoWMode = config.Env("SSH_IFY_POW", PoWOff)
+
+	// PoWDifficulty is the number of leading zero bits a solution needs; each bit doubles
+	// the work. It is read from SSH_IFY_POW_DIFFICULTY.
+	PoWDifficulty = config.EnvInt("SSH_IFY_POW_DIFFICULTY", 18)
+
+	// PoWPreAuthThreshold is the number of connections waiting to authenticate at which
+	// PoWAuto starts challenging new requests. It is read from
+	// SSH_IFY_POW_PREAUTH_THRESHOLD.
+	PoWPreAuthThreshold = config.EnvInt("SSH_IFY_POW_PREAUTH_THRESHOLD", 128)
+
+	// PoWSecret signs challenges. It is read from SSH_IFY_POW_SECRET and must be shared by
+	// the nodes behind one load balancer; when empty, a random secret is used.
+	PoWSecret = config.Env("SSH_IFY_POW_SECRET", "")
+)
+
+// powChallenges counts proof-of-work challenges by result: "issued", "solved", "invalid",
+// "expired", "weak", "replayed" or "unsupported" for SOCKS and raw SSH clients, which
+// cannot be challenged.
+var powChallenges = metrics.NewCounterVec("ssh_ify_pow_challenges_total",
+	"Proof-of-work challenges issued to clients and solutions received, by result.", "result")
+
+// powKey is the key challenges are signed with.
+var powKey = func() []byte {
+	if PoWSecret != "" {
+		return []byte(PoWSecret)
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// CheckPoW validates the proof-of-work settings.
+func CheckPoW() error {
+	switch PoWMode {
+	case PoWOff, PoWAuto, PoWAlways:
+	default:
+		return fmt.Errorf("unknown SSH_IFY_POW %q (expected %s, %s or %s)", PoWMode, PoWOff, PoWAuto, PoWAlways)
+	}
+	if PoWDifficulty < 1 || PoWDifficulty > 32 {
+		return fmt.Errorf("SSH_IFY_POW_DIFFICULTY must be between 1 and 32, not %d", PoWDifficulty)
+	}
+	return nil
+}
+
+// powRequired reports whether new requests must prove work now.
+func (s *Server) powRequired() bool {
+	switch PoWMode {
+	case PoWAlways:
+		return true
+	case PoWAuto:
+		if PoWPreAuthThreshold > 0 && s.PreAuthSessions() >= PoWPreAuthThreshold {
+			return true
+		}
+		return MemoryBudget > 0 && float64(MemoryInUse()) >= powMemoryLoad*float64(MemoryBudget)
+	}
+	return false
+}
+
+// newPoWChallenge returns a challenge of the given difficulty issued at now.
+func newPoWChallenge(difficulty int, now time.Time) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	payload := strconv.Itoa(difficulty) + "." + strconv.FormatInt(now.Unix(), 10) + "." + hex.EncodeToString(nonce)
+	mac := hmac.New(sha256.New, powKey)
+	mac.Write([]byte(payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// powZeroBits returns the number of leading zero bits of the SHA-256 of value.
+func powZeroBits(value string) int {
+	sum := sha256.Sum256([]byte(value))
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// SolvePoW returns a value for PoWSolutionHeader solving challenge, as client software
+// does on a response carrying PoWChallengeHeader.
+func SolvePoW(challenge string) (string, error) {
+	prefix, _, ok := strings.Cut(challenge, ".")
+	difficulty, err := strconv.Atoi(prefix)
+	if !ok || err != nil || difficulty < 1 || difficulty > 32 {
+		return "", fmt.Errorf("invalid proof-of-work challenge %q", challenge)
+	}
+	for counter := uint64(0); ; counter++ {
+		solution := challenge + ":" + strconv.FormatUint(counter, 10)
+		if powZeroBits(solution) >= difficulty {
+			return solution, nil
+		}
+	}
+}
+
+// checkPoWSolution checks a PoWSolutionHeader value at now, remembering its challenge so
+// that it is not accepted again. It returns the result counted for it: "solved" or why
+// it was refused.
+func checkPoWSolution(solution string, now time.Time) string {
+	challenge, counter, ok := strings.Cut(solution, ":")
+	parts := strings.Split(challenge, ".")
+	if !ok || len(counter) > 20 || len(parts) != 4 {
+		return "invalid"
+	}
+	mac := hmac.New(sha256.New, powKey)
+	mac.Write([]byte(parts[0] + "." + parts[1] + "." + parts[2]))
+	if !hmac.Equal([]byte(parts[3]), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		return "invalid"
+	}
+	difficulty, err1 := strconv.Atoi(parts[0])
+	unix, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return "invalid"
+	}
+	issued := time.Unix(unix, 0)
+	if now.Before(issued.Add(-time.Minute)) || now.After(issued.Add(PoWChallengeTTL)) {
+		return "expired"
+	}
+	// The challenge may have been issued before the difficulty was raised.
+	if difficulty < PoWDifficulty || powZeroBits(solution) < difficulty {
+		return "weak"
+	}
+	if !usedNonces.add("pow:"+parts[2], now, issued.Add(PoWChallengeTTL)) {
+		return "replayed"
+	}
+	return "solved"
+}
+
+// checkPoW reports whether req may proceed without proving work, or proved it. Otherwise
+// it answers with a fresh challenge, or a 403 response to a bad solution, and closes.
+func (s *Session) checkPoW(req *http.Request) bool {
+	if !s.server.powRequired() {
+		return true
+	}
+	now := s.clock.Now()
+	if solution := req.Header.Get(PoWSolutionHeader); solution != "" {
+		result := checkPoWSolution(solution, now)
+		powChallenges.Inc(result)
+		if result == "solved" {
+			return true
+		}
+		logsample.Printf(logsample.ProofOfWork, "[session %s] Proof of work %s", s.sessionID, result)
+		if result == "invalid" || result == "replayed" {
+			s.respond(http.StatusForbidden)
+			return false
+		}
+	}
+	powChallenges.Inc("issued")
+	logsample.Printf(logsample.ProofOfWork, "[session %s] Asking %s for proof of work", s.sessionID, s.client.RemoteAddr())
+	fmt.Fprintf(s.client, "HTTP/1.1 428 Precondition Required\r\n%s: %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n",
+		PoWChallengeHeader, newPoWChallenge(PoWDifficulty, now))
+	return false
+}
+
+// refuseWithoutPoW reports whether the session, a SOCKS or raw SSH client that cannot
+// be challenged, is refused because new connections must prove work now. Such clients
+// would otherwise bypass the proof of work that HTTP clients are asked for.
+func (s *Session) refuseWithoutPoW(feature string) bool {
+	if !s.server.powRequired() {
+		return false
+	}
+	powChallenges.Inc("unsupported")
+	logsample.Printf(logsample.ProofOfWork, "[session %s] Proof of work required, refusing %s client %s",
+		s.sessionID, feature, s.client.RemoteAddr())
+	return true
+}
@@ -0,0 +1,48 @@
+package tunnel
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestPoWRefusesSniffedProtocols(t *testing.T) {
+	mode := PoWMode
+	t.Cleanup(func() { PoWMode = mode })
+	h := newHarness(t, FeatureWebSocket, FeatureSOCKS, FeatureSSH)
+
+	// first returns the first bytes the server answers hello with, or nil if it closes.
+	first := func(hello string) []byte {
+		conn := h.dial()
+		if _, err := io.WriteString(conn, hello); err != nil {
+			t.Fatalf("writing %q: %v", hello, err)
+		}
+		reply := make([]byte, 2)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil
+		}
+		return reply
+	}
+	socks := "\x05\x01\x00"
+	ssh := "SSH-2.0-test\r\n"
+
+	PoWMode = PoWOff
+	if reply := first(socks); reply == nil {
+		t.Error("SOCKS client refused without proof of work required")
+	}
+	if reply := first(ssh); reply == nil {
+		t.Error("raw SSH client refused without proof of work required")
+	}
+
+	PoWMode = PoWAlways
+	if reply := first(socks); reply != nil {
+		t.Errorf("SOCKS client got %q while proof of work is required", reply)
+	}
+	if reply := first(ssh); reply != nil {
+		t.Errorf("raw SSH client got %q while proof of work is required", reply)
+	}
+	resp, _ := h.upgrade(h.dial())
+	if resp.StatusCode != http.StatusPreconditionRequired || resp.Header.Get(PoWChallengeHeader) == "" {
+		t.Errorf("WebSocket upgrade got status %d without a challenge, want 428 with one", resp.StatusCode)
+	}
+}
@@ -0,0 +1,77 @@
+package tunnel
+
+import (
+	"log"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Pre-authentication limits, read from the environment at startup. Connections count as
+// pre-authentication from the moment they are accepted until their user authenticates,
+// by SSH or on the upgrade request, so that handshake floods are bounded.
+var (
+	// MaxPreAuthSessions caps the connections waiting to authenticate; further
+	// connections are closed as soon as they are accepted. It is read from
+	// SSH_IFY_MAX_PREAUTH_SESSIONS; 0 means unlimited.
+	MaxPreAuthSessions = config.EnvInt("SSH_IFY_MAX_PREAUTH_SESSIONS", 1024)
+
+	// PreAuthTimeout closes connections that have not authenticated this long after they
+	// were accepted, however active they are. It is read from SSH_IFY_PREAUTH_TIMEOUT;
+	// 0 disables it.
+	PreAuthTimeout = config.EnvDuration("SSH_IFY_PREAUTH_TIMEOUT", time.Minute)
+)
+
+var (
+	preAuthSessionsGauge = metrics.NewGauge("ssh_ify_preauth_sessions",
+		"Number of accepted connections that have not authenticated yet.")
+	preAuthRefusals = metrics.NewCounter("ssh_ify_preauth_refused_sessions_total",
+		"Connections closed on accept because too many were waiting to authenticate.")
+	preAuthTimeouts = metrics.NewCounter("ssh_ify_preauth_timeouts_total",
+		"Connections closed for not authenticating within the pre-authentication timeout.")
+)
+
+// admitPreAuth counts sess as waiting to authenticate and starts its PreAuthTimeout. It
+// reports false, leaving sess uncounted, if MaxPreAuthSessions are already waiting.
+func (s *Server) admitPreAuth(sess *Session) bool {
+	count := s.preAuthCount.Add(1)
+	if MaxPreAuthSessions > 0 && count > int32(MaxPreAuthSessions) {
+		s.preAuthCount.Add(-1)
+		preAuthRefusals.Inc()
+		log.Printf("[session %s] %d connections waiting to authenticate, refusing %s",
+			sess.sessionID, MaxPreAuthSessions, sess.client.RemoteAddr())
+		return false
+	}
+	preAuthSessionsGauge.Set(int64(count))
+	sess.preAuth.Store(true)
+	if PreAuthTimeout > 0 {
+		sess.preAuthTimer = sess.clock.AfterFunc(PreAuthTimeout, func() {
+			if sess.leavePreAuth() {
+				preAuthTimeouts.Inc()
+				log.Printf("[session %s] Not authenticated within %s, closing connection", sess.sessionID, PreAuthTimeout)
+				sess.Close()
+			}
+		})
+	}
+	return true
+}
+
+// leavePreAuth stops counting the session as waiting to authenticate, because it
+// authenticated, ended or no longer needs to, and reports whether it was counted.
+func (s *Session) leavePreAuth() bool {
+	if !s.preAuth.CompareAndSwap(true, false) {
+		return false
+	}
+	if s.preAuthTimer != nil {
+		s.preAuthTimer.Stop()
+	}
+	preAuthSessionsGauge.Set(int64(s.server.preAuthCount.Add(-1)))
+	return true
+}
+
+// PreAuthSessions returns the number of accepted connections that have not
+// authenticated yet.
+func (s *Server) PreAuthSessions() int {
+	return int(s.preAuthCount.Load())
+}
@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/privsep"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// PrivsepUser splits the server into a privileged supervisor, which binds the listeners
+// and holds the SSH host key and TLS private key, and one worker process per listener
+// running as this user. It is read from SSH_IFY_PRIVSEP_USER; empty, the default, runs a
+// single process. Unix only.
+var PrivsepUser = config.Env("SSH_IFY_PRIVSEP_USER", "")
+
+// WorkerEnv names the listener served by a worker process. The supervisor sets it.
+const WorkerEnv = "SSH_IFY_PRIVSEP_WORKER"
+
+// ServerPortsEnv lists the TCP ports of every listener of the supervisor, separated by
+// commas, so that workers refuse forwards to the ports of other workers too.
+const ServerPortsEnv = "SSH_IFY_PRIVSEP_SERVER_PORTS"
+
+// controlFD is the file descriptor of a worker's control channel, after its listener.
+const controlFD = 4
+
+// workerListener is the name of the listener this process serves as a worker, or "".
+var workerListener = os.Getenv(WorkerEnv)
+
+// supervisor is the control channel of a worker process to its supervisor, or nil.
+var supervisor *privsep.Client
+
+// startWorker connects a worker process to its supervisor, through which it signs with
+// the host and TLS keys, and exits once the supervisor is gone.
+func startWorker() {
+	os.Unsetenv(WorkerEnv)
+	for _, port := range strings.Split(os.Getenv(ServerPortsEnv), ",") {
+		if n, err := strconv.Atoi(port); err == nil {
+			ssh.AddServerPort(n)
+		}
+	}
+	os.Unsetenv(ServerPortsEnv)
+	conn, err := net.FileConn(os.NewFile(controlFD, "control"))
+	if err != nil {
+		log.Fatalf("Worker: no control channel to the supervisor: %v", err)
+	}
+	supervisor = privsep.NewClient(conn)
+	ssh.HostKeySource = supervisor.HostKey
+	log.Printf("Worker: serving the %s listener as uid %d", workerListener, os.Getuid())
+
+	go func() {
+		parent := os.Getppid()
+		for range time.Tick(time.Second) {
+			if os.Getppid() != parent {
+				log.Fatalf("Worker: supervisor exited")
+			}
+		}
+	}()
+}
+
+// servesListener reports whether this process serves the listener name: all of them,
+// unless it is a worker.
+func servesListener(name string) bool {
+	return workerListener == "" || workerListener == name
+}
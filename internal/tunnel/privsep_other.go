@@ -0,0 +1,10 @@
+//go:build !unix
+
+package tunnel
+
+import "log"
+
+// supervise refuses to run, as privilege separation needs Unix credentials.
+func (s *Server) supervise() {
+	log.Fatalf("Privilege separation is only supported on Unix")
+}
@@ -0,0 +1,236 @@
+//go:build unix
+
+package tunnel
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/privsep"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// worker is a process serving one listener on behalf of the supervisor.
+type worker struct {
+	name     string
+	listener *os.File // Listening socket, kept open across restarts
+}
+
+// supervise runs this process as the privilege separation supervisor: it binds every
+// listener, loads the host and TLS keys, hands the config directory to PrivsepUser and
+// runs a worker as that user for each listener, restarting workers that exit, until it
+// is told to shut down.
+func (s *Server) supervise() {
+	if os.Geteuid() != 0 {
+		log.Fatalf("Privilege separation needs the server to start as root")
+	}
+	account, err := user.Lookup(PrivsepUser)
+	if err != nil {
+		log.Fatalf("Privilege separation: %v", err)
+	}
+	uid, _ := strconv.ParseUint(account.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(account.Gid, 10, 32)
+	if uid == 0 {
+		log.Fatalf("Privilege separation: %s must not be root", PrivsepUser)
+	}
+	credential := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}}
+
+	hostKey, err := ssh.LoadHostKey()
+	if err != nil {
+		log.Fatalf("Privilege separation: %v", err)
+	}
+	cert, err := s.defaultCertificate()
+	if err != nil {
+		log.Fatalf("Privilege separation: failed to load TLS certificate: %v", err)
+	}
+	// The key may have been generated readable by everyone; only the supervisor reads it.
+	if err := os.Chmod(s.tlsKeyFile, 0600); err != nil {
+		log.Fatalf("Privilege separation: %v", err)
+	}
+	keys := privsep.Keys{HostKey: hostKey, TLS: cert}
+
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		log.Fatalf("Privilege separation: %v", err)
+	}
+	if err := handConfigDir(configDir, int(uid), int(gid), ssh.HostKeyPath, s.tlsKeyFile); err != nil {
+		log.Fatalf("Privilege separation: failed to hand %s to %s: %v", configDir, PrivsepUser, err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Privilege separation: locating executable: %v", err)
+	}
+
+	var workers []*worker
+	for _, cfg := range s.listenerConfigs() {
+		ln, err := s.listenWith(cfg.Name, cfg.Addr, cfg.socketOptions())
+		if err != nil {
+			log.Fatalf("Failed to listen on %s %s: %v", cfg.Name, cfg.Addr, err)
+		}
+		file, err := ln.File()
+		if err != nil {
+			log.Fatalf("Privilege separation: duplicating %s listener: %v", cfg.Name, err)
+		}
+		ln.Close()
+		workers = append(workers, &worker{name: cfg.Name, listener: file})
+	}
+
+	var ports []string
+	for _, port := range ssh.ServerPorts() {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	serverPorts := ServerPortsEnv + "=" + strings.Join(ports, ",")
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, upgradeSignals...)...)
+	var running sync.Map // Listener name to *exec.Cmd of its current worker
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s.ctx.Err() == nil {
+				cmd, err := w.start(exe, credential, keys, serverPorts)
+				if err != nil {
+					log.Printf("Privilege separation: failed to start %s worker: %v", w.name, err)
+				} else {
+					running.Store(w.name, cmd)
+					err = cmd.Wait()
+					running.Delete(w.name)
+				}
+				if s.ctx.Err() == nil {
+					log.Printf("Privilege separation: %s worker exited (%v), restarting in %s", w.name, err, ListenerRestartDelay)
+					time.Sleep(ListenerRestartDelay)
+				}
+			}
+		}()
+	}
+	log.Printf("Privilege separation: supervising %d workers running as %s", len(workers), PrivsepUser)
+
+	for sig := range c {
+		if isUpgradeSignal(sig) {
+			log.Printf("Privilege separation: upgrades are not supported, restart the server instead")
+			continue
+		}
+		break
+	}
+	s.cancel()
+	running.Range(func(_, cmd any) bool {
+		cmd.(*exec.Cmd).Process.Signal(syscall.SIGTERM)
+		return true
+	})
+	wg.Wait()
+	log.Println("Shutting down...")
+}
+
+// start runs the worker as credential, serving its listener and answering its requests
+// on a new control channel until the worker exits. serverPorts is the ServerPortsEnv
+// entry of its environment.
+func (w *worker) start(exe string, credential *syscall.Credential, keys privsep.Keys, serverPorts string) (*exec.Cmd, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	ours, theirs := os.NewFile(uintptr(fds[0]), "control"), os.NewFile(uintptr(fds[1]), "control")
+	defer theirs.Close()
+	conn, err := net.FileConn(ours)
+	ours.Close()
+	if err != nil {
+		theirs.Close()
+		return nil, err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
+	// The worker cannot read the settings file once it dropped privileges; the
+	// environment still takes precedence over it.
+	cmd.Env = append(config.FileEnviron(), os.Environ()...)
+	cmd.Env = append(cmd.Env, WorkerEnv+"="+w.name, ListenFDsEnv+"="+w.name, serverPorts)
+	cmd.ExtraFiles = []*os.File{w.listener, theirs} // File descriptors 3 and controlFD
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	if err := cmd.Start(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go func() {
+		defer conn.Close()
+		if err := privsep.Serve(conn, keys); err != nil {
+			log.Printf("Privilege separation: %s worker control channel: %v", w.name, err)
+		}
+	}()
+	return cmd, nil
+}
+
+// supervisorFiles are the files in the config directory that configure the supervisor
+// itself: it reads the settings file for the workers' environment and binds the
+// listeners of the listener file. They are root's, so that a compromised worker cannot
+// change what a restarted supervisor does, and the settings file is not readable by
+// workers at all. Each name maps to its mode.
+var supervisorFiles = map[string]os.FileMode{
+	config.SettingsFileName: 0600,
+	"policy.json":           0640,
+	"listeners.json":        0640,
+}
+
+// handConfigDir prepares dir for workers running as uid and gid. The directory stays
+// root's but writable by gid, with the sticky bit set so that workers can create and
+// replace their own files but not root's. The supervisorFiles and the private key files
+// stay root's; everything else is handed to uid and gid. It refuses supervisorFiles that
+// someone other than root owns, which a worker may have planted.
+func handConfigDir(dir string, uid, gid int, keyFiles ...string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	keys := make(map[string]bool)
+	for _, file := range keyFiles {
+		if abs, err := filepath.Abs(file); err == nil {
+			keys[abs] = true
+		}
+	}
+	root, _ := filepath.Abs(dir)
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		abs, _ := filepath.Abs(path)
+		switch mode, supervisor := supervisorFiles[entry.Name()]; {
+		case abs == root:
+			if err := os.Lchown(path, 0, gid); err != nil {
+				return err
+			}
+			return os.Chmod(path, 0770|os.ModeSticky)
+		case keys[abs]:
+			return nil
+		case supervisor && filepath.Dir(abs) == root:
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 {
+				return fmt.Errorf("%s is owned by uid %d, not root; check it and make it root's", path, stat.Uid)
+			}
+			if !entry.Type().IsRegular() {
+				return fmt.Errorf("%s is not a regular file", path)
+			}
+			if err := os.Lchown(path, 0, gid); err != nil {
+				return err
+			}
+			return os.Chmod(path, mode)
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
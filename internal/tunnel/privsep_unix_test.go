@@ -0,0 +1,61 @@
+//go:build unix
+
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestHandConfigDir(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file owners needs root")
+	}
+	const uid, gid = 65534, 65534
+	dir := t.TempDir()
+	for _, name := range []string{"users.json", "settings.json", "policy.json", "listeners.json", "host_key", "checkpoints/a.json"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := handConfigDir(dir, uid, gid, filepath.Join(dir, "host_key")); err != nil {
+		t.Fatalf("handConfigDir() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		uid, gid uint32
+		mode     os.FileMode
+	}{
+		{".", 0, gid, 0770 | os.ModeDir | os.ModeSticky},
+		{"users.json", uid, gid, 0600},
+		{"checkpoints", uid, gid, 0700 | os.ModeDir},
+		{"checkpoints/a.json", uid, gid, 0600},
+		{"settings.json", 0, gid, 0600},
+		{"policy.json", 0, gid, 0640},
+		{"listeners.json", 0, gid, 0640},
+		{"host_key", 0, 0, 0600},
+	}
+	for _, tt := range tests {
+		info, err := os.Lstat(filepath.Join(dir, tt.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		if stat.Uid != tt.uid || stat.Gid != tt.gid || info.Mode() != tt.mode {
+			t.Errorf("%s is %d:%d %v, want %d:%d %v", tt.name, stat.Uid, stat.Gid, info.Mode(), tt.uid, tt.gid, tt.mode)
+		}
+	}
+
+	// A settings file planted by a worker is refused.
+	os.Remove(filepath.Join(dir, "settings.json"))
+	if err := os.WriteFile(filepath.Join(dir, "settings.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Lchown(filepath.Join(dir, "settings.json"), uid, gid)
+	if err := handConfigDir(dir, uid, gid); err == nil {
+		t.Error("handConfigDir() accepted a settings file owned by the worker user")
+	}
+}
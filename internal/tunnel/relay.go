@@ -0,0 +1,57 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/relay"
+)
+
+// Direction identifies which way a Relayer is copying.
+type Direction int
+
+// Relay directions
+const (
+	// ClientToTarget copies bytes received from the client to the SSH server.
+	ClientToTarget Direction = iota
+	// TargetToClient copies bytes from the SSH server back to the client.
+	TargetToClient
+)
+
+// String returns a short name for the direction.
+func (d Direction) String() string {
+	if d == ClientToTarget {
+		return "client->target"
+	}
+	return "target->client"
+}
+
+// Relayer copies one direction of a session's byte stream. Deployments can supply their
+// own to throttle, inspect or transform traffic without changing Session.Relay. Copy
+// must return once src is exhausted, either side fails or ctx is cancelled, and pass the
+// bytes read from src to report so accounting stays accurate.
+type Relayer interface {
+	Copy(ctx context.Context, dir Direction, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error)
+}
+
+// RelayFunc adapts a function to the Relayer interface.
+type RelayFunc func(ctx context.Context, dir Direction, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error)
+
+// Copy calls f.
+func (f RelayFunc) Copy(ctx context.Context, dir Direction, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error) {
+	return f(ctx, dir, dst, src, report)
+}
+
+// BufferedRelay is the default Relayer. It copies with buffers from the shared pool.
+type BufferedRelay struct{}
+
+// Copy copies src to dst with a pooled buffer.
+func (BufferedRelay) Copy(ctx context.Context, dir Direction, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error) {
+	return CopyWithBuffer(ctx, dst, src, report)
+}
+
+// SetRelayer replaces the Relayer used by sessions created after the call. The
+// server-wide bandwidth cap is still enforced around r.
+func (s *Server) SetRelayer(r Relayer) {
+	s.relayer = limitedRelay{next: r}
+}
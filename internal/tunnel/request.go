@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrHeaderTooLarge is returned while reading a request whose header block exceeds MaxHeaderSize.
+var ErrHeaderTooLarge = errors.New("request header block too large")
+
+// ErrRequestLineTooLong is returned while reading a request whose request line exceeds
+// MaxRequestLineSize.
+var ErrRequestLineTooLong = errors.New("request line too long")
+
+// ErrTooManyHeaderLines is returned while reading a request with more than MaxHeaderLines
+// header lines.
+var ErrTooManyHeaderLines = errors.New("too many request header lines")
+
+// headerReader feeds the HTTP parser from the client connection while enforcing the
+// header size limit, the per-line timeout and the cumulative handshake deadline.
+type headerReader struct {
+	s         *Session
+	deadline  time.Time // Cumulative deadline for the whole header block
+	remaining int64     // Bytes still allowed before MaxHeaderSize is exceeded
+	lineDone  bool      // Whether the last read completed a line, starting the next line's timer
+	recorded  []byte    // Everything read so far, if recording
+	record    bool      // Whether to keep what is read in recorded
+}
+
+// Read reads from the client, refreshing the read deadline whenever a new line begins.
+func (h *headerReader) Read(p []byte) (int, error) {
+	if h.remaining <= 0 {
+		return 0, ErrHeaderTooLarge
+	}
+	if int64(len(p)) > h.remaining {
+		p = p[:h.remaining]
+	}
+	if h.lineDone {
+		lineDeadline := h.s.clock.Now().Add(HeaderLineTimeout.Load())
+		if lineDeadline.After(h.deadline) {
+			lineDeadline = h.deadline
+		}
+		h.s.client.SetReadDeadline(lineDeadline)
+		h.lineDone = false
+	}
+
+	n, err := h.s.client.Read(p)
+	h.remaining -= int64(n)
+	if h.record {
+		h.recorded = append(h.recorded, p[:n]...)
+	}
+	if bytes.IndexByte(p[:n], '\n') >= 0 {
+		h.lineDone = true
+	}
+	return n, err
+}
+
+// requestReader buffers the start of the client stream. It holds any bytes the client
+// sent after the request header block.
+type requestReader struct {
+	*bufio.Reader
+	hr *headerReader
+}
+
+// newRequestReader returns a reader over the client connection that enforces the header
+// limits. With record set, everything read from the client is kept for Recorded.
+func (s *Session) newRequestReader(record bool) *requestReader {
+	hr := &headerReader{
+		s:         s,
+		deadline:  s.clock.Now().Add(RequestHeaderTimeout.Load()),
+		remaining: MaxHeaderSize,
+		lineDone:  true,
+		record:    record,
+	}
+	return &requestReader{Reader: bufio.NewReaderSize(hr, BufferSize), hr: hr}
+}
+
+// Recorded returns everything read from the client so far, including bytes still
+// buffered, if the reader was created with record set.
+func (r *requestReader) Recorded() []byte {
+	return r.hr.recorded
+}
+
+// Pending returns a copy of the bytes read from the client but not consumed yet.
+func (r *requestReader) Pending() []byte {
+	if n := r.Buffered(); n > 0 {
+		pending, _ := r.Peek(n)
+		return bytes.Clone(pending)
+	}
+	return nil
+}
+
+// readRequest reads and parses the HTTP upgrade request from the client. The header
+// block is checked strictly before it is parsed: everything the client sends after it
+// goes into the tunnel, so a request that a proxy in front could frame differently must
+// not get through.
+func (s *Session) readRequest(reader *requestReader) (*http.Request, error) {
+	block, err := readHeaderBlock(reader.Reader)
+	if err != nil {
+		if reader.hr.remaining <= 0 && !errors.Is(err, ErrRequestLineTooLong) {
+			return nil, ErrHeaderTooLarge
+		}
+		return nil, err
+	}
+	return http.ReadRequest(bufio.NewReader(bytes.NewReader(block)))
+}
+
+// readHeaderBlock reads the request line and header lines up to the blank line ending
+// them, leaving anything after it buffered in r. It rejects request lines longer than
+// MaxRequestLineSize, more than MaxHeaderLines header lines, NUL bytes and bare carriage
+// returns, folded header lines and requests with more than one Content-Length or
+// Transfer-Encoding, or both.
+func readHeaderBlock(r *bufio.Reader) ([]byte, error) {
+	var block []byte
+	var contentLengths, transferEncodings int
+	for lines := 0; ; lines++ {
+		first := lines == 0
+		if MaxHeaderLines > 0 && lines > MaxHeaderLines+1 {
+			// The request line, MaxHeaderLines header lines and the blank line were allowed.
+			return nil, ErrTooManyHeaderLines
+		}
+		start := len(block)
+		for {
+			chunk, err := r.ReadSlice('\n')
+			block = append(block, chunk...)
+			if first && int64(len(block)) > MaxRequestLineSize {
+				return nil, ErrRequestLineTooLong
+			}
+			if err == nil {
+				break
+			}
+			if err != bufio.ErrBufferFull {
+				return nil, err
+			}
+		}
+		line := bytes.TrimSuffix(bytes.TrimSuffix(block[start:], []byte("\n")), []byte("\r"))
+		switch {
+		case bytes.IndexByte(line, 0) >= 0:
+			return nil, errors.New("NUL byte in request header")
+		case bytes.IndexByte(line, '\r') >= 0:
+			return nil, errors.New("bare carriage return in request header")
+		case len(line) == 0 && !first:
+			if contentLengths > 0 && transferEncodings > 0 {
+				return nil, errors.New("both Content-Length and Transfer-Encoding in request")
+			}
+			return block, nil
+		case first:
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			return nil, errors.New("folded request header line")
+		}
+		name, value, _ := bytes.Cut(line, []byte(":"))
+		switch {
+		case bytes.EqualFold(name, []byte("Content-Length")):
+			contentLengths++
+			if contentLengths > 1 || bytes.IndexByte(value, ',') >= 0 {
+				return nil, errors.New("duplicate Content-Length in request")
+			}
+		case bytes.EqualFold(name, []byte("Transfer-Encoding")):
+			transferEncodings++
+			if transferEncodings > 1 {
+				return nil, errors.New("duplicate Transfer-Encoding in request")
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+)
+
+func TestReadHeaderBlock(t *testing.T) {
+	tooMany := "GET / HTTP/1.1\r\n" + strings.Repeat("X-A: b\r\n", MaxHeaderLines+1) + "\r\n"
+	tests := []struct {
+		name    string
+		request string
+		err     error // Expected error; nil with ok false means any error
+		ok      bool
+	}{
+		{name: "valid", request: "GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\n\r\n", ok: true},
+		{name: "bare LF", request: "GET / HTTP/1.1\nHost: x\n\n", ok: true},
+		{name: "max header lines", request: "GET / HTTP/1.1\r\n" + strings.Repeat("X-A: b\r\n", MaxHeaderLines) + "\r\n", ok: true},
+		{name: "content length", request: "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\n", ok: true},
+		{name: "NUL byte", request: "GET / HTTP/1.1\r\nHost: x\x00y\r\n\r\n"},
+		{name: "NUL in request line", request: "GET /\x00 HTTP/1.1\r\n\r\n"},
+		{name: "bare CR", request: "GET / HTTP/1.1\r\nHost: x\ry\r\n\r\n"},
+		{name: "folded line", request: "GET / HTTP/1.1\r\nHost: x\r\n y\r\n\r\n"},
+		{name: "folded line with tab", request: "GET / HTTP/1.1\r\nHost: x\r\n\ty\r\n\r\n"},
+		{name: "duplicate Content-Length", request: "POST / HTTP/1.1\r\nContent-Length: 5\r\ncontent-length: 5\r\n\r\n"},
+		{name: "Content-Length list", request: "POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\n"},
+		{name: "duplicate Transfer-Encoding", request: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n"},
+		{name: "Content-Length and Transfer-Encoding", request: "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n"},
+		{name: "request line too long", request: "GET /" + strings.Repeat("a", int(MaxRequestLineSize)) + " HTTP/1.1\r\n\r\n", err: ErrRequestLineTooLong},
+		{name: "too many header lines", request: tooMany, err: ErrTooManyHeaderLines},
+		{name: "truncated", request: "GET / HTTP/1.1\r\nHost: x\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.request+"payload"), BufferSize)
+			block, err := readHeaderBlock(r)
+			switch {
+			case tt.ok && err != nil:
+				t.Fatalf("readHeaderBlock() error = %v, want nil", err)
+			case tt.ok:
+				if string(block) != tt.request {
+					t.Errorf("readHeaderBlock() = %q, want %q", block, tt.request)
+				}
+				if rest, _ := r.Peek(r.Buffered()); string(rest) != "payload" {
+					t.Errorf("bytes after the header block = %q, want %q", rest, "payload")
+				}
+			case err == nil:
+				t.Fatalf("readHeaderBlock() accepted %q", tt.request)
+			case tt.err != nil && !errors.Is(err, tt.err):
+				t.Errorf("readHeaderBlock() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func FuzzReadHeaderBlock(f *testing.F) {
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\n\r\nSSH-2.0-x\r\n"))
+	f.Add([]byte("CONNECT example.com:443 HTTP/1.1\r\nProxy-Authorization: Basic YTpi\r\n\r\n"))
+	f.Add([]byte("POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\nhello"))
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: x\r\n y\r\n\r\n"))
+	f.Add([]byte("GET / HTTP/1.1\nHost: a\rb\n\n"))
+	f.Add([]byte("GET / HTTP/1.1\r\nX: \x00\r\n\r\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReaderSize(bytes.NewReader(data), BufferSize)
+		block, err := readHeaderBlock(r)
+		if err != nil {
+			return
+		}
+		if !bytes.HasPrefix(data, block) {
+			t.Fatalf("header block %q is not a prefix of the input", block)
+		}
+		if !bytes.HasSuffix(block, []byte("\n\n")) && !bytes.HasSuffix(block, []byte("\n\r\n")) {
+			t.Fatalf("header block %q does not end with a blank line", block)
+		}
+		if bytes.IndexByte(block, 0) >= 0 {
+			t.Fatalf("header block %q contains a NUL byte", block)
+		}
+		for _, line := range bytes.Split(bytes.TrimSuffix(block, []byte("\n")), []byte("\n"))[1:] {
+			line = bytes.TrimSuffix(line, []byte("\r"))
+			if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+				t.Fatalf("header block %q contains a folded line", block)
+			}
+			if bytes.IndexByte(line, '\r') >= 0 {
+				t.Fatalf("header block %q contains a bare carriage return", block)
+			}
+		}
+		if n := bytes.Count(block, []byte("\n")); n > MaxHeaderLines+2 {
+			t.Fatalf("header block has %d lines, more than %d allowed", n, MaxHeaderLines+2)
+		}
+	})
+}
+
+// readConn is a client connection that sends data and discards what it is sent.
+type readConn struct {
+	*bytes.Reader
+}
+
+func (readConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (readConn) Close() error                     { return nil }
+func (readConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+func (readConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (readConn) SetDeadline(time.Time) error      { return nil }
+func (readConn) SetReadDeadline(time.Time) error  { return nil }
+func (readConn) SetWriteDeadline(time.Time) error { return nil }
+
+func FuzzReadRequest(f *testing.F) {
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\nSSH-2.0-x\r\n"))
+	f.Add([]byte("GET /tcp/example.com:443 HTTP/1.1\r\nX-Forward-To: example.com:443\r\n\r\n"))
+	f.Add([]byte("CONNECT [::1]:22 HTTP/1.1\r\nHost: [::1]:22\r\n\r\n"))
+	f.Add([]byte("GET http://x/%zz HTTP/1.1\r\nHost: x\r\n\r\n"))
+	f.Add([]byte("GET / HTTP/9.9\r\nHost:\r\n\r\n"))
+	f.Add([]byte("POST /speedtest/up HTTP/1.1\r\nContent-Length: -1\r\n\r\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := &Session{client: readConn{bytes.NewReader(data)}, clock: clock.Real{}}
+		reader := s.newRequestReader(false)
+		req, err := s.readRequest(reader)
+		if err != nil {
+			return
+		}
+		// Values the handler reads from the request must not panic either.
+		forwardTarget(req)
+		speedtestKind(req)
+		requestFeature(req)
+		resumeTarget(req)
+		basicCredentials(req)
+		upgradeResponse(req)
+		if header := MaxHeaderSize - reader.hr.remaining - int64(reader.Buffered()); header > MaxHeaderSize {
+			t.Fatalf("read %d bytes of header, more than %d allowed", header, MaxHeaderSize)
+		}
+	})
+}
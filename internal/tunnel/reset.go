@@ -0,0 +1,123 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+)
+
+// ResetAddr is the address the password reset page listens on with TLS, e.g. ":8443".
+// It is read from SSH_IFY_RESET_ADDR; when empty, the page is disabled.
+var ResetAddr = config.Env("SSH_IFY_RESET_ADDR", "")
+
+// passwordResets counts password reset attempts.
+var passwordResets = metrics.NewCounterVec("ssh_ify_password_resets_total",
+	"Password reset attempts, by result.", "result")
+
+// resetPage is the password reset form, shown with the outcome of the last attempt.
+var resetPage = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if not .Done}}<form method="post">
+<p><label>{{.TokenLabel}}<br><input name="token" value="{{.Token}}" required size="70"></label></p>
+<p><label>{{.PasswordLabel}}<br><input name="password" type="password" required></label></p>
+<p><button type="submit">{{.Submit}}</button></p>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// resetView is the data the password reset form is rendered with.
+type resetView struct {
+	Lang, Title, TokenLabel, PasswordLabel, Submit string
+	Token, Message                                 string
+	Done                                           bool
+}
+
+// serveReset serves the password reset page on ResetAddr with the TLS certificates of the
+// tunnel listeners until the server stops listening.
+func (s *Server) serveReset() {
+	if ResetAddr == "" {
+		return
+	}
+	tcpLn, err := s.listen("reset", ResetAddr)
+	if err != nil {
+		log.Printf("Password reset page disabled: %v", err)
+		return
+	}
+	// Reset the passwords the SSH server authenticates against.
+	if ssh.GetUserDB() == nil {
+		ssh.InitializeAuth("")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", handleResetForm)
+	mux.HandleFunc("POST /{$}", handleReset)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-s.listenCtx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Password reset page listening on %s", ResetAddr)
+	if err := srv.Serve(tls.NewListener(tcpLn, s.tlsConfig())); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Password reset page stopped: %v", err)
+	}
+}
+
+// writeResetPage renders the password reset form with status and message.
+func writeResetPage(w http.ResponseWriter, status int, view resetView) {
+	view.Lang = i18n.Lang()
+	view.Title = i18n.T("Reset your password")
+	view.TokenLabel = i18n.T("Reset token")
+	view.PasswordLabel = i18n.T("New password")
+	view.Submit = i18n.T("Set password")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	resetPage.Execute(w, view)
+}
+
+// handleResetForm shows the password reset form, filled in with the token of a link
+// such as "/?token=sfr_...".
+func handleResetForm(w http.ResponseWriter, r *http.Request) {
+	writeResetPage(w, http.StatusOK, resetView{Token: r.URL.Query().Get("token")})
+}
+
+// handleReset sets a new password for the user a reset token was created for.
+func handleReset(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := r.ParseForm(); err != nil {
+		writeResetPage(w, http.StatusBadRequest, resetView{Message: i18n.T("Invalid request.")})
+		return
+	}
+	token := r.PostForm.Get("token")
+	user, err := ssh.GetUserDB().ResetPassword(token, r.PostForm.Get("password"))
+	switch {
+	case errors.Is(err, usermgmt.ErrInvalidResetToken):
+		passwordResets.Inc("invalid_token")
+		log.Printf("Password reset: invalid or expired token from %s", r.RemoteAddr)
+		writeResetPage(w, http.StatusForbidden, resetView{Message: i18n.T("This reset token is invalid or has expired.")})
+	case err != nil:
+		passwordResets.Inc("rejected")
+		log.Printf("Password reset: failed from %s: %v", r.RemoteAddr, err)
+		writeResetPage(w, http.StatusBadRequest, resetView{Token: token, Message: i18n.Sprintf("Password not changed: %v", err)})
+	default:
+		passwordResets.Inc("success")
+		log.Printf("Password reset: user '%s' set a new password from %s", user, r.RemoteAddr)
+		writeResetPage(w, http.StatusOK, resetView{Message: i18n.T("Your password has been changed."), Done: true})
+	}
+}
@@ -0,0 +1,129 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// SessionIDPlaceholder is replaced with the session ID in custom response bodies and
+// header values, so that users can quote it to support.
+const SessionIDPlaceholder = "{session_id}"
+
+// ResponseTemplate customizes the HTTP response sent for one status code.
+type ResponseTemplate struct {
+	Reason  string            `json:"reason,omitempty"`  // Reason phrase; defaults to the standard one
+	Headers map[string]string `json:"headers,omitempty"` // Extra headers, e.g. {"Server": "nginx"}
+	Body    string            `json:"body,omitempty"`
+}
+
+// LoadResponseTemplates reads a JSON object mapping status codes to templates, e.g.
+//
+//	{"400": {"headers": {"Server": "nginx"}, "body": "<h1>400 Bad Request</h1>"},
+//	 "502": {"body": "Tunnel unavailable, contact support@example.com (ref {session_id})"}}
+//
+// A missing file yields an empty map.
+func LoadResponseTemplates(path string) (map[int]ResponseTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[int]ResponseTemplate{}, nil
+		}
+		return nil, err
+	}
+	raw := make(map[string]ResponseTemplate)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+	templates := make(map[int]ResponseTemplate, len(raw))
+	for key, tmpl := range raw {
+		code, err := strconv.Atoi(key)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q in %s", key, path)
+		}
+		templates[code] = tmpl
+	}
+	return templates, nil
+}
+
+// loadResponseTemplates loads the response templates from the config directory.
+// Failures are logged and leave the built-in responses in place.
+func loadResponseTemplates() map[int]ResponseTemplate {
+	path, err := config.GetResponsesPath()
+	if err != nil {
+		log.Printf("Failed to locate response templates: %v", err)
+		return nil
+	}
+	templates, err := LoadResponseTemplates(path)
+	if err != nil {
+		log.Printf("Failed to load response templates: %v", err)
+		return nil
+	}
+	if len(templates) > 0 {
+		log.Printf("Loaded %d custom HTTP responses from %s", len(templates), path)
+	}
+	return templates
+}
+
+// builtinResponses are sent for status codes without a template.
+var builtinResponses = map[int]string{
+	http.StatusUnauthorized:       UnauthorizedResponse,
+	http.StatusServiceUnavailable: ServiceUnavailableResponse,
+}
+
+// render formats the template as a complete response for code.
+func (t ResponseTemplate) render(code int, sessionID string) string {
+	reason := t.Reason
+	if reason == "" {
+		reason = http.StatusText(code)
+	}
+	expand := func(s string) string { return strings.ReplaceAll(s, SessionIDPlaceholder, sessionID) }
+
+	headers := map[string]string{
+		"Content-Length": strconv.Itoa(len(expand(t.Body))),
+		"Connection":     "close",
+	}
+	if t.Body != "" {
+		headers["Content-Type"] = "text/html; charset=utf-8"
+	}
+	for name, value := range t.Headers {
+		headers[http.CanonicalHeaderKey(name)] = expand(value)
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", code, reason)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, headers[name])
+	}
+	b.WriteString("\r\n")
+	b.WriteString(expand(t.Body))
+	return b.String()
+}
+
+// respond writes the response for code to the client, using the configured template if
+// there is one.
+func (s *Session) respond(code int) {
+	if tmpl, ok := s.server.responses[code]; ok {
+		s.client.Write([]byte(tmpl.render(code, s.sessionID)))
+		return
+	}
+	if resp, ok := builtinResponses[code]; ok {
+		s.client.Write([]byte(resp))
+		return
+	}
+	fmt.Fprintf(s.client, "HTTP/1.1 %d %s\r\n\r\n", code, http.StatusText(code))
+}
@@ -0,0 +1,352 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Clients opt in to resumption by sending ResumeTokenHeader with the value "new" on the
+// upgrade request; the 101 response carries the session's token in the same header.
+// After their transport drops, clients reconnect with the token and, in
+// ResumeOffsetHeader, the number of stream bytes they received. The 101 response then
+// carries the number of bytes the server received, and each side resends what the
+// other is missing before the stream continues.
+const (
+	ResumeTokenHeader  = "X-Resume-Token"
+	ResumeOffsetHeader = "X-Resume-Offset"
+	ResumeNewToken     = "new"
+)
+
+// Session resumption configuration, read from the environment at startup.
+var (
+	// ResumeEnabled lets SSH tunnels outlive their transport. It is read from SSH_IFY_RESUME.
+	ResumeEnabled = config.EnvBool("SSH_IFY_RESUME", false)
+
+	// ResumeGrace is how long a session whose transport dropped waits for the client to
+	// reconnect. It is read from SSH_IFY_RESUME_GRACE.
+	ResumeGrace = config.EnvDuration("SSH_IFY_RESUME_GRACE", 2*time.Minute)
+
+	// ResumeBuffer is how many bytes already sent to the client are kept for resending
+	// after a reconnect. It is read from SSH_IFY_RESUME_BUFFER.
+	ResumeBuffer = config.EnvSize("SSH_IFY_RESUME_BUFFER", 1<<20)
+)
+
+// sessionResumptions counts reconnect attempts by result.
+var sessionResumptions = metrics.NewCounterVec("ssh_ify_session_resumptions_total",
+	"Attempts to resume a session on a new transport, by result.", "result")
+
+// resumableConn is the client side of a session that survives transport failures. Reads
+// and writes wait for the client to reconnect while no transport is attached; bytes
+// sent are kept so that the ones lost with a transport can be resent.
+type resumableConn struct {
+	token     string
+	sessionID string
+	server    *Server
+
+	writeMutex sync.Mutex // Serializes writes to the transport
+
+	mutex    sync.Mutex
+	cond     *sync.Cond // Signalled when a transport is attached or the connection closes
+	conn     net.Conn   // Current transport, nil while detached
+	lastConn net.Conn   // Most recent transport, for addresses
+	attaches int        // Number of transports attached so far
+	closed   bool
+	received int64  // Bytes read from the client
+	sent     int64  // Bytes written by the session
+	written  int64  // Bytes written to the current transport, counting from the stream start
+	replay   []byte // The last bytes written by the session, ending at sent
+}
+
+// newResumableConn wraps conn, the client connection of the session with sessionID whose
+// first bytes are pending, and registers it with s under a new token.
+func (s *Server) newResumableConn(sessionID string, conn net.Conn, pending []byte) (*resumableConn, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	rc := &resumableConn{token: hex.EncodeToString(token), sessionID: sessionID, server: s}
+	rc.cond = sync.NewCond(&rc.mutex)
+	rc.conn, rc.lastConn = withPending(conn, pending), conn
+	s.resumable.Store(rc.token, rc)
+	return rc, nil
+}
+
+// withPending returns conn with pending placed before the bytes it has yet to read.
+func withPending(conn net.Conn, pending []byte) net.Conn {
+	if len(pending) == 0 {
+		return conn
+	}
+	return &replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(pending), conn)}
+}
+
+// transport returns the current transport, waiting for the client to reconnect if
+// there is none.
+func (rc *resumableConn) transport() (net.Conn, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	for rc.conn == nil && !rc.closed {
+		rc.cond.Wait()
+	}
+	if rc.closed {
+		return nil, net.ErrClosed
+	}
+	return rc.conn, nil
+}
+
+// detach drops conn after it failed, if it is still the current transport, and closes
+// rc unless the client reconnects within ResumeGrace.
+func (rc *resumableConn) detach(conn net.Conn, err error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.closed || rc.conn != conn {
+		return
+	}
+	conn.Close()
+	rc.conn = nil
+	attaches := rc.attaches
+	log.Printf("[session %s] Transport lost (%v), waiting %s for the client to reconnect", rc.sessionID, err, ResumeGrace)
+	rc.server.clock.AfterFunc(ResumeGrace, func() {
+		rc.mutex.Lock()
+		expired := rc.conn == nil && rc.attaches == attaches
+		rc.mutex.Unlock()
+		if expired {
+			log.Printf("[session %s] Client did not reconnect within %s, closing", rc.sessionID, ResumeGrace)
+			rc.Close()
+		}
+	})
+}
+
+// Read reads from the current transport. When the transport fails, it waits for the
+// client to reconnect and reads from the new transport.
+func (rc *resumableConn) Read(p []byte) (int, error) {
+	for {
+		conn, err := rc.transport()
+		if err != nil {
+			return 0, err
+		}
+		n, err := conn.Read(p)
+		if n > 0 {
+			rc.mutex.Lock()
+			current := rc.conn == conn
+			if current {
+				rc.received += int64(n)
+			}
+			rc.mutex.Unlock()
+			// Bytes from a replaced transport are resent by the client.
+			if current {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			rc.detach(conn, err)
+		}
+	}
+}
+
+// Write keeps p for resending and writes it to the current transport. When the
+// transport fails, it waits for the client to reconnect; the bytes the client missed,
+// including p, are then resent on the new transport.
+func (rc *resumableConn) Write(p []byte) (int, error) {
+	rc.mutex.Lock()
+	rc.replay = append(rc.replay, p...)
+	rc.sent += int64(len(p))
+	// Keep ResumeBuffer bytes, and any that were not written to a transport yet. The
+	// buffer is trimmed into a new slice, which a concurrent flush may still be writing
+	// from, once it holds twice that, so that most writes do not copy.
+	if keep := max(ResumeBuffer, rc.sent-rc.written); int64(len(rc.replay)) > 2*keep {
+		rc.replay = bytes.Clone(rc.replay[int64(len(rc.replay))-keep:])
+	}
+	rc.mutex.Unlock()
+
+	for {
+		conn, err := rc.transport()
+		if err != nil {
+			return 0, err
+		}
+		if err := rc.flush(conn); err != nil {
+			rc.detach(conn, err)
+			continue
+		}
+		return len(p), nil
+	}
+}
+
+// flush writes the bytes conn has not received yet to conn, if it is the current transport.
+func (rc *resumableConn) flush(conn net.Conn) error {
+	rc.writeMutex.Lock()
+	defer rc.writeMutex.Unlock()
+	rc.mutex.Lock()
+	if rc.conn != conn {
+		rc.mutex.Unlock()
+		return nil
+	}
+	start := rc.sent - int64(len(rc.replay))
+	data := rc.replay[rc.written-start:]
+	end := rc.sent
+	rc.mutex.Unlock()
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+	rc.mutex.Lock()
+	if rc.conn == conn {
+		rc.written = end
+	}
+	rc.mutex.Unlock()
+	return nil
+}
+
+// attach makes conn, whose first bytes are pending, the transport of rc once the client
+// reconnected having received offset bytes. It writes the 101 response for req with the
+// number of bytes the server received and resends what the client missed.
+func (rc *resumableConn) attach(conn net.Conn, pending []byte, req *http.Request, offset int64) error {
+	rc.mutex.Lock()
+	start := rc.sent - int64(len(rc.replay))
+	if rc.closed || offset < start || offset > rc.sent {
+		rc.mutex.Unlock()
+		return fmt.Errorf("offset %d outside the resendable range %d-%d", offset, start, rc.sent)
+	}
+	if rc.conn != nil {
+		rc.conn.Close()
+	}
+	response := withHeader(upgradeResponse(req), ResumeOffsetHeader, strconv.FormatInt(rc.received, 10))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		rc.conn = nil
+		rc.mutex.Unlock()
+		return err
+	}
+	transport := withPending(conn, pending)
+	rc.conn, rc.lastConn = transport, conn
+	rc.attaches++
+	rc.written = offset
+	rc.cond.Broadcast()
+	rc.mutex.Unlock()
+
+	if err := rc.flush(transport); err != nil {
+		rc.detach(transport, err)
+	}
+	return nil
+}
+
+// Close closes the current transport and forgets the session's token.
+func (rc *resumableConn) Close() error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.closed {
+		return nil
+	}
+	rc.closed = true
+	rc.server.resumable.Delete(rc.token)
+	rc.cond.Broadcast()
+	if rc.conn != nil {
+		return rc.conn.Close()
+	}
+	return nil
+}
+
+// LocalAddr returns the local address of the most recent transport.
+func (rc *resumableConn) LocalAddr() net.Addr {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.lastConn.LocalAddr()
+}
+
+// RemoteAddr returns the client address of the most recent transport.
+func (rc *resumableConn) RemoteAddr() net.Addr {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.lastConn.RemoteAddr()
+}
+
+// SetDeadline sets the deadlines of the current transport, if any.
+func (rc *resumableConn) SetDeadline(t time.Time) error {
+	if conn := rc.current(); conn != nil {
+		return conn.SetDeadline(t)
+	}
+	return nil
+}
+
+// SetReadDeadline sets the read deadline of the current transport, if any.
+func (rc *resumableConn) SetReadDeadline(t time.Time) error {
+	if conn := rc.current(); conn != nil {
+		return conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of the current transport, if any.
+func (rc *resumableConn) SetWriteDeadline(t time.Time) error {
+	if conn := rc.current(); conn != nil {
+		return conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (rc *resumableConn) current() net.Conn {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.conn
+}
+
+// withHeader adds a header line to an HTTP response header block.
+func withHeader(response, name, value string) string {
+	return strings.TrimSuffix(response, "\r\n") + name + ": " + value + "\r\n\r\n"
+}
+
+// wantsResume reports whether req asks for a resumable SSH tunnel.
+func wantsResume(req *http.Request) bool {
+	return ResumeEnabled && req.Header.Get(ResumeTokenHeader) == ResumeNewToken
+}
+
+// resumeTarget returns the token of the session req reconnects to, or "".
+func resumeTarget(req *http.Request) string {
+	if token := req.Header.Get(ResumeTokenHeader); ResumeEnabled && token != ResumeNewToken {
+		return token
+	}
+	return ""
+}
+
+// handleResume attaches the session's client connection to the session named by token
+// and reports whether the connection was handed over.
+func (s *Session) handleResume(req *http.Request, token string, pending []byte) bool {
+	value, ok := s.server.resumable.Load(token)
+	if !ok {
+		sessionResumptions.Inc("unknown")
+		log.Printf("[session %s] Resumption refused: unknown token", s.sessionID)
+		s.respond(http.StatusNotFound)
+		return false
+	}
+	rc := value.(*resumableConn)
+	offset, err := strconv.ParseInt(req.Header.Get(ResumeOffsetHeader), 10, 64)
+	if err != nil {
+		sessionResumptions.Inc("invalid")
+		log.Printf("[session %s] Resumption refused: invalid %s", s.sessionID, ResumeOffsetHeader)
+		s.respond(http.StatusBadRequest)
+		return false
+	}
+	if err := rc.attach(s.client, pending, req, offset); err != nil {
+		sessionResumptions.Inc("failed")
+		log.Printf("[session %s] Resumption of session %s failed: %v", s.sessionID, rc.sessionID, err)
+		s.respond(http.StatusGone)
+		return false
+	}
+	sessionResumptions.Inc("resumed")
+	log.Printf("[session %s] Resumed session %s from %s", s.sessionID, rc.sessionID, s.client.RemoteAddr())
+	return true
+}
@@ -0,0 +1,267 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stallTimeout is how long a resumingClient waits for a write before giving up on the
+// transport.
+const stallTimeout = 500 * time.Millisecond
+
+// resumingClient is the client side of a resumable session. Whenever its transport
+// fails it reconnects with the session's token, reporting the bytes it received, and
+// resends the bytes the server reports it missed. Each transport is wrapped with the
+// faults returned for its attempt number.
+type resumingClient struct {
+	h      *harness
+	faults func(attempt int) faults
+
+	writeMutex sync.Mutex // Serializes writes to the transport
+
+	mutex      sync.Mutex
+	token      string
+	conn       net.Conn
+	attempt    int // Transports opened so far, identifying the current one
+	reconnects int
+	closed     bool
+	received   int64  // Bytes read from the server
+	sent       []byte // Every byte written, for resending
+	written    int    // Bytes of sent written to the current transport
+}
+
+// resumingClient opens a resumable session whose transports have the given faults.
+func (h *harness) resumingClient(faults func(attempt int) faults) *resumingClient {
+	h.t.Helper()
+	c := &resumingClient{h: h, faults: faults}
+	transport := c.transport()
+	if transport == nil {
+		h.t.Fatal("listener closed")
+	}
+	resp, conn := h.upgrade(transport, ResumeTokenHeader+": "+ResumeNewToken)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		h.t.Fatalf("upgrade response status %d, want 101", resp.StatusCode)
+	}
+	if c.token = resp.Header.Get(ResumeTokenHeader); c.token == "" {
+		h.t.Fatalf("upgrade response has no %s", ResumeTokenHeader)
+	}
+	c.conn = conn
+	h.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// transport dials the next transport.
+func (c *resumingClient) transport() net.Conn {
+	conn, err := c.h.listener.Dial()
+	if err != nil {
+		return nil
+	}
+	c.attempt++
+	return c.faults(c.attempt - 1).wrap(conn)
+}
+
+// reconnect replaces transport number attempt, unless another one replaced it already,
+// and resends the bytes the server missed.
+func (c *resumingClient) reconnect(attempt int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.attempt == attempt {
+		if c.closed {
+			return net.ErrClosed
+		}
+		c.conn.Close()
+		raw := c.transport()
+		if raw == nil {
+			return net.ErrClosed
+		}
+		c.conn = raw
+		resp, conn, err := upgradeConn(raw, ResumeTokenHeader+": "+c.token,
+			ResumeOffsetHeader+": "+strconv.FormatInt(c.received, 10))
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			return fmt.Errorf("resuming: status %d", resp.StatusCode)
+		}
+		offset, err := strconv.ParseInt(resp.Header.Get(ResumeOffsetHeader), 10, 64)
+		if err != nil || offset > int64(len(c.sent)) {
+			return fmt.Errorf("resuming: invalid %s %q", ResumeOffsetHeader, resp.Header.Get(ResumeOffsetHeader))
+		}
+		c.conn = conn
+		conn.SetWriteDeadline(time.Now().Add(stallTimeout))
+		if _, err := conn.Write(c.sent[offset:]); err != nil {
+			continue
+		}
+		c.written = len(c.sent)
+		c.reconnects++
+	}
+	return nil
+}
+
+// Read reads from the current transport, reconnecting when it fails.
+func (c *resumingClient) Read(p []byte) (int, error) {
+	for {
+		c.mutex.Lock()
+		conn, attempt, closed := c.conn, c.attempt, c.closed
+		c.mutex.Unlock()
+		if closed {
+			return 0, net.ErrClosed
+		}
+		n, err := conn.Read(p)
+		if n > 0 {
+			c.mutex.Lock()
+			current := c.attempt == attempt
+			if current {
+				c.received += int64(n)
+			}
+			c.mutex.Unlock()
+			// Bytes from a replaced transport are resent by the server.
+			if current {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			if err := c.reconnect(attempt); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// Write keeps p for resending and writes it to the current transport, reconnecting
+// when the transport fails or stalls for stallTimeout.
+func (c *resumingClient) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.mutex.Lock()
+	c.sent = append(c.sent, p...)
+	c.mutex.Unlock()
+	for {
+		c.mutex.Lock()
+		conn, attempt, closed := c.conn, c.attempt, c.closed
+		data, end := c.sent[c.written:], len(c.sent)
+		c.mutex.Unlock()
+		if closed {
+			return 0, net.ErrClosed
+		}
+		conn.SetWriteDeadline(time.Now().Add(stallTimeout))
+		if _, err := conn.Write(data); err != nil {
+			if err := c.reconnect(attempt); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		c.mutex.Lock()
+		if c.attempt == attempt {
+			c.written = end
+		}
+		c.mutex.Unlock()
+		return len(p), nil
+	}
+}
+
+// Reconnects returns how many times the client resumed the session.
+func (c *resumingClient) Reconnects() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.reconnects
+}
+
+func (c *resumingClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return c.conn.Close()
+}
+
+func (c *resumingClient) LocalAddr() net.Addr              { return c.h.listener.Addr() }
+func (c *resumingClient) RemoteAddr() net.Addr             { return c.h.listener.Addr() }
+func (c *resumingClient) SetDeadline(time.Time) error      { return nil }
+func (c *resumingClient) SetReadDeadline(time.Time) error  { return nil }
+func (c *resumingClient) SetWriteDeadline(time.Time) error { return nil }
+
+// resumeTunnel logs in over c and checks that size bytes survive a round trip through
+// a forwarded channel.
+func resumeTunnel(t *testing.T, h *harness, c *resumingClient, size int) {
+	t.Helper()
+	client, err := h.handshake(c, harnessUser, harnessPassword)
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+	conn, err := client.Dial("tcp", "203.0.113.7:80")
+	if err != nil {
+		t.Fatalf("forwarding: %v", err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn, size)
+}
+
+func TestResumeAcrossDrops(t *testing.T) {
+	h := newHarness(t)
+	drops := []int64{40 << 10, 24 << 10, 96 << 10, 16 << 10, 64 << 10}
+	c := h.resumingClient(func(attempt int) faults {
+		return faults{latency: 100 * time.Microsecond, chunk: 1400, dropAfter: drops[attempt%len(drops)]}
+	})
+	resumeTunnel(t, h, c, 512<<10)
+	if c.Reconnects() < 5 {
+		t.Errorf("client reconnected %d times, want at least 5", c.Reconnects())
+	}
+}
+
+func TestResumeAfterPartialWrites(t *testing.T) {
+	h := newHarness(t)
+	// Transports drop in the middle of chunks that do not line up with SSH packets.
+	c := h.resumingClient(func(attempt int) faults {
+		return faults{chunk: 333, dropAfter: int64(20<<10 + attempt*7919)}
+	})
+	resumeTunnel(t, h, c, 256<<10)
+	if c.Reconnects() == 0 {
+		t.Error("client never reconnected")
+	}
+}
+
+func TestResumeAfterStall(t *testing.T) {
+	h := newHarness(t)
+	c := h.resumingClient(func(attempt int) faults {
+		if attempt == 0 {
+			return faults{stallAfter: 16 << 10}
+		}
+		return faults{}
+	})
+	resumeTunnel(t, h, c, 128<<10)
+	if c.Reconnects() == 0 {
+		t.Error("client never reconnected after the stall")
+	}
+}
+
+func TestResumeRefused(t *testing.T) {
+	h := newHarness(t)
+	c := h.resumingClient(func(int) faults { return faults{} })
+	tests := []struct {
+		name   string
+		token  string
+		offset string
+		status int
+	}{
+		{"unknown token", "0123456789abcdef", "0", http.StatusNotFound},
+		{"invalid offset", c.token, "x", http.StatusBadRequest},
+		{"offset not sent yet", c.token, "1000000", http.StatusGone},
+		{"negative offset", c.token, "-1", http.StatusGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := h.upgrade(h.dial(), ResumeTokenHeader+": "+tt.token, ResumeOffsetHeader+": "+tt.offset)
+			if resp.StatusCode != tt.status {
+				t.Errorf("resumption got status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+	// Refused attempts leave the session usable.
+	resumeTunnel(t, h, c, 4096)
+}
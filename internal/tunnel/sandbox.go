@@ -0,0 +1,28 @@
+package tunnel
+
+import (
+	"log"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sandbox"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// applySandbox confines the process with the sandboxes of sandbox.Mode, first creating
+// the host key and TLS certificate that would otherwise be generated on demand. The
+// config directory stays writable and the files read while serving stay readable.
+func (s *Server) applySandbox() {
+	if _, err := ssh.HostKeySource(); err != nil {
+		log.Fatalf("Failed to prepare sandbox: %v", err)
+	}
+	s.tlsConfig()
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		log.Fatalf("Failed to prepare sandbox: %v", err)
+	}
+	readOnly := []string{ssh.HostKeyPath, ssh.HostCertPath, ssh.BannerFile, ssh.UserCAFile}
+	if err := sandbox.Apply([]string{configDir}, readOnly); err != nil {
+		log.Fatalf("Failed to sandbox the server: %v", err)
+	}
+	log.Printf("Sandbox: applied %s", sandbox.Mode)
+}
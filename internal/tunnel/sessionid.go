@@ -0,0 +1,38 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet used by ULIDs.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newSessionID returns a ULID: a 26 character, lexicographically sortable identifier made
+// of a 48-bit millisecond timestamp followed by 80 random bits. Unlike the remote address,
+// it stays unique when clients reconnect from the same NAT port.
+func newSessionID(now time.Time) string {
+	var out [26]byte
+
+	// 48-bit timestamp in the first 10 characters.
+	ms := uint64(now.UnixMilli())
+	for i := 9; i >= 0; i-- {
+		out[i] = crockfordAlphabet[ms&0x1f]
+		ms >>= 5
+	}
+
+	// 80 random bits in the last 16 characters, encoded as two 40-bit halves.
+	var entropy [10]byte
+	rand.Read(entropy[:])
+	for half := 0; half < 2; half++ {
+		var v uint64
+		for _, b := range entropy[half*5 : half*5+5] {
+			v = v<<8 | uint64(b)
+		}
+		for i := 7; i >= 0; i-- {
+			out[10+half*8+i] = crockfordAlphabet[v&0x1f]
+			v >>= 5
+		}
+	}
+	return string(out[:])
+}
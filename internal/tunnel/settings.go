@@ -0,0 +1,172 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+)
+
+// SettingsPath is the admin socket endpoint listing the settings that can be changed at
+// runtime; PUT SettingsPath/{name} with a SettingChange changes one.
+const SettingsPath = "/settings"
+
+// PolicyReloadPath is the admin socket endpoint that reloads the forwarding policy and
+// the plans on POST.
+const PolicyReloadPath = "/policy/reload"
+
+// SettingChange is the body of a request changing a setting.
+type SettingChange struct {
+	Value   string `json:"value"`
+	Persist bool   `json:"persist,omitempty"` // Save the value to the settings file
+}
+
+// settingsFileMutex serializes updates of the settings file.
+var settingsFileMutex sync.Mutex
+
+// persistSetting saves value for the setting name in the settings file, keeping the
+// other settings in it.
+func persistSetting(name, value string) error {
+	settingsFileMutex.Lock()
+	defer settingsFileMutex.Unlock()
+
+	path, err := config.GetSettingsPath()
+	if err != nil {
+		return err
+	}
+	settings, err := config.ReadSettings(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if settings == nil {
+		settings = make(map[string]string)
+	}
+	settings[name] = value
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save settings: %v", err)
+	}
+	if os.Getenv(name) != "" {
+		log.Printf("%s is also set in the environment, which takes precedence over %s after a restart", name, path)
+	}
+	return nil
+}
+
+// handleSettings lists the runtime settings on the admin socket.
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Tunables())
+}
+
+// handleSetSetting changes the setting named in the path on the admin socket.
+func handleSetSetting(w http.ResponseWriter, r *http.Request) {
+	var req SettingChange
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	value := strings.TrimSpace(req.Value)
+	if err := config.SetTunable(name, value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Admin socket: %s set to %s", name, value)
+	if req.Persist {
+		if err := persistSetting(name, value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePolicyReload reloads the forwarding policy and then the plans, whose rules are
+// compiled on top of it, on the admin socket.
+func handlePolicyReload(w http.ResponseWriter, r *http.Request) {
+	if err := policy.Reload(); err != nil {
+		log.Printf("Admin socket: failed to reload forwarding policy: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err := usermgmt.ReloadPlans(); err != nil {
+		log.Printf("Admin socket: failed to reload plans: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("Admin socket: forwarding policy and plans reloaded")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FetchSettings requests the runtime settings through an admin socket client.
+func FetchSettings(ctx context.Context, client *http.Client) ([]config.Setting, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://admin"+SettingsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin socket returned %s", resp.Status)
+	}
+	var settings []config.Setting
+	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SetSetting changes the runtime setting name through an admin socket client.
+func SetSetting(ctx context.Context, client *http.Client, name string, change SettingChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://admin"+SettingsPath+"/"+url.PathEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return doAdminRequest(client, req)
+}
+
+// ReloadPolicy reloads the forwarding policy and the plans of the server through an admin
+// socket client.
+func ReloadPolicy(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://admin"+PolicyReloadPath, nil)
+	if err != nil {
+		return err
+	}
+	return doAdminRequest(client, req)
+}
+
+// doAdminRequest sends req, which expects no content in reply, and reports the server's
+// error message if it fails.
+func doAdminRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("admin socket returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clientconfig"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+)
+
+// SignupAddr is the address the invite signup page listens on with TLS, e.g. ":8445".
+// It is read from SSH_IFY_SIGNUP_ADDR; when empty, the page is disabled.
+var SignupAddr = config.Env("SSH_IFY_SIGNUP_ADDR", "")
+
+// signups counts signup attempts.
+var signups = metrics.NewCounterVec("ssh_ify_signups_total",
+	"Invite signup attempts, by result.", "result")
+
+// signupPage is the signup form, shown with the outcome of the last attempt.
+var signupPage = template.Must(template.New("signup").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if not .Done}}<form method="post">
+<p><label>{{.InviteLabel}}<br><input name="invite" value="{{.Invite}}" required size="70"></label></p>
+<p><label>{{.UsernameLabel}}<br><input name="username" value="{{.Username}}" required maxlength="32" autocomplete="username"></label></p>
+<p><label>{{.PasswordLabel}}<br><input name="password" type="password" required autocomplete="new-password"></label></p>
+<p><button type="submit">{{.Submit}}</button></p>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// signupView is the data the signup form is rendered with.
+type signupView struct {
+	Lang, Title, InviteLabel, UsernameLabel, PasswordLabel, Submit string
+	Invite, Username, Message                                      string
+	Done                                                           bool
+}
+
+// SignupLink returns the link to the signup page for an invite token, at
+// SSH_IFY_PUBLIC_HOST. It returns "" unless both the page and the public host are set.
+func SignupLink(token string) string {
+	_, port, err := net.SplitHostPort(SignupAddr)
+	if err != nil || clientconfig.PublicHost == "" {
+		return ""
+	}
+	link := url.URL{
+		Scheme:   "https",
+		Host:     net.JoinHostPort(clientconfig.PublicHost, port),
+		Path:     "/",
+		RawQuery: url.Values{"invite": {token}}.Encode(),
+	}
+	return link.String()
+}
+
+// serveSignup serves the invite signup page on SignupAddr with the TLS certificates of the
+// tunnel listeners until the server stops listening.
+func (s *Server) serveSignup() {
+	if SignupAddr == "" {
+		return
+	}
+	tcpLn, err := s.listen("signup", SignupAddr)
+	if err != nil {
+		log.Printf("Invite signup page disabled: %v", err)
+		return
+	}
+	// Add accounts to the user database the SSH server authenticates against.
+	if ssh.GetUserDB() == nil {
+		ssh.InitializeAuth("")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", handleSignupForm)
+	mux.HandleFunc("POST /{$}", handleSignup)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-s.listenCtx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Invite signup page listening on %s", SignupAddr)
+	if err := srv.Serve(tls.NewListener(tcpLn, s.tlsConfig())); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Invite signup page stopped: %v", err)
+	}
+}
+
+// writeSignupPage renders the signup form with status and message.
+func writeSignupPage(w http.ResponseWriter, status int, view signupView) {
+	view.Lang = i18n.Lang()
+	view.Title = i18n.T("Create your account")
+	view.InviteLabel = i18n.T("Invite")
+	view.UsernameLabel = i18n.T("Username")
+	view.PasswordLabel = i18n.T("Password")
+	view.Submit = i18n.T("Create account")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	signupPage.Execute(w, view)
+}
+
+// handleSignupForm shows the signup form, filled in with the invite of a link such as
+// "/?invite=sfi_...".
+func handleSignupForm(w http.ResponseWriter, r *http.Request) {
+	writeSignupPage(w, http.StatusOK, signupView{Invite: r.URL.Query().Get("invite")})
+}
+
+// handleSignup creates the account of an invite.
+func handleSignup(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := r.ParseForm(); err != nil {
+		writeSignupPage(w, http.StatusBadRequest, signupView{Message: i18n.T("Invalid request.")})
+		return
+	}
+	invite, username := r.PostForm.Get("invite"), r.PostForm.Get("username")
+	err := ssh.GetUserDB().RedeemInvite(invite, username, r.PostForm.Get("password"))
+	switch {
+	case errors.Is(err, usermgmt.ErrInvalidInvite):
+		signups.Inc("invalid_invite")
+		log.Printf("Signup: invalid or expired invite from %s", r.RemoteAddr)
+		writeSignupPage(w, http.StatusForbidden, signupView{Message: i18n.T("This invite is invalid, used or has expired.")})
+	case err != nil:
+		signups.Inc("rejected")
+		log.Printf("Signup: failed from %s: %v", r.RemoteAddr, err)
+		writeSignupPage(w, http.StatusBadRequest, signupView{Invite: invite, Username: username, Message: i18n.Sprintf("Account not created: %v", err)})
+	default:
+		signups.Inc("success")
+		log.Printf("Signup: user '%s' created from %s", username, r.RemoteAddr)
+		writeSignupPage(w, http.StatusOK, signupView{Message: i18n.Sprintf("Account '%s' created. You can now connect with your username and password.", username), Done: true})
+	}
+}
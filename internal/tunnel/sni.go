@@ -0,0 +1,112 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// CertPair names the certificate and key files served for one SNI hostname.
+type CertPair struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// LoadCertMap reads a JSON object mapping hostnames to certificate pairs, e.g.
+//
+//	{"example.com": {"cert": "/etc/ssl/example.pem", "key": "/etc/ssl/example.key"},
+//	 "*.example.org": {"cert": "wildcard.pem", "key": "wildcard.key"}}
+//
+// A missing file yields an empty map.
+func LoadCertMap(path string) (map[string]CertPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]CertPair{}, nil
+		}
+		return nil, err
+	}
+	pairs := make(map[string]CertPair)
+	if len(data) == 0 {
+		return pairs, nil
+	}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return pairs, nil
+}
+
+// certSelector picks the certificate presented for a TLS handshake by SNI hostname.
+type certSelector struct {
+	byName   map[string]*tls.Certificate // Lower-case hostnames, including "*.domain" wildcards
+	fallback *tls.Certificate            // Served when no hostname matches or no SNI is sent
+}
+
+// newCertSelector loads every pair in pairs and returns a selector falling back to fallback.
+func newCertSelector(pairs map[string]CertPair, fallback *tls.Certificate) (*certSelector, error) {
+	sel := &certSelector{byName: make(map[string]*tls.Certificate), fallback: fallback}
+	for name, pair := range pairs {
+		cert, err := tls.LoadX509KeyPair(pair.Cert, pair.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate for %s: %v", name, err)
+		}
+		sel.byName[strings.ToLower(name)] = &cert
+	}
+	return sel, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. An exact hostname match wins over
+// a wildcard for the parent domain; otherwise the fallback certificate is used.
+func (c *certSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert, ok := c.lookup(hello.ServerName); ok {
+		return cert, nil
+	}
+	return c.fallback, nil
+}
+
+// lookup returns the certificate configured for the SNI hostname serverName, if any.
+func (c *certSelector) lookup(serverName string) (*tls.Certificate, bool) {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return nil, false
+	}
+	if cert, ok := c.byName[name]; ok {
+		return cert, true
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := c.byName["*."+parent]; ok {
+			return cert, true
+		}
+	}
+	return nil, false
+}
+
+// loadCertSelector builds the selector for the TLS listener from the certificate map in
+// the config directory. Failures are logged and leave only the fallback certificate.
+func loadCertSelector(fallback *tls.Certificate) *certSelector {
+	sel := &certSelector{byName: map[string]*tls.Certificate{}, fallback: fallback}
+	path, err := config.GetCertsPath()
+	if err != nil {
+		log.Printf("Failed to locate SNI certificate map: %v", err)
+		return sel
+	}
+	pairs, err := LoadCertMap(path)
+	if err != nil {
+		log.Printf("Failed to load SNI certificate map: %v", err)
+		return sel
+	}
+	loaded, err := newCertSelector(pairs, fallback)
+	if err != nil {
+		log.Printf("Failed to load SNI certificates: %v", err)
+		return sel
+	}
+	if len(loaded.byName) > 0 {
+		log.Printf("Loaded TLS certificates for %d SNI hostnames from %s", len(loaded.byName), path)
+	}
+	return loaded
+}
@@ -0,0 +1,199 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// SOCKS5 protocol constants (RFC 1928 and RFC 1929).
+const (
+	socksVersion         = 0x05
+	socksAuthVersion     = 0x01
+	socksMethodPassword  = 0x02
+	socksMethodNone      = 0xff // No acceptable methods
+	socksCommandConnect  = 0x01
+	socksAddressIPv4     = 0x01
+	socksAddressDomain   = 0x03
+	socksAddressIPv6     = 0x04
+	socksReplySucceeded  = 0x00
+	socksReplyFailure    = 0x01
+	socksReplyNotAllowed = 0x02
+	socksReplyRefused    = 0x05
+	socksReplyCommand    = 0x07
+	socksReplyAddress    = 0x08
+)
+
+// socksReplies maps openForward results to SOCKS reply codes.
+var socksReplies = map[string]byte{
+	"invalid":     socksReplyFailure,
+	"denied":      socksReplyNotAllowed,
+	"limited":     socksReplyFailure,
+	"unreachable": socksReplyRefused,
+}
+
+// errSOCKSAuth is returned when a SOCKS client does not offer or fails username/password
+// authentication.
+var errSOCKSAuth = errors.New("SOCKS authentication failed")
+
+// handleSOCKS serves a SOCKS5 CONNECT request read from r. Clients must authenticate with
+// a user's username and password, which are checked like SSH passwords. It reports
+// whether the session was relayed.
+func (s *Session) handleSOCKS(r *requestReader) bool {
+	s.client.SetReadDeadline(s.clock.Now().Add(RequestHeaderTimeout.Load()))
+	user, err := s.socksAuthenticate(r)
+	if err != nil {
+		proxyRequests.Inc("socks", "unauthorized")
+		log.Printf("[session %s] SOCKS handshake failed: %v", s.sessionID, err)
+		return false
+	}
+	target, reply, err := readSOCKSRequest(r)
+	if err != nil {
+		proxyRequests.Inc("socks", "invalid")
+		log.Printf("[session %s] Invalid SOCKS request: %v", s.sessionID, err)
+		if reply != 0 {
+			s.socksReply(reply, nil)
+		}
+		return false
+	}
+	s.enterPhase(PhaseRelay)
+
+	release, result, _ := s.openForward(user, target)
+	if release == nil {
+		proxyRequests.Inc("socks", result)
+		s.socksReply(socksReplies[result], nil)
+		return false
+	}
+	if err := s.socksReply(socksReplySucceeded, s.target.LocalAddr()); err != nil {
+		log.Printf("[session %s] Failed to write SOCKS reply: %v", s.sessionID, err)
+		release()
+		return false
+	}
+	s.preData = r.Pending()
+	proxyRequests.Inc("socks", "forwarded")
+	release = s.startForward(user, target, release)
+	s.Relay()
+	release()
+	return true
+}
+
+// socksAuthenticate negotiates username/password authentication and returns the user.
+func (s *Session) socksAuthenticate(r io.Reader) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", err
+	}
+	offered := false
+	for _, method := range methods {
+		offered = offered || method == socksMethodPassword
+	}
+	if !offered {
+		s.client.Write([]byte{socksVersion, socksMethodNone})
+		return "", errSOCKSAuth
+	}
+	if _, err := s.client.Write([]byte{socksVersion, socksMethodPassword}); err != nil {
+		return "", err
+	}
+
+	// VER ULEN UNAME PLEN PASSWD
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksAuthVersion {
+		return "", errSOCKSAuth
+	}
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(r, user); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(r, header[:1]); err != nil {
+		return "", err
+	}
+	password := make([]byte, header[0])
+	if _, err := io.ReadFull(r, password); err != nil {
+		return "", err
+	}
+
+	addr := ssh.SessionAddr{ID: s.sessionID, Client: s.client.RemoteAddr(), ClientCert: s.clientCert()}
+	if err := ssh.AuthenticateProxy(addr, string(user), string(password)); err != nil {
+		s.publishEvent(EventAuthFailed, Event{User: string(user), Error: err.Error()})
+		s.client.Write([]byte{socksAuthVersion, 0x01})
+		return "", err
+	}
+	if _, err := s.client.Write([]byte{socksAuthVersion, 0x00}); err != nil {
+		return "", err
+	}
+	return string(user), nil
+}
+
+// readSOCKSRequest reads a SOCKS request and returns its destination as host:port. On
+// failure it also returns the reply to send, if any.
+func readSOCKSRequest(r io.Reader) (target string, reply byte, err error) {
+	header := make([]byte, 4) // VER CMD RSV ATYP
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", 0, err
+	}
+	if header[0] != socksVersion {
+		return "", socksReplyFailure, errors.New("unsupported version")
+	}
+	if header[1] != socksCommandConnect {
+		return "", socksReplyCommand, errors.New("unsupported command")
+	}
+
+	var host string
+	switch header[3] {
+	case socksAddressIPv4, socksAddressIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if header[3] == socksAddressIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", 0, err
+		}
+		host = ip.String()
+	case socksAddressDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		return "", socksReplyAddress, errors.New("unsupported address type")
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", 0, err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), 0, nil
+}
+
+// socksReply writes a SOCKS reply with the given code and bound address, which may be nil.
+func (s *Session) socksReply(code byte, bound net.Addr) error {
+	reply := []byte{socksVersion, code, 0x00}
+	ip, port := net.IPv4zero.To4(), 0
+	if tcpAddr, ok := bound.(*net.TCPAddr); ok {
+		ip, port = tcpAddr.IP, tcpAddr.Port
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		reply = append(append(reply, socksAddressIPv4), ip4...)
+	} else {
+		reply = append(append(reply, socksAddressIPv6), ip.To16()...)
+	}
+	reply = binary.BigEndian.AppendUint16(reply, uint16(port))
+	_, err := s.client.Write(reply)
+	return err
+}
@@ -0,0 +1,200 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Speedtest requests are answered below SpeedtestPathPrefix: "ping" answers at once,
+// "down" streams a payload to the client and "up" accepts one from it.
+const SpeedtestPathPrefix = "/speedtest/"
+
+// Speedtest kinds
+const (
+	SpeedtestPing = "ping" // GET: an immediate SpeedtestResult, to time the round trip
+	SpeedtestDown = "down" // GET ?size=10MB: the given number of bytes
+	SpeedtestUp   = "up"   // POST with a Content-Length body: a SpeedtestResult timing its upload
+)
+
+// Speedtest configuration, read from the environment at startup.
+var (
+	// Speedtest lets users who authenticate with basic auth measure the throughput and
+	// latency of their tunnel against the server itself. It is read from
+	// SSH_IFY_SPEEDTEST.
+	Speedtest = config.EnvBool("SSH_IFY_SPEEDTEST", false)
+
+	// SpeedtestMaxSize is the largest payload one speedtest request may send or receive.
+	// It is read from SSH_IFY_SPEEDTEST_MAX_SIZE.
+	SpeedtestMaxSize = config.EnvSize("SSH_IFY_SPEEDTEST_MAX_SIZE", 100<<20)
+)
+
+// SpeedtestDefaultSize is the payload of download tests that do not give a size.
+const SpeedtestDefaultSize = 10 << 20
+
+// SpeedtestResult answers ping and upload tests.
+type SpeedtestResult struct {
+	Time          time.Time `json:"time"`                      // When the server answered
+	Bytes         int64     `json:"bytes,omitempty"`           // Payload bytes received
+	DurationMS    int64     `json:"duration_ms,omitempty"`     // From the end of the request headers, or 100 Continue, to the last payload byte
+	BitsPerSecond int64     `json:"bits_per_second,omitempty"` // Bytes over duration, in bits per second
+}
+
+// speedtests counts speedtest requests by kind and result.
+var speedtests = metrics.NewCounterVec("ssh_ify_speedtests_total",
+	"Number of speedtest requests, by kind and result.", "kind", "result")
+
+// speedtestPayload is repeated to make download payloads. It is random so that
+// compressing proxies on the way cannot inflate the measured throughput.
+var speedtestPayload = func() []byte {
+	b := make([]byte, 64<<10)
+	rand.Read(b)
+	return b
+}()
+
+// speedtestKind returns the kind of speedtest req asks for, or "" if it asks for none.
+func speedtestKind(req *http.Request) string {
+	if !Speedtest {
+		return ""
+	}
+	kind, ok := strings.CutPrefix(req.URL.Path, SpeedtestPathPrefix)
+	if !ok {
+		return ""
+	}
+	return kind
+}
+
+// serveSpeedtest answers a speedtest request of the given kind from the authenticated
+// user. Its traffic passes through the session's relayer, so the bandwidth cap applies,
+// and is recorded as the user's usage.
+func (s *Session) serveSpeedtest(req *http.Request, kind string) {
+	start := s.clock.Now()
+	s.authMutex.Lock()
+	s.username, s.authenticatedAt = s.upgradeUser, start
+	s.authMutex.Unlock()
+
+	var err error
+	var status int
+	switch {
+	case kind == SpeedtestPing && req.Method == http.MethodGet:
+		err = s.writeSpeedtestResult(SpeedtestResult{Time: s.clock.Now()})
+	case kind == SpeedtestDown && req.Method == http.MethodGet:
+		status, err = s.speedtestDown(req)
+	case kind == SpeedtestUp && (req.Method == http.MethodPost || req.Method == http.MethodPut):
+		status, err = s.speedtestUp(req, start)
+	case kind == SpeedtestPing || kind == SpeedtestDown || kind == SpeedtestUp:
+		status = http.StatusMethodNotAllowed
+	default:
+		status = http.StatusNotFound
+	}
+
+	result := "ok"
+	switch {
+	case status != 0:
+		result = "rejected"
+		s.respond(status)
+	case err != nil && !isIgnorableError(err):
+		result = "error"
+		log.Printf("[session %s] Speedtest %s for user '%s' failed: %v", s.sessionID, kind, s.upgradeUser, err)
+	default:
+		log.Printf("[session %s] Speedtest %s for user '%s' took %s", s.sessionID, kind, s.upgradeUser,
+			s.clock.Now().Sub(start).Round(time.Millisecond))
+	}
+	speedtests.Inc(kind, result)
+	s.recordUsage(s.bytesIn.Load(), s.bytesOut.Load())
+}
+
+// speedtestDown streams the number of bytes given by the size query parameter. A
+// non-zero status means the request was refused.
+func (s *Session) speedtestDown(req *http.Request) (int, error) {
+	size := int64(SpeedtestDefaultSize)
+	if value := req.URL.Query().Get("size"); value != "" {
+		n, err := config.ParseSize(value)
+		if err != nil || n <= 0 {
+			return http.StatusBadRequest, nil
+		}
+		size = n
+	}
+	if size > SpeedtestMaxSize {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n"+
+		"Content-Length: %d\r\nCache-Control: no-store\r\nConnection: close\r\n\r\n", size)
+	if _, err := io.WriteString(s.client, header); err != nil {
+		return 0, err
+	}
+	payload := io.LimitReader(repeatReader(speedtestPayload), size)
+	_, err := s.relayer.Copy(s.server.ctx, TargetToClient, s.client, &activityReader{r: payload, s: s},
+		countBytes(&s.bytesOut, relayedBytesOut))
+	return 0, err
+}
+
+// speedtestUp reads a request body of at most SpeedtestMaxSize bytes and answers with
+// the time it took since start, or since 100 Continue was sent if the client expects it.
+// A non-zero status means the request was refused.
+func (s *Session) speedtestUp(req *http.Request, start time.Time) (int, error) {
+	if req.ContentLength < 0 {
+		return http.StatusLengthRequired, nil
+	}
+	if req.ContentLength > SpeedtestMaxSize {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	if strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+		// The client waits for this before sending the body, so timing starts here.
+		if _, err := io.WriteString(s.client, "HTTP/1.1 100 Continue\r\n\r\n"); err != nil {
+			return 0, err
+		}
+		start = s.clock.Now()
+	}
+
+	body := io.LimitReader(io.MultiReader(bytes.NewReader(s.preData), s.client), req.ContentLength)
+	s.preData = nil
+	n, err := s.relayer.Copy(s.server.ctx, ClientToTarget, io.Discard, &activityReader{r: body, s: s},
+		countBytes(&s.bytesIn, relayedBytesIn))
+	if err != nil {
+		return 0, err
+	}
+	if n < req.ContentLength {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	now := s.clock.Now()
+	elapsed := now.Sub(start)
+	result := SpeedtestResult{Time: now, Bytes: n, DurationMS: elapsed.Milliseconds()}
+	if elapsed > 0 {
+		result.BitsPerSecond = int64(float64(n*8) / elapsed.Seconds())
+	}
+	return 0, s.writeSpeedtestResult(result)
+}
+
+// writeSpeedtestResult answers with result as JSON.
+func (s *Session) writeSpeedtestResult(result SpeedtestResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.client, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n"+
+		"Content-Length: %d\r\nCache-Control: no-store\r\nConnection: close\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// repeatReader reads b over and over.
+type repeatReader []byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		n += copy(p[n:], r)
+	}
+	return n, nil
+}
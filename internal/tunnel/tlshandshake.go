@@ -0,0 +1,123 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Reasons TLS handshakes fail for, as counted in tlsHandshakeFailures
+const (
+	TLSFailureTimeout      = "timeout"            // The client did not finish within TLSHandshakeTimeout
+	TLSFailureClosed       = "closed"             // The client hung up before finishing
+	TLSFailurePlainHTTP    = "plain_http"         // The client sent a plain HTTP request
+	TLSFailureNotTLS       = "not_tls"            // The client spoke another protocol, such as SSH
+	TLSFailureProtocol     = "protocol"           // No TLS version, cipher suite or curve in common
+	TLSFailureUnknownSNI   = "unknown_sni"        // The client rejected the default certificate served for its unknown SNI
+	TLSFailureCertRejected = "cert_rejected"      // The client rejected the server certificate
+	TLSFailureClientCert   = "client_certificate" // The client certificate was missing or not trusted
+	TLSFailureOther        = "other"
+)
+
+var (
+	// tlsHandshakes counts completed TLS handshakes.
+	tlsHandshakes = metrics.NewCounter("ssh_ify_tls_handshakes_total",
+		"Number of TLS handshakes completed on the TLS listeners.")
+
+	// tlsHandshakeFailures counts failed TLS handshakes by reason.
+	tlsHandshakeFailures = metrics.NewCounterVec("ssh_ify_tls_handshake_failures_total",
+		"Number of TLS handshakes that failed on the TLS listeners.", "reason")
+)
+
+// tlsFailureHints suggest what to change on the client for a failure reason.
+var tlsFailureHints = map[string]string{
+	TLSFailurePlainHTTP:    "the client sent plain HTTP to the TLS port; enable TLS/SSL in the client or use the TCP listener",
+	TLSFailureNotTLS:       "the client did not start a TLS handshake; enable TLS/SSL in the client or use the TCP listener",
+	TLSFailureProtocol:     "the client supports no TLS version or cipher suite the server accepts; update the client or check hardened mode",
+	TLSFailureUnknownSNI:   "no certificate is configured for the client's SNI hostname; add it to certs.json or change the SNI in the client",
+	TLSFailureCertRejected: "the client does not trust the server certificate; install a certificate it trusts or disable verification in the client",
+	TLSFailureClientCert:   "the client presented no certificate signed by SSH_IFY_CLIENT_CA",
+}
+
+// handshakeTLS completes the TLS handshake of a session accepted on a TLS listener within
+// TLSHandshakeTimeout, reporting whether it succeeded. Failures are counted, logged with a
+// hint where the cause is clear and, for plain HTTP requests, answered as PlainHTTPOnTLS selects.
+func (s *Session) handshakeTLS() bool {
+	tlsConn, ok := s.client.(*tls.Conn)
+	if !ok {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(s.server.ctx, TLSHandshakeTimeout.Load())
+	defer cancel()
+	err := tlsConn.HandshakeContext(ctx)
+	if err == nil {
+		if rec, ok := tlsConn.NetConn().(*recordingConn); ok {
+			rec.stop()
+		}
+		tlsHandshakes.Inc()
+		return true
+	}
+
+	reason := s.classifyTLSError(tlsConn, err)
+	tlsHandshakeFailures.Inc(reason)
+	var header tls.RecordHeaderError
+	if reason == TLSFailurePlainHTTP && errors.As(err, &header) && header.Conn != nil {
+		s.answerPlainHTTP(header.Conn)
+	}
+	if hint, ok := tlsFailureHints[reason]; ok {
+		logsample.Printf(logsample.TLSHandshake, "[session %s] TLS handshake failed (%s): %v; %s", s.sessionID, reason, err, hint)
+	} else {
+		logsample.Printf(logsample.TLSHandshake, "[session %s] TLS handshake failed (%s): %v", s.sessionID, reason, err)
+	}
+	return false
+}
+
+// classifyTLSError returns the reason the handshake on tlsConn failed with err.
+func (s *Session) classifyTLSError(tlsConn *tls.Conn, err error) string {
+	var header tls.RecordHeaderError
+	var ne net.Error
+	msg := err.Error()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return TLSFailureTimeout
+	case errors.As(err, &header):
+		if looksLikeHTTP(header.RecordHeader[:]) {
+			return TLSFailurePlainHTTP
+		}
+		return TLSFailureNotTLS
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return TLSFailureClosed
+	case strings.Contains(msg, "unsupported versions"), strings.Contains(msg, "supported by both client and server"),
+		strings.Contains(msg, "older than TLS 1.3"), strings.Contains(msg, "protocol version not supported"),
+		strings.Contains(msg, "insufficient security"):
+		return TLSFailureProtocol
+	case strings.Contains(msg, "client didn't provide a certificate"), strings.Contains(msg, "failed to verify certificate"),
+		strings.Contains(msg, "client certificate"):
+		return TLSFailureClientCert
+	case strings.Contains(msg, "remote error") && strings.Contains(msg, "certificate"):
+		if name := tlsConn.ConnectionState().ServerName; name != "" && s.server.tlsCerts != nil {
+			if _, ok := s.server.tlsCerts.lookup(name); !ok {
+				return TLSFailureUnknownSNI
+			}
+		}
+		return TLSFailureCertRejected
+	}
+	return TLSFailureOther
+}
+
+// looksLikeHTTP reports whether the five bytes read as a TLS record header start an HTTP
+// request instead.
+func looksLikeHTTP(header []byte) bool {
+	switch string(header) {
+	case "GET /", "HEAD ", "POST ", "PUT /", "OPTIO", "CONNE", "DELET", "PATCH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/alert"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+)
+
+// Budget actions
+const (
+	// BudgetThrottle limits all traffic to BudgetThrottleRate once the budget is reached.
+	BudgetThrottle = "throttle"
+	// BudgetStop refuses new tunnels once the budget is reached.
+	BudgetStop = "stop"
+)
+
+// TransferCheckInterval is how often the monthly transfer is updated and saved.
+const TransferCheckInterval = 10 * time.Second
+
+// Monthly transfer budget configuration, read from the environment at startup.
+var (
+	// MonthlyBudget is the server's transfer allowance per calendar month, counting both
+	// directions. It is read from SSH_IFY_MONTHLY_BUDGET, e.g. "2TB"; 0 disables it.
+	MonthlyBudget = config.EnvSize("SSH_IFY_MONTHLY_BUDGET", 0)
+
+	// BudgetThreshold is the percentage of MonthlyBudget at which BudgetAction is taken.
+	// It is read from SSH_IFY_BUDGET_THRESHOLD.
+	BudgetThreshold = config.EnvInt("SSH_IFY_BUDGET_THRESHOLD", 90)
+
+	// BudgetAction is BudgetThrottle or BudgetStop. It is read from SSH_IFY_BUDGET_ACTION.
+	BudgetAction = config.Env("SSH_IFY_BUDGET_ACTION", BudgetThrottle)
+
+	// BudgetThrottleRate is the bytes per second each direction is limited to when
+	// throttling. It is read from SSH_IFY_BUDGET_THROTTLE_RATE.
+	BudgetThrottleRate = config.EnvSize("SSH_IFY_BUDGET_THROTTLE_RATE", 64*1024)
+)
+
+var (
+	// monthTransfer is the server's transfer so far this month.
+	monthTransfer atomic.Int64
+
+	// budgetReached is set once the transfer passed the budget threshold this month.
+	budgetReached atomic.Bool
+
+	monthTransferGauge = metrics.NewGaugeFunc("ssh_ify_month_transfer_bytes",
+		"Bytes relayed in both directions in the current calendar month.",
+		func() float64 { return float64(monthTransfer.Load()) })
+	budgetReachedGauge = metrics.NewGaugeFunc("ssh_ify_month_budget_reached",
+		"Whether the monthly transfer budget threshold has been reached (1) or not (0).",
+		func() float64 {
+			if budgetReached.Load() {
+				return 1
+			}
+			return 0
+		})
+	budgetRefusals = metrics.NewCounter("ssh_ify_budget_refused_sessions_total",
+		"Sessions refused because the monthly transfer budget was reached.")
+)
+
+// transferState is the monthly transfer counter persisted across restarts.
+type transferState struct {
+	Month   string `json:"month"`   // Calendar month as "2006-01"
+	Bytes   int64  `json:"bytes"`   // Bytes relayed in Month
+	Alerted bool   `json:"alerted"` // Whether the budget alert was sent for Month
+}
+
+// trackTransfer counts relayed bytes against the monthly budget until the server shuts
+// down, taking BudgetAction when the threshold is reached and undoing it when a new
+// month begins. It does nothing if no budget is configured.
+func (s *Server) trackTransfer() {
+	if MonthlyBudget <= 0 {
+		return
+	}
+	path, err := config.GetTransferPath()
+	if err != nil {
+		log.Printf("Monthly transfer budget disabled: %v", err)
+		return
+	}
+	if BudgetAction != BudgetThrottle && BudgetAction != BudgetStop {
+		log.Printf("Unknown SSH_IFY_BUDGET_ACTION %q, using %s", BudgetAction, BudgetThrottle)
+	}
+	state := loadTransferState(path)
+	last := relayedBytesIn.Value() + relayedBytesOut.Value()
+
+	ticker := time.NewTicker(TransferCheckInterval)
+	defer ticker.Stop()
+	for {
+		total := relayedBytesIn.Value() + relayedBytesOut.Value()
+		s.updateTransfer(&state, total-last)
+		last = total
+		if err := saveTransferState(path, state); err != nil {
+			log.Printf("Failed to save monthly transfer: %v", err)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateTransfer adds delta bytes to state, starting a new month if needed, and applies
+// or lifts the budget action.
+func (s *Server) updateTransfer(state *transferState, delta int64) {
+	if month := s.clock.Now().Format("2006-01"); month != state.Month {
+		if state.Month != "" {
+			log.Printf("Monthly transfer: %s used %s, starting %s", state.Month, accounting.FormatBytes(state.Bytes), month)
+		}
+		*state = transferState{Month: month}
+		if budgetReached.Swap(false) {
+			egressBucket.SetRate(EgressLimit)
+			ingressBucket.SetRate(IngressLimit)
+			log.Println("Monthly transfer budget reset, lifting restrictions")
+		}
+	}
+	state.Bytes += delta
+	monthTransfer.Store(state.Bytes)
+
+	if state.Bytes < MonthlyBudget*int64(BudgetThreshold)/100 || budgetReached.Swap(true) {
+		return
+	}
+	if BudgetAction != BudgetStop {
+		egressBucket.SetRate(lowerLimit(EgressLimit, BudgetThrottleRate))
+		ingressBucket.SetRate(lowerLimit(IngressLimit, BudgetThrottleRate))
+	}
+	if !state.Alerted {
+		state.Alerted = true
+		alert.Send("transfer_budget", "%s of %s monthly transfer budget used (%d%%), action: %s",
+			accounting.FormatBytes(state.Bytes), accounting.FormatBytes(MonthlyBudget), BudgetThreshold, BudgetAction)
+	}
+}
+
+// lowerLimit returns the lower of two rate limits, where 0 means unlimited.
+func lowerLimit(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// refuseOverTransferBudget refuses the session with a 503 response if the monthly
+// budget was reached with BudgetStop and reports whether it did so.
+func (s *Session) refuseOverTransferBudget() bool {
+	if BudgetAction != BudgetStop || !budgetReached.Load() {
+		return false
+	}
+	budgetRefusals.Inc()
+	log.Printf("[session %s] Monthly transfer budget reached, refusing session", s.sessionID)
+	s.respond(http.StatusServiceUnavailable)
+	return true
+}
+
+// loadTransferState reads the persisted counter, starting from zero if it is missing
+// or unreadable.
+func loadTransferState(path string) transferState {
+	var state transferState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read monthly transfer: %v", err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Failed to parse monthly transfer %s: %v", path, err)
+	}
+	return state
+}
+
+// saveTransferState writes the counter atomically.
+func saveTransferState(path string, state transferState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
@@ -2,13 +2,14 @@
 package tunnel
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -17,8 +18,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/bufpool"
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/keepalive"
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/relay"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sandbox"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sockopt"
 	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
-	"github.com/ayanrajpoot10/ssh-ify/pkg/certgen"
 )
 
 // Constants
@@ -29,11 +39,13 @@ const (
 	// BufferSize defines the buffer size (in bytes) for reading client requests.
 	BufferSize = 4096 * 4
 
-	// ClientReadTimeout specifies the maximum duration to wait for client data before timing out.
+	// ClientReadTimeout is the default of HandshakeTimeout, which the handshake stage
+	// timeouts default to in turn.
 	ClientReadTimeout = 60 * time.Second
 
 	// WebSocketUpgradeResponse is the HTTP response sent to clients to acknowledge a successful
-	// WebSocket protocol upgrade. This is used to establish SSH-over-WebSocket tunnels.
+	// WebSocket protocol upgrade. This is used to establish SSH-over-WebSocket tunnels. Its
+	// fixed accept key is only sent to clients without a Sec-WebSocket-Key or in legacy mode.
 	WebSocketUpgradeResponse = "HTTP/1.1 101 Switching Protocols\r\n" +
 		"Upgrade: websocket\r\n" +
 		"Connection: Upgrade\r\n" +
@@ -52,19 +64,60 @@ var (
 	// DefaultListenTLSPort is the default TLS listen port (HTTPS).
 	DefaultListenTLSPort int = 443
 
+	// DefaultTLSCertFile is the default path of the TLS certificate (generated if missing).
+	DefaultTLSCertFile string = "cert.pem"
+
+	// DefaultTLSKeyFile is the default path of the TLS private key (generated if missing).
+	DefaultTLSKeyFile string = "key.pem"
+
+	// MaxHeaderSize is the maximum size in bytes of the HTTP request header block.
+	// It is read from SSH_IFY_MAX_HEADER_SIZE, e.g. "32KB".
+	MaxHeaderSize = config.EnvSize("SSH_IFY_MAX_HEADER_SIZE", BufferSize)
+
+	// HeaderLineTimeout is the maximum time a client may take to send each header line.
+	// It is read from SSH_IFY_HEADER_LINE_TIMEOUT, e.g. "10s".
+	HeaderLineTimeout = config.EnvTunableDuration("SSH_IFY_HEADER_LINE_TIMEOUT", 10*time.Second)
+
+	// MaxRequestLineSize is the maximum size in bytes of the request line, the method,
+	// target and protocol version. It is read from SSH_IFY_MAX_REQUEST_LINE, e.g. "8KB".
+	MaxRequestLineSize = config.EnvSize("SSH_IFY_MAX_REQUEST_LINE", 8*1024)
+
+	// MaxHeaderLines is the maximum number of header lines in the request header block,
+	// not counting the request line. It is read from SSH_IFY_MAX_HEADER_LINES.
+	MaxHeaderLines = config.EnvInt("SSH_IFY_MAX_HEADER_LINES", 100)
+
+	// HandshakeTimeout is the default of TLSHandshakeTimeout and RequestHeaderTimeout. It
+	// is read from SSH_IFY_HANDSHAKE_TIMEOUT.
+	HandshakeTimeout = config.EnvDuration("SSH_IFY_HANDSHAKE_TIMEOUT", ClientReadTimeout)
+
+	// TLSHandshakeTimeout is the maximum time a client of a TLS listener may take to
+	// complete the TLS handshake. It is read from SSH_IFY_TLS_HANDSHAKE_TIMEOUT.
+	TLSHandshakeTimeout = config.EnvTunableDuration("SSH_IFY_TLS_HANDSHAKE_TIMEOUT", HandshakeTimeout)
+
+	// RequestHeaderTimeout is the maximum total time a client may take to send the whole
+	// request header block, or the SOCKS handshake, however steadily it trickles data. It
+	// is read from SSH_IFY_REQUEST_HEADER_TIMEOUT. The SSH handshake that follows is
+	// bounded by ssh.AuthTimeout.
+	RequestHeaderTimeout = config.EnvTunableDuration("SSH_IFY_REQUEST_HEADER_TIMEOUT", HandshakeTimeout)
+
+	// relayedBytesIn and relayedBytesOut count bytes relayed from and to clients.
+	relayedBytesIn = metrics.NewCounter("ssh_ify_relayed_bytes_in_total",
+		"Number of bytes relayed from clients to the SSH server.")
+	relayedBytesOut = metrics.NewCounter("ssh_ify_relayed_bytes_out_total",
+		"Number of bytes relayed from the SSH server to clients.")
+
+	// headerReadFailures counts requests dropped while reading headers, by reason.
+	headerReadFailures = metrics.NewCounterVec("ssh_ify_header_read_failures_total",
+		"Number of connections dropped while reading the request header block.", "reason")
+
 	// bufferPool is a pool of reusable byte slices for I/O operations
-	bufferPool = sync.Pool{
-		New: func() interface{} {
-			buf := make([]byte, BufferPoolSize)
-			return &buf
-		},
-	}
+	bufferPool = bufpool.New("relay", BufferPoolSize)
 )
 
 // Buffer pool functions
 // getBuffer retrieves a buffer from the pool
 func getBuffer() *[]byte {
-	return bufferPool.Get().(*[]byte)
+	return bufferPool.Get()
 }
 
 // putBuffer returns a buffer to the pool for reuse
@@ -72,25 +125,63 @@ func putBuffer(buf *[]byte) {
 	bufferPool.Put(buf)
 }
 
-// CopyWithBuffer performs buffered copying using a pooled buffer.
-func CopyWithBuffer(dst io.Writer, src io.Reader) (int64, error) {
+// BuffersInUse returns the number of relay buffers currently checked out of the pool.
+func BuffersInUse() int64 {
+	return bufferPool.InUse()
+}
+
+// BufferPoolStats returns a snapshot of the use of the relay buffer pool.
+func BufferPoolStats() bufpool.Stats {
+	return bufferPool.Stats()
+}
+
+// CopyWithBuffer copies src to dst with a pooled buffer until src is exhausted, either
+// side fails or ctx is cancelled, passing the bytes read to report as it goes.
+func CopyWithBuffer(ctx context.Context, dst io.Writer, src io.Reader, report relay.Reporter) (int64, error) {
 	buf := getBuffer()
 	defer putBuffer(buf)
-	return io.CopyBuffer(dst, src, *buf)
+	return relay.Copy(ctx, dst, src, *buf, report)
 }
 
 // Server manages TCP and TLS connections for the ssh-ify tunnel proxy server.
 type Server struct {
-	host        string
-	tcpPort     int
-	tlsPort     int
-	ctx         context.Context
-	cancel      context.CancelFunc
-	conns       sync.Map       // map[*Session]struct{} for concurrency safety
-	activeCount int32          // atomic counter for active connections
-	tlsCertFile string         // Path to TLS certificate file
-	tlsKeyFile  string         // Path to TLS key file
-	wg          sync.WaitGroup // WaitGroup to track active sessions
+	host         string
+	tcpPort      int
+	tlsPort      int
+	ctx          context.Context
+	cancel       context.CancelFunc
+	conns        sync.Map                 // map[*Session]struct{} for concurrency safety
+	activeCount  int32                    // atomic counter for active connections
+	addMutex     sync.Mutex               // Orders Add against the start of Shutdown
+	preAuthCount atomic.Int32             // Accepted connections that have not authenticated yet
+	tlsCertFile  string                   // Path to TLS certificate file
+	tlsKeyFile   string                   // Path to TLS key file
+	tlsOnce      sync.Once                // Loads tlsConf for the first TLS listener
+	tlsConf      *tls.Config              // TLS configuration shared by all TLS listeners
+	tlsCerts     *certSelector            // Certificates of tlsConf by SNI hostname
+	adminOnce    sync.Once                // Creates adminHandler on first use
+	adminHandler http.Handler             // Web admin dashboard and API
+	wg           sync.WaitGroup           // WaitGroup to track active sessions
+	dialer       ssh.Dialer               // Dialer used by sessions for forwarded channels
+	relayer      Relayer                  // Copies the byte streams of sessions
+	clock        clock.Clock              // Time source used by sessions for deadlines
+	listeners    sync.Map                 // map[string]*listener of running accept loops
+	listenerCfgs []ListenerConfig         // Tunnel listeners, loaded before they are served
+	switches     listenerSwitches         // Listeners an admin disabled at runtime
+	responses    map[int]ResponseTemplate // Custom HTTP responses by status code
+	usage        *accounting.Store        // Store finished sessions are recorded in
+	startedAt    time.Time                // When the server was created
+
+	listenCtx     context.Context    // Cancelled when the server stops accepting connections
+	stopListening context.CancelFunc // Stops accepting, e.g. while draining after an upgrade
+	sockets       sync.Map           // map[string]*net.TCPListener handed to a successor on upgrade
+	upgraded      atomic.Bool        // Set once the listeners were handed to a successor
+	resumable     sync.Map           // map[string]*resumableConn of sessions clients can resume
+
+	maintenanceMutex sync.Mutex   // Guards maintenance
+	maintenance      *Maintenance // Maintenance in progress, or nil
+
+	events eventHub // Subscribers to session events
 }
 
 // Session manages a single client connection for the ssh-ify tunnel proxy server.
@@ -100,33 +191,82 @@ type Session struct {
 	server    *Server
 	sshConfig *ssh.ServerConfig
 	sessionID string
+	dialer    ssh.Dialer
+	relayer   Relayer
+	clock     clock.Clock
+	features  Features // Features of the listener the session was accepted on
+	listener  string   // Name of the listener the session was accepted on
+	probe     bool     // Whether the session is the doctor's loopback probe, see ServeProbe
+
+	lastActivity atomic.Int64    // UnixNano time data was last relayed in either direction
+	deadlines    deadlineManager // Idle deadline of the client, by phase
+	memory       atomic.Int64    // Bytes of buffers and pipes accounted to this session
+
+	preData []byte // Bytes read past the request header block, relayed before the client stream
+
+	preAuth      atomic.Bool // Set while the session counts as waiting to authenticate
+	preAuthTimer clock.Timer // Closes the session at PreAuthTimeout, if set
+
+	authFailed  atomic.Bool // Set when the client failed SSH authentication
+	upgradeUser string      // User authenticated by basic auth on the upgrade request
+
+	bytesIn  atomic.Int64 // Bytes relayed from the client so far
+	bytesOut atomic.Int64 // Bytes relayed to the client so far
+
+	authMutex       sync.Mutex // Guards username, authenticatedAt and clientVersion, set by the SSH goroutine
+	username        string     // SSH user the session authenticated as
+	authenticatedAt time.Time  // When SSH authentication succeeded
+	clientVersion   string     // Version string of the SSH client, e.g. "SSH-2.0-OpenSSH_9.6"
 }
 
 // Server methods
 // Add registers a new client connection with the server.
 func (s *Server) Add(conn *Session) {
+	s.addMutex.Lock()
+	defer s.addMutex.Unlock()
 	select {
 	case <-s.ctx.Done():
 		return
 	default:
+		conn.leavePreAuth()
 		s.conns.Store(conn, struct{}{})
 		s.wg.Add(1)
 		newCount := atomic.AddInt32(&s.activeCount, 1)
-		log.Println("Connection added. Active:", newCount)
+		activeSessionsGauge.Set(int64(newCount))
+		log.Printf("[session %s] Connection added. Active: %d", conn.sessionID, newCount)
 	}
 }
 
 // Remove unregisters a client connection from the server.
+// Sessions that were never added (e.g. failed authentication) are ignored.
 func (s *Server) Remove(conn *Session) {
-	s.conns.Delete(conn)
+	if _, loaded := s.conns.LoadAndDelete(conn); !loaded {
+		return
+	}
 	s.wg.Done()
 	newCount := atomic.AddInt32(&s.activeCount, -1)
-	log.Println("Connection removed. Active:", newCount)
+	activeSessionsGauge.Set(int64(newCount))
+	log.Printf("[session %s] Connection removed. Active: %d", conn.sessionID, newCount)
 }
 
-// Shutdown gracefully terminates the server.
+// Shutdown gracefully terminates the server, logging the bytes its sessions relayed.
+// Sessions that finish authenticating once it started are not added.
 func (s *Server) Shutdown() {
-	log.Println("Closing all active connections...")
+	s.addMutex.Lock()
+	s.cancel()
+	s.addMutex.Unlock()
+
+	var count int
+	var bytesIn, bytesOut int64
+	s.conns.Range(func(key, value any) bool {
+		if sess, ok := key.(*Session); ok {
+			in, out := sess.Transferred()
+			count, bytesIn, bytesOut = count+1, bytesIn+in, bytesOut+out
+		}
+		return true
+	})
+	log.Printf("Closing %d active connections (%s in, %s out so far)...", count,
+		accounting.FormatBytes(bytesIn), accounting.FormatBytes(bytesOut))
 	s.conns.Range(func(key, value any) bool {
 		if sess, ok := key.(*Session); ok {
 			sess.Close()
@@ -134,114 +274,303 @@ func (s *Server) Shutdown() {
 		return true
 	})
 	s.wg.Wait()
-	log.Println("All sessions closed.")
+	log.Printf("All sessions closed. Relayed %s in, %s out since start.",
+		accounting.FormatBytes(relayedBytesIn.Value()), accounting.FormatBytes(relayedBytesOut.Value()))
+}
+
+// ServerOption changes a dependency of a Server created by NewServer.
+type ServerOption func(*Server)
+
+// WithDialer makes the server's sessions reach forwarding targets with dialer.
+func WithDialer(dialer ssh.Dialer) ServerOption {
+	return func(s *Server) { s.dialer = dialer }
+}
+
+// WithClock makes the server and its sessions take the time and schedule timers with c.
+func WithClock(c clock.Clock) ServerOption {
+	return func(s *Server) { s.clock = c }
 }
 
-// NewServer constructs and returns a new Server with default configuration.
-func NewServer() *Server {
+// NewServer constructs and returns a new Server with default configuration, using the
+// default dialer and the system clock unless opts replace them.
+func NewServer(opts ...ServerOption) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Server{
+	listenCtx, stopListening := context.WithCancel(ctx)
+	s := &Server{
 		host:        DefaultListenAddress,
 		tcpPort:     DefaultListenPort,
 		tlsPort:     DefaultListenTLSPort,
 		ctx:         ctx,
 		cancel:      cancel,
 		conns:       sync.Map{},
-		tlsCertFile: "cert.pem",
-		tlsKeyFile:  "key.pem",
+		tlsCertFile: DefaultTLSCertFile,
+		tlsKeyFile:  DefaultTLSKeyFile,
+		dialer:      ssh.DefaultDialer,
+		relayer:     limitedRelay{next: BufferedRelay{}},
+		clock:       clock.Real{},
+		usage:       accounting.NewStore(""),
+		responses:   loadResponseTemplates(),
+
+		listenCtx:     listenCtx,
+		stopListening: stopListening,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.startedAt = s.clock.Now()
+	return s
+}
+
+// NewSession creates a session for conn that inherits the server's dialer, relayer and clock.
+// Each session gets a unique ULID used to correlate its log lines.
+func NewSession(conn net.Conn, s *Server) *Session {
+	return &Session{
+		client:    conn,
+		server:    s,
+		sessionID: newSessionID(s.clock.Now()),
+		dialer:    s.dialer,
+		relayer:   s.relayer,
+		clock:     s.clock,
+	}
+}
+
+// ServeProbe serves conn, the server end of the doctor's in-process loopback probe, as
+// a session on a listener serving WebSocket upgrades. Logins as ssh.ProbeUser on it are
+// rejected without counting towards bans or lockouts.
+func (s *Server) ServeProbe(conn net.Conn) {
+	sess := NewSession(conn, s)
+	sess.features = Features{FeatureWebSocket: true}
+	sess.probe = true
+	sess.Handle()
+}
+
+// ID returns the unique identifier of the session.
+func (s *Session) ID() string {
+	return s.sessionID
 }
 
 // StartServer launches the tunnel proxy server and manages its lifecycle.
 func StartServer() {
 	s := NewServer()
 
-	// Create a channel to receive OS signals for graceful shutdown.
+	// Refuse permissive settings and weak keys before serving anything.
+	if config.Hardened {
+		if err := ssh.CheckHardened(); err != nil {
+			log.Fatalf("Refusing to start in hardened mode: %v", err)
+		}
+		if err := CheckHardenedTLS(); err != nil {
+			log.Fatalf("Refusing to start in hardened mode: %v", err)
+		}
+		log.Printf("Hardened mode: only strong TLS and SSH cryptography is offered")
+	}
+	if TunnelKeyMode != TunnelKeyStatic && TunnelKeyMode != TunnelKeySigned {
+		log.Fatalf("Unknown SSH_IFY_TUNNEL_KEY_MODE %q (expected %s or %s)", TunnelKeyMode, TunnelKeyStatic, TunnelKeySigned)
+	}
+	if err := ssh.ForwardSocketOptions.Check(); err != nil {
+		log.Fatalf("Invalid outbound socket options: %v", err)
+	}
+	if err := keepalive.Check(); err != nil {
+		log.Fatalf("Invalid SSH_IFY_KEEPALIVE_PRESET: %v", err)
+	}
+	if err := CheckPoW(); err != nil {
+		log.Fatalf("Invalid proof-of-work settings: %v", err)
+	}
+
+	// With privilege separation, this process either is a worker or supervises them.
+	if workerListener != "" {
+		startWorker()
+	} else if PrivsepUser != "" {
+		s.supervise()
+		return
+	}
+
+	s.listenerCfgs = s.listenerConfigs()
+	s.loadListenerStates()
+
+	// Workers other than the first listener's leave the shared services to it.
+	if servesListener(s.listenerCfgs[0].Name) {
+		s.serveSharedServices()
+	}
+
+	// Create a channel to receive OS signals for graceful shutdown and upgrades.
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, upgradeSignals...)...)
 
 	// Start both TCP and TLS servers simultaneously in separate goroutines.
 	s.ListenAndServe()
 
-	// Block until a shutdown signal is received (e.g., Ctrl+C or SIGTERM).
-	<-c
+	// Confine the process now that everything it needs is open.
+	if sandbox.Mode != "" {
+		s.applySandbox()
+	}
+
+	// Block until a shutdown signal is received (e.g., Ctrl+C or SIGTERM). An upgrade
+	// signal hands the listeners to a new process and drains this one instead.
+	for sig := range c {
+		if !isUpgradeSignal(sig) {
+			break
+		}
+		if err := s.Upgrade(); err != nil {
+			log.Printf("Upgrade failed, continuing to serve: %v", err)
+			continue
+		}
+		s.drain(c)
+		break
+	}
 	// Signal received: stop the server and log shutdown.
 	s.cancel()
 	s.Shutdown()
 	log.Println("Shutting down...")
 }
 
+// serveSharedServices starts the services beside the tunnel listeners: metrics, the admin
+// socket and web pages, the experimental transports and the background bookkeeping.
+func (s *Server) serveSharedServices() {
+	// Expose metrics if an address is configured.
+	if addr := config.Env("SSH_IFY_METRICS_ADDR", ""); addr != "" {
+		go s.serveMetrics(addr)
+	}
+
+	// Serve live statistics to "ssh-ify top" on the admin socket.
+	go s.serveAdminSocket()
+
+	// Serve the web admin dashboard if an address is configured.
+	go s.serveWebAdmin()
+
+	// Serve the password reset page if an address is configured.
+	go s.serveReset()
+
+	// Serve the self-service portal if an address is configured.
+	go s.servePortal()
+
+	// Serve the invite signup page if an address is configured.
+	go s.serveSignup()
+
+	// Serve the experimental DNS transport if a domain is configured.
+	go s.serveDNS()
+
+	// Serve the experimental ICMP transport if enabled.
+	go s.serveICMP()
+
+	// Publish stats to the cluster backend when running in cluster mode.
+	go s.publishClusterStats()
+
+	// Count transfer against the monthly budget if one is configured.
+	go s.trackTransfer()
+
+	// Record the sessions of servers that stopped unexpectedly, and checkpoint ours.
+	go s.checkpointSessions()
+}
+
 // Listen and serve methods
+// listener tracks a running accept loop so the watchdog can detect and restart it.
+type listener struct {
+	name      string
+	raw       deadlineListener // Underlying listener, used for accept deadlines
+	ln        net.Listener     // Listener connections are accepted from (may wrap raw in TLS)
+	features  Features         // Features enabled for sessions accepted on this listener
+	heartbeat atomic.Int64     // UnixNano time of the last accept loop iteration
+}
+
+// deadlineListener is a listener whose Accept calls can be bounded, such as
+// *net.TCPListener.
+type deadlineListener interface {
+	net.Listener
+	SetDeadline(t time.Time) error
+}
+
 // serveListener continuously accepts incoming connections on the provided listener and
 // spawns a new session for each connection. It monitors the server context for shutdown
 // signals and ensures proper handling of connection deadlines and errors.
-func serveListener(s *Server, ln net.Listener) {
-	defer ln.Close()
+func serveListener(s *Server, l *listener) {
+	defer l.ln.Close()
 	for {
 		select {
-		case <-s.ctx.Done():
+		case <-s.listenCtx.Done():
 			return
 		default:
-			// Set deadline for TCPListener if possible
-			if tcpLn, ok := ln.(*net.TCPListener); ok {
-				tcpLn.SetDeadline(time.Now().Add(2 * time.Second))
-			}
-			conn, err := ln.Accept()
+			// Record liveness and bound Accept so shutdown and the watchdog are noticed.
+			l.heartbeat.Store(s.clock.Now().UnixNano())
+			l.raw.SetDeadline(time.Now().Add(2 * time.Second))
+			conn, err := l.ln.Accept()
 			if err != nil {
 				if ne, ok := err.(net.Error); ok && ne.Timeout() {
 					continue
 				}
+				if enabled, _ := s.switches.enabled(l.name); enabled {
+					log.Printf("%s listener accept failed: %v", l.name, err)
+				}
 				return
 			}
-			sess := &Session{client: conn, server: s, sessionID: conn.RemoteAddr().String()}
+			sess := NewSession(conn, s)
+			sess.features, sess.listener = l.features, l.name
+			if !s.admitPreAuth(sess) {
+				conn.Close()
+				continue
+			}
 			go sess.Handle()
 		}
 	}
 }
 
-// ListenAndServe starts both TCP and TLS tunnel servers simultaneously.
+// ListenAndServe starts all configured tunnel listeners simultaneously.
 func (s *Server) ListenAndServe() {
-	// Start TCP listener in a goroutine
-	go s.listenTCP()
-
-	// Start TLS listener in a goroutine
-	go s.listenTLS()
-}
-
-// listenTCP starts the plain TCP listener and handles incoming connections.
-func (s *Server) listenTCP() {
-	addr := fmt.Sprintf("%s:%d", s.host, s.tcpPort)
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("Failed to listen on TCP %s: %v", addr, err)
+	if s.listenerCfgs == nil {
+		s.listenerCfgs = s.listenerConfigs()
+		s.loadListenerStates()
 	}
-	log.Printf("TCP server listening on %s", addr)
-	serveListener(s, ln)
-}
 
-// listenTLS starts the TLS listener and handles incoming secure connections.
-func (s *Server) listenTLS() {
-	// Auto-generate certificates if they don't exist
-	if err := certgen.GenerateCert(s.tlsCertFile, s.tlsKeyFile); err != nil {
-		log.Fatalf("Failed to generate TLS certificates: %v", err)
+	// Start each listener in a goroutine
+	for _, cfg := range s.listenerCfgs {
+		if servesListener(cfg.Name) {
+			go s.serveListenerConfig(cfg)
+		}
 	}
 
-	cert, err := tls.LoadX509KeyPair(s.tlsCertFile, s.tlsKeyFile)
-	if err != nil {
-		log.Fatalf("Failed to load TLS certificate or key: %v", err)
-	}
+	// Start the watchdog that monitors listeners, sessions and buffers
+	go s.runWatchdog()
+}
+
+// runListener binds addr and serves it until the server shuts down. If the accept loop
+// stops unexpectedly (e.g. after a watchdog restart) the address is bound again; while
+// an admin has the listener disabled, it is bound again once enabled.
+func (s *Server) runListener(name, addr string, opts sockopt.Options, features Features, wrap func(net.Listener) net.Listener) {
+	restart := false
+	for first := true; s.listenCtx.Err() == nil; first = false {
+		if restart {
+			log.Printf("%s listener stopped, restarting in %s", name, ListenerRestartDelay)
+			time.Sleep(ListenerRestartDelay)
+		}
+		if enabled, _ := s.switches.enabled(name); !enabled {
+			first = false
+			if !s.awaitListenerEnabled(name) {
+				return
+			}
+		}
 
-	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
-	addr := fmt.Sprintf("%s:%d", s.host, s.tlsPort)
+		tcpLn, err := s.listenWith(name, addr, opts)
+		if err != nil {
+			if first {
+				log.Fatalf("Failed to listen on %s %s: %v", name, addr, err)
+			}
+			log.Printf("Failed to listen on %s %s: %v", name, addr, err)
+			restart = true
+			continue
+		}
 
-	tcpLn, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("Failed to listen on TLS %s: %v", addr, err)
+		l := &listener{name: name, raw: tcpLn, ln: wrap(keepaliveListener{tcpLn}), features: features}
+		l.heartbeat.Store(s.clock.Now().UnixNano())
+		s.listeners.Store(name, l)
+		if opts.IsZero() {
+			log.Printf("%s server listening on %s (%s)", name, addr, features)
+		} else {
+			log.Printf("%s server listening on %s with %s (%s)", name, addr, opts, features)
+		}
+		serveListener(s, l)
+		s.listeners.Delete(name)
+		s.sockets.Delete(name)
+		restart, _ = s.switches.enabled(name)
 	}
-
-	ln := tls.NewListener(tcpLn, tlsConfig)
-	log.Printf("TLS server listening on %s", addr)
-	serveListener(s, ln)
 }
 
 // Session methods
@@ -257,71 +586,270 @@ func (s *Session) Close() {
 
 // Handle manages the lifecycle of a client connection.
 func (s *Session) Handle() {
-	log.Printf("[session %s] New connection opened", s.sessionID)
+	defer ssh.RecoverPanic("session", s.sessionID, s.Close)
+	log.Printf("[session %s] New connection opened from %s", s.sessionID, s.client.RemoteAddr())
 
-	// Set a read deadline to avoid hanging connections.
-	s.client.SetReadDeadline(time.Now().Add(ClientReadTimeout))
-	reader := bufio.NewReaderSize(s.client, BufferSize)
-	var builder strings.Builder
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			log.Printf("[session %s] Error reading from client: %v", s.sessionID, err)
-			log.Printf("[session %s] Closing connection due to read error.", s.sessionID)
-			return
+	relayed := false
+	defer func() {
+		if !relayed {
+			s.Close()
 		}
-		builder.WriteString(line)
-		if strings.HasSuffix(builder.String(), "\r\n\r\n") {
-			break
+		s.leavePreAuth()
+		s.releaseMemory()
+	}()
+
+	// Drop banned clients before doing any work for them.
+	if s.banned() {
+		return
+	}
+
+	// Refuse new sessions while the memory budget is exhausted.
+	if s.shed() {
+		return
+	}
+
+	// Refuse new sessions once the monthly transfer budget is used up.
+	if s.refuseOverTransferBudget() {
+		return
+	}
+
+	// Complete the TLS handshake up front so that its failures are reported as such.
+	if !s.handshakeTLS() {
+		return
+	}
+
+	// Read the upgrade request; header size and read timeouts are enforced while parsing.
+	s.account(BufferSize)
+	reader := s.newRequestReader(s.features.Has(FeatureAdmin))
+
+	// Clients may skip the HTTP request and speak SOCKS or SSH right away.
+	switch s.sniff(reader) {
+	case FeatureSOCKS:
+		if !s.refuseInMaintenance(false) && !s.refuseWithoutPoW(FeatureSOCKS) {
+			relayed = s.handleSOCKS(reader)
+		}
+		return
+	case FeatureSSH:
+		if !s.refuseInMaintenance(false) && !s.refuseWithoutPoW(FeatureSSH) {
+			relayed = s.handleDirectSSH(reader)
+		}
+		return
+	}
+
+	req, err := s.readRequest(reader)
+	if err != nil {
+		var ne net.Error
+		switch {
+		case errors.Is(err, ErrHeaderTooLarge):
+			headerReadFailures.Inc("too_large")
+			logsample.Printf(logsample.BadRequest, "[session %s] Header too large, closing connection", s.sessionID)
+			s.respond(http.StatusRequestHeaderFieldsTooLarge)
+		case errors.Is(err, ErrTooManyHeaderLines):
+			headerReadFailures.Inc("too_many_lines")
+			logsample.Printf(logsample.BadRequest, "[session %s] More than %d header lines, closing connection", s.sessionID, MaxHeaderLines)
+			s.respond(http.StatusRequestHeaderFieldsTooLarge)
+		case errors.Is(err, ErrRequestLineTooLong):
+			headerReadFailures.Inc("line_too_long")
+			logsample.Printf(logsample.BadRequest, "[session %s] Request line too long, closing connection", s.sessionID)
+			s.respond(http.StatusRequestURITooLong)
+		case errors.As(err, &ne) && ne.Timeout():
+			headerReadFailures.Inc("timeout")
+			logsample.Printf(logsample.BadRequest, "[session %s] Timed out reading request headers, closing connection", s.sessionID)
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			headerReadFailures.Inc("error")
+			logsample.Printf(logsample.BadRequest, "[session %s] Error reading from client, closing connection: %v", s.sessionID, err)
+		default:
+			headerReadFailures.Inc("malformed")
+			logsample.Printf(logsample.BadRequest, "[session %s] Malformed request: %v", s.sessionID, err)
+			s.respond(http.StatusBadRequest)
 		}
-		// Prevent header overflow attacks.
-		if builder.Len() > BufferSize {
-			log.Printf("[session %s] Header too large, closing connection", s.sessionID)
-			s.client.Write([]byte("HTTP/1.1 431 Request Header Fields Too Large\r\n\r\n"))
+		return
+	}
+
+	log.Printf("[session %s] Request received: %s %s %s", s.sessionID, req.Method, req.RequestURI, req.Proto)
+	if req.Host != "" {
+		log.Printf("[session %s] Host header: %s", s.sessionID, req.Host)
+	}
+	if cfIP := req.Header.Get("CF-Connecting-IP"); cfIP != "" {
+		log.Printf("[session %s] CF-Connecting-IP header: %s", s.sessionID, cfIP)
+	}
+
+	// Serve the web admin dashboard to local clients on listeners that enable it.
+	if s.wantsAdmin(req) {
+		s.serveAdmin(reader.Recorded())
+		return
+	}
+
+	// Refuse new tunnels while the server is in maintenance.
+	if s.refuseInMaintenance(true) {
+		return
+	}
+
+	// Refuse requests for features this listener does not serve.
+	feature := requestFeature(req)
+	if !s.features.Has(feature) {
+		listenerFeatureRejections.Inc(feature)
+		log.Printf("[session %s] Feature %s is disabled on this listener", s.sessionID, feature)
+		s.respond(http.StatusForbidden)
+		return
+	}
+
+	// Refuse requests without the pre-shared tunnel key before any SSH work is done.
+	if ok, reason := checkTunnelKey(req, s.clock.Now()); !ok {
+		tunnelKeyRejections.Inc(reason)
+		logsample.Printf(logsample.TunnelKey, "[session %s] Tunnel key %s", s.sessionID, reason)
+		if HoneypotEnabled {
+			s.tarpit(TriggerTunnelKey, httpTarpitResponse())
 			return
 		}
+		s.respond(http.StatusForbidden)
+		return
+	}
+
+	// Make clients prove work before anything costly while the server is under load.
+	if !s.checkPoW(req) {
+		return
 	}
-	buf := builder.String()
 
-	reqLines := strings.Split(buf, "\r\n")
-	if len(reqLines) > 0 {
-		log.Printf("[session %s] Request received: %s", s.sessionID, reqLines[0])
-		hostHeader := HeaderValue(reqLines[1:], "Host")
-		if hostHeader != "" {
-			log.Printf("[session %s] Host header: %s", s.sessionID, hostHeader)
+	// Check basic-auth credentials on the upgrade request. Raw forwarding, proxying and
+	// speedtests always need them.
+	target := forwardTarget(req)
+	if req.Method == http.MethodConnect {
+		target = req.Host
+	}
+	speedtest := speedtestKind(req)
+	if !s.checkUpgradeAuth(req, target != "" || speedtest != "") {
+		return
+	}
+
+	// Keep any bytes the client sent right after the header block (a payload body or the
+	// start of the SSH stream) so they are relayed instead of dropped.
+	s.preData = reader.Pending()
+
+	// Replace the header deadlines with the idle timeout of the negotiated protocol.
+	switch {
+	case req.Method == http.MethodConnect || target != "" || speedtest != "":
+		s.enterPhase(PhaseRelay)
+	case resumeTarget(req) != "":
+		// The connection becomes a transport of the resumed session, whose relay moves
+		// its deadline.
+		s.client.SetReadDeadline(time.Time{})
+	default:
+		s.enterPhase(PhaseSSHHandshake)
+	}
+
+	// Check the budget again now that the tunnel is about to be set up.
+	if s.shed() {
+		return
+	}
+
+	// Measure the tunnel for a client app.
+	if speedtest != "" {
+		s.serveSpeedtest(req, speedtest)
+		return
+	}
+
+	// Relay a proxied connection to the requested destination.
+	if req.Method == http.MethodConnect {
+		if release, ok := ConnectHandler(s, target); ok {
+			relayed = true
+			s.Relay()
+			release()
 		}
-		cfIP := HeaderValue(reqLines[1:], "CF-Connecting-IP")
-		if cfIP != "" {
-			log.Printf("[session %s] CF-Connecting-IP header: %s", s.sessionID, cfIP)
+		return
+	}
+
+	// Relay raw TCP to the requested destination, without an SSH layer.
+	if target != "" {
+		if release, ok := ForwardHandler(s, req, target); ok {
+			relayed = true
+			s.Relay()
+			release()
 		}
+		return
 	}
 
-	// Remove read deadline for rest of session.
-	s.client.SetReadDeadline(time.Time{})
+	// Hand the connection over to the session the client reconnects to.
+	if token := resumeTarget(req); token != "" {
+		relayed = s.handleResume(req, token, s.preData)
+		return
+	}
 
 	// Handle WebSocket upgrade and tunnel setup using the new handler.
-	if WebSocketHandler(s, reqLines[1:]) {
+	if WebSocketHandler(s, req) {
+		relayed = true
 		s.Relay()
 	}
 }
 
+// HandleStream manages the lifecycle of a connection that carries the SSH stream
+// directly, without an HTTP upgrade request, such as a DNS transport session.
+func (s *Session) HandleStream() {
+	defer ssh.RecoverPanic("session", s.sessionID, s.Close)
+
+	relayed := false
+	defer func() {
+		if !relayed {
+			s.Close()
+		}
+		s.releaseMemory()
+	}()
+
+	if s.banned() || s.refuseInMaintenance(false) || s.shed() || s.refuseOverTransferBudget() {
+		return
+	}
+	if err := s.startSSH(); err != nil {
+		log.Printf("[session %s] Error initializing SSH config: %v", s.sessionID, err)
+		return
+	}
+	relayed = true
+	s.Relay()
+}
+
 // Relay copies data bidirectionally between client and target connections.
 func (s *Session) Relay() {
 	defer func() {
 		s.Close()          // Clean up both connections
 		s.server.Remove(s) // Remove from active map
-		log.Printf("[session %s] Connection closed.", s.sessionID)
+		in, out := s.Transferred()
+		log.Printf("[session %s] Connection closed after relaying %s in, %s out.", s.sessionID,
+			accounting.FormatBytes(in), accounting.FormatBytes(out))
+		s.authMutex.Lock()
+		started := s.authenticatedAt
+		s.authMutex.Unlock()
+		if !started.IsZero() {
+			s.publishEvent(EventSessionClosed, Event{BytesIn: in, BytesOut: out, Duration: s.clock.Now().Sub(started)})
+		}
 	}()
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
+	s.touch()
+	s.account(2 * BufferPoolSize)
+
+	// Bytes that arrived together with the upgrade request go first.
+	src := io.Reader(s.client)
+	if len(s.preData) > 0 {
+		log.Printf("[session %s] Forwarding %d bytes received with the upgrade request", s.sessionID, len(s.preData))
+		src = io.MultiReader(bytes.NewReader(s.preData), s.client)
+	}
+
 	// Copy client → target
+	var bytesIn, bytesOut int64
 	go func() {
 		defer wg.Done()
-		_, err := CopyWithBuffer(s.target, s.client)
-		if err != nil && !isIgnorableError(err) {
-			log.Printf("[session %s] Error copying client to target: %v", s.sessionID, err)
+		defer ssh.RecoverPanic("relay", s.sessionID, s.Close)
+		var err error
+		bytesIn, err = s.relayer.Copy(s.server.ctx, ClientToTarget, s.target, &activityReader{r: src, s: s},
+			countBytes(&s.bytesIn, relayedBytesIn))
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			phase := s.deadlines.current()
+			idleTimeouts.Inc(phase.String())
+			log.Printf("[session %s] Closing session idle for %s (%s)", s.sessionID, phase.IdleTimeout(), phase)
+		} else if err != nil && !isIgnorableError(err) {
+			logsample.Printf(logsample.CopyError, "[session %s] Error copying client to target: %v", s.sessionID, err)
 		}
 		// Important: Closing target to unblock other io.Copy
 		s.target.Close()
@@ -330,42 +858,96 @@ func (s *Session) Relay() {
 	// Copy target → client
 	go func() {
 		defer wg.Done()
-		_, err := CopyWithBuffer(s.client, s.target)
+		defer ssh.RecoverPanic("relay", s.sessionID, s.Close)
+		var err error
+		bytesOut, err = s.relayer.Copy(s.server.ctx, TargetToClient, s.client, &activityReader{r: s.target, s: s},
+			countBytes(&s.bytesOut, relayedBytesOut))
 		if err != nil && !isIgnorableError(err) {
-			log.Printf("[session %s] Error copying target to client: %v", s.sessionID, err)
+			logsample.Printf(logsample.CopyError, "[session %s] Error copying target to client: %v", s.sessionID, err)
+		}
+		// Clients that failed SSH authentication are held in the tarpit if enabled.
+		if s.authFailed.Load() {
+			s.tarpit(TriggerSSHAuth, randomByte)
 		}
 		// Important: Closing client to unblock other io.Copy
 		s.client.Close()
 	}()
 
 	wg.Wait()
+	s.recordUsage(bytesIn, bytesOut)
 }
 
-// Utility functions
-// HeaderValue extracts the value of a specific HTTP header from header lines.
-func HeaderValue(headers []string, headerName string) string {
-	headerNameLower := strings.ToLower(headerName)
-	for _, line := range headers {
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
-			continue
-		}
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		if strings.ToLower(strings.TrimSpace(parts[0])) == headerNameLower {
-			return strings.TrimSpace(parts[1])
-		}
+// recordUsage appends the session's usage to the server's accounting store. Sessions
+// that never authenticated are not recorded.
+func (s *Session) recordUsage(bytesIn, bytesOut int64) {
+	s.authMutex.Lock()
+	username, start := s.username, s.authenticatedAt
+	s.authMutex.Unlock()
+	if username == "" || s.server.usage == nil {
+		return
+	}
+	rec := accounting.Record{
+		SessionID: s.sessionID,
+		Username:  username,
+		Client:    s.client.RemoteAddr().String(),
+		Start:     start,
+		End:       s.clock.Now(),
+		BytesIn:   bytesIn,
+		BytesOut:  bytesOut,
+	}
+	if err := s.server.usage.Append(rec); err != nil {
+		log.Printf("[session %s] Failed to record usage: %v", s.sessionID, err)
+	}
+}
+
+// touch records that the session relayed data now, which also moves its idle deadline.
+func (s *Session) touch() {
+	now := s.clock.Now()
+	s.lastActivity.Store(now.UnixNano())
+	s.deadlines.activity(s.client, now)
+}
+
+// Transferred returns the bytes the session relayed from and to its client so far. The
+// relay reports them at least every relay.ReportInterval while data flows.
+func (s *Session) Transferred() (bytesIn, bytesOut int64) {
+	return s.bytesIn.Load(), s.bytesOut.Load()
+}
+
+// LastActivity returns the time the session last relayed data.
+func (s *Session) LastActivity() time.Time {
+	return time.Unix(0, s.lastActivity.Load())
+}
+
+// countBytes returns the relay.Reporter adding the bytes relayed in one direction to the
+// session's count and the server-wide total for that direction.
+func countBytes(count *atomic.Int64, total *metrics.Counter) relay.Reporter {
+	return func(n int64) {
+		count.Add(n)
+		total.Add(n)
+	}
+}
+
+// activityReader wraps a relay source and records session activity on every read.
+type activityReader struct {
+	r io.Reader
+	s *Session
+}
+
+// Read reads from the underlying reader and updates the session's last activity time.
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.s.touch()
 	}
-	return ""
+	return n, err
 }
 
+// Utility functions
 // isIgnorableError returns true if the error is EOF or a known benign network error.
 //
 // Used internally to suppress logging for expected connection closure errors.
 func isIgnorableError(err error) bool {
-	if err == io.EOF {
+	if err == io.EOF || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, context.Canceled) {
 		return true
 	}
 	if err == nil {
@@ -377,8 +959,8 @@ func isIgnorableError(err error) bool {
 
 // WebSocket handling
 // WebSocketHandler upgrades a session to WebSocket and establishes an SSH tunnel.
-func WebSocketHandler(s *Session, reqLines []string) bool {
-	upgradeHeader := HeaderValue(reqLines, "Upgrade")
+func WebSocketHandler(s *Session, req *http.Request) bool {
+	upgradeHeader := req.Header.Get("Upgrade")
 
 	if upgradeHeader == "" {
 		log.Printf("[session %s] No Upgrade header found. Closing connection.", s.sessionID)
@@ -387,24 +969,93 @@ func WebSocketHandler(s *Session, reqLines []string) bool {
 	}
 
 	log.Printf("[session %s] WebSocket upgrade: using in-process SSH server.", s.sessionID)
-	proxyEnd, sshEnd := net.Pipe()
+	if err := s.startSSH(); err != nil {
+		log.Printf("[session %s] Error initializing SSH config: %v", s.sessionID, err)
+		s.respond(http.StatusBadGateway)
+		return false
+	}
+	response := upgradeResponse(req)
+	var rc *resumableConn
+	if wantsResume(req) {
+		var err error
+		if rc, err = s.server.newResumableConn(s.sessionID, s.client, s.preData); err != nil {
+			log.Printf("[session %s] Failed to make the session resumable: %v", s.sessionID, err)
+		} else {
+			response = withHeader(response, ResumeTokenHeader, rc.token)
+		}
+	}
+	if _, err := s.client.Write([]byte(response)); err != nil {
+		log.Printf("[session %s] Failed to write WebSocket upgrade response: %v", s.sessionID, err)
+		if rc != nil {
+			rc.Close()
+		}
+		s.Close()
+		return false
+	}
+	if rc != nil {
+		s.client, s.preData = rc, nil
+		log.Printf("[session %s] Session is resumable for %s after its transport drops.", s.sessionID, ResumeGrace)
+	}
+	log.Printf("[session %s] Tunnel established.", s.sessionID)
+	return true
+}
+
+// startSSH connects the session's target to a new in-process SSH server.
+func (s *Session) startSSH() error {
+	s.account(SessionOverhead)
 	if s.sshConfig == nil {
 		var err error
 		s.sshConfig, err = ssh.NewConfig()
 		if err != nil {
-			log.Printf("[session %s] Error initializing SSH config: %v", s.sessionID, err)
-			return false
+			return err
+		}
+	}
+	proxyEnd, sshEnd := net.Pipe()
+	handler := ssh.NewConnHandler(s.sshConfig)
+	handler.Dialer, handler.Clock = s.dialer, s.clock
+	handler.HandshakeFailed = func(err error) {
+		// The probe's login is expected to fail and is not held in the tarpit.
+		if ssh.IsAuthError(err) && !s.probe {
+			s.authFailed.Store(true)
+			s.publishEvent(EventAuthFailed, Event{Error: err.Error()})
 		}
 	}
-	go ssh.HandleSSHConnection(sshEnd, s.sshConfig, func() {
+	handler.ChannelOpened = func(target string) {
+		s.publishEvent(EventChannelOpened, Event{Target: target})
+	}
+	handler.Diagnostics = s.diagnostics
+	addr := ssh.SessionAddr{ID: s.sessionID, Client: s.client.RemoteAddr(), ClientCert: s.clientCert(), Probe: s.probe}
+	if cfg, ok := s.server.listenerConfig(s.listener); ok {
+		addr.NoBanner = cfg.NoBanner
+	}
+	if addr.ClientCert != nil {
+		log.Printf("[session %s] TLS client certificate: %s", s.sessionID, addr.ClientCert.Subject)
+	}
+	go handler.Serve(ssh.NewSessionConn(sshEnd, addr), func(user, clientVersion string) {
+		s.authMutex.Lock()
+		s.username, s.authenticatedAt, s.clientVersion = user, s.clock.Now(), clientVersion
+		s.authMutex.Unlock()
+		log.Printf("[session %s] SSH client version: %s", s.sessionID, clientVersion)
+		s.deadlines.advance(s.client, s.clock.Now(), PhaseSSHHandshake, PhaseSSH)
 		s.server.Add(s)
+		s.publishEvent(EventSessionStarted, Event{User: user})
 	})
 	s.target = proxyEnd
-	if _, err := s.client.Write([]byte(WebSocketUpgradeResponse)); err != nil {
-		log.Printf("[session %s] Failed to write WebSocket upgrade response: %v", s.sessionID, err)
-		s.Close()
-		return false
+	return nil
+}
+
+// diagnostics reports the session's traffic and the server-wide limits it is subject to
+// for diagnostics channels.
+func (s *Session) diagnostics() ssh.TransportDiagnostics {
+	d := ssh.TransportDiagnostics{
+		BytesIn:       s.bytesIn.Load(),
+		BytesOut:      s.bytesOut.Load(),
+		EgressLimit:   egressBucket.Rate(),
+		IngressLimit:  ingressBucket.Rate(),
+		BudgetReached: budgetReached.Load(),
 	}
-	log.Printf("[session %s] Tunnel established.", s.sessionID)
-	return true
+	if MonthlyBudget > 0 {
+		d.MonthlyRemaining = max(MonthlyBudget-monthTransfer.Load(), 0)
+	}
+	return d
 }
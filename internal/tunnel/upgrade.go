@@ -0,0 +1,180 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sandbox"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sockopt"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// ListenFDsEnv names the listeners a process inherits from its predecessor during an
+// upgrade, as a comma-separated list matching file descriptors 3, 4, ...
+const ListenFDsEnv = "SSH_IFY_LISTEN_FDS"
+
+// DrainTimeout bounds how long a process keeps serving its sessions after handing its
+// listeners to an upgraded binary. It is read from SSH_IFY_DRAIN_TIMEOUT.
+var DrainTimeout = config.EnvDuration("SSH_IFY_DRAIN_TIMEOUT", time.Hour)
+
+// inherited holds the listener files passed in by a predecessor, by listener name.
+// Each is taken by the first listen call for its name.
+var inherited = inheritListeners()
+
+// inheritListeners collects the listener files named in ListenFDsEnv and clears the
+// variable so it is not passed on to unrelated child processes.
+func inheritListeners() map[string]*os.File {
+	names := os.Getenv(ListenFDsEnv)
+	if names == "" {
+		return nil
+	}
+	os.Unsetenv(ListenFDsEnv)
+	files := make(map[string]*os.File)
+	for i, name := range strings.Split(names, ",") {
+		files[name] = os.NewFile(uintptr(3+i), name)
+	}
+	return files
+}
+
+// listen returns a TCP listener for the named listener on addr, reusing the socket
+// inherited from a predecessor if there is one. The listener is registered so that it
+// can be handed over again on the next upgrade.
+func (s *Server) listen(name, addr string) (*net.TCPListener, error) {
+	return s.listenWith(name, addr, sockopt.Options{})
+}
+
+// listenWith is like listen, but applies opts to a newly bound socket. An inherited
+// socket keeps the options it was bound with.
+func (s *Server) listenWith(name, addr string, opts sockopt.Options) (*net.TCPListener, error) {
+	var ln net.Listener
+	var err error
+	if file, ok := inherited[name]; ok {
+		delete(inherited, name)
+		ln, err = net.FileListener(file)
+		file.Close()
+		if err == nil {
+			log.Printf("%s listener inherited from previous process", name)
+		}
+	} else {
+		lc := net.ListenConfig{Control: opts.Control()}
+		ln, err = lc.Listen(context.Background(), "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tcpLn, ok := ln.(*net.TCPListener)
+	if !ok {
+		ln.Close()
+		return nil, fmt.Errorf("%s listener is not a TCP listener", name)
+	}
+	s.sockets.Store(name, tcpLn)
+	ssh.AddServerAddr(tcpLn.Addr())
+	return tcpLn, nil
+}
+
+// serveMetrics serves the metrics endpoint on addr, which must be a control address,
+// until the server stops listening.
+func (s *Server) serveMetrics(addr string) {
+	ln, err := s.listenControl("metrics", addr)
+	if err != nil {
+		log.Printf("Metrics server disabled: %v", err)
+		return
+	}
+	go func() {
+		<-s.listenCtx.Done()
+		ln.Close()
+	}()
+	mux := http.NewServeMux()
+	handleControlEndpoints(mux)
+	log.Printf("Metrics server listening on %s", ln.Addr())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(ln); err != nil && s.listenCtx.Err() == nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
+
+// Upgrade starts the current executable again with the same arguments, handing it every
+// listening socket, and stops accepting connections in this process. Existing sessions
+// keep running; see drain.
+func (s *Server) Upgrade() error {
+	if sandbox.Applied() {
+		return fmt.Errorf("the sandbox does not allow starting another executable, restart instead")
+	}
+	if workerListener != "" {
+		return fmt.Errorf("workers cannot be upgraded under privilege separation, restart instead")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating executable: %v", err)
+	}
+
+	var names []string
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	s.sockets.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	slices.Sort(names)
+	for _, name := range names {
+		ln, _ := s.sockets.Load(name)
+		f, err := ln.(*net.TCPListener).File()
+		if err != nil {
+			return fmt.Errorf("duplicating %s listener: %v", name, err)
+		}
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), ListenFDsEnv+"="+strings.Join(names, ","))
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting %s: %v", exe, err)
+	}
+	// The successor runs on its own; reap it in the background should it exit first.
+	go cmd.Wait()
+
+	log.Printf("Upgrade: started %s (pid %d) with listeners %s", exe, cmd.Process.Pid, strings.Join(names, ", "))
+	s.upgraded.Store(true)
+	s.stopListening()
+	return nil
+}
+
+// drain waits until every session has ended, DrainTimeout has passed or another signal
+// arrives on c, whichever comes first.
+func (s *Server) drain(c <-chan os.Signal) {
+	log.Printf("Draining %d sessions (timeout %s)", atomic.LoadInt32(&s.activeCount), DrainTimeout)
+	timeout := time.NewTimer(DrainTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&s.activeCount) > 0 {
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			log.Printf("Drain timeout reached with %d sessions left", atomic.LoadInt32(&s.activeCount))
+			return
+		case sig := <-c:
+			log.Printf("Received %s while draining", sig)
+			return
+		}
+	}
+	log.Println("All sessions drained.")
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package tunnel
+
+import "os"
+
+// upgradeSignals is empty where listener handoff is not supported.
+var upgradeSignals []os.Signal
+
+// isUpgradeSignal reports whether sig requests an upgrade, which it never does here.
+func isUpgradeSignal(sig os.Signal) bool {
+	return false
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package tunnel
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals trigger a binary upgrade with listener handoff.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+// isUpgradeSignal reports whether sig requests an upgrade.
+func isUpgradeSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR2
+}
@@ -0,0 +1,87 @@
+package tunnel
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// UpgradeAuth requires upgrade requests to carry the credentials of an enabled user in a
+// Proxy-Authorization or Authorization basic-auth header, checked before the SSH layer
+// starts. It is read from SSH_IFY_UPGRADE_AUTH.
+var UpgradeAuth = config.EnvBool("SSH_IFY_UPGRADE_AUTH", false)
+
+// UnauthorizedResponse asks the client for basic-auth credentials.
+const UnauthorizedResponse = "HTTP/1.1 401 Unauthorized\r\n" +
+	"WWW-Authenticate: Basic realm=\"ssh-ify\"\r\n" +
+	"Content-Length: 0\r\n" +
+	"Connection: close\r\n\r\n"
+
+// upgradeAuthRejections counts upgrade requests refused for missing or wrong credentials, by reason.
+var upgradeAuthRejections = metrics.NewCounterVec("ssh_ify_upgrade_auth_rejections_total",
+	"Number of upgrade requests refused for missing or wrong basic-auth credentials.", "reason")
+
+// basicCredentials returns the basic-auth credentials of req, preferring
+// Proxy-Authorization over Authorization.
+func basicCredentials(req *http.Request) (user, password string, ok bool) {
+	for _, header := range []string{"Proxy-Authorization", "Authorization"} {
+		value := req.Header.Get(header)
+		scheme, encoded, found := strings.Cut(value, " ")
+		if !found || !strings.EqualFold(scheme, "Basic") {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			continue
+		}
+		if user, password, ok = strings.Cut(string(decoded), ":"); ok {
+			return user, password, true
+		}
+	}
+	return "", "", false
+}
+
+// checkUpgradeAuth authenticates the upgrade request when UpgradeAuth is enabled or the
+// request requires it, and records the user on success. Rejected clients are answered
+// with 401 or 403, or held in the tarpit.
+func (s *Session) checkUpgradeAuth(req *http.Request, required bool) bool {
+	if !UpgradeAuth && !required {
+		return true
+	}
+	user, password, ok := basicCredentials(req)
+	if !ok {
+		upgradeAuthRejections.Inc("missing")
+		log.Printf("[session %s] Upgrade request without credentials", s.sessionID)
+		s.respond(http.StatusUnauthorized)
+		return false
+	}
+	// Credentials that are not followed by an SSH login must pass its challenges too.
+	authenticate := ssh.AuthenticateUpgrade
+	if required {
+		authenticate = ssh.AuthenticateProxy
+	}
+	addr := ssh.SessionAddr{ID: s.sessionID, Client: s.client.RemoteAddr(), ClientCert: s.clientCert()}
+	if err := authenticate(addr, user, password); err != nil {
+		s.publishEvent(EventAuthFailed, Event{User: user, Error: err.Error()})
+		if errors.Is(err, ssh.ErrPolicyDenied) {
+			upgradeAuthRejections.Inc("denied")
+			s.respond(http.StatusForbidden)
+			return false
+		}
+		upgradeAuthRejections.Inc("invalid")
+		if HoneypotEnabled {
+			s.tarpit(TriggerUpgradeAuth, httpTarpitResponse())
+			return false
+		}
+		s.respond(http.StatusUnauthorized)
+		return false
+	}
+	s.upgradeUser = user
+	return true
+}
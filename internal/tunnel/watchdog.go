@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"log"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+)
+
+// ListenerRestartDelay is the pause before a stopped listener is bound again.
+const ListenerRestartDelay = time.Second
+
+// Watchdog configuration, read from the environment at startup.
+var (
+	// WatchdogInterval is how often the watchdog inspects the server.
+	WatchdogInterval = config.EnvDuration("SSH_IFY_WATCHDOG_INTERVAL", 15*time.Second)
+
+	// StuckListenerThreshold is how long an accept loop may go without a heartbeat
+	// before it is reported as stuck.
+	StuckListenerThreshold = config.EnvDuration("SSH_IFY_WATCHDOG_STUCK_LISTENER", 30*time.Second)
+
+	// IdleSessionThreshold is how long an active session may relay no data before it
+	// is reported as idle.
+	IdleSessionThreshold = config.EnvDuration("SSH_IFY_WATCHDOG_IDLE_SESSION", 10*time.Minute)
+
+	// MaxBuffersInUse is the number of checked-out relay buffers (tunnel and SSH pools
+	// combined) above which the buffer pools are reported as exhausted.
+	MaxBuffersInUse = int64(config.EnvInt("SSH_IFY_WATCHDOG_MAX_BUFFERS", 4096))
+
+	// WatchdogSelfHeal makes the watchdog restart stuck listeners and close idle sessions
+	// instead of only reporting them.
+	WatchdogSelfHeal = config.EnvBool("SSH_IFY_WATCHDOG_SELF_HEAL", false)
+)
+
+// Watchdog metrics
+var (
+	activeSessionsGauge = metrics.NewGauge("ssh_ify_active_sessions",
+		"Number of authenticated sessions currently relaying.")
+	stuckListenersGauge = metrics.NewGauge("ssh_ify_watchdog_stuck_listeners",
+		"Number of accept loops without a recent heartbeat.")
+	idleSessionsGauge = metrics.NewGauge("ssh_ify_watchdog_idle_sessions",
+		"Number of active sessions that relayed no data within the idle threshold.")
+	buffersInUseGauge = metrics.NewGaugeFunc("ssh_ify_buffers_in_use",
+		"Number of relay buffers currently checked out of the tunnel and SSH pools.",
+		func() float64 { return float64(BuffersInUse() + ssh.BuffersInUse()) })
+	gcCycles = metrics.NewCounterFunc("ssh_ify_gc_cycles_total",
+		"Number of completed garbage collection cycles.",
+		func() float64 { return float64(readGCStats().Cycles) })
+	gcPauseSeconds = metrics.NewCounterFunc("ssh_ify_gc_pause_seconds_total",
+		"Total time the garbage collector paused the program.",
+		func() float64 { return readGCStats().PauseTotal.Seconds() })
+	heapAllocGauge = metrics.NewGaugeFunc("ssh_ify_heap_alloc_bytes",
+		"Bytes of allocated heap objects.",
+		func() float64 { return float64(readGCStats().HeapAlloc) })
+	watchdogWarnings = metrics.NewCounterVec("ssh_ify_watchdog_warnings_total",
+		"Number of problems detected by the watchdog.", "kind")
+	listenerRestarts = metrics.NewCounter("ssh_ify_watchdog_listener_restarts_total",
+		"Number of listeners restarted by the watchdog.")
+	idleSessionsClosed = metrics.NewCounter("ssh_ify_watchdog_idle_sessions_closed_total",
+		"Number of idle sessions closed by the watchdog.")
+)
+
+// runWatchdog periodically inspects the server until it shuts down.
+func (s *Server) runWatchdog() {
+	ticker := time.NewTicker(WatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkListeners()
+			s.checkSessions()
+			s.checkBuffers()
+		}
+	}
+}
+
+// checkListeners reports accept loops whose heartbeat is older than StuckListenerThreshold
+// and, with self-healing enabled, closes them so runListener binds them again.
+func (s *Server) checkListeners() {
+	now := s.clock.Now()
+	stuck := int64(0)
+	s.listeners.Range(func(key, value any) bool {
+		l := value.(*listener)
+		silent := now.Sub(time.Unix(0, l.heartbeat.Load()))
+		if silent < StuckListenerThreshold {
+			return true
+		}
+		stuck++
+		watchdogWarnings.Inc("stuck_listener")
+		log.Printf("Watchdog: %s accept loop has not run for %s", l.name, silent.Round(time.Second))
+		if WatchdogSelfHeal {
+			log.Printf("Watchdog: restarting %s listener", l.name)
+			listenerRestarts.Inc()
+			l.ln.Close()
+		}
+		return true
+	})
+	stuckListenersGauge.Set(stuck)
+}
+
+// checkSessions reports active sessions that relayed no data within IdleSessionThreshold
+// and, with self-healing enabled, closes them.
+func (s *Server) checkSessions() {
+	now := s.clock.Now()
+	idle := int64(0)
+	s.conns.Range(func(key, value any) bool {
+		sess := key.(*Session)
+		silent := now.Sub(sess.LastActivity())
+		if silent < IdleSessionThreshold {
+			return true
+		}
+		idle++
+		if WatchdogSelfHeal {
+			log.Printf("[session %s] Watchdog: closing session idle for %s", sess.sessionID, silent.Round(time.Second))
+			idleSessionsClosed.Inc()
+			sess.Close()
+		}
+		return true
+	})
+	idleSessionsGauge.Set(idle)
+	if idle > 0 {
+		watchdogWarnings.Inc("idle_sessions")
+		log.Printf("Watchdog: %d active sessions relayed no data for at least %s", idle, IdleSessionThreshold)
+	}
+}
+
+// checkBuffers reports when more relay buffers are checked out than MaxBuffersInUse.
+func (s *Server) checkBuffers() {
+	inUse := BuffersInUse() + ssh.BuffersInUse()
+	if inUse > MaxBuffersInUse {
+		watchdogWarnings.Inc("buffer_exhaustion")
+		log.Printf("Watchdog: %d relay buffers in use exceeds limit of %d", inUse, MaxBuffersInUse)
+	}
+}
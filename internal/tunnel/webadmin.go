@@ -0,0 +1,539 @@
+package tunnel
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/keepalive"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+	"github.com/ayanrajpoot10/ssh-ify/internal/logsample"
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+	"github.com/ayanrajpoot10/ssh-ify/internal/sandbox"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+)
+
+// AdminAddr is the address the web admin dashboard listens on, e.g. "127.0.0.1:8081".
+// It is read from SSH_IFY_ADMIN_ADDR; when empty, the dashboard is disabled.
+var AdminAddr = config.Env("SSH_IFY_ADMIN_ADDR", "")
+
+// webUI holds the single-page dashboard served at "/".
+//
+//go:embed webui
+var webUI embed.FS
+
+// Setting is one effective configuration value shown on the dashboard.
+type Setting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Settings returns the effective server configuration. Secrets are reported only as
+// set or unset.
+func (s *Server) Settings() []Setting {
+	secret := func(v string) string {
+		if v == "" {
+			return "unset"
+		}
+		return "set"
+	}
+	settings := []Setting{
+		{"TLS certificate", s.tlsCertFile},
+		{"TLS key", s.tlsKeyFile},
+		{"Client CA", ClientCAFile},
+		{"Client certificate auth", ssh.ClientCertAuth},
+		{"User CA", ssh.UserCAFile},
+		{"Keyboard-interactive challenges", ssh.KeyboardInteractiveChallenges},
+		{"Keyboard-interactive mode", ssh.KeyboardInteractiveMode},
+		{"Hardened mode", fmt.Sprint(config.Hardened)},
+		{"Sandbox", sandbox.Mode},
+		{"Sandbox paths", sandbox.ExtraPaths},
+		{"Privilege separation user", PrivsepUser},
+		{"Crypto profile", ssh.CryptoProfile},
+		{"Key exchanges", ssh.KeyExchangeList},
+		{"Ciphers", ssh.CipherList},
+		{"MACs", ssh.MACList},
+		{"Max auth tries", fmt.Sprint(ssh.MaxAuthTries)},
+		{"Login without credentials", fmt.Sprint(ssh.NoClientAuth)},
+		{"SSH auth timeout", ssh.AuthTimeout.String()},
+		{"Banner policy", ssh.BannerPolicy},
+		{"Banner skipped for clients", ssh.BannerSkipClients},
+		{"Client versions allowed", ssh.ClientVersionAllow},
+		{"Client versions denied", ssh.ClientVersionDeny},
+		{"Private forwarding targets", fmt.Sprint(ssh.AllowPrivateTargets)},
+		{"Policy audit log", fmt.Sprint(policy.AuditEnabled)},
+		{"Forwarding resolver", ssh.ForwardResolver},
+		{"Forwarding IP preference", ssh.ForwardIPPreference},
+		{"Happy Eyeballs delay", ssh.HappyEyeballsDelay.String()},
+		{"Forward pool size", fmt.Sprint(ssh.ForwardPoolSize)},
+		{"Forward pool idle timeout", ssh.ForwardPoolIdleTimeout.String()},
+		{"Forward socket options", ssh.ForwardSocketOptions.String()},
+		{"Tunnel key", secret(TunnelKey)},
+		{"Tunnel key mode", TunnelKeyMode},
+		{"Tunnel key skew", TunnelKeySkew.String()},
+		{"Proof of work", PoWMode},
+		{"Proof-of-work difficulty", fmt.Sprint(PoWDifficulty)},
+		{"Proof-of-work pre-auth threshold", fmt.Sprint(PoWPreAuthThreshold)},
+		{"Upgrade basic auth", fmt.Sprint(UpgradeAuth)},
+		{"WebSocket forwarding", fmt.Sprint(WebSocketForward)},
+		{"Speedtest", fmt.Sprint(Speedtest)},
+		{"Speedtest max size", fmt.Sprint(SpeedtestMaxSize)},
+		{"Diagnostics channel", fmt.Sprint(ssh.DiagChannel)},
+		{"DNS transport domain", DNSDomain},
+		{"ICMP transport", fmt.Sprint(ICMPEnabled)},
+		{"Legacy WebSocket accept", fmt.Sprint(LegacyWebSocketAccept)},
+		{"Max header size", fmt.Sprint(MaxHeaderSize)},
+		{"Max request line", fmt.Sprint(MaxRequestLineSize)},
+		{"Max header lines", fmt.Sprint(MaxHeaderLines)},
+		{"Header line timeout", HeaderLineTimeout.String()},
+		{"TLS handshake timeout", TLSHandshakeTimeout.String()},
+		{"Request header timeout", RequestHeaderTimeout.String()},
+		{"Plain HTTP on TLS port", PlainHTTPOnTLS},
+		{"SSH handshake idle timeout", SSHHandshakeIdleTimeout.String()},
+		{"SSH idle timeout", SSHIdleTimeout.String()},
+		{"Relay idle timeout", RelayIdleTimeout.String()},
+		{"Keepalive preset", keepalive.Preset},
+		{"WebSocket ping interval", keepalive.WebSocketPing.String()},
+		{"SSH keepalive interval", keepalive.SSH.String()},
+		{"SSH keepalive count", fmt.Sprint(keepalive.SSHCountMax)},
+		{"TCP keepalive interval", keepalive.TCP.String()},
+		{"Memory budget", fmt.Sprint(MemoryBudget)},
+		{"Egress limit (bytes/s)", fmt.Sprint(egressBucket.Rate())},
+		{"Ingress limit (bytes/s)", fmt.Sprint(ingressBucket.Rate())},
+		{"Monthly transfer budget", fmt.Sprint(MonthlyBudget)},
+		{"Budget threshold (%)", fmt.Sprint(BudgetThreshold)},
+		{"Budget action", BudgetAction},
+		{"Watchdog interval", WatchdogInterval.String()},
+		{"Watchdog self-heal", fmt.Sprint(WatchdogSelfHeal)},
+		{"Idle session threshold", IdleSessionThreshold.String()},
+		{"Honeypot", fmt.Sprint(HoneypotEnabled)},
+		{"Language", i18n.Lang()},
+		{"Log sample burst", fmt.Sprint(logsample.Burst)},
+		{"Log sample interval", logsample.Interval.String()},
+		{"Maintenance message", MaintenanceMessage},
+		{"Session resumption", fmt.Sprint(ResumeEnabled)},
+		{"Resumption grace", ResumeGrace.String()},
+		{"Resumption buffer", fmt.Sprint(ResumeBuffer)},
+		{"Metrics address", config.Env("SSH_IFY_METRICS_ADDR", "")},
+		{"Admin address", AdminAddr},
+		{"Password reset address", ResetAddr},
+		{"Reset token lifetime", usermgmt.ResetTokenTTL.String()},
+		{"Portal address", PortalAddr},
+		{"Portal sign-in lifetime", usermgmt.UserTokenTTL.String()},
+		{"Signup address", SignupAddr},
+		{"Invite lifetime", usermgmt.InviteTTL.String()},
+		{"Profiling", fmt.Sprint(PprofEnabled)},
+		{"Ban threshold", fmt.Sprint(limits.BanThreshold)},
+		{"Ban window", limits.BanWindow.String()},
+		{"Ban duration", limits.BanDuration.String()},
+		{"Max sessions per user", fmt.Sprint(limits.MaxSessionsPerUser)},
+		{"Max pre-auth connections", fmt.Sprint(MaxPreAuthSessions)},
+		{"Pre-auth timeout", PreAuthTimeout.String()},
+		{"Max forwards per connection", fmt.Sprint(limits.MaxForwardsPerConnection)},
+		{"Max session duration", limits.MaxSessionDuration.String()},
+		{"Session duration warning", limits.SessionDurationWarning.String()},
+		{"Account throttle delay", limits.AccountThrottleDelay.String()},
+		{"Account throttle max", limits.AccountThrottleMax.String()},
+		{"Account throttle window", limits.AccountThrottleWindow.String()},
+		{"Account lock threshold", fmt.Sprint(limits.AccountLockThreshold)},
+		{"Account lock duration", limits.AccountLockDuration.String()},
+		{"Redis backend", secret(cluster.RedisURL)},
+		{"Cluster node", cluster.NodeName},
+	}
+	return append(s.listenerSettings(), settings...)
+}
+
+// listenerSettings describes the running tunnel listeners, sorted by name.
+func (s *Server) listenerSettings() []Setting {
+	var settings []Setting
+	s.listeners.Range(func(key, value any) bool {
+		l := value.(*listener)
+		settings = append(settings, Setting{"Listener " + l.name, fmt.Sprintf("%s (%s)", l.raw.Addr(), l.features)})
+		return true
+	})
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+// FindSession returns the active session with the given ID, or nil.
+func (s *Server) FindSession(id string) *Session {
+	var found *Session
+	s.conns.Range(func(key, value any) bool {
+		if sess := key.(*Session); sess.sessionID == id {
+			found = sess
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// Username returns the SSH user the session authenticated as, or "" before authentication.
+func (s *Session) Username() string {
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	return s.username
+}
+
+// webAdmin serves the dashboard and its JSON API.
+type webAdmin struct {
+	server  *Server
+	manager *usermgmt.Manager // Unscoped manager; requests act through manager.As
+}
+
+// webAdminHandler returns the handler serving the dashboard and its API, creating it on
+// first use. It is shared by the web admin listener and tunnel listeners with FeatureAdmin.
+func (s *Server) webAdminHandler() http.Handler {
+	s.adminOnce.Do(func() {
+		// Share the user database the SSH server authenticates against so edits apply at once.
+		if ssh.GetUserDB() == nil {
+			ssh.InitializeAuth("")
+		}
+		wa := &webAdmin{
+			server:  s,
+			manager: usermgmt.NewManagerWithDB(ssh.GetUserDB(), usermgmt.NewAdminDB("")),
+		}
+
+		ui, _ := fs.Sub(webUI, "webui")
+		mux := http.NewServeMux()
+		mux.Handle("GET /", http.FileServer(http.FS(ui)))
+		mux.HandleFunc("GET /api/me", wa.auth(wa.handleMe))
+		mux.HandleFunc("GET /api/stats", wa.auth(wa.handleStats))
+		mux.HandleFunc("GET /api/config", wa.auth(wa.handleConfig))
+		mux.HandleFunc("GET /api/users", wa.auth(wa.handleListUsers))
+		mux.HandleFunc("GET /api/users/{name}", wa.auth(wa.handleGetUser))
+		mux.HandleFunc("POST /api/users", wa.auth(wa.handleAddUser))
+		mux.HandleFunc("DELETE /api/users/{name}", wa.auth(wa.handleRemoveUser))
+		mux.HandleFunc("POST /api/users/{name}/{action}", wa.auth(wa.handleUserAction))
+		mux.HandleFunc("DELETE /api/sessions/{id}", wa.auth(wa.handleKillSession))
+		s.adminHandler = mux
+	})
+	return s.adminHandler
+}
+
+// serveWebAdmin serves the web admin dashboard on AdminAddr, which must be a control
+// address, until the server shuts down.
+func (s *Server) serveWebAdmin() {
+	if AdminAddr == "" {
+		return
+	}
+	handler := s.webAdminHandler()
+
+	ln, err := s.listenControl("web admin", AdminAddr)
+	if err != nil {
+		log.Printf("Web admin dashboard disabled: %v", err)
+		return
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-s.listenCtx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Web admin dashboard listening on %s", AdminAddr)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Web admin dashboard stopped: %v", err)
+	}
+}
+
+// wantsAdmin reports whether req is a dashboard request from a loopback client on a
+// listener with FeatureAdmin, rather than a tunnel request.
+func (s *Session) wantsAdmin(req *http.Request) bool {
+	if !s.features.Has(FeatureAdmin) || req.Header.Get("Upgrade") != "" || req.Method == http.MethodConnect || forwardTarget(req) != "" {
+		return false
+	}
+	tcpAddr, ok := s.client.RemoteAddr().(*net.TCPAddr)
+	return ok && tcpAddr.IP.IsLoopback()
+}
+
+// serveAdmin serves the web admin dashboard on the session's connection, starting with
+// the already read bytes in recorded, until the client or the server closes it.
+func (s *Session) serveAdmin(recorded []byte) {
+	s.leavePreAuth() // The dashboard authenticates its own requests.
+	s.client.SetReadDeadline(time.Time{})
+	log.Printf("[session %s] Serving web admin dashboard", s.sessionID)
+	conn := &replayConn{Conn: s.client, r: io.MultiReader(bytes.NewReader(recorded), s.client)}
+	ln := newConnListener(conn)
+	srv := &http.Server{Handler: s.server.webAdminHandler(), ReadHeaderTimeout: 5 * time.Second, IdleTimeout: time.Minute}
+	go func() {
+		select {
+		case <-s.server.ctx.Done():
+			srv.Close()
+		case <-ln.done:
+		}
+	}()
+	srv.Serve(ln)
+}
+
+// replayConn is a connection whose reads come from r, e.g. bytes already read followed
+// by the connection itself.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// connListener is a listener that accepts a single connection and then waits until
+// that connection is closed.
+type connListener struct {
+	conn      net.Conn
+	accepted  bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{conn: conn, done: make(chan struct{})}
+}
+
+// Accept returns the connection on the first call and blocks until it is closed on
+// later calls. It is only called from the serving goroutine.
+func (l *connListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return &closeNotifyConn{Conn: l.conn, l: l}, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// closeNotifyConn closes its listener when it is closed.
+type closeNotifyConn struct {
+	net.Conn
+	l *connListener
+}
+
+func (c *closeNotifyConn) Close() error {
+	c.l.Close()
+	return c.Conn.Close()
+}
+
+// auth wraps h so that it only runs for requests carrying a valid admin token in the
+// Authorization header, passing a manager scoped to that admin.
+func (wa *webAdmin) auth(h func(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		// Pick up tokens created or revoked with the CLI since the server started.
+		admins := wa.manager.GetAdminDB()
+		if err := admins.Reload(); err != nil {
+			log.Printf("Web admin: failed to reload admin database: %v", err)
+		}
+		admin, err := admins.AuthenticateToken(token)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		h(w, r, wa.manager.As(admin))
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// handleMe describes the authenticated admin.
+func (wa *webAdmin) handleMe(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	admin := um.Actor()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"username": admin.Username,
+		"role":     admin.Role,
+		"quota":    admin.Quota,
+	})
+}
+
+// handleStats returns server statistics with the sessions the admin may manage.
+func (wa *webAdmin) handleStats(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	stats := wa.server.Stats()
+	visible := stats.Sessions[:0]
+	for _, sess := range stats.Sessions {
+		if um.CanManage(sess.User) {
+			visible = append(visible, sess)
+		}
+	}
+	stats.Sessions = visible
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleConfig returns the effective configuration to superadmins.
+func (wa *webAdmin) handleConfig(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	if !um.Actor().IsSuperAdmin() {
+		writeError(w, http.StatusForbidden, "configuration is only visible to superadmins")
+		return
+	}
+	writeJSON(w, http.StatusOK, wa.server.Settings())
+}
+
+// userView is the JSON representation of a user.
+type userView struct {
+	Username    string    `json:"username"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	Owner       string    `json:"owner"`
+	Plan        string    `json:"plan,omitempty"`
+	Expires     time.Time `json:"expires,omitzero"`
+	Schedule    string    `json:"schedule"`
+	Contact     string    `json:"contact"`
+	Notes       string    `json:"notes"`
+	ClientCerts []string  `json:"client_certs"`
+	Lock        string    `json:"lock,omitempty"`
+
+	Stats *usermgmt.UserStats `json:"stats,omitempty"`
+}
+
+// handleListUsers lists the users the admin may manage.
+func (wa *webAdmin) handleListUsers(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	users := um.Users()
+	views := make([]userView, 0, len(users))
+	for _, u := range users {
+		views = append(views, newUserView(u))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleGetUser describes one user the admin may manage.
+func (wa *webAdmin) handleGetUser(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	u, err := um.GetUser(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserView(u))
+}
+
+// newUserView returns the web admin view of u.
+func newUserView(u *usermgmt.User) userView {
+	lock := ""
+	if u.Lock.Active(time.Now()) {
+		lock = u.Lock.String()
+	}
+	return userView{
+		Username:    u.Username,
+		Enabled:     u.Enabled,
+		CreatedAt:   u.CreatedAt,
+		Owner:       u.Owner,
+		Plan:        u.Plan,
+		Expires:     u.Expires,
+		Schedule:    u.Schedule.String(),
+		Contact:     u.Contact,
+		Notes:       u.Notes,
+		ClientCerts: u.ClientCerts,
+		Lock:        lock,
+		Stats:       u.Stats,
+	}
+}
+
+// credentials is the request body for creating a user or changing a password.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// handleAddUser creates a user owned by the admin.
+func (wa *webAdmin) handleAddUser(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	var req credentials
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := um.AddUserDirect(req.Username, req.Password); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Web admin: '%s' added user '%s'", um.Actor().Username, req.Username)
+	writeJSON(w, http.StatusCreated, map[string]string{"username": req.Username})
+}
+
+// handleRemoveUser deletes a user.
+func (wa *webAdmin) handleRemoveUser(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	name := r.PathValue("name")
+	if err := um.RemoveUser(name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Web admin: '%s' removed user '%s'", um.Actor().Username, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUserAction enables or disables a user or changes their password.
+func (wa *webAdmin) handleUserAction(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	name, action := r.PathValue("name"), r.PathValue("action")
+	var err error
+	switch action {
+	case "enable":
+		err = um.EnableUser(name)
+	case "disable":
+		err = um.DisableUser(name)
+	case "unlock":
+		if err = um.UnlockUser(name); err == nil {
+			limits.Shared().ResetFailures(limits.AccountKey(name))
+		}
+	case "password":
+		var req credentials
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		err = um.ChangePassword(name, req.Password)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown action '%s'", action))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Web admin: '%s' applied %s to user '%s'", um.Actor().Username, action, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleKillSession closes an active session of a user the admin may manage.
+func (wa *webAdmin) handleKillSession(w http.ResponseWriter, r *http.Request, um *usermgmt.Manager) {
+	id := r.PathValue("id")
+	sess := wa.server.FindSession(id)
+	if sess == nil || !um.CanManage(sess.Username()) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	sess.Close()
+	log.Printf("[session %s] Web admin: closed by '%s'", id, um.Actor().Username)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+)
+
+// webAdminClient sends API requests to a web admin handler with an admin's token.
+type webAdminClient struct {
+	t       *testing.T
+	handler http.Handler
+	token   string
+}
+
+// do sends a request and returns the response status and body.
+func (c webAdminClient) do(method, path, body string) (int, string) {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+// newWebAdminClients registers a superadmin and the resellers wr1 and wr2, who own the
+// users wa1 and wb1, and returns API clients acting for each admin.
+func newWebAdminClients(t *testing.T) (root, r1, r2 webAdminClient) {
+	t.Helper()
+	handler := NewServer().webAdminHandler()
+	admins := usermgmt.NewAdminDB("")
+	db := ssh.GetUserDB()
+	client := func(username, role string) webAdminClient {
+		t.Helper()
+		if err := admins.AddAdmin(username, "password", role, 0); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admins.RemoveAdmin(username) })
+		token, err := admins.CreateToken(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return webAdminClient{t: t, handler: handler, token: token}
+	}
+	root, r1, r2 = client("wroot", usermgmt.RoleSuperAdmin), client("wr1", usermgmt.RoleReseller), client("wr2", usermgmt.RoleReseller)
+	for user, owner := range map[string]string{"wa1": "wr1", "wb1": "wr2"} {
+		if err := db.AddUserWithOwner(user, "secret", owner, 0); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.RemoveUser(user) })
+	}
+	return root, r1, r2
+}
+
+func TestWebAdminResellerScope(t *testing.T) {
+	root, r1, r2 := newWebAdminClients(t)
+
+	status, body := r1.do("GET", "/api/users", "")
+	var users []userView
+	if err := json.Unmarshal([]byte(body), &users); status != http.StatusOK || err != nil {
+		t.Fatalf("listing users: status %d, body %s", status, body)
+	}
+	if len(users) != 1 || users[0].Username != "wa1" {
+		t.Errorf("reseller sees users %+v, want only wa1", users)
+	}
+	if status, _ := r1.do("GET", "/api/users/wb1", ""); status != http.StatusNotFound {
+		t.Errorf("reading another reseller's user: status %d, want 404", status)
+	}
+
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/api/users/wb1/disable", ""},
+		{"POST", "/api/users/wb1/password", `{"password": "stolen"}`},
+		{"DELETE", "/api/users/wb1", ""},
+	} {
+		if status, _ := r1.do(req.method, req.path, req.body); status != http.StatusBadRequest {
+			t.Errorf("%s %s by another reseller: status %d, want 400", req.method, req.path, status)
+		}
+	}
+	db := ssh.GetUserDB()
+	if user, err := db.GetUserInfo("wb1"); err != nil || !user.Enabled {
+		t.Fatalf("user of another reseller was removed or disabled: %+v, %v", user, err)
+	}
+	if !db.Authenticate("wb1", "secret") {
+		t.Error("password of another reseller's user was changed")
+	}
+	// The owner may make the same changes.
+	if status, body := r2.do("POST", "/api/users/wb1/disable", ""); status != http.StatusNoContent {
+		t.Errorf("owner disabling their user: status %d, body %s", status, body)
+	}
+
+	if status, _ := r1.do("GET", "/api/config", ""); status != http.StatusForbidden {
+		t.Errorf("reseller reading the configuration: status %d, want 403", status)
+	}
+	if status, _ := root.do("GET", "/api/config", ""); status != http.StatusOK {
+		t.Errorf("superadmin reading the configuration: status %d, want 200", status)
+	}
+	if status, _ := root.do("GET", "/api/users/wb1", ""); status != http.StatusOK {
+		t.Errorf("superadmin reading any user: status %d, want 200", status)
+	}
+}
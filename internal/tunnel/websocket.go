@@ -0,0 +1,227 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/keepalive"
+)
+
+// websocketGUID is appended to the client's key to compute the accept key (RFC 6455 section 4.2.2).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// LegacyWebSocketAccept makes the upgrade response always carry the fixed
+// Sec-WebSocket-Accept value of WebSocketUpgradeResponse, as older releases did. It is
+// read from SSH_IFY_LEGACY_WEBSOCKET_ACCEPT.
+var LegacyWebSocketAccept = config.EnvBool("SSH_IFY_LEGACY_WEBSOCKET_ACCEPT", false)
+
+// WebSocketAccept returns the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func WebSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeResponse returns the 101 response for req. The accept key is computed from the
+// client's Sec-WebSocket-Key; requests without one, which many tunneling clients send,
+// get the fixed legacy response.
+func upgradeResponse(req *http.Request) string {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if LegacyWebSocketAccept || key == "" {
+		return WebSocketUpgradeResponse
+	}
+	return "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + WebSocketAccept(key) + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+}
+
+// WebSocket opcodes (RFC 6455 section 5.2)
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// wsConn carries a byte stream in WebSocket frames over a client connection. Reads
+// return the unmasked payload of data frames and answer pings and close frames; writes
+// send each buffer as one unmasked binary frame.
+type wsConn struct {
+	net.Conn
+	rd         *bufio.Reader
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closed     chan struct{} // Closed by Close, stopping pings
+
+	remaining uint64  // Payload bytes left in the current data frame
+	mask      [4]byte // Masking key of the current data frame
+	masked    bool
+	maskPos   int
+}
+
+// newWebSocketConn wraps conn, first reading the frames in pending, which were received
+// together with the upgrade request. A ping frame is sent every keepalive.WebSocketPing
+// until the connection is closed.
+func newWebSocketConn(conn net.Conn, pending []byte) *wsConn {
+	c := &wsConn{
+		Conn:   conn,
+		rd:     bufio.NewReader(io.MultiReader(bytes.NewReader(pending), conn)),
+		closed: make(chan struct{}),
+	}
+	if keepalive.WebSocketPing > 0 {
+		go c.ping(keepalive.WebSocketPing)
+	}
+	return c
+}
+
+// ping sends an empty ping frame every interval until the connection is closed or a
+// write fails. Clients answer with pongs, which Read discards.
+func (c *wsConn) ping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close stops pings and closes the underlying connection.
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// readHeader reads a frame header and returns its opcode and payload length.
+func (c *wsConn) readHeader() (byte, uint64, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rd, head[:]); err != nil {
+		return 0, 0, err
+	}
+	opcode := head[0] & 0x0f
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rd, ext[:]); err != nil {
+			return 0, 0, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rd, ext[:]); err != nil {
+			return 0, 0, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	c.masked, c.maskPos = head[1]&0x80 != 0, 0
+	if c.masked {
+		if _, err := io.ReadFull(c.rd, c.mask[:]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return opcode, length, nil
+}
+
+// unmask unmasks p, which continues the payload of the current frame.
+func (c *wsConn) unmask(p []byte) {
+	if !c.masked {
+		return
+	}
+	for i := range p {
+		p[i] ^= c.mask[c.maskPos&3]
+		c.maskPos++
+	}
+}
+
+// Read reads payload bytes of data frames, handling control frames in between.
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		opcode, length, err := c.readHeader()
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case opContinuation, opText, opBinary:
+			c.remaining = length
+		case opClose, opPing, opPong:
+			if length > 125 {
+				return 0, fmt.Errorf("websocket: control frame of %d bytes", length)
+			}
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(c.rd, payload); err != nil {
+				return 0, err
+			}
+			c.unmask(payload)
+			switch opcode {
+			case opPing:
+				if err := c.writeFrame(opPong, payload); err != nil {
+					return 0, err
+				}
+			case opClose:
+				if len(payload) > 2 {
+					payload = payload[:2]
+				}
+				c.writeFrame(opClose, payload)
+				return 0, io.EOF
+			}
+		default:
+			return 0, fmt.Errorf("websocket: unknown opcode %#x", opcode)
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.rd.Read(p)
+	c.unmask(p[:n])
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// Write sends p as one binary frame.
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame sends one unmasked frame with the FIN bit set.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	buffers := net.Buffers{header, payload}
+	_, err := buffers.WriteTo(c.Conn)
+	return err
+}
@@ -0,0 +1,133 @@
+package upstream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 protocol constants (RFC 1928 and RFC 1929).
+const (
+	socksVersion        = 0x05
+	socksAuthVersion    = 0x01
+	socksMethodNone     = 0x00
+	socksMethodPassword = 0x02
+	socksCommandConnect = 0x01
+	socksAddressIPv4    = 0x01
+	socksAddressDomain  = 0x03
+	socksAddressIPv6    = 0x04
+	socksReplySucceeded = 0x00
+)
+
+// dialSOCKS connects to the SOCKS5 proxy of u and asks it to connect to address.
+func (u *Upstream) dialSOCKS(base Dialer, address string) (net.Conn, error) {
+	request, err := socksConnectRequest(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := u.via.Dial(base, "tcp", u.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if err := u.socksHandshake(conn, request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socksHandshake authenticates with the proxy on conn and sends the CONNECT request.
+func (u *Upstream) socksHandshake(conn net.Conn, request []byte) error {
+	method := byte(socksMethodNone)
+	if u.User != "" {
+		method = socksMethodPassword
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion || reply[1] != method {
+		return errors.New("SOCKS proxy refused the authentication method")
+	}
+
+	if method == socksMethodPassword {
+		auth := []byte{socksAuthVersion, byte(len(u.User))}
+		auth = append(auth, u.User...)
+		auth = append(auth, byte(len(u.Password)))
+		auth = append(auth, u.Password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS proxy rejected the credentials")
+		}
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return err
+	}
+	if header[1] != socksReplySucceeded {
+		return fmt.Errorf("SOCKS proxy replied with code %d", header[1])
+	}
+	// Skip the bound address.
+	var skip int
+	switch header[3] {
+	case socksAddressIPv4:
+		skip = net.IPv4len
+	case socksAddressIPv6:
+		skip = net.IPv6len
+	case socksAddressDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("SOCKS proxy replied with address type %d", header[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// socksConnectRequest encodes a CONNECT request for address.
+func socksConnectRequest(address string) ([]byte, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port in %q", address)
+	}
+	request := []byte{socksVersion, socksCommandConnect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(append(request, socksAddressIPv4), ip4...)
+		} else {
+			request = append(append(request, socksAddressIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name too long in %q", address)
+		}
+		request = append(request, socksAddressDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	return binary.BigEndian.AppendUint16(request, uint16(port)), nil
+}
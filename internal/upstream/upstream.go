@@ -0,0 +1,217 @@
+// Package upstream dials forwarded connections through upstream SSH servers or SOCKS5
+// proxies, so that selected destinations leave through other exit nodes. Upstreams can
+// themselves be reached through another upstream, forming multi-hop chains.
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/metrics"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Upstream types
+const (
+	TypeSSH    = "ssh"
+	TypeSOCKS5 = "socks5"
+)
+
+// HandshakeTimeout bounds connecting to an upstream and completing its handshake.
+const HandshakeTimeout = 15 * time.Second
+
+// Dialer opens connections to the first hop. *net.Dialer satisfies this interface.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// upstreamDials counts connections opened through upstreams by upstream and result.
+var upstreamDials = metrics.NewCounterVec("ssh_ify_upstream_dials_total",
+	"Forwarded connections opened through upstreams, by upstream and result.", "upstream", "result")
+
+// Upstream is an SSH server or SOCKS5 proxy that forwarded connections are tunneled
+// through. Connections to an SSH upstream share one SSH connection, which is opened on
+// first use and reopened after it fails.
+type Upstream struct {
+	Type     string `json:"type"`               // TypeSSH or TypeSOCKS5
+	Addr     string `json:"addr"`               // host:port of the upstream
+	User     string `json:"user,omitempty"`     // Username; optional for SOCKS5
+	Password string `json:"password,omitempty"` // Password; optional if Key is set
+	Key      string `json:"key,omitempty"`      // Private key file for SSH upstreams
+	HostKey  string `json:"host_key,omitempty"` // Expected SSH host key, in authorized_keys format
+	Via      string `json:"via,omitempty"`      // Upstream this one is reached through
+
+	name      string
+	via       *Upstream
+	sshConfig *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// Resolve validates upstreams and links each to the upstream it is reached through. It
+// must be called once before any of them is used.
+func Resolve(upstreams map[string]*Upstream) error {
+	for name, u := range upstreams {
+		if u == nil {
+			return fmt.Errorf("upstream %q: missing definition", name)
+		}
+		u.name = name
+		if err := u.prepare(); err != nil {
+			return fmt.Errorf("upstream %q: %v", name, err)
+		}
+		if u.Via != "" {
+			if u.via = upstreams[u.Via]; u.via == nil {
+				return fmt.Errorf("upstream %q: unknown upstream %q", name, u.Via)
+			}
+		}
+	}
+	for name, u := range upstreams {
+		seen := map[*Upstream]bool{}
+		for hop := u; hop != nil; hop = hop.via {
+			if seen[hop] {
+				return fmt.Errorf("upstream %q: chain loops back to %q", name, hop.name)
+			}
+			seen[hop] = true
+		}
+	}
+	return nil
+}
+
+// prepare checks the fields of u and builds its SSH client configuration.
+func (u *Upstream) prepare() error {
+	if _, _, err := net.SplitHostPort(u.Addr); err != nil {
+		return fmt.Errorf("invalid address %q: %v", u.Addr, err)
+	}
+	switch u.Type {
+	case TypeSOCKS5:
+		if len(u.User) > 255 || len(u.Password) > 255 {
+			return errors.New("SOCKS5 username and password are limited to 255 bytes")
+		}
+		return nil
+	case TypeSSH:
+	default:
+		return fmt.Errorf("unknown type %q", u.Type)
+	}
+
+	if u.User == "" {
+		return errors.New("SSH upstreams need a user")
+	}
+	if u.HostKey == "" {
+		return errors.New("SSH upstreams need a host_key")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(u.HostKey))
+	if err != nil {
+		return fmt.Errorf("invalid host_key: %v", err)
+	}
+	var auth []ssh.AuthMethod
+	if u.Key != "" {
+		data, err := os.ReadFile(u.Key)
+		if err != nil {
+			return err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %v", u.Key, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if u.Password != "" {
+		auth = append(auth, ssh.Password(u.Password))
+	}
+	if len(auth) == 0 {
+		return errors.New("SSH upstreams need a password or a key")
+	}
+	u.sshConfig = &ssh.ClientConfig{
+		User:            u.User,
+		Auth:            auth,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         HandshakeTimeout,
+	}
+	return nil
+}
+
+// Name returns the name u was defined under.
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// Dial connects to address through u, or directly with base if u is nil.
+func (u *Upstream) Dial(base Dialer, network, address string) (net.Conn, error) {
+	if u == nil {
+		return base.Dial(network, address)
+	}
+	var conn net.Conn
+	var err error
+	if u.Type == TypeSOCKS5 {
+		conn, err = u.dialSOCKS(base, address)
+	} else {
+		conn, err = u.dialSSH(base, network, address)
+	}
+	if err != nil {
+		upstreamDials.Inc(u.name, "failed")
+		return nil, fmt.Errorf("via upstream %s: %w", u.name, err)
+	}
+	upstreamDials.Inc(u.name, "connected")
+	return conn, nil
+}
+
+// dialSSH opens a direct-tcpip channel to address over the SSH connection of u. If the
+// connection turns out to be broken, it is replaced once.
+func (u *Upstream) dialSSH(base Dialer, network, address string) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := u.sshClient(base)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := client.Dial(network, address)
+		var rejected *ssh.OpenChannelError
+		if err == nil || errors.As(err, &rejected) || attempt > 0 {
+			return conn, err
+		}
+		u.drop(client)
+	}
+}
+
+// sshClient returns the SSH connection of u, connecting first if there is none.
+func (u *Upstream) sshClient(base Dialer) (*ssh.Client, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.client != nil {
+		return u.client, nil
+	}
+
+	conn, err := u.via.Dial(base, "tcp", u.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, u.Addr, u.sshConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+	u.client = client
+	go func() {
+		client.Wait()
+		u.drop(client)
+	}()
+	return client, nil
+}
+
+// drop closes client and forgets it if it is still the SSH connection of u.
+func (u *Upstream) drop(client *ssh.Client) {
+	client.Close()
+	u.mu.Lock()
+	if u.client == client {
+		u.client = nil
+	}
+	u.mu.Unlock()
+}
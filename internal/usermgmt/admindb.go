@@ -0,0 +1,324 @@
+package usermgmt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Admin roles
+const (
+	// RoleSuperAdmin may manage every user and every admin.
+	RoleSuperAdmin = "superadmin"
+	// RoleReseller may only manage users they own, up to their quota.
+	RoleReseller = "reseller"
+)
+
+// Admin represents an administrator account that manages users.
+type Admin struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	Quota        int       `json:"quota,omitempty"` // Maximum owned users for resellers; 0 means unlimited
+	CreatedAt    time.Time `json:"created_at"`
+	TokenHashes  []string  `json:"token_hashes,omitempty"` // SHA-256 hashes of the admin's API tokens
+}
+
+// IsSuperAdmin reports whether the admin has unrestricted access.
+func (a *Admin) IsSuperAdmin() bool {
+	return a.Role == RoleSuperAdmin
+}
+
+// AdminDB manages admin accounts with thread-safe operations.
+type AdminDB struct {
+	admins   map[string]*Admin
+	filePath string
+	mutex    sync.RWMutex
+}
+
+// NewAdminDB creates a new admin database instance.
+func NewAdminDB(dbPath string) *AdminDB {
+	if dbPath == "" {
+		// Use config directory by default
+		configPath, err := config.GetAdminDBPath()
+		if err != nil {
+			// Fallback to current directory if config dir fails
+			dbPath = "admins.json"
+		} else {
+			dbPath = configPath
+		}
+	}
+
+	db := &AdminDB{
+		admins:   make(map[string]*Admin),
+		filePath: dbPath,
+	}
+
+	// Load existing admins from file
+	db.loadFromFile()
+
+	return db
+}
+
+// AddAdmin creates a new admin account with the given role and quota.
+func (db *AdminDB) AddAdmin(username, password, role string, quota int) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, exists := db.admins[username]; exists {
+		return fmt.Errorf("admin '%s' already exists", username)
+	}
+
+	// Validate input
+	if username == "" {
+		return fmt.Errorf("username cannot be empty")
+	}
+	if len(password) < 8 {
+		return fmt.Errorf("admin password must be at least 8 characters long")
+	}
+	if role != RoleSuperAdmin && role != RoleReseller {
+		return fmt.Errorf("unknown role '%s' (expected %s or %s)", role, RoleSuperAdmin, RoleReseller)
+	}
+	if quota < 0 {
+		return fmt.Errorf("quota cannot be negative")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost(bcrypt.DefaultCost))
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	db.admins[username] = &Admin{
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         role,
+		Quota:        quota,
+		CreatedAt:    time.Now(),
+	}
+
+	// Save to file
+	if err := db.saveToFile(); err != nil {
+		// Rollback
+		delete(db.admins, username)
+		return fmt.Errorf("failed to save admin database: %v", err)
+	}
+	return nil
+}
+
+// RemoveAdmin deletes an admin account.
+func (db *AdminDB) RemoveAdmin(username string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, exists := db.admins[username]; !exists {
+		return fmt.Errorf("admin '%s' does not exist", username)
+	}
+
+	delete(db.admins, username)
+
+	// Save to file
+	if err := db.saveToFile(); err != nil {
+		return fmt.Errorf("failed to save admin database: %v", err)
+	}
+	return nil
+}
+
+// SetQuota changes the maximum number of users a reseller may own.
+func (db *AdminDB) SetQuota(username string, quota int) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	admin, exists := db.admins[username]
+	if !exists {
+		return fmt.Errorf("admin '%s' does not exist", username)
+	}
+	if quota < 0 {
+		return fmt.Errorf("quota cannot be negative")
+	}
+
+	admin.Quota = quota
+
+	// Save to file
+	if err := db.saveToFile(); err != nil {
+		return fmt.Errorf("failed to save admin database: %v", err)
+	}
+	return nil
+}
+
+// Authenticate verifies admin credentials and returns a copy of the admin on success.
+func (db *AdminDB) Authenticate(username, password string) (*Admin, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	admin, exists := db.admins[username]
+	if !exists || bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)) != nil {
+		return nil, fmt.Errorf("invalid admin credentials")
+	}
+
+	return admin.sanitized(), nil
+}
+
+// sanitized returns a copy of the admin without password and token hashes.
+func (a *Admin) sanitized() *Admin {
+	c := *a
+	c.PasswordHash = ""
+	c.TokenHashes = nil
+	return &c
+}
+
+// TokenPrefix starts every admin API token so that leaked tokens are easy to recognize.
+const TokenPrefix = "sfy_"
+
+// hashToken returns the hex SHA-256 hash a token is stored as.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken generates a new API token for an admin. Only its hash is stored, so the
+// returned token cannot be shown again.
+func (db *AdminDB) CreateToken(username string) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	admin, exists := db.admins[username]
+	if !exists {
+		return "", fmt.Errorf("admin '%s' does not exist", username)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(secret)
+	admin.TokenHashes = append(admin.TokenHashes, hashToken(token))
+
+	// Save to file
+	if err := db.saveToFile(); err != nil {
+		// Rollback
+		admin.TokenHashes = admin.TokenHashes[:len(admin.TokenHashes)-1]
+		return "", fmt.Errorf("failed to save admin database: %v", err)
+	}
+	return token, nil
+}
+
+// RevokeTokens invalidates all API tokens of an admin.
+func (db *AdminDB) RevokeTokens(username string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	admin, exists := db.admins[username]
+	if !exists {
+		return fmt.Errorf("admin '%s' does not exist", username)
+	}
+
+	admin.TokenHashes = nil
+
+	// Save to file
+	if err := db.saveToFile(); err != nil {
+		return fmt.Errorf("failed to save admin database: %v", err)
+	}
+	return nil
+}
+
+// AuthenticateToken returns a copy of the admin owning token.
+func (db *AdminDB) AuthenticateToken(token string) (*Admin, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if strings.HasPrefix(token, TokenPrefix) {
+		hash := hashToken(token)
+		for _, admin := range db.admins {
+			for _, h := range admin.TokenHashes {
+				if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+					return admin.sanitized(), nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid admin token")
+}
+
+// Reload replaces the in-memory admins with the contents of the database file, picking
+// up changes made by other processes such as the CLI.
+func (db *AdminDB) Reload() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	current := db.admins
+	db.admins = make(map[string]*Admin)
+	if err := db.loadFromFile(); err != nil {
+		db.admins = current
+		return err
+	}
+	return nil
+}
+
+// ListAdmins returns copies of all admin accounts without password or token hashes.
+func (db *AdminDB) ListAdmins() []*Admin {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	admins := make([]*Admin, 0, len(db.admins))
+	for _, admin := range db.admins {
+		admins = append(admins, admin.sanitized())
+	}
+	return admins
+}
+
+// saveToFile saves the admin database to disk.
+func (db *AdminDB) saveToFile() error {
+	data, err := json.MarshalIndent(db.admins, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to temporary file first, then rename for atomic operation
+	tempFile := db.filePath + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempFile, db.filePath); err != nil {
+		os.Remove(tempFile) // Clean up temp file
+		return err
+	}
+
+	return nil
+}
+
+// loadFromFile loads the admin database from disk.
+func (db *AdminDB) loadFromFile() error {
+	file, err := os.Open(db.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// File doesn't exist yet, start with empty database
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		// Empty file, start with empty database
+		return nil
+	}
+
+	return json.Unmarshal(data, &db.admins)
+}
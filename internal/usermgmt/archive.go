@@ -0,0 +1,110 @@
+package usermgmt
+
+import (
+	"fmt"
+	"time"
+)
+
+// archiveTable is the table archived users are kept in.
+const archiveTable = "archived-users"
+
+// ArchivedUser is the record of a removed user kept so that the removal can be undone.
+type ArchivedUser struct {
+	User       *User     `json:"user"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// ArchiveUser removes a user, keeping their record in the archive so that they can be
+// brought back with UnarchiveUser. Archiving replaces an earlier archive of the same name.
+func (db *UserDB) ArchiveUser(username string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	user, exists := db.users[username]
+	if !exists {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+	archive, err := loadTable[ArchivedUser](db, archiveTable)
+	if err != nil {
+		return fmt.Errorf("failed to load archived users: %v", err)
+	}
+	archive[username] = &ArchivedUser{User: user, ArchivedAt: db.clock.Now()}
+	if err := saveTable(db, archiveTable, archive, username); err != nil {
+		return fmt.Errorf("failed to save archived users: %v", err)
+	}
+
+	delete(db.users, username)
+	if err := db.saveLocked(username); err != nil {
+		db.users[username] = user
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// UnarchiveUser restores an archived user. It fails if a user of the same name exists.
+func (db *UserDB) UnarchiveUser(username string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	if _, exists := db.users[username]; exists {
+		return fmt.Errorf("user '%s' already exists", username)
+	}
+	archive, err := loadTable[ArchivedUser](db, archiveTable)
+	if err != nil {
+		return fmt.Errorf("failed to load archived users: %v", err)
+	}
+	entry := archive[username]
+	if entry == nil || entry.User == nil {
+		return fmt.Errorf("user '%s' is not archived", username)
+	}
+
+	db.users[username] = entry.User
+	if err := db.insertLocked(username); err != nil {
+		delete(db.users, username)
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	delete(archive, username)
+	if err := saveTable(db, archiveTable, archive, username); err != nil {
+		return fmt.Errorf("failed to save archived users: %v", err)
+	}
+	return nil
+}
+
+// ArchivedUsers returns the archived users by username.
+func (db *UserDB) ArchivedUsers() (map[string]*ArchivedUser, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return loadTable[ArchivedUser](db, archiveTable)
+}
+
+// PurgeArchived deletes the archived record of username for good, or of every archived
+// user if username is "". It returns the number of records deleted.
+func (db *UserDB) PurgeArchived(username string) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	archive, err := loadTable[ArchivedUser](db, archiveTable)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load archived users: %v", err)
+	}
+	var names []string
+	if username == "" {
+		for name := range archive {
+			names = append(names, name)
+		}
+	} else if archive[username] != nil {
+		names = []string{username}
+	} else {
+		return 0, fmt.Errorf("user '%s' is not archived", username)
+	}
+
+	for _, name := range names {
+		delete(archive, name)
+	}
+	if err := saveTable(db, archiveTable, archive, names...); err != nil {
+		return 0, fmt.Errorf("failed to save archived users: %v", err)
+	}
+	return len(names), nil
+}
@@ -0,0 +1,81 @@
+package usermgmt
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FingerprintPrefix marks a client certificate identity that is a SHA-256 fingerprint
+// of the DER-encoded certificate rather than a subject alternative name.
+const FingerprintPrefix = "sha256:"
+
+// CertFingerprint returns the "sha256:<hex>" identity of a certificate.
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return FingerprintPrefix + hex.EncodeToString(sum[:])
+}
+
+// CertIdentities returns every identity a certificate can be mapped by: its fingerprint
+// followed by its DNS, email and URI subject alternative names.
+func CertIdentities(cert *x509.Certificate) []string {
+	ids := []string{CertFingerprint(cert)}
+	for _, name := range cert.DNSNames {
+		ids = append(ids, "dns:"+strings.ToLower(name))
+	}
+	for _, email := range cert.EmailAddresses {
+		ids = append(ids, "email:"+strings.ToLower(email))
+	}
+	for _, uri := range cert.URIs {
+		ids = append(ids, "uri:"+uri.String())
+	}
+	return ids
+}
+
+// NormalizeCertIdentity validates a client certificate identity and returns it in the
+// form produced by CertIdentities. Accepted forms are "sha256:<hex>" (colons allowed, as
+// printed by openssl), "dns:<name>", "email:<address>" and "uri:<uri>". A path to a PEM
+// certificate is accepted too and converted to its fingerprint.
+func NormalizeCertIdentity(identity string) (string, error) {
+	identity = strings.TrimSpace(identity)
+	kind, value, ok := strings.Cut(identity, ":")
+	if ok {
+		switch strings.ToLower(kind) {
+		case "sha256":
+			hexValue := strings.ToLower(strings.ReplaceAll(value, ":", ""))
+			if b, err := hex.DecodeString(hexValue); err != nil || len(b) != sha256.Size {
+				return "", fmt.Errorf("invalid SHA-256 fingerprint %q", value)
+			}
+			return FingerprintPrefix + hexValue, nil
+		case "dns", "email":
+			if value == "" {
+				return "", fmt.Errorf("empty %s identity", kind)
+			}
+			return strings.ToLower(kind) + ":" + strings.ToLower(value), nil
+		case "uri":
+			if value == "" {
+				return "", fmt.Errorf("empty uri identity")
+			}
+			return "uri:" + value, nil
+		}
+	}
+
+	// Fall back to reading a certificate file.
+	data, err := os.ReadFile(identity)
+	if err != nil {
+		return "", fmt.Errorf("invalid client certificate identity %q: expected sha256:, dns:, email:, uri: or a PEM file", identity)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("%s does not contain a PEM certificate", identity)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", identity, err)
+	}
+	return CertFingerprint(cert), nil
+}
@@ -0,0 +1,26 @@
+package usermgmt
+
+import (
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost returns the bcrypt cost of new password hashes: cost, raised to
+// config.HardenedBcryptCost in hardened mode.
+func passwordCost(cost int) int {
+	if config.Hardened {
+		return max(cost, config.HardenedBcryptCost)
+	}
+	return cost
+}
+
+// WeakPasswordHash reports whether hash is a bcrypt hash cheaper than hardened mode
+// allows. It is always false outside hardened mode; such hashes are replaced as their
+// users log in.
+func WeakPasswordHash(hash string) bool {
+	if !config.Hardened {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < config.HardenedBcryptCost
+}
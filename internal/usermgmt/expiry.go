@@ -0,0 +1,43 @@
+package usermgmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpiryLayout is the date format of account expiry dates.
+const ExpiryLayout = "2006-01-02"
+
+// ParseExpiry parses an account expiry specification: a date such as "2024-12-31", at
+// whose start in the server's local time zone the account expires, or a number of days
+// from now such as "30d". The spec "none" yields the zero time, meaning never.
+func ParseExpiry(spec string, now time.Time) (time.Time, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "none" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(spec, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("invalid number of days %q", spec)
+		}
+		return now.AddDate(0, 0, n), nil
+	}
+	t, err := time.ParseInLocation(ExpiryLayout, spec, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry %q: expected YYYY-MM-DD, <days>d or none", spec)
+	}
+	return t, nil
+}
+
+// Expired reports whether the account of user has expired at now.
+func (user *User) Expired(now time.Time) bool {
+	return !user.Expires.IsZero() && !now.Before(user.Expires)
+}
+
+// SetExpiry sets when the account of a user expires; the zero time means never.
+func (db *UserDB) SetExpiry(username string, expires time.Time) error {
+	return db.updateUser(username, func(user *User) { user.Expires = expires })
+}
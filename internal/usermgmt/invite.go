@@ -0,0 +1,206 @@
+package usermgmt
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// InviteTokenPrefix starts every invite token so that leaked tokens are easy to recognize.
+const InviteTokenPrefix = "sfi_"
+
+// inviteTable is the table pending invites are kept in, by token hash.
+const inviteTable = "invites"
+
+// InviteTTL is how long an invite stays valid when none is given. It is read from
+// SSH_IFY_INVITE_TTL.
+var InviteTTL = config.EnvDuration("SSH_IFY_INVITE_TTL", 7*24*time.Hour)
+
+// ErrInvalidInvite is returned for invite tokens that are unknown, used or expired.
+var ErrInvalidInvite = errors.New("invalid or expired invite")
+
+// signupName restricts the usernames chosen at signup, which anyone holding an invite
+// picks.
+var signupName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,31}$`)
+
+// Invite is a pending invite: one account that can be created with a preset policy.
+type Invite struct {
+	Owner    string    `json:"owner,omitempty"`    // Admin the account will be owned by
+	Quota    int       `json:"quota,omitempty"`    // Owner's account quota, if a reseller
+	Plan     string    `json:"plan,omitempty"`     // Plan the account is assigned to
+	Schedule *Schedule `json:"schedule,omitempty"` // Allowed login window of the account
+	Expiry   string    `json:"expiry,omitempty"`   // Account expiry, as accepted by ParseExpiry at signup
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"` // When the invite can no longer be used
+}
+
+// CreateInvite stores invite and generates the one-time token that redeems it until ttl
+// has passed. It returns the token with its expiry. Only its hash is stored, so the token
+// cannot be shown again.
+func (db *UserDB) CreateInvite(invite Invite, ttl time.Duration) (string, time.Time, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if invite.Expiry != "" {
+		if _, err := ParseExpiry(invite.Expiry, db.clock.Now()); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	invites, err := loadTable[Invite](db, inviteTable)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to load invites: %v", err)
+	}
+	token, err := generateToken(InviteTokenPrefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Drop invites that have expired.
+	now := db.clock.Now()
+	var changed []string
+	for hash, entry := range invites {
+		if !now.Before(entry.Expires) {
+			delete(invites, hash)
+			changed = append(changed, hash)
+		}
+	}
+	hash := hashToken(token)
+	invite.Created = now
+	invite.Expires = now.Add(ttl)
+	invites[hash] = &invite
+	if err := saveTable(db, inviteTable, invites, append(changed, hash)...); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to save invites: %v", err)
+	}
+	return token, invite.Expires, nil
+}
+
+// Invites returns the pending invites created by owner, or all of them if owner is
+// empty, sorted by expiry.
+func (db *UserDB) Invites(owner string) ([]*Invite, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	invites, err := loadTable[Invite](db, inviteTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invites: %v", err)
+	}
+	now := db.clock.Now()
+	var pending []*Invite
+	for _, entry := range invites {
+		if now.Before(entry.Expires) && (owner == "" || entry.Owner == owner) {
+			pending = append(pending, entry)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Expires.Before(pending[j].Expires) })
+	return pending, nil
+}
+
+// RevokeInvites revokes the pending invites created by owner, or all of them if owner is
+// empty, and returns how many were revoked.
+func (db *UserDB) RevokeInvites(owner string) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	invites, err := loadTable[Invite](db, inviteTable)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load invites: %v", err)
+	}
+	var revoked []string
+	for hash, entry := range invites {
+		if owner == "" || entry.Owner == owner {
+			delete(invites, hash)
+			revoked = append(revoked, hash)
+		}
+	}
+	if len(revoked) == 0 {
+		return 0, nil
+	}
+	if err := saveTable(db, inviteTable, invites, revoked...); err != nil {
+		return 0, fmt.Errorf("failed to save invites: %v", err)
+	}
+	return len(revoked), nil
+}
+
+// claimInviteLocked revokes the invite stored under hash, failing with ErrInvalidInvite
+// if it was revoked already. In cluster mode the check and the removal are one command,
+// so that of several nodes redeeming the invite at once only one succeeds. The caller
+// must hold the mutex.
+func (db *UserDB) claimInviteLocked(invites map[string]*Invite, hash string) error {
+	if db.shared == nil {
+		delete(invites, hash)
+		if err := saveTable(db, inviteTable, invites, hash); err != nil {
+			return fmt.Errorf("failed to save invites: %v", err)
+		}
+		return nil
+	}
+	removed, err := db.shared.Int("HDEL", cluster.Key(inviteTable), hash)
+	if err != nil {
+		return fmt.Errorf("failed to save invites: %v", err)
+	}
+	if removed == 0 {
+		return ErrInvalidInvite
+	}
+	delete(invites, hash)
+	return nil
+}
+
+// RedeemInvite creates the account username with password and the policy of the invite
+// token was created for, and revokes the token. Tokens are kept when the account is
+// rejected, e.g. because the username is taken, so that the user can try again.
+func (db *UserDB) RedeemInvite(token, username, password string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if !strings.HasPrefix(token, InviteTokenPrefix) {
+		return ErrInvalidInvite
+	}
+	invites, err := loadTable[Invite](db, inviteTable)
+	if err != nil {
+		return fmt.Errorf("failed to load invites: %v", err)
+	}
+	hash := hashToken(token)
+	invite, exists := invites[hash]
+	now := db.clock.Now()
+	if !exists || !now.Before(invite.Expires) {
+		return ErrInvalidInvite
+	}
+
+	if !signupName.MatchString(username) {
+		return fmt.Errorf("username must be 1 to 32 letters, digits, '.', '_' or '-'")
+	}
+	db.refreshLocked(username)
+	user, err := db.newUserLocked(username, password, invite.Owner, invite.Quota)
+	if err != nil {
+		return err
+	}
+	user.Plan = invite.Plan
+	user.Schedule = invite.Schedule
+	if invite.Expiry != "" {
+		if user.Expires, err = ParseExpiry(invite.Expiry, now); err != nil {
+			return err
+		}
+	}
+
+	// Claim the invite before creating the account so that it cannot be used twice, even
+	// by another node, and give it back if the account cannot be saved.
+	if err := db.claimInviteLocked(invites, hash); err != nil {
+		return err
+	}
+	db.users[username] = user
+	if err := db.insertLocked(username); err != nil {
+		delete(db.users, username)
+		invites[hash] = invite
+		if restoreErr := saveTable(db, inviteTable, invites, hash); restoreErr != nil {
+			log.Printf("Failed to restore invite after failed signup of '%s': %v", username, restoreErr)
+		}
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
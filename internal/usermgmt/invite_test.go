@@ -0,0 +1,85 @@
+package usermgmt
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis/redistest"
+)
+
+// newClusterDB returns a database of a cluster node sharing server.
+func newClusterDB(t *testing.T, server *redistest.Server) *UserDB {
+	t.Helper()
+	client, err := redis.ParseURL(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &UserDB{
+		users:    make(map[string]*User),
+		filePath: filepath.Join(t.TempDir(), "users.json"),
+		clock:    clock.Real{},
+		shared:   client,
+	}
+}
+
+func TestRedeemInviteOnceAcrossNodes(t *testing.T) {
+	server := redistest.NewServer(t)
+	nodes := []*UserDB{newClusterDB(t, server), newClusterDB(t, server), newClusterDB(t, server)}
+	token, _, err := nodes[0].CreateInvite(Invite{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(nodes))
+	for i, db := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = db.RedeemInvite(token, "user"+string(rune('a'+i)), "password")
+		}()
+	}
+	wg.Wait()
+
+	redeemed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case !errors.Is(err, ErrInvalidInvite):
+			t.Errorf("RedeemInvite error = %v, want %v", err, ErrInvalidInvite)
+		}
+	}
+	if redeemed != 1 {
+		t.Fatalf("invite redeemed %d times, want once", redeemed)
+	}
+	if users := nodes[0].ListUsers(); len(users) != 1 {
+		t.Errorf("cluster has %d users, want 1", len(users))
+	}
+}
+
+func TestRedeemInviteKeptWhenAccountNotSaved(t *testing.T) {
+	server := redistest.NewServer(t)
+	db := newClusterDB(t, server)
+	token, _, err := db.CreateInvite(Invite{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Fail("HSETNX", 1)
+	if err := db.RedeemInvite(token, "alice", "password"); err == nil {
+		t.Fatal("RedeemInvite succeeded although the account was not saved")
+	}
+	if invites, err := db.Invites(""); err != nil || len(invites) != 1 {
+		t.Fatalf("pending invites = %d, %v, want the invite back", len(invites), err)
+	}
+	if err := db.RedeemInvite(token, "alice", "password"); err != nil {
+		t.Fatalf("redeeming the invite again: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package usermgmt
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lock records why and until when an account is locked.
+type Lock struct {
+	Reason   string    `json:"reason"`
+	LockedAt time.Time `json:"locked_at"`
+	Until    time.Time `json:"until,omitempty"` // Zero until unlocked manually
+}
+
+// Active reports whether the lock is in effect at t. A nil lock is never active, and a
+// lock unlocks itself once Until has passed.
+func (l *Lock) Active(t time.Time) bool {
+	return l != nil && (l.Until.IsZero() || t.Before(l.Until))
+}
+
+// String formats the lock for display.
+func (l *Lock) String() string {
+	if l == nil {
+		return "none"
+	}
+	until := "until unlocked"
+	if !l.Until.IsZero() {
+		until = "until " + l.Until.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%s (since %s, %s)", l.Reason, l.LockedAt.Format("2006-01-02 15:04:05"), until)
+}
+
+// LockUser locks an account for d (0 locks it until UnlockUser is called) and returns the
+// lock. It reports false if the account was already locked, in which case the existing
+// lock is kept.
+func (db *UserDB) LockUser(username, reason string, d time.Duration) (*Lock, bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	user, exists := db.users[username]
+	if !exists {
+		return nil, false, fmt.Errorf("user '%s' does not exist", username)
+	}
+	now := db.clock.Now()
+	if user.Lock.Active(now) {
+		return user.Lock, false, nil
+	}
+
+	lock := &Lock{Reason: reason, LockedAt: now}
+	if d > 0 {
+		lock.Until = now.Add(d)
+	}
+	user.Lock = lock
+
+	// Save to file
+	if err := db.saveLocked(username); err != nil {
+		return nil, false, fmt.Errorf("failed to save user database: %v", err)
+	}
+	return lock, true, nil
+}
+
+// UnlockUser lifts the lock of an account, if any.
+func (db *UserDB) UnlockUser(username string) error {
+	return db.updateUser(username, func(user *User) { user.Lock = nil })
+}
@@ -6,19 +6,91 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
 )
 
 // Manager provides command-line interface for user management.
 type Manager struct {
-	db *UserDB
+	db     *UserDB
+	admins *AdminDB
+	actor  *Admin            // Admin the manager acts for; nil means unrestricted local access
+	usage  *accounting.Store // Usage log user statistics are computed from
 }
 
 // NewManager creates a new user manager instance.
 func NewManager(dbPath string) *Manager {
 	return &Manager{
-		db: NewUserDB(dbPath),
+		db:     NewUserDB(dbPath),
+		admins: NewAdminDB(""),
+		usage:  accounting.NewStore(""),
+	}
+}
+
+// NewManagerWithDB creates a user manager over existing databases, e.g. the user
+// database the SSH server authenticates against.
+func NewManagerWithDB(db *UserDB, admins *AdminDB) *Manager {
+	return &Manager{db: db, admins: admins, usage: accounting.NewStore("")}
+}
+
+// As returns a manager sharing um's databases that acts for admin.
+func (um *Manager) As(admin *Admin) *Manager {
+	return &Manager{db: um.db, admins: um.admins, actor: admin, usage: um.usage}
+}
+
+// LoginAdmin authenticates an admin and scopes all further operations to their permissions.
+func (um *Manager) LoginAdmin(username, password string) error {
+	admin, err := um.admins.Authenticate(username, password)
+	if err != nil {
+		return err
+	}
+	um.actor = admin
+	return nil
+}
+
+// Actor returns the admin the manager acts for, or nil for unrestricted access.
+func (um *Manager) Actor() *Admin {
+	return um.actor
+}
+
+// isReseller reports whether the manager is scoped to a reseller.
+func (um *Manager) isReseller() bool {
+	return um.actor != nil && !um.actor.IsSuperAdmin()
+}
+
+// authorize checks that the current actor may manage the given user.
+func (um *Manager) authorize(username string) error {
+	if !um.isReseller() {
+		return nil
+	}
+	user, err := um.db.GetUserInfo(username)
+	if err != nil {
+		return err
 	}
+	if user.Owner != um.actor.Username {
+		return fmt.Errorf("permission denied: user '%s' is not owned by '%s'", username, um.actor.Username)
+	}
+	return nil
+}
+
+// requireSuperAdmin checks that the current actor has unrestricted access.
+func (um *Manager) requireSuperAdmin() error {
+	if um.isReseller() {
+		return fmt.Errorf("permission denied: '%s' is not a superadmin", um.actor.Username)
+	}
+	return nil
+}
+
+// GetAdminDB returns the underlying AdminDB instance.
+func (um *Manager) GetAdminDB() *AdminDB {
+	return um.admins
 }
 
 // GetUserDB returns the underlying UserDB instance for authentication purposes.
@@ -30,21 +102,21 @@ func (um *Manager) GetUserDB() *UserDB {
 func (um *Manager) AddUserInteractive() error {
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Print("Enter username: ")
+	i18n.Print("Enter username: ")
 	username, err := reader.ReadString('\n')
 	if err != nil {
 		return err
 	}
 	username = strings.TrimSpace(username)
 
-	fmt.Print("Enter password: ")
+	i18n.Print("Enter password: ")
 	password, err := reader.ReadString('\n')
 	if err != nil {
 		return err
 	}
 	password = strings.TrimSpace(password)
 
-	fmt.Print("Confirm password: ")
+	i18n.Print("Confirm password: ")
 	confirm, err := reader.ReadString('\n')
 	if err != nil {
 		return err
@@ -55,69 +127,305 @@ func (um *Manager) AddUserInteractive() error {
 		return fmt.Errorf("passwords do not match")
 	}
 
-	return um.db.AddUser(username, password)
+	return um.AddUserDirect(username, password)
 }
 
-// AddUserDirect adds a user with provided credentials.
+// AddUserDirect adds a user with provided credentials. Users added by a reseller
+// are owned by them and count against their quota.
 func (um *Manager) AddUserDirect(username, password string) error {
+	if um.isReseller() {
+		return um.db.AddUserWithOwner(username, password, um.actor.Username, um.actor.Quota)
+	}
+	if um.actor != nil {
+		return um.db.AddUserWithOwner(username, password, um.actor.Username, 0)
+	}
 	return um.db.AddUser(username, password)
 }
 
 // RemoveUser removes a user account.
 func (um *Manager) RemoveUser(username string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
 	return um.db.RemoveUser(username)
 }
 
-// ListUsers displays all users with their information.
+// ArchiveUser removes a user account, keeping its record so that it can be restored with
+// UnarchiveUser until it is purged.
+func (um *Manager) ArchiveUser(username string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	return um.db.ArchiveUser(username)
+}
+
+// UnarchiveUser restores an archived user account.
+func (um *Manager) UnarchiveUser(username string) error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	return um.db.UnarchiveUser(username)
+}
+
+// PurgeArchived deletes the archived record of a user for good, or of every archived
+// user if username is "", and returns the number of records deleted.
+func (um *Manager) PurgeArchived(username string) (int, error) {
+	if err := um.requireSuperAdmin(); err != nil {
+		return 0, err
+	}
+	return um.db.PurgeArchived(username)
+}
+
+// ListArchived displays the archived users.
+func (um *Manager) ListArchived() error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	archive, err := um.db.ArchivedUsers()
+	if err != nil {
+		return err
+	}
+	if len(archive) == 0 {
+		i18n.Println("No archived users.")
+		return nil
+	}
+	names := make([]string, 0, len(archive))
+	for name := range archive {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	i18n.Printf("%-20s %-20s %-s\n", "Username", "Archived", "Owner")
+	i18n.Println(strings.Repeat("-", 56))
+	for _, name := range names {
+		owner := "-"
+		if user := archive[name].User; user != nil && user.Owner != "" {
+			owner = user.Owner
+		}
+		i18n.Printf("%-20s %-20s %-s\n", name, archive[name].ArchivedAt.Format("2006-01-02 15:04:05"), owner)
+	}
+	return nil
+}
+
+// RestoreUsers replaces all users with those of a backup written by backup-users.
+func (um *Manager) RestoreUsers(users map[string]*User) error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	return um.db.RestoreDB(users)
+}
+
+// Confirm prints prompt and reports whether the answer read from reader is yes. Anything
+// else, including the end of input, is taken as no.
+func Confirm(reader *bufio.Reader, prompt string) bool {
+	fmt.Print(prompt + " [y/N]: ")
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// ListUsers displays all users with their information. Resellers only see their own users.
 func (um *Manager) ListUsers() {
-	users := um.db.ListUsers()
+	if um.isReseller() {
+		um.printUsers(um.db.ListUsersByOwner(um.actor.Username))
+		return
+	}
+	um.printUsers(um.db.ListUsers())
+}
+
+// ListUsersByOwner displays the users owned by the given admin or reseller.
+func (um *Manager) ListUsersByOwner(owner string) {
+	if um.isReseller() && owner != um.actor.Username {
+		i18n.Printf("Permission denied: '%s' may only list their own users.\n", um.actor.Username)
+		return
+	}
+	um.printUsers(um.db.ListUsersByOwner(owner))
+}
+
+// Users returns the details of all users visible to the current actor, sorted by username,
+// with their statistics.
+func (um *Manager) Users() []*User {
+	usernames := um.db.ListUsers()
+	if um.isReseller() {
+		usernames = um.db.ListUsersByOwner(um.actor.Username)
+	}
+	sort.Strings(usernames)
+
+	users := make([]*User, 0, len(usernames))
+	for _, username := range usernames {
+		if user, err := um.db.GetUserInfo(username); err == nil {
+			users = append(users, user)
+		}
+	}
+	um.attachStats(users...)
+	return users
+}
+
+// GetUser returns the details of a user the current actor may manage, with their
+// statistics.
+func (um *Manager) GetUser(username string) (*User, error) {
+	if err := um.authorize(username); err != nil {
+		return nil, err
+	}
+	user, err := um.db.GetUserInfo(username)
+	if err != nil {
+		return nil, err
+	}
+	um.attachStats(user)
+	return user, nil
+}
+
+// attachStats sets the Stats of users. Failing to read the usage log leaves them unset.
+func (um *Manager) attachStats(users ...*User) {
+	usernames := make([]string, len(users))
+	for i, user := range users {
+		usernames[i] = user.Username
+	}
+	stats, err := um.userStats(usernames...)
+	if err != nil {
+		log.Printf("Failed to compute user statistics: %v", err)
+		return
+	}
+	for _, user := range users {
+		user.Stats = stats[user.Username]
+	}
+}
+
+// CanManage reports whether the current actor may manage the given user.
+func (um *Manager) CanManage(username string) bool {
+	return um.authorize(username) == nil
+}
+
+// printUsers displays a table of the given users.
+func (um *Manager) printUsers(users []string) {
 	if len(users) == 0 {
-		fmt.Println("No users found.")
+		i18n.Println("No users found.")
 		return
 	}
+	sort.Strings(users)
 
-	fmt.Printf("%-20s %-10s %-20s\n", "Username", "Status", "Created")
-	fmt.Println(strings.Repeat("-", 60))
+	i18n.Printf("%-20s %-10s %-20s %-15s %-12s %-s\n", "Username", "Status", "Created", "Owner", "Plan", "Schedule")
+	i18n.Println(strings.Repeat("-", 109))
 
 	for _, username := range users {
 		user, err := um.db.GetUserInfo(username)
 		if err != nil {
-			fmt.Printf("%-20s ERROR: %v\n", username, err)
+			i18n.Printf("%-20s ERROR: %v\n", username, err)
 			continue
 		}
 
 		status := "Enabled"
 		if !user.Enabled {
 			status = "Disabled"
+		} else if user.Lock.Active(time.Now()) {
+			status = "Locked"
+		} else if user.Expired(time.Now()) {
+			status = "Expired"
+		}
+		owner := user.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		plan := user.Plan
+		if plan == "" {
+			plan = "-"
 		}
 
-		fmt.Printf("%-20s %-10s %-20s\n",
+		i18n.Printf("%-20s %-10s %-20s %-15s %-12s %-s\n",
 			user.Username,
 			status,
 			user.CreatedAt.Format("2006-01-02 15:04:05"),
+			owner,
+			plan,
+			user.Schedule,
 		)
 	}
 }
 
+// ShowUser displays all details of a single user.
+func (um *Manager) ShowUser(username string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	user, err := um.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	status := "Enabled"
+	if !user.Enabled {
+		status = "Disabled"
+	}
+
+	i18n.Printf("Username: %s\n", user.Username)
+	i18n.Printf("Status:   %s\n", status)
+	i18n.Printf("Created:  %s\n", user.CreatedAt.Format("2006-01-02 15:04:05"))
+	i18n.Printf("Schedule: %s\n", user.Schedule)
+	if user.Plan != "" {
+		i18n.Printf("Plan:     %s\n", user.Plan)
+	}
+	if !user.Expires.IsZero() {
+		i18n.Printf("Expires:  %s\n", user.Expires.Format("2006-01-02 15:04:05"))
+	}
+	if user.Lock.Active(time.Now()) {
+		i18n.Printf("Locked:   %s\n", user.Lock)
+	}
+	i18n.Printf("Owner:    %s\n", user.Owner)
+	i18n.Printf("Contact:  %s\n", user.Contact)
+	i18n.Printf("Notes:    %s\n", user.Notes)
+	for _, identity := range user.ClientCerts {
+		i18n.Printf("Cert:     %s\n", identity)
+	}
+	if stats := user.Stats; stats != nil {
+		i18n.Printf("Sessions: %d (%d active)\n", stats.Sessions, stats.ActiveSessions)
+		i18n.Printf("Month:    %s in, %s out\n", accounting.FormatBytes(stats.MonthBytesIn), accounting.FormatBytes(stats.MonthBytesOut))
+		if !stats.LastSession.IsZero() {
+			i18n.Printf("Last:     %s from %s\n", stats.LastSession.Format("2006-01-02 15:04:05"), stats.LastClient)
+		}
+	}
+	return nil
+}
+
+// SetUserInfo updates one descriptive field ("notes", "contact" or "owner") of a user.
+// Resellers cannot change ownership.
+func (um *Manager) SetUserInfo(username, field, value string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	switch field {
+	case "notes":
+		return um.db.SetNotes(username, value)
+	case "contact":
+		return um.db.SetContact(username, value)
+	case "owner":
+		if err := um.requireSuperAdmin(); err != nil {
+			return err
+		}
+		return um.db.SetOwner(username, value)
+	default:
+		return fmt.Errorf("unknown field '%s' (expected notes, contact or owner)", field)
+	}
+}
+
 // ChangePasswordInteractive prompts for username and new password.
 func (um *Manager) ChangePasswordInteractive() error {
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Print("Enter username: ")
+	i18n.Print("Enter username: ")
 	username, err := reader.ReadString('\n')
 	if err != nil {
 		return err
 	}
 	username = strings.TrimSpace(username)
 
-	fmt.Print("Enter new password: ")
+	i18n.Print("Enter new password: ")
 	password, err := reader.ReadString('\n')
 	if err != nil {
 		return err
 	}
 	password = strings.TrimSpace(password)
 
-	fmt.Print("Confirm new password: ")
+	i18n.Print("Confirm new password: ")
 	confirm, err := reader.ReadString('\n')
 	if err != nil {
 		return err
@@ -128,35 +436,334 @@ func (um *Manager) ChangePasswordInteractive() error {
 		return fmt.Errorf("passwords do not match")
 	}
 
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	return um.db.UpdatePassword(username, password)
+}
+
+// ChangePassword sets a new password for a user.
+func (um *Manager) ChangePassword(username, password string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
 	return um.db.UpdatePassword(username, password)
 }
 
+// CreateResetToken creates a one-time token with which a user sets a new password at the
+// password reset endpoint, and returns it with its expiry.
+func (um *Manager) CreateResetToken(username string) (string, time.Time, error) {
+	if err := um.authorize(username); err != nil {
+		return "", time.Time{}, err
+	}
+	return um.db.CreateResetToken(username, ResetTokenTTL)
+}
+
+// CreateInvite creates an invite for one account owned by the current actor, valid until
+// ttl has passed, and returns its token with its expiry. plan, schedule and expiry are
+// specs like those of SetPlan, SetSchedule and SetExpiry, applied to the account at
+// signup; empty or "none" leaves them unset. Resellers' invites count towards their quota.
+func (um *Manager) CreateInvite(plan, schedule, expiry string, ttl time.Duration) (string, time.Time, error) {
+	var invite Invite
+	if um.actor != nil {
+		invite.Owner = um.actor.Username
+	}
+	if um.isReseller() {
+		invite.Quota = um.actor.Quota
+	}
+	if plan != "" && !strings.EqualFold(plan, "none") {
+		path, err := config.GetPlansPath()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		plans, err := LoadPlans(path, policy.Shared())
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if plans[plan] == nil {
+			return "", time.Time{}, fmt.Errorf("plan '%s' does not exist", plan)
+		}
+		invite.Plan = plan
+	}
+	if schedule != "" && !strings.EqualFold(strings.TrimSpace(schedule), "none") {
+		parsed, err := ParseSchedule(schedule)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		invite.Schedule = parsed
+	}
+	if !strings.EqualFold(strings.TrimSpace(expiry), "none") {
+		invite.Expiry = expiry
+	}
+	return um.db.CreateInvite(invite, ttl)
+}
+
+// ListInvites displays the pending invites of the current actor, or all of them for
+// superadmins.
+func (um *Manager) ListInvites() error {
+	invites, err := um.db.Invites(um.inviteOwner())
+	if err != nil {
+		return err
+	}
+	if len(invites) == 0 {
+		i18n.Println("No pending invites.")
+		return nil
+	}
+	i18n.Printf("%-16s %-12s %-12s %-20s %-s\n", "Owner", "Plan", "Expiry", "Valid until", "Schedule")
+	i18n.Println(strings.Repeat("-", 80))
+	for _, invite := range invites {
+		owner, plan, expiry, schedule := "-", "-", "-", "-"
+		if invite.Owner != "" {
+			owner = invite.Owner
+		}
+		if invite.Plan != "" {
+			plan = invite.Plan
+		}
+		if invite.Expiry != "" {
+			expiry = invite.Expiry
+		}
+		if invite.Schedule != nil {
+			schedule = invite.Schedule.String()
+		}
+		i18n.Printf("%-16s %-12s %-12s %-20s %-s\n", owner, plan, expiry, invite.Expires.Format("2006-01-02 15:04:05"), schedule)
+	}
+	return nil
+}
+
+// RevokeInvites revokes the pending invites of the current actor, or all of them for
+// superadmins, and returns how many were revoked.
+func (um *Manager) RevokeInvites() (int, error) {
+	return um.db.RevokeInvites(um.inviteOwner())
+}
+
+// inviteOwner returns the owner whose invites the current actor manages, or "" for all.
+func (um *Manager) inviteOwner() string {
+	if um.isReseller() {
+		return um.actor.Username
+	}
+	return ""
+}
+
 // EnableUser enables a user account.
 func (um *Manager) EnableUser(username string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
 	return um.db.EnableUser(username)
 }
 
 // DisableUser disables a user account.
 func (um *Manager) DisableUser(username string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
 	return um.db.DisableUser(username)
 }
 
+// UnlockUser lifts the brute-force lock of a user account.
+func (um *Manager) UnlockUser(username string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	return um.db.UnlockUser(username)
+}
+
+// SetSchedule parses spec and applies it as the user's login schedule.
+// The spec "none" removes any existing schedule.
+func (um *Manager) SetSchedule(username, spec string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	if strings.EqualFold(strings.TrimSpace(spec), "none") {
+		return um.db.SetSchedule(username, nil)
+	}
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	return um.db.SetSchedule(username, schedule)
+}
+
+// SetPlan assigns the user to a plan defined in the plans file. The plan "none" removes
+// the user from their plan.
+func (um *Manager) SetPlan(username, plan string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	if strings.EqualFold(plan, "none") {
+		return um.db.SetPlan(username, "", nil)
+	}
+	path, err := config.GetPlansPath()
+	if err != nil {
+		return err
+	}
+	plans, err := LoadPlans(path, policy.Shared())
+	if err != nil {
+		return err
+	}
+	return um.db.SetPlan(username, plan, plans)
+}
+
+// SetExpiry parses spec with ParseExpiry and applies it as the expiry of the user's account.
+func (um *Manager) SetExpiry(username, spec string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	expires, err := ParseExpiry(spec, time.Now())
+	if err != nil {
+		return err
+	}
+	return um.db.SetExpiry(username, expires)
+}
+
+// AddClientCert maps a TLS client certificate identity to a user.
+func (um *Manager) AddClientCert(username, identity string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	return um.db.AddClientCert(username, identity)
+}
+
+// RemoveClientCert removes a TLS client certificate identity from a user.
+func (um *Manager) RemoveClientCert(username, identity string) error {
+	if err := um.authorize(username); err != nil {
+		return err
+	}
+	return um.db.RemoveClientCert(username, identity)
+}
+
 // BackupUsers creates a backup of the user database.
 func (um *Manager) BackupUsers(backupPath string) error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
 	return um.db.BackupDB(backupPath)
 }
 
+// AddAdmin creates an admin account. Only superadmins (or unrestricted local access) may do so.
+func (um *Manager) AddAdmin(username, password, role string, quota int) error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	return um.admins.AddAdmin(username, password, role, quota)
+}
+
+// RemoveAdmin removes an admin account.
+func (um *Manager) RemoveAdmin(username string) error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	return um.admins.RemoveAdmin(username)
+}
+
+// SetAdminQuota changes the number of users a reseller may own.
+func (um *Manager) SetAdminQuota(username string, quota int) error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	return um.admins.SetQuota(username, quota)
+}
+
+// requireSelfOrSuperAdmin checks that the current actor is the given admin or has
+// unrestricted access.
+func (um *Manager) requireSelfOrSuperAdmin(username string) error {
+	if um.isReseller() && um.actor.Username != username {
+		return fmt.Errorf("permission denied: '%s' may only manage their own tokens", um.actor.Username)
+	}
+	return nil
+}
+
+// CreateToken generates an API token for an admin. Resellers may only create their own.
+func (um *Manager) CreateToken(username string) (string, error) {
+	if err := um.requireSelfOrSuperAdmin(username); err != nil {
+		return "", err
+	}
+	return um.admins.CreateToken(username)
+}
+
+// RevokeTokens invalidates all API tokens of an admin. Resellers may only revoke their own.
+func (um *Manager) RevokeTokens(username string) error {
+	if err := um.requireSelfOrSuperAdmin(username); err != nil {
+		return err
+	}
+	return um.admins.RevokeTokens(username)
+}
+
+// ListAdmins displays all admin accounts with their role, quota and usage.
+func (um *Manager) ListAdmins() error {
+	if err := um.requireSuperAdmin(); err != nil {
+		return err
+	}
+	admins := um.admins.ListAdmins()
+	if len(admins) == 0 {
+		i18n.Println("No admins found.")
+		return nil
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].Username < admins[j].Username })
+
+	i18n.Printf("%-20s %-12s %-12s %-20s\n", "Admin", "Role", "Users/Quota", "Created")
+	i18n.Println(strings.Repeat("-", 66))
+	for _, admin := range admins {
+		quota := "unlimited"
+		if admin.Quota > 0 {
+			quota = strconv.Itoa(admin.Quota)
+		}
+		usage := fmt.Sprintf("%d/%s", len(um.db.ListUsersByOwner(admin.Username)), quota)
+		i18n.Printf("%-20s %-12s %-12s %-20s\n",
+			admin.Username,
+			admin.Role,
+			usage,
+			admin.CreatedAt.Format("2006-01-02 15:04:05"),
+		)
+	}
+	return nil
+}
+
 // PrintHelp displays help information for user management commands.
 func (um *Manager) PrintHelp() {
-	fmt.Println("User Management Commands:")
-	fmt.Println("  add-user           - Add a new user (interactive)")
-	fmt.Println("  remove-user <user> - Remove a user")
-	fmt.Println("  list-users         - List all users")
-	fmt.Println("  change-password    - Change user password (interactive)")
-	fmt.Println("  enable-user <user> - Enable a user account")
-	fmt.Println("  disable-user <user>- Disable a user account")
-	fmt.Println("  backup-users <file>- Backup user database")
-	fmt.Println("  help               - Show this help")
+	i18n.Println("User Management Commands:")
+	i18n.Println("  add-user           - Add a new user (interactive)")
+	i18n.Println("  remove-user <user> [--archive]")
+	i18n.Println("                     - Remove a user, or archive them so they can be restored")
+	i18n.Println("  list-archived      - List archived users")
+	i18n.Println("  unarchive-user <user>")
+	i18n.Println("                     - Restore an archived user")
+	i18n.Println("  purge-archived [user]")
+	i18n.Println("                     - Delete an archived user, or all of them, for good")
+	i18n.Println("  list-users [owner] - List all users, or those owned by owner")
+	i18n.Println("  show-user <user>   - Show all details of a user")
+	i18n.Println("  set-info <user> <notes|contact|owner> <value>")
+	i18n.Println("                     - Update a descriptive field of a user")
+	i18n.Println("  change-password    - Change user password (interactive)")
+	i18n.Println("  reset-token <user> - Create a one-time token for the user to set a new password")
+	i18n.Println("  enable-user <user> - Enable a user account")
+	i18n.Println("  disable-user <user>- Disable a user account")
+	i18n.Println("  unlock-user <user> - Lift the brute-force lock of a user account")
+	i18n.Println("  set-schedule <user> <spec|none>")
+	i18n.Println("                     - Restrict login hours, e.g. 'weekdays 09:00-18:00'")
+	i18n.Println("  set-plan <user> <plan|none>")
+	i18n.Println("                     - Assign a user to a plan from plans.yaml")
+	i18n.Println("  set-expiry <user> <YYYY-MM-DD|days|none>")
+	i18n.Println("                     - Expire an account on a date or after a number of days, e.g. '30d'")
+	i18n.Println("  add-client-cert <user> <identity>")
+	i18n.Println("                     - Map a TLS client certificate (sha256:, dns:, email:, uri: or PEM file)")
+	i18n.Println("  remove-client-cert <user> <identity>")
+	i18n.Println("                     - Remove a client certificate mapping")
+	i18n.Println("  backup-users <file>- Backup user database")
+	i18n.Println("  restore-users <file>")
+	i18n.Println("                     - Replace all users with those of a backup")
+	i18n.Println("  add-admin <admin> <superadmin|reseller> [quota]")
+	i18n.Println("                     - Add an admin account (interactive password)")
+	i18n.Println("  remove-admin <admin>")
+	i18n.Println("                     - Remove an admin account")
+	i18n.Println("  set-quota <admin> <quota>")
+	i18n.Println("                     - Set the user quota of a reseller (0 = unlimited)")
+	i18n.Println("  list-admins        - List all admin accounts")
+	i18n.Println("  create-token <admin>")
+	i18n.Println("                     - Create an API token for the web dashboard")
+	i18n.Println("  revoke-tokens <admin>")
+	i18n.Println("                     - Revoke all API tokens of an admin")
+	i18n.Println("  help               - Show this help")
 }
 
 // CreateDefaultUserFromEnv creates a default user from environment variables if they are set.
@@ -192,14 +799,14 @@ func (um *Manager) CreateDefaultUserFromEnv() error {
 func (um *Manager) RunUserManagementCLI() {
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Println("SSH-ify User Management")
-	fmt.Println("Type 'help' for available commands or 'quit' to exit.")
+	i18n.Println("SSH-ify User Management")
+	i18n.Println("Type 'help' for available commands or 'quit' to exit.")
 
 	for {
-		fmt.Print("ssh-ify> ")
+		i18n.Print("ssh-ify> ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Printf("Error reading input: %v\n", err)
+			i18n.Printf("Error reading input: %v\n", err)
 			continue
 		}
 
@@ -214,7 +821,7 @@ func (um *Manager) RunUserManagementCLI() {
 
 		switch command {
 		case "quit", "exit":
-			fmt.Println("Goodbye!")
+			i18n.Println("Goodbye!")
 			return
 
 		case "help":
@@ -222,68 +829,312 @@ func (um *Manager) RunUserManagementCLI() {
 
 		case "add-user":
 			if err := um.AddUserInteractive(); err != nil {
-				fmt.Printf("Error adding user: %v\n", err)
+				i18n.Printf("Error adding user: %v\n", err)
 			} else {
-				fmt.Println("User added successfully!")
+				i18n.Println("User added successfully!")
 			}
 
 		case "remove-user":
-			if len(parts) < 2 {
-				fmt.Println("Usage: remove-user <username>")
+			if len(parts) < 2 || len(parts) > 3 || len(parts) == 3 && parts[2] != "--archive" {
+				i18n.Println("Usage: remove-user <username> [--archive]")
+				continue
+			}
+			if len(parts) == 3 {
+				if !Confirm(reader, i18n.Sprintf("Archive user '%s'?", parts[1])) {
+					i18n.Println("Aborted.")
+				} else if err := um.ArchiveUser(parts[1]); err != nil {
+					i18n.Printf("Error archiving user: %v\n", err)
+				} else {
+					i18n.Printf("User '%s' archived successfully!\n", parts[1])
+				}
+				continue
+			}
+			if !Confirm(reader, i18n.Sprintf("Permanently remove user '%s'?", parts[1])) {
+				i18n.Println("Aborted.")
+			} else if err := um.RemoveUser(parts[1]); err != nil {
+				i18n.Printf("Error removing user: %v\n", err)
+			} else {
+				i18n.Printf("User '%s' removed successfully!\n", parts[1])
+			}
+
+		case "list-archived":
+			if err := um.ListArchived(); err != nil {
+				i18n.Printf("Error listing archived users: %v\n", err)
+			}
+
+		case "unarchive-user":
+			if len(parts) != 2 {
+				i18n.Println("Usage: unarchive-user <username>")
 				continue
 			}
-			if err := um.RemoveUser(parts[1]); err != nil {
-				fmt.Printf("Error removing user: %v\n", err)
+			if err := um.UnarchiveUser(parts[1]); err != nil {
+				i18n.Printf("Error unarchiving user: %v\n", err)
 			} else {
-				fmt.Printf("User '%s' removed successfully!\n", parts[1])
+				i18n.Printf("User '%s' unarchived successfully!\n", parts[1])
+			}
+
+		case "purge-archived":
+			if len(parts) > 2 {
+				i18n.Println("Usage: purge-archived [username]")
+				continue
+			}
+			target, prompt := "", i18n.T("Permanently delete all archived users?")
+			if len(parts) == 2 {
+				target, prompt = parts[1], i18n.Sprintf("Permanently delete archived user '%s'?", parts[1])
+			}
+			if !Confirm(reader, prompt) {
+				i18n.Println("Aborted.")
+			} else if n, err := um.PurgeArchived(target); err != nil {
+				i18n.Printf("Error purging archived users: %v\n", err)
+			} else {
+				i18n.Printf("%d archived users purged.\n", n)
 			}
 
 		case "list-users":
-			um.ListUsers()
+			if len(parts) > 1 {
+				um.ListUsersByOwner(parts[1])
+			} else {
+				um.ListUsers()
+			}
+
+		case "show-user":
+			if len(parts) < 2 {
+				i18n.Println("Usage: show-user <username>")
+				continue
+			}
+			if err := um.ShowUser(parts[1]); err != nil {
+				i18n.Printf("Error showing user: %v\n", err)
+			}
+
+		case "set-info":
+			if len(parts) < 3 {
+				i18n.Println("Usage: set-info <username> <notes|contact|owner> [value]")
+				continue
+			}
+			if err := um.SetUserInfo(parts[1], parts[2], strings.Join(parts[3:], " ")); err != nil {
+				i18n.Printf("Error updating user: %v\n", err)
+			} else {
+				i18n.Printf("User '%s' updated successfully!\n", parts[1])
+			}
 
 		case "change-password":
 			if err := um.ChangePasswordInteractive(); err != nil {
-				fmt.Printf("Error changing password: %v\n", err)
+				i18n.Printf("Error changing password: %v\n", err)
+			} else {
+				i18n.Println("Password changed successfully!")
+			}
+
+		case "reset-token":
+			if len(parts) != 2 {
+				i18n.Println("Usage: reset-token <username>")
+				continue
+			}
+			token, expires, err := um.CreateResetToken(parts[1])
+			if err != nil {
+				i18n.Printf("Error creating reset token: %v\n", err)
 			} else {
-				fmt.Println("Password changed successfully!")
+				i18n.Printf("Reset token for user '%s' (shown only once, valid until %s): %s\n", parts[1], expires.Format("2006-01-02 15:04:05"), token)
 			}
 
 		case "enable-user":
 			if len(parts) < 2 {
-				fmt.Println("Usage: enable-user <username>")
+				i18n.Println("Usage: enable-user <username>")
 				continue
 			}
 			if err := um.EnableUser(parts[1]); err != nil {
-				fmt.Printf("Error enabling user: %v\n", err)
+				i18n.Printf("Error enabling user: %v\n", err)
 			} else {
-				fmt.Printf("User '%s' enabled successfully!\n", parts[1])
+				i18n.Printf("User '%s' enabled successfully!\n", parts[1])
 			}
 
 		case "disable-user":
 			if len(parts) < 2 {
-				fmt.Println("Usage: disable-user <username>")
+				i18n.Println("Usage: disable-user <username>")
 				continue
 			}
 			if err := um.DisableUser(parts[1]); err != nil {
-				fmt.Printf("Error disabling user: %v\n", err)
+				i18n.Printf("Error disabling user: %v\n", err)
+			} else {
+				i18n.Printf("User '%s' disabled successfully!\n", parts[1])
+			}
+
+		case "unlock-user":
+			if len(parts) < 2 {
+				i18n.Println("Usage: unlock-user <username>")
+				continue
+			}
+			if err := um.UnlockUser(parts[1]); err != nil {
+				i18n.Printf("Error unlocking user: %v\n", err)
+			} else {
+				i18n.Printf("User '%s' unlocked successfully!\n", parts[1])
+			}
+
+		case "set-schedule":
+			if len(parts) < 3 {
+				i18n.Println("Usage: set-schedule <username> <days> <start>-<end> | none")
+				continue
+			}
+			if err := um.SetSchedule(parts[1], strings.Join(parts[2:], " ")); err != nil {
+				i18n.Printf("Error setting schedule: %v\n", err)
+			} else {
+				i18n.Printf("Schedule for user '%s' updated successfully!\n", parts[1])
+			}
+
+		case "set-plan":
+			if len(parts) != 3 {
+				i18n.Println("Usage: set-plan <username> <plan> | none")
+				continue
+			}
+			if err := um.SetPlan(parts[1], parts[2]); err != nil {
+				i18n.Printf("Error setting plan: %v\n", err)
+			} else {
+				i18n.Printf("Plan for user '%s' updated successfully!\n", parts[1])
+			}
+
+		case "set-expiry":
+			if len(parts) != 3 {
+				i18n.Println("Usage: set-expiry <username> <YYYY-MM-DD> | <days>d | none")
+				continue
+			}
+			if err := um.SetExpiry(parts[1], parts[2]); err != nil {
+				i18n.Printf("Error setting expiry: %v\n", err)
+			} else {
+				i18n.Printf("Expiry for user '%s' updated successfully!\n", parts[1])
+			}
+
+		case "add-client-cert":
+			if len(parts) < 3 {
+				i18n.Println("Usage: add-client-cert <username> <identity>")
+				continue
+			}
+			if err := um.AddClientCert(parts[1], parts[2]); err != nil {
+				i18n.Printf("Error adding client certificate: %v\n", err)
+			} else {
+				i18n.Printf("Client certificate mapped to user '%s' successfully!\n", parts[1])
+			}
+
+		case "remove-client-cert":
+			if len(parts) < 3 {
+				i18n.Println("Usage: remove-client-cert <username> <identity>")
+				continue
+			}
+			if err := um.RemoveClientCert(parts[1], parts[2]); err != nil {
+				i18n.Printf("Error removing client certificate: %v\n", err)
 			} else {
-				fmt.Printf("User '%s' disabled successfully!\n", parts[1])
+				i18n.Printf("Client certificate removed from user '%s' successfully!\n", parts[1])
 			}
 
 		case "backup-users":
 			if len(parts) < 2 {
-				fmt.Println("Usage: backup-users <backup-file-path>")
+				i18n.Println("Usage: backup-users <backup-file-path>")
 				continue
 			}
 			if err := um.BackupUsers(parts[1]); err != nil {
-				fmt.Printf("Error backing up users: %v\n", err)
+				i18n.Printf("Error backing up users: %v\n", err)
+			} else {
+				i18n.Printf("User database backed up to '%s' successfully!\n", parts[1])
+			}
+
+		case "restore-users":
+			if len(parts) != 2 {
+				i18n.Println("Usage: restore-users <backup-file-path>")
+				continue
+			}
+			users, err := ReadBackup(parts[1])
+			if err != nil {
+				i18n.Printf("Error restoring users: %v\n", err)
+				continue
+			}
+			if !Confirm(reader, i18n.Sprintf("Replace all users with the %d users in '%s'?", len(users), parts[1])) {
+				i18n.Println("Aborted.")
+			} else if err := um.RestoreUsers(users); err != nil {
+				i18n.Printf("Error restoring users: %v\n", err)
+			} else {
+				i18n.Printf("%d users restored from '%s' successfully!\n", len(users), parts[1])
+			}
+
+		case "add-admin":
+			if len(parts) < 3 {
+				i18n.Println("Usage: add-admin <admin> <superadmin|reseller> [quota]")
+				continue
+			}
+			quota := 0
+			if len(parts) > 3 {
+				if quota, err = strconv.Atoi(parts[3]); err != nil {
+					i18n.Printf("Invalid quota: %s\n", parts[3])
+					continue
+				}
+			}
+			i18n.Print("Enter admin password: ")
+			password, err := reader.ReadString('\n')
+			if err != nil {
+				i18n.Printf("Error reading input: %v\n", err)
+				continue
+			}
+			if err := um.AddAdmin(parts[1], strings.TrimSpace(password), parts[2], quota); err != nil {
+				i18n.Printf("Error adding admin: %v\n", err)
+			} else {
+				i18n.Printf("Admin '%s' added successfully!\n", parts[1])
+			}
+
+		case "remove-admin":
+			if len(parts) < 2 {
+				i18n.Println("Usage: remove-admin <admin>")
+				continue
+			}
+			if err := um.RemoveAdmin(parts[1]); err != nil {
+				i18n.Printf("Error removing admin: %v\n", err)
+			} else {
+				i18n.Printf("Admin '%s' removed successfully!\n", parts[1])
+			}
+
+		case "set-quota":
+			if len(parts) < 3 {
+				i18n.Println("Usage: set-quota <admin> <quota>")
+				continue
+			}
+			quota, err := strconv.Atoi(parts[2])
+			if err != nil {
+				i18n.Printf("Invalid quota: %s\n", parts[2])
+				continue
+			}
+			if err := um.SetAdminQuota(parts[1], quota); err != nil {
+				i18n.Printf("Error setting quota: %v\n", err)
+			} else {
+				i18n.Printf("Quota for admin '%s' updated successfully!\n", parts[1])
+			}
+
+		case "list-admins":
+			if err := um.ListAdmins(); err != nil {
+				i18n.Printf("Error listing admins: %v\n", err)
+			}
+
+		case "create-token":
+			if len(parts) < 2 {
+				i18n.Println("Usage: create-token <admin>")
+				continue
+			}
+			token, err := um.CreateToken(parts[1])
+			if err != nil {
+				i18n.Printf("Error creating token: %v\n", err)
+			} else {
+				i18n.Printf("Token for admin '%s' (shown only once): %s\n", parts[1], token)
+			}
+
+		case "revoke-tokens":
+			if len(parts) < 2 {
+				i18n.Println("Usage: revoke-tokens <admin>")
+				continue
+			}
+			if err := um.RevokeTokens(parts[1]); err != nil {
+				i18n.Printf("Error revoking tokens: %v\n", err)
 			} else {
-				fmt.Printf("User database backed up to '%s' successfully!\n", parts[1])
+				i18n.Printf("Tokens of admin '%s' revoked successfully!\n", parts[1])
 			}
 
 		default:
-			fmt.Printf("Unknown command: %s\n", command)
-			fmt.Println("Type 'help' for available commands.")
+			i18n.Printf("Unknown command: %s\n", command)
+			i18n.Println("Type 'help' for available commands.")
 		}
 	}
 }
@@ -0,0 +1,115 @@
+package usermgmt
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newResellerManagers returns managers sharing new databases that act for a superadmin
+// and for the resellers r1 and r2, who own the users a1 and b1 respectively.
+func newResellerManagers(t *testing.T) (root, r1, r2 *Manager) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	admins := NewAdminDB(filepath.Join(dir, "admins.json"))
+	um := NewManagerWithDB(NewUserDB(filepath.Join(dir, "users.json")), admins)
+	as := func(username, role string) *Manager {
+		t.Helper()
+		if err := admins.AddAdmin(username, "password", role, 0); err != nil {
+			t.Fatal(err)
+		}
+		admin, err := admins.Authenticate(username, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return um.As(admin)
+	}
+	root, r1, r2 = as("root", RoleSuperAdmin), as("r1", RoleReseller), as("r2", RoleReseller)
+	if err := r1.AddUserDirect("a1", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.AddUserDirect("b1", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	return root, r1, r2
+}
+
+func TestResellerCannotListOthersUsers(t *testing.T) {
+	root, r1, _ := newResellerManagers(t)
+	var names []string
+	for _, user := range r1.Users() {
+		names = append(names, user.Username)
+	}
+	if !slices.Equal(names, []string{"a1"}) {
+		t.Errorf("reseller sees users %v, want only their own", names)
+	}
+	if _, err := r1.GetUser("b1"); err == nil {
+		t.Error("reseller read the details of another reseller's user")
+	}
+	if r1.CanManage("b1") {
+		t.Error("reseller may manage another reseller's user")
+	}
+	if len(root.Users()) != 2 {
+		t.Errorf("superadmin sees %d users, want 2", len(root.Users()))
+	}
+}
+
+func TestResellerCannotModifyOthersUsers(t *testing.T) {
+	_, r1, r2 := newResellerManagers(t)
+	db := r1.GetUserDB()
+	changes := map[string]func() error{
+		"change password": func() error { return r1.ChangePassword("b1", "stolen") },
+		"disable":         func() error { return r1.DisableUser("b1") },
+		"set expiry":      func() error { return r1.SetExpiry("b1", "1d") },
+		"set schedule":    func() error { return r1.SetSchedule("b1", "weekdays 09:00-18:00") },
+		"set notes":       func() error { return r1.SetUserInfo("b1", "notes", "mine now") },
+		"remove":          func() error { return r1.RemoveUser("b1") },
+		"archive":         func() error { return r1.ArchiveUser("b1") },
+	}
+	for name, change := range changes {
+		if err := change(); err == nil {
+			t.Errorf("%s: reseller changed another reseller's user", name)
+		}
+	}
+	user, err := db.GetUserInfo("b1")
+	if err != nil {
+		t.Fatalf("user of another reseller is gone: %v", err)
+	}
+	if !user.Enabled || !user.Expires.IsZero() || user.Schedule != nil || user.Notes != "" {
+		t.Errorf("user of another reseller was modified: %+v", user)
+	}
+	if !db.Authenticate("b1", "secret") {
+		t.Error("password of another reseller's user was changed")
+	}
+	// The owner may make the same changes.
+	if err := r2.DisableUser("b1"); err != nil {
+		t.Errorf("owner disabling their user: %v", err)
+	}
+}
+
+func TestResellerCannotPurgeArchivedUsers(t *testing.T) {
+	root, r1, r2 := newResellerManagers(t)
+	if err := r2.ArchiveUser("b1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r1.PurgeArchived("b1"); err == nil {
+		t.Error("reseller purged another reseller's archived user")
+	}
+	if _, err := r1.PurgeArchived(""); err == nil {
+		t.Error("reseller purged every archived user")
+	}
+	if err := r1.UnarchiveUser("b1"); err == nil {
+		t.Error("reseller restored another reseller's archived user")
+	}
+	archive, err := root.GetUserDB().ArchivedUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive["b1"] == nil {
+		t.Fatal("archived user was purged by a reseller")
+	}
+	if n, err := root.PurgeArchived("b1"); err != nil || n != 1 {
+		t.Errorf("superadmin purge = %d, %v, want 1", n, err)
+	}
+}
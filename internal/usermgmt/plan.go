@@ -0,0 +1,194 @@
+package usermgmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+	"github.com/ayanrajpoot10/ssh-ify/internal/yaml"
+)
+
+// Plan is a named set of limits shared by the users assigned to it, so that changing a
+// plan changes the access of all of its users at once.
+type Plan struct {
+	MaxSessions int           `json:"max_sessions,omitempty"` // Concurrent sessions per user; 0 uses the server-wide limit
+	MaxDuration string        `json:"max_duration,omitempty"` // Longest a session may last, e.g. "12h"; empty uses the server-wide limit
+	Schedule    *Schedule     `json:"schedule,omitempty"`     // Login window of users without a schedule of their own
+	Rules       []policy.Rule `json:"rules,omitempty"`        // Forwarding rules checked before the forwarding policy
+
+	name        string
+	maxDuration time.Duration
+	rules       *policy.Policy
+}
+
+// LoadPlans reads named plans from a YAML file such as
+//
+//	basic:
+//	  max_sessions: 1
+//	  max_duration: 4h
+//	  schedule: {days: [mon, tue, wed, thu, fri], start: "08:00", end: "20:00"}
+//	  rules:
+//	    - {action: deny, ports: [25, 465, 587]}
+//	premium:
+//	  max_sessions: 4
+//	  rules:
+//	    - {action: allow, via: exit-de}
+//
+// or, if path ends in ".json", the same plans as JSON. Rules may name the upstreams of
+// base in Via. A missing file yields no plans.
+func LoadPlans(path string, base *policy.Policy) (map[string]*Plan, error) {
+	plans := map[string]*Plan{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return plans, nil
+		}
+		return nil, err
+	}
+	if len(data) > 0 {
+		unmarshal := yaml.Unmarshal
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			unmarshal = json.Unmarshal
+		}
+		if err := unmarshal(data, &plans); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+	for name, plan := range plans {
+		if plan == nil {
+			return nil, fmt.Errorf("invalid plans %s: plan %q: missing definition", path, name)
+		}
+		plan.name = name
+		if err := plan.prepare(base); err != nil {
+			return nil, fmt.Errorf("invalid plans %s: plan %q: %v", path, name, err)
+		}
+	}
+	return plans, nil
+}
+
+// prepare checks the fields of the plan and compiles its rules on top of base.
+func (p *Plan) prepare(base *policy.Policy) error {
+	if p.MaxSessions < 0 {
+		return fmt.Errorf("max_sessions must not be negative")
+	}
+	if p.MaxDuration != "" {
+		d, err := time.ParseDuration(p.MaxDuration)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("max_duration must be a positive duration such as \"12h\"")
+		}
+		p.maxDuration = d
+	}
+	if p.Schedule != nil {
+		if err := p.Schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	rules, err := base.Overlay(p.Rules)
+	if err != nil {
+		return err
+	}
+	p.rules = rules
+	return nil
+}
+
+// CheckForward returns the decision of the first rule of the plan matching a connection
+// of user to host:port, and false if none matches.
+func (p *Plan) CheckForward(user, host string, port int) (policy.Decision, bool) {
+	decision, ok := p.rules.Match(user, host, port)
+	if ok {
+		decision.Rule = "plan " + p.name + " " + decision.Rule
+	}
+	return decision, ok
+}
+
+// SessionDuration returns the longest a session of the plan's users may last, or zero if
+// the plan does not limit it.
+func (p *Plan) SessionDuration() time.Duration {
+	return p.maxDuration
+}
+
+// PlanNames returns the names of plans in sorted order.
+func PlanNames(plans map[string]*Plan) []string {
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sharedPlans holds the process-wide plans once they have been loaded. A nil map means
+// they failed to load.
+var sharedPlans atomic.Pointer[map[string]*Plan]
+
+// SharedPlans returns the process-wide plans loaded from the config directory. When they
+// cannot be loaded there are none, so that users assigned to a plan cannot log in.
+func SharedPlans() map[string]*Plan {
+	if plans := sharedPlans.Load(); plans != nil {
+		return *plans
+	}
+	plans, err := loadSharedPlans()
+	if err != nil {
+		log.Printf("Failed to load plans, refusing users with a plan: %v", err)
+	}
+	sharedPlans.CompareAndSwap(nil, &plans)
+	return *sharedPlans.Load()
+}
+
+// ReloadPlans replaces the process-wide plans with the contents of the plans file,
+// compiled on top of the current forwarding policy. Plans that cannot be loaded are
+// reported and leave the current ones in place.
+func ReloadPlans() error {
+	plans, err := loadSharedPlans()
+	if err != nil {
+		return err
+	}
+	sharedPlans.Store(&plans)
+	return nil
+}
+
+// loadSharedPlans loads the plans of the config directory on top of the shared policy.
+func loadSharedPlans() (map[string]*Plan, error) {
+	path, err := config.GetPlansPath()
+	if err != nil {
+		return nil, err
+	}
+	plans, err := LoadPlans(path, policy.Shared())
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) > 0 {
+		log.Printf("Loaded %d plans from %s", len(plans), path)
+	}
+	return plans, nil
+}
+
+// PlanOf returns the plan of the user, or nil if the user does not exist, has no plan
+// or is assigned to a plan that is not defined.
+func (db *UserDB) PlanOf(username string) *Plan {
+	db.refresh(username)
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	user, exists := db.users[username]
+	if !exists || user.Plan == "" {
+		return nil
+	}
+	return SharedPlans()[user.Plan]
+}
+
+// SetPlan assigns a plan of plans to the user, or removes the user's plan if plan is "".
+func (db *UserDB) SetPlan(username, plan string, plans map[string]*Plan) error {
+	if plan != "" && plans[plan] == nil {
+		return fmt.Errorf("plan '%s' does not exist", plan)
+	}
+	return db.updateUser(username, func(user *User) { user.Plan = plan })
+}
@@ -0,0 +1,124 @@
+package usermgmt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/policy"
+)
+
+func TestLoadPlansYAMLMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"plans.yaml": `# Plans of the test
+basic:
+  max_sessions: 1
+  max_duration: 4h
+  schedule: {days: [mon, tue, wed, thu, fri], start: "08:00", end: "20:00"}
+  rules:
+    - {action: deny, ports: [25, 465, 587]}
+premium:
+  max_sessions: 4
+  rules:
+    - action: allow
+      hosts: ["*.example.com"]
+`,
+		"plans.json": `{
+  "basic": {"max_sessions": 1, "max_duration": "4h",
+            "schedule": {"days": ["mon", "tue", "wed", "thu", "fri"], "start": "08:00", "end": "20:00"},
+            "rules": [{"action": "deny", "ports": ["25", "465", "587"]}]},
+  "premium": {"max_sessions": 4, "rules": [{"action": "allow", "hosts": ["*.example.com"]}]}
+}`,
+	}
+	loaded := make(map[string]map[string]*Plan)
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		plans, err := LoadPlans(path, &policy.Policy{})
+		if err != nil {
+			t.Fatalf("loading %s: %v", name, err)
+		}
+		loaded[name] = plans
+	}
+
+	yamlPlans, jsonPlans := loaded["plans.yaml"], loaded["plans.json"]
+	if !reflect.DeepEqual(PlanNames(yamlPlans), []string{"basic", "premium"}) {
+		t.Fatalf("plans = %v, want basic and premium", PlanNames(yamlPlans))
+	}
+	for _, name := range PlanNames(jsonPlans) {
+		y, j := yamlPlans[name], jsonPlans[name]
+		if y.MaxSessions != j.MaxSessions || y.SessionDuration() != j.SessionDuration() ||
+			!reflect.DeepEqual(y.Schedule, j.Schedule) || !reflect.DeepEqual(y.Rules, j.Rules) {
+			t.Errorf("plan %q from YAML = %+v, from JSON = %+v", name, y, j)
+		}
+	}
+	if d := yamlPlans["basic"].SessionDuration(); d != 4*time.Hour {
+		t.Errorf("basic session duration = %s, want 4h", d)
+	}
+}
+
+func TestLoadPlansInvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plans.yaml")
+	if err := os.WriteFile(path, []byte("basic:\n  max_sessions: -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPlans(path, &policy.Policy{}); err == nil {
+		t.Error("plan with negative max_sessions loaded")
+	}
+}
+
+func TestReloadPlans(t *testing.T) {
+	previous := sharedPlans.Load()
+	t.Cleanup(func() { sharedPlans.Store(previous) })
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	dir := filepath.Join(home, "ssh-ify")
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	maxSessions := func() int {
+		t.Helper()
+		plan := SharedPlans()["basic"]
+		if plan == nil {
+			t.Fatal("plan basic not loaded")
+		}
+		return plan.MaxSessions
+	}
+
+	// Existing plans.json files are read while there is no plans.yaml.
+	write("plans.json", `{"basic": {"max_sessions": 1}}`)
+	if err := ReloadPlans(); err != nil {
+		t.Fatal(err)
+	}
+	if n := maxSessions(); n != 1 {
+		t.Fatalf("max_sessions = %d, want 1 from plans.json", n)
+	}
+
+	write("plans.yaml", "basic:\n  max_sessions: 2\n")
+	if err := ReloadPlans(); err != nil {
+		t.Fatal(err)
+	}
+	if n := maxSessions(); n != 2 {
+		t.Fatalf("max_sessions = %d after editing the plans, want 2", n)
+	}
+
+	// Plans that fail to load leave the current ones in place.
+	write("plans.yaml", "basic:\n  max_sessions: many\n")
+	if err := ReloadPlans(); err == nil {
+		t.Fatal("invalid plans reloaded")
+	}
+	if n := maxSessions(); n != 2 {
+		t.Fatalf("max_sessions = %d after a failed reload, want 2", n)
+	}
+}
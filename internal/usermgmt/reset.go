@@ -0,0 +1,112 @@
+package usermgmt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// ResetTokenPrefix starts every password reset token so that leaked tokens are easy to
+// recognize.
+const ResetTokenPrefix = "sfr_"
+
+// resetTable is the table pending password resets are kept in, by token hash.
+const resetTable = "reset-tokens"
+
+// ResetTokenTTL is how long a password reset token stays valid. It is read from
+// SSH_IFY_RESET_TOKEN_TTL.
+var ResetTokenTTL = config.EnvDuration("SSH_IFY_RESET_TOKEN_TTL", 24*time.Hour)
+
+// ErrInvalidResetToken is returned for reset tokens that are unknown, used or expired.
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ResetToken is a pending password reset.
+type ResetToken struct {
+	Username string    `json:"username"`
+	Expires  time.Time `json:"expires"`
+}
+
+// CreateResetToken generates a one-time token with which a user can set a new password
+// until ttl has passed, and returns it with its expiry. Only its hash is stored, so the
+// token cannot be shown again. Earlier tokens of the user are revoked.
+func (db *UserDB) CreateResetToken(username string, ttl time.Duration) (string, time.Time, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	if _, exists := db.users[username]; !exists {
+		return "", time.Time{}, fmt.Errorf("user '%s' does not exist", username)
+	}
+	tokens, err := loadTable[ResetToken](db, resetTable)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to load reset tokens: %v", err)
+	}
+
+	token, err := generateToken(ResetTokenPrefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Drop the user's earlier tokens and any that have expired.
+	now := db.clock.Now()
+	var changed []string
+	for hash, entry := range tokens {
+		if entry.Username == username || !now.Before(entry.Expires) {
+			delete(tokens, hash)
+			changed = append(changed, hash)
+		}
+	}
+	hash := hashToken(token)
+	expires := now.Add(ttl)
+	tokens[hash] = &ResetToken{Username: username, Expires: expires}
+	if err := saveTable(db, resetTable, tokens, append(changed, hash)...); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to save reset tokens: %v", err)
+	}
+	return token, expires, nil
+}
+
+// ResetPassword sets the password of the user token was created for and revokes the
+// token, returning the username. The user is read again first, so that a reset neither
+// restores an account deleted meanwhile nor undoes other changes made to it. Tokens are
+// kept when the new password is rejected, so that the user can try again.
+func (db *UserDB) ResetPassword(token, newPassword string) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if !strings.HasPrefix(token, ResetTokenPrefix) {
+		return "", ErrInvalidResetToken
+	}
+	tokens, err := loadTable[ResetToken](db, resetTable)
+	if err != nil {
+		return "", fmt.Errorf("failed to load reset tokens: %v", err)
+	}
+	hash := hashToken(token)
+	entry, exists := tokens[hash]
+	if !exists || !db.clock.Now().Before(entry.Expires) {
+		return "", ErrInvalidResetToken
+	}
+	db.refreshLocked(entry.Username)
+	user, exists := db.users[entry.Username]
+	if !exists {
+		return "", ErrInvalidResetToken
+	}
+
+	previous := user.PasswordHash
+	if err := db.setPasswordLocked(user, newPassword); err != nil {
+		return "", err
+	}
+	// Revoke the token first so that it cannot be used twice.
+	delete(tokens, hash)
+	if err := saveTable(db, resetTable, tokens, hash); err != nil {
+		user.PasswordHash = previous
+		return "", fmt.Errorf("failed to save reset tokens: %v", err)
+	}
+	if err := db.saveLocked(entry.Username); err != nil {
+		user.PasswordHash = previous
+		return "", fmt.Errorf("failed to save user database: %v", err)
+	}
+	return entry.Username, nil
+}
@@ -0,0 +1,198 @@
+package usermgmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdayNames maps the short day names used in schedules to time.Weekday values.
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// dayOrder lists the short day names in week order, starting on Sunday.
+var dayOrder = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule restricts the days and time of day a user may be logged in.
+// Times are interpreted in the server's local time zone. A window whose end is
+// before its start (e.g. 22:00-06:00) spans midnight.
+type Schedule struct {
+	Days  []string `json:"days,omitempty"` // Short day names ("mon", "tue", ...); empty means every day
+	Start string   `json:"start"`          // Start of the window, "HH:MM"
+	End   string   `json:"end"`            // End of the window, "HH:MM" (exclusive)
+}
+
+// ParseSchedule parses a schedule specification of the form "<days> <start>-<end>",
+// for example "weekdays 09:00-18:00", "mon-fri 9-18", "sat,sun 10:00-14:00" or
+// "daily 08:00-22:00". The days part may be omitted to mean every day.
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	var daysSpec, hoursSpec string
+	switch len(fields) {
+	case 1:
+		hoursSpec = fields[0]
+	case 2:
+		daysSpec, hoursSpec = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf("invalid schedule %q: expected \"<days> <start>-<end>\"", spec)
+	}
+
+	days, err := parseDays(daysSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, ok := strings.Cut(hoursSpec, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid schedule hours %q: expected <start>-<end>", hoursSpec)
+	}
+	sched := &Schedule{Days: days, Start: normalizeClock(start), End: normalizeClock(end)}
+	if err := sched.Validate(); err != nil {
+		return nil, err
+	}
+	return sched, nil
+}
+
+// parseDays expands a day specification into sorted short day names.
+func parseDays(spec string) ([]string, error) {
+	switch spec {
+	case "", "daily", "everyday", "all":
+		return nil, nil
+	case "weekdays":
+		return []string{"mon", "tue", "wed", "thu", "fri"}, nil
+	case "weekends":
+		return []string{"sun", "sat"}, nil
+	}
+
+	selected := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdayNames[from]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", from)
+		}
+		if !isRange {
+			selected[first] = true
+			continue
+		}
+		last, ok := weekdayNames[to]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", to)
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			selected[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	days := make([]string, 0, len(selected))
+	for _, name := range dayOrder {
+		if selected[weekdayNames[name]] {
+			days = append(days, name)
+		}
+	}
+	return days, nil
+}
+
+// normalizeClock turns "9" into "09:00" and leaves other values for Validate to check.
+func normalizeClock(s string) string {
+	if h, err := strconv.Atoi(s); err == nil {
+		return fmt.Sprintf("%02d:00", h)
+	}
+	return s
+}
+
+// parseClock converts "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		// Allow 24:00 as an end-of-day marker.
+		if s == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks that the schedule's days and times are well formed.
+func (s *Schedule) Validate() error {
+	for _, d := range s.Days {
+		if _, ok := weekdayNames[d]; !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+	}
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("schedule start and end must differ")
+	}
+	return nil
+}
+
+// Allows reports whether t falls inside the schedule. A nil schedule allows any time.
+func (s *Schedule) Allows(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if start > end {
+		// Overnight window: the early-morning part belongs to the previous day's window.
+		if minute < end {
+			return s.allowsDay((day + 6) % 7)
+		}
+		return minute >= start && s.allowsDay(day)
+	}
+	return minute >= start && minute < end && s.allowsDay(day)
+}
+
+// allowsDay reports whether the schedule includes the given weekday.
+func (s *Schedule) allowsDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if weekdayNames[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the schedule in the format accepted by ParseSchedule.
+func (s *Schedule) String() string {
+	if s == nil {
+		return "any time"
+	}
+	days := "daily"
+	if len(s.Days) > 0 {
+		days = strings.Join(s.Days, ",")
+	}
+	return fmt.Sprintf("%s %s-%s", days, s.Start, s.End)
+}
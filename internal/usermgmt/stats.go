@@ -0,0 +1,68 @@
+package usermgmt
+
+import (
+	"net"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/limits"
+)
+
+// UserStats summarizes the activity of a user, computed from the usage log and the
+// sessions currently open rather than stored with the account.
+type UserStats struct {
+	Sessions       int       `json:"sessions"`              // Finished sessions in the usage log
+	MonthBytesIn   int64     `json:"month_bytes_in"`        // Bytes received from the user by sessions that ended this month
+	MonthBytesOut  int64     `json:"month_bytes_out"`       // Bytes sent to the user by sessions that ended this month
+	LastClient     string    `json:"last_client,omitempty"` // Source IP of the most recent finished session
+	LastSession    time.Time `json:"last_session,omitzero"` // When the most recent finished session ended
+	ActiveSessions int       `json:"active_sessions"`       // Sessions open now
+}
+
+// ActiveSessions returns the number of sessions username has open. It defaults to the
+// counts of limits.Shared, which cover the whole cluster in cluster mode but only this
+// process otherwise; the command line replaces it to ask the running server.
+var ActiveSessions = func(username string) (int, error) {
+	return limits.Shared().Sessions(username)
+}
+
+// userStats computes the statistics of the given users in one pass over the usage log.
+func (um *Manager) userStats(usernames ...string) (map[string]*UserStats, error) {
+	stats := make(map[string]*UserStats, len(usernames))
+	for _, username := range usernames {
+		stats[username] = &UserStats{}
+	}
+
+	now := time.Now()
+	monthStart, _, _ := accounting.MonthRange(now.Format("2006-01"))
+	records, err := um.usage.Records(time.Time{}, now.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		s, ok := stats[rec.Username]
+		if !ok {
+			continue
+		}
+		s.Sessions++
+		if !rec.End.Before(monthStart) {
+			s.MonthBytesIn += rec.BytesIn
+			s.MonthBytesOut += rec.BytesOut
+		}
+		if rec.End.After(s.LastSession) {
+			s.LastSession = rec.End
+			s.LastClient = rec.Client
+			if host, _, err := net.SplitHostPort(rec.Client); err == nil {
+				s.LastClient = host
+			}
+		}
+	}
+
+	for username, s := range stats {
+		// Counting is best effort: with no server running, nothing is open.
+		if n, err := ActiveSessions(username); err == nil {
+			s.ActiveSessions = n
+		}
+	}
+	return stats, nil
+}
@@ -3,22 +3,38 @@ package usermgmt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/ayanrajpoot10/ssh-ify/internal/clock"
+	"github.com/ayanrajpoot10/ssh-ify/internal/cluster"
 	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/redis"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents a user account in the system.
 type User struct {
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"password_hash"`
-	CreatedAt    time.Time `json:"created_at"`
-	Enabled      bool      `json:"enabled"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"password_hash"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Enabled      bool       `json:"enabled"`
+	Schedule     *Schedule  `json:"schedule,omitempty"`     // Allowed login window; nil means any time
+	Plan         string     `json:"plan,omitempty"`         // Name of the plan the user is assigned to
+	Expires      time.Time  `json:"expires,omitzero"`       // When the account stops working; zero means never
+	Notes        string     `json:"notes,omitempty"`        // Free-form administrator notes
+	Contact      string     `json:"contact,omitempty"`      // Contact information for the account holder
+	Owner        string     `json:"owner,omitempty"`        // Admin or reseller responsible for the account
+	ClientCerts  []string   `json:"client_certs,omitempty"` // TLS client certificate identities mapped to the account
+	Lock         *Lock      `json:"lock,omitempty"`         // Brute-force lockout; nil when not locked
+	Stats        *UserStats `json:"stats,omitempty"`        // Computed activity, set by Manager and never stored
 }
 
 // UserDB manages user accounts with thread-safe operations.
@@ -26,6 +42,9 @@ type UserDB struct {
 	users    map[string]*User
 	filePath string
 	mutex    sync.RWMutex
+	clock    clock.Clock   // Time source for schedule checks
+	shared   *redis.Client // Cluster backend; nil keeps users in filePath
+	loaded   os.FileInfo   // filePath as last read or written, to notice changes by other processes
 }
 
 // NewUserDB creates a new user database instance.
@@ -44,17 +63,25 @@ func NewUserDB(dbPath string) *UserDB {
 	db := &UserDB{
 		users:    make(map[string]*User),
 		filePath: dbPath,
+		clock:    clock.Real{},
+		shared:   cluster.Client(),
 	}
 
-	// Load existing users from file
-	db.loadFromFile()
+	// Load existing users from the cluster backend or from file
+	if db.shared != nil {
+		db.mutex.Lock()
+		db.refreshAllLocked()
+		db.mutex.Unlock()
+	} else {
+		db.loadFromFile()
+	}
 
 	return db
 }
 
 // hashPassword creates a bcrypt hash of the password.
 func (db *UserDB) hashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost(bcrypt.MinCost))
 	if err != nil {
 		return "", err
 	}
@@ -69,51 +96,75 @@ func (db *UserDB) verifyPassword(password, hash string) bool {
 
 // AddUser creates a new user account.
 func (db *UserDB) AddUser(username, password string) error {
+	return db.AddUserWithOwner(username, password, "", 0)
+}
+
+// AddUserWithOwner creates a new user account owned by owner. If quota is positive,
+// the account is refused once owner already owns quota users.
+func (db *UserDB) AddUserWithOwner(username, password, owner string, quota int) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	user, err := db.newUserLocked(username, password, owner, quota)
+	if err != nil {
+		return err
+	}
+	db.users[username] = user
 
+	// Save to file
+	if err := db.insertLocked(username); err != nil {
+		// Rollback
+		delete(db.users, username)
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// newUserLocked validates a new account owned by owner and returns it, without adding it.
+// It enforces the owner's quota like AddUserWithOwner.
+func (db *UserDB) newUserLocked(username, password, owner string, quota int) (*User, error) {
 	// Check if user already exists
 	if _, exists := db.users[username]; exists {
-		return fmt.Errorf("user '%s' already exists", username)
+		return nil, fmt.Errorf("user '%s' already exists", username)
+	}
+
+	// Enforce the owner's account quota
+	if quota > 0 && db.shared != nil {
+		db.refreshAllLocked()
+	}
+	if quota > 0 && db.countOwnedLocked(owner) >= quota {
+		return nil, fmt.Errorf("account quota of %d users reached for '%s'", quota, owner)
 	}
 
 	// Validate input
 	if username == "" {
-		return fmt.Errorf("username cannot be empty")
+		return nil, fmt.Errorf("username cannot be empty")
 	}
 	if len(password) < 4 {
-		return fmt.Errorf("password must be at least 4 characters long")
+		return nil, fmt.Errorf("password must be at least 4 characters long")
 	}
 
 	// Hash password
 	hash, err := db.hashPassword(password)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %v", err)
+		return nil, fmt.Errorf("failed to hash password: %v", err)
 	}
 
-	// Create user
-	user := &User{
+	return &User{
 		Username:     username,
 		PasswordHash: hash,
 		CreatedAt:    time.Now(),
 		Enabled:      true,
-	}
-
-	db.users[username] = user
-
-	// Save to file
-	if err := db.saveToFile(); err != nil {
-		// Rollback
-		delete(db.users, username)
-		return fmt.Errorf("failed to save user database: %v", err)
-	}
-	return nil
+		Owner:        owner,
+	}, nil
 }
 
 // RemoveUser deletes a user account.
 func (db *UserDB) RemoveUser(username string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
+	db.refreshLocked(username)
 
 	if _, exists := db.users[username]; !exists {
 		return fmt.Errorf("user '%s' does not exist", username)
@@ -122,7 +173,7 @@ func (db *UserDB) RemoveUser(username string) error {
 	delete(db.users, username)
 
 	// Save to file
-	if err := db.saveToFile(); err != nil {
+	if err := db.saveLocked(username); err != nil {
 		return fmt.Errorf("failed to save user database: %v", err)
 	}
 	return nil
@@ -132,12 +183,26 @@ func (db *UserDB) RemoveUser(username string) error {
 func (db *UserDB) UpdatePassword(username, newPassword string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
+	db.refreshLocked(username)
 
 	user, exists := db.users[username]
 	if !exists {
 		return fmt.Errorf("user '%s' does not exist", username)
 	}
+	if err := db.setPasswordLocked(user, newPassword); err != nil {
+		return err
+	}
 
+	// Save to file
+	if err := db.saveLocked(username); err != nil {
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// setPasswordLocked validates newPassword and stores its hash in user. The caller must
+// hold the mutex and save the user.
+func (db *UserDB) setPasswordLocked(user *User, newPassword string) error {
 	if len(newPassword) < 4 {
 		return fmt.Errorf("password must be at least 4 characters long")
 	}
@@ -150,11 +215,6 @@ func (db *UserDB) UpdatePassword(username, newPassword string) error {
 
 	// Update user
 	user.PasswordHash = hash
-
-	// Save to file
-	if err := db.saveToFile(); err != nil {
-		return fmt.Errorf("failed to save user database: %v", err)
-	}
 	return nil
 }
 
@@ -162,6 +222,7 @@ func (db *UserDB) UpdatePassword(username, newPassword string) error {
 func (db *UserDB) EnableUser(username string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
+	db.refreshLocked(username)
 
 	user, exists := db.users[username]
 	if !exists {
@@ -171,7 +232,7 @@ func (db *UserDB) EnableUser(username string) error {
 	user.Enabled = true
 
 	// Save to file
-	if err := db.saveToFile(); err != nil {
+	if err := db.saveLocked(username); err != nil {
 		return fmt.Errorf("failed to save user database: %v", err)
 	}
 	return nil
@@ -181,6 +242,7 @@ func (db *UserDB) EnableUser(username string) error {
 func (db *UserDB) DisableUser(username string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
+	db.refreshLocked(username)
 
 	user, exists := db.users[username]
 	if !exists {
@@ -190,31 +252,242 @@ func (db *UserDB) DisableUser(username string) error {
 	user.Enabled = false
 
 	// Save to file
-	if err := db.saveToFile(); err != nil {
+	if err := db.saveLocked(username); err != nil {
 		return fmt.Errorf("failed to save user database: %v", err)
 	}
 	return nil
 }
 
+// SetSchedule sets or clears (nil) the login schedule of a user.
+func (db *UserDB) SetSchedule(username string, schedule *Schedule) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	user, exists := db.users[username]
+	if !exists {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+
+	if schedule != nil {
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	user.Schedule = schedule
+
+	// Save to file
+	if err := db.saveLocked(username); err != nil {
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// SetNotes replaces the free-form notes of a user.
+func (db *UserDB) SetNotes(username, notes string) error {
+	return db.updateUser(username, func(user *User) { user.Notes = notes })
+}
+
+// SetContact replaces the contact information of a user.
+func (db *UserDB) SetContact(username, contact string) error {
+	return db.updateUser(username, func(user *User) { user.Contact = contact })
+}
+
+// SetOwner replaces the owner of a user.
+func (db *UserDB) SetOwner(username, owner string) error {
+	return db.updateUser(username, func(user *User) { user.Owner = owner })
+}
+
+// AddClientCert maps a TLS client certificate identity (see NormalizeCertIdentity) to a user.
+// An identity can belong to only one user.
+func (db *UserDB) AddClientCert(username, identity string) error {
+	identity, err := NormalizeCertIdentity(identity)
+	if err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshAllLocked()
+
+	user, exists := db.users[username]
+	if !exists {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+	for name, other := range db.users {
+		if slices.Contains(other.ClientCerts, identity) {
+			return fmt.Errorf("client certificate %s is already mapped to user '%s'", identity, name)
+		}
+	}
+
+	user.ClientCerts = append(user.ClientCerts, identity)
+
+	// Save to file
+	if err := db.saveLocked(username); err != nil {
+		user.ClientCerts = user.ClientCerts[:len(user.ClientCerts)-1]
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// RemoveClientCert removes a TLS client certificate identity from a user.
+func (db *UserDB) RemoveClientCert(username, identity string) error {
+	identity, err := NormalizeCertIdentity(identity)
+	if err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	user, exists := db.users[username]
+	if !exists {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+	i := slices.Index(user.ClientCerts, identity)
+	if i < 0 {
+		return fmt.Errorf("client certificate %s is not mapped to user '%s'", identity, username)
+	}
+
+	user.ClientCerts = slices.Delete(user.ClientCerts, i, i+1)
+
+	// Save to file
+	if err := db.saveLocked(username); err != nil {
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// updateUser applies update to an existing user and saves the database.
+func (db *UserDB) updateUser(username string, update func(user *User)) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	user, exists := db.users[username]
+	if !exists {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+
+	update(user)
+
+	// Save to file
+	if err := db.saveLocked(username); err != nil {
+		return fmt.Errorf("failed to save user database: %v", err)
+	}
+	return nil
+}
+
+// LoginAllowed reports whether the user exists, is enabled, unlocked and unexpired, and is
+// inside their login schedule or that of their plan.
+func (db *UserDB) LoginAllowed(username string) bool {
+	db.refresh(username)
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	user, exists := db.users[username]
+	return exists && db.loginAllowedLocked(user)
+}
+
+// loginAllowedLocked reports whether user is enabled, not locked, not expired and inside
+// their login schedule now. Users without a schedule of their own follow that of their
+// plan, and users whose plan is not defined are refused. The caller must hold the mutex.
+func (db *UserDB) loginAllowedLocked(user *User) bool {
+	now := db.clock.Now()
+	if !user.Enabled || user.Lock.Active(now) || user.Expired(now) {
+		return false
+	}
+	schedule := user.Schedule
+	if user.Plan != "" {
+		plan := SharedPlans()[user.Plan]
+		if plan == nil {
+			log.Printf("User '%s' is assigned to undefined plan '%s', refusing login", user.Username, user.Plan)
+			return false
+		}
+		if schedule == nil {
+			schedule = plan.Schedule
+		}
+	}
+	return schedule.Allows(now)
+}
+
 // Authenticate verifies user credentials.
 func (db *UserDB) Authenticate(username, password string) bool {
+	db.refresh(username)
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
+	// Reject logins outside the user's schedule before checking the password.
 	user, exists := db.users[username]
-	if !exists || !user.Enabled {
+	if !exists || !db.loginAllowedLocked(user) {
 		return false
 	}
 
 	if db.verifyPassword(password, user.PasswordHash) {
+		if WeakPasswordHash(user.PasswordHash) {
+			// Rehash with the hardened cost once the read lock is released.
+			go db.rehashPassword(username, password, user.PasswordHash)
+		}
 		return true
 	}
 
 	return false
 }
 
+// rehashPassword replaces the password hash of username, if it is still hash, with a
+// hash of password at the current cost. The user is read again first, and the rehash
+// skipped if that fails, so that a login never saves a stale copy over changes made by
+// another process.
+func (db *UserDB) rehashPassword(username, password, hash string) {
+	// Hash before locking, as costly hashes would hold up other logins.
+	newHash, err := db.hashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of user '%s': %v", username, err)
+		return
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.shared == nil {
+		if err := db.reloadFileLocked(); err != nil {
+			log.Printf("Not rehashing password of user '%s': %v", username, err)
+			return
+		}
+	} else {
+		db.refreshLocked(username)
+	}
+	user, exists := db.users[username]
+	if !exists || user.PasswordHash != hash {
+		return
+	}
+	user.PasswordHash = newHash
+	if err := db.saveLocked(username); err != nil {
+		log.Printf("Failed to save rehashed password of user '%s': %v", username, err)
+	}
+}
+
+// AuthenticateClientCert reports whether any of the given client certificate identities
+// is mapped to the user and the user may log in now.
+func (db *UserDB) AuthenticateClientCert(username string, identities []string) bool {
+	db.refresh(username)
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	user, exists := db.users[username]
+	if !exists || !db.loginAllowedLocked(user) {
+		return false
+	}
+	for _, identity := range identities {
+		if slices.Contains(user.ClientCerts, identity) {
+			return true
+		}
+	}
+	return false
+}
+
 // ListUsers returns a list of all usernames.
 func (db *UserDB) ListUsers() []string {
+	db.refreshAll()
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
@@ -225,8 +498,35 @@ func (db *UserDB) ListUsers() []string {
 	return users
 }
 
+// ListUsersByOwner returns the usernames of all users owned by owner.
+func (db *UserDB) ListUsersByOwner(owner string) []string {
+	db.refreshAll()
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	users := make([]string, 0)
+	for username, user := range db.users {
+		if user.Owner == owner {
+			users = append(users, username)
+		}
+	}
+	return users
+}
+
+// countOwnedLocked returns the number of users owned by owner. The caller must hold the mutex.
+func (db *UserDB) countOwnedLocked(owner string) int {
+	count := 0
+	for _, user := range db.users {
+		if user.Owner == owner {
+			count++
+		}
+	}
+	return count
+}
+
 // GetUserInfo returns user information (without password hash).
 func (db *UserDB) GetUserInfo(username string) (*User, error) {
+	db.refresh(username)
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
@@ -237,12 +537,169 @@ func (db *UserDB) GetUserInfo(username string) (*User, error) {
 
 	// Return a copy without the password hash for security
 	return &User{
-		Username:  user.Username,
-		CreatedAt: user.CreatedAt,
-		Enabled:   user.Enabled,
+		Username:    user.Username,
+		CreatedAt:   user.CreatedAt,
+		Enabled:     user.Enabled,
+		Schedule:    user.Schedule,
+		Plan:        user.Plan,
+		Expires:     user.Expires,
+		Notes:       user.Notes,
+		Contact:     user.Contact,
+		Owner:       user.Owner,
+		ClientCerts: slices.Clone(user.ClientCerts),
+		Lock:        user.Lock,
 	}, nil
 }
 
+// saveLocked persists the current state of username (deleting it if it no longer
+// exists) to the cluster backend, or to the file on disk. The caller must hold the mutex.
+func (db *UserDB) saveLocked(username string) error {
+	if db.shared == nil {
+		return db.saveRecordLocked(username, false)
+	}
+	user, exists := db.users[username]
+	if !exists {
+		return db.shared.HDel(cluster.Key("users"), username)
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return db.shared.HSet(cluster.Key("users"), username, string(data))
+}
+
+// insertLocked persists a newly created user. In cluster mode it fails if another node
+// created the same user concurrently. The caller must hold the mutex.
+func (db *UserDB) insertLocked(username string) error {
+	if db.shared == nil {
+		return db.saveRecordLocked(username, true)
+	}
+	data, err := json.Marshal(db.users[username])
+	if err != nil {
+		return err
+	}
+	created, err := db.shared.HSetNX(cluster.Key("users"), username, string(data))
+	if err == nil && !created {
+		err = fmt.Errorf("user '%s' was created concurrently on another node", username)
+	}
+	return err
+}
+
+// saveRecordLocked writes the current state of username (deleting it if it no longer
+// exists) to the file on disk, keeping the other records as they are there rather than
+// as they are cached, so that changes made by other processes, such as the command
+// line, are not undone. With insert, it fails if the file already has the user. The
+// caller must hold the mutex.
+func (db *UserDB) saveRecordLocked(username string, insert bool) error {
+	users, err := readUsersFile(db.filePath)
+	if err != nil {
+		return err
+	}
+	user, exists := db.users[username]
+	if _, onDisk := users[username]; insert && onDisk {
+		return fmt.Errorf("user '%s' was created concurrently by another process", username)
+	}
+	if exists {
+		users[username] = user
+	} else {
+		delete(users, username)
+	}
+	db.users = users
+	return db.saveToFile()
+}
+
+// refresh reloads username from the cluster backend, or the file on disk if another
+// process changed it, so that changes made elsewhere are seen. The backend is queried
+// without holding the mutex, so that a slow round trip only delays this caller.
+func (db *UserDB) refresh(username string) {
+	if db.shared == nil {
+		db.mutex.Lock()
+		defer db.mutex.Unlock()
+		db.refreshLocked(username)
+		return
+	}
+	user, err := db.fetchUser(username)
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.storeFetchedLocked(username, user, err)
+}
+
+// refreshLocked is refresh for callers holding the mutex. Backend and file errors are
+// logged and leave the cached user in place.
+func (db *UserDB) refreshLocked(username string) {
+	if db.shared == nil {
+		if err := db.reloadFileLocked(); err != nil {
+			log.Printf("Failed to reload user database: %v", err)
+		}
+		return
+	}
+	user, err := db.fetchUser(username)
+	db.storeFetchedLocked(username, user, err)
+}
+
+// fetchUser reads username from the cluster backend. It returns a nil user if the
+// backend has none.
+func (db *UserDB) fetchUser(username string) (*User, error) {
+	data, err := db.shared.HGet(cluster.Key("users"), username)
+	if errors.Is(err, redis.ErrNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := &User{}
+	if err := json.Unmarshal([]byte(data), user); err != nil {
+		return nil, fmt.Errorf("invalid record: %v", err)
+	}
+	return user, nil
+}
+
+// storeFetchedLocked caches the result of fetchUser for username. Errors are logged and
+// leave the cached user in place. The caller must hold the mutex.
+func (db *UserDB) storeFetchedLocked(username string, user *User, err error) {
+	switch {
+	case err != nil:
+		log.Printf("Failed to load user '%s' from cluster backend: %v", username, err)
+	case user == nil:
+		delete(db.users, username)
+	default:
+		db.users[username] = user
+	}
+}
+
+// refreshAll reloads every user from the cluster backend, or the file on disk if
+// another process changed it.
+func (db *UserDB) refreshAll() {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshAllLocked()
+}
+
+// refreshAllLocked is refreshAll for callers holding the mutex.
+func (db *UserDB) refreshAllLocked() {
+	if db.shared == nil {
+		if err := db.reloadFileLocked(); err != nil {
+			log.Printf("Failed to reload user database: %v", err)
+		}
+		return
+	}
+	fields, err := db.shared.HGetAll(cluster.Key("users"))
+	if err != nil {
+		log.Printf("Failed to load users from cluster backend: %v", err)
+		return
+	}
+	users := make(map[string]*User, len(fields))
+	for username, data := range fields {
+		user := &User{}
+		if err := json.Unmarshal([]byte(data), user); err != nil {
+			log.Printf("Failed to parse user '%s' from cluster backend: %v", username, err)
+			continue
+		}
+		users[username] = user
+	}
+	db.users = users
+}
+
 // saveToFile saves the user database to disk.
 func (db *UserDB) saveToFile() error {
 	data, err := json.MarshalIndent(db.users, "", "  ")
@@ -261,36 +718,158 @@ func (db *UserDB) saveToFile() error {
 		return err
 	}
 
+	db.loaded, _ = os.Stat(db.filePath)
 	return nil
 }
 
 // loadFromFile loads the user database from disk.
 func (db *UserDB) loadFromFile() error {
-	file, err := os.Open(db.filePath)
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.reloadFileLocked()
+}
+
+// reloadFileLocked reads the user database from disk again if it changed since it was
+// last read or written. The caller must hold the mutex.
+func (db *UserDB) reloadFileLocked() error {
+	info, err := os.Stat(db.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info != nil && db.loaded != nil && info.ModTime().Equal(db.loaded.ModTime()) && info.Size() == db.loaded.Size() {
+		return nil
+	}
+	users, err := readUsersFile(db.filePath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// File doesn't exist yet, start with empty database
-			return nil
-		}
 		return err
 	}
-	defer file.Close()
+	db.users, db.loaded = users, info
+	return nil
+}
 
-	data, err := io.ReadAll(file)
+// readUsersFile reads a user database file. A missing or empty file has no users.
+func readUsersFile(path string) (map[string]*User, error) {
+	users := make(map[string]*User)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &users); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+	return users, nil
+}
+
+// loadTable reads the table name, JSON records kept by key alongside the users: in the
+// cluster backend, or in name.json next to the user database.
+func loadTable[T any](db *UserDB, name string) (map[string]*T, error) {
+	table := make(map[string]*T)
+	if db.shared != nil {
+		fields, err := db.shared.HGetAll(cluster.Key(name))
+		if err != nil {
+			return nil, err
+		}
+		for key, data := range fields {
+			entry := new(T)
+			if err := json.Unmarshal([]byte(data), entry); err != nil {
+				return nil, fmt.Errorf("failed to parse %s entry '%s': %v", name, key, err)
+			}
+			table[key] = entry
+		}
+		return table, nil
+	}
+
+	path := db.tablePath(name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return table, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &table); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+	return table, nil
+}
 
-	if len(data) == 0 {
-		// Empty file, start with empty database
+// saveTable persists the entries of table at keys, deleting those table no longer has.
+// Without a cluster backend the file is read again and only the entries at keys are
+// replaced, so that entries changed by other processes, such as tokens created on the
+// command line, are kept.
+func saveTable[T any](db *UserDB, name string, table map[string]*T, keys ...string) error {
+	if db.shared != nil {
+		for _, key := range keys {
+			entry, exists := table[key]
+			if !exists {
+				if err := db.shared.HDel(cluster.Key(name), key); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := db.shared.HSet(cluster.Key(name), key, string(data)); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
-	return json.Unmarshal(data, &db.users)
+	onDisk, err := loadTable[T](db, name)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if entry, exists := table[key]; exists {
+			onDisk[key] = entry
+		} else {
+			delete(onDisk, key)
+		}
+	}
+	data, err := json.MarshalIndent(onDisk, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempFile := db.tablePath(name) + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, db.tablePath(name)); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
+
+// tablePath returns the file the table name is kept in without a cluster backend.
+func (db *UserDB) tablePath(name string) string {
+	return filepath.Join(filepath.Dir(db.filePath), name+".json")
 }
 
-// BackupDB creates a backup of the user database.
+// BackupDB creates a backup of the user database. In cluster mode the users are
+// exported from the backend in the users.json format.
 func (db *UserDB) BackupDB(backupPath string) error {
+	if db.shared != nil {
+		db.refreshAll()
+		db.mutex.RLock()
+		defer db.mutex.RUnlock()
+		data, err := json.MarshalIndent(db.users, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(backupPath, data, 0600)
+	}
+
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
@@ -309,3 +888,51 @@ func (db *UserDB) BackupDB(backupPath string) error {
 	_, err = io.Copy(destFile, sourceFile)
 	return err
 }
+
+// ReadBackup reads a backup written by BackupDB and checks that it is well-formed.
+func ReadBackup(backupPath string) (map[string]*User, error) {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]*User)
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", backupPath, err)
+	}
+	for username, user := range users {
+		if user == nil || user.Username != username {
+			return nil, fmt.Errorf("invalid backup %s: record of user '%s' is missing or names another user", backupPath, username)
+		}
+	}
+	return users, nil
+}
+
+// RestoreDB replaces all users with those of a backup read with ReadBackup.
+func (db *UserDB) RestoreDB(users map[string]*User) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshAllLocked()
+
+	previous := db.users
+	db.users = users
+	if db.shared == nil {
+		if err := db.saveToFile(); err != nil {
+			db.users = previous
+			return fmt.Errorf("failed to save user database: %v", err)
+		}
+		return nil
+	}
+	for username := range previous {
+		if _, kept := users[username]; !kept {
+			if err := db.saveLocked(username); err != nil {
+				return fmt.Errorf("failed to save user database: %v", err)
+			}
+		}
+	}
+	for username := range users {
+		if err := db.saveLocked(username); err != nil {
+			return fmt.Errorf("failed to save user database: %v", err)
+		}
+	}
+	return nil
+}
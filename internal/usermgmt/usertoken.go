@@ -0,0 +1,122 @@
+package usermgmt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+)
+
+// UserTokenPrefix starts every user token so that leaked tokens are easy to recognize.
+const UserTokenPrefix = "sfu_"
+
+// userTokenTable is the table user tokens are kept in, by token hash.
+const userTokenTable = "user-tokens"
+
+// UserTokenTTL is how long a user stays signed in to the self-service portal. It is read
+// from SSH_IFY_USER_TOKEN_TTL.
+var UserTokenTTL = config.EnvDuration("SSH_IFY_USER_TOKEN_TTL", 12*time.Hour)
+
+// ErrInvalidUserToken is returned for user tokens that are unknown, revoked or expired.
+var ErrInvalidUserToken = errors.New("invalid or expired user token")
+
+// UserToken is a user's sign-in to the self-service portal. Unlike admin tokens it only
+// grants access to the user's own account.
+type UserToken struct {
+	Username string    `json:"username"`
+	Expires  time.Time `json:"expires"`
+}
+
+// generateToken returns a random token starting with prefix.
+func generateToken(prefix string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return prefix + hex.EncodeToString(secret), nil
+}
+
+// CreateUserToken generates a token for a user that is valid until ttl has passed, and
+// returns it with its expiry. Only its hash is stored.
+func (db *UserDB) CreateUserToken(username string, ttl time.Duration) (string, time.Time, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.refreshLocked(username)
+
+	if _, exists := db.users[username]; !exists {
+		return "", time.Time{}, fmt.Errorf("user '%s' does not exist", username)
+	}
+	tokens, err := loadTable[UserToken](db, userTokenTable)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to load user tokens: %v", err)
+	}
+	token, err := generateToken(UserTokenPrefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Drop expired tokens while the table is being rewritten anyway.
+	now := db.clock.Now()
+	var changed []string
+	for hash, entry := range tokens {
+		if !now.Before(entry.Expires) {
+			delete(tokens, hash)
+			changed = append(changed, hash)
+		}
+	}
+	hash := hashToken(token)
+	expires := now.Add(ttl)
+	tokens[hash] = &UserToken{Username: username, Expires: expires}
+	if err := saveTable(db, userTokenTable, tokens, append(changed, hash)...); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to save user tokens: %v", err)
+	}
+	return token, expires, nil
+}
+
+// AuthenticateUserToken returns the name of the user owning token. Tokens of users that
+// were removed are invalid.
+func (db *UserDB) AuthenticateUserToken(token string) (string, error) {
+	if !strings.HasPrefix(token, UserTokenPrefix) {
+		return "", ErrInvalidUserToken
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	tokens, err := loadTable[UserToken](db, userTokenTable)
+	if err != nil {
+		return "", fmt.Errorf("failed to load user tokens: %v", err)
+	}
+	entry, exists := tokens[hashToken(token)]
+	if !exists || !db.clock.Now().Before(entry.Expires) {
+		return "", ErrInvalidUserToken
+	}
+	db.refreshLocked(entry.Username)
+	if _, exists := db.users[entry.Username]; !exists {
+		return "", ErrInvalidUserToken
+	}
+	return entry.Username, nil
+}
+
+// RevokeUserToken invalidates a user token. Unknown tokens are ignored.
+func (db *UserDB) RevokeUserToken(token string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	tokens, err := loadTable[UserToken](db, userTokenTable)
+	if err != nil {
+		return fmt.Errorf("failed to load user tokens: %v", err)
+	}
+	hash := hashToken(token)
+	if _, exists := tokens[hash]; !exists {
+		return nil
+	}
+	delete(tokens, hash)
+	if err := saveTable(db, userTokenTable, tokens, hash); err != nil {
+		return fmt.Errorf("failed to save user tokens: %v", err)
+	}
+	return nil
+}
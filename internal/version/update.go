@@ -0,0 +1,395 @@
+package version
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants
+const (
+	// ReleasesURL is the GitHub API endpoint for the latest ssh-ify release.
+	ReleasesURL = "https://api.github.com/repos/ayanrajpoot10/ssh-ify/releases/latest"
+
+	// UpdateTimeout bounds each HTTP request made by the update check and self-update.
+	UpdateTimeout = 60 * time.Second
+
+	// ChecksumsAsset is the release asset listing the SHA-256 of the other assets, in the
+	// format of sha256sum. Releases without it are not installed.
+	ChecksumsAsset = "SHA256SUMS"
+
+	// maxChecksumsSize caps the size of ChecksumsAsset.
+	maxChecksumsSize = 1 << 20
+)
+
+// Release describes a published GitHub release.
+type Release struct {
+	TagName string  `json:"tag_name"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a downloadable file attached to a release.
+type Asset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+// LatestRelease queries GitHub for the most recent release.
+func LatestRelease() (*Release, error) {
+	client := &http.Client{Timeout: UpdateTimeout}
+	req, err := http.NewRequest(http.MethodGet, ReleasesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "ssh-ify/"+Version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query releases: %s", resp.Status)
+	}
+
+	var release Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to decode release: %v", err)
+	}
+	return &release, nil
+}
+
+// IsNewer reports whether the release is a later version than the running one, comparing
+// them as semantic versions so that an older release is never installed over a newer
+// build. Development builds, whose version is not one, are always considered out of
+// date; releases whose tag is not one are never considered newer.
+func (r *Release) IsNewer() bool {
+	release, ok := parseVersion(r.TagName)
+	if !ok {
+		return false
+	}
+	running, ok := parseVersion(Version)
+	if !ok {
+		return true
+	}
+	return compareVersions(release, running) > 0
+}
+
+// semver is a parsed semantic version.
+type semver struct {
+	core       [3]int
+	prerelease []string // Dot-separated identifiers after "-"; nil for a release
+}
+
+// parseVersion parses a version like "v1.2.3" or "1.2.3-rc.1+build", reporting whether
+// it is one. Build metadata is ignored.
+func parseVersion(text string) (semver, bool) {
+	var v semver
+	text, _, _ = strings.Cut(strings.TrimPrefix(text, "v"), "+")
+	text, pre, hasPre := strings.Cut(text, "-")
+	parts := strings.Split(text, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		if pre == "" {
+			return v, false
+		}
+		v.prerelease = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+// compareVersions returns -1, 0 or +1 as a is lower than, equal to or higher than b, by
+// semantic versioning precedence.
+func compareVersions(a, b semver) int {
+	for i := range a.core {
+		if c := cmp.Compare(a.core[i], b.core[i]); c != 0 {
+			return c
+		}
+	}
+	// A pre-release is lower than the release it precedes.
+	switch {
+	case a.prerelease == nil && b.prerelease == nil:
+		return 0
+	case a.prerelease == nil:
+		return 1
+	case b.prerelease == nil:
+		return -1
+	}
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		x, xErr := strconv.Atoi(a.prerelease[i])
+		y, yErr := strconv.Atoi(b.prerelease[i])
+		var c int
+		switch {
+		case xErr == nil && yErr == nil:
+			c = cmp.Compare(x, y)
+		case xErr == nil:
+			c = -1 // Numeric identifiers are lower than alphanumeric ones
+		case yErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(a.prerelease[i], b.prerelease[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a.prerelease), len(b.prerelease))
+}
+
+// PlatformAsset returns the release asset built for the current OS and architecture.
+// Assets are named "ssh-ify_<os>_<arch>", optionally with the version without its "v"
+// after "ssh-ify_", and are either a .tar.gz archive (.zip on Windows) holding the
+// executable or the executable itself (with .exe on Windows).
+func (r *Release) PlatformAsset() (*Asset, error) {
+	archive, binary := ".tar.gz", ""
+	if runtime.GOOS == "windows" {
+		archive, binary = ".zip", ".exe"
+	}
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	prefixes := []string{"ssh-ify_" + platform, "ssh-ify_" + strings.TrimPrefix(r.TagName, "v") + "_" + platform}
+	for _, suffix := range []string{archive, binary} {
+		for _, prefix := range prefixes {
+			for i := range r.Assets {
+				if r.Assets[i].Name == prefix+suffix {
+					return &r.Assets[i], nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("release %s has no asset for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+}
+
+// checksum returns the SHA-256 that the release's ChecksumsAsset lists for asset.
+func (r *Release) checksum(client *http.Client, asset *Asset) ([]byte, error) {
+	var sums *Asset
+	for i := range r.Assets {
+		if r.Assets[i].Name == ChecksumsAsset {
+			sums = &r.Assets[i]
+		}
+	}
+	if sums == nil {
+		return nil, fmt.Errorf("release %s has no %s to verify %s with", r.TagName, ChecksumsAsset, asset.Name)
+	}
+	resp, err := client.Get(sums.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", ChecksumsAsset, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", ChecksumsAsset, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumsSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", ChecksumsAsset, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != asset.Name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid checksum of %s in %s", asset.Name, ChecksumsAsset)
+		}
+		return sum, nil
+	}
+	return nil, fmt.Errorf("%s does not list %s", ChecksumsAsset, asset.Name)
+}
+
+// verifyFile checks that the file at path has the SHA-256 sum.
+func verifyFile(path string, sum []byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), sum) {
+		return fmt.Errorf("checksum mismatch: got %x, want %x", hash.Sum(nil), sum)
+	}
+	return nil
+}
+
+// executableName is the name of the executable in release archives.
+func executableName() string {
+	if runtime.GOOS == "windows" {
+		return "ssh-ify.exe"
+	}
+	return "ssh-ify"
+}
+
+// download saves the asset to a new temporary file in dir and returns its path.
+func download(client *http.Client, asset *Asset, dir string) (string, error) {
+	resp, err := client.Get(asset.DownloadURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %v", asset.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", asset.Name, resp.Status)
+	}
+	file, err := os.CreateTemp(dir, ".ssh-ify-download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to download %s: %v", asset.Name, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to download %s: %v", asset.Name, err)
+	}
+	return file.Name(), nil
+}
+
+// extractExecutable copies the executable from the downloaded asset at path, unpacking
+// it from .tar.gz and .zip archives, to dst.
+func extractExecutable(asset *Asset, path string, dst io.Writer) error {
+	switch {
+	case strings.HasSuffix(asset.Name, ".tar.gz"):
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", asset.Name, err)
+		}
+		archive := tar.NewReader(gz)
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %v", asset.Name, err)
+			}
+			if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == executableName() {
+				_, err := io.Copy(dst, archive)
+				return err
+			}
+		}
+	case strings.HasSuffix(asset.Name, ".zip"):
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", asset.Name, err)
+		}
+		defer archive.Close()
+		for _, entry := range archive.File {
+			if entry.Mode().IsRegular() && filepath.Base(entry.Name) == executableName() {
+				src, err := entry.Open()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %v", asset.Name, err)
+				}
+				defer src.Close()
+				_, err = io.Copy(dst, src)
+				return err
+			}
+		}
+	default:
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(dst, file)
+		return err
+	}
+	return fmt.Errorf("%s does not contain %s", asset.Name, executableName())
+}
+
+// SelfUpdate downloads the release asset for the current platform, verifies it against
+// the release's ChecksumsAsset and replaces the running executable with the executable
+// it holds.
+func SelfUpdate(r *Release) error {
+	asset, err := r.PlatformAsset()
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to resolve executable: %v", err)
+	}
+
+	client := &http.Client{Timeout: UpdateTimeout}
+	sum, err := r.checksum(client, asset)
+	if err != nil {
+		return err
+	}
+	downloaded, err := download(client, asset, filepath.Dir(exe))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(downloaded)
+	if err := verifyFile(downloaded, sum); err != nil {
+		return fmt.Errorf("refusing to install %s: %v", asset.Name, err)
+	}
+
+	// Write next to the executable so the final rename stays on one filesystem.
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".ssh-ify-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := extractExecutable(asset, downloaded, tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write update: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write update: %v", err)
+	}
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		return fmt.Errorf("failed to mark update executable: %v", err)
+	}
+
+	// Move the old binary aside first; Windows refuses to overwrite a running executable.
+	oldPath := exe + ".old"
+	os.Remove(oldPath)
+	if err := os.Rename(exe, oldPath); err != nil {
+		return fmt.Errorf("failed to move current executable: %v", err)
+	}
+	if err := os.Rename(tmpPath, exe); err != nil {
+		// Rollback
+		os.Rename(oldPath, exe)
+		return fmt.Errorf("failed to install update: %v", err)
+	}
+	os.Remove(oldPath)
+	return nil
+}
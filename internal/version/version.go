@@ -0,0 +1,52 @@
+// Package version exposes build information for ssh-ify and checks for newer releases.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, overridden at build time via ldflags, e.g.:
+//
+//	go build -ldflags "-X github.com/ayanrajpoot10/ssh-ify/internal/version.Version=v1.2.0 \
+//	  -X github.com/ayanrajpoot10/ssh-ify/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/ayanrajpoot10/ssh-ify/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	// Version is the release version of the binary.
+	Version = "dev"
+
+	// Commit is the git commit the binary was built from.
+	Commit = ""
+
+	// BuildDate is the UTC time the binary was built.
+	BuildDate = ""
+)
+
+// Info returns a multi-line, human readable description of the build.
+func Info() string {
+	commit, date := Commit, BuildDate
+	// Fall back to the VCS information recorded by the Go toolchain.
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("ssh-ify %s\n  commit:     %s\n  built:      %s\n  go version: %s\n  platform:   %s/%s",
+		Version, commit, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,592 @@
+// Package yaml decodes the subset of YAML used by ssh-ify's hand-edited configuration
+// files: block mappings and sequences, one-line flow collections such as [a, b] and
+// {k: v}, plain, single- and double-quoted scalars, and comments. Anchors, tags,
+// multi-line scalars and multiple documents are not supported.
+//
+// Values are decoded into Go values like encoding/json does, using the json struct tags
+// of the target, so that one type describes both formats.
+package yaml
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Node kinds
+const (
+	scalarNode = iota
+	mappingNode
+	sequenceNode
+)
+
+// node is a parsed YAML value.
+type node struct {
+	kind   int
+	line   int
+	value  string   // Scalar text, unquoted
+	quoted bool     // The scalar was quoted, so it is never null
+	keys   []string // Mapping keys in order
+	values []*node  // Mapping values, parallel to keys, or sequence items
+}
+
+// isNull reports whether n is an empty value, ~ or null.
+func (n *node) isNull() bool {
+	return n.kind == scalarNode && !n.quoted && (n.value == "" || n.value == "~" || n.value == "null")
+}
+
+// Unmarshal parses data and stores the result in the value pointed to by v.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("yaml: Unmarshal needs a non-nil pointer, not %T", v)
+	}
+	n, err := parse(string(data))
+	if err != nil {
+		return err
+	}
+	return decode(n, rv.Elem())
+}
+
+// line is a non-blank line of a document with its comment removed.
+type line struct {
+	number int
+	indent int
+	text   string
+}
+
+// parser reads the block structure of a document.
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// parse parses a document into a node; an empty document is null.
+func parse(data string) (*node, error) {
+	p := &parser{}
+	for i, text := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		text = stripComment(text)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot be used for indentation", i+1)
+		}
+		if (trimmed == "---" || trimmed == "...") && len(trimmed) == len(text) {
+			continue
+		}
+		p.lines = append(p.lines, line{number: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if len(p.lines) == 0 {
+		return &node{kind: scalarNode, line: 1}, nil
+	}
+	n, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return n, nil
+}
+
+// stripComment removes a comment from text: a # at the start of the line or after a
+// space, outside quotes.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '\'' && c == '\'':
+			if i+1 < len(text) && text[i+1] == '\'' {
+				i++
+				continue
+			}
+			quote = 0
+		case quote == '"' && c == '\\':
+			i++
+		case quote == '"' && c == '"':
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// block parses the mapping or sequence starting at the current line, whose entries are
+// indented by indent.
+func (p *parser) block(indent int) (*node, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+// isSequenceItem reports whether text starts a block sequence item.
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// sequence parses the items of a block sequence indented by indent.
+func (p *parser) sequence(indent int) (*node, error) {
+	seq := &node{kind: sequenceNode, line: p.lines[p.pos].number}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		var item *node
+		var err error
+		switch {
+		case rest == "":
+			p.pos++
+			item, err = p.nested(indent, l.number)
+		case isSequenceItem(rest) || isMappingEntry(rest):
+			// The item is a collection starting on the dash line: parse it as if its
+			// first entry were on a line of its own.
+			p.lines[p.pos] = line{number: l.number, indent: indent + len(l.text) - len(rest), text: rest}
+			item, err = p.block(p.lines[p.pos].indent)
+		default:
+			p.pos++
+			item, err = parseInline(rest, l.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq.values = append(seq.values, item)
+	}
+	return seq, nil
+}
+
+// mapping parses the entries of a block mapping indented by indent.
+func (p *parser) mapping(indent int) (*node, error) {
+	m := &node{kind: mappingNode, line: p.lines[p.pos].number}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		if isSequenceItem(l.text) {
+			return nil, fmt.Errorf("line %d: expected a mapping entry, found a sequence item", l.number)
+		}
+		key, rest, err := splitEntry(l.text, l.number)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(m.keys, key) {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.number, key)
+		}
+		p.pos++
+		var value *node
+		if rest == "" {
+			// A sequence may start at the indentation of its key.
+			if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+				value, err = p.sequence(indent)
+			} else {
+				value, err = p.nested(indent, l.number)
+			}
+		} else {
+			value, err = parseInline(rest, l.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+		m.values = append(m.values, value)
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return m, nil
+}
+
+// nested parses the block indented deeper than indent following the line numbered
+// number, or returns null if there is none.
+func (p *parser) nested(indent, number int) (*node, error) {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return p.block(p.lines[p.pos].indent)
+	}
+	return &node{kind: scalarNode, line: number}, nil
+}
+
+// isMappingEntry reports whether text is a "key: value" or "key:" block mapping entry.
+func isMappingEntry(text string) bool {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return false
+	}
+	_, _, err := splitEntry(text, 0)
+	return err == nil
+}
+
+// splitEntry splits a block mapping entry into its key and the text of its value.
+func splitEntry(text string, number int) (key, rest string, err error) {
+	s := &scanner{text: text, line: number}
+	if text[0] == '"' || text[0] == '\'' {
+		if key, err = s.quoted(); err != nil {
+			return "", "", err
+		}
+		s.skipSpaces()
+		if !s.consume(':') {
+			return "", "", fmt.Errorf("line %d: expected ':' after key", number)
+		}
+	} else {
+		i := 0
+		for ; i < len(text); i++ {
+			if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+				break
+			}
+		}
+		if i == len(text) {
+			return "", "", fmt.Errorf("line %d: expected \"key: value\"", number)
+		}
+		key, s.pos = strings.TrimSpace(text[:i]), i+1
+	}
+	rest = strings.TrimSpace(text[s.pos:])
+	if rest != "" && text[s.pos] != ' ' {
+		return "", "", fmt.Errorf("line %d: expected a space after ':'", number)
+	}
+	return key, rest, nil
+}
+
+// parseInline parses a value written on one line: a flow collection or a scalar.
+func parseInline(text string, number int) (*node, error) {
+	s := &scanner{text: text, line: number}
+	var n *node
+	var err error
+	switch text[0] {
+	case '[', '{', '"', '\'':
+		if n, err = s.flow(); err != nil {
+			return nil, err
+		}
+		s.skipSpaces()
+		if s.pos < len(text) {
+			return nil, fmt.Errorf("line %d: unexpected %q after value", number, text[s.pos:])
+		}
+	default:
+		if strings.ContainsAny(text[:1], "&*!|>%@`") {
+			return nil, fmt.Errorf("line %d: unsupported YAML syntax %q", number, text)
+		}
+		n = &node{kind: scalarNode, line: number, value: text}
+	}
+	return n, nil
+}
+
+// scanner reads flow collections and quoted scalars from one line.
+type scanner struct {
+	text string
+	pos  int
+	line int
+}
+
+func (s *scanner) skipSpaces() {
+	for s.pos < len(s.text) && s.text[s.pos] == ' ' {
+		s.pos++
+	}
+}
+
+// consume skips c if it is the next character.
+func (s *scanner) consume(c byte) bool {
+	if s.pos < len(s.text) && s.text[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// flow parses a flow collection, a quoted scalar or a plain scalar ending at a flow
+// indicator.
+func (s *scanner) flow() (*node, error) {
+	s.skipSpaces()
+	if s.pos == len(s.text) {
+		return nil, fmt.Errorf("line %d: unexpected end of line", s.line)
+	}
+	switch s.text[s.pos] {
+	case '[':
+		s.pos++
+		seq := &node{kind: sequenceNode, line: s.line}
+		err := s.items(']', func() error {
+			item, err := s.flow()
+			seq.values = append(seq.values, item)
+			return err
+		})
+		return seq, err
+	case '{':
+		s.pos++
+		m := &node{kind: mappingNode, line: s.line}
+		err := s.items('}', func() error {
+			key, err := s.flow()
+			if err != nil {
+				return err
+			}
+			if key.kind != scalarNode {
+				return fmt.Errorf("line %d: mapping keys must be scalars", s.line)
+			}
+			s.skipSpaces()
+			if !s.consume(':') {
+				return fmt.Errorf("line %d: expected ':' after key %q", s.line, key.value)
+			}
+			value, err := s.flow()
+			if err != nil {
+				return err
+			}
+			if slices.Contains(m.keys, key.value) {
+				return fmt.Errorf("line %d: duplicate key %q", s.line, key.value)
+			}
+			m.keys = append(m.keys, key.value)
+			m.values = append(m.values, value)
+			return nil
+		})
+		return m, err
+	case '"', '\'':
+		value, err := s.quoted()
+		return &node{kind: scalarNode, line: s.line, value: value, quoted: true}, err
+	}
+	start := s.pos
+	for s.pos < len(s.text) && !strings.ContainsRune(",[]{}", rune(s.text[s.pos])) &&
+		!(s.text[s.pos] == ':' && (s.pos+1 == len(s.text) || strings.ContainsRune(" ,]}", rune(s.text[s.pos+1])))) {
+		s.pos++
+	}
+	return &node{kind: scalarNode, line: s.line, value: strings.TrimSpace(s.text[start:s.pos])}, nil
+}
+
+// items parses the comma-separated entries of a flow collection up to its closing
+// character, calling entry for each.
+func (s *scanner) items(closing byte, entry func() error) error {
+	s.skipSpaces()
+	if s.consume(closing) {
+		return nil
+	}
+	for {
+		if err := entry(); err != nil {
+			return err
+		}
+		s.skipSpaces()
+		if s.consume(closing) {
+			return nil
+		}
+		if !s.consume(',') {
+			return fmt.Errorf("line %d: expected ',' or '%c'", s.line, closing)
+		}
+		s.skipSpaces()
+		if s.consume(closing) {
+			return nil
+		}
+	}
+}
+
+// quoted parses a single- or double-quoted scalar.
+func (s *scanner) quoted() (string, error) {
+	quote := s.text[s.pos]
+	s.pos++
+	var b strings.Builder
+	for s.pos < len(s.text) {
+		c := s.text[s.pos]
+		s.pos++
+		switch {
+		case c == quote && quote == '\'' && s.pos < len(s.text) && s.text[s.pos] == '\'':
+			b.WriteByte('\'')
+			s.pos++
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if s.pos == len(s.text) {
+				return "", fmt.Errorf("line %d: unterminated escape", s.line)
+			}
+			e := s.text[s.pos]
+			s.pos++
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"', '/':
+				b.WriteByte(e)
+			default:
+				return "", fmt.Errorf("line %d: unsupported escape \\%c", s.line, e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("line %d: unterminated quoted string", s.line)
+}
+
+// decode stores n in v, which must be settable.
+func decode(n *node, v reflect.Value) error {
+	if n.isNull() {
+		v.SetZero()
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decode(n, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			break
+		}
+		generic, err := toGeneric(n)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(generic))
+		return nil
+	case reflect.Struct:
+		if n.kind != mappingNode {
+			return typeError(n, "a mapping")
+		}
+		fields := structFields(v.Type())
+		for i, key := range n.keys {
+			index, ok := fields[key]
+			if !ok {
+				continue // Unknown keys are ignored, as by encoding/json.
+			}
+			if err := decode(n.values[i], v.Field(index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if n.kind != mappingNode {
+			return typeError(n, "a mapping")
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i, key := range n.keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decode(n.values[i], elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Slice:
+		if n.kind != sequenceNode {
+			return typeError(n, "a sequence")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(n.values), len(n.values))
+		for i, item := range n.values {
+			if err := decode(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.String:
+		if n.kind != scalarNode {
+			return typeError(n, "a string")
+		}
+		v.SetString(n.value)
+		return nil
+	case reflect.Bool:
+		if n.kind != scalarNode || n.value != "true" && n.value != "false" {
+			return typeError(n, "true or false")
+		}
+		v.SetBool(n.value == "true")
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(n.value, 10, v.Type().Bits())
+		if n.kind != scalarNode || err != nil {
+			return typeError(n, "an integer")
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(n.value, 10, v.Type().Bits())
+		if n.kind != scalarNode || err != nil {
+			return typeError(n, "a non-negative integer")
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(n.value, v.Type().Bits())
+		if n.kind != scalarNode || err != nil {
+			return typeError(n, "a number")
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("yaml: cannot decode into %s", v.Type())
+}
+
+// typeError reports that n is not the kind of value expected.
+func typeError(n *node, expected string) error {
+	found := "a mapping"
+	switch n.kind {
+	case scalarNode:
+		found = strconv.Quote(n.value)
+	case sequenceNode:
+		found = "a sequence"
+	}
+	return fmt.Errorf("line %d: expected %s, found %s", n.line, expected, found)
+}
+
+// structFields returns the indexes of the exported fields of t by their JSON name.
+func structFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+// toGeneric converts n to maps, slices, strings, integers, floats, booleans and nil,
+// as encoding/json does for interface values.
+func toGeneric(n *node) (any, error) {
+	switch n.kind {
+	case mappingNode:
+		m := make(map[string]any, len(n.keys))
+		for i, key := range n.keys {
+			value, err := toGeneric(n.values[i])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case sequenceNode:
+		items := make([]any, len(n.values))
+		for i, item := range n.values {
+			value, err := toGeneric(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	}
+	if n.quoted {
+		return n.value, nil
+	}
+	if n.isNull() {
+		return nil, nil
+	}
+	if n.value == "true" || n.value == "false" {
+		return n.value == "true", nil
+	}
+	if i, err := strconv.ParseInt(n.value, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(n.value, 64); err == nil {
+		return f, nil
+	}
+	return n.value, nil
+}
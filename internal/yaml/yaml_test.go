@@ -0,0 +1,115 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type rule struct {
+	Action string   `json:"action"`
+	Ports  []string `json:"ports,omitempty"`
+	Via    string   `json:"via,omitempty"`
+}
+
+type plan struct {
+	MaxSessions int       `json:"max_sessions,omitempty"`
+	MaxDuration string    `json:"max_duration,omitempty"`
+	Schedule    *schedule `json:"schedule,omitempty"`
+	Rules       []rule    `json:"rules,omitempty"`
+	Enabled     bool      `json:"enabled"`
+}
+
+type schedule struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	const doc = `
+# Plans
+basic:
+  max_sessions: 1
+  max_duration: 4h   # per session
+  schedule: {days: [mon, tue], start: "08:00", end: '20:00'}
+  rules:
+    - action: deny
+      ports: [25, "465", 587]
+    - {action: allow, via: exit-de}
+  enabled: true
+premium:
+  max_sessions: 4
+  rules:
+  - action: allow
+    ports:
+      - 1-1024
+free: ~
+`
+	var plans map[string]*plan
+	if err := Unmarshal([]byte(doc), &plans); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*plan{
+		"basic": {
+			MaxSessions: 1,
+			MaxDuration: "4h",
+			Schedule:    &schedule{Days: []string{"mon", "tue"}, Start: "08:00", End: "20:00"},
+			Rules:       []rule{{Action: "deny", Ports: []string{"25", "465", "587"}}, {Action: "allow", Via: "exit-de"}},
+			Enabled:     true,
+		},
+		"premium": {MaxSessions: 4, Rules: []rule{{Action: "allow", Ports: []string{"1-1024"}}}},
+		"free":    nil,
+	}
+	if !reflect.DeepEqual(plans, want) {
+		t.Errorf("plans = %+v, want %+v", plans, want)
+	}
+}
+
+func TestUnmarshalScalars(t *testing.T) {
+	var v map[string]any
+	doc := "s: 'it''s # not a comment'\nq: \"a\\tb\"\nn: -3\nf: 1.5\nb: false\nz: null\nurl: http://example.com:8080/x\n"
+	if err := Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"s": "it's # not a comment", "q": "a\tb", "n": int64(-3), "f": 1.5, "b": false, "z": nil,
+		"url": "http://example.com:8080/x",
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("values = %#v, want %#v", v, want)
+	}
+}
+
+func TestUnmarshalEmpty(t *testing.T) {
+	plans := map[string]*plan{"kept": nil}
+	if err := Unmarshal([]byte("# nothing here\n\n"), &plans); err != nil {
+		t.Fatal(err)
+	}
+	if plans != nil {
+		t.Errorf("empty document decoded to %v, want nil", plans)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct{ name, doc, err string }{
+		{"wrong type", "basic:\n  max_sessions: many\n", `line 2: expected an integer, found "many"`},
+		{"sequence for mapping", "basic:\n  schedule: [mon]\n", "line 2: expected a mapping, found a sequence"},
+		{"duplicate key", "a: 1\na: 2\n", `line 2: duplicate key "a"`},
+		{"bad indentation", "a:\n  b: 1\n    c: 2\n", "line 3: unexpected indentation"},
+		{"tab indentation", "a:\n\tb: 1\n", "line 2: tabs cannot be used for indentation"},
+		{"not an entry", "a: 1\njust text\n", "line 2: expected \"key: value\""},
+		{"unterminated quote", "a: \"open\n", "line 1: unterminated quoted string"},
+		{"unclosed flow", "a: [1, 2\n", "line 1: expected ',' or ']'"},
+		{"anchor", "a: &x 1\n", "line 1: unsupported YAML syntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plans map[string]plan
+			err := Unmarshal([]byte(tt.doc), &plans)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
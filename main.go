@@ -2,79 +2,658 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/ayanrajpoot10/ssh-ify/internal/accounting"
+	"github.com/ayanrajpoot10/ssh-ify/internal/clientconfig"
+	"github.com/ayanrajpoot10/ssh-ify/internal/config"
+	"github.com/ayanrajpoot10/ssh-ify/internal/doctor"
+	"github.com/ayanrajpoot10/ssh-ify/internal/i18n"
+	"github.com/ayanrajpoot10/ssh-ify/internal/ssh"
+	"github.com/ayanrajpoot10/ssh-ify/internal/top"
 	"github.com/ayanrajpoot10/ssh-ify/internal/tunnel"
 	"github.com/ayanrajpoot10/ssh-ify/internal/usermgmt"
+	"github.com/ayanrajpoot10/ssh-ify/internal/version"
 )
 
 // main is the application entry point. Parses CLI arguments to start server or run user management commands.
 func main() {
+	// Strip the global "--as <admin>" and "--lang <code>" options so commands see their
+	// usual arguments.
+	for len(os.Args) > 2 && (os.Args[1] == "--as" || os.Args[1] == "--lang") {
+		if os.Args[1] == "--as" {
+			asAdmin = os.Args[2]
+		} else if !i18n.SetLang(os.Args[2]) {
+			fmt.Fprintf(os.Stderr, "Unsupported language '%s', using English. Supported: %s\n", os.Args[2], strings.Join(i18n.Supported(), ", "))
+		}
+		os.Args = append([]string{os.Args[0]}, os.Args[3:]...)
+	}
+
 	// Check for command line arguments
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "user-mgmt", "users", "manage-users":
 			// Run user management CLI
-			um := usermgmt.NewManager("")
+			um := newManager()
 			um.RunUserManagementCLI()
 			return
 
 		case "add-user":
 			if len(os.Args) != 4 {
-				fmt.Println("Usage: ssh-ify add-user <username> <password>")
+				i18n.Println("Usage: ssh-ify add-user <username> <password>")
 				os.Exit(1)
 			}
-			um := usermgmt.NewManager("")
+			um := newManager()
 			if err := um.AddUserDirect(os.Args[2], os.Args[3]); err != nil {
-				fmt.Printf("Error adding user: %v\n", err)
+				i18n.Printf("Error adding user: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("User '%s' added successfully!\n", os.Args[2])
+			i18n.Printf("User '%s' added successfully!\n", os.Args[2])
 			return
 
 		case "remove-user":
+			args, flags := splitFlags(os.Args[2:], "--archive", "--yes")
+			if len(args) != 1 {
+				i18n.Println("Usage: ssh-ify remove-user <username> [--archive] [--yes]")
+				os.Exit(1)
+			}
+			um := newManager()
+			if flags["--archive"] {
+				confirmOrExit(flags["--yes"], i18n.Sprintf("Archive user '%s'?", args[0]))
+				if err := um.ArchiveUser(args[0]); err != nil {
+					i18n.Printf("Error archiving user: %v\n", err)
+					os.Exit(1)
+				}
+				i18n.Printf("User '%s' archived successfully!\n", args[0])
+				return
+			}
+			confirmOrExit(flags["--yes"], i18n.Sprintf("Permanently remove user '%s'?", args[0]))
+			if err := um.RemoveUser(args[0]); err != nil {
+				i18n.Printf("Error removing user: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("User '%s' removed successfully!\n", args[0])
+			return
+
+		case "list-archived":
+			if err := newManager().ListArchived(); err != nil {
+				i18n.Printf("Error listing archived users: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "unarchive-user":
 			if len(os.Args) != 3 {
-				fmt.Println("Usage: ssh-ify remove-user <username>")
+				i18n.Println("Usage: ssh-ify unarchive-user <username>")
+				os.Exit(1)
+			}
+			if err := newManager().UnarchiveUser(os.Args[2]); err != nil {
+				i18n.Printf("Error unarchiving user: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("User '%s' unarchived successfully!\n", os.Args[2])
+			return
+
+		case "purge-archived":
+			args, flags := splitFlags(os.Args[2:], "--yes")
+			if len(args) > 1 {
+				i18n.Println("Usage: ssh-ify purge-archived [username] [--yes]")
+				os.Exit(1)
+			}
+			um := newManager()
+			target, prompt := "", i18n.T("Permanently delete all archived users?")
+			if len(args) == 1 {
+				target, prompt = args[0], i18n.Sprintf("Permanently delete archived user '%s'?", args[0])
+			}
+			confirmOrExit(flags["--yes"], prompt)
+			n, err := um.PurgeArchived(target)
+			if err != nil {
+				i18n.Printf("Error purging archived users: %v\n", err)
 				os.Exit(1)
 			}
-			um := usermgmt.NewManager("")
-			if err := um.RemoveUser(os.Args[2]); err != nil {
-				fmt.Printf("Error removing user: %v\n", err)
+			i18n.Printf("%d archived users purged.\n", n)
+			return
+
+		case "restore-users":
+			args, flags := splitFlags(os.Args[2:], "--yes")
+			if len(args) != 1 {
+				i18n.Println("Usage: ssh-ify restore-users <backup-file> [--yes]")
+				os.Exit(1)
+			}
+			um := newManager()
+			users, err := usermgmt.ReadBackup(args[0])
+			if err != nil {
+				i18n.Printf("Error restoring users: %v\n", err)
+				os.Exit(1)
+			}
+			confirmOrExit(flags["--yes"], i18n.Sprintf("Replace all users with the %d users in '%s'?", len(users), args[0]))
+			if err := um.RestoreUsers(users); err != nil {
+				i18n.Printf("Error restoring users: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("User '%s' removed successfully!\n", os.Args[2])
+			i18n.Printf("%d users restored from '%s' successfully!\n", len(users), args[0])
 			return
 
 		case "list-users":
-			um := usermgmt.NewManager("")
-			um.ListUsers()
+			um := newManager()
+			if len(os.Args) == 4 && os.Args[2] == "--owner" {
+				um.ListUsersByOwner(os.Args[3])
+			} else {
+				um.ListUsers()
+			}
+			return
+
+		case "show-user":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify show-user <username>")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.ShowUser(os.Args[2]); err != nil {
+				i18n.Printf("Error showing user: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "set-info":
+			if len(os.Args) < 4 {
+				i18n.Println("Usage: ssh-ify set-info <username> <notes|contact|owner> [value]")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.SetUserInfo(os.Args[2], os.Args[3], strings.Join(os.Args[4:], " ")); err != nil {
+				i18n.Printf("Error updating user: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("User '%s' updated successfully!\n", os.Args[2])
 			return
 
 		case "enable-user":
 			if len(os.Args) != 3 {
-				fmt.Println("Usage: ssh-ify enable-user <username>")
+				i18n.Println("Usage: ssh-ify enable-user <username>")
 				os.Exit(1)
 			}
-			um := usermgmt.NewManager("")
+			um := newManager()
 			if err := um.EnableUser(os.Args[2]); err != nil {
-				fmt.Printf("Error enabling user: %v\n", err)
+				i18n.Printf("Error enabling user: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("User '%s' enabled successfully!\n", os.Args[2])
+			i18n.Printf("User '%s' enabled successfully!\n", os.Args[2])
 			return
 
 		case "disable-user":
 			if len(os.Args) != 3 {
-				fmt.Println("Usage: ssh-ify disable-user <username>")
+				i18n.Println("Usage: ssh-ify disable-user <username>")
 				os.Exit(1)
 			}
-			um := usermgmt.NewManager("")
+			um := newManager()
 			if err := um.DisableUser(os.Args[2]); err != nil {
-				fmt.Printf("Error disabling user: %v\n", err)
+				i18n.Printf("Error disabling user: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("User '%s' disabled successfully!\n", os.Args[2])
+			return
+
+		case "unlock-user":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify unlock-user <username>")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.UnlockUser(os.Args[2]); err != nil {
+				i18n.Printf("Error unlocking user: %v\n", err)
+				os.Exit(1)
+			}
+			// A running server keeps the failure count in memory.
+			if err := tunnel.UnlockUser(context.Background(), newAdminClient(), os.Args[2]); err != nil {
+				i18n.Printf("Note: running server not notified: %v\n", err)
+			}
+			i18n.Printf("User '%s' unlocked successfully!\n", os.Args[2])
+			return
+
+		case "reset-token":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify reset-token <username>")
+				os.Exit(1)
+			}
+			um := newManager()
+			token, expires, err := um.CreateResetToken(os.Args[2])
+			if err != nil {
+				i18n.Printf("Error creating reset token: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Reset token for user '%s' (shown only once, valid until %s):\n%s\n", os.Args[2], expires.Format("2006-01-02 15:04:05"), token)
+			return
+
+		case "create-invite":
+			if err := createInvite(os.Args[2:]); err != nil {
+				i18n.Printf("Error creating invite: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "list-invites":
+			if err := newManager().ListInvites(); err != nil {
+				i18n.Printf("Error listing invites: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "revoke-invites":
+			args, flags := splitFlags(os.Args[2:], "--yes")
+			if len(args) != 0 {
+				i18n.Println("Usage: ssh-ify revoke-invites [--yes]")
+				os.Exit(1)
+			}
+			um := newManager()
+			confirmOrExit(flags["--yes"], i18n.T("Revoke all pending invites?"))
+			n, err := um.RevokeInvites()
+			if err != nil {
+				i18n.Printf("Error revoking invites: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("%d invites revoked.\n", n)
+			return
+
+		case "export-client":
+			if err := exportClient(os.Args[2:]); err != nil {
+				i18n.Printf("Error exporting client profile: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("User '%s' disabled successfully!\n", os.Args[2])
+			return
+
+		case "set-schedule":
+			if len(os.Args) < 4 {
+				i18n.Println("Usage: ssh-ify set-schedule <username> <days> <start>-<end> | none")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.SetSchedule(os.Args[2], strings.Join(os.Args[3:], " ")); err != nil {
+				i18n.Printf("Error setting schedule: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Schedule for user '%s' updated successfully!\n", os.Args[2])
+			return
+
+		case "set-plan":
+			if len(os.Args) != 4 {
+				i18n.Println("Usage: ssh-ify set-plan <username> <plan> | none")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.SetPlan(os.Args[2], os.Args[3]); err != nil {
+				i18n.Printf("Error setting plan: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Plan for user '%s' updated successfully!\n", os.Args[2])
+			return
+
+		case "set-expiry":
+			if len(os.Args) != 4 {
+				i18n.Println("Usage: ssh-ify set-expiry <username> <YYYY-MM-DD> | <days>d | none")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.SetExpiry(os.Args[2], os.Args[3]); err != nil {
+				i18n.Printf("Error setting expiry: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Expiry for user '%s' updated successfully!\n", os.Args[2])
+			return
+
+		case "add-client-cert":
+			if len(os.Args) != 4 {
+				i18n.Println("Usage: ssh-ify add-client-cert <username> <sha256:..|dns:..|email:..|uri:..|cert.pem>")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.AddClientCert(os.Args[2], os.Args[3]); err != nil {
+				i18n.Printf("Error adding client certificate: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Client certificate mapped to user '%s' successfully!\n", os.Args[2])
+			return
+
+		case "remove-client-cert":
+			if len(os.Args) != 4 {
+				i18n.Println("Usage: ssh-ify remove-client-cert <username> <identity>")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.RemoveClientCert(os.Args[2], os.Args[3]); err != nil {
+				i18n.Printf("Error removing client certificate: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Client certificate removed from user '%s' successfully!\n", os.Args[2])
+			return
+
+		case "add-admin":
+			if len(os.Args) < 5 || len(os.Args) > 6 {
+				i18n.Println("Usage: ssh-ify add-admin <admin> <password> <superadmin|reseller> [quota]")
+				os.Exit(1)
+			}
+			quota := 0
+			if len(os.Args) == 6 {
+				var err error
+				if quota, err = strconv.Atoi(os.Args[5]); err != nil {
+					i18n.Printf("Invalid quota: %s\n", os.Args[5])
+					os.Exit(1)
+				}
+			}
+			um := newManager()
+			if err := um.AddAdmin(os.Args[2], os.Args[3], os.Args[4], quota); err != nil {
+				i18n.Printf("Error adding admin: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Admin '%s' added successfully!\n", os.Args[2])
+			return
+
+		case "remove-admin":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify remove-admin <admin>")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.RemoveAdmin(os.Args[2]); err != nil {
+				i18n.Printf("Error removing admin: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Admin '%s' removed successfully!\n", os.Args[2])
+			return
+
+		case "set-quota":
+			if len(os.Args) != 4 {
+				i18n.Println("Usage: ssh-ify set-quota <admin> <quota>")
+				os.Exit(1)
+			}
+			quota, err := strconv.Atoi(os.Args[3])
+			if err != nil {
+				i18n.Printf("Invalid quota: %s\n", os.Args[3])
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.SetAdminQuota(os.Args[2], quota); err != nil {
+				i18n.Printf("Error setting quota: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Quota for admin '%s' updated successfully!\n", os.Args[2])
+			return
+
+		case "list-admins":
+			um := newManager()
+			if err := um.ListAdmins(); err != nil {
+				i18n.Printf("Error listing admins: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "create-token":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify create-token <admin>")
+				os.Exit(1)
+			}
+			um := newManager()
+			token, err := um.CreateToken(os.Args[2])
+			if err != nil {
+				i18n.Printf("Error creating token: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Token for admin '%s' (shown only once):\n%s\n", os.Args[2], token)
+			return
+
+		case "revoke-tokens":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify revoke-tokens <admin>")
+				os.Exit(1)
+			}
+			um := newManager()
+			if err := um.RevokeTokens(os.Args[2]); err != nil {
+				i18n.Printf("Error revoking tokens: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Tokens of admin '%s' revoked successfully!\n", os.Args[2])
+			return
+
+		case "report":
+			month := time.Now().Format("2006-01")
+			format := accounting.FormatTable
+			for i := 2; i < len(os.Args); i++ {
+				switch {
+				case os.Args[i] == "--month" && i+1 < len(os.Args):
+					i++
+					month = os.Args[i]
+				case os.Args[i] == "--format" && i+1 < len(os.Args):
+					i++
+					format = os.Args[i]
+				default:
+					i18n.Println("Usage: ssh-ify report [--month YYYY-MM] [--format table|csv|json]")
+					os.Exit(1)
+				}
+			}
+			if err := printReport(month, format); err != nil {
+				i18n.Printf("Error generating report: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "top":
+			interval := top.DefaultInterval
+			if len(os.Args) == 4 && os.Args[2] == "--interval" {
+				var err error
+				if interval, err = time.ParseDuration(os.Args[3]); err != nil || interval <= 0 {
+					i18n.Printf("Invalid interval: %s\n", os.Args[3])
+					os.Exit(1)
+				}
+			} else if len(os.Args) != 2 {
+				i18n.Println("Usage: ssh-ify top [--interval 1s]")
+				os.Exit(1)
+			}
+			socket, err := config.GetAdminSocketPath()
+			if err != nil {
+				i18n.Printf("Error locating admin socket: %v\n", err)
+				os.Exit(1)
+			}
+			if err := top.New(socket, interval, os.Stdout).Run(); err != nil {
+				i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "sessions":
+			var user string
+			if len(os.Args) == 4 && os.Args[2] == "--user" {
+				user = os.Args[3]
+			} else if len(os.Args) != 2 {
+				i18n.Println("Usage: ssh-ify sessions [--user <user>]")
+				os.Exit(1)
+			}
+			sessions, err := tunnel.FetchSessions(context.Background(), newAdminClient())
+			if err != nil {
+				i18n.Printf("Error listing sessions: %v\n", err)
+				os.Exit(1)
+			}
+			printSessions(sessions, user)
+			return
+
+		case "list-bans":
+			bans, err := tunnel.FetchBans(context.Background(), newAdminClient())
+			if err != nil {
+				i18n.Printf("Error listing bans: %v\n", err)
+				os.Exit(1)
+			}
+			printBans(bans)
+			return
+
+		case "unban":
+			if len(os.Args) != 3 {
+				i18n.Println("Usage: ssh-ify unban <ip>")
+				os.Exit(1)
+			}
+			if err := tunnel.Unban(context.Background(), newAdminClient(), os.Args[2]); err != nil {
+				i18n.Printf("Error lifting ban: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Ban of '%s' lifted successfully!\n", os.Args[2])
+			return
+
+		case "listeners":
+			listeners, err := tunnel.FetchListeners(context.Background(), newAdminClient())
+			if err != nil {
+				i18n.Printf("Error listing listeners: %v\n", err)
+				os.Exit(1)
+			}
+			printListeners(listeners)
+			return
+
+		case "listener":
+			persist := len(os.Args) == 5 && os.Args[4] == "--persist"
+			if (len(os.Args) != 4 && !persist) || (os.Args[2] != "enable" && os.Args[2] != "disable") {
+				i18n.Println("Usage: ssh-ify listener enable|disable <name> [--persist]")
+				os.Exit(1)
+			}
+			state := tunnel.ListenerState{Enabled: os.Args[2] == "enable", Persist: persist}
+			if err := tunnel.SetListener(context.Background(), newAdminClient(), os.Args[3], state); err != nil {
+				i18n.Printf("Error updating listener: %v\n", err)
+				os.Exit(1)
+			}
+			if state.Enabled {
+				i18n.Printf("Listener '%s' enabled successfully!\n", os.Args[3])
+			} else {
+				i18n.Printf("Listener '%s' disabled successfully!\n", os.Args[3])
+			}
+			return
+
+		case "settings":
+			settings, err := tunnel.FetchSettings(context.Background(), newAdminClient())
+			if err != nil {
+				i18n.Printf("Error listing settings: %v\n", err)
+				os.Exit(1)
+			}
+			printSettings(settings)
+			return
+
+		case "setting":
+			persist := len(os.Args) == 5 && os.Args[4] == "--persist"
+			if len(os.Args) != 4 && !persist {
+				i18n.Println("Usage: ssh-ify setting <name> <value> [--persist]")
+				os.Exit(1)
+			}
+			change := tunnel.SettingChange{Value: os.Args[3], Persist: persist}
+			if err := tunnel.SetSetting(context.Background(), newAdminClient(), os.Args[2], change); err != nil {
+				i18n.Printf("Error updating setting: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Setting '%s' updated successfully!\n", os.Args[2])
+			return
+
+		case "maintenance":
+			if err := runMaintenance(os.Args[2:]); err != nil {
+				i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "policy":
+			runPolicy(os.Args[2:])
+			return
+
+		case "audit":
+			if err := runAudit(os.Args[2:]); err != nil {
+				i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "cluster-status":
+			nodes, err := tunnel.FetchClusterStats()
+			if err != nil {
+				i18n.Printf("Error reading cluster status: %v\n", err)
+				os.Exit(1)
+			}
+			printClusterStatus(nodes)
+			return
+
+		case "host-key":
+			pub, err := ssh.HostPublicKey()
+			if err != nil {
+				i18n.Printf("Error loading host key: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(pub))
+			return
+
+		case "tunnel-token":
+			if tunnel.TunnelKey == "" {
+				i18n.Println("Error: SSH_IFY_TUNNEL_KEY is not set")
+				os.Exit(1)
+			}
+			fmt.Println(tunnel.SignTunnelKey(tunnel.TunnelKey, time.Now()))
+			return
+
+		case "solve-pow":
+			if len(os.Args) < 3 {
+				i18n.Println("Usage: ssh-ify solve-pow <challenge>")
+				os.Exit(1)
+			}
+			solution, err := tunnel.SolvePoW(os.Args[2])
+			if err != nil {
+				i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(solution)
+			return
+
+		case "doctor":
+			results := doctor.Run(doctor.Checks())
+			if !doctor.PrintReport(os.Stdout, results) {
+				os.Exit(1)
+			}
+			return
+
+		case "version", "-v", "--version":
+			i18n.Println(version.Info())
+			if len(os.Args) > 2 && os.Args[2] == "--check-update" {
+				release, err := version.LatestRelease()
+				if err != nil {
+					i18n.Printf("Error checking for updates: %v\n", err)
+					os.Exit(1)
+				}
+				if release.IsNewer() {
+					i18n.Printf("A new release is available: %s (%s)\n", release.TagName, release.HTMLURL)
+					i18n.Println("Run 'ssh-ify self-update' to install it.")
+				} else {
+					i18n.Println("You are running the latest release.")
+				}
+			}
+			return
+
+		case "self-update":
+			release, err := version.LatestRelease()
+			if err != nil {
+				i18n.Printf("Error checking for updates: %v\n", err)
+				os.Exit(1)
+			}
+			if !release.IsNewer() {
+				i18n.Printf("Already running the latest release (%s).\n", release.TagName)
+				return
+			}
+			if err := version.SelfUpdate(release); err != nil {
+				i18n.Printf("Error updating: %v\n", err)
+				os.Exit(1)
+			}
+			i18n.Printf("Updated to %s. Restart ssh-ify to use the new version.\n", release.TagName)
 			return
 
 		case "help", "-h", "--help":
@@ -82,7 +661,7 @@ func main() {
 			return
 
 		default:
-			fmt.Printf("Unknown command: %s\n", os.Args[1])
+			i18n.Printf("Unknown command: %s\n", os.Args[1])
 			printUsage()
 			os.Exit(1)
 		}
@@ -91,29 +670,544 @@ func main() {
 	// Initialize user management and create default user from environment variables if needed
 	um := usermgmt.NewManager("")
 	if err := um.CreateDefaultUserFromEnv(); err != nil {
-		fmt.Printf("Warning: Failed to create default user from environment variables: %v\n", err)
+		i18n.Printf("Warning: Failed to create default user from environment variables: %v\n", err)
 	}
 
 	// Start the server defined in the tunnel package.
 	tunnel.StartServer()
 }
 
+// asAdmin is the admin named with the global "--as" option, if any.
+var asAdmin string
+
+// stdin reads answers to prompts, so that consecutive prompts share its buffer.
+var stdin = bufio.NewReader(os.Stdin)
+
+// newManager returns a user manager, scoped to the "--as" admin when one was given.
+// The admin password is read from SSH_IFY_ADMIN_PASSWORD or prompted for.
+func newManager() *usermgmt.Manager {
+	usermgmt.ActiveSessions = countServerSessions
+	um := usermgmt.NewManager("")
+	if asAdmin == "" {
+		return um
+	}
+
+	password := os.Getenv("SSH_IFY_ADMIN_PASSWORD")
+	if password == "" {
+		i18n.Printf("Password for admin '%s': ", asAdmin)
+		line, err := stdin.ReadString('\n')
+		if err != nil {
+			i18n.Printf("Error reading password: %v\n", err)
+			os.Exit(1)
+		}
+		password = strings.TrimSpace(line)
+	}
+	if err := um.LoginAdmin(asAdmin, password); err != nil {
+		i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return um
+}
+
+// printReport writes the usage report for month. Resellers only see their own users.
+func printReport(month, format string) error {
+	from, to, err := accounting.MonthRange(month)
+	if err != nil {
+		return err
+	}
+	records, err := accounting.NewStore("").Records(from, to)
+	if err != nil {
+		return err
+	}
+
+	um := newManager()
+	if actor := um.Actor(); actor != nil && !actor.IsSuperAdmin() {
+		owned := make(map[string]bool)
+		for _, username := range um.GetUserDB().ListUsersByOwner(actor.Username) {
+			owned[username] = true
+		}
+		visible := records[:0]
+		for _, rec := range records {
+			if owned[rec.Username] {
+				visible = append(visible, rec)
+			}
+		}
+		records = visible
+	}
+
+	return accounting.WriteReport(os.Stdout, accounting.Summarize(records), format)
+}
+
+// createInviteUsage describes the arguments of the create-invite command.
+const createInviteUsage = "Usage: ssh-ify create-invite [--plan <plan>] [--schedule <spec>] [--expiry <YYYY-MM-DD|days>] [--ttl <duration>]"
+
+// createInvite creates an invite for one account and prints its token, with a link to the
+// signup page when it and the public host are configured.
+func createInvite(args []string) error {
+	var plan, schedule, expiry string
+	ttl := usermgmt.InviteTTL
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--plan" && i+1 < len(args):
+			i++
+			plan = args[i]
+		case args[i] == "--schedule" && i+1 < len(args):
+			i++
+			schedule = args[i]
+		case args[i] == "--expiry" && i+1 < len(args):
+			i++
+			expiry = args[i]
+		case args[i] == "--ttl" && i+1 < len(args):
+			i++
+			var err error
+			if ttl, err = time.ParseDuration(args[i]); err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid duration %q", args[i])
+			}
+		default:
+			i18n.Println(createInviteUsage)
+			os.Exit(1)
+		}
+	}
+
+	token, expires, err := newManager().CreateInvite(plan, schedule, expiry, ttl)
+	if err != nil {
+		return err
+	}
+	i18n.Printf("Invite for one account (shown only once, valid until %s):\n%s\n", expires.Format("2006-01-02 15:04:05"), token)
+	if link := tunnel.SignupLink(token); link != "" {
+		i18n.Printf("Signup link: %s\n", link)
+	}
+	return nil
+}
+
+// exportClientUsage describes the arguments of the export-client command.
+const exportClientUsage = "Usage: ssh-ify export-client <username> [--host <host>] [--port <port>] [--sni <name>] [--format json|ehi|openssh|qr]"
+
+// exportClient prints the connection profile of a user in a format tunnel clients import.
+// The host defaults to SSH_IFY_PUBLIC_HOST, and the port and TLS to the listener clients
+// should tunnel through.
+func exportClient(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		i18n.Println(exportClientUsage)
+		os.Exit(1)
+	}
+	username, host, format := args[0], clientconfig.PublicHost, clientconfig.FormatJSON
+	var port int
+	var sni string
+	for i := 1; i < len(args); i++ {
+		switch {
+		case args[i] == "--host" && i+1 < len(args):
+			i++
+			host = args[i]
+		case args[i] == "--port" && i+1 < len(args):
+			i++
+			var err error
+			if port, err = strconv.Atoi(args[i]); err != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("invalid port %q", args[i])
+			}
+		case args[i] == "--sni" && i+1 < len(args):
+			i++
+			sni = args[i]
+		case args[i] == "--format" && i+1 < len(args):
+			i++
+			format = args[i]
+		default:
+			i18n.Println(exportClientUsage)
+			os.Exit(1)
+		}
+	}
+	if host == "" {
+		return fmt.Errorf("no host given; pass --host or set SSH_IFY_PUBLIC_HOST")
+	}
+
+	if _, err := newManager().GetUser(username); err != nil {
+		return err
+	}
+	cfg, err := tunnel.ClientConfig(username, host, tunnel.DefaultListeners())
+	if err != nil {
+		return err
+	}
+	if port != 0 {
+		cfg.Port = port
+	}
+	if sni != "" && cfg.TLS {
+		cfg.SNI = sni
+	}
+	return cfg.Write(os.Stdout, format)
+}
+
+// splitFlags separates the boolean flags among names from the other arguments.
+func splitFlags(args []string, names ...string) ([]string, map[string]bool) {
+	var rest []string
+	flags := make(map[string]bool)
+	for _, arg := range args {
+		if slices.Contains(names, arg) {
+			flags[arg] = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return rest, flags
+}
+
+// confirmOrExit asks prompt and exits unless the answer is yes. It does not ask if yes
+// is set, which the --yes flag of destructive commands does for scripts.
+func confirmOrExit(yes bool, prompt string) {
+	if yes {
+		return
+	}
+	if !usermgmt.Confirm(stdin, prompt) {
+		i18n.Println("Aborted; pass --yes to skip this confirmation.")
+		os.Exit(1)
+	}
+}
+
+// countServerSessions returns the number of sessions username has open on the running
+// server, or the cluster in cluster mode.
+func countServerSessions(username string) (int, error) {
+	sessions, err := tunnel.FetchSessions(context.Background(), newAdminClient())
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, sess := range sessions {
+		if sess.User == username {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// newAdminClient returns a client for the running server's admin socket.
+func newAdminClient() *http.Client {
+	socket, err := config.GetAdminSocketPath()
+	if err != nil {
+		i18n.Printf("Error locating admin socket: %v\n", err)
+		os.Exit(1)
+	}
+	return tunnel.NewAdminClient(socket)
+}
+
+// maintenanceUsage describes the arguments of the maintenance command.
+const maintenanceUsage = "Usage: ssh-ify maintenance on [--message <text>] [--shutdown-in <duration>] [--warn <duration>]\n" +
+	"       ssh-ify maintenance off|status"
+
+// runMaintenance starts, ends or reports maintenance mode of the running server.
+func runMaintenance(args []string) error {
+	if len(args) == 0 {
+		i18n.Println(maintenanceUsage)
+		os.Exit(1)
+	}
+	ctx, client := context.Background(), newAdminClient()
+	switch args[0] {
+	case "on":
+		var req tunnel.MaintenanceRequest
+		for i := 1; i < len(args); i++ {
+			var err error
+			switch {
+			case args[i] == "--message" && i+1 < len(args):
+				i++
+				req.Message = args[i]
+			case args[i] == "--shutdown-in" && i+1 < len(args):
+				i++
+				req.ShutdownIn, err = time.ParseDuration(args[i])
+			case args[i] == "--warn" && i+1 < len(args):
+				i++
+				req.WarnBefore, err = time.ParseDuration(args[i])
+			default:
+				i18n.Println(maintenanceUsage)
+				os.Exit(1)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if req.WarnBefore > 0 && req.ShutdownIn <= 0 {
+			return fmt.Errorf("--warn needs --shutdown-in")
+		}
+		m, err := tunnel.StartMaintenance(ctx, client, req)
+		if err != nil {
+			return err
+		}
+		printMaintenance(m)
+	case "off":
+		if len(args) != 1 {
+			i18n.Println(maintenanceUsage)
+			os.Exit(1)
+		}
+		if err := tunnel.EndMaintenance(ctx, client); err != nil {
+			return err
+		}
+		i18n.Println("Maintenance mode off; new sessions are accepted again.")
+	case "status":
+		m, err := tunnel.FetchMaintenance(ctx, client)
+		if err != nil {
+			return err
+		}
+		printMaintenance(m)
+	default:
+		i18n.Println(maintenanceUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// policyUsage describes the arguments of the policy command.
+const policyUsage = "Usage: ssh-ify policy test <user> <host:port>\n" +
+	"       ssh-ify policy reload"
+
+// runPolicy explains how the rules of a user's plan and the forwarding policy decide a
+// destination, exiting with status 1 if it is denied, or reloads the running server's
+// forwarding policy and plans.
+func runPolicy(args []string) {
+	if len(args) == 1 && args[0] == "reload" {
+		if err := tunnel.ReloadPolicy(context.Background(), newAdminClient()); err != nil {
+			i18n.Printf("Error reloading policy: %v\n", err)
+			os.Exit(1)
+		}
+		i18n.Println("Forwarding policy and plans reloaded successfully!")
+		return
+	}
+	if len(args) != 3 || args[0] != "test" {
+		i18n.Println(policyUsage)
+		os.Exit(1)
+	}
+	user, target := args[1], args[2]
+	host, portText, err := net.SplitHostPort(target)
+	port, portErr := strconv.Atoi(portText)
+	if err != nil || portErr != nil || host == "" || port <= 0 || port > 65535 {
+		i18n.Printf("Invalid destination '%s', expected <host:port>\n", target)
+		os.Exit(1)
+	}
+
+	ssh.InitializeAuth("")
+	decision := ssh.ExplainForward(user, host, port)
+	if !decision.Allowed {
+		i18n.Printf("%s may not connect to %s: denied by %s\n", user, target, decision.Rule)
+		os.Exit(1)
+	}
+	i18n.Printf("%s may connect to %s: allowed by %s\n", user, target, decision.Rule)
+	if decision.Via != nil {
+		i18n.Printf("Connections go through upstream %s\n", decision.Via.Name())
+	}
+}
+
+// auditUsage describes the arguments of the audit command.
+const auditUsage = "Usage: ssh-ify audit export [--since <time>] [--until <time>] [--user <user>] [--ip <ip>]\n" +
+	"       [--destination <host[:port]>] [--format json|csv]"
+
+// runAudit streams the forwarding decisions of the running server's policy audit log
+// matching the given filters to standard output.
+func runAudit(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		i18n.Println(auditUsage)
+		os.Exit(1)
+	}
+	params := map[string]string{
+		"--since": "since", "--until": "until", "--user": "user", "--ip": "ip",
+		"--destination": "destination", "--format": "format",
+	}
+	query := url.Values{}
+	for i := 1; i < len(args); i++ {
+		name, ok := params[args[i]]
+		if !ok || i+1 >= len(args) {
+			i18n.Println(auditUsage)
+			os.Exit(1)
+		}
+		i++
+		if name == "since" || name == "until" {
+			if _, err := tunnel.ParseAuditTime(args[i], time.Now()); err != nil {
+				return err
+			}
+		}
+		query.Set(name, args[i])
+	}
+	return tunnel.ExportAudit(context.Background(), newAdminClient(), query, os.Stdout)
+}
+
+// printMaintenance describes maintenance mode, or its absence.
+func printMaintenance(m *tunnel.Maintenance) {
+	if m == nil {
+		i18n.Println("Maintenance mode is off.")
+		return
+	}
+	i18n.Printf("Maintenance mode on since %s\n", m.Since.Format("2006-01-02 15:04:05"))
+	i18n.Printf("Message:  %s\n", m.Message)
+	if !m.ShutdownAt.IsZero() {
+		i18n.Printf("Sessions: closed at %s\n", m.ShutdownAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// printSessions prints the active sessions the admin may manage, optionally only those
+// of user.
+func printSessions(sessions []tunnel.NodeSession, user string) {
+	um := newManager()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Session\tNode\tUser\tClient\tVersion\tSince\tIn\tOut")
+	shown := 0
+	for _, sess := range sessions {
+		if (user != "" && sess.User != user) || !um.CanManage(sess.User) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			sess.ID, sess.Node, sess.User, sess.Client, sess.ClientVersion, sess.Since.Format("2006-01-02 15:04:05"),
+			accounting.FormatBytes(sess.BytesIn), accounting.FormatBytes(sess.BytesOut))
+		shown++
+	}
+	w.Flush()
+	i18n.Printf("%d active sessions\n", shown)
+}
+
+// printBans prints the banned IPs sorted by address with the time left on each ban.
+func printBans(bans map[string]time.Time) {
+	if len(bans) == 0 {
+		i18n.Println("No banned IPs.")
+		return
+	}
+	ips := make([]string, 0, len(bans))
+	for ip := range bans {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IP\tExpires\tRemaining")
+	for _, ip := range ips {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", ip, bans[ip].Format("2006-01-02 15:04:05"), time.Until(bans[ip]).Truncate(time.Second))
+	}
+	w.Flush()
+}
+
+// printListeners prints the tunnel listeners and whether each is enabled and listening.
+func printListeners(listeners []tunnel.ListenerInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tAddress\tTLS\tEnabled\tListening")
+	for _, l := range listeners {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%t\n", l.Name, l.Addr, l.TLS, l.Enabled, l.Listening)
+	}
+	w.Flush()
+}
+
+// printSettings prints the settings that can be changed at runtime and where their
+// values come from.
+func printSettings(settings []config.Setting) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tValue\tDefault\tSource")
+	for _, st := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", st.Name, st.Value, st.Default, st.Source)
+	}
+	w.Flush()
+}
+
+// printClusterStatus prints one line per live cluster node followed by the totals.
+func printClusterStatus(nodes []tunnel.NodeStats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Node\tSessions\tIn\tOut\tUptime\tUpdated")
+	var sessions int
+	var in, out int64
+	for _, n := range nodes {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s ago\n",
+			n.Node, len(n.Sessions),
+			accounting.FormatBytes(n.BytesIn), accounting.FormatBytes(n.BytesOut),
+			n.Time.Sub(n.StartedAt).Truncate(time.Second),
+			time.Since(n.Time).Truncate(time.Second))
+		sessions += len(n.Sessions)
+		in += n.BytesIn
+		out += n.BytesOut
+	}
+	fmt.Fprintf(w, "Total (%d nodes)\t%d\t%s\t%s\t\t\n",
+		len(nodes), sessions, accounting.FormatBytes(in), accounting.FormatBytes(out))
+	w.Flush()
+}
+
 // printUsage prints CLI usage information.
 func printUsage() {
-	fmt.Println(`SSH-ify - SSH Tunnel Proxy Server
+	i18n.Println(`SSH-ify - SSH Tunnel Proxy Server
 
 Usage:
+  ssh-ify [--as <admin>] <command>  - Run a command with an admin's permissions
+  ssh-ify [--lang <code>] <command> - Show messages in en, es, pt or id (or set SSH_IFY_LANG)
   ssh-ify                           - Start the server
   ssh-ify user-mgmt                 - Interactive user management
   ssh-ify add-user <user> <pass>    - Add a user
-  ssh-ify remove-user <user>        - Remove a user
-  ssh-ify list-users                - List all users
+  ssh-ify remove-user <user> [--archive] [--yes]
+                                    - Remove a user, or archive them so they can be restored
+  ssh-ify list-archived             - List archived users
+  ssh-ify unarchive-user <user>     - Restore an archived user
+  ssh-ify purge-archived [user] [--yes]
+                                    - Delete an archived user, or all of them, for good
+  ssh-ify restore-users <file> [--yes]
+                                    - Replace all users with those of a backup
+  ssh-ify list-users [--owner <o>]  - List all users, or those owned by <o>
+  ssh-ify show-user <user>          - Show all details of a user
+  ssh-ify set-info <user> <f> <val> - Set notes, contact or owner of a user
   ssh-ify enable-user <user>        - Enable a user
   ssh-ify disable-user <user>       - Disable a user
+  ssh-ify unlock-user <user>        - Lift the brute-force lock of a user
+  ssh-ify reset-token <user>        - Create a one-time token for the user to set a new password
+  ssh-ify create-invite [--plan <p>] [--schedule <s>] [--expiry <e>] [--ttl 168h]
+                                    - Create a one-time invite to sign up for an account
+  ssh-ify list-invites              - List pending invites
+  ssh-ify revoke-invites [--yes]    - Revoke all pending invites
+  ssh-ify export-client <user> [--host <h>] [--port <p>] [--sni <s>] [--format json|ehi|openssh|qr]
+                                    - Print a client profile or QR code for a user
+  ssh-ify set-schedule <user> <sch> - Restrict login hours (or 'none')
+  ssh-ify set-plan <user> <plan>    - Assign a user to a plan from plans.yaml (or 'none')
+  ssh-ify set-expiry <user> <date>  - Expire an account on YYYY-MM-DD or after <days>d (or 'none')
+  ssh-ify add-client-cert <user> <id>
+                                    - Map a TLS client certificate to a user
+  ssh-ify remove-client-cert <user> <id>
+                                    - Remove a client certificate mapping
+  ssh-ify add-admin <a> <pass> <role> [quota]
+                                    - Add a superadmin or reseller admin
+  ssh-ify remove-admin <admin>      - Remove an admin
+  ssh-ify set-quota <admin> <quota> - Set a reseller's user quota (0 = unlimited)
+  ssh-ify list-admins               - List all admins
+  ssh-ify create-token <admin>      - Create an API token for the web dashboard
+  ssh-ify revoke-tokens <admin>     - Revoke all API tokens of an admin
+  ssh-ify report [--month YYYY-MM] [--format table|csv|json]
+                                    - Per-user usage totals for a month
+  ssh-ify top [--interval 1s]       - Live dashboard of sessions and throughput
+  ssh-ify sessions [--user <user>]  - List active sessions on every cluster node
+  ssh-ify list-bans                 - List client IPs banned for failed logins
+  ssh-ify unban <ip>                - Lift the ban of a client IP
+  ssh-ify listeners                 - List the tunnel listeners and their state
+  ssh-ify listener enable|disable <name> [--persist]
+                                    - Start or stop accepting connections on a listener
+  ssh-ify settings                  - List the settings that can be changed at runtime
+  ssh-ify setting <name> <value> [--persist]
+                                    - Change a setting, optionally saving it to settings.json
+  ssh-ify maintenance on [--message <text>] [--shutdown-in 30m] [--warn 5m]
+                                    - Refuse new tunnels, optionally closing sessions later
+  ssh-ify maintenance off|status    - End or show maintenance mode
+  ssh-ify policy test <user> <host:port>
+                                    - Explain whether the forwarding rules allow a destination
+  ssh-ify policy reload             - Reload the running server's forwarding policy and plans
+  ssh-ify audit export [--since 24h] [--until <t>] [--user <u>] [--ip <ip>] [--destination <d>] [--format json|csv]
+                                    - Stream forwarding decisions from the policy audit log
+  ssh-ify cluster-status            - Sessions and traffic of every cluster node
+  ssh-ify host-key                  - Print the SSH host public key for a host CA to sign
+  ssh-ify tunnel-token              - Print a one-time signed X-Tunnel-Key header value
+  ssh-ify solve-pow <challenge>     - Print an X-Tunnel-PoW header value solving a challenge
+  ssh-ify doctor                    - Run diagnostics and print a report
+  ssh-ify version [--check-update]  - Show build information
+  ssh-ify self-update               - Download and install the latest release
   ssh-ify help                      - Show this help
 
 Examples:
   ssh-ify add-user alice mypassword
   ssh-ify remove-user alice
+  ssh-ify set-schedule alice weekdays 09:00-18:00
+  ssh-ify set-plan alice premium
+  ssh-ify set-expiry alice 30d
+  ssh-ify set-info alice owner reseller1
+  ssh-ify add-client-cert robot client.pem
+  ssh-ify add-admin reseller1 s3cretpass reseller 50
+  ssh-ify --as reseller1 add-user bob bobpass
+  ssh-ify --as reseller1 create-invite --plan premium --expiry 30d
+  ssh-ify export-client alice --host tunnel.example.com --format qr
+  ssh-ify report --month 2024-06 --format csv
+  ssh-ify maintenance on --message "Back at 02:00 UTC" --shutdown-in 30m --warn 5m
+  ssh-ify policy test alice example.com:443
+  ssh-ify audit export --since 2024-06-01 --user alice --format csv
   ssh-ify user-mgmt`)
 }
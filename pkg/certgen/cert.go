@@ -13,15 +13,24 @@ import (
 	"time"
 )
 
+// DefaultKeyBits is the size of the RSA key generated by GenerateCert.
+const DefaultKeyBits = 2048
+
 // GenerateCert generates a self-signed X.509 certificate and RSA private key.
 func GenerateCert(certFile, keyFile string) error {
+	return GenerateCertWithKeySize(certFile, keyFile, DefaultKeyBits)
+}
+
+// GenerateCertWithKeySize generates a self-signed X.509 certificate and an RSA private
+// key of the given size in bits.
+func GenerateCertWithKeySize(certFile, keyFile string, bits int) error {
 	// Return early if both cert and key files exist
 	if fileExists(certFile) && fileExists(keyFile) {
 		return nil
 	}
 
 	// Generate private key
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return fmt.Errorf("failed to generate private key: %w", err)
 	}